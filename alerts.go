@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// maxAlertHistory fired and resolved alerts kept by the engine
+const maxAlertHistory = 1000
+
+// alertHistoryPrefix keys of the history in the store
+const alertHistoryPrefix = "alerts/history/"
+
+// alert severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// AlertRule : objects of a resource matching the filter are alerting
+type AlertRule struct {
+	Name     string `yaml:"name" json:"name"`
+	Resource string `yaml:"resource" json:"resource"`
+	// Filter expression, like messages>10000 and consumers=0
+	Filter string `yaml:"filter" json:"filter"`
+	// Expr script objects have to match as well, like
+	// messages > 3 * avg_over("queue_messages", "24h")
+	Expr     string `yaml:"expr,omitempty" json:"expr,omitempty"`
+	Severity string `yaml:"severity" json:"severity"`
+	// Summary shown for the alert, defaults to the rule name
+	Summary string `yaml:"summary,omitempty" json:"summary,omitempty"`
+	filter  FilterExpr
+	script  *Script
+}
+
+// AlertRules : rules file of the alert engine
+type AlertRules struct {
+	Rules []AlertRule `yaml:"rules" json:"rules"`
+}
+
+// LoadAlertRules read and validate a rules yaml file
+func LoadAlertRules(file string) (AlertRules, error) {
+	var rules AlertRules
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return rules, err
+	}
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("%s: %s", file, err)
+	}
+	return rules, rules.compile()
+}
+
+// compile parse the filters of all rules
+func (rules AlertRules) compile() error {
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i+1)
+		}
+		if !isPollResource(rule.Resource) || rule.Resource == ResourceOverview {
+			return fmt.Errorf("rule %s: unknown list resource %q", rule.Name, rule.Resource)
+		}
+		if rule.Severity == "" {
+			rule.Severity = SeverityWarning
+		}
+		if !contains([]string{SeverityInfo, SeverityWarning, SeverityCritical}, rule.Severity) {
+			return fmt.Errorf("rule %s: unknown severity %q", rule.Name, rule.Severity)
+		}
+		filter, err := ParseFilterExpr(rule.Filter)
+		if err != nil {
+			return fmt.Errorf("rule %s: %s", rule.Name, err)
+		}
+		rule.filter = filter
+		if rule.Expr != "" {
+			if rule.script, err = ParseScript(rule.Expr); err != nil {
+				return fmt.Errorf("rule %s: %s", rule.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Alert : a rule firing for one object
+type Alert struct {
+	ID       string     `json:"id"`
+	Rule     string     `json:"rule"`
+	Severity string     `json:"severity"`
+	Summary  string     `json:"summary"`
+	Vhost    string     `json:"vhost,omitempty"`
+	Object   string     `json:"object"`
+	Fired    time.Time  `json:"fired"`
+	Resolved *time.Time `json:"resolved,omitempty"`
+	// Acked user that acknowledged the alert
+	Acked string `json:"acked,omitempty"`
+	// SilencedUntil the alert is not notified before
+	SilencedUntil *time.Time `json:"silencedUntil,omitempty"`
+	// Maintenance window the alert fired in, Suppressed when the window
+	// keeps it from being notified
+	Maintenance string `json:"maintenance,omitempty"`
+	Suppressed  bool   `json:"suppressed,omitempty"`
+}
+
+// Silenced true while a silence is in effect
+func (alert Alert) Silenced(now time.Time) bool {
+	return alert.SilencedUntil != nil && now.Before(*alert.SilencedUntil)
+}
+
+// alertID stable id of a rule firing for an object
+func alertID(rule string, vhost string, object string) string {
+	sum := sha1.Sum([]byte(rule + "\x00" + vhost + "\x00" + object))
+	return hex.EncodeToString(sum[:8])
+}
+
+// AlertChange : an alert that fired, resolved, was acked or silenced
+type AlertChange struct {
+	Type  string `json:"type"`
+	Alert Alert  `json:"alert"`
+}
+
+// alertState : acks and silences, persisted in the store of the server
+type alertState struct {
+	Acks     map[string]string    `json:"acks"`
+	Silences map[string]time.Time `json:"silences"`
+}
+
+// AlertEngine evaluates the rules against snapshots and keeps the active
+// alerts and their history
+type AlertEngine struct {
+	mutex   sync.Mutex
+	rules   AlertRules
+	active  map[string]*Alert
+	history []Alert
+	state   alertState
+	store   KVStore
+	// metrics history the scripts of rules can read
+	metrics *MetricHistory
+	// maintenance windows alerts are suppressed or annotated in
+	maintenance Maintenance
+	// Changes receives every change of an alert
+	Changes *Broadcaster
+}
+
+// NewAlertEngine create an engine, acks and silences are persisted in store
+// when it is not nil
+func NewAlertEngine(rules AlertRules, store KVStore) *AlertEngine {
+	engine := &AlertEngine{
+		rules:   rules,
+		active:  map[string]*Alert{},
+		state:   alertState{Acks: map[string]string{}, Silences: map[string]time.Time{}},
+		store:   store,
+		Changes: NewBroadcaster(),
+	}
+	if store != nil {
+		if _, err := getJSON(store, "alerts/state", &engine.state); err != nil {
+			subsystemLog("alerts").Warnf("loading acks and silences failed: %s", err)
+		}
+		if engine.state.Acks == nil {
+			engine.state.Acks = map[string]string{}
+		}
+		if engine.state.Silences == nil {
+			engine.state.Silences = map[string]time.Time{}
+		}
+		if err := engine.loadHistory(); err != nil {
+			subsystemLog("alerts").Warnf("loading the alert history failed: %s", err)
+		}
+	}
+	return engine
+}
+
+// loadHistory read the latest changes of the history from the store
+func (engine *AlertEngine) loadHistory() error {
+	keys, err := engine.store.Keys(alertHistoryPrefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) > maxAlertHistory {
+		keys = keys[len(keys)-maxAlertHistory:]
+	}
+	for _, key := range keys {
+		var alert Alert
+		if _, err := getJSON(engine.store, key, &alert); err != nil {
+			return err
+		}
+		engine.history = append(engine.history, alert)
+	}
+	return nil
+}
+
+// CompactHistory delete the stored changes beyond the history kept by the
+// engine
+func (engine *AlertEngine) CompactHistory(now time.Time) error {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	keys, err := engine.store.Keys(alertHistoryPrefix)
+	if err != nil {
+		return err
+	}
+	for len(keys) > maxAlertHistory {
+		if err := engine.store.Delete(keys[0]); err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// alertHistoryKey store key of a change, keys sort by time
+func alertHistoryKey(change AlertChange, now time.Time) string {
+	return fmt.Sprintf("%s%s-%s-%s", alertHistoryPrefix, now.UTC().Format("20060102T150405.000000000Z"), change.Alert.ID, change.Type)
+}
+
+// UseMetricHistory let the scripts of rules read the metric history
+func (engine *AlertEngine) UseMetricHistory(history *MetricHistory) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.metrics = history
+}
+
+// SetRules replace the rules, alerts of removed rules resolve with the
+// next evaluation
+func (engine *AlertEngine) SetRules(rules AlertRules) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.rules = rules
+}
+
+// SetMaintenance replace the maintenance windows
+func (engine *AlertEngine) SetMaintenance(maintenance Maintenance) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.maintenance = maintenance
+}
+
+// Maintenance the windows in effect at now
+func (engine *AlertEngine) Maintenance(now time.Time) []MaintenanceWindow {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	return engine.maintenance.Active(now)
+}
+
+// Evaluate match the rules against the snapshot, alerts that started or
+// stopped matching are returned and broadcast. Alerts firing in a
+// suppressing maintenance window are marked suppressed, they are fired
+// again when they outlast the window.
+func (engine *AlertEngine) Evaluate(snapshot *Snapshot, now time.Time) []AlertChange {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	matching := map[string]Alert{}
+	env := &ScriptEnv{Info: &snapshot.Info, History: engine.metrics, Now: now}
+	for _, rule := range engine.rules.Rules {
+		list, _, err := ListQuery{Filter: rule.filter, Script: rule.script, Env: env.with(nil, rule.Resource)}.Apply(resourceOf(snapshot.Info, rule.Resource))
+		if err != nil {
+			subsystemLog("alerts").Warnf("rule %s: %s", rule.Name, err)
+			continue
+		}
+		objects, _ := list.([]interface{})
+		for _, item := range objects {
+			object, _ := item.(map[string]interface{})
+			vhost, name := objectIdentity(rule.Resource, object)
+			summary := rule.Summary
+			if summary == "" {
+				summary = rule.Name
+			}
+			id := alertID(rule.Name, vhost, name)
+			matching[id] = Alert{ID: id, Rule: rule.Name, Severity: rule.Severity, Summary: summary, Vhost: vhost, Object: name, Fired: now}
+		}
+	}
+	for _, analyzer := range registeredAnalyzers() {
+		findings, err := analyzer.Analyze(snapshot.Info)
+		if err != nil {
+			// a failing analyzer resolves nothing, its alerts stay active
+			subsystemLog("alerts").Warnf("%s", err)
+			for id, alert := range engine.active {
+				if alert.Rule == analyzer.Name() {
+					matching[id] = *alert
+				}
+			}
+			continue
+		}
+		for _, finding := range findings {
+			summary := finding.Summary
+			if summary == "" {
+				summary = analyzer.Name()
+			}
+			id := alertID(analyzer.Name(), finding.Vhost, finding.Object)
+			matching[id] = Alert{ID: id, Rule: analyzer.Name(), Severity: finding.Severity, Summary: summary, Vhost: finding.Vhost, Object: finding.Object, Fired: now}
+		}
+	}
+	var changes []AlertChange
+	for id, alert := range matching {
+		if active, ok := engine.active[id]; ok {
+			if active.Suppressed {
+				if _, ok := engine.maintenance.Covering(active.Vhost, now); !ok {
+					// still firing after its window, notified now
+					active.Suppressed = false
+					changes = append(changes, AlertChange{Type: "fired", Alert: *active})
+				}
+			}
+			continue
+		}
+		alert := alert
+		if window, ok := engine.maintenance.Covering(alert.Vhost, now); ok {
+			alert.Maintenance = window.Name
+			alert.Suppressed = window.Action == MaintenanceSuppress
+		}
+		engine.decorate(&alert)
+		engine.active[id] = &alert
+		changes = append(changes, AlertChange{Type: "fired", Alert: alert})
+	}
+	acksCleared := false
+	for id, alert := range engine.active {
+		if _, ok := matching[id]; ok {
+			continue
+		}
+		resolved := now
+		alert.Resolved = &resolved
+		delete(engine.active, id)
+		if _, ok := engine.state.Acks[id]; ok {
+			// an ack is for one firing, silences last until they expire
+			delete(engine.state.Acks, id)
+			acksCleared = true
+		}
+		changes = append(changes, AlertChange{Type: "resolved", Alert: *alert})
+	}
+	if acksCleared {
+		engine.saveState()
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Alert.ID < changes[j].Alert.ID })
+	for _, change := range changes {
+		engine.history = append(engine.history, change.Alert)
+		if engine.store != nil {
+			if err := putJSON(engine.store, alertHistoryKey(change, now), change.Alert); err != nil {
+				subsystemLog("alerts").Warnf("storing the alert history failed: %s", err)
+			}
+		}
+		engine.Changes.Publish(change)
+	}
+	if len(engine.history) > maxAlertHistory {
+		engine.history = engine.history[len(engine.history)-maxAlertHistory:]
+	}
+	return changes
+}
+
+// objectIdentity vhost and name of a json object of resource
+func objectIdentity(resource string, object map[string]interface{}) (string, string) {
+	field := func(name string) string {
+		value, _ := lookupField(object, name)
+		str, _ := value.(string)
+		return str
+	}
+	switch resource {
+	case ResourceConsumers:
+		return field("queue.vhost"), field("queue.name") + " " + field("consumer_tag")
+	case ResourceBindings:
+		return field("vhost"), field("source") + " -> " + field("destination") + " " + field("routing_key")
+	}
+	return field("vhost"), field("name")
+}
+
+// decorate copy the ack and silence of the alert, mutex must be held
+func (engine *AlertEngine) decorate(alert *Alert) {
+	alert.Acked = engine.state.Acks[alert.ID]
+	if until, ok := engine.state.Silences[alert.ID]; ok {
+		alert.SilencedUntil = &until
+	}
+}
+
+// Active alerts ordered by severity and fire time
+func (engine *AlertEngine) Active() []Alert {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	alerts := []Alert{}
+	for _, alert := range engine.active {
+		alerts = append(alerts, *alert)
+	}
+	rank := map[string]int{SeverityCritical: 0, SeverityWarning: 1, SeverityInfo: 2}
+	sort.Slice(alerts, func(i, j int) bool {
+		if rank[alerts[i].Severity] != rank[alerts[j].Severity] {
+			return rank[alerts[i].Severity] < rank[alerts[j].Severity]
+		}
+		return alerts[i].Fired.Before(alerts[j].Fired)
+	})
+	return alerts
+}
+
+// History fired and resolved alerts, newest first
+func (engine *AlertEngine) History() []Alert {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	history := make([]Alert, len(engine.history))
+	for i, alert := range engine.history {
+		history[len(history)-1-i] = alert
+	}
+	return history
+}
+
+// Ack acknowledge an active alert as user
+func (engine *AlertEngine) Ack(id string, user string) (Alert, error) {
+	return engine.update(id, "acked", func(state *alertState) {
+		state.Acks[id] = user
+	})
+}
+
+// Silence do not notify an active alert until the given time
+func (engine *AlertEngine) Silence(id string, until time.Time) (Alert, error) {
+	return engine.update(id, "silenced", func(state *alertState) {
+		state.Silences[id] = until
+	})
+}
+
+// update change the state of an active alert, persist and broadcast it
+func (engine *AlertEngine) update(id string, change string, apply func(*alertState)) (Alert, error) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	alert, ok := engine.active[id]
+	if !ok {
+		return Alert{}, fmt.Errorf("no active alert %q", id)
+	}
+	apply(&engine.state)
+	engine.decorate(alert)
+	if err := engine.saveState(); err != nil {
+		return *alert, err
+	}
+	engine.Changes.Publish(AlertChange{Type: change, Alert: *alert})
+	return *alert, nil
+}
+
+// saveState persist acks and silences, expired silences are dropped. The
+// mutex must be held.
+func (engine *AlertEngine) saveState() error {
+	for id, until := range engine.state.Silences {
+		if time.Now().After(until) {
+			delete(engine.state.Silences, id)
+		}
+	}
+	if engine.store == nil {
+		return nil
+	}
+	return putJSON(engine.store, "alerts/state", engine.state)
+}
+
+// RunAlerts evaluate the rules against the latest snapshot every interval
+// until ctx is done
+func RunAlerts(ctx context.Context, poller *Poller, engine *AlertEngine, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if snapshot := poller.Snapshot(); snapshot != nil {
+				for _, change := range engine.Evaluate(snapshot, now) {
+					subsystemLog("alerts").Infof("%s %s %s %s", change.Type, change.Alert.Rule, change.Alert.Vhost, change.Alert.Object)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAlertRules(t *testing.T) AlertRules {
+	rules := AlertRules{Rules: []AlertRule{{Name: "backlog", Resource: ResourceQueues, Filter: "messages>100", Severity: SeverityCritical}}}
+	assert.Nil(t, rules.compile())
+	return rules
+}
+
+func TestAlertRulesCompile(t *testing.T) {
+	assert.NotNil(t, AlertRules{Rules: []AlertRule{{Name: "x", Resource: "overview"}}}.compile())
+	assert.NotNil(t, AlertRules{Rules: []AlertRule{{Name: "x", Resource: "queues", Severity: "page"}}}.compile())
+	assert.NotNil(t, AlertRules{Rules: []AlertRule{{Name: "x", Resource: "queues", Filter: "messages"}}}.compile())
+	rules := AlertRules{Rules: []AlertRule{{Name: "x", Resource: "queues", Filter: "messages>1"}}}
+	assert.Nil(t, rules.compile())
+	assert.Equal(t, SeverityWarning, rules.Rules[0].Severity)
+}
+
+func TestAlertEngine(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "alerts")
+	defer os.RemoveAll(dir)
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	engine := NewAlertEngine(testAlertRules(t), store)
+	changes, cancel := engine.Changes.Subscribe()
+	defer cancel()
+
+	now := time.Now()
+	snapshot := &Snapshot{Info: rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{
+		{Vhost: "/", Name: "orders", Messages: 500},
+		{Vhost: "/", Name: "small", Messages: 5},
+	}}}
+	fired := engine.Evaluate(snapshot, now)
+	assert.Equal(t, 1, len(fired))
+	assert.Equal(t, "fired", fired[0].Type)
+	assert.Equal(t, "orders", fired[0].Alert.Object)
+	assert.Equal(t, 0, len(engine.Evaluate(snapshot, now.Add(time.Second))))
+	assert.Equal(t, "fired", (<-changes).(AlertChange).Type)
+
+	id := fired[0].Alert.ID
+	alert, err := engine.Ack(id, "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", alert.Acked)
+	alert, err = engine.Silence(id, now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, alert.Silenced(now))
+	_, err = engine.Ack("missing", "alice")
+	assert.NotNil(t, err)
+
+	// acks and silences survive a restart
+	restarted := NewAlertEngine(testAlertRules(t), store)
+	assert.Equal(t, 1, len(restarted.History()))
+	assert.Equal(t, "alice", restarted.Evaluate(snapshot, now)[0].Alert.Acked)
+
+	snapshot.Info.Queues[0].Messages = 0
+	resolved := engine.Evaluate(snapshot, now.Add(time.Minute))
+	assert.Equal(t, "resolved", resolved[0].Type)
+	assert.Equal(t, 0, len(engine.Active()))
+	assert.Equal(t, 2, len(engine.History()))
+	assert.NotNil(t, engine.History()[0].Resolved)
+}
+
+func TestServerAlerts(t *testing.T) {
+	engine := NewAlertEngine(testAlertRules(t), nil)
+	engine.Evaluate(&Snapshot{Info: rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "orders", Messages: 500}}}}, time.Now())
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	server.EnableAlerts(engine)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/alerts", nil))
+	var alerts []Alert
+	json.Unmarshal(rec.Body.Bytes(), &alerts)
+	assert.Equal(t, 1, len(alerts))
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("POST", "/api/alerts/"+alerts[0].ID+"/silence", strings.NewReader(`{"duration":"30m"}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, engine.Active()[0].Silenced(time.Now()))
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("POST", "/api/alerts/"+alerts[0].ID+"/silence", strings.NewReader(`{"duration":"soon"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// tokens only see and mute the alerts of their vhosts
+	store := &TokenStore{}
+	other, _, _ := store.Issue("other", []string{ActionRead, ActionAlert}, []string{"other"}, 0, time.Now())
+	reader, _, _ := store.Issue("reader", []string{ActionRead}, nil, 0, time.Now())
+	server.RequireTokens(store)
+	request := func(method string, path string, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"duration":"30m"}`))
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = request("GET", "/api/alerts", other)
+	json.Unmarshal(rec.Body.Bytes(), &alerts)
+	assert.Equal(t, 0, len(alerts))
+	rec = request("GET", "/api/alerts/history", other)
+	json.Unmarshal(rec.Body.Bytes(), &alerts)
+	assert.Equal(t, 0, len(alerts))
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/alerts/"+engine.Active()[0].ID+"/ack", other).Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/alerts/"+engine.Active()[0].ID+"/silence", reader).Code)
+	assert.Equal(t, ActionAlert, requestAction(httptest.NewRequest("POST", "/api/alerts/x/ack", nil)))
+	assert.Equal(t, ActionRead, requestAction(httptest.NewRequest("GET", "/api/alerts/history", nil)))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/streadway/amqp"
+)
+
+// ManagementAPIURL normalize a management url given by the user, see
+// ParseManagementURL, the login is filled in from det
+func ManagementAPIURL(det RabbitmqLoginDetails) (*url.URL, error) {
+	uri, err := ParseManagementURL(det.ManagementURL)
+	if err != nil {
+		return nil, err
+	}
+	if uri.User == nil && det.Username != "" {
+		uri.User = url.UserPassword(det.Username, det.Password)
+	}
+	return uri, nil
+}
+
+// isWildcardAddress listener bound to all interfaces, its address is of no
+// use to a client
+func isWildcardAddress(addr string) bool {
+	ip := net.ParseIP(addr)
+	return addr == "" || (ip != nil && ip.IsUnspecified())
+}
+
+// DeriveAMQPURI find the amqp endpoint of the broker behind mgmt in the
+// listeners of its overview. A https management url prefers the amqps
+// listener. Listeners of the node answering the api come first; wildcard
+// addresses are replaced by the host of the management url.
+func DeriveAMQPURI(mgmt *url.URL, overview rabtap.RabbitOverview) (*url.URL, error) {
+	protocols := []string{"amqp", "amqp/ssl"}
+	if mgmt.Scheme == "https" {
+		protocols = []string{"amqp/ssl", "amqp"}
+	}
+	for _, protocol := range protocols {
+		found := false
+		var host string
+		var port int
+		for _, listener := range overview.Listeners {
+			if listener.Protocol != protocol {
+				continue
+			}
+			if !found || listener.Node == overview.Node {
+				found = true
+				host, port = listener.IPAddress, listener.Port
+			}
+		}
+		if !found {
+			continue
+		}
+		if isWildcardAddress(host) {
+			host = mgmt.Hostname()
+		}
+		scheme := "amqp"
+		if protocol == "amqp/ssl" {
+			scheme = "amqps"
+		}
+		return &url.URL{
+			Scheme: scheme,
+			User:   mgmt.User,
+			Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		}, nil
+	}
+	return nil, fmt.Errorf("broker at %s has no amqp listener", mgmt.Host)
+}
+
+// connectManagement connect to the management api first and dial the amqp
+// endpoint it announces, using the same tls settings
+func (rabbitmq *Rabbitmq) connectManagement(det RabbitmqLoginDetails) error {
+	mgmt, err := ManagementAPIURL(det)
+	if err != nil {
+		return err
+	}
+	rabbitmq.restURL = mgmt.String()
+	if err := rabbitmq.RestClient(rabbitmq.restURL); err != nil {
+		return err
+	}
+	amqpURI, err := DeriveAMQPURI(mgmt, rabbitmq.info().Overview)
+	if err != nil {
+		return err
+	}
+	subsystemLog("amqp").Infof("discovered amqp endpoint %s://%s", amqpURI.Scheme, amqpURI.Host)
+	rabbitmq.amqpURL = amqpURI.String()
+	conn, err := amqp.DialConfig(rabbitmq.amqpURL, rabbitmq.amqpConfig)
+	rabbitmq.mu.Lock()
+	defer rabbitmq.mu.Unlock()
+	if err != nil {
+		rabbitmq.connected = false
+		return err
+	}
+	if rabbitmq.connection != nil {
+		rabbitmq.connection.Close()
+	}
+	rabbitmq.target = BrokerTarget{Host: amqpURI.Hostname(), Port: amqpURI.Port()}
+	rabbitmq.connected = true
+	rabbitmq.connection = conn
+	return nil
+}
+
+// VhostAMQPURL the amqp uri of the broker pointing to vhost instead of the
+// vhost in amqpURL
+func VhostAMQPURL(amqpURL string, vhost string) (string, error) {
+	uri, err := url.Parse(amqpURL)
+	if err != nil {
+		return "", err
+	}
+	uri.Path = "/" + vhost
+	uri.RawPath = "/" + url.PathEscape(vhost)
+	return uri.String(), nil
+}
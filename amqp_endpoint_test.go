@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func testOverview() rabtap.RabbitOverview {
+	var overview rabtap.RabbitOverview
+	json.Unmarshal([]byte(`{"node": "rabbit@b", "listeners": [
+		{"node": "rabbit@a", "protocol": "amqp", "ip_address": "10.0.0.1", "port": 5672},
+		{"node": "rabbit@b", "protocol": "amqp", "ip_address": "::", "port": 5672},
+		{"node": "rabbit@b", "protocol": "amqp/ssl", "ip_address": "10.0.0.2", "port": 5671}]}`), &overview)
+	return overview
+}
+
+func TestManagementAPIURL(t *testing.T) {
+	uri, err := ManagementAPIURL(RabbitmqLoginDetails{ManagementURL: "https://mq.example.com:15671/", Username: "u", Password: "p"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://u:p@mq.example.com:15671/api", uri.String())
+
+	uri, err = ManagementAPIURL(RabbitmqLoginDetails{ManagementURL: "http://admin:x@mq/api", Username: "u"})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://admin:x@mq/api", uri.String())
+
+	uri, err = ManagementAPIURL(RabbitmqLoginDetails{ManagementURL: "amqp://mq"})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://mq:15672/api", uri.String())
+}
+
+func TestParseManagementURL(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"mq.example.com":                         "http://mq.example.com:15672/api",
+		"mq.example.com:15671":                   "https://mq.example.com:15671/api",
+		"https://mq.example.com/rabbitmq/":       "https://mq.example.com/rabbitmq/api",
+		"http://mq:15672/#/queues":               "http://mq:15672/api",
+		"http://mq:15672/api/?x=1":               "http://mq:15672/api",
+		"https://gw/api/rabbit/":                 "https://gw/api/rabbit/api",
+		"https://gw/api/rabbit/api":              "https://gw/api/rabbit/api",
+		"amqps://u:p@mq.example.com:5671/orders": "https://u:p@mq.example.com:15671/api",
+		"http://u:p%2Fq@mq:15672":                "http://u:p%2Fq@mq:15672/api",
+	} {
+		uri, err := ParseManagementURL(raw)
+		assert.Nil(t, err, raw)
+		assert.Equal(t, expected, uri.String(), raw)
+	}
+	for _, raw := range []string{"", "ftp://mq", "amqp://mq:1234", "http://:p@mq", "http://mq:15672/api?user=u&password=p"} {
+		_, err := ParseManagementURL(raw)
+		assert.NotNil(t, err, raw)
+	}
+	_, err := ParseManagementURL("http://u:pa/ss@mq:15672")
+	assert.NotNil(t, err)
+	assert.False(t, strings.Contains(err.Error(), "pa/ss"))
+
+	err = managementURLError(&url.URL{Scheme: "http", Host: "mq:80", Path: "/api"}, &ManagementError{Code: 404, msg: "GET overview: 404 Not Found"})
+	assert.True(t, strings.Contains(err.Error(), "no management api at http://mq:80/api"))
+}
+
+func TestDeriveAMQPURI(t *testing.T) {
+	mgmt, _ := url.Parse("http://u:p@mq.example.com:15672/api")
+	uri, err := DeriveAMQPURI(mgmt, testOverview())
+	assert.Nil(t, err)
+	assert.Equal(t, "amqp://u:p@mq.example.com:5672", uri.String())
+
+	mgmt, _ = url.Parse("https://u:p@mq.example.com:15671/api")
+	uri, err = DeriveAMQPURI(mgmt, testOverview())
+	assert.Nil(t, err)
+	assert.Equal(t, "amqps://u:p@10.0.0.2:5671", uri.String())
+
+	_, err = DeriveAMQPURI(mgmt, rabtap.RabbitOverview{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// AMQPManagerOptions : reconnect backoff of an AMQPManager
+type AMQPManagerOptions struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// AMQPManager keeps an amqp connection alive: it reconnects with backoff
+// when the broker goes away and runs the registered recovery hooks on every
+// new connection, so queues, bindings and consumers are set up again.
+type AMQPManager struct {
+	uri    string
+	config amqp.Config
+	opts   AMQPManagerOptions
+
+	mutex      sync.Mutex
+	conn       *amqp.Connection
+	recoveries []func(conn *amqp.Connection) error
+}
+
+// NewAMQPManager create a manager for the broker at uri, dialing with config
+// (tls, sasl, heartbeat). Unset options get defaults.
+func NewAMQPManager(uri string, config amqp.Config, opts AMQPManagerOptions) *AMQPManager {
+	if config.Heartbeat <= 0 {
+		config.Heartbeat = 10 * time.Second
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	return &AMQPManager{uri: uri, config: config, opts: opts}
+}
+
+// backoff delay before reconnect attempt n, doubling up to the maximum
+func (manager *AMQPManager) backoff(attempt int) time.Duration {
+	delay := manager.opts.MinBackoff
+	for i := 0; i < attempt && delay < manager.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > manager.opts.MaxBackoff {
+		delay = manager.opts.MaxBackoff
+	}
+	return delay
+}
+
+// OnConnect register a hook run on every (re)established connection. A
+// failing hook closes the connection, which is then retried.
+func (manager *AMQPManager) OnConnect(hook func(conn *amqp.Connection) error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.recoveries = append(manager.recoveries, hook)
+}
+
+// Connection the current connection, nil while disconnected
+func (manager *AMQPManager) Connection() *amqp.Connection {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return manager.conn
+}
+
+// connect dial the broker and run the recovery hooks
+func (manager *AMQPManager) connect() (*amqp.Connection, error) {
+	conn, err := amqp.DialConfig(manager.uri, manager.config)
+	if err != nil {
+		return nil, err
+	}
+	manager.mutex.Lock()
+	hooks := append([]func(conn *amqp.Connection) error{}, manager.recoveries...)
+	manager.mutex.Unlock()
+	for _, hook := range hooks {
+		if err := hook(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	manager.mutex.Lock()
+	manager.conn = conn
+	manager.mutex.Unlock()
+	return conn, nil
+}
+
+// Run connect and stay connected until ctx is done
+func (manager *AMQPManager) Run(ctx context.Context) {
+	logger := subsystemLog("amqp")
+	attempt := 0
+	for {
+		conn, err := manager.connect()
+		if err != nil {
+			delay := manager.backoff(attempt)
+			attempt++
+			logger.Warnf("connecting failed: %s, retrying in %s", err, delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+				continue
+			}
+		}
+		if attempt > 0 {
+			logger.Infof("reconnected after %d attempts", attempt)
+		}
+		attempt = 0
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			manager.mutex.Lock()
+			manager.conn = nil
+			manager.mutex.Unlock()
+			return
+		case amqpErr := <-closed:
+			manager.mutex.Lock()
+			manager.conn = nil
+			manager.mutex.Unlock()
+			logger.Warnf("connection lost: %v", amqpErr)
+		}
+	}
+}
+
+// Consume subscribe handle to the queue returned by setup on every
+// connection. setup declares the topology the consumer needs, it runs again
+// after each reconnect.
+func (manager *AMQPManager) Consume(ctx context.Context, setup func(ch *amqp.Channel) (string, error), handle func(amqp.Delivery)) {
+	manager.OnConnect(func(conn *amqp.Connection) error {
+		ch, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+		queue, err := setup(ch)
+		if err != nil {
+			ch.Close()
+			return err
+		}
+		deliveries, err := ch.Consume(queue, "", true, false, false, false, nil)
+		if err != nil {
+			ch.Close()
+			return err
+		}
+		go func() {
+			defer ch.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery, ok := <-deliveries:
+					if !ok {
+						return
+					}
+					handle(delivery)
+				}
+			}
+		}()
+		return nil
+	})
+}
+
+// errNotConnected the manager is reconnecting and has no connection to use
+var errNotConnected = errors.New("amqp: not connected")
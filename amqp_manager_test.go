@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAMQPManagerBackoff(t *testing.T) {
+	manager := NewAMQPManager("amqp://localhost", amqp.Config{}, AMQPManagerOptions{
+		MinBackoff: time.Second, MaxBackoff: 10 * time.Second,
+	})
+	assert.Equal(t, time.Second, manager.backoff(0))
+	assert.Equal(t, 2*time.Second, manager.backoff(1))
+	assert.Equal(t, 8*time.Second, manager.backoff(3))
+	assert.Equal(t, 10*time.Second, manager.backoff(4))
+	assert.Equal(t, 10*time.Second, manager.backoff(100))
+	assert.Nil(t, manager.Connection())
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const defaultTokensFile = "radish-tokens.yml"
+
+// token actions of the serve api
+const (
+	ActionRead    = "read"
+	ActionRefresh = "refresh"
+	ActionTail    = "tail"
+	ActionMarker  = "marker"
+	ActionAlert   = "alert"
+	ActionViews   = "views"
+	// ActionDebug the profiling endpoints, they expose the command line
+	// with its secrets and can start cpu profiles and traces
+	ActionDebug = "debug"
+)
+
+// TokenActions : actions a token can be limited to
+var TokenActions = []string{ActionRead, ActionRefresh, ActionTail, ActionPurge, ActionClose, ActionDelete, ActionMarker, ActionAlert, ActionViews, ActionDebug}
+
+// APIToken : a scoped token of the serve api, only the hash of the secret
+// is stored. Empty Actions or Vhosts allow all of them.
+type APIToken struct {
+	Name    string    `yaml:"name" json:"name"`
+	Hash    string    `yaml:"hash" json:"-"`
+	Actions []string  `yaml:"actions,omitempty" json:"actions,omitempty"`
+	Vhosts  []string  `yaml:"vhosts,omitempty" json:"vhosts,omitempty"`
+	Expires time.Time `yaml:"expires,omitempty" json:"expires,omitempty"`
+}
+
+// Allows true when the token may perform action
+func (token APIToken) Allows(action string) bool {
+	return len(token.Actions) == 0 || contains(token.Actions, action)
+}
+
+// AllowsVhost true when the token may see vhost
+func (token APIToken) AllowsVhost(vhost string) bool {
+	return len(token.Vhosts) == 0 || contains(token.Vhosts, vhost)
+}
+
+// Expired true when the token has an expiry before now
+func (token APIToken) Expired(now time.Time) bool {
+	return !token.Expires.IsZero() && now.After(token.Expires)
+}
+
+// TokenStore : tokens accepted by the serve api
+type TokenStore struct {
+	Tokens []APIToken `yaml:"tokens" json:"tokens"`
+}
+
+// LoadTokenStore read a token file, a missing file has no tokens
+func LoadTokenStore(file string) (*TokenStore, error) {
+	store := &TokenStore{}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return store, nil
+}
+
+// Save write the token file, readable by the owner only
+func (store *TokenStore) Save(file string) error {
+	data, err := yaml.Marshal(store)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+// contains true when list has value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hashSecret hex sha256 of a token secret
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue create a token replacing the one of the same name, the secret is
+// returned once and not kept
+func (store *TokenStore) Issue(name string, actions []string, vhosts []string, ttl time.Duration, now time.Time) (string, APIToken, error) {
+	for _, action := range actions {
+		if !contains(TokenActions, action) {
+			return "", APIToken{}, fmt.Errorf("unknown action %q, expected one of %s", action, strings.Join(TokenActions, ","))
+		}
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", APIToken{}, err
+	}
+	secret := "rdt_" + hex.EncodeToString(buf)
+	token := APIToken{Name: name, Hash: hashSecret(secret), Actions: actions, Vhosts: vhosts}
+	if ttl > 0 {
+		token.Expires = now.Add(ttl).UTC()
+	}
+	for i, existing := range store.Tokens {
+		if existing.Name == name {
+			store.Tokens[i] = token
+			return secret, token, nil
+		}
+	}
+	store.Tokens = append(store.Tokens, token)
+	return secret, token, nil
+}
+
+// Revoke remove the token named name, false if there is none
+func (store *TokenStore) Revoke(name string) bool {
+	for i, token := range store.Tokens {
+		if token.Name == name {
+			store.Tokens = append(store.Tokens[:i], store.Tokens[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate find the unexpired token of secret
+func (store *TokenStore) Authenticate(secret string, now time.Time) (APIToken, error) {
+	hash := hashSecret(secret)
+	for _, token := range store.Tokens {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(token.Hash)) != 1 {
+			continue
+		}
+		if token.Expired(now) {
+			return token, fmt.Errorf("token %s expired", token.Name)
+		}
+		return token, nil
+	}
+	return APIToken{}, fmt.Errorf("unknown token")
+}
+
+// bearerToken the secret of an Authorization: Bearer header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// requestAction the token action needed for a serve api request, every
+// request causing a broker fetch is a refresh
+func requestAction(r *http.Request) string {
+	if r.URL.Path == "/api/tail" {
+		return ActionTail
+	}
+	if strings.HasPrefix(r.URL.Path, "/debug/") {
+		return ActionDebug
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/actions/") {
+		return strings.TrimPrefix(r.URL.Path, "/api/actions/")
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/markers") && r.Method != http.MethodGet {
+		return ActionMarker
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/alerts/") && r.Method != http.MethodGet {
+		return ActionAlert
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/views") && r.Method != http.MethodGet {
+		return ActionViews
+	}
+	if r.URL.Path == "/refresh" || strings.HasSuffix(r.URL.Path, "/refresh") {
+		return ActionRefresh
+	}
+	if fresh, _ := strconv.ParseBool(r.URL.Query().Get("fresh")); fresh {
+		return ActionRefresh
+	}
+	return ActionRead
+}
+
+type tokenKey struct{}
+
+// requestToken the token the request was authenticated with
+func requestToken(r *http.Request) (APIToken, bool) {
+	token, ok := r.Context().Value(tokenKey{}).(APIToken)
+	return token, ok
+}
+
+// authorize check the token of r, the returned request carries it
+func (server *Server) authorize(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	secret := bearerToken(r)
+	if secret == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="radish"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing bearer token"})
+		return r, false
+	}
+	token, err := server.tokens.Authenticate(secret, time.Now())
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="radish", error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return r, false
+	}
+	if action := requestAction(r); !token.Allows(action) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("token %s may not %s", token.Name, action)})
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), tokenKey{}, token)), true
+}
+
+// FilterVhosts keep the objects of the vhosts the token may see. The
+// overview spans all vhosts and is dropped for vhost limited tokens.
+func (token APIToken) FilterVhosts(snapshot *Snapshot) *Snapshot {
+	if snapshot == nil || len(token.Vhosts) == 0 {
+		return snapshot
+	}
+	filtered := *snapshot
+	info := rabtap.BrokerInfo{}
+	info.Overview.RabbitmqVersion = snapshot.Info.Overview.RabbitmqVersion
+	info.Overview.ManagementVersion = snapshot.Info.Overview.ManagementVersion
+	info.Overview.ClusterName = snapshot.Info.Overview.ClusterName
+	rates := ClientRates{Queues: map[string]QueueRates{}, Connections: map[string]ConnectionRates{}}
+	for _, queue := range snapshot.Info.Queues {
+		if token.AllowsVhost(queue.Vhost) {
+			info.Queues = append(info.Queues, queue)
+			key := queue.Vhost + "/" + queue.Name
+			if rate, ok := snapshot.Rates.Queues[key]; ok {
+				rates.Queues[key] = rate
+			}
+		}
+	}
+	for _, exchange := range snapshot.Info.Exchanges {
+		if token.AllowsVhost(exchange.Vhost) {
+			info.Exchanges = append(info.Exchanges, exchange)
+		}
+	}
+	for _, binding := range snapshot.Info.Bindings {
+		if token.AllowsVhost(binding.Vhost) {
+			info.Bindings = append(info.Bindings, binding)
+		}
+	}
+	for _, consumer := range snapshot.Info.Consumers {
+		if token.AllowsVhost(consumer.Queue.Vhost) {
+			info.Consumers = append(info.Consumers, consumer)
+		}
+	}
+	for _, conn := range snapshot.Info.Connections {
+		if token.AllowsVhost(conn.Vhost) {
+			info.Connections = append(info.Connections, conn)
+			if rate, ok := snapshot.Rates.Connections[conn.Name]; ok {
+				rates.Connections[conn.Name] = rate
+			}
+		}
+	}
+	filtered.Info, filtered.Rates = info, rates
+	return &filtered
+}
+
+// snapshot the latest snapshot as far as the token of r may see it
+func (server *Server) snapshot(r *http.Request) *Snapshot {
+	snapshot := server.poller.Snapshot()
+	if token, ok := requestToken(r); ok {
+		return token.FilterVhosts(snapshot)
+	}
+	return snapshot
+}
+
+func init() {
+	registerCommand("token-issue", "[--tokens f] [--actions read,refresh,...] [--vhosts v,...] [--ttl d] <name> issue a scoped token of the serve api, the secret is printed once", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("token-issue")
+		file := flags.String("tokens", envOr("RADISH_TOKENS", defaultTokensFile), "token file of the serve api")
+		actions := flags.String("actions", ActionRead, "allowed actions: "+strings.Join(TokenActions, ","))
+		vhosts := flags.String("vhosts", "", "allowed vhosts, empty for all")
+		ttl := flags.Duration("ttl", 0, "lifetime of the token, 0 never expires")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("token-issue: expected token name")
+		}
+		store, err := LoadTokenStore(*file)
+		if err != nil {
+			return nil, usageError("token-issue: %s", err)
+		}
+		secret, token, err := store.Issue(flags.Arg(0), splitList(*actions), splitList(*vhosts), *ttl, time.Now())
+		if err != nil {
+			return nil, usageError("token-issue: %s", err)
+		}
+		if err := store.Save(*file); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"token": token, "secret": secret}, nil
+	})
+	registerCommand("token-revoke", "[--tokens f] <name> revoke a token of the serve api", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("token-revoke")
+		file := flags.String("tokens", envOr("RADISH_TOKENS", defaultTokensFile), "token file of the serve api")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("token-revoke: expected token name")
+		}
+		store, err := LoadTokenStore(*file)
+		if err != nil {
+			return nil, usageError("token-revoke: %s", err)
+		}
+		if !store.Revoke(flags.Arg(0)) {
+			return nil, usageError("token-revoke: no token %q", flags.Arg(0))
+		}
+		return store.Tokens, store.Save(*file)
+	})
+}
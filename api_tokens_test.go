@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenStoreIssue(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &TokenStore{}
+	secret, token, err := store.Issue("ci", []string{ActionRead}, []string{"prod"}, time.Hour, now)
+	assert.Nil(t, err)
+	assert.NotEqual(t, secret, token.Hash)
+	assert.Equal(t, now.Add(time.Hour), token.Expires)
+
+	found, err := store.Authenticate(secret, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "ci", found.Name)
+	_, err = store.Authenticate(secret, now.Add(2*time.Hour))
+	assert.NotNil(t, err)
+	_, err = store.Authenticate("rdt_wrong", now)
+	assert.NotNil(t, err)
+
+	_, _, err = store.Issue("ci", []string{"drop"}, nil, 0, now)
+	assert.NotNil(t, err)
+
+	dir, _ := ioutil.TempDir("", "tokens")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "tokens.yml")
+	assert.Nil(t, store.Save(file))
+	loaded, err := LoadTokenStore(file)
+	assert.Nil(t, err)
+	_, err = loaded.Authenticate(secret, now)
+	assert.Nil(t, err)
+	assert.True(t, loaded.Revoke("ci"))
+	assert.False(t, loaded.Revoke("ci"))
+}
+
+func TestTokenFilterVhosts(t *testing.T) {
+	snapshot := &Snapshot{Info: rabtap.BrokerInfo{
+		Queues:      []rabtap.RabbitQueue{{Vhost: "prod", Name: "a"}, {Vhost: "test", Name: "b"}},
+		Connections: []rabtap.RabbitConnection{{Vhost: "test", Name: "c"}},
+	}}
+	snapshot.Info.Overview.QueueTotals.Messages = 10
+	filtered := APIToken{Vhosts: []string{"prod"}}.FilterVhosts(snapshot)
+	assert.Equal(t, 1, len(filtered.Info.Queues))
+	assert.Equal(t, "a", filtered.Info.Queues[0].Name)
+	assert.Equal(t, 0, len(filtered.Info.Connections))
+	assert.Equal(t, 0, filtered.Info.Overview.QueueTotals.Messages)
+	assert.Equal(t, snapshot, APIToken{}.FilterVhosts(snapshot))
+}
+
+func TestServerTokens(t *testing.T) {
+	store := &TokenStore{}
+	reader, _, _ := store.Issue("reader", []string{ActionRead}, nil, 0, time.Now())
+	debugger, _, _ := store.Issue("debugger", []string{ActionDebug}, nil, 0, time.Now())
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	server.RequireTokens(store)
+	server.EnableProfiling()
+
+	request := func(method string, path string, secret string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, request("GET", "/healthz", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/metrics", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/metrics", "rdt_wrong"))
+	assert.Equal(t, http.StatusOK, request("GET", "/metrics", reader))
+	assert.Equal(t, http.StatusForbidden, request("POST", "/refresh", reader))
+	// the command line holds the broker password
+	assert.Equal(t, http.StatusForbidden, request("GET", "/debug/pprof/cmdline", reader))
+	assert.Equal(t, http.StatusOK, request("GET", "/debug/pprof/cmdline", debugger))
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultAuditFile = "radish-audit.log"
+
+// AuditEntry : an operation changing the broker, who did it and how it went
+type AuditEntry struct {
+	Time           time.Time `json:"time"`
+	User           string    `json:"user"`
+	Action         string    `json:"action"`
+	Vhost          string    `json:"vhost,omitempty"`
+	Target         string    `json:"target"`
+	Reason         string    `json:"reason,omitempty"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+	Result         string    `json:"result"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// auditPrefix keys of the audit entries in a store
+const auditPrefix = "audit/"
+
+// AuditLog : append only json lines file of audit entries, or one key per
+// entry in a store
+type AuditLog struct {
+	file  string
+	store KVStore
+	mutex sync.Mutex
+	// seq keeps the keys of entries recorded in the same instant apart
+	seq int
+}
+
+// NewAuditLog log to file, it is created on the first entry
+func NewAuditLog(file string) *AuditLog {
+	return &AuditLog{file: file}
+}
+
+// NewStoreAuditLog log to store, every entry is a key under audit/
+func NewStoreAuditLog(store KVStore) *AuditLog {
+	return &AuditLog{store: store}
+}
+
+// OpenAuditLog log to location: sqlite databases and s3 buckets are opened
+// as store, see OpenKVStore, anything else is a json lines file
+func OpenAuditLog(location string) (*AuditLog, error) {
+	if !isStoreLocation(location) {
+		return NewAuditLog(location), nil
+	}
+	store, err := OpenKVStore(location)
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreAuditLog(store), nil
+}
+
+// auditKey store key of an entry, keys sort by time
+func auditKey(entry AuditEntry, seq int) string {
+	return fmt.Sprintf("%s%s-%06d", auditPrefix, entry.Time.UTC().Format("20060102T150405.000000000Z"), seq)
+}
+
+// Record append the entry
+func (audit *AuditLog) Record(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	if audit.store != nil {
+		audit.seq = (audit.seq + 1) % 1000000
+		return audit.store.Put(auditKey(entry, audit.seq), data)
+	}
+	f, err := os.OpenFile(audit.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Entries read the entries at or after since, a missing log has none
+func (audit *AuditLog) Entries(since time.Time) ([]AuditEntry, error) {
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	if audit.store != nil {
+		return audit.storeEntries(since)
+	}
+	entries := []AuditEntry{}
+	f, err := os.Open(audit.file)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// storeEntries read the entries of the store at or after since, mutex must
+// be held
+func (audit *AuditLog) storeEntries(since time.Time) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	keys, err := audit.store.Keys(auditPrefix)
+	if err != nil {
+		return nil, err
+	}
+	first := auditKey(AuditEntry{Time: since}, 0)
+	for _, key := range keys {
+		if key < first {
+			continue
+		}
+		var entry AuditEntry
+		if _, err := getJSON(audit.store, key, &entry); err != nil {
+			return nil, err
+		}
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Close the store of the log
+func (audit *AuditLog) Close() error {
+	if audit.store != nil {
+		return audit.store.Close()
+	}
+	return nil
+}
+
+// AuditReport : audit entries as table
+type AuditReport struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// Table entries as table, failed operations red
+func (report AuditReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"TIME", "USER", "ACTION", "VHOST", "TARGET", "RESULT"}}
+	for _, entry := range report.Entries {
+		color := Green
+		result := entry.Result
+		if entry.Error != "" {
+			color, result = Red, entry.Result+": "+entry.Error
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: entry.Time.Local().Format("2006-01-02 15:04:05")},
+			{Text: entry.User},
+			{Text: entry.Action},
+			{Text: orDash(entry.Vhost)},
+			{Text: entry.Target},
+			{Text: result, Color: color},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("audit", "[--file f] [--since d] show the operations recorded by serve --actions", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("audit")
+		file := flags.String("file", envOr("RADISH_AUDIT", defaultAuditFile), "audit log file, sqlite .db or s3://bucket/prefix")
+		since := flags.Duration("since", 24*time.Hour, "show entries of this period")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		audit, err := OpenAuditLog(*file)
+		if err != nil {
+			return nil, usageError("audit: %s", err)
+		}
+		defer audit.Close()
+		entries, err := audit.Entries(time.Now().Add(-*since))
+		if err != nil {
+			return nil, err
+		}
+		return AuditReport{Entries: entries}, nil
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+// AuthAttempts : authentication attempts of one protocol on a node
+type AuthAttempts struct {
+	Node      string `json:"node"`
+	Protocol  string `json:"protocol"`
+	Attempts  int64  `json:"auth_attempts"`
+	Failed    int64  `json:"auth_attempts_failed"`
+	Succeeded int64  `json:"auth_attempts_succeeded"`
+}
+
+// AuthSource : authentication attempts by user and client address
+type AuthSource struct {
+	Username      string `json:"username"`
+	RemoteAddress string `json:"remote_address"`
+	Protocol      string `json:"protocol,omitempty"`
+	Attempts      int64  `json:"auth_attempts"`
+	Failed        int64  `json:"auth_attempts_failed"`
+	Succeeded     int64  `json:"auth_attempts_succeeded"`
+	// FailureEvents seen on the event exchange while watching
+	FailureEvents int64 `json:"failure_events"`
+}
+
+// AuthReport : authentication statistics of the cluster
+type AuthReport struct {
+	Nodes   []AuthAttempts `json:"nodes"`
+	Sources []AuthSource   `json:"sources"`
+}
+
+// NodeNames list the nodes of the cluster
+func (client *ManagementClient) NodeNames() ([]string, error) {
+	var nodes []struct {
+		Name string `json:"name"`
+	}
+	if err := client.get("nodes?columns=name", &nodes); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+	}
+	return names, nil
+}
+
+// AuthReport collect the authentication attempts of all nodes. Per source
+// statistics need rabbitmq 3.8 with track_auth_attempt_source enabled, they
+// are left out when the broker does not provide them.
+func (client *ManagementClient) AuthReport() (AuthReport, error) {
+	report := AuthReport{Nodes: []AuthAttempts{}, Sources: []AuthSource{}}
+	nodes, err := client.NodeNames()
+	if err != nil {
+		return report, err
+	}
+	sources := map[string]*AuthSource{}
+	for _, node := range nodes {
+		var attempts []AuthAttempts
+		if err := client.get(managementPath("auth", "attempts", node), &attempts); err != nil {
+			subsystemLog("auth").Debugf("auth attempts of %s unavailable: %s", node, err)
+			continue
+		}
+		for _, attempt := range attempts {
+			attempt.Node = node
+			report.Nodes = append(report.Nodes, attempt)
+		}
+		var bySource []AuthSource
+		if err := client.get(managementPath("auth", "attempts", node, "source"), &bySource); err != nil {
+			subsystemLog("auth").Debugf("auth attempt sources of %s unavailable: %s", node, err)
+			continue
+		}
+		for _, source := range bySource {
+			mergeAuthSource(sources, source)
+		}
+	}
+	report.Sources = sortedAuthSources(sources)
+	return report, nil
+}
+
+// mergeAuthSource add the counts of source to the entry of its user and address
+func mergeAuthSource(sources map[string]*AuthSource, source AuthSource) {
+	key := source.Username + "@" + source.RemoteAddress
+	existing, ok := sources[key]
+	if !ok {
+		copied := source
+		copied.Protocol = ""
+		sources[key] = &copied
+		return
+	}
+	existing.Attempts += source.Attempts
+	existing.Failed += source.Failed
+	existing.Succeeded += source.Succeeded
+	existing.FailureEvents += source.FailureEvents
+}
+
+// sortedAuthSources sources with the most failures first
+func sortedAuthSources(sources map[string]*AuthSource) []AuthSource {
+	res := make([]AuthSource, 0, len(sources))
+	for _, source := range sources {
+		res = append(res, *source)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		fi, fj := res[i].Failed+res[i].FailureEvents, res[j].Failed+res[j].FailureEvents
+		if fi != fj {
+			return fi > fj
+		}
+		return res[i].Username+res[i].RemoteAddress < res[j].Username+res[j].RemoteAddress
+	})
+	return res
+}
+
+// AddFailureEvents merge user.authentication.failure events into the report
+func (report *AuthReport) AddFailureEvents(events []BrokerEvent) {
+	sources := map[string]*AuthSource{}
+	for _, source := range report.Sources {
+		mergeAuthSource(sources, source)
+	}
+	for _, event := range events {
+		if event.Type != "user.authentication.failure" {
+			continue
+		}
+		address := event.Properties["peer_address"]
+		if address == "" {
+			address = event.Properties["peer_host"]
+		}
+		mergeAuthSource(sources, AuthSource{Username: event.Name, RemoteAddress: address, FailureEvents: 1})
+	}
+	report.Sources = sortedAuthSources(sources)
+}
+
+// Table sources of authentication attempts as table, nodes are in the json output
+func (report AuthReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"USER", "ADDRESS", "ATTEMPTS", "FAILED", "SUCCEEDED", "FAILURE EVENTS"}}
+	for _, source := range report.Sources {
+		color := None
+		if source.Failed+source.FailureEvents > 0 {
+			color = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: orDash(source.Username), Color: color},
+			{Text: orDash(source.RemoteAddress)},
+			{Text: format.Count(source.Attempts)},
+			{Text: format.Count(source.Failed), Color: color},
+			{Text: format.Count(source.Succeeded)},
+			{Text: format.Count(source.FailureEvents)},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("auth-failures", "[--watch d] authentication attempts by user and address", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("auth-failures")
+		watch := flags.Duration("watch", 0, "also collect failure events of the event exchange for this long")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		report, err := rabbitmq.management().AuthReport()
+		if err != nil {
+			return nil, err
+		}
+		if *watch > 0 {
+			signalCtx, stop := signalContext(context.Background())
+			defer stop()
+			ctx, cancel := context.WithTimeout(signalCtx, *watch)
+			defer cancel()
+			bus := NewEventBus()
+			events, unsubscribe := bus.Subscribe()
+			defer unsubscribe()
+			go rabbitmq.ListenEvents(ctx, "user.authentication.failure", bus)
+			var failures []BrokerEvent
+			for done := false; !done; {
+				select {
+				case <-ctx.Done():
+					done = true
+				case event := <-events:
+					failures = append(failures, event)
+				}
+			}
+			report.AddFailureEvents(failures)
+		}
+		return report, nil
+	})
+}
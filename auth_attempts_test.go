@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthReport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/nodes":
+			w.Write([]byte(`[{"name": "rabbit@a"}, {"name": "rabbit@b"}]`))
+		case "/api/auth/attempts/rabbit@a":
+			w.Write([]byte(`[{"protocol": "amqp091", "auth_attempts": 5, "auth_attempts_failed": 3, "auth_attempts_succeeded": 2}]`))
+		case "/api/auth/attempts/rabbit@a/source":
+			w.Write([]byte(`[
+				{"username": "app", "remote_address": "10.0.0.1", "protocol": "amqp091", "auth_attempts": 2, "auth_attempts_succeeded": 2},
+				{"username": "admin", "remote_address": "10.0.0.9", "protocol": "amqp091", "auth_attempts": 3, "auth_attempts_failed": 3}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+
+	report, err := NewManagementClient(uri, nil).AuthReport()
+	assert.Nil(t, err)
+	assert.Equal(t, []AuthAttempts{{Node: "rabbit@a", Protocol: "amqp091", Attempts: 5, Failed: 3, Succeeded: 2}}, report.Nodes)
+	assert.Equal(t, "admin", report.Sources[0].Username)
+
+	report.AddFailureEvents([]BrokerEvent{
+		{Type: "user.authentication.failure", Name: "guest", Properties: map[string]string{"peer_address": "10.0.0.5"}},
+		{Type: "user.authentication.failure", Name: "guest", Properties: map[string]string{"peer_address": "10.0.0.5"}},
+		{Type: "queue.created", Name: "q"},
+	})
+	assert.Len(t, report.Sources, 3)
+	assert.Equal(t, AuthSource{Username: "admin", RemoteAddress: "10.0.0.9", Attempts: 3, Failed: 3}, report.Sources[0])
+	assert.Equal(t, AuthSource{Username: "guest", RemoteAddress: "10.0.0.5", FailureEvents: 2}, report.Sources[1])
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultAnomalyThreshold deviations from the baseline mean that are
+// flagged, in standard deviations
+const defaultAnomalyThreshold = 3.0
+
+// anomalyTolerance relative deviation always tolerated, a baseline of a
+// steady broker has no spread and would flag every change otherwise
+const anomalyTolerance = 0.1
+
+// baselineAnalyzer name of the analyzer comparing snapshots to a baseline
+const baselineAnalyzer = "baseline"
+
+// BaselineStat : the profile of a metric over the baseline window
+type BaselineStat struct {
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"stddev"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Samples int     `json:"samples"`
+}
+
+// Baseline : the normal behavior of a broker, the key metrics profiled over
+// a window and the bindings of its durable queues
+type Baseline struct {
+	Captured time.Time               `json:"captured"`
+	Window   time.Duration           `json:"window"`
+	Metrics  map[string]BaselineStat `json:"metrics"`
+	Bindings []string                `json:"bindings"`
+	// Threshold standard deviations a value may be off, 3 when 0
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+// baselineMetrics the broker wide metrics of a snapshot profiled by a
+// baseline: message totals, rates and object counts
+func baselineMetrics(info rabtap.BrokerInfo) map[string]float64 {
+	values := map[string]float64{}
+	for _, sample := range BrokerMetrics(&Snapshot{Info: info}) {
+		if len(sample.Labels) == 0 || sample.Def.Name == metricObjects.Name {
+			values[seriesName(sample.Def.Name, sample.Labels)] = sample.Value
+		}
+	}
+	return values
+}
+
+// durableBindings keys of the bindings to durable queues and between
+// exchanges, temporary queues come and go with their clients
+func durableBindings(info rabtap.BrokerInfo) []string {
+	durable := map[string]bool{}
+	for _, queue := range info.Queues {
+		durable[queue.Vhost+"/"+queue.Name] = queue.Durable
+	}
+	keys := []string{}
+	for _, binding := range info.Bindings {
+		if binding.DestinationType == "queue" && !durable[binding.Vhost+"/"+binding.Destination] {
+			continue
+		}
+		keys = append(keys, fmt.Sprintf("%s -> %s %s (%s) in %s", orDash(binding.Source), binding.DestinationType, binding.Destination, binding.RoutingKey, binding.Vhost))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// profile the statistics of values
+func profile(values []float64) BaselineStat {
+	stat := BaselineStat{Samples: len(values)}
+	if len(values) == 0 {
+		return stat
+	}
+	stat.Min, stat.Max = values[0], values[0]
+	for _, value := range values {
+		stat.Mean += value
+		stat.Min = math.Min(stat.Min, value)
+		stat.Max = math.Max(stat.Max, value)
+	}
+	stat.Mean /= float64(len(values))
+	for _, value := range values {
+		stat.StdDev += (value - stat.Mean) * (value - stat.Mean)
+	}
+	stat.StdDev = math.Sqrt(stat.StdDev / float64(len(values)))
+	return stat
+}
+
+// CaptureBaseline profile the key metrics of the snapshots, the bindings
+// are taken from the last one
+func CaptureBaseline(snapshots []rabtap.BrokerInfo, now time.Time) Baseline {
+	series := map[string][]float64{}
+	for _, info := range snapshots {
+		for name, value := range baselineMetrics(info) {
+			series[name] = append(series[name], value)
+		}
+	}
+	baseline := Baseline{Captured: now, Metrics: map[string]BaselineStat{}, Bindings: []string{}}
+	for name, values := range series {
+		baseline.Metrics[name] = profile(values)
+	}
+	if len(snapshots) > 0 {
+		baseline.Bindings = durableBindings(snapshots[len(snapshots)-1])
+	}
+	return baseline
+}
+
+// CaptureBaselineHistory profile the key metrics recorded in the history
+// during the window before now, the bindings are taken from info
+func CaptureBaselineHistory(history *MetricHistory, info rabtap.BrokerInfo, window time.Duration, now time.Time) (Baseline, error) {
+	baseline := Baseline{Captured: now, Window: window, Metrics: map[string]BaselineStat{}, Bindings: durableBindings(info)}
+	for _, metric := range []MetricDef{metricMessages, metricMessagesReady, metricMessagesUnacked, metricPublishRate, metricDeliverRate, metricObjects} {
+		_, series, err := history.Query(metric.Name, now.Add(-window), now, now)
+		if err != nil {
+			return baseline, err
+		}
+		for name, points := range series {
+			values := make([]float64, len(points))
+			for i, point := range points {
+				values[i] = point.Value
+			}
+			baseline.Metrics[name] = profile(values)
+		}
+	}
+	if len(baseline.Metrics) == 0 {
+		return baseline, fmt.Errorf("no history within %s", window)
+	}
+	return baseline, nil
+}
+
+// LoadBaseline read a baseline json file
+func LoadBaseline(file string) (Baseline, error) {
+	var baseline Baseline
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return baseline, err
+	}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return baseline, fmt.Errorf("%s: %s", file, err)
+	}
+	return baseline, nil
+}
+
+// Save write the baseline as json
+func (baseline Baseline) Save(file string) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// Anomaly : a metric deviating significantly from its baseline
+type Anomaly struct {
+	Metric   string  `json:"metric"`
+	Value    float64 `json:"value"`
+	Mean     float64 `json:"mean"`
+	StdDev   float64 `json:"stddev"`
+	Score    float64 `json:"score"`
+	Severity string  `json:"severity"`
+	Summary  string  `json:"summary"`
+}
+
+// Detect compare the snapshot to the baseline. A metric is anomalous when
+// it is more than Threshold standard deviations and the tolerance off its
+// mean, bindings of durable queues appearing or disappearing are always.
+// Values twice the threshold off are critical.
+func (baseline Baseline) Detect(info rabtap.BrokerInfo) []Anomaly {
+	threshold := baseline.Threshold
+	if threshold <= 0 {
+		threshold = defaultAnomalyThreshold
+	}
+	anomalies := []Anomaly{}
+	values := baselineMetrics(info)
+	names := make([]string, 0, len(baseline.Metrics))
+	for name := range baseline.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stat, value := baseline.Metrics[name], values[name]
+		if stat.Samples == 0 {
+			continue
+		}
+		spread := math.Max(stat.StdDev, math.Max(math.Abs(stat.Mean)*anomalyTolerance, 1)/threshold)
+		score := (value - stat.Mean) / spread
+		if math.Abs(score) <= threshold {
+			continue
+		}
+		direction := "spike"
+		if score < 0 {
+			direction = "drop"
+		}
+		severity := SeverityWarning
+		if math.Abs(score) >= 2*threshold {
+			severity = SeverityCritical
+		}
+		anomalies = append(anomalies, Anomaly{
+			Metric: name, Value: value, Mean: stat.Mean, StdDev: stat.StdDev, Score: score, Severity: severity,
+			Summary: fmt.Sprintf("%s %s: %.4g, baseline %.4g ± %.2g", name, direction, value, stat.Mean, stat.StdDev),
+		})
+	}
+	current := durableBindings(info)
+	added, removed := stringSetDiff(current, baseline.Bindings), stringSetDiff(baseline.Bindings, current)
+	if len(added)+len(removed) > 0 {
+		severity := SeverityWarning
+		if len(removed) > 0 {
+			severity = SeverityCritical
+		}
+		anomalies = append(anomalies, Anomaly{
+			Metric: "bindings", Value: float64(len(current)), Mean: float64(len(baseline.Bindings)), Score: float64(len(added) + len(removed)), Severity: severity,
+			Summary: fmt.Sprintf("bindings changed: %d added, %d removed", len(added), len(removed)),
+		})
+	}
+	return anomalies
+}
+
+// stringSetDiff the values of a missing in b
+func stringSetDiff(a []string, b []string) []string {
+	in := map[string]bool{}
+	for _, value := range b {
+		in[value] = true
+	}
+	diff := []string{}
+	for _, value := range a {
+		if !in[value] {
+			diff = append(diff, value)
+		}
+	}
+	return diff
+}
+
+// Name of the baseline analyzer
+func (baseline Baseline) Name() string {
+	return baselineAnalyzer
+}
+
+// Analyze report the anomalies as findings, so the alert engine fires and
+// resolves them like rule matches
+func (baseline Baseline) Analyze(info rabtap.BrokerInfo) ([]Finding, error) {
+	findings := []Finding{}
+	for _, anomaly := range baseline.Detect(info) {
+		findings = append(findings, Finding{Severity: anomaly.Severity, Object: anomaly.Metric, Summary: anomaly.Summary})
+	}
+	return findings, nil
+}
+
+// AnomalyList : the anomalies of a snapshot
+type AnomalyList []Anomaly
+
+// Table one row per anomaly, colored by severity
+func (list AnomalyList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"METRIC", "VALUE", "BASELINE", "SCORE", "SUMMARY"}}
+	for _, anomaly := range list {
+		color := Yellow
+		if anomaly.Severity == SeverityCritical {
+			color = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: anomaly.Metric},
+			{Text: format.Float(anomaly.Value), Color: color},
+			{Text: format.Float(anomaly.Mean)},
+			{Text: fmt.Sprintf("%+.1f", anomaly.Score), Color: color},
+			{Text: anomaly.Summary},
+		})
+	}
+	return table
+}
+
+// BaselineSummary : a captured baseline
+type BaselineSummary struct {
+	File     string `json:"file"`
+	Baseline `json:"baseline"`
+}
+
+// Table one row per profiled metric
+func (summary BaselineSummary) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"METRIC", "MEAN", "STDDEV", "MIN", "MAX", "SAMPLES"}}
+	names := make([]string, 0, len(summary.Metrics))
+	for name := range summary.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stat := summary.Metrics[name]
+		table.Rows = append(table.Rows, []Cell{
+			{Text: name},
+			{Text: format.Float(stat.Mean)},
+			{Text: format.Float(stat.StdDev)},
+			{Text: format.Float(stat.Min)},
+			{Text: format.Float(stat.Max)},
+			{Text: format.Count(int64(stat.Samples))},
+		})
+	}
+	table.Rows = append(table.Rows, []Cell{{Text: "bindings"}, {Text: format.Count(int64(len(summary.Bindings)))}, {Text: "-"}, {Text: "-"}, {Text: "-"}, {Text: "1"}})
+	return table
+}
+
+// sampleBaseline fetch count snapshots every interval
+func sampleBaseline(ctx context.Context, rabbitmq *Rabbitmq, count int, every time.Duration) ([]rabtap.BrokerInfo, error) {
+	snapshots := []rabtap.BrokerInfo{rabbitmq.info()}
+	for len(snapshots) < count {
+		select {
+		case <-ctx.Done():
+			return snapshots, nil
+		case <-time.After(every):
+		}
+		if err := rabbitmq.UpdateBrokerInfoContext(ctx); err != nil {
+			return snapshots, err
+		}
+		snapshots = append(snapshots, rabbitmq.info())
+	}
+	return snapshots, nil
+}
+
+func init() {
+	registerCommand("baseline", "capture [--store f --window d --retention r | --samples n --every d] [--threshold z] <file> | check <file> profile the key metrics, flag deviations from the profile", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("baseline")
+		storeFile := flags.String("store", envOr("RADISH_STORE", ""), "capture from the metric history of this serve store")
+		window := flags.Duration("window", 7*24*time.Hour, "history window the baseline is captured from")
+		retention := flags.String("retention", defaultRetention, "retention of the history in the store, as given to serve")
+		samples := flags.Int("samples", 1, "snapshots to capture without a store")
+		every := flags.Duration("every", 30*time.Second, "interval of the captured snapshots")
+		threshold := flags.Float64("threshold", defaultAnomalyThreshold, "standard deviations off the mean flagged as anomaly")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 2 || (flags.Arg(0) != "capture" && flags.Arg(0) != "check") {
+			return nil, usageError("baseline: expected capture or check and a file")
+		}
+		file := flags.Arg(1)
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		if flags.Arg(0) == "check" {
+			baseline, err := LoadBaseline(file)
+			if err != nil {
+				return nil, usageError("baseline: %s", err)
+			}
+			anomalies := AnomalyList(baseline.Detect(rabbitmq.info()))
+			if len(anomalies) > 0 {
+				return anomalies, thresholdError("%d anomalies against the baseline of %s", len(anomalies), baseline.Captured.Format(time.RFC3339))
+			}
+			return anomalies, nil
+		}
+		var baseline Baseline
+		if *storeFile != "" {
+			store, err := OpenKVStore(*storeFile)
+			if err != nil {
+				return nil, usageError("store: %s", err)
+			}
+			defer store.Close()
+			policy, err := ParseRetentionPolicy(*retention)
+			if err != nil {
+				return nil, usageError("retention: %s", err)
+			}
+			history, err := NewMetricHistory(store, policy, 0)
+			if err != nil {
+				return nil, err
+			}
+			if baseline, err = CaptureBaselineHistory(history, rabbitmq.info(), *window, time.Now()); err != nil {
+				return nil, usageError("baseline: %s", err)
+			}
+		} else {
+			ctx, shutdown := cli.daemonContext()
+			defer shutdown()
+			snapshots, err := sampleBaseline(ctx, rabbitmq, *samples, *every)
+			if err != nil {
+				return nil, err
+			}
+			baseline = CaptureBaseline(snapshots, time.Now())
+			baseline.Window = time.Duration(len(snapshots)-1) * *every
+		}
+		baseline.Threshold = *threshold
+		if err := baseline.Save(file); err != nil {
+			return nil, err
+		}
+		return BaselineSummary{File: file, Baseline: baseline}, nil
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// baselineInfo a broker with n connections publishing rate messages/s
+func baselineInfo(n int, rate float64) rabtap.BrokerInfo {
+	info := rabtap.BrokerInfo{
+		Queues:   []rabtap.RabbitQueue{{Vhost: "/", Name: "orders", Durable: true}, {Vhost: "/", Name: "amq.gen-1"}},
+		Bindings: []rabtap.RabbitBinding{{Vhost: "/", Source: "orders", Destination: "orders", DestinationType: "queue", RoutingKey: "#"}, {Vhost: "/", Source: "orders", Destination: "amq.gen-1", DestinationType: "queue"}},
+	}
+	info.Connections = make([]rabtap.RabbitConnection, n)
+	info.Overview.MessageStats.PublishDetails.Rate = rate
+	return info
+}
+
+func TestBaselineDetect(t *testing.T) {
+	baseline := CaptureBaseline([]rabtap.BrokerInfo{baselineInfo(100, 500), baselineInfo(104, 520), baselineInfo(96, 480)}, time.Now())
+	assert.Equal(t, 3, baseline.Metrics[`objects{kind="connections"}`].Samples)
+	assert.Equal(t, 100.0, baseline.Metrics[`objects{kind="connections"}`].Mean)
+	assert.Equal(t, []string{"orders -> queue orders (#) in /"}, baseline.Bindings)
+
+	assert.Equal(t, 0, len(baseline.Detect(baselineInfo(105, 510))))
+
+	anomalies := baseline.Detect(baselineInfo(40, 5))
+	assert.Equal(t, 2, len(anomalies))
+	assert.Equal(t, `objects{kind="connections"}`, anomalies[0].Metric)
+	assert.Equal(t, SeverityCritical, anomalies[0].Severity)
+	assert.True(t, anomalies[0].Score < 0)
+	assert.Equal(t, "publish_rate", anomalies[1].Metric)
+
+	// a steady broker tolerates small changes
+	steady := CaptureBaseline([]rabtap.BrokerInfo{baselineInfo(10, 0)}, time.Now())
+	assert.Equal(t, 0, len(steady.Detect(baselineInfo(11, 0))))
+
+	changed := baselineInfo(100, 500)
+	changed.Bindings = changed.Bindings[1:]
+	anomalies = baseline.Detect(changed)
+	assert.Equal(t, 1, len(anomalies))
+	assert.Equal(t, "bindings changed: 0 added, 1 removed", anomalies[0].Summary)
+
+	findings, _ := baseline.Analyze(changed)
+	assert.Equal(t, "bindings", findings[0].Object)
+
+	dir, _ := ioutil.TempDir("", "baseline")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "baseline.json")
+	assert.Nil(t, baseline.Save(file))
+	loaded, err := LoadBaseline(file)
+	assert.Nil(t, err)
+	assert.Equal(t, baseline.Metrics, loaded.Metrics)
+}
+
+func TestBaselineHistory(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "baseline")
+	defer os.RemoveAll(dir)
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	defer store.Close()
+	policy, _ := ParseRetentionPolicy("10s:1d")
+	history, _ := NewMetricHistory(store, policy, 0)
+	start := time.Unix(1577880000, 0)
+	for i := 0; i < 10; i++ {
+		history.Record(BrokerMetrics(&Snapshot{Info: baselineInfo(50+i%2, 100)}), start.Add(time.Duration(i)*10*time.Second))
+	}
+	now := start.Add(2 * time.Minute)
+	baseline, err := CaptureBaselineHistory(history, baselineInfo(50, 100), time.Hour, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, baseline.Metrics[`objects{kind="connections"}`].Samples)
+	assert.Equal(t, 50.5, baseline.Metrics[`objects{kind="connections"}`].Mean)
+
+	_, err = CaptureBaselineHistory(history, baselineInfo(50, 100), time.Hour, now.Add(24*time.Hour))
+	assert.NotNil(t, err)
+}
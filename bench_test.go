@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+const benchQueues = 100000
+
+// benchBrokerInfo a broker with n queues, each bound to one of 100 exchanges
+// and consumed by one consumer
+func benchBrokerInfo(n int) rabtap.BrokerInfo {
+	var info rabtap.BrokerInfo
+	for i := 0; i < 100; i++ {
+		info.Exchanges = append(info.Exchanges, rabtap.RabbitExchange{
+			Name: fmt.Sprintf("ex-%d", i), Vhost: fmt.Sprintf("vhost-%d", i%10), Type: "topic",
+		})
+	}
+	for i := 0; i < n; i++ {
+		vhost := fmt.Sprintf("vhost-%d", i%10)
+		name := fmt.Sprintf("queue-%d", i)
+		info.Queues = append(info.Queues, rabtap.RabbitQueue{
+			Name: name, Vhost: vhost, Node: fmt.Sprintf("rabbit@node-%d", i%3), State: "running",
+			Durable: true, Messages: i % 1000,
+		})
+		info.Bindings = append(info.Bindings, rabtap.RabbitBinding{
+			Source: fmt.Sprintf("ex-%d", i%100), Vhost: vhost, Destination: name,
+			DestinationType: "queue", RoutingKey: name,
+		})
+		consumer := rabtap.RabbitConsumer{ConsumerTag: fmt.Sprintf("ctag-%d", i)}
+		consumer.Queue.Name = name
+		consumer.Queue.Vhost = vhost
+		info.Consumers = append(info.Consumers, consumer)
+	}
+	return info
+}
+
+func BenchmarkDecodeQueues(b *testing.B) {
+	data, err := json.Marshal(benchBrokerInfo(benchQueues).Queues)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var queues []rabtap.RabbitQueue
+		if err := json.Unmarshal(data, &queues); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompactBrokerInfo(b *testing.B) {
+	info := benchBrokerInfo(benchQueues)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CompactBrokerInfo(&info, NewInterner())
+	}
+}
+
+func BenchmarkFindDanglingRefs(b *testing.B) {
+	info := benchBrokerInfo(benchQueues)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FindDanglingRefs(info)
+	}
+}
+
+func BenchmarkDiffPolicies(b *testing.B) {
+	var desired, existing []RabbitPolicy
+	for i := 0; i < 10000; i++ {
+		policy := RabbitPolicy{
+			Vhost: fmt.Sprintf("vhost-%d", i%10), Name: fmt.Sprintf("policy-%d", i), Pattern: "^q",
+			Definition: map[string]interface{}{"max-length": i},
+		}
+		existing = append(existing, policy)
+		if i%2 == 0 {
+			policy.Definition = map[string]interface{}{"max-length": i + 1}
+		}
+		desired = append(desired, policy)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DiffPolicies(desired, existing, true)
+	}
+}
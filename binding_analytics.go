@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultMaxBindings bindings per exchange above which an exchange is flagged
+const defaultMaxBindings = 1000
+
+// ExchangeBindings : binding statistics of one exchange
+type ExchangeBindings struct {
+	Vhost        string `json:"vhost"`
+	Exchange     string `json:"exchange"`
+	Type         string `json:"type"`
+	Bindings     int    `json:"bindings"`
+	Destinations int    `json:"destinations"`
+	// topic exchanges only
+	Wildcards int `json:"wildcards"`
+	MaxDepth  int `json:"maxDepth"`
+	TrieNodes int `json:"trieNodes"`
+}
+
+// RoutingKeyBindings : number of bindings sharing one routing key
+type RoutingKeyBindings struct {
+	Vhost      string `json:"vhost"`
+	Exchange   string `json:"exchange"`
+	RoutingKey string `json:"routingKey"`
+	Bindings   int    `json:"bindings"`
+}
+
+// BindingReport : exchanges with many bindings and the largest fanouts
+type BindingReport struct {
+	Exchanges   []ExchangeBindings   `json:"exchanges"`
+	RoutingKeys []RoutingKeyBindings `json:"routingKeys"`
+	MaxBindings int                  `json:"-"`
+}
+
+// topicTrie count the words of the topic routing trie the broker builds from
+// the binding keys of an exchange, matching walks it word by word and
+// branches at every * and #
+type topicTrie map[string]topicTrie
+
+func (trie topicTrie) add(words []string) {
+	if len(words) == 0 {
+		return
+	}
+	child, ok := trie[words[0]]
+	if !ok {
+		child = topicTrie{}
+		trie[words[0]] = child
+	}
+	child.add(words[1:])
+}
+
+func (trie topicTrie) size() int {
+	count := len(trie)
+	for _, child := range trie {
+		count += child.size()
+	}
+	return count
+}
+
+// isWildcardKey true for topic binding keys with a * or # word
+func isWildcardKey(key string) bool {
+	for _, word := range strings.Split(key, ".") {
+		if word == "*" || word == "#" {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyzeBindings count bindings and destinations per exchange, the shape of
+// the topic tries and the routing keys bound most often. Exchanges with less
+// than minBindings bindings are left out, top limits the routing keys.
+func AnalyzeBindings(info rabtap.BrokerInfo, minBindings int, top int) BindingReport {
+	types := map[string]string{}
+	for _, exchange := range info.Exchanges {
+		types[exchange.Vhost+"/"+exchange.Name] = exchange.Type
+	}
+	stats := map[string]*ExchangeBindings{}
+	destinations := map[string]map[string]bool{}
+	tries := map[string]topicTrie{}
+	keys := map[string]*RoutingKeyBindings{}
+	for _, binding := range info.Bindings {
+		// every queue is bound to the default exchange
+		if binding.Source == "" {
+			continue
+		}
+		id := binding.Vhost + "/" + binding.Source
+		stat, ok := stats[id]
+		if !ok {
+			stat = &ExchangeBindings{Vhost: binding.Vhost, Exchange: binding.Source, Type: types[id]}
+			stats[id] = stat
+			destinations[id] = map[string]bool{}
+			tries[id] = topicTrie{}
+		}
+		stat.Bindings++
+		destinations[id][binding.DestinationType+"/"+binding.Destination] = true
+		if stat.Type == "topic" {
+			words := strings.Split(binding.RoutingKey, ".")
+			tries[id].add(words)
+			if len(words) > stat.MaxDepth {
+				stat.MaxDepth = len(words)
+			}
+			if isWildcardKey(binding.RoutingKey) {
+				stat.Wildcards++
+			}
+		}
+		keyID := id + "\x00" + binding.RoutingKey
+		if _, ok := keys[keyID]; !ok {
+			keys[keyID] = &RoutingKeyBindings{Vhost: binding.Vhost, Exchange: binding.Source, RoutingKey: binding.RoutingKey}
+		}
+		keys[keyID].Bindings++
+	}
+
+	report := BindingReport{Exchanges: []ExchangeBindings{}, RoutingKeys: []RoutingKeyBindings{}, MaxBindings: minBindings}
+	for id, stat := range stats {
+		stat.Destinations = len(destinations[id])
+		if stat.Type == "topic" {
+			stat.TrieNodes = tries[id].size()
+		}
+		if stat.Bindings >= minBindings {
+			report.Exchanges = append(report.Exchanges, *stat)
+		}
+	}
+	sort.Slice(report.Exchanges, func(i, j int) bool {
+		a, b := report.Exchanges[i], report.Exchanges[j]
+		if a.Bindings != b.Bindings {
+			return a.Bindings > b.Bindings
+		}
+		return a.Vhost+"/"+a.Exchange < b.Vhost+"/"+b.Exchange
+	})
+	for _, key := range keys {
+		report.RoutingKeys = append(report.RoutingKeys, *key)
+	}
+	sort.Slice(report.RoutingKeys, func(i, j int) bool {
+		a, b := report.RoutingKeys[i], report.RoutingKeys[j]
+		if a.Bindings != b.Bindings {
+			return a.Bindings > b.Bindings
+		}
+		return a.Vhost+"/"+a.Exchange+"/"+a.RoutingKey < b.Vhost+"/"+b.Exchange+"/"+b.RoutingKey
+	})
+	if len(report.RoutingKeys) > top {
+		report.RoutingKeys = report.RoutingKeys[:top]
+	}
+	return report
+}
+
+// Table exchanges followed by the top routing keys as table
+func (report BindingReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "EXCHANGE", "TYPE", "BINDINGS", "DESTINATIONS", "WILDCARDS", "DEPTH", "TRIE NODES"}}
+	for _, stat := range report.Exchanges {
+		color := None
+		if report.MaxBindings > 0 && stat.Bindings >= report.MaxBindings {
+			color = Yellow
+		}
+		depth, wildcards, nodes := "-", "-", "-"
+		if stat.Type == "topic" {
+			depth = fmt.Sprint(stat.MaxDepth)
+			wildcards = format.Count(int64(stat.Wildcards))
+			nodes = format.Count(int64(stat.TrieNodes))
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: stat.Vhost},
+			{Text: stat.Exchange, Color: color},
+			{Text: orDash(stat.Type)},
+			{Text: format.Count(int64(stat.Bindings)), Color: color},
+			{Text: format.Count(int64(stat.Destinations))},
+			{Text: wildcards},
+			{Text: depth},
+			{Text: nodes},
+		})
+	}
+	for _, key := range report.RoutingKeys {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: key.Vhost},
+			{Text: key.Exchange},
+			{Text: "key " + orDash(key.RoutingKey)},
+			{Text: format.Count(int64(key.Bindings))},
+			{Text: "-"}, {Text: "-"}, {Text: "-"}, {Text: "-"},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("binding-stats", "[--min-bindings n] [--top n] exchanges with many bindings and the largest fanouts", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("binding-stats")
+		minBindings := flags.Int("min-bindings", defaultMaxBindings, "only exchanges with at least this many bindings")
+		top := flags.Int("top", 10, "number of routing keys to show")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return AnalyzeBindings(rabbitmq.info(), *minBindings, *top), nil
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeBindings(t *testing.T) {
+	info := rabtap.BrokerInfo{
+		Exchanges: []rabtap.RabbitExchange{{Vhost: "/", Name: "events", Type: "topic"}, {Vhost: "/", Name: "fan", Type: "fanout"}},
+		Bindings: []rabtap.RabbitBinding{
+			{Vhost: "/", Source: "", Destination: "q1", DestinationType: "queue", RoutingKey: "q1"},
+			{Vhost: "/", Source: "events", Destination: "q1", DestinationType: "queue", RoutingKey: "order.*.created"},
+			{Vhost: "/", Source: "events", Destination: "q2", DestinationType: "queue", RoutingKey: "order.#"},
+			{Vhost: "/", Source: "events", Destination: "q3", DestinationType: "queue", RoutingKey: "order.#"},
+			{Vhost: "/", Source: "events", Destination: "q3", DestinationType: "queue", RoutingKey: "user.login"},
+			{Vhost: "/", Source: "fan", Destination: "q1", DestinationType: "queue"},
+		},
+	}
+	report := AnalyzeBindings(info, 2, 1)
+	assert.Equal(t, []ExchangeBindings{
+		{Vhost: "/", Exchange: "events", Type: "topic", Bindings: 4, Destinations: 3, Wildcards: 3, MaxDepth: 3, TrieNodes: 6},
+	}, report.Exchanges)
+	assert.Equal(t, []RoutingKeyBindings{{Vhost: "/", Exchange: "events", RoutingKey: "order.#", Bindings: 2}}, report.RoutingKeys)
+
+	assert.Len(t, AnalyzeBindings(info, 0, 10).Exchanges, 2)
+}
+
+func TestIsWildcardKey(t *testing.T) {
+	assert.True(t, isWildcardKey("a.*.c"))
+	assert.True(t, isWildcardKey("#"))
+	assert.False(t, isWildcardKey("a.b*.c"))
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	uuid "github.com/satori/go.uuid"
 )
@@ -19,6 +21,34 @@ func RequestHandler(reqType string, reqID string, content string) {
 		go loginHandler(reqID, content)
 	case "GET_BROKERINFO":
 		go updateBrokerInfo(reqID)
+	case "GET_CONNECTION_DETAILS":
+		go connectionDetails(reqID, content)
+	case "GET_QUEUE_CONSUMERS":
+		go queueConsumers(reqID, content)
+	case "GET_STREAMS":
+		go streams(reqID)
+	case "GET_PROTOCOL_SESSIONS":
+		go protocolSessions(reqID)
+	case "GET_CONNECTION_PEERS":
+		go connectionPeers(reqID, content)
+	case "START_DEFINITIONS_BACKUP":
+		go startDefinitionsBackup(reqID, content)
+	case "STOP_JOB":
+		go stopJobHandler(reqID, content)
+	case "GET_DEFINITIONS":
+		go definitions(reqID, content)
+	case "SIMULATE_POLICIES":
+		go simulatePolicies(reqID, content)
+	case "APPLY_POLICIES":
+		go applyPolicies(reqID, content)
+	case "PROVISION_USERS":
+		go provisionUsers(reqID, content)
+	case "CREATE_USER":
+		go createUser(reqID, content)
+	case "CREATE_MANIFEST":
+		go createManifest(reqID, content)
+	case "BULK_OPERATION":
+		go bulkOperation(reqID, content)
 	case "SUBSCRIBE":
 		go subscribe(reqID, content)
 	// case "UNSUSCRIBE":
@@ -35,7 +65,8 @@ func loginHandler(resID string, str string) {
 	if err != nil {
 		UIRespond("LOGIN_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
 	}
-	brokerInfoJSON := StringifyRabbitmqDetails(&rabbitmq.brokerInfo)
+	info := rabbitmq.info()
+	brokerInfoJSON := StringifyRabbitmqDetails(&info)
 	UIRespond("LOGIN_RESPONSE", resID, "SUCCESS", brokerInfoJSON, "")
 }
 
@@ -44,10 +75,160 @@ func updateBrokerInfo(resID string) {
 	if err != nil {
 		UIRespond("GET_BROKERINFO_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
 	}
-	brokerInfoJSON := StringifyRabbitmqDetails(&rabbitmq.brokerInfo)
+	info := rabbitmq.info()
+	brokerInfoJSON := StringifyRabbitmqDetails(&info)
 	UIRespond("GET_BROKERINFO_RESPONSE", resID,  "SUCCESS", brokerInfoJSON, "")
 }
 
+func connectionDetails(resID string, connName string) {
+	details, err := rabbitmq.ConnectionDetails(connName)
+	if err != nil {
+		UIRespond("GET_CONNECTION_DETAILS_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("GET_CONNECTION_DETAILS_RESPONSE", resID, "SUCCESS", StringifyJSON(details), "")
+}
+
+func queueConsumers(resID string, content string) {
+	consumers, err := rabbitmq.QueueConsumers(ParseQueueRef(content))
+	if err != nil {
+		UIRespond("GET_QUEUE_CONSUMERS_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("GET_QUEUE_CONSUMERS_RESPONSE", resID, "SUCCESS", StringifyJSON(consumers), "")
+}
+
+func streams(resID string) {
+	streams, err := rabbitmq.management().Streams()
+	if err != nil {
+		UIRespond("GET_STREAMS_RESPONSE", resID, "FAILURE", "[]", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("GET_STREAMS_RESPONSE", resID, "SUCCESS", StringifyJSON(streams), "")
+}
+
+func protocolSessions(resID string) {
+	if err := rabbitmq.UpdateBrokerInfo(); err != nil {
+		UIRespond("GET_PROTOCOL_SESSIONS_RESPONSE", resID, "FAILURE", "[]", fmt.Sprintf("%s", err))
+		return
+	}
+	info := rabbitmq.info()
+	sessions, err := rabbitmq.management().ProtocolSessions(&info)
+	if err != nil {
+		UIRespond("GET_PROTOCOL_SESSIONS_RESPONSE", resID, "FAILURE", "[]", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("GET_PROTOCOL_SESSIONS_RESPONSE", resID, "SUCCESS", StringifyJSON(sessions), "")
+}
+
+func connectionPeers(resID string, content string) {
+	conns, err := rabbitmq.AnnotatedConnections(ParsePeerOptions(content))
+	if err != nil {
+		UIRespond("GET_CONNECTION_PEERS_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("GET_CONNECTION_PEERS_RESPONSE", resID, "SUCCESS", StringifyJSON(conns), "")
+}
+
+func startDefinitionsBackup(resID string, content string) {
+	backup, err := NewDefinitionsBackup(rabbitmq.management(), ParseBackupOptions(content))
+	if err != nil {
+		UIRespond("START_DEFINITIONS_BACKUP_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	jobID, kill := startJob(resID)
+	UIRespond("START_DEFINITIONS_BACKUP_RESPONSE", resID, "SUCCESS", StringifyJSON(jobID), "")
+	backup.Run(kill)
+}
+
+func stopJobHandler(resID string, jobID string) {
+	if err := stopJob(jobID); err != nil {
+		UIRespond("STOP_JOB_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("STOP_JOB_RESPONSE", resID, "SUCCESS", "{}", "")
+}
+
+func definitions(resID string, content string) {
+	data, err := rabbitmq.management().NormalizedDefinitions(ParseDefinitionsOptions(content))
+	if err != nil {
+		UIRespond("GET_DEFINITIONS_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	var compact bytes.Buffer
+	json.Compact(&compact, data)
+	UIRespond("GET_DEFINITIONS_RESPONSE", resID, "SUCCESS", compact.String(), "")
+}
+
+func simulatePolicies(resID string, content string) {
+	sim, err := rabbitmq.management().SimulatePolicies(ParsePolicyChanges(content))
+	if err != nil {
+		UIRespond("SIMULATE_POLICIES_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("SIMULATE_POLICIES_RESPONSE", resID, "SUCCESS", StringifyJSON(sim), "")
+}
+
+func applyPolicies(resID string, content string) {
+	result, err := rabbitmq.management().ApplyPolicyFile(ParsePolicyApplyOptions(content))
+	if err != nil {
+		UIRespond("APPLY_POLICIES_RESPONSE", resID, "FAILURE", StringifyJSON(result), fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("APPLY_POLICIES_RESPONSE", resID, "SUCCESS", StringifyJSON(result), "")
+}
+
+func provisionUsers(resID string, content string) {
+	plan, err := rabbitmq.management().ProvisionUsers(ParseUserProvisioningOptions(content))
+	if err != nil {
+		UIRespond("PROVISION_USERS_RESPONSE", resID, "FAILURE", StringifyJSON(plan), fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("PROVISION_USERS_RESPONSE", resID, "SUCCESS", StringifyJSON(plan), "")
+}
+
+func createUser(resID string, content string) {
+	var user NewUser
+	if err := json.Unmarshal([]byte(content), &user); err != nil {
+		UIRespond("CREATE_USER_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	if err := rabbitmq.management().CreateUser(user); err != nil {
+		UIRespond("CREATE_USER_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("CREATE_USER_RESPONSE", resID, "SUCCESS", "{}", "")
+}
+
+func createManifest(resID string, content string) {
+	progress := func(p BulkProgress) {
+		UIRespond("CREATE_MANIFEST_PROGRESS", resID, "SUCCESS", StringifyJSON(p), "")
+	}
+	summary, err := rabbitmq.management().CreateManifest(ParseManifestOptions(content), progress)
+	if err != nil {
+		UIRespond("CREATE_MANIFEST_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("CREATE_MANIFEST_RESPONSE", resID, "SUCCESS", StringifyJSON(summary), "")
+}
+
+func bulkOperation(resID string, content string) {
+	var req BulkRequest
+	if err := json.Unmarshal([]byte(content), &req); err != nil {
+		UIRespond("BULK_OPERATION_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	progress := func(p BulkProgress) {
+		UIRespond("BULK_OPERATION_PROGRESS", resID, "SUCCESS", StringifyJSON(p), "")
+	}
+	summary, err := rabbitmq.management().RunBulkRequest(req, progress)
+	if err != nil {
+		UIRespond("BULK_OPERATION_RESPONSE", resID, "FAILURE", "{}", fmt.Sprintf("%s", err))
+		return
+	}
+	UIRespond("BULK_OPERATION_RESPONSE", resID, "SUCCESS", StringifyJSON(summary), "")
+}
+
 func newUUID(resID string) string {
 	u := uuid.NewV4()
 	return u.String()[:8]
@@ -12,6 +12,26 @@ type RabbitmqLoginDetails struct {
 	Port string `json:"port"`
 	Username string `json:"userName"`
 	Password string `json:"password"`
+	// Discovery resolves Host as a dns srv name ("srv") or consul service ("consul")
+	Discovery string `json:"discovery"`
+	ConsulAddr string `json:"consulAddr"`
+	// ManagementURL when set the amqp endpoint is derived from its listeners
+	ManagementURL string `json:"managementUrl"`
+	// TLS settings, shared by the amqp connection and the management client
+	TLS bool `json:"tls"`
+	CACert string `json:"caCert"`
+	ClientCert string `json:"clientCert"`
+	ClientKey string `json:"clientKey"`
+	TLSSkipVerify bool `json:"tlsSkipVerify"`
+	// AuthMechanism PLAIN (default) or EXTERNAL to login by client certificate
+	AuthMechanism string `json:"authMechanism"`
+	// Scope comma separated name prefixes like team-a.*, only objects
+	// matching them are listed and written
+	Scope string `json:"scope"`
+	// ReadOnly refuse every operation modifying the broker
+	ReadOnly bool `json:"readOnly"`
+	// DefaultVhost vhost of commands run without --vhost, "/" when empty
+	DefaultVhost string `json:"defaultVhost"`
 }
 
 
@@ -33,6 +53,15 @@ func StringifyRabbitmqDetails(info *rabtap.BrokerInfo) string {
 	return string(e);
 }
 
+//StringifyJSON : stringify any response value
+func StringifyJSON(v interface{}) string {
+	e, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println(err)
+	}
+	return string(e)
+}
+
 // UIRespond : send data to frontend
 func UIRespond(resType string, resID string, status string, response string, err string) {
 	str := fmt.Sprintf("response('%s', '%s', '%s', '%s', '%s')",resType, resID, status, response, err);
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sort"
+)
+
+// MetricDef : a broker metric, shared by all exporters so the prometheus,
+// push and otlp outputs carry the same data
+type MetricDef struct {
+	Name string
+	Help string
+	// Kind gauge or counter
+	Kind string
+	Unit string
+}
+
+// MetricLabel : name and value of a label
+type MetricLabel struct {
+	Name  string
+	Value string
+}
+
+// MetricSample : value of a metric for one set of labels
+type MetricSample struct {
+	Def    MetricDef
+	Labels []MetricLabel
+	Value  float64
+}
+
+var (
+	metricMessages        = MetricDef{"messages", "Messages in all queues.", "gauge", "{message}"}
+	metricMessagesReady   = MetricDef{"messages_ready", "Messages ready for delivery in all queues.", "gauge", "{message}"}
+	metricMessagesUnacked = MetricDef{"messages_unacknowledged", "Messages delivered but not acknowledged in all queues.", "gauge", "{message}"}
+	metricPublishRate     = MetricDef{"publish_rate", "Messages published per second.", "gauge", "{message}/s"}
+	metricDeliverRate     = MetricDef{"deliver_get_rate", "Messages delivered or fetched per second.", "gauge", "{message}/s"}
+	metricObjects         = MetricDef{"objects", "Number of objects by kind.", "gauge", "{object}"}
+
+	metricQueueMessages      = MetricDef{"queue_messages", "Messages in the queue.", "gauge", "{message}"}
+	metricQueueMessagesReady = MetricDef{"queue_messages_ready", "Messages ready for delivery in the queue.", "gauge", "{message}"}
+	metricQueueUnacked       = MetricDef{"queue_messages_unacknowledged", "Messages delivered but not acknowledged.", "gauge", "{message}"}
+	metricQueueBytes         = MetricDef{"queue_message_bytes", "Size of the messages in the queue.", "gauge", "By"}
+	metricQueueConsumers     = MetricDef{"queue_consumers", "Consumers of the queue.", "gauge", "{consumer}"}
+	metricQueuePublishRate   = MetricDef{"queue_publish_rate", "Messages published to the queue per second.", "gauge", "{message}/s"}
+	metricQueueDeliverRate   = MetricDef{"queue_deliver_get_rate", "Messages delivered from the queue per second.", "gauge", "{message}/s"}
+
+	metricConnectionRecv     = MetricDef{"connection_received_bytes", "Bytes received on the connection.", "counter", "By"}
+	metricConnectionSend     = MetricDef{"connection_sent_bytes", "Bytes sent on the connection.", "counter", "By"}
+	metricConnectionChannels = MetricDef{"connection_channels", "Channels open on the connection.", "gauge", "{channel}"}
+
+	metricNodeQueues      = MetricDef{"node_queues", "Queues located on the node.", "gauge", "{queue}"}
+	metricNodeMessages    = MetricDef{"node_messages", "Messages in the queues located on the node.", "gauge", "{message}"}
+	metricNodeConnections = MetricDef{"node_connections", "Client connections to the node.", "gauge", "{connection}"}
+)
+
+// BrokerMetrics the metrics of a snapshot. Queue rates computed by radish
+// are preferred over the rates reported by the broker.
+func BrokerMetrics(snapshot *Snapshot) []MetricSample {
+	info := snapshot.Info
+	overview := info.Overview
+	samples := []MetricSample{
+		{metricMessages, nil, float64(overview.QueueTotals.Messages)},
+		{metricMessagesReady, nil, float64(overview.QueueTotals.MessagesReady)},
+		{metricMessagesUnacked, nil, float64(overview.QueueTotals.MessagesUnacknowledged)},
+		{metricPublishRate, nil, overview.MessageStats.PublishDetails.Rate},
+		{metricDeliverRate, nil, overview.MessageStats.DeliverGetDetails.Rate},
+		{metricObjects, []MetricLabel{{"kind", "queues"}}, float64(len(info.Queues))},
+		{metricObjects, []MetricLabel{{"kind", "exchanges"}}, float64(len(info.Exchanges))},
+		{metricObjects, []MetricLabel{{"kind", "bindings"}}, float64(len(info.Bindings))},
+		{metricObjects, []MetricLabel{{"kind", "connections"}}, float64(len(info.Connections))},
+		{metricObjects, []MetricLabel{{"kind", "consumers"}}, float64(len(info.Consumers))},
+	}
+
+	type nodeTotals struct{ queues, messages, connections int }
+	nodes := map[string]*nodeTotals{}
+	node := func(name string) *nodeTotals {
+		if nodes[name] == nil {
+			nodes[name] = &nodeTotals{}
+		}
+		return nodes[name]
+	}
+	for _, q := range info.Queues {
+		labels := []MetricLabel{{"vhost", q.Vhost}, {"queue", q.Name}}
+		publish, deliver := q.MessageStats.PublishDetails.Rate, q.MessageStats.DeliverGetDetails.Rate
+		if rates, ok := snapshot.Rates.Queues[q.Vhost+"/"+q.Name]; ok {
+			publish, deliver = rates.Publish, rates.DeliverGet
+		}
+		samples = append(samples,
+			MetricSample{metricQueueMessages, labels, float64(q.Messages)},
+			MetricSample{metricQueueMessagesReady, labels, float64(q.MessagesReady)},
+			MetricSample{metricQueueUnacked, labels, float64(q.MessagesUnacknowledged)},
+			MetricSample{metricQueueBytes, labels, float64(q.MessageBytes)},
+			MetricSample{metricQueueConsumers, labels, float64(q.Consumers)},
+			MetricSample{metricQueuePublishRate, labels, publish},
+			MetricSample{metricQueueDeliverRate, labels, deliver},
+		)
+		if q.Node != "" {
+			node(q.Node).queues++
+			node(q.Node).messages += q.Messages
+		}
+	}
+	for _, c := range info.Connections {
+		labels := []MetricLabel{{"vhost", c.Vhost}, {"user", c.User}, {"connection", c.Name}}
+		samples = append(samples,
+			MetricSample{metricConnectionRecv, labels, float64(c.RecvOct)},
+			MetricSample{metricConnectionSend, labels, float64(c.SendOct)},
+			MetricSample{metricConnectionChannels, labels, float64(c.Channels)},
+		)
+		if c.Node != "" {
+			node(c.Node).connections++
+		}
+	}
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		labels := []MetricLabel{{"node", name}}
+		samples = append(samples,
+			MetricSample{metricNodeQueues, labels, float64(nodes[name].queues)},
+			MetricSample{metricNodeMessages, labels, float64(nodes[name].messages)},
+			MetricSample{metricNodeConnections, labels, float64(nodes[name].connections)},
+		)
+	}
+	return samples
+}
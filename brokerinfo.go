@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultBrokerInfoTimeout deadline of a complete broker info fetch
+const defaultBrokerInfoTimeout = 30 * time.Second
+
+// BrokerInfo fetch all resources in parallel. The call returns when all of
+// them arrived, one failed or ctx is done; outstanding requests are aborted
+// then, so no worker outlives the call. Objects outside the scope of the
+// client are dropped.
+func (client *ManagementClient) BrokerInfo(ctx context.Context) (rabtap.BrokerInfo, error) {
+	var info rabtap.BrokerInfo
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	targets := map[string]interface{}{
+		"overview":    &info.Overview,
+		"connections": &info.Connections,
+		"exchanges":   &info.Exchanges,
+		"queues":      &info.Queues,
+		"consumers":   &info.Consumers,
+		"bindings":    &info.Bindings,
+	}
+	// buffered, workers never block on sending their result
+	results := make(chan error, len(targets))
+	for path, target := range targets {
+		go func(path string, target interface{}) {
+			results <- client.getContext(ctx, path, target)
+		}(path, target)
+	}
+	for range targets {
+		select {
+		case err := <-results:
+			if err != nil {
+				return rabtap.BrokerInfo{}, err
+			}
+		case <-ctx.Done():
+			return rabtap.BrokerInfo{}, ctx.Err()
+		}
+	}
+	return client.scope.FilterBrokerInfo(info), nil
+}
+
+// Overview of the broker, the poller fetches the resources one at a time
+// through these
+func (client *ManagementClient) Overview(ctx context.Context) (rabtap.RabbitOverview, error) {
+	var overview rabtap.RabbitOverview
+	err := client.getContext(ctx, "overview", &overview)
+	return overview, err
+}
+
+// Connections of the broker
+func (client *ManagementClient) Connections(ctx context.Context) ([]rabtap.RabbitConnection, error) {
+	var connections []rabtap.RabbitConnection
+	err := client.getContext(ctx, "connections", &connections)
+	return connections, err
+}
+
+// Exchanges of the broker
+func (client *ManagementClient) Exchanges(ctx context.Context) ([]rabtap.RabbitExchange, error) {
+	var exchanges []rabtap.RabbitExchange
+	err := client.getContext(ctx, "exchanges", &exchanges)
+	return client.scope.FilterBrokerInfo(rabtap.BrokerInfo{Exchanges: exchanges}).Exchanges, err
+}
+
+// Queues of the broker
+func (client *ManagementClient) Queues(ctx context.Context) ([]rabtap.RabbitQueue, error) {
+	var queues []rabtap.RabbitQueue
+	err := client.getContext(ctx, "queues", &queues)
+	return client.scope.FilterBrokerInfo(rabtap.BrokerInfo{Queues: queues}).Queues, err
+}
+
+// Consumers of the broker
+func (client *ManagementClient) Consumers(ctx context.Context) ([]rabtap.RabbitConsumer, error) {
+	var consumers []rabtap.RabbitConsumer
+	err := client.getContext(ctx, "consumers", &consumers)
+	return client.scope.FilterBrokerInfo(rabtap.BrokerInfo{Consumers: consumers}).Consumers, err
+}
+
+// Bindings of the broker
+func (client *ManagementClient) Bindings(ctx context.Context) ([]rabtap.RabbitBinding, error) {
+	var bindings []rabtap.RabbitBinding
+	err := client.getContext(ctx, "bindings", &bindings)
+	return client.scope.FilterBrokerInfo(rabtap.BrokerInfo{Bindings: bindings}).Bindings, err
+}
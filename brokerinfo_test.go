@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrokerInfoTimeout(t *testing.T) {
+	aborted := make(chan bool, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/queues" {
+			// never answers, until the client gives up
+			<-r.Context().Done()
+			aborted <- true
+			return
+		}
+		if r.URL.Path == "/api/overview" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	uri, _ := url.Parse(ts.URL + "/api")
+	client := NewManagementClient(uri, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.BrokerInfo(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("pending request was not aborted")
+	}
+}
+
+func TestBrokerInfo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/overview":
+			w.Write([]byte(`{"management_version":"3.8.2"}`))
+		case "/api/queues":
+			w.Write([]byte(`[{"name":"q1","vhost":"/"}]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer ts.Close()
+
+	uri, _ := url.Parse(ts.URL + "/api")
+	info, err := NewManagementClient(uri, nil).BrokerInfo(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "3.8.2", info.Overview.ManagementVersion)
+	assert.Equal(t, "q1", info.Queues[0].Name)
+}
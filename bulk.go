@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBulkConcurrency = 8
+
+// bulkLogInterval minimum time between two progress log lines
+const bulkLogInterval = time.Second
+
+// BulkTask : a single operation of a bulk run
+type BulkTask struct {
+	ID  string
+	Run func() error
+}
+
+// BulkFailure : a failed task of a bulk run
+type BulkFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// BulkSummary : outcome of a bulk run
+type BulkSummary struct {
+	Total     int           `json:"total"`
+	Succeeded int           `json:"succeeded"`
+	Skipped   int           `json:"skipped"`
+	Failures  []BulkFailure `json:"failures"`
+}
+
+// BulkProgress : progress of a running bulk run
+type BulkProgress struct {
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+	Total  int `json:"total"`
+}
+
+// BulkOptions : options shared by all bulk operations
+type BulkOptions struct {
+	Concurrency int `json:"concurrency"`
+	// Checkpoint file recording finished tasks. Tasks listed in an existing
+	// checkpoint are skipped, so a partially failed run can be resumed.
+	Checkpoint string `json:"checkpoint"`
+}
+
+// readCheckpoint the ids of the tasks finished in an earlier run
+func readCheckpoint(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			done[line] = true
+		}
+	}
+	return done, scanner.Err()
+}
+
+// RunBulk run the tasks with the configured number of workers, progress is
+// called after every finished task
+func RunBulk(tasks []BulkTask, opts BulkOptions, progress func(BulkProgress)) (BulkSummary, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	summary := BulkSummary{Total: len(tasks), Failures: []BulkFailure{}}
+
+	var checkpoint *os.File
+	finished := map[string]bool{}
+	if opts.Checkpoint != "" {
+		var err error
+		if finished, err = readCheckpoint(opts.Checkpoint); err != nil {
+			return summary, err
+		}
+		checkpoint, err = os.OpenFile(opts.Checkpoint, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return summary, err
+		}
+		defer checkpoint.Close()
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan BulkTask)
+	lastLog := time.Time{}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				err := task.Run()
+				mutex.Lock()
+				if err != nil {
+					summary.Failures = append(summary.Failures, BulkFailure{ID: task.ID, Error: err.Error()})
+				} else {
+					summary.Succeeded++
+					if checkpoint != nil {
+						fmt.Fprintln(checkpoint, task.ID)
+					}
+				}
+				current := BulkProgress{
+					Done:   summary.Skipped + summary.Succeeded + len(summary.Failures),
+					Failed: len(summary.Failures),
+					Total:  summary.Total,
+				}
+				if time.Since(lastLog) >= bulkLogInterval || current.Done == current.Total {
+					subsystemLog("bulk").Infof("%d/%d done, %d failed", current.Done, current.Total, current.Failed)
+					lastLog = time.Now()
+				}
+				if progress != nil {
+					progress(current)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, task := range tasks {
+		if finished[task.ID] {
+			mutex.Lock()
+			summary.Skipped++
+			mutex.Unlock()
+			continue
+		}
+		queue <- task
+	}
+	close(queue)
+	wg.Wait()
+	return summary, nil
+}
+
+// ObjectRef : a named object in a vhost, vhost is empty for connections
+type ObjectRef struct {
+	Vhost string `json:"vhost"`
+	Name  string `json:"name"`
+}
+
+// BulkRequest : a bulk operation on a list of objects
+type BulkRequest struct {
+	// Operation is one of delete_queues, delete_exchanges, purge_queues or
+	// close_connections
+	Operation string      `json:"operation"`
+	Targets   []ObjectRef `json:"targets"`
+	Reason    string      `json:"reason"`
+	BulkOptions
+}
+
+// BulkTasks the tasks executing the bulk request
+func (client *ManagementClient) BulkTasks(req BulkRequest) ([]BulkTask, error) {
+	var op func(ObjectRef) error
+	switch req.Operation {
+	case "delete_queues":
+		op = func(ref ObjectRef) error { return client.DeleteQueue(ref.Vhost, ref.Name) }
+	case "delete_exchanges":
+		op = func(ref ObjectRef) error { return client.DeleteExchange(ref.Vhost, ref.Name) }
+	case "purge_queues":
+		op = func(ref ObjectRef) error { return client.PurgeQueue(ref.Vhost, ref.Name) }
+	case "close_connections":
+		op = func(ref ObjectRef) error { return client.CloseConnection(ref.Name, req.Reason) }
+	default:
+		return nil, fmt.Errorf("unknown bulk operation %s", req.Operation)
+	}
+	tasks := []BulkTask{}
+	for _, target := range req.Targets {
+		target := target
+		tasks = append(tasks, BulkTask{
+			ID:  fmt.Sprintf("%s %s/%s", req.Operation, target.Vhost, target.Name),
+			Run: func() error { return op(target) },
+		})
+	}
+	return tasks, nil
+}
+
+// RunBulkRequest execute a bulk request against the broker
+func (client *ManagementClient) RunBulkRequest(req BulkRequest, progress func(BulkProgress)) (BulkSummary, error) {
+	tasks, err := client.BulkTasks(req)
+	if err != nil {
+		return BulkSummary{}, err
+	}
+	return RunBulk(tasks, req.BulkOptions, progress)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBulkResumesFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radish-bulk")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	checkpoint := filepath.Join(dir, "checkpoint")
+
+	runs := map[string]int{}
+	failing := map[string]bool{"task-3": true}
+	tasks := []BulkTask{}
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("task-%d", i)
+		tasks = append(tasks, BulkTask{ID: id, Run: func() error {
+			runs[id]++
+			if failing[id] {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		}})
+	}
+
+	opts := BulkOptions{Concurrency: 1, Checkpoint: checkpoint}
+	summary, err := RunBulk(tasks, opts, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, summary.Succeeded)
+	assert.Equal(t, "task-3", summary.Failures[0].ID)
+
+	delete(failing, "task-3")
+	summary, err = RunBulk(tasks, opts, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, summary.Skipped)
+	assert.Equal(t, 1, summary.Succeeded)
+	assert.Equal(t, 2, runs["task-3"])
+	assert.Equal(t, 1, runs["task-0"])
+}
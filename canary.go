@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// canaryWindow latency samples kept for the percentiles
+const canaryWindow = 1000
+
+// LatencyStats : sliding window of latency samples
+type LatencyStats struct {
+	mutex   sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int64
+	sum     time.Duration
+}
+
+// Add record a sample, the oldest one is dropped once the window is full
+func (stats *LatencyStats) Add(latency time.Duration) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	stats.count++
+	stats.sum += latency
+	if len(stats.samples) < canaryWindow {
+		stats.samples = append(stats.samples, latency)
+		return
+	}
+	stats.samples[stats.next] = latency
+	stats.next = (stats.next + 1) % canaryWindow
+}
+
+// Count samples recorded in total
+func (stats *LatencyStats) Count() int64 {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	return stats.count
+}
+
+// Sum of all samples recorded
+func (stats *LatencyStats) Sum() time.Duration {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	return stats.sum
+}
+
+// Percentiles nearest rank percentiles of the window, p in 0..100
+func (stats *LatencyStats) Percentiles(ps ...float64) []time.Duration {
+	stats.mutex.Lock()
+	sorted := append([]time.Duration{}, stats.samples...)
+	stats.mutex.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	res := make([]time.Duration, len(ps))
+	if len(sorted) == 0 {
+		return res
+	}
+	for i, p := range ps {
+		rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		res[i] = sorted[rank]
+	}
+	return res
+}
+
+// CanaryOptions : how often and how large canary messages are sent
+type CanaryOptions struct {
+	Interval time.Duration
+	Count    int
+	Size     int
+	Timeout  time.Duration
+}
+
+// Canary : publishes timestamped messages to a transient queue and
+// consumes them back, measuring confirm and round trip latency
+type Canary struct {
+	opts      CanaryOptions
+	RoundTrip LatencyStats
+	Confirm   LatencyStats
+	mutex     sync.Mutex
+	lost      int64
+}
+
+// NewCanary create a canary, unset options get defaults
+func NewCanary(opts CanaryOptions) *Canary {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &Canary{opts: opts}
+}
+
+// Lost messages not confirmed or not received within the timeout
+func (canary *Canary) Lost() int64 {
+	canary.mutex.Lock()
+	defer canary.mutex.Unlock()
+	return canary.lost
+}
+
+func (canary *Canary) addLost() {
+	canary.mutex.Lock()
+	defer canary.mutex.Unlock()
+	canary.lost++
+}
+
+// CanarySample : latencies of one canary message
+type CanarySample struct {
+	Seq       int           `json:"seq"`
+	Confirm   time.Duration `json:"confirm"`
+	RoundTrip time.Duration `json:"roundTrip"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// canaryChannel : channel the canary publishes and consumes on. Delivery
+// tags of confirms count from 1 on every channel, tag is the one of the
+// last publish.
+type canaryChannel struct {
+	ch         *amqp.Channel
+	queue      string
+	confirms   <-chan amqp.Confirmation
+	deliveries <-chan amqp.Delivery
+	tag        uint64
+}
+
+// openCanaryChannel declare the canary queue on a new channel of conn and
+// consume it
+func openCanaryChannel(conn *amqp.Connection) (*canaryChannel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 16))
+	deliveries, err := ch.Consume(queue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return &canaryChannel{ch: ch, queue: queue.Name, confirms: confirms, deliveries: deliveries}, nil
+}
+
+// canaryConnectPoll how often the canary checks for a connection while the
+// manager reconnects
+const canaryConnectPoll = 50 * time.Millisecond
+
+// connection wait up to the timeout for the manager to be connected
+func (canary *Canary) connection(ctx context.Context, manager *AMQPManager) *amqp.Connection {
+	timeout := time.After(canary.opts.Timeout)
+	for {
+		if conn := manager.Connection(); conn != nil {
+			return conn
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timeout:
+			return nil
+		case <-time.After(canaryConnectPoll):
+		}
+	}
+}
+
+// Run send canary messages over the connection of manager until ctx is
+// done or Count messages were sent, every sample is passed to observe. The
+// manager has to be running, after a reconnect the canary opens a new
+// channel and carries on; messages sent while disconnected count as lost.
+func (canary *Canary) Run(ctx context.Context, manager *AMQPManager, observe func(CanarySample)) error {
+	if manager == nil {
+		return ErrOffline
+	}
+	var cc *canaryChannel
+	defer func() {
+		if cc != nil {
+			cc.ch.Close()
+		}
+	}()
+	body := make([]byte, canary.opts.Size)
+	ticker := time.NewTicker(canary.opts.Interval)
+	defer ticker.Stop()
+	for seq := 1; canary.opts.Count <= 0 || seq <= canary.opts.Count; seq++ {
+		var sample CanarySample
+		if cc == nil {
+			if conn := canary.connection(ctx, manager); conn == nil {
+				sample = CanarySample{Seq: seq, Error: errNotConnected.Error()}
+			} else if opened, err := openCanaryChannel(conn); err != nil {
+				sample = CanarySample{Seq: seq, Error: err.Error()}
+			} else {
+				cc = opened
+			}
+		}
+		if cc != nil {
+			var broken bool
+			sample, broken = canary.send(cc, seq, body)
+			if broken {
+				cc.ch.Close()
+				cc = nil
+			}
+		} else {
+			canary.addLost()
+		}
+		if observe != nil {
+			observe(sample)
+		}
+		if canary.opts.Count > 0 && seq == canary.opts.Count {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// send publish one message and wait for its confirm and delivery. broken
+// reports a closed channel, which has to be opened again.
+func (canary *Canary) send(cc *canaryChannel, seq int, body []byte) (sample CanarySample, broken bool) {
+	sample = CanarySample{Seq: seq}
+	id := strconv.Itoa(seq)
+	sent := time.Now()
+	err := cc.ch.Publish("", cc.queue, false, false, amqp.Publishing{MessageId: id, Timestamp: sent, Body: body})
+	if err != nil {
+		sample.Error = err.Error()
+		canary.addLost()
+		return sample, true
+	}
+	cc.tag++
+	timeout := time.After(canary.opts.Timeout)
+	for confirmed, received := false, false; !confirmed || !received; {
+		select {
+		case confirm, ok := <-cc.confirms:
+			if !ok {
+				sample.Error = "channel closed"
+				canary.addLost()
+				return sample, true
+			}
+			// late confirms of earlier, timed out messages are skipped
+			if confirm.DeliveryTag != cc.tag {
+				continue
+			}
+			confirmed = true
+			if !confirm.Ack {
+				sample.Error = "publish nacked"
+				canary.addLost()
+				return sample, false
+			}
+			sample.Confirm = time.Since(sent)
+			canary.Confirm.Add(sample.Confirm)
+		case delivery, ok := <-cc.deliveries:
+			if !ok {
+				sample.Error = "consumer cancelled"
+				canary.addLost()
+				return sample, true
+			}
+			// late deliveries of earlier, timed out messages are skipped
+			if delivery.MessageId != id {
+				continue
+			}
+			received = true
+			sample.RoundTrip = time.Since(sent)
+			canary.RoundTrip.Add(sample.RoundTrip)
+		case <-timeout:
+			sample.Error = fmt.Sprintf("no answer within %s", canary.opts.Timeout)
+			canary.addLost()
+			return sample, false
+		}
+	}
+	return sample, false
+}
+
+// canaryQuantiles percentiles reported for the canary
+var canaryQuantiles = []float64{50, 90, 99, 100}
+
+// CanaryReport : latency percentiles of a canary run
+type CanaryReport struct {
+	Sent      int64           `json:"sent"`
+	Lost      int64           `json:"lost"`
+	Quantiles []float64       `json:"quantiles"`
+	RoundTrip []time.Duration `json:"roundTrip"`
+	Confirm   []time.Duration `json:"confirm"`
+}
+
+// Report current percentiles of the canary
+func (canary *Canary) Report() CanaryReport {
+	return CanaryReport{
+		Sent:      canary.RoundTrip.Count() + canary.Lost(),
+		Lost:      canary.Lost(),
+		Quantiles: canaryQuantiles,
+		RoundTrip: canary.RoundTrip.Percentiles(canaryQuantiles...),
+		Confirm:   canary.Confirm.Percentiles(canaryQuantiles...),
+	}
+}
+
+// Table percentiles as table
+func (report CanaryReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"PERCENTILE", "ROUND TRIP", "CONFIRM"}}
+	for i, q := range report.Quantiles {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: fmt.Sprintf("p%g", q)},
+			{Text: report.RoundTrip[i].String()},
+			{Text: report.Confirm[i].String()},
+		})
+	}
+	lostColor := Green
+	if report.Lost > 0 {
+		lostColor = Red
+	}
+	table.Rows = append(table.Rows, []Cell{{Text: "lost"}, {Text: fmt.Sprintf("%d of %d", report.Lost, report.Sent), Color: lostColor}, {Text: ""}})
+	return table
+}
+
+func init() {
+	registerCommand("canary", "[--interval d] [--count n] [--size b] measure publish/consume latency", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("canary")
+		var opts CanaryOptions
+		flags.DurationVar(&opts.Interval, "interval", time.Second, "time between two messages")
+		flags.IntVar(&opts.Count, "count", 10, "messages to send, 0 runs until interrupted")
+		flags.IntVar(&opts.Size, "size", 64, "payload size in bytes")
+		flags.DurationVar(&opts.Timeout, "timeout", 5*time.Second, "time a message may take before it counts as lost")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		ctx, stop := signalContext(context.Background())
+		defer stop()
+		manager := NewAMQPManager(rabbitmq.amqpURL, rabbitmq.amqpConfig, AMQPManagerOptions{})
+		go manager.Run(ctx)
+		canary := NewCanary(opts)
+		err = canary.Run(ctx, manager, func(sample CanarySample) {
+			if cli.json {
+				return
+			}
+			if sample.Error != "" {
+				fmt.Fprintf(cli.out, "seq=%d error=%s\n", sample.Seq, sample.Error)
+				return
+			}
+			fmt.Fprintf(cli.out, "seq=%d confirm=%s round_trip=%s\n", sample.Seq, sample.Confirm, sample.RoundTrip)
+		})
+		return canary.Report(), err
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyStats(t *testing.T) {
+	var stats LatencyStats
+	assert.Equal(t, []time.Duration{0}, stats.Percentiles(50))
+	for i := 1; i <= 100; i++ {
+		stats.Add(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, []time.Duration{50 * time.Millisecond, 99 * time.Millisecond, 100 * time.Millisecond},
+		stats.Percentiles(50, 99, 100))
+
+	for i := 0; i < canaryWindow; i++ {
+		stats.Add(time.Second)
+	}
+	assert.Equal(t, int64(100+canaryWindow), stats.Count())
+	assert.Equal(t, []time.Duration{time.Second}, stats.Percentiles(1))
+	assert.Equal(t, 5050*time.Millisecond+canaryWindow*time.Second, stats.Sum())
+}
+
+func TestCanaryOffline(t *testing.T) {
+	canary := NewCanary(CanaryOptions{Count: 2, Interval: time.Millisecond, Timeout: time.Millisecond})
+	manager := NewAMQPManager("amqp://localhost", amqp.Config{}, AMQPManagerOptions{})
+	var samples []CanarySample
+	assert.Nil(t, canary.Run(context.Background(), manager, func(sample CanarySample) {
+		samples = append(samples, sample)
+	}))
+	assert.Equal(t, 2, len(samples))
+	assert.Equal(t, errNotConnected.Error(), samples[1].Error)
+	assert.Equal(t, int64(2), canary.Lost())
+	assert.Equal(t, ErrOffline, canary.Run(context.Background(), nil, nil))
+}
+
+func TestCanaryMetrics(t *testing.T) {
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	server.canary = NewCanary(CanaryOptions{})
+	server.canary.RoundTrip.Add(20 * time.Millisecond)
+	server.canary.RoundTrip.Add(30 * time.Millisecond)
+	server.canary.addLost()
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.True(t, strings.Contains(body, "radish_canary_round_trip_seconds{quantile=\"0.5\"} 0.02\n"))
+	assert.True(t, strings.Contains(body, "radish_canary_round_trip_seconds_sum 0.05\n"))
+	assert.True(t, strings.Contains(body, "radish_canary_round_trip_seconds_count 2\n"))
+	assert.True(t, strings.Contains(body, "radish_canary_lost_total 1\n"))
+
+	report := server.canary.Report()
+	assert.Equal(t, int64(3), report.Sent)
+	assert.Equal(t, "1 of 3", report.Table(NumberFormat{}).Rows[4][1].Text)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultExpiryWindow certificates expiring within are reported
+const defaultExpiryWindow = 30 * 24 * time.Hour
+
+// CertInfo : certificate of a client connection or a broker listener
+type CertInfo struct {
+	Source    string    `json:"source"`
+	Name      string    `json:"name"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	Expiring  bool      `json:"expiring"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// certTimeLayouts formats of peer_cert_validity across broker versions
+var certTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+func parseCertTime(str string) (time.Time, error) {
+	str = strings.TrimSpace(str)
+	for _, layout := range certTimeLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown certificate time %q", str)
+}
+
+// ParseCertValidity parse the "<not before> - <not after>" validity of a
+// connection's peer certificate
+func ParseCertValidity(validity string) (time.Time, time.Time, error) {
+	parts := strings.Split(validity, " - ")
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown certificate validity %q", validity)
+	}
+	notBefore, err := parseCertTime(parts[0])
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	notAfter, err := parseCertTime(parts[1])
+	return notBefore, notAfter, err
+}
+
+// certField string value of a peer_cert_* field, the broker sends null
+// for connections without certificate
+func certField(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return ""
+}
+
+// ConnectionCerts client certificates of the tls connections in conns
+func ConnectionCerts(conns []rabtap.RabbitConnection, now time.Time, window time.Duration) []CertInfo {
+	certs := []CertInfo{}
+	for _, conn := range conns {
+		validity := certField(conn.PeerCertValidity)
+		if !conn.Ssl || validity == "" {
+			continue
+		}
+		cert := CertInfo{
+			Source:  "connection",
+			Name:    conn.Name,
+			Subject: certField(conn.PeerCertSubject),
+			Issuer:  certField(conn.PeerCertIssuer),
+		}
+		var err error
+		if cert.NotBefore, cert.NotAfter, err = ParseCertValidity(validity); err != nil {
+			cert.Error = err.Error()
+		} else {
+			cert.Expiring = cert.NotAfter.Sub(now) < window
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+// tlsListener listener terminating tls, e.g. amqp/ssl, https or mqtt/ssl
+func tlsListener(protocol string) bool {
+	return strings.HasSuffix(protocol, "/ssl") || protocol == "https" || strings.HasPrefix(protocol, "https/")
+}
+
+// ProbeListenerCerts connect to the tls listeners of the overview and read
+// their certificates. host replaces wildcard listener addresses.
+func ProbeListenerCerts(overview rabtap.RabbitOverview, host string, now time.Time, window time.Duration) []CertInfo {
+	certs := []CertInfo{}
+	for _, listener := range overview.Listeners {
+		if !tlsListener(listener.Protocol) {
+			continue
+		}
+		target := listenerAddress(listener.IPAddress, listener.Port, host)
+		cert := CertInfo{Source: "listener", Name: fmt.Sprintf("%s %s %s", listener.Node, listener.Protocol, target)}
+		dialer := &net.Dialer{Timeout: 5 * time.Second}
+		// only inspecting, the chain is not verified
+		conn, err := tls.DialWithDialer(dialer, "tcp", target, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			cert.Error = err.Error()
+			certs = append(certs, cert)
+			continue
+		}
+		if peers := conn.ConnectionState().PeerCertificates; len(peers) > 0 {
+			leaf := peers[0]
+			cert.Subject = leaf.Subject.String()
+			cert.Issuer = leaf.Issuer.String()
+			cert.NotBefore = leaf.NotBefore
+			cert.NotAfter = leaf.NotAfter
+			cert.Expiring = leaf.NotAfter.Sub(now) < window
+		}
+		conn.Close()
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+// CertList : certificates ordered by expiry
+type CertList []CertInfo
+
+// Table certificates as table
+func (list CertList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"SOURCE", "NAME", "SUBJECT", "NOT AFTER", "EXPIRES IN"}}
+	now := time.Now()
+	for _, cert := range list {
+		color, expires, notAfter := Green, "", ""
+		switch {
+		case cert.Error != "":
+			color, expires = Red, cert.Error
+		case cert.NotAfter.Before(now):
+			color, expires, notAfter = Red, "expired", cert.NotAfter.Format(time.RFC3339)
+		default:
+			expires, notAfter = fmt.Sprintf("%dd", int(cert.NotAfter.Sub(now).Hours()/24)), cert.NotAfter.Format(time.RFC3339)
+			if cert.Expiring {
+				color = Yellow
+			}
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: cert.Source},
+			{Text: cert.Name},
+			{Text: orDash(cert.Subject)},
+			{Text: orDash(notAfter)},
+			{Text: expires, Color: color},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("certs", "[--within d] [--probe] certificates of tls connections and listeners", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("certs")
+		within := flags.Duration("within", defaultExpiryWindow, "report certificates expiring within")
+		probe := flags.Bool("probe", false, "connect to the tls listeners and inspect their certificates")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		certs := ConnectionCerts(rabbitmq.info().Connections, now, *within)
+		if *probe {
+			certs = append(certs, ProbeListenerCerts(rabbitmq.info().Overview, rabbitmq.currentTarget().Host, now, *within)...)
+		}
+		sort.SliceStable(certs, func(i, j int) bool { return certs[i].NotAfter.Before(certs[j].NotAfter) })
+		expiring := 0
+		for _, cert := range certs {
+			if cert.Expiring {
+				expiring++
+			}
+		}
+		if expiring > 0 {
+			return CertList(certs), thresholdError("%d certificates expire within %s", expiring, *within)
+		}
+		return CertList(certs), nil
+	})
+}
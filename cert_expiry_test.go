@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCertValidity(t *testing.T) {
+	notBefore, notAfter, err := ParseCertValidity("2019-06-12T13:00:00Z - 2029-06-09T13:00:00Z")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2019, 6, 12, 13, 0, 0, 0, time.UTC), notBefore)
+	assert.Equal(t, time.Date(2029, 6, 9, 13, 0, 0, 0, time.UTC), notAfter)
+
+	_, _, err = ParseCertValidity("forever")
+	assert.NotNil(t, err)
+}
+
+func TestConnectionCerts(t *testing.T) {
+	var conns []rabtap.RabbitConnection
+	json.Unmarshal([]byte(`[
+		{"name": "plain", "ssl": false, "peer_cert_validity": null},
+		{"name": "soon", "ssl": true, "peer_cert_subject": "CN=app", "peer_cert_issuer": "CN=ca",
+		 "peer_cert_validity": "2020-01-01T00:00:00Z - 2020-05-01T00:00:00Z"},
+		{"name": "later", "ssl": true, "peer_cert_validity": "2020-01-01T00:00:00Z - 2021-01-01T00:00:00Z"}]`), &conns)
+	now := time.Date(2020, 4, 15, 0, 0, 0, 0, time.UTC)
+
+	certs := ConnectionCerts(conns, now, defaultExpiryWindow)
+	assert.Len(t, certs, 2)
+	assert.Equal(t, "soon", certs[0].Name)
+	assert.Equal(t, "CN=app", certs[0].Subject)
+	assert.True(t, certs[0].Expiring)
+	assert.False(t, certs[1].Expiring)
+}
+
+func TestTLSListener(t *testing.T) {
+	assert.True(t, tlsListener("amqp/ssl"))
+	assert.True(t, tlsListener("https"))
+	assert.False(t, tlsListener("amqp"))
+	assert.False(t, tlsListener("http"))
+}
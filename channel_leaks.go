@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaults of the channel leak detector
+const (
+	defaultLeakSamples     = 10
+	defaultLeakGrowth      = 20
+	defaultLeakMaxChannels = 1000
+)
+
+// kinds of channel alerts
+const (
+	LeakGrowing      = "growing"
+	LeakTooManyChans = "too_many_channels"
+)
+
+// ChannelLeakOptions : when a connection's channels count as leaking
+type ChannelLeakOptions struct {
+	// Samples channel counts kept per connection, growth is judged over them
+	Samples int
+	// MinGrowth channels a connection must gain over the samples
+	MinGrowth int
+	// MaxChannels channels of a single connection alerting right away
+	MaxChannels int
+}
+
+// ChannelAlert : a connection whose channels grow without ever dropping,
+// or that holds too many of them
+type ChannelAlert struct {
+	Kind       string    `json:"kind"`
+	Connection string    `json:"connection"`
+	Name       string    `json:"name,omitempty"`
+	User       string    `json:"user"`
+	Vhost      string    `json:"vhost"`
+	PeerHost   string    `json:"peerHost"`
+	Product    string    `json:"product"`
+	Version    string    `json:"version"`
+	Channels   int       `json:"channels"`
+	Growth     int       `json:"growth"`
+	Time       time.Time `json:"time"`
+}
+
+// String one line summary of the alert
+func (alert ChannelAlert) String() string {
+	return fmt.Sprintf("%s %s connection=%q user=%s client=%s/%s channels=%d growth=%d",
+		alert.Time.Format(time.RFC3339), alert.Kind, alert.Connection, alert.User,
+		orDash(alert.Product), orDash(alert.Version), alert.Channels, alert.Growth)
+}
+
+// ChannelLeakDetector keep the recent channel counts of every connection
+type ChannelLeakDetector struct {
+	opts    ChannelLeakOptions
+	counts  map[string][]int
+	alerted map[string]bool
+	latest  map[string]ChannelAlert
+}
+
+// NewChannelLeakDetector create a detector, unset options get defaults
+func NewChannelLeakDetector(opts ChannelLeakOptions) *ChannelLeakDetector {
+	if opts.Samples < 2 {
+		opts.Samples = defaultLeakSamples
+	}
+	if opts.MinGrowth <= 0 {
+		opts.MinGrowth = defaultLeakGrowth
+	}
+	if opts.MaxChannels <= 0 {
+		opts.MaxChannels = defaultLeakMaxChannels
+	}
+	return &ChannelLeakDetector{opts: opts, counts: map[string][]int{}, alerted: map[string]bool{}, latest: map[string]ChannelAlert{}}
+}
+
+// monotonicGrowth channels gained over counts, 0 when they ever dropped
+func monotonicGrowth(counts []int) int {
+	for i := 1; i < len(counts); i++ {
+		if counts[i] < counts[i-1] {
+			return 0
+		}
+	}
+	return counts[len(counts)-1] - counts[0]
+}
+
+// Observe record the channel counts of the connections and return the
+// alerts that started firing. An alert fires again only after it cleared.
+// Connections that are gone are forgotten.
+func (detector *ChannelLeakDetector) Observe(connections []rabtap.RabbitConnection, at time.Time) []ChannelAlert {
+	var alerts []ChannelAlert
+	seen := map[string]bool{}
+	for _, conn := range connections {
+		seen[conn.Name] = true
+		counts := append(detector.counts[conn.Name], conn.Channels)
+		if len(counts) > detector.opts.Samples {
+			counts = counts[len(counts)-detector.opts.Samples:]
+		}
+		detector.counts[conn.Name] = counts
+		alert := ChannelAlert{
+			Connection: conn.Name, Name: conn.ClientProperties.ConnectionName, User: conn.User,
+			Vhost: conn.Vhost, PeerHost: conn.PeerHost, Product: conn.ClientProperties.Product,
+			Version: conn.ClientProperties.Version, Channels: conn.Channels, Time: at,
+		}
+		if len(counts) == detector.opts.Samples {
+			alert.Growth = monotonicGrowth(counts)
+		}
+		detector.latest[conn.Name] = alert
+		for kind, firing := range map[string]bool{
+			LeakGrowing:      alert.Growth >= detector.opts.MinGrowth,
+			LeakTooManyChans: conn.Channels >= detector.opts.MaxChannels,
+		} {
+			key := kind + "\x00" + conn.Name
+			if firing && !detector.alerted[key] {
+				alert.Kind = kind
+				alerts = append(alerts, alert)
+			}
+			detector.alerted[key] = firing
+		}
+	}
+	for name := range detector.counts {
+		if !seen[name] {
+			delete(detector.counts, name)
+			delete(detector.latest, name)
+			delete(detector.alerted, LeakGrowing+"\x00"+name)
+			delete(detector.alerted, LeakTooManyChans+"\x00"+name)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Connection != alerts[j].Connection {
+			return alerts[i].Connection < alerts[j].Connection
+		}
+		return alerts[i].Kind < alerts[j].Kind
+	})
+	return alerts
+}
+
+// ChannelReport : connections with most channels at the last sample
+type ChannelReport []ChannelAlert
+
+// Report the top connections by channels, with their growth
+func (detector *ChannelLeakDetector) Report(top int) ChannelReport {
+	report := ChannelReport{}
+	for _, alert := range detector.latest {
+		alert.Kind = ""
+		if alert.Growth >= detector.opts.MinGrowth {
+			alert.Kind = LeakGrowing
+		}
+		if alert.Channels >= detector.opts.MaxChannels {
+			alert.Kind = LeakTooManyChans
+		}
+		report = append(report, alert)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Channels != report[j].Channels {
+			return report[i].Channels > report[j].Channels
+		}
+		return report[i].Connection < report[j].Connection
+	})
+	if top > 0 && len(report) > top {
+		report = report[:top]
+	}
+	return report
+}
+
+// Table connections as table
+func (report ChannelReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"CONNECTION", "USER", "CLIENT", "CHANNELS", "GROWTH", "ALERT"}}
+	for _, alert := range report {
+		color := None
+		if alert.Kind != "" {
+			color = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: alert.Connection},
+			{Text: alert.User},
+			{Text: orDash(alert.Product) + " " + orDash(alert.Version)},
+			{Text: format.Count(int64(alert.Channels)), Color: color},
+			{Text: format.Count(int64(alert.Growth))},
+			{Text: orDash(alert.Kind), Color: color},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("channel-leaks", "[--interval d] [--samples n] [--min-growth n] [--max-channels n] [--count n] [--top n] watch channel counts per connection for leaks", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("channel-leaks")
+		interval := flags.Duration("interval", 30*time.Second, "time between two samples")
+		opts := ChannelLeakOptions{}
+		flags.IntVar(&opts.Samples, "samples", defaultLeakSamples, "samples growth is judged over")
+		flags.IntVar(&opts.MinGrowth, "min-growth", defaultLeakGrowth, "channels gained without dropping making a leak")
+		flags.IntVar(&opts.MaxChannels, "max-channels", defaultLeakMaxChannels, "channels of one connection alerting right away")
+		count := flags.Int("count", 0, "samples to take, 0 runs until interrupted")
+		top := flags.Int("top", 20, "connections listed in the final report")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if *interval <= 0 {
+			return nil, usageError("channel-leaks: --interval must be positive")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		detector := NewChannelLeakDetector(opts)
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for i := 1; ; i++ {
+			connections, err := rabbitmq.fetcher().Connections(ctx)
+			if err != nil {
+				return detector.Report(*top), fmt.Errorf("sampling connections: %s", err)
+			}
+			for _, alert := range detector.Observe(connections, time.Now()) {
+				if !cli.json {
+					fmt.Fprintln(cli.out, alert.String())
+				}
+			}
+			if *count > 0 && i >= *count {
+				return detector.Report(*top), nil
+			}
+			select {
+			case <-ctx.Done():
+				return detector.Report(*top), nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelLeakDetector(t *testing.T) {
+	detector := NewChannelLeakDetector(ChannelLeakOptions{Samples: 3, MinGrowth: 10, MaxChannels: 500})
+	conn := func(name string, channels int) rabtap.RabbitConnection {
+		c := rabtap.RabbitConnection{Name: name, User: "app", Channels: channels}
+		c.ClientProperties.Product, c.ClientProperties.Version = "RabbitMQ .NET Client", "6.2.1"
+		return c
+	}
+	now := time.Now()
+	assert.Empty(t, detector.Observe([]rabtap.RabbitConnection{conn("leaky", 1), conn("steady", 5)}, now))
+	assert.Empty(t, detector.Observe([]rabtap.RabbitConnection{conn("leaky", 6), conn("steady", 3)}, now))
+	alerts := detector.Observe([]rabtap.RabbitConnection{conn("leaky", 12), conn("steady", 15), conn("huge", 800)}, now)
+	assert.Len(t, alerts, 2)
+	assert.Equal(t, "huge", alerts[0].Connection)
+	assert.Equal(t, LeakTooManyChans, alerts[0].Kind)
+	assert.Equal(t, "leaky", alerts[1].Connection)
+	assert.Equal(t, LeakGrowing, alerts[1].Kind)
+	assert.Equal(t, 11, alerts[1].Growth)
+	assert.Equal(t, "6.2.1", alerts[1].Version)
+
+	// still firing, not reported again
+	assert.Empty(t, detector.Observe([]rabtap.RabbitConnection{conn("leaky", 20), conn("huge", 800)}, now))
+	report := detector.Report(1)
+	assert.Len(t, report, 1)
+	assert.Equal(t, "huge", report[0].Connection)
+	assert.Len(t, detector.Report(0), 2)
+}
+
+func TestMonotonicGrowth(t *testing.T) {
+	assert.Equal(t, 4, monotonicGrowth([]int{1, 1, 5}))
+	assert.Equal(t, 0, monotonicGrowth([]int{1, 9, 5}))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// ChaosOptions : which connections chaos mode closes and how often
+type ChaosOptions struct {
+	Interval time.Duration
+	Rounds   int
+	Percent  float64
+	User     string
+	Vhost    string
+	Product  string
+	Seed     int64
+	DryRun   bool
+	Reason   string
+}
+
+// ChaosAction : a connection closed by chaos mode
+type ChaosAction struct {
+	Time       time.Time `json:"time"`
+	Round      int       `json:"round"`
+	Connection string    `json:"connection"`
+	User       string    `json:"user"`
+	Vhost      string    `json:"vhost"`
+	Product    string    `json:"product"`
+	DryRun     bool      `json:"dryRun"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// String one line of the action log
+func (action ChaosAction) String() string {
+	verb := "closed"
+	if action.DryRun {
+		verb = "would close"
+	}
+	line := fmt.Sprintf("%s round=%d %s %q user=%s vhost=%s product=%q", action.Time.Format(time.RFC3339),
+		action.Round, verb, action.Connection, action.User, action.Vhost, action.Product)
+	if action.Error != "" {
+		line += " error=" + action.Error
+	}
+	return line
+}
+
+// chaosCandidate connection matches the filters of opts, the connections of
+// radish itself are never closed
+func chaosCandidate(conn rabtap.RabbitConnection, opts ChaosOptions) bool {
+	return conn.ClientProperties.ConnectionName != radishConnectionName &&
+		(opts.User == "" || conn.User == opts.User) &&
+		(opts.Vhost == "" || conn.Vhost == opts.Vhost) &&
+		(opts.Product == "" || strings.Contains(strings.ToLower(conn.ClientProperties.Product), strings.ToLower(opts.Product)))
+}
+
+// SelectVictims pick Percent of the matching connections at random, at least
+// one when any match. Candidates are sorted by name so that a seed picks the
+// same connections whatever order the broker lists them in.
+func SelectVictims(conns []rabtap.RabbitConnection, opts ChaosOptions, rng *rand.Rand) []rabtap.RabbitConnection {
+	var candidates []rabtap.RabbitConnection
+	for _, conn := range conns {
+		if chaosCandidate(conn, opts) {
+			candidates = append(candidates, conn)
+		}
+	}
+	if len(candidates) == 0 || opts.Percent <= 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Name < candidates[j].Name })
+	n := int(math.Ceil(float64(len(candidates)) * math.Min(opts.Percent, 100) / 100))
+	victims := make([]rabtap.RabbitConnection, 0, n)
+	for _, i := range rng.Perm(len(candidates))[:n] {
+		victims = append(victims, candidates[i])
+	}
+	return victims
+}
+
+// RunChaos close random connections every interval until ctx is done or
+// all rounds ran. Every action is passed to record.
+func RunChaos(ctx context.Context, opts ChaosOptions, list func(ctx context.Context) ([]rabtap.RabbitConnection, error),
+	closeConn func(name string, reason string) error, record func(ChaosAction)) error {
+	rng := rand.New(rand.NewSource(opts.Seed))
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for round := 1; opts.Rounds <= 0 || round <= opts.Rounds; round++ {
+		conns, err := list(ctx)
+		if err != nil {
+			return err
+		}
+		for _, conn := range SelectVictims(conns, opts, rng) {
+			action := ChaosAction{
+				Time: time.Now(), Round: round, Connection: conn.Name, User: conn.User,
+				Vhost: conn.Vhost, Product: conn.ClientProperties.Product, DryRun: opts.DryRun,
+			}
+			if !opts.DryRun {
+				if err := closeConn(conn.Name, opts.Reason); err != nil {
+					action.Error = err.Error()
+				}
+			}
+			record(action)
+		}
+		if opts.Rounds > 0 && round == opts.Rounds {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// ChaosLog : actions of a chaos run
+type ChaosLog []ChaosAction
+
+// Table actions as table
+func (actions ChaosLog) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"ROUND", "CONNECTION", "USER", "VHOST", "PRODUCT", "RESULT"}}
+	for _, action := range actions {
+		result, color := "closed", Yellow
+		switch {
+		case action.Error != "":
+			result, color = action.Error, Red
+		case action.DryRun:
+			result, color = "dry run", None
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: fmt.Sprint(action.Round)},
+			{Text: action.Connection},
+			{Text: action.User},
+			{Text: action.Vhost},
+			{Text: orDash(action.Product)},
+			{Text: result, Color: color},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("chaos", "[--percent p] [--interval d] [--rounds n] [--user u] [--vhost v] [--product p] [--seed s] [--dry-run] close random connections", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("chaos")
+		var opts ChaosOptions
+		flags.Float64Var(&opts.Percent, "percent", 10, "share of the matching connections closed per round")
+		flags.DurationVar(&opts.Interval, "interval", time.Minute, "time between two rounds")
+		flags.IntVar(&opts.Rounds, "rounds", 1, "rounds to run, 0 runs until interrupted")
+		flags.StringVar(&opts.User, "user", "", "only connections of this user")
+		flags.StringVar(&opts.Vhost, "vhost", "", "only connections to this vhost")
+		flags.StringVar(&opts.Product, "product", "", "only connections whose client product contains this")
+		flags.Int64Var(&opts.Seed, "seed", time.Now().UnixNano(), "random seed, repeat a run with the same seed")
+		flags.BoolVar(&opts.DryRun, "dry-run", false, "only log which connections would be closed")
+		flags.StringVar(&opts.Reason, "reason", "radish chaos test", "close reason shown to clients")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		opts.Vhost = NormalizeVhost(opts.Vhost)
+		if opts.Percent <= 0 || opts.Percent > 100 {
+			return nil, usageError("chaos: --percent must be in (0, 100]")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		subsystemLog("chaos").Infof("seed %d", opts.Seed)
+		ctx, stop := signalContext(context.Background())
+		defer stop()
+		actions := ChaosLog{}
+		err = RunChaos(ctx, opts, rabbitmq.fetcher().Connections, rabbitmq.management().CloseConnection, func(action ChaosAction) {
+			actions = append(actions, action)
+			if !cli.json {
+				fmt.Fprintln(cli.out, action.String())
+			}
+		})
+		return actions, err
+	})
+}
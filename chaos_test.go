@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func chaosConns() []rabtap.RabbitConnection {
+	var conns []rabtap.RabbitConnection
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		conns = append(conns, rabtap.RabbitConnection{Name: name, User: "app", Vhost: "/"})
+	}
+	conns = append(conns, rabtap.RabbitConnection{Name: "admin", User: "admin", Vhost: "/"})
+	return conns
+}
+
+func TestSelectVictims(t *testing.T) {
+	opts := ChaosOptions{Percent: 50, User: "app"}
+	victims := SelectVictims(chaosConns(), opts, rand.New(rand.NewSource(1)))
+	assert.Len(t, victims, 3)
+	for _, victim := range victims {
+		assert.Equal(t, "app", victim.User)
+	}
+	// same seed, same victims
+	again := SelectVictims(chaosConns(), opts, rand.New(rand.NewSource(1)))
+	assert.Equal(t, victims, again)
+	// and whatever order the broker lists the connections in
+	reversed := chaosConns()
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	assert.Equal(t, victims, SelectVictims(reversed, opts, rand.New(rand.NewSource(1))))
+
+	own := rabtap.RabbitConnection{Name: "radish", User: "app", Vhost: "/"}
+	own.ClientProperties.ConnectionName = radishConnectionName
+	assert.Empty(t, SelectVictims([]rabtap.RabbitConnection{own}, ChaosOptions{Percent: 100}, rand.New(rand.NewSource(1))))
+
+	assert.Len(t, SelectVictims(chaosConns(), ChaosOptions{Percent: 1}, rand.New(rand.NewSource(1))), 1)
+	assert.Nil(t, SelectVictims(chaosConns(), ChaosOptions{Percent: 50, Vhost: "other"}, rand.New(rand.NewSource(1))))
+}
+
+func TestRunChaos(t *testing.T) {
+	var closed []string
+	var actions []ChaosAction
+	opts := ChaosOptions{Percent: 100, User: "admin", Rounds: 2, Interval: time.Millisecond, Reason: "test"}
+	err := RunChaos(context.Background(), opts, func(ctx context.Context) ([]rabtap.RabbitConnection, error) {
+		return chaosConns(), nil
+	}, func(name string, reason string) error {
+		closed = append(closed, name+":"+reason)
+		return errors.New("gone")
+	}, func(action ChaosAction) {
+		actions = append(actions, action)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin:test", "admin:test"}, closed)
+	assert.Equal(t, 2, actions[1].Round)
+	assert.Equal(t, "gone", actions[0].Error)
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exit codes of the command line mode, stable for use in scripts
+const (
+	ExitOK             = 0
+	ExitUsage          = 1
+	ExitConnection     = 2
+	ExitPartialFailure = 3
+	ExitThreshold      = 4
+)
+
+// CLIError : error carrying the exit code it maps to
+type CLIError struct {
+	Code int
+	Err  error
+}
+
+func (e *CLIError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap the error behind the exit code
+func (e *CLIError) Unwrap() error {
+	return e.Err
+}
+
+func usageError(format string, args ...interface{}) error {
+	return &CLIError{Code: ExitUsage, Err: fmt.Errorf(format, args...)}
+}
+
+func connectionError(err error) error {
+	return &CLIError{Code: ExitConnection, Err: err}
+}
+
+func thresholdError(format string, args ...interface{}) error {
+	return &CLIError{Code: ExitThreshold, Err: fmt.Errorf(format, args...)}
+}
+
+// exitCode map an error returned by a command to the exit code. Errors
+// without a code, like broker, http and network failures, are runtime
+// failures and not usage errors.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var cliErr *CLIError
+	if errors.As(err, &cliErr) {
+		return cliErr.Code
+	}
+	return ExitConnection
+}
+
+// bulkResult turn failures of a bulk run into a partial failure
+func bulkResult(summary BulkSummary, err error) (interface{}, error) {
+	if err != nil {
+		return summary, err
+	}
+	if len(summary.Failures) > 0 {
+		return summary, &CLIError{
+			Code: ExitPartialFailure,
+			Err:  fmt.Errorf("%d of %d operations failed", len(summary.Failures), summary.Total),
+		}
+	}
+	return summary, nil
+}
+
+// CLIResult : json envelope printed for every command with --json
+type CLIResult struct {
+	OK       bool        `json:"ok"`
+	Command  string      `json:"command"`
+	ExitCode int         `json:"exitCode"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// CLI : state of a command line invocation
+type CLI struct {
+	login           RabbitmqLoginDetails
+	logging         LogOptions
+	shutdownTimeout time.Duration
+	json            bool
+	csv             bool
+	markdown        bool
+	html            bool
+	table           TableOptions
+	format          NumberFormat
+	noColor         bool
+	out             io.Writer
+	in              io.Reader
+	prompts         io.Writer
+	rabbitmq        *Rabbitmq
+	// profile of the profiles file the login details come from, baseLogin
+	// the login details of the flags before it was applied
+	profile      string
+	profilesFile string
+	baseLogin    RabbitmqLoginDetails
+	// allProfiles run the command against every profile, see runAllProfiles
+	allProfiles bool
+	// plugins loaded from pluginsFile
+	pluginsFile string
+	plugins     PluginConfig
+	// record the management api responses to this bundle, replay commands
+	// against one instead of a broker, as of replayAt when set
+	record   string
+	replay   string
+	replayAt string
+	// redaction of recordings and exported snapshots
+	redact     string
+	redactSalt string
+	redaction  Redaction
+}
+
+// connect connect to the broker on first use
+func (cli *CLI) connect() (*Rabbitmq, error) {
+	if cli.rabbitmq != nil {
+		return cli.rabbitmq, nil
+	}
+	rabbitmq := NewRabbitmq()
+	if cli.replay != "" {
+		if err := cli.replayRecording(rabbitmq); err != nil {
+			return nil, err
+		}
+		cli.rabbitmq = rabbitmq
+		return rabbitmq, nil
+	}
+	if cli.record != "" {
+		recorder, err := NewRecorder(cli.record)
+		if err != nil {
+			return nil, usageError("record: %s", err)
+		}
+		recorder.redaction = cli.redaction
+		rabbitmq.recorder = recorder
+		onShutdown("record", func(ctx context.Context) error {
+			subsystemLog("record").Infof("recorded %d responses to %s", recorder.Count(), cli.record)
+			return recorder.Close()
+		})
+	}
+	if err := rabbitmq.Connect(cli.login); err != nil {
+		return nil, connectionError(err)
+	}
+	cli.rabbitmq = rabbitmq
+	onShutdown("rabbitmq", func(ctx context.Context) error {
+		return rabbitmq.Close()
+	})
+	return rabbitmq, nil
+}
+
+// replayRecording answer the requests of rabbitmq from the --replay bundle
+func (cli *CLI) replayRecording(rabbitmq *Rabbitmq) error {
+	recording, err := LoadRecording(cli.replay)
+	if err != nil {
+		return usageError("replay: %s", err)
+	}
+	if cli.replayAt != "" {
+		if recording.At, err = time.Parse(time.RFC3339, cli.replayAt); err != nil {
+			return usageError("replay-at: expected an RFC3339 time: %s", err)
+		}
+	}
+	if err := rabbitmq.Replay(recording, cli.login); err != nil {
+		return connectionError(err)
+	}
+	return nil
+}
+
+// daemonContext context of a long running command, cancelled by SIGINT or
+// SIGTERM. The returned function runs the shutdown hooks.
+func (cli *CLI) daemonContext() (context.Context, func()) {
+	ctx, cancel := signalContext(context.Background())
+	return ctx, func() {
+		cancel()
+		runShutdownHooks(cli.shutdownTimeout)
+	}
+}
+
+// cliCommand : a command of the command line mode
+type cliCommand struct {
+	usage string
+	run   func(cli *CLI, args []string) (interface{}, error)
+}
+
+var cliCommands = map[string]cliCommand{}
+
+// registerCommand add a command to the command line mode
+func registerCommand(name string, usage string, run func(cli *CLI, args []string) (interface{}, error)) {
+	cliCommands[name] = cliCommand{usage: usage, run: run}
+}
+
+// newFlagSet create a flag set for a command, parse errors are reported as
+// usage errors by parseFlags
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	return flags
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return usageError("%s: %s", flags.Name(), err)
+	}
+	return nil
+}
+
+func envOr(name string, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func cliUsage() string {
+	names := []string{}
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{"usage: radish [--host h] [--port p] [--user u] [--password p] [--json] [--csv] [--markdown] [--html] [--verbose] [--no-color] [--wide] [--raw] <command> [args]", "", "commands:"}
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("  %-20s %s", name, cliCommands[name].usage))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// printResult print the command result, as json envelope or indented json
+func (cli *CLI) printResult(command string, result interface{}, err error) {
+	code := exitCode(err)
+	if cli.json {
+		envelope := CLIResult{OK: err == nil, Command: command, ExitCode: code, Result: result}
+		if err != nil {
+			envelope.Error = err.Error()
+		}
+		data, _ := json.MarshalIndent(envelope, "", "  ")
+		fmt.Fprintln(cli.out, string(data))
+		return
+	}
+	fanout, isFanout := result.(FanoutResult)
+	if (cli.markdown || cli.html) && result != nil {
+		sections := []ReportSection{{Title: command, Result: result}}
+		if isFanout {
+			sections = fanout.Sections()
+		}
+		cli.printDocument(command, sections)
+	} else if tabular, ok := result.(Tabular); ok && cli.csv {
+		tabular.Table(NumberFormat{Raw: true}).WriteCSV(cli.out)
+	} else if isFanout {
+		for _, section := range fanout.Sections() {
+			fmt.Fprintf(cli.out, "== %s ==\n", section.Title)
+			cli.printValue(section.Result)
+			fmt.Fprintln(cli.out)
+		}
+	} else {
+		cli.printValue(result)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	}
+}
+
+// printValue print a result as table, or indented json when it is none
+func (cli *CLI) printValue(result interface{}) {
+	if tabular, ok := result.(Tabular); ok {
+		opts := cli.table
+		opts.Color = colorEnabled(cli.out, cli.noColor)
+		if opts.Width == 0 {
+			opts.Width = outputWidth(cli.out)
+		}
+		tabular.Table(cli.format).Render(cli.out, opts)
+	} else if result != nil {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintln(cli.out, string(data))
+	}
+}
+
+// printDocument print the sections as standalone markdown or html document
+func (cli *CLI) printDocument(command string, sections []ReportSection) {
+	report := Report{Title: "radish " + command, Generated: time.Now(), Sections: sections}
+	if cli.rabbitmq != nil {
+		report.Cluster = cli.rabbitmq.info().Overview.ClusterName
+	}
+	format := ReportMarkdown
+	if cli.html {
+		format = ReportHTML
+	}
+	content, _ := report.Render(format, cli.format)
+	cli.out.Write(content)
+}
+
+// confirm ask a yes/no question on the terminal, anything but y or yes is no.
+// The question goes to prompts, stderr, so it never ends up in --json output.
+func (cli *CLI) confirm(question string) bool {
+	fmt.Fprintf(cli.prompts, "%s [y/N] ", question)
+	var answer string
+	fmt.Fscanln(cli.in, &answer)
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// globalFlags the flags before the command, bound to the fields of cli
+func (cli *CLI) globalFlags() *flag.FlagSet {
+	global := newFlagSet("radish")
+	global.StringVar(&cli.login.Host, "host", envOr("RADISH_HOST", "127.0.0.1"), "broker host")
+	global.StringVar(&cli.login.Port, "port", envOr("RADISH_PORT", ""), "amqp port, 5672 or 5671 with tls by default")
+	global.StringVar(&cli.login.Username, "user", envOr("RADISH_USER", "guest"), "user name")
+	global.StringVar(&cli.login.Password, "password", envOr("RADISH_PASSWORD", "guest"), "password")
+	global.StringVar(&cli.login.Discovery, "discovery", "", "resolve host via srv or consul")
+	global.StringVar(&cli.login.ConsulAddr, "consul", "127.0.0.1:8500", "consul address")
+	global.BoolVar(&cli.login.TLS, "tls", false, "use amqps and https")
+	global.StringVar(&cli.login.CACert, "cacert", envOr("RADISH_CACERT", ""), "ca bundle to verify the broker with")
+	global.StringVar(&cli.login.ClientCert, "cert", envOr("RADISH_CERT", ""), "client certificate, enables tls")
+	global.StringVar(&cli.login.ClientKey, "key", envOr("RADISH_KEY", ""), "client certificate key")
+	global.BoolVar(&cli.login.TLSSkipVerify, "insecure", false, "do not verify the broker certificate")
+	global.StringVar(&cli.login.AuthMechanism, "auth-mechanism", "PLAIN", "amqp auth mechanism: PLAIN or EXTERNAL")
+	global.StringVar(&cli.login.ManagementURL, "management-url", envOr("RADISH_MANAGEMENT_URL", ""), "management api url, the amqp endpoint is discovered from it")
+	global.StringVar(&cli.login.Scope, "scope", envOr("RADISH_SCOPE", ""), "only list and write objects with these name prefixes, like team-a.*")
+	global.StringVar(&cli.login.DefaultVhost, "default-vhost", envOr("RADISH_VHOST", ""), "vhost of commands run without --vhost, / by default")
+	global.BoolVar(&cli.login.ReadOnly, "read-only", envOr("RADISH_READ_ONLY", "") == "true", "refuse every operation modifying the broker")
+	global.StringVar(&cli.profile, "profile", envOr("RADISH_PROFILE", ""), "connect with this broker profile of the profiles file")
+	global.BoolVar(&cli.allProfiles, "all-profiles", false, "run a read only command against every profile of the profiles file")
+	global.StringVar(&cli.profilesFile, "profiles", envOr("RADISH_PROFILES", defaultProfilesFile), "broker profiles yaml file")
+	global.StringVar(&cli.pluginsFile, "plugins", envOr("RADISH_PLUGINS", ""), "load the exec plugins of this yaml file")
+	global.StringVar(&cli.record, "record", envOr("RADISH_RECORD", ""), "save the management api responses with their time to this bundle")
+	global.StringVar(&cli.replay, "replay", envOr("RADISH_REPLAY", ""), "run against a bundle of --record instead of a broker")
+	global.StringVar(&cli.replayAt, "replay-at", "", "replay the bundle as of this RFC3339 time instead of its latest responses")
+	global.StringVar(&cli.redact, "redact", envOr("RADISH_REDACT", ""), "redact recordings and exported snapshots: names, users, payloads, ips or all")
+	global.StringVar(&cli.redactSalt, "redact-salt", envOr("RADISH_REDACT_SALT", ""), "salt of the redacted name and ip hashes, random by default")
+	global.BoolVar(&cli.json, "json", false, "print results as json envelope")
+	global.BoolVar(&cli.csv, "csv", false, "print tables as csv, implies --raw")
+	global.BoolVar(&cli.markdown, "markdown", false, "print results as markdown document with tables and charts")
+	global.BoolVar(&cli.html, "html", false, "print results as standalone html document with tables and charts")
+	global.BoolVar(&cli.noColor, "no-color", false, "disable colored output")
+	global.BoolVar(&cli.table.Wide, "wide", false, "never truncate table columns")
+	global.BoolVar(&cli.format.Raw, "raw", false, "show exact numbers instead of humanized ones")
+	global.IntVar(&cli.table.Width, "width", 0, "table width, defaults to the terminal width")
+	global.StringVar(&cli.table.Ellipsis, "ellipsis", "…", "marker of truncated values")
+	global.BoolVar(&cli.table.TruncateMiddle, "truncate-middle", false, "truncate values in the middle")
+	global.StringVar(&cli.logging.Level, "log-level", "warn", "log level: debug, info, warn or error")
+	global.StringVar(&cli.logging.Format, "log-format", "text", "log format: text or json")
+	global.DurationVar(&cli.shutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "time daemon modes get to finish after a signal")
+	global.BoolVar(&cli.logging.Verbose, "verbose", false, "debug logs including api requests and timings")
+	return global
+}
+
+// RunCLI run radish as a command line tool, returns the exit code
+func RunCLI(args []string) int {
+	cli := &CLI{out: os.Stdout, in: os.Stdin, prompts: os.Stderr}
+	global := cli.globalFlags()
+	if err := parseFlags(global, args); err != nil {
+		cli.printResult("", nil, err)
+		return exitCode(err)
+	}
+	if err := ConfigureLogging(cli.logging); err != nil {
+		err = usageError("%s", err)
+		cli.printResult("", nil, err)
+		return exitCode(err)
+	}
+	if err := cli.useProfile(); err != nil {
+		err = usageError("%s", err)
+		cli.printResult("", nil, err)
+		return exitCode(err)
+	}
+	if cli.record != "" && cli.replay != "" {
+		err := usageError("--record and --replay are exclusive")
+		cli.printResult("", nil, err)
+		return exitCode(err)
+	}
+	redaction, err := ParseRedaction(cli.redact, cli.redactSalt)
+	if err != nil {
+		err = usageError("redact: %s", err)
+		cli.printResult("", nil, err)
+		return exitCode(err)
+	}
+	cli.redaction = redaction
+	if cli.pluginsFile != "" {
+		plugins, err := LoadPlugins(cli.pluginsFile)
+		if err != nil {
+			err = usageError("plugins: %s", err)
+			cli.printResult("", nil, err)
+			return exitCode(err)
+		}
+		cli.plugins = plugins
+	}
+	if global.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, cliUsage())
+		return ExitUsage
+	}
+
+	name := global.Arg(0)
+	command, ok := cliCommands[name]
+	if !ok {
+		err := usageError("unknown command %s", name)
+		cli.printResult(name, nil, err)
+		fmt.Fprintln(os.Stderr, cliUsage())
+		return ExitUsage
+	}
+	var result interface{}
+	if cli.allProfiles {
+		result, err = cli.runAllProfiles(name, command, global.Args()[1:])
+	} else {
+		result, err = command.run(cli, global.Args()[1:])
+	}
+	cli.printResult(name, result, err)
+	runShutdownHooks(cli.shutdownTimeout)
+	return exitCode(err)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+func init() {
+	registerCommand("info", "[--node n] show broker overview and object lists", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("info")
+		node := flags.String("node", "", "only queues, connections and consumers on this node")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return FilterBrokerInfoByNode(rabbitmq.info(), *node), nil
+	})
+
+	registerCommand("connection", "<name> show channels, consumers and queues of a connection", func(cli *CLI, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, usageError("connection: expected connection name")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return rabbitmq.ConnectionDetails(args[0])
+	})
+
+	registerCommand("queue-consumers", "[--vhost v] <queue> show who consumes from a queue", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("queue-consumers")
+		vhost := flags.String("vhost", "", "vhost of the queue, the default vhost when omitted")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = cli.vhost(*vhost)
+		if flags.NArg() != 1 {
+			return nil, usageError("queue-consumers: expected queue name")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return rabbitmq.QueueConsumers(QueueRef{Vhost: *vhost, Queue: flags.Arg(0)})
+	})
+
+	registerCommand("definitions", "[--keep-secrets] export normalized definitions", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("definitions")
+		keepSecrets := flags.Bool("keep-secrets", false, "keep password hashes and uri credentials")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		data, err := rabbitmq.management().NormalizedDefinitions(DefinitionsOptions{KeepSecrets: *keepSecrets})
+		if err != nil {
+			return nil, err
+		}
+		return rawJSON(data), nil
+	})
+
+	registerCommand("apply-policies", "[--dry-run] <file> apply policies from a yaml file", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("apply-policies")
+		dryRun := flags.Bool("dry-run", false, "only show the diff")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("apply-policies: expected policy file")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return rabbitmq.management().ApplyPolicyFile(PolicyApplyOptions{File: flags.Arg(0), DryRun: *dryRun})
+	})
+
+	registerCommand("provision-users", "[--dry-run] <file> reconcile users from a users file", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("provision-users")
+		dryRun := flags.Bool("dry-run", false, "only show the plan")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("provision-users: expected users file")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return rabbitmq.management().ProvisionUsers(UserProvisioningOptions{File: flags.Arg(0), DryRun: *dryRun})
+	})
+
+	registerCommand("create", "[--concurrency n] [--checkpoint f] <manifest> create objects from a manifest", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("create")
+		var opts ManifestOptions
+		bulkFlags(flags, &opts.BulkOptions)
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("create: expected manifest file")
+		}
+		opts.File = flags.Arg(0)
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return bulkResult(rabbitmq.management().CreateManifest(opts, nil))
+	})
+
+	for _, op := range []string{"delete_queues", "delete_exchanges", "purge_queues", "close_connections"} {
+		op := op
+		name := strings.Replace(op, "_", "-", -1)
+		registerCommand(name, "[--vhost v] [--concurrency n] [--checkpoint f] <name>...", func(cli *CLI, args []string) (interface{}, error) {
+			flags := newFlagSet(name)
+			req := BulkRequest{Operation: op}
+			vhost := flags.String("vhost", "", "vhost of the objects, the default vhost when omitted")
+			flags.StringVar(&req.Reason, "reason", "closed by radish", "reason shown to closed connections")
+			bulkFlags(flags, &req.BulkOptions)
+			if err := parseFlags(flags, args); err != nil {
+				return nil, err
+			}
+			*vhost = cli.vhost(*vhost)
+			if flags.NArg() == 0 {
+				return nil, usageError("%s: expected at least one name", name)
+			}
+			for _, target := range flags.Args() {
+				req.Targets = append(req.Targets, ObjectRef{Vhost: *vhost, Name: target})
+			}
+			rabbitmq, err := cli.connect()
+			if err != nil {
+				return nil, err
+			}
+			return bulkResult(rabbitmq.management().RunBulkRequest(req, nil))
+		})
+	}
+}
+
+// bulkFlags register the flags shared by all bulk commands
+func bulkFlags(flags *flag.FlagSet, opts *BulkOptions) {
+	flags.IntVar(&opts.Concurrency, "concurrency", defaultBulkConcurrency, "number of parallel requests")
+	flags.StringVar(&opts.Checkpoint, "checkpoint", "", "checkpoint file to resume from")
+}
+
+// rawJSON already encoded json embedded as is in results
+type rawJSON []byte
+
+func (data rawJSON) MarshalJSON() ([]byte, error) {
+	return data, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCodes(t *testing.T) {
+	assert.Equal(t, ExitOK, exitCode(nil))
+	assert.Equal(t, ExitConnection, exitCode(fmt.Errorf("plain error")))
+	assert.Equal(t, ExitConnection, exitCode(context.DeadlineExceeded))
+	assert.Equal(t, ExitThreshold, exitCode(fmt.Errorf("check: %w", thresholdError("too many"))))
+	assert.Equal(t, ExitConnection, exitCode(connectionError(fmt.Errorf("refused"))))
+	assert.Equal(t, ExitThreshold, exitCode(thresholdError("too many")))
+
+	_, err := bulkResult(BulkSummary{Total: 2, Succeeded: 1, Failures: []BulkFailure{{ID: "a"}}}, nil)
+	assert.Equal(t, ExitPartialFailure, exitCode(err))
+	_, err = bulkResult(BulkSummary{Total: 1, Succeeded: 1}, nil)
+	assert.Nil(t, err)
+}
+
+func TestRunCLIUsage(t *testing.T) {
+	assert.Equal(t, ExitUsage, RunCLI([]string{"--no-such-flag"}))
+	assert.Equal(t, ExitUsage, RunCLI([]string{"no-such-command"}))
+	assert.Equal(t, ExitUsage, RunCLI([]string{"connection"}))
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DeniedClient : client versions known to misbehave
+type DeniedClient struct {
+	Product string `yaml:"product" json:"product"`
+	// Versions comparison like <0.13.0, >=5.0 or =1.2.3, or a glob like 0.13.*
+	Versions string `yaml:"versions" json:"versions"`
+	Reason   string `yaml:"reason" json:"reason"`
+}
+
+// ClientDenylist : denied client versions
+type ClientDenylist struct {
+	Clients []DeniedClient `yaml:"clients" json:"clients"`
+}
+
+// LoadClientDenylist read a denylist yaml file
+func LoadClientDenylist(file string) (ClientDenylist, error) {
+	var denylist ClientDenylist
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return denylist, err
+	}
+	if err := yaml.Unmarshal(data, &denylist); err != nil {
+		return denylist, err
+	}
+	for _, client := range denylist.Clients {
+		if _, _, err := parseVersionConstraint(client.Versions); err != nil {
+			return denylist, fmt.Errorf("%s: %s", client.Product, err)
+		}
+	}
+	return denylist, nil
+}
+
+// compareVersions compare dotted versions numerically, a missing or non
+// numeric part counts as 0, a suffix like -rc1 is ignored
+func compareVersions(a string, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(strings.SplitN(as[i], "-", 2)[0])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(strings.SplitN(bs[i], "-", 2)[0])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersionConstraint split a constraint into operator and version, a
+// constraint without operator is a glob
+func parseVersionConstraint(constraint string) (string, string, error) {
+	constraint = strings.TrimSpace(constraint)
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(constraint, op) {
+			return op, strings.TrimSpace(constraint[len(op):]), nil
+		}
+	}
+	if _, err := path.Match(constraint, ""); err != nil {
+		return "", "", fmt.Errorf("bad version pattern %q", constraint)
+	}
+	return "", constraint, nil
+}
+
+// Match true when product and version fall under the entry
+func (denied DeniedClient) Match(product string, version string) bool {
+	if !strings.EqualFold(denied.Product, product) {
+		return false
+	}
+	op, constraint, err := parseVersionConstraint(denied.Versions)
+	if err != nil {
+		return false
+	}
+	cmp := compareVersions(version, constraint)
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "=":
+		return cmp == 0
+	}
+	ok, _ := path.Match(constraint, version)
+	return ok
+}
+
+// Lookup the first entry denying the client
+func (denylist ClientDenylist) Lookup(product string, version string) (DeniedClient, bool) {
+	for _, denied := range denylist.Clients {
+		if denied.Match(product, version) {
+			return denied, true
+		}
+	}
+	return DeniedClient{}, false
+}
+
+// ClientVersion : connections of one client library version
+type ClientVersion struct {
+	Product     string   `json:"product"`
+	Version     string   `json:"version"`
+	Platform    string   `json:"platform"`
+	Connections int      `json:"connections"`
+	Users       []string `json:"users"`
+	Denied      bool     `json:"denied"`
+	Reason      string   `json:"reason,omitempty"`
+}
+
+// ClientInventory : client library versions in use, denied ones first
+type ClientInventory []ClientVersion
+
+// BuildClientInventory count connections per client product and version
+func BuildClientInventory(connections []rabtap.RabbitConnection, denylist ClientDenylist) ClientInventory {
+	versions := map[[2]string]*ClientVersion{}
+	for _, conn := range connections {
+		props := conn.ClientProperties
+		key := [2]string{props.Product, props.Version}
+		if versions[key] == nil {
+			versions[key] = &ClientVersion{Product: props.Product, Version: props.Version, Platform: props.Platform, Users: []string{}}
+			if denied, ok := denylist.Lookup(props.Product, props.Version); ok {
+				versions[key].Denied, versions[key].Reason = true, denied.Reason
+			}
+		}
+		version := versions[key]
+		version.Connections++
+		version.Users = appendUnique(version.Users, conn.User)
+	}
+	inventory := ClientInventory{}
+	for _, version := range versions {
+		sort.Strings(version.Users)
+		inventory = append(inventory, *version)
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		a, b := inventory[i], inventory[j]
+		if a.Denied != b.Denied {
+			return a.Denied
+		}
+		if a.Product != b.Product {
+			return a.Product < b.Product
+		}
+		return compareVersions(a.Version, b.Version) < 0
+	})
+	return inventory
+}
+
+// Table versions as table
+func (inventory ClientInventory) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"PRODUCT", "VERSION", "PLATFORM", "CONNECTIONS", "USERS", "DENIED"}}
+	for _, version := range inventory {
+		denied, color := "-", None
+		if version.Denied {
+			denied, color = orDash(version.Reason), Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: orDash(version.Product), Color: color},
+			{Text: orDash(version.Version), Color: color},
+			{Text: orDash(version.Platform)},
+			{Text: format.Count(int64(version.Connections))},
+			{Text: strings.Join(version.Users, ",")},
+			{Text: denied, Color: color},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("clients", "[--denylist f] [--fail-denied] client library versions in use", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("clients")
+		file := flags.String("denylist", envOr("RADISH_CLIENT_DENYLIST", ""), "yaml file of denied client versions")
+		failDenied := flags.Bool("fail-denied", false, "exit with the threshold code when denied clients are connected")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		denylist := ClientDenylist{}
+		if *file != "" {
+			var err error
+			if denylist, err = LoadClientDenylist(*file); err != nil {
+				return nil, usageError("clients: %s", err)
+			}
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		inventory := BuildClientInventory(rabbitmq.info().Connections, denylist)
+		denied := 0
+		for _, version := range inventory {
+			if version.Denied {
+				denied += version.Connections
+			}
+		}
+		if *failDenied && denied > 0 {
+			return inventory, thresholdError("%d connections use denied client versions", denied)
+		}
+		return inventory, nil
+	})
+}
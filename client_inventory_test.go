@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildClientInventory(t *testing.T) {
+	conn := func(user string, product string, version string) rabtap.RabbitConnection {
+		c := rabtap.RabbitConnection{User: user}
+		c.ClientProperties.Product, c.ClientProperties.Version = product, version
+		return c
+	}
+	connections := []rabtap.RabbitConnection{
+		conn("app", "pika", "0.13.1"), conn("batch", "pika", "0.13.1"), conn("app", "pika", "1.3.2"),
+		conn("svc", "RabbitMQ", "5.9.0"),
+	}
+	denylist := ClientDenylist{Clients: []DeniedClient{{Product: "Pika", Versions: "<1.0", Reason: "blocking connection bugs"}}}
+
+	inventory := BuildClientInventory(connections, denylist)
+	assert.Len(t, inventory, 3)
+	assert.Equal(t, ClientVersion{Product: "pika", Version: "0.13.1", Connections: 2,
+		Users: []string{"app", "batch"}, Denied: true, Reason: "blocking connection bugs"}, inventory[0])
+	assert.Equal(t, "RabbitMQ", inventory[1].Product)
+	assert.False(t, inventory[2].Denied)
+}
+
+func TestDeniedClientMatch(t *testing.T) {
+	assert.True(t, DeniedClient{Product: "amqp", Versions: "5.*"}.Match("amqp", "5.1.0"))
+	assert.True(t, DeniedClient{Product: "amqp", Versions: ">=2.10"}.Match("amqp", "2.10.1"))
+	assert.False(t, DeniedClient{Product: "amqp", Versions: ">=2.10"}.Match("amqp", "2.9.9"))
+	assert.True(t, DeniedClient{Product: "amqp", Versions: "=1.2"}.Match("amqp", "1.2.0"))
+	assert.Equal(t, -1, compareVersions("1.2.0-rc1", "1.10"))
+}
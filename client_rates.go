@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// QueueRates : message rates of a queue computed from counter deltas
+type QueueRates struct {
+	Publish    float64 `json:"publish"`
+	DeliverGet float64 `json:"deliverGet"`
+}
+
+// ConnectionRates : byte rates of a connection computed from counter deltas
+type ConnectionRates struct {
+	Recv float64 `json:"recv"`
+	Send float64 `json:"send"`
+}
+
+// ClientRates : rates computed by radish itself, independent of the rates
+// the broker reports
+type ClientRates struct {
+	Publish     float64                    `json:"publish"`
+	DeliverGet  float64                    `json:"deliverGet"`
+	Queues      map[string]QueueRates      `json:"queues"`
+	Connections map[string]ConnectionRates `json:"connections"`
+}
+
+// rateSample : a counter value and when it was sampled
+type rateSample struct {
+	value int
+	at    time.Time
+}
+
+// RateTracker turn successive samples of counters into per second rates
+type RateTracker struct {
+	samples map[string]map[string]rateSample
+	rates   ClientRates
+}
+
+// NewRateTracker create a tracker without samples
+func NewRateTracker() *RateTracker {
+	return &RateTracker{
+		samples: map[string]map[string]rateSample{},
+		rates:   ClientRates{Queues: map[string]QueueRates{}, Connections: map[string]ConnectionRates{}},
+	}
+}
+
+// rate record the counter of key and return its rate since the previous
+// sample, false on the first sample
+func (tracker *RateTracker) rate(prev map[string]rateSample, cur map[string]rateSample, key string, value int, at time.Time) (float64, bool) {
+	sample := rateSample{value, at}
+	cur[key] = sample
+	last, ok := prev[key]
+	if !ok {
+		return 0, false
+	}
+	return counterRate(last.value, sample.value, sample.at.Sub(last.at)), true
+}
+
+// Update sample the counters of the resource fetched at time at. Objects gone
+// from info are forgotten. Returns the current rates.
+func (tracker *RateTracker) Update(resource string, info rabtap.BrokerInfo, at time.Time) ClientRates {
+	prev := tracker.samples[resource]
+	cur := map[string]rateSample{}
+	switch resource {
+	case ResourceOverview:
+		stats := info.Overview.MessageStats
+		tracker.rates.Publish, _ = tracker.rate(prev, cur, "publish", stats.Publish, at)
+		tracker.rates.DeliverGet, _ = tracker.rate(prev, cur, "deliver_get", stats.DeliverGet, at)
+	case ResourceQueues:
+		queues := make(map[string]QueueRates, len(info.Queues))
+		for _, queue := range info.Queues {
+			key := queue.Vhost + "/" + queue.Name
+			publish, ok := tracker.rate(prev, cur, key+"/publish", queue.MessageStats.Publish, at)
+			deliver, _ := tracker.rate(prev, cur, key+"/deliver_get", queue.MessageStats.DeliverGet, at)
+			if ok {
+				queues[key] = QueueRates{Publish: publish, DeliverGet: deliver}
+			}
+		}
+		tracker.rates.Queues = queues
+	case ResourceConnections:
+		conns := make(map[string]ConnectionRates, len(info.Connections))
+		for _, conn := range info.Connections {
+			recv, ok := tracker.rate(prev, cur, conn.Name+"/recv", conn.RecvOct, at)
+			send, _ := tracker.rate(prev, cur, conn.Name+"/send", conn.SendOct, at)
+			if ok {
+				conns[conn.Name] = ConnectionRates{Recv: recv, Send: send}
+			}
+		}
+		tracker.rates.Connections = conns
+	default:
+		return tracker.rates
+	}
+	tracker.samples[resource] = cur
+	return tracker.rates
+}
+
+// Rates the rates of the last update
+func (tracker *RateTracker) Rates() ClientRates {
+	return tracker.rates
+}
+
+// QueueRateList : queue rates computed client side
+type QueueRateList struct {
+	Interval time.Duration         `json:"interval"`
+	Queues   map[string]QueueRates `json:"queues"`
+}
+
+// Table queue rates as table, busiest queues first
+func (list QueueRateList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"QUEUE", "IN", "OUT"}}
+	keys := make([]string, 0, len(list.Queues))
+	for key := range list.Queues {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := list.Queues[keys[i]], list.Queues[keys[j]]
+		if a.Publish+a.DeliverGet != b.Publish+b.DeliverGet {
+			return a.Publish+a.DeliverGet > b.Publish+b.DeliverGet
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		rates := list.Queues[key]
+		table.Rows = append(table.Rows, []Cell{
+			{Text: key},
+			{Text: format.Rate(rates.Publish, "msg")},
+			{Text: format.Rate(rates.DeliverGet, "msg")},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("rates", "[--interval d] queue rates measured by radish from two samples", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("rates")
+		interval := flags.Duration("interval", 5*time.Second, "time between the two samples")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if *interval <= 0 {
+			return nil, usageError("rates: --interval must be positive")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		tracker := NewRateTracker()
+		for i := 0; i < 2; i++ {
+			if i > 0 {
+				time.Sleep(*interval)
+			}
+			queues, err := rabbitmq.fetcher().Queues(context.Background())
+			if err != nil {
+				return nil, fmt.Errorf("sampling queues: %s", err)
+			}
+			tracker.Update(ResourceQueues, rabtap.BrokerInfo{Queues: queues}, time.Now())
+		}
+		return QueueRateList{Interval: *interval, Queues: tracker.Rates().Queues}, nil
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateTracker(t *testing.T) {
+	tracker := NewRateTracker()
+	start := time.Now()
+	info := rabtap.BrokerInfo{
+		Queues:      []rabtap.RabbitQueue{{Vhost: "/", Name: "q1"}},
+		Connections: []rabtap.RabbitConnection{{Name: "c1", RecvOct: 1000, SendOct: 500}},
+	}
+	info.Queues[0].MessageStats.Publish = 100
+	tracker.Update(ResourceQueues, info, start)
+	tracker.Update(ResourceConnections, info, start)
+	assert.Empty(t, tracker.Rates().Queues)
+
+	info.Queues[0].MessageStats.Publish = 150
+	info.Connections[0].RecvOct = 3000
+	info.Connections[0].SendOct = 200 // restarted
+	tracker.Update(ResourceQueues, info, start.Add(10*time.Second))
+	rates := tracker.Update(ResourceConnections, info, start.Add(10*time.Second))
+	assert.Equal(t, QueueRates{Publish: 5}, rates.Queues["//q1"])
+	assert.Equal(t, ConnectionRates{Recv: 200, Send: 20}, rates.Connections["c1"])
+
+	info.Queues = nil
+	assert.Empty(t, tracker.Update(ResourceQueues, info, start.Add(20*time.Second)).Queues)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// completionCacheTTL how long completion candidates fetched from the broker are reused
+const completionCacheTTL = 5 * time.Minute
+
+// the scripts pass the words before the cursor to __complete words, which
+// skips the global flags to find the command and applies --profile
+var bashCompletion = `_radish() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    COMPREPLY=( $(compgen -W "$(radish __complete words "${COMP_WORDS[@]:1:COMP_CWORD-1}")" -- "$cur") )
+}
+complete -F _radish radish
+`
+
+var zshCompletion = `#compdef radish
+_radish() {
+    compadd -- ${(f)"$(radish __complete words ${words[2,CURRENT-1]})"}
+}
+compdef _radish radish
+`
+
+var fishCompletion = `complete -c radish -f -a '(radish __complete words (commandline -opc)[2..-1])'
+`
+
+// completionKind the kind of object names a command takes as arguments
+func completionKind(command string) string {
+	switch command {
+	case "connection", "close-connections":
+		return "connections"
+	case "delete-exchanges":
+		return "exchanges"
+	case "queue-consumers", "delete-queues", "purge-queues", "search", "get", "delete-messages":
+		return "queues"
+	}
+	return ""
+}
+
+// completionCommands the commands users can run
+func completionCommands() []string {
+	commands := []string{}
+	for name := range cliCommands {
+		if !strings.HasPrefix(name, "__") {
+			commands = append(commands, name)
+		}
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// completeWords candidates for the word after words, the command line typed
+// so far without "radish". The global flags before the command are applied,
+// so --profile selects the broker names are fetched from.
+func (cli *CLI) completeWords(words []string) []string {
+	prev := ""
+	if len(words) > 0 {
+		prev = words[len(words)-1]
+	}
+	global := cli.globalFlags()
+	if err := global.Parse(words); err != nil {
+		// a global flag still waiting for its value
+		switch strings.TrimLeft(prev, "-") {
+		case "profile":
+			profiles, err := LoadBrokerProfiles(cli.profilesFile)
+			if err != nil {
+				return nil
+			}
+			return profiles.Names()
+		case "default-vhost":
+			return cli.completionCandidates("vhosts")
+		}
+		return nil
+	}
+	if global.NArg() == 0 {
+		return completionCommands()
+	}
+	if prev == "--vhost" || prev == "-vhost" {
+		return cli.completionCandidates("vhosts")
+	}
+	return cli.completionCandidates(completionKind(global.Arg(0)))
+}
+
+// completionCandidates the names of kind of the broker of the profile in
+// use
+func (cli *CLI) completionCandidates(kind string) []string {
+	if kind == "" || cli.useProfile() != nil {
+		return nil
+	}
+	names, err := cli.completionNames()
+	if err != nil {
+		// completion must stay silent when the broker is unreachable
+		return nil
+	}
+	return names[kind]
+}
+
+type completionCache struct {
+	Fetched time.Time           `json:"fetched"`
+	Names   map[string][]string `json:"names"`
+}
+
+// completionCachePath cache file of the broker cli connects to, every
+// profile and broker gets its own
+func (cli *CLI) completionCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	broker := strings.Join([]string{cli.profile, cli.login.ManagementURL, cli.login.Host,
+		cli.login.Port, cli.login.Username, cli.replay}, "\x00")
+	sum := sha256.Sum256([]byte(broker))
+	return filepath.Join(dir, "radish", "completion-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// completionNames the names of all objects of the broker by kind, cached on disk
+func (cli *CLI) completionNames() (map[string][]string, error) {
+	path := cli.completionCachePath()
+	var cache completionCache
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &cache) == nil && time.Since(cache.Fetched) < completionCacheTTL {
+			return cache.Names, nil
+		}
+	}
+
+	rabbitmq, err := cli.connect()
+	if err != nil {
+		return nil, err
+	}
+	info := rabbitmq.info()
+	unique := map[string]map[string]bool{
+		"vhosts": {}, "queues": {}, "exchanges": {}, "connections": {},
+	}
+	for _, queue := range info.Queues {
+		unique["vhosts"][queue.Vhost] = true
+		unique["queues"][queue.Name] = true
+	}
+	for _, exchange := range info.Exchanges {
+		unique["vhosts"][exchange.Vhost] = true
+		if exchange.Name != "" {
+			unique["exchanges"][exchange.Name] = true
+		}
+	}
+	for _, conn := range info.Connections {
+		unique["connections"][conn.Name] = true
+	}
+	cache = completionCache{Fetched: time.Now(), Names: map[string][]string{}}
+	for kind, names := range unique {
+		list := []string{}
+		for name := range names {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		cache.Names[kind] = list
+	}
+	if data, err := json.Marshal(cache); err == nil {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, data, 0600)
+	}
+	return cache.Names, nil
+}
+
+func init() {
+	registerCommand("completion", "<bash|zsh|fish> print a shell completion script", func(cli *CLI, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, usageError("completion: expected shell name")
+		}
+		scripts := map[string]string{"bash": bashCompletion, "zsh": zshCompletion, "fish": fishCompletion}
+		script, ok := scripts[args[0]]
+		if !ok {
+			return nil, usageError("completion: unsupported shell %s", args[0])
+		}
+		fmt.Fprint(cli.out, script)
+		return nil, nil
+	})
+
+	// __complete is called by the completion scripts, it prints one candidate per line
+	registerCommand("__complete", "internal: print completion candidates", func(cli *CLI, args []string) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, usageError("__complete: expected kind")
+		}
+		candidates := []string{}
+		switch args[0] {
+		case "words":
+			candidates = cli.completeWords(args[1:])
+		case "commands":
+			candidates = completionCommands()
+		case "vhosts":
+			candidates = cli.completionCandidates("vhosts")
+		case "names":
+			if len(args) > 1 {
+				candidates = cli.completionCandidates(completionKind(args[1]))
+			}
+		}
+		fmt.Fprintln(cli.out, strings.Join(candidates, "\n"))
+		return nil, nil
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompleteWords(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "completion")
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	os.Setenv("XDG_CACHE_HOME", dir)
+	profilesFile := filepath.Join(dir, "profiles.yml")
+	ioutil.WriteFile(profilesFile, []byte("profiles:\n  prod:\n    host: prod-mq\n  staging:\n    host: staging-mq\n"), 0600)
+
+	// candidates cached per profile, the broker is never contacted
+	cache := func(profile string, queues ...string) {
+		cli := &CLI{}
+		cli.globalFlags().Parse([]string{"--profiles", profilesFile, "--profile", profile})
+		assert.Nil(t, cli.useProfile())
+		data, _ := json.Marshal(completionCache{Fetched: time.Now(), Names: map[string][]string{
+			"queues": queues, "vhosts": {"/", profile},
+		}})
+		path := cli.completionCachePath()
+		os.MkdirAll(filepath.Dir(path), 0755)
+		assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+	}
+	cache("prod", "orders")
+	cache("staging", "orders-test")
+
+	complete := func(line string) []string {
+		return (&CLI{}).completeWords(strings.Fields(line))
+	}
+	global := "--profiles " + profilesFile + " "
+	assert.Contains(t, complete(""), "purge-queues")
+	assert.NotContains(t, complete(""), "__complete")
+	assert.Contains(t, complete("--json --profile prod"), "purge-queues")
+	assert.Equal(t, []string{"prod", "staging"}, complete(global+"--tls --profile"))
+	assert.Equal(t, []string{"orders"}, complete(global+"--profile prod purge-queues"))
+	assert.Equal(t, []string{"orders-test"}, complete(global+"--json --profile staging --width 80 purge-queues"))
+	assert.Equal(t, []string{"/", "staging"}, complete(global+"--profile staging get --vhost"))
+	assert.Equal(t, []string{"/", "prod"}, complete(global+"--profile prod --default-vhost"))
+	assert.Nil(t, complete(global+"--profile prod overview"))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// RabbitChannel : channel as returned by the management api
+type RabbitChannel struct {
+	Name                   string `json:"name"`
+	Number                 int    `json:"number"`
+	Node                   string `json:"node"`
+	User                   string `json:"user"`
+	Vhost                  string `json:"vhost"`
+	State                  string `json:"state"`
+	PrefetchCount          int    `json:"prefetch_count"`
+	ConsumerCount          int    `json:"consumer_count"`
+	MessagesUnacknowledged int    `json:"messages_unacknowledged"`
+	MessagesUnconfirmed    int    `json:"messages_unconfirmed"`
+	Confirm                bool   `json:"confirm"`
+	Transactional          bool   `json:"transactional"`
+	ConnectionDetails      struct {
+		Name     string `json:"name"`
+		PeerHost string `json:"peer_host"`
+		PeerPort int    `json:"peer_port"`
+	} `json:"connection_details"`
+	MessageStats struct {
+		Ack            int `json:"ack"`
+		PublishDetails struct {
+			Rate float64 `json:"rate"`
+		} `json:"publish_details"`
+		DeliverGetDetails struct {
+			Rate float64 `json:"rate"`
+		} `json:"deliver_get_details"`
+	} `json:"message_stats"`
+}
+
+// ChannelDetails : a channel together with the consumers running on it
+type ChannelDetails struct {
+	Channel   RabbitChannel           `json:"channel"`
+	Consumers []rabtap.RabbitConsumer `json:"consumers"`
+}
+
+// ConnectionDetails : joined view of a connection, its channels and the
+// queues its consumers are reading from
+type ConnectionDetails struct {
+	Connection rabtap.RabbitConnection `json:"connection"`
+	Channels   []ChannelDetails        `json:"channels"`
+	Queues     []rabtap.RabbitQueue    `json:"queues"`
+}
+
+// ConnectionChannels get the channels opened on the given connection
+func (client *ManagementClient) ConnectionChannels(connName string) ([]RabbitChannel, error) {
+	var channels []RabbitChannel
+	err := client.get(managementPath("connections", connName, "channels"), &channels)
+	return channels, err
+}
+
+// BuildConnectionDetails join connection, channels, consumers and queues for
+// the connection with the given name
+func BuildConnectionDetails(info *rabtap.BrokerInfo, channels []RabbitChannel, connName string) (ConnectionDetails, error) {
+	var details ConnectionDetails
+	found := false
+	for _, conn := range info.Connections {
+		if conn.Name == connName {
+			details.Connection = conn
+			found = true
+			break
+		}
+	}
+	if !found {
+		return details, fmt.Errorf("connection %s not found", connName)
+	}
+
+	queues := map[string]bool{}
+	for _, channel := range channels {
+		if channel.ConnectionDetails.Name != "" && channel.ConnectionDetails.Name != connName {
+			continue
+		}
+		chDetails := ChannelDetails{Channel: channel, Consumers: []rabtap.RabbitConsumer{}}
+		for _, consumer := range info.Consumers {
+			if consumer.ChannelDetails.Name == channel.Name {
+				chDetails.Consumers = append(chDetails.Consumers, consumer)
+				queues[consumer.Queue.Vhost+"/"+consumer.Queue.Name] = true
+			}
+		}
+		details.Channels = append(details.Channels, chDetails)
+	}
+
+	for _, queue := range info.Queues {
+		if queues[queue.Vhost+"/"+queue.Name] {
+			details.Queues = append(details.Queues, queue)
+		}
+	}
+	return details, nil
+}
+
+// ConnectionDetails fetch the joined view of the given connection
+func (rabbitmq *Rabbitmq) ConnectionDetails(connName string) (ConnectionDetails, error) {
+	if err := rabbitmq.UpdateBrokerInfo(); err != nil {
+		return ConnectionDetails{}, err
+	}
+	channels, err := rabbitmq.management().ConnectionChannels(connName)
+	if err != nil {
+		return ConnectionDetails{}, err
+	}
+	info := rabbitmq.info()
+	return BuildConnectionDetails(&info, channels, connName)
+}
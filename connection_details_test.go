@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildConnectionDetails(t *testing.T) {
+	info := rabtap.BrokerInfo{
+		Connections: []rabtap.RabbitConnection{{Name: "conn1"}, {Name: "conn2"}},
+		Queues:      []rabtap.RabbitQueue{{Name: "q1", Vhost: "/"}, {Name: "q2", Vhost: "/"}},
+	}
+	consumer := rabtap.RabbitConsumer{ConsumerTag: "tag1"}
+	consumer.Queue.Name = "q1"
+	consumer.Queue.Vhost = "/"
+	consumer.ChannelDetails.Name = "conn1 (1)"
+	info.Consumers = []rabtap.RabbitConsumer{consumer}
+
+	channels := []RabbitChannel{{Name: "conn1 (1)", Number: 1}, {Name: "conn1 (2)", Number: 2}}
+
+	details, err := BuildConnectionDetails(&info, channels, "conn1")
+	assert.Nil(t, err)
+	assert.Equal(t, "conn1", details.Connection.Name)
+	assert.Equal(t, 2, len(details.Channels))
+	assert.Equal(t, 1, len(details.Channels[0].Consumers))
+	assert.Equal(t, 0, len(details.Channels[1].Consumers))
+	assert.Equal(t, 1, len(details.Queues))
+	assert.Equal(t, "q1", details.Queues[0].Name)
+}
+
+func TestBuildConnectionDetailsUnknownConnection(t *testing.T) {
+	info := rabtap.BrokerInfo{}
+	_, err := BuildConnectionDetails(&info, nil, "conn1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronShortcuts : named schedules
+var cronShortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// CronSchedule : the minutes, hours, days of month, months and weekdays of
+// a five field cron expression
+type CronSchedule struct {
+	spec     string
+	fields   [5]map[int]bool
+	anyDay   bool
+	anyWeek  bool
+	location *time.Location
+}
+
+// cronRanges bounds of the five fields
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// ParseCronSchedule parse a cron expression like "30 6 * * 1-5" or one of
+// @hourly, @daily, @weekly and @monthly. Fields accept *, lists, ranges
+// and steps, 7 is sunday too.
+func ParseCronSchedule(spec string) (CronSchedule, error) {
+	schedule := CronSchedule{spec: spec, location: time.Local}
+	expr := strings.TrimSpace(spec)
+	if shortcut, ok := cronShortcuts[expr]; ok {
+		expr = shortcut
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return schedule, fmt.Errorf("cron schedule %q: expected 5 fields", spec)
+	}
+	for i, part := range parts {
+		values, err := parseCronField(part, cronRanges[i][0], cronRanges[i][1], i == 4)
+		if err != nil {
+			return schedule, fmt.Errorf("cron schedule %q: %s", spec, err)
+		}
+		schedule.fields[i] = values
+	}
+	schedule.anyDay = parts[2] == "*"
+	schedule.anyWeek = parts[4] == "*"
+	return schedule, nil
+}
+
+// parseCronField values of one field, like */15, 1-5 or 0,30
+func parseCronField(field string, min int, max int, weekday bool) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", item)
+			}
+			item = item[:i]
+		}
+		lo, hi := min, max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid range %q", item)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		limit := max
+		if weekday {
+			limit = 7
+		}
+		if lo < min || hi > limit || lo > hi {
+			return nil, fmt.Errorf("%q out of range %d-%d", item, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	if weekday && values[7] {
+		delete(values, 7)
+		values[0] = true
+	}
+	return values, nil
+}
+
+// String the expression the schedule was parsed from
+func (schedule CronSchedule) String() string {
+	return schedule.spec
+}
+
+// Matches true when the schedule fires in the minute of t. Like cron, a
+// restricted day of month and weekday match when either one does.
+func (schedule CronSchedule) Matches(t time.Time) bool {
+	if schedule.location != nil {
+		t = t.In(schedule.location)
+	}
+	if !schedule.fields[0][t.Minute()] || !schedule.fields[1][t.Hour()] || !schedule.fields[3][int(t.Month())] {
+		return false
+	}
+	day, weekday := schedule.fields[2][t.Day()], schedule.fields[4][int(t.Weekday())]
+	switch {
+	case schedule.anyDay && schedule.anyWeek:
+		return true
+	case schedule.anyDay:
+		return weekday
+	case schedule.anyWeek:
+		return day
+	}
+	return day || weekday
+}
+
+// Next first minute after t the schedule fires in, the zero time when it
+// does not fire within five years
+func (schedule CronSchedule) Next(t time.Time) time.Time {
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	for end := next.AddDate(5, 0, 0); next.Before(end); next = next.Add(time.Minute) {
+		if schedule.Matches(next) {
+			return next
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const redactedValue = "<redacted>"
+
+// fields identifying an object in the definitions, in sort order
+var definitionSortFields = []string{
+	"vhost", "name", "user", "component", "exchange",
+	"source", "destination_type", "destination", "routing_key",
+}
+
+func definitionSortKey(item interface{}) string {
+	obj, ok := item.(map[string]interface{})
+	if !ok {
+		return fmt.Sprint(item)
+	}
+	parts := []string{}
+	for _, field := range definitionSortFields {
+		if v, ok := obj[field]; ok {
+			parts = append(parts, fmt.Sprint(v))
+		}
+	}
+	// arguments disambiguate otherwise equal bindings
+	args, _ := json.Marshal(obj["arguments"])
+	return strings.Join(parts, "\x00") + "\x00" + string(args)
+}
+
+// redactURI drop the credentials of an amqp uri
+func redactURI(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.User == nil {
+		return uri
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+// redactParameter drop the credentials of the uris of a shovel or federation
+// upstream parameter, uri, src-uri and dest-uri are a string or a list
+func redactParameter(param map[string]interface{}) {
+	value, ok := param["value"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key, field := range value {
+		if key != "uri" && !strings.HasSuffix(key, "-uri") {
+			continue
+		}
+		switch uri := field.(type) {
+		case string:
+			value[key] = redactURI(uri)
+		case []interface{}:
+			for i, item := range uri {
+				if s, ok := item.(string); ok {
+					uri[i] = redactURI(s)
+				}
+			}
+		}
+	}
+}
+
+// NormalizeDefinitions bring exported definitions into a canonical form with
+// sorted keys and stable ordered object lists, so exports can be diffed.
+// Numbers are kept as exported. When redact is set password hashes are
+// replaced by a placeholder and credentials removed from shovel and
+// federation uris.
+func NormalizeDefinitions(data []byte, redact bool) ([]byte, error) {
+	var definitions map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&definitions); err != nil {
+		return nil, err
+	}
+	for key, value := range definitions {
+		list, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			return definitionSortKey(list[i]) < definitionSortKey(list[j])
+		})
+		if redact && key == "users" {
+			for _, item := range list {
+				if user, ok := item.(map[string]interface{}); ok {
+					if _, ok := user["password_hash"]; ok {
+						user["password_hash"] = redactedValue
+					}
+				}
+			}
+		}
+		if redact && (key == "parameters" || key == "global_parameters") {
+			for _, item := range list {
+				if param, ok := item.(map[string]interface{}); ok {
+					redactParameter(param)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(definitions); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DefinitionsOptions : how to export the definitions, secrets are redacted
+// unless KeepSecrets is set
+type DefinitionsOptions struct {
+	KeepSecrets bool `json:"keepSecrets"`
+}
+
+// ParseDefinitionsOptions : parse definitions options sent by the ui
+func ParseDefinitionsOptions(str string) DefinitionsOptions {
+	var res DefinitionsOptions
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		fmt.Println(err)
+	}
+	return res
+}
+
+// NormalizedDefinitions export the broker definitions in canonical form
+func (client *ManagementClient) NormalizedDefinitions(opts DefinitionsOptions) ([]byte, error) {
+	data, err := client.Definitions()
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeDefinitions(data, !opts.KeepSecrets)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const backupPrefix = "definitions-"
+
+// BackupStore : place where backup files are written to
+type BackupStore interface {
+	Write(name string, data []byte) error
+	List() ([]string, error)
+	Delete(name string) error
+}
+
+// DirStore stores backups as files in a local directory
+type DirStore struct {
+	Dir string
+}
+
+// Write create the file name in the directory
+func (store DirStore) Write(name string, data []byte) error {
+	if err := os.MkdirAll(store.Dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(store.Dir, name), data, 0644)
+}
+
+// List list the files in the directory, sorted
+func (store DirStore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(store.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete remove the file name from the directory
+func (store DirStore) Delete(name string) error {
+	return os.Remove(filepath.Join(store.Dir, name))
+}
+
+// S3Store stores backups in an s3 compatible bucket
+type S3Store struct {
+	client *S3Client
+}
+
+// Write upload name to the bucket
+func (store S3Store) Write(name string, data []byte) error {
+	return store.client.PutObject(name, data)
+}
+
+// List list the objects in the bucket, sorted
+func (store S3Store) List() ([]string, error) {
+	return store.client.ListObjects()
+}
+
+// Delete remove name from the bucket
+func (store S3Store) Delete(name string) error {
+	return store.client.DeleteObject(name)
+}
+
+// KVBackupStore stores backups as keys under backups/ of a sqlite or s3 store
+type KVBackupStore struct {
+	store KVStore
+}
+
+// backupKeyPrefix keys of the backups in a store
+const backupKeyPrefix = "backups/"
+
+// Write put name into the store
+func (store KVBackupStore) Write(name string, data []byte) error {
+	return store.store.Put(backupKeyPrefix+name, data)
+}
+
+// List list the backups in the store, sorted
+func (store KVBackupStore) List() ([]string, error) {
+	keys, err := store.store.Keys(backupKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, backupKeyPrefix)
+	}
+	return keys, nil
+}
+
+// Delete remove name from the store
+func (store KVBackupStore) Delete(name string) error {
+	return store.store.Delete(backupKeyPrefix + name)
+}
+
+// BackupOptions : configuration of the definitions backup job
+type BackupOptions struct {
+	Dir string    `json:"dir"`
+	S3  *S3Target `json:"s3"`
+	// Store sqlite database or s3://bucket/prefix location, see OpenKVStore
+	Store string `json:"store"`
+	// Interval between two exports in seconds
+	Interval int  `json:"interval"`
+	Gzip     bool `json:"gzip"`
+	// Retention number of backups to keep, 0 keeps all
+	Retention int `json:"retention"`
+	// Normalize write definitions in canonical form, see NormalizeDefinitions
+	Normalize bool `json:"normalize"`
+	// KeepSecrets keep password hashes and uri credentials when normalizing
+	KeepSecrets bool `json:"keepSecrets"`
+}
+
+// ParseBackupOptions : parse backup options sent by the ui
+func ParseBackupOptions(str string) BackupOptions {
+	var res BackupOptions
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		fmt.Println(err)
+	}
+	return res
+}
+
+// DefinitionsBackup exports the broker definitions and writes them to a
+// store whenever they changed
+type DefinitionsBackup struct {
+	client   *ManagementClient
+	store    BackupStore
+	opts     BackupOptions
+	lastHash string
+}
+
+// NewDefinitionsBackup create a backup job writing to the store selected in opts
+func NewDefinitionsBackup(client *ManagementClient, opts BackupOptions) (*DefinitionsBackup, error) {
+	var store BackupStore
+	switch {
+	case opts.S3 != nil:
+		store = S3Store{client: NewS3Client(*opts.S3)}
+	case opts.Store != "":
+		if !isStoreLocation(opts.Store) {
+			return nil, fmt.Errorf("backup store %q is no sqlite database or s3 location, use dir for files", opts.Store)
+		}
+		kv, err := OpenKVStore(opts.Store)
+		if err != nil {
+			return nil, err
+		}
+		store = KVBackupStore{store: kv}
+	case opts.Dir != "":
+		store = DirStore{Dir: opts.Dir}
+	default:
+		return nil, fmt.Errorf("no backup directory, store or s3 target configured")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 3600
+	}
+	return &DefinitionsBackup{client: client, store: store, opts: opts}, nil
+}
+
+// Definitions export the definitions of the whole broker
+func (client *ManagementClient) Definitions() ([]byte, error) {
+	return client.getRaw("definitions")
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// BackupOnce export the definitions and write them when they changed since
+// the last run. Returns the name of the written backup, empty if skipped.
+func (backup *DefinitionsBackup) BackupOnce(now time.Time) (string, error) {
+	var data []byte
+	var err error
+	if backup.opts.Normalize {
+		data, err = backup.client.NormalizedDefinitions(DefinitionsOptions{KeepSecrets: backup.opts.KeepSecrets})
+	} else {
+		data, err = backup.client.Definitions()
+	}
+	if err != nil {
+		return "", err
+	}
+	hash := sha256Hex(data)
+	if hash == backup.lastHash {
+		return "", nil
+	}
+	name := backupPrefix + now.UTC().Format("20060102T150405Z") + ".json"
+	if backup.opts.Gzip {
+		if data, err = gzipBytes(data); err != nil {
+			return "", err
+		}
+		name += ".gz"
+	}
+	if err := backup.store.Write(name, data); err != nil {
+		return "", err
+	}
+	backup.lastHash = hash
+	return name, backup.prune()
+}
+
+// prune delete the oldest backups exceeding the retention
+func (backup *DefinitionsBackup) prune() error {
+	if backup.opts.Retention <= 0 {
+		return nil
+	}
+	names, err := backup.store.List()
+	if err != nil {
+		return err
+	}
+	backups := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, backupPrefix) {
+			backups = append(backups, name)
+		}
+	}
+	for len(backups) > backup.opts.Retention {
+		if err := backup.store.Delete(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// RunContext backup the definitions on every interval until ctx is done
+func (backup *DefinitionsBackup) RunContext(ctx context.Context) {
+	stop := make(chan bool)
+	go func() {
+		<-ctx.Done()
+		close(stop)
+	}()
+	backup.Run(stop)
+}
+
+// Run backup the definitions on every interval until stop is signalled
+func (backup *DefinitionsBackup) Run(stop chan bool) {
+	ticker := time.NewTicker(time.Duration(backup.opts.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		name, err := backup.BackupOnce(time.Now())
+		if err != nil {
+			subsystemLog("backup").Errorf("definitions backup failed: %s", err)
+		} else if name != "" {
+			subsystemLog("backup").Infof("definitions backup written to %s", name)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefinitionsBackupSkipsUnchangedAndPrunes(t *testing.T) {
+	definitions := `{"queues":[]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(definitions))
+	}))
+	defer server.Close()
+	uri, _ := url.Parse(server.URL + "/api")
+
+	dir, err := ioutil.TempDir("", "radish-backup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	backup, err := NewDefinitionsBackup(NewManagementClient(uri, nil), BackupOptions{Dir: dir, Retention: 2})
+	assert.Nil(t, err)
+
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	name, err := backup.BackupOnce(now)
+	assert.Nil(t, err)
+	assert.Equal(t, "definitions-20190101T000000Z.json", name)
+
+	name, err = backup.BackupOnce(now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "", name)
+
+	for i := 2; i < 5; i++ {
+		definitions = `{"queues":[` + string(rune('0'+i)) + `]}`
+		_, err = backup.BackupOnce(now.Add(time.Duration(i) * time.Hour))
+		assert.Nil(t, err)
+	}
+	files, _ := DirStore{Dir: dir}.List()
+	assert.Equal(t, []string{"definitions-20190101T030000Z.json", "definitions-20190101T040000Z.json"}, files)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// discoveryInterval how often discovered brokers are resolved again
+const discoveryInterval = 30 * time.Second
+
+// BrokerTarget : a resolved broker endpoint
+type BrokerTarget struct {
+	Host string `json:"host"`
+	Port string `json:"port"`
+}
+
+// ResolveSRV lookup the targets of a dns srv name, ordered by priority and weight
+func ResolveSRV(name string) ([]BrokerTarget, error) {
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, err
+	}
+	targets := []BrokerTarget{}
+	for _, record := range records {
+		targets = append(targets, BrokerTarget{
+			Host: record.Target,
+			Port: strconv.Itoa(int(record.Port)),
+		})
+	}
+	return targets, nil
+}
+
+// ResolveConsul lookup the healthy instances of a consul service
+func ResolveConsul(consulAddr string, service string) ([]BrokerTarget, error) {
+	endpoint := fmt.Sprintf("http://%s/v1/health/service/%s?passing=true", consulAddr, url.PathEscape(service))
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul lookup of %s: %s", service, res.Status)
+	}
+	var entries []struct {
+		Node struct {
+			Address string
+		}
+		Service struct {
+			Address string
+			Port    int
+		}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	targets := []BrokerTarget{}
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		targets = append(targets, BrokerTarget{Host: host, Port: strconv.Itoa(entry.Service.Port)})
+	}
+	return targets, nil
+}
+
+// ResolveBrokerTargets resolve the broker endpoints for the configured
+// discovery mechanism, a plain host resolves to itself
+func ResolveBrokerTargets(det RabbitmqLoginDetails) ([]BrokerTarget, error) {
+	var targets []BrokerTarget
+	var err error
+	switch det.Discovery {
+	case "":
+		return []BrokerTarget{{Host: det.Host, Port: det.Port}}, nil
+	case "srv":
+		targets, err = ResolveSRV(det.Host)
+	case "consul":
+		targets, err = ResolveConsul(det.ConsulAddr, det.Host)
+	default:
+		return nil, fmt.Errorf("unknown discovery mechanism %s", det.Discovery)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no brokers found for %s", det.Host)
+	}
+	return targets, nil
+}
+
+func containsTarget(targets []BrokerTarget, target BrokerTarget) bool {
+	for _, t := range targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// connectAny connect to the first of targets that accepts, in the order
+// discovery returned them, the error of the last target when none does
+func (rabbitmq *Rabbitmq) connectAny(det RabbitmqLoginDetails, targets []BrokerTarget) error {
+	return connectFirst(targets, func(target BrokerTarget) error {
+		return rabbitmq.connectTarget(det, target)
+	})
+}
+
+// connectFirst try connect on every target until one succeeds
+func connectFirst(targets []BrokerTarget, connect func(BrokerTarget) error) error {
+	err := fmt.Errorf("no brokers to connect to")
+	for i, target := range targets {
+		if err = connect(target); err == nil {
+			return nil
+		}
+		if i < len(targets)-1 {
+			subsystemLog("discovery").Warnf("connect to %s:%s failed, trying the next broker: %s", target.Host, target.Port, err)
+		}
+	}
+	return err
+}
+
+// rediscover reconnect unless the current target is still among targets
+func (rabbitmq *Rabbitmq) rediscover(targets []BrokerTarget, connect func(BrokerTarget) error) {
+	current := rabbitmq.currentTarget()
+	if containsTarget(targets, current) {
+		return
+	}
+	subsystemLog("discovery").Infof("broker %s:%s is gone, reconnecting", current.Host, current.Port)
+	if err := connectFirst(targets, connect); err != nil {
+		subsystemLog("discovery").Errorf("reconnect to the discovered brokers failed: %s", err)
+	}
+}
+
+// watchDiscovery periodically resolve the broker targets again and reconnect
+// when the current target has disappeared
+func (rabbitmq *Rabbitmq) watchDiscovery(det RabbitmqLoginDetails, stop chan bool) {
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			targets, err := ResolveBrokerTargets(det)
+			if err != nil {
+				subsystemLog("discovery").Warnf("broker discovery failed: %s", err)
+				continue
+			}
+			rabbitmq.rediscover(targets, func(target BrokerTarget) error {
+				return rabbitmq.connectTarget(det, target)
+			})
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectFirst(t *testing.T) {
+	targets := []BrokerTarget{{Host: "a", Port: "5672"}, {Host: "b", Port: "5672"}, {Host: "c", Port: "5672"}}
+	var tried []string
+	err := connectFirst(targets, func(target BrokerTarget) error {
+		tried = append(tried, target.Host)
+		if target.Host == "b" {
+			return nil
+		}
+		return errors.New("refused")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, tried)
+
+	err = connectFirst(targets, func(target BrokerTarget) error { return errors.New(target.Host + " refused") })
+	assert.EqualError(t, err, "c refused")
+	assert.NotNil(t, connectFirst(nil, func(BrokerTarget) error { return nil }))
+}
+
+func TestRediscover(t *testing.T) {
+	rabbitmq := NewRabbitmq()
+	rabbitmq.target = BrokerTarget{Host: "a", Port: "5672"}
+	var tried []string
+	connect := func(target BrokerTarget) error {
+		tried = append(tried, target.Host)
+		if target.Host == "b" {
+			return errors.New("refused")
+		}
+		rabbitmq.mu.Lock()
+		rabbitmq.target = target
+		rabbitmq.mu.Unlock()
+		return nil
+	}
+
+	// still discovered, stays connected
+	rabbitmq.rediscover([]BrokerTarget{{Host: "b", Port: "5672"}, {Host: "a", Port: "5672"}}, connect)
+	assert.Empty(t, tried)
+
+	// gone, fails over past the broker refusing
+	rabbitmq.rediscover([]BrokerTarget{{Host: "b", Port: "5672"}, {Host: "c", Port: "5672"}}, connect)
+	assert.Equal(t, []string{"b", "c"}, tried)
+	assert.Equal(t, "c", rabbitmq.currentTarget().Host)
+}
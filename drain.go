@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ways of keeping publishers away while a queue drains
+const (
+	DrainBlockPolicy = "policy"
+	DrainBlockClose  = "close"
+	DrainBlockNone   = "none"
+)
+
+// drainPolicyPriority above other operator policies matching the queue
+const drainPolicyPriority = 9999
+
+// DrainOptions : queue to drain and how to stop new messages arriving
+type DrainOptions struct {
+	Vhost        string
+	Queue        string
+	Block        string
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// DrainResult : outcome of a drain
+type DrainResult struct {
+	Vhost             string        `json:"vhost"`
+	Queue             string        `json:"queue"`
+	Drained           bool          `json:"drained"`
+	Remaining         int           `json:"remaining"`
+	Duration          time.Duration `json:"duration"`
+	ClosedConnections []string      `json:"closedConnections,omitempty"`
+}
+
+// drainPolicy temporary operator policy rejecting publishes to the queue.
+// With overflow reject-publish the messages already queued are kept, only
+// new ones are refused. As an operator policy it is merged with the queue's
+// own policy instead of replacing it.
+func drainPolicy(vhost string, queue string) RabbitPolicy {
+	return RabbitPolicy{
+		Vhost:    vhost,
+		Name:     "radish-drain-" + queue,
+		Pattern:  "^" + regexp.QuoteMeta(queue) + "$",
+		ApplyTo:  "queues",
+		Priority: drainPolicyPriority,
+		Definition: map[string]interface{}{
+			"max-length": 0,
+			"overflow":   "reject-publish",
+		},
+	}
+}
+
+// QueueMessages number of messages in a queue
+func (client *ManagementClient) QueueMessages(vhost string, queue string) (int, error) {
+	var res struct {
+		Messages int `json:"messages"`
+	}
+	err := client.get(objectPath("queues", vhost, queue)+"?columns=messages", &res)
+	return res.Messages, err
+}
+
+// UpstreamPublishers connections publishing to the exchanges the queue is
+// bound to. The broker only tracks publishers per exchange with
+// rates_mode detailed, otherwise the list is empty.
+func (client *ManagementClient) UpstreamPublishers(vhost string, queue string) ([]string, error) {
+	var bindings []struct {
+		Source string `json:"source"`
+	}
+	if err := client.get(managementPath("queues", vhost, queue, "bindings"), &bindings); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	conns := []string{}
+	for _, binding := range bindings {
+		if binding.Source == "" {
+			continue
+		}
+		var exchange struct {
+			Incoming []struct {
+				ChannelDetails struct {
+					ConnectionName string `json:"connection_name"`
+				} `json:"channel_details"`
+			} `json:"incoming"`
+		}
+		if err := client.get(objectPath("exchanges", vhost, binding.Source), &exchange); err != nil {
+			return nil, err
+		}
+		for _, incoming := range exchange.Incoming {
+			name := incoming.ChannelDetails.ConnectionName
+			if name != "" && !seen[name] {
+				seen[name] = true
+				conns = append(conns, name)
+			}
+		}
+	}
+	return conns, nil
+}
+
+// DrainQueue block publishers of a queue and wait until its consumers
+// emptied it or the timeout passed. The drain policy is removed again in
+// any case.
+func (client *ManagementClient) DrainQueue(ctx context.Context, opts DrainOptions, progress func(remaining int)) (DrainResult, error) {
+	result := DrainResult{Vhost: opts.Vhost, Queue: opts.Queue}
+	if err := client.scope.Check("queue", opts.Queue); err != nil {
+		return result, err
+	}
+	start := time.Now()
+	switch opts.Block {
+	case DrainBlockPolicy:
+		policy := drainPolicy(opts.Vhost, opts.Queue)
+		if err := client.PutOperatorPolicy(policy); err != nil {
+			return result, err
+		}
+		defer func() {
+			if err := client.DeleteOperatorPolicy(policy.Vhost, policy.Name); err != nil {
+				subsystemLog("drain").Errorf("removing operator policy %s failed: %s", policy.Name, err)
+			}
+		}()
+	case DrainBlockClose:
+		conns, err := client.UpstreamPublishers(opts.Vhost, opts.Queue)
+		if err != nil {
+			return result, err
+		}
+		for _, conn := range conns {
+			if err := client.CloseConnection(conn, "queue "+opts.Queue+" is drained for maintenance"); err != nil {
+				return result, err
+			}
+			result.ClosedConnections = append(result.ClosedConnections, conn)
+		}
+	case DrainBlockNone, "":
+	default:
+		return result, fmt.Errorf("unknown block mode %q", opts.Block)
+	}
+
+	deadline := time.After(opts.Timeout)
+	ticker := time.NewTicker(opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		remaining, err := client.QueueMessages(opts.Vhost, opts.Queue)
+		if err != nil {
+			return result, err
+		}
+		result.Remaining = remaining
+		result.Duration = time.Since(start)
+		if progress != nil {
+			progress(remaining)
+		}
+		if remaining == 0 {
+			result.Drained = true
+			return result, nil
+		}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-deadline:
+			return result, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func init() {
+	registerCommand("drain", "[--vhost v] [--block policy|close|none] [--timeout d] <queue> wait until a queue is empty", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("drain")
+		opts := DrainOptions{}
+		flags.StringVar(&opts.Vhost, "vhost", "", "vhost of the queue, the default vhost when omitted")
+		flags.StringVar(&opts.Block, "block", DrainBlockPolicy, "keep publishers away: policy (reject-publish), close (their connections) or none")
+		flags.DurationVar(&opts.Timeout, "timeout", 10*time.Minute, "give up after")
+		flags.DurationVar(&opts.PollInterval, "poll", 2*time.Second, "time between two checks")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		opts.Vhost = cli.vhost(opts.Vhost)
+		if flags.NArg() != 1 {
+			return nil, usageError("drain: expected queue name")
+		}
+		opts.Queue = flags.Arg(0)
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		ctx, stop := signalContext(context.Background())
+		defer stop()
+		result, err := rabbitmq.management().DrainQueue(ctx, opts, func(remaining int) {
+			if !cli.json {
+				fmt.Fprintf(cli.out, "%s %d messages left\n", time.Now().Format(time.RFC3339), remaining)
+			}
+		})
+		if err == nil && !result.Drained {
+			err = thresholdError("%d messages left after %s", result.Remaining, opts.Timeout)
+		}
+		return result, err
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainQueue(t *testing.T) {
+	var calls []string
+	remaining := []string{`{"messages": 5}`, `{"messages": 2}`, `{"messages": 0}`}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.EscapedPath())
+		if r.Method == "GET" {
+			w.Write([]byte(remaining[0]))
+			remaining = remaining[1:]
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+
+	var seen []int
+	result, err := NewManagementClient(uri, nil).DrainQueue(context.Background(), DrainOptions{
+		Vhost: "/", Queue: "orders", Block: DrainBlockPolicy, Timeout: time.Second, PollInterval: time.Millisecond,
+	}, func(n int) { seen = append(seen, n) })
+	assert.Nil(t, err)
+	assert.True(t, result.Drained)
+	assert.Equal(t, []int{5, 2, 0}, seen)
+	assert.Equal(t, "PUT /api/operator-policies/%2F/radish-drain-orders", calls[0])
+	assert.Equal(t, "DELETE /api/operator-policies/%2F/radish-drain-orders", calls[len(calls)-1])
+}
+
+func TestDrainPolicy(t *testing.T) {
+	policy := drainPolicy("/", "orders.v1")
+	assert.Equal(t, `^orders\.v1$`, policy.Pattern)
+	assert.Equal(t, "reject-publish", policy.Definition["overflow"])
+	assert.Equal(t, 0, policy.Definition["max-length"])
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Emitter pushes metric samples to a metrics backend
+type Emitter interface {
+	Emit(samples []MetricSample, at time.Time) error
+}
+
+// EmitterOptions : prefix and tags added to every metric of an emitter
+type EmitterOptions struct {
+	Prefix string
+	Tags   []MetricLabel
+}
+
+// ParseTags parse "env=prod,dc=fra" into sorted labels
+func ParseTags(str string) ([]MetricLabel, error) {
+	var tags []MetricLabel
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected name=value", pair)
+		}
+		tags = append(tags, MetricLabel{kv[0], kv[1]})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// labels the tags of the emitter followed by the labels of the sample
+func (opts EmitterOptions) labels(sample MetricSample) []MetricLabel {
+	return append(append([]MetricLabel{}, opts.Tags...), sample.Labels...)
+}
+
+// StatsdEmitter : statsd gauges over udp, tags in the dogstatsd format
+type StatsdEmitter struct {
+	EmitterOptions
+	conn net.Conn
+}
+
+// NewStatsdEmitter create an emitter sending to the statsd daemon at addr
+func NewStatsdEmitter(addr string, opts EmitterOptions) (*StatsdEmitter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdEmitter{EmitterOptions: opts, conn: conn}, nil
+}
+
+// Close the udp socket
+func (emitter *StatsdEmitter) Close() error {
+	return emitter.conn.Close()
+}
+
+// statsdMaxPacket keep packets below the common udp mtu
+const statsdMaxPacket = 1432
+
+// statsdEscaper : separators of the dogstatsd format, replaced in tags
+var statsdEscaper = strings.NewReplacer(":", "_", "|", "_", ",", "_", "\n", "_")
+
+// statsdLine counters are sent as gauges too, the broker counters are totals
+func statsdLine(opts EmitterOptions, sample MetricSample) string {
+	line := fmt.Sprintf("%s%s:%g|g", opts.Prefix, sample.Def.Name, sample.Value)
+	if labels := opts.labels(sample); len(labels) > 0 {
+		tags := make([]string, len(labels))
+		for i, label := range labels {
+			tags[i] = statsdEscaper.Replace(label.Name) + ":" + statsdEscaper.Replace(label.Value)
+		}
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// Emit send the samples, several lines per packet
+func (emitter *StatsdEmitter) Emit(samples []MetricSample, at time.Time) error {
+	var packet bytes.Buffer
+	for _, sample := range samples {
+		line := statsdLine(emitter.EmitterOptions, sample)
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsdMaxPacket {
+			if _, err := emitter.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err := emitter.conn.Write(packet.Bytes())
+		return err
+	}
+	return nil
+}
+
+// GraphiteEmitter : graphite plaintext protocol over tcp with tags
+type GraphiteEmitter struct {
+	EmitterOptions
+	Addr string
+}
+
+// graphiteEscaper : separators of the plaintext protocol, replaced in tags.
+// ; ends a tag, spaces and newlines the path, ~ and = are reserved in tags.
+var graphiteEscaper = strings.NewReplacer(";", "_", " ", "_", "\n", "_", "~", "_", "=", "_")
+
+// graphiteLine e.g. radish.queue_messages;vhost=/;queue=orders 12 1588338245
+func graphiteLine(opts EmitterOptions, sample MetricSample, at time.Time) string {
+	name := opts.Prefix + sample.Def.Name
+	for _, label := range opts.labels(sample) {
+		name += ";" + graphiteEscaper.Replace(label.Name) + "=" + graphiteEscaper.Replace(label.Value)
+	}
+	return fmt.Sprintf("%s %g %d\n", name, sample.Value, at.Unix())
+}
+
+// Emit send the samples over a new connection
+func (emitter *GraphiteEmitter) Emit(samples []MetricSample, at time.Time) error {
+	conn, err := net.DialTimeout("tcp", emitter.Addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var buf bytes.Buffer
+	for _, sample := range samples {
+		buf.WriteString(graphiteLine(emitter.EmitterOptions, sample, at))
+	}
+	_, err = conn.Write(buf.Bytes())
+	return err
+}
+
+// InfluxEmitter : influxdb line protocol posted to a write endpoint, e.g.
+// http://influx:8086/write?db=rabbitmq
+type InfluxEmitter struct {
+	EmitterOptions
+	URL    string
+	client *http.Client
+}
+
+// NewInfluxEmitter create an emitter posting to url
+func NewInfluxEmitter(url string, opts EmitterOptions) *InfluxEmitter {
+	return &InfluxEmitter{EmitterOptions: opts, URL: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxLine e.g. radish_queue_messages,queue=orders,vhost=/ value=12 1588338245000000000
+func influxLine(opts EmitterOptions, sample MetricSample, at time.Time) string {
+	line := influxEscaper.Replace(opts.Prefix + sample.Def.Name)
+	for _, label := range opts.labels(sample) {
+		// empty tag values are not allowed
+		if label.Value != "" {
+			line += "," + influxEscaper.Replace(label.Name) + "=" + influxEscaper.Replace(label.Value)
+		}
+	}
+	return fmt.Sprintf("%s value=%g %d\n", line, sample.Value, at.UnixNano())
+}
+
+// Emit post all samples in one request
+func (emitter *InfluxEmitter) Emit(samples []MetricSample, at time.Time) error {
+	var buf bytes.Buffer
+	for _, sample := range samples {
+		buf.WriteString(influxLine(emitter.EmitterOptions, sample, at))
+	}
+	res, err := emitter.client.Post(emitter.URL, "text/plain; charset=utf-8", &buf)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("influx write failed: %s", res.Status)
+	}
+	return nil
+}
+
+// RunEmitters push the metrics of the latest poller snapshot to all emitters
+// every interval until ctx is done. Failing emitters are logged and retried
+// with the next snapshot. Emitters holding a connection are closed at the end.
+func RunEmitters(ctx context.Context, poller *Poller, emitters []Emitter, interval time.Duration) {
+	defer func() {
+		for _, emitter := range emitters {
+			if closer, ok := emitter.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			snapshot := poller.Snapshot()
+			if snapshot == nil {
+				continue
+			}
+			samples := BrokerMetrics(snapshot)
+			for _, emitter := range emitters {
+				if err := emitter.Emit(samples, now); err != nil {
+					subsystemLog("emitter").Warnf("%T failed: %s", emitter, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrokerMetrics(t *testing.T) {
+	snapshot := &Snapshot{Info: rabtap.BrokerInfo{
+		Queues:      []rabtap.RabbitQueue{{Vhost: "/", Name: "orders", Node: "rabbit@a", Messages: 5}},
+		Connections: []rabtap.RabbitConnection{{Name: "c1", Node: "rabbit@a"}},
+	}}
+	snapshot.Info.Queues[0].MessageStats.PublishDetails.Rate = 1
+	snapshot.Rates.Queues = map[string]QueueRates{"//orders": {Publish: 7}}
+	samples := BrokerMetrics(snapshot)
+	find := func(def MetricDef) MetricSample {
+		for _, sample := range samples {
+			if sample.Def == def {
+				return sample
+			}
+		}
+		return MetricSample{}
+	}
+	assert.Equal(t, MetricSample{metricQueueMessages, []MetricLabel{{"vhost", "/"}, {"queue", "orders"}}, 5}, find(metricQueueMessages))
+	assert.Equal(t, 7.0, find(metricQueuePublishRate).Value)
+	assert.Equal(t, MetricSample{metricNodeConnections, []MetricLabel{{"node", "rabbit@a"}}, 1}, find(metricNodeConnections))
+}
+
+func TestEmitterLines(t *testing.T) {
+	tags, err := ParseTags("env=prod")
+	assert.Nil(t, err)
+	opts := EmitterOptions{Prefix: "radish.", Tags: tags}
+	sample := MetricSample{metricQueueMessages, []MetricLabel{{"vhost", "/"}, {"queue", "my queue"}}, 12}
+	at := time.Unix(1588338245, 0)
+
+	assert.Equal(t, "radish.queue_messages:12|g|#env:prod,vhost:/,queue:my queue", statsdLine(opts, sample))
+	assert.Equal(t, "radish.queue_messages;env=prod;vhost=/;queue=my_queue 12 1588338245\n", graphiteLine(opts, sample, at))
+	assert.Equal(t, `radish.queue_messages,env=prod,vhost=/,queue=my\ queue value=12 1588338245000000000`+"\n", influxLine(opts, sample, at))
+
+	_, err = ParseTags("env")
+	assert.NotNil(t, err)
+
+	odd := MetricSample{metricQueueMessages, []MetricLabel{{"vhost", "a:b|c,d"}, {"queue", "x;y=z~w\nv"}}, 1}
+	assert.Equal(t, "queue_messages:1|g|#vhost:a_b_c_d,queue:x;y=z~w_v", statsdLine(EmitterOptions{}, odd))
+	assert.Equal(t, "queue_messages;vhost=a:b|c,d;queue=x_y_z_w_v 1 1588338245\n", graphiteLine(EmitterOptions{}, odd, at))
+}
+
+func TestStatsdEmitter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+	emitter, err := NewStatsdEmitter(conn.LocalAddr().String(), EmitterOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, emitter.Emit([]MetricSample{{metricMessages, nil, 1}, {metricMessagesReady, nil, 2}}, time.Now()))
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "messages:1|g\nmessages_ready:2|g", string(buf[:n]))
+	assert.Nil(t, emitter.Close())
+	assert.NotNil(t, emitter.Emit([]MetricSample{{metricMessages, nil, 1}}, time.Now()))
+}
+
+func TestInfluxEmitter(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	emitter := NewInfluxEmitter(server.URL+"/write?db=rabbitmq", EmitterOptions{})
+	assert.Nil(t, emitter.Emit([]MetricSample{{metricMessages, nil, 3}}, time.Unix(1, 0)))
+	assert.Equal(t, "messages value=3 1000000000\n", body)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// eventExchange exchange of the rabbitmq_event_exchange plugin
+const eventExchange = "amq.rabbitmq.event"
+
+// TranslateEvent turn a message of the event exchange into a broker event.
+// The routing key is the event type, name and vhost are headers like all
+// other details of the event.
+func TranslateEvent(delivery amqp.Delivery) BrokerEvent {
+	event := BrokerEvent{
+		Type:       delivery.RoutingKey,
+		Time:       delivery.Timestamp,
+		Source:     EventSourceExchange,
+		Properties: map[string]string{},
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for key, value := range delivery.Headers {
+		str := fmt.Sprint(value)
+		if bytes, ok := value.([]byte); ok {
+			str = string(bytes)
+		}
+		switch key {
+		case "name":
+			event.Name = str
+		case "vhost":
+			event.Vhost = str
+		case "timestamp_in_ms":
+		default:
+			event.Properties[key] = str
+		}
+	}
+	// consumers have no name, the poller names them by tag
+	if tag, ok := event.Properties["consumer_tag"]; ok && event.Name == "" {
+		event.Name = tag
+		delete(event.Properties, "consumer_tag")
+	}
+	return event
+}
+
+// eventResources resource class of the poller an event type changes
+var eventResources = map[string]string{
+	"queue":      ResourceQueues,
+	"exchange":   ResourceExchanges,
+	"binding":    ResourceBindings,
+	"connection": ResourceConnections,
+	"consumer":   ResourceConsumers,
+}
+
+// RefreshOnEvents let the poller re-fetch the resources events from the event
+// exchange report as changed, until ctx is done
+func RefreshOnEvents(ctx context.Context, poller *Poller) {
+	events, cancel := poller.Events.Subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if event.Source != EventSourceExchange {
+				continue
+			}
+			kind := strings.SplitN(event.Type, ".", 2)[0]
+			if resource, ok := eventResources[kind]; ok {
+				poller.Refresh(resource)
+			}
+		}
+	}
+}
+
+// ListenEvents publish the events of the event exchange to bus until ctx is
+// done. pattern selects the event types, e.g. "queue.*" or "#".
+func (rabbitmq *Rabbitmq) ListenEvents(ctx context.Context, pattern string, bus *EventBus) {
+	manager := NewAMQPManager(rabbitmq.amqpURL, rabbitmq.amqpConfig, AMQPManagerOptions{})
+	manager.Consume(ctx, func(ch *amqp.Channel) (string, error) {
+		queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			return "", err
+		}
+		return queue.Name, ch.QueueBind(queue.Name, pattern, eventExchange, false, nil)
+	}, func(delivery amqp.Delivery) {
+		bus.Publish(TranslateEvent(delivery))
+	})
+	manager.Run(ctx)
+}
+
+func init() {
+	registerCommand("events", "[--pattern p] [--interval d] [--no-listener] follow broker events", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("events")
+		pattern := flags.String("pattern", "#", "event types to listen to, e.g. queue.*")
+		interval := flags.Duration("interval", defaultPollInterval, "poll interval detecting changes")
+		noListener := flags.Bool("no-listener", false, "only poll, for brokers without the event exchange plugin")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		poller := NewPoller(rabbitmq, PollIntervals{Default: *interval})
+		events, cancel := poller.Events.Subscribe()
+		defer cancel()
+		go poller.Run(ctx)
+		if !*noListener {
+			go rabbitmq.ListenEvents(ctx, *pattern, poller.Events)
+			go RefreshOnEvents(ctx, poller)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, nil
+			case event := <-events:
+				fmt.Fprintln(cli.out, event.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// sources of broker events
+const (
+	EventSourcePoller   = "poller"
+	EventSourceExchange = "event-exchange"
+)
+
+// BrokerEvent : a change on the broker, named like the events of the
+// rabbitmq event exchange, e.g. queue.created or connection.closed
+type BrokerEvent struct {
+	Type       string            `json:"type"`
+	Vhost      string            `json:"vhost,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Time       time.Time         `json:"time"`
+	Source     string            `json:"source"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// String one line summary of the event
+func (event BrokerEvent) String() string {
+	str := fmt.Sprintf("%s %-26s", event.Time.Format(time.RFC3339), event.Type)
+	if event.Vhost != "" {
+		str += " vhost=" + event.Vhost
+	}
+	if event.Name != "" {
+		str += fmt.Sprintf(" name=%q", event.Name)
+	}
+	keys := make([]string, 0, len(event.Properties))
+	for key := range event.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		str += fmt.Sprintf(" %s=%s", key, event.Properties[key])
+	}
+	return str
+}
+
+// key identity of the event, equal for the same change seen by the poller
+// and the event exchange
+func (event BrokerEvent) key() string {
+	return event.Type + "|" + event.Vhost + "|" + event.Name
+}
+
+// eventDedupWindow time a change reported by the event exchange suppresses
+// the same change detected by the poller
+const eventDedupWindow = 5 * time.Minute
+
+// EventBus : fans events out to subscribers, slow subscribers lose events
+// instead of blocking the producers
+type EventBus struct {
+	mutex       sync.Mutex
+	subscribers map[chan BrokerEvent]bool
+	announced   map[string]time.Time
+}
+
+// NewEventBus create a bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: map[chan BrokerEvent]bool{}, announced: map[string]time.Time{}}
+}
+
+// Subscribe receive all events published from now on until cancel is called
+func (bus *EventBus) Subscribe() (<-chan BrokerEvent, func()) {
+	ch := make(chan BrokerEvent, 256)
+	bus.mutex.Lock()
+	bus.subscribers[ch] = true
+	bus.mutex.Unlock()
+	return ch, func() {
+		bus.mutex.Lock()
+		defer bus.mutex.Unlock()
+		if bus.subscribers[ch] {
+			delete(bus.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish send event to all subscribers. Changes the event exchange already
+// announced are not repeated when the poller notices them later.
+func (bus *EventBus) Publish(event BrokerEvent) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	for key, at := range bus.announced {
+		if event.Time.Sub(at) > eventDedupWindow {
+			delete(bus.announced, key)
+		}
+	}
+	switch event.Source {
+	case EventSourceExchange:
+		bus.announced[event.key()] = event.Time
+	case EventSourcePoller:
+		if _, ok := bus.announced[event.key()]; ok {
+			return
+		}
+	}
+	for ch := range bus.subscribers {
+		select {
+		case ch <- event:
+		default:
+			subsystemLog("events").Warnf("subscriber too slow, dropped %s", event.Type)
+		}
+	}
+}
+
+// objectKeys identities of the objects of resource in info
+func objectKeys(resource string, info rabtap.BrokerInfo) map[string]BrokerEvent {
+	keys := map[string]BrokerEvent{}
+	switch resource {
+	case ResourceQueues:
+		for _, queue := range info.Queues {
+			keys[queue.Vhost+"/"+queue.Name] = BrokerEvent{Vhost: queue.Vhost, Name: queue.Name}
+		}
+	case ResourceExchanges:
+		for _, exchange := range info.Exchanges {
+			keys[exchange.Vhost+"/"+exchange.Name] = BrokerEvent{Vhost: exchange.Vhost, Name: exchange.Name}
+		}
+	case ResourceConnections:
+		for _, conn := range info.Connections {
+			keys[conn.Name] = BrokerEvent{Vhost: conn.Vhost, Name: conn.Name,
+				Properties: map[string]string{"user": conn.User}}
+		}
+	case ResourceConsumers:
+		for _, consumer := range info.Consumers {
+			keys[consumer.ChannelDetails.Name+"/"+consumer.ConsumerTag] = BrokerEvent{
+				Vhost: consumer.Queue.Vhost, Name: consumer.ConsumerTag,
+				Properties: map[string]string{"queue": consumer.Queue.Name},
+			}
+		}
+	}
+	return keys
+}
+
+// sortedEventKeys keys of objects in a stable order
+func sortedEventKeys(objects map[string]BrokerEvent) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// eventNames created and deleted event types of the resource
+var eventNames = map[string][2]string{
+	ResourceQueues:      {"queue.created", "queue.deleted"},
+	ResourceExchanges:   {"exchange.created", "exchange.deleted"},
+	ResourceConnections: {"connection.created", "connection.closed"},
+	ResourceConsumers:   {"consumer.created", "consumer.deleted"},
+}
+
+// DiffEvents events turning the objects of resource in old into those in new
+func DiffEvents(resource string, old rabtap.BrokerInfo, new rabtap.BrokerInfo, now time.Time) []BrokerEvent {
+	names, ok := eventNames[resource]
+	if !ok {
+		return nil
+	}
+	before, after := objectKeys(resource, old), objectKeys(resource, new)
+	var events []BrokerEvent
+	for _, key := range sortedEventKeys(after) {
+		if _, ok := before[key]; !ok {
+			event := after[key]
+			event.Type, event.Time, event.Source = names[0], now, EventSourcePoller
+			events = append(events, event)
+		}
+	}
+	for _, key := range sortedEventKeys(before) {
+		if _, ok := after[key]; !ok {
+			event := before[key]
+			event.Type, event.Time, event.Source = names[1], now, EventSourcePoller
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffEvents(t *testing.T) {
+	now := time.Now()
+	old := rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "a"}, {Vhost: "/", Name: "b"}}}
+	new := rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "b"}, {Vhost: "/", Name: "c"}}}
+	events := DiffEvents(ResourceQueues, old, new, now)
+	assert.Equal(t, []BrokerEvent{
+		{Type: "queue.created", Vhost: "/", Name: "c", Time: now, Source: EventSourcePoller},
+		{Type: "queue.deleted", Vhost: "/", Name: "a", Time: now, Source: EventSourcePoller},
+	}, events)
+	assert.Nil(t, DiffEvents(ResourceOverview, old, new, now))
+}
+
+func TestTranslateEvent(t *testing.T) {
+	at := time.Date(2020, 4, 1, 10, 0, 0, 0, time.UTC)
+	event := TranslateEvent(amqp.Delivery{
+		RoutingKey: "user.authentication.failure",
+		Timestamp:  at,
+		Headers:    amqp.Table{"name": "admin", "peer_address": []byte("10.0.0.7"), "connection_type": "network"},
+	})
+	assert.Equal(t, "user.authentication.failure", event.Type)
+	assert.Equal(t, "admin", event.Name)
+	assert.Equal(t, "10.0.0.7", event.Properties["peer_address"])
+	assert.Equal(t, EventSourceExchange, event.Source)
+	assert.Equal(t, `2020-04-01T10:00:00Z user.authentication.failure name="admin" connection_type=network peer_address=10.0.0.7`,
+		event.String())
+}
+
+func TestEventBusSuppressesPolledDuplicates(t *testing.T) {
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe()
+	now := time.Now()
+	bus.Publish(BrokerEvent{Type: "queue.created", Vhost: "/", Name: "q", Time: now, Source: EventSourceExchange})
+	bus.Publish(BrokerEvent{Type: "queue.created", Vhost: "/", Name: "q", Time: now.Add(time.Second), Source: EventSourcePoller})
+	bus.Publish(BrokerEvent{Type: "queue.deleted", Vhost: "/", Name: "q", Time: now.Add(time.Second), Source: EventSourcePoller})
+	cancel()
+	var types []string
+	for event := range events {
+		types = append(types, event.Type+"/"+event.Source)
+	}
+	assert.Equal(t, []string{"queue.created/event-exchange", "queue.deleted/poller"}, types)
+	cancel()
+}
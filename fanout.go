@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fanoutCommands read only commands that may run against every profile
+// with --all-profiles. health-check and route-check publish probe messages
+// and are left out, the read only fan-out connections refuse them.
+var fanoutCommands = map[string]bool{
+	"info": true, "queues": true, "connections": true, "channels": true, "clients": true,
+	"rates": true, "queue-consumers": true, "binding-stats": true, "certs": true,
+	"heartbeat-audit": true, "lazy-advice": true, "owners": true, "placement": true,
+	"sessions": true, "quorum-queues": true, "posture": true, "storage": true, "streams": true,
+	"topology": true, "user-activity": true, "vhost-usage": true, "expr": true,
+}
+
+// fanoutLogin the login details of a profile for a fan-out. Credentials of
+// the flags are never sent to other brokers, every profile has to bring
+// its own, and every connection is read only.
+func fanoutLogin(profiles BrokerProfiles, name string, base RabbitmqLoginDetails) (RabbitmqLoginDetails, error) {
+	profile := profiles.Profiles[name]
+	if (profile.User == "" || profile.Password == "") && profile.Cert == "" {
+		return base, fmt.Errorf("profile %s has no credentials of its own", name)
+	}
+	base.Username, base.Password, base.ClientCert, base.ClientKey = "", "", "", ""
+	login, err := profiles.Login(name, base)
+	login.ReadOnly = true
+	return login, err
+}
+
+// ProfileResult : result of a command against one profile
+type ProfileResult struct {
+	Profile string      `json:"profile"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// FanoutResult : results of a command against every profile, in profile
+// order
+type FanoutResult struct {
+	Command  string          `json:"command"`
+	Profiles []ProfileResult `json:"profiles"`
+}
+
+// RunFanout run the command against each profile concurrently
+func RunFanout(command string, names []string, run func(profile string) (interface{}, error)) FanoutResult {
+	result := FanoutResult{Command: command, Profiles: make([]ProfileResult, len(names))}
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			value, err := run(name)
+			result.Profiles[i] = ProfileResult{Profile: name, Result: value}
+			if err != nil {
+				result.Profiles[i].Error = err.Error()
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	return result
+}
+
+// Failed the profiles the command failed against
+func (result FanoutResult) Failed() []string {
+	failed := []string{}
+	for _, profile := range result.Profiles {
+		if profile.Error != "" {
+			failed = append(failed, profile.Profile)
+		}
+	}
+	return failed
+}
+
+// Err a partial failure when the command failed against some profiles
+func (result FanoutResult) Err() error {
+	failed := result.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	return &CLIError{Code: ExitPartialFailure, Err: fmt.Errorf("%s failed against %d of %d profiles: %s", result.Command, len(failed), len(result.Profiles), strings.Join(failed, ", "))}
+}
+
+// Summary one row per profile with the number of rows it returned
+func (result FanoutResult) Summary(format NumberFormat) Table {
+	table := Table{Headers: []string{"PROFILE", "ROWS", "STATUS"}}
+	total := 0
+	for _, profile := range result.Profiles {
+		rows := Cell{Text: "-"}
+		status := Cell{Text: "ok", Color: Green}
+		if tabular, ok := profile.Result.(Tabular); ok {
+			n := len(tabular.Table(format).Rows)
+			total += n
+			rows.Text = format.Count(int64(n))
+		}
+		if profile.Error != "" {
+			status = Cell{Text: profile.Error, Color: Red}
+		}
+		table.Rows = append(table.Rows, []Cell{{Text: profile.Profile}, rows, status})
+	}
+	table.Rows = append(table.Rows, []Cell{{Text: "total"}, {Text: format.Count(int64(total))}, {Text: fmt.Sprintf("%d of %d failed", len(result.Failed()), len(result.Profiles))}})
+	return table
+}
+
+// Table the rows of every profile in one table with a leading PROFILE
+// column, for csv output and questions like which cluster has a queue
+func (result FanoutResult) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"PROFILE"}}
+	for _, profile := range result.Profiles {
+		tabular, ok := profile.Result.(Tabular)
+		if !ok {
+			continue
+		}
+		part := tabular.Table(format)
+		if len(table.Headers) == 1 {
+			table.Headers = append(table.Headers, part.Headers...)
+		}
+		for _, row := range part.Rows {
+			table.Rows = append(table.Rows, append([]Cell{{Text: profile.Profile}}, row...))
+		}
+	}
+	return table
+}
+
+// Sections one report section per profile and the summary
+func (result FanoutResult) Sections() []ReportSection {
+	sections := []ReportSection{}
+	for _, profile := range result.Profiles {
+		var value interface{} = profile.Result
+		if profile.Error != "" {
+			value = map[string]string{"error": profile.Error}
+		}
+		sections = append(sections, ReportSection{Title: profile.Profile, Result: value})
+	}
+	return append(sections, ReportSection{Title: "Summary", Result: fanoutSummary(result)})
+}
+
+// fanoutSummary : the summary table of a fan-out as result
+type fanoutSummary FanoutResult
+
+// Table the summary of the fan-out
+func (summary fanoutSummary) Table(format NumberFormat) Table {
+	return FanoutResult(summary).Summary(format)
+}
+
+// runAllProfiles run the command against every profile of the profiles
+// file, each with its own credentials and read only
+func (cli *CLI) runAllProfiles(name string, command cliCommand, args []string) (interface{}, error) {
+	if !fanoutCommands[name] {
+		names := []string{}
+		for command := range fanoutCommands {
+			names = append(names, command)
+		}
+		sort.Strings(names)
+		return nil, usageError("--all-profiles: %s is not a read only command, expected one of %s", name, strings.Join(names, ", "))
+	}
+	if cli.profile != "" || cli.record != "" || cli.replay != "" {
+		return nil, usageError("--all-profiles: --profile, --record and --replay need a single broker")
+	}
+	profiles, err := LoadBrokerProfiles(cli.profilesFile)
+	if err != nil {
+		return nil, usageError("--all-profiles: %s", err)
+	}
+	if len(profiles.Profiles) == 0 {
+		return nil, usageError("--all-profiles: no profiles in %s", cli.profilesFile)
+	}
+	result := RunFanout(name, profiles.Names(), func(profile string) (interface{}, error) {
+		login, err := fanoutLogin(profiles, profile, cli.baseLogin)
+		if err != nil {
+			return nil, err
+		}
+		sub := *cli
+		sub.rabbitmq, sub.profile, sub.login = nil, profile, login
+		return command.run(&sub, args)
+	})
+	return result, result.Err()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanoutLogin(t *testing.T) {
+	profiles := BrokerProfiles{Profiles: map[string]BrokerProfile{
+		"prod":    {Host: "prod", User: "reader", Password: "secret"},
+		"staging": {Host: "staging"},
+	}}
+	base := RabbitmqLoginDetails{Host: "localhost", Username: "admin", Password: "admin"}
+	login, err := fanoutLogin(profiles, "prod", base)
+	assert.Nil(t, err)
+	assert.Equal(t, "reader", login.Username)
+	assert.True(t, login.ReadOnly)
+	// the admin credentials of the flags are not sent to staging
+	_, err = fanoutLogin(profiles, "staging", base)
+	assert.NotNil(t, err)
+}
+
+func TestFanoutCommands(t *testing.T) {
+	for name := range fanoutCommands {
+		_, ok := cliCommands[name]
+		assert.True(t, ok, name)
+	}
+	// these write to the broker, which the read only fan-out refuses
+	assert.False(t, fanoutCommands["health-check"])
+	assert.False(t, fanoutCommands["route-check"])
+}
+
+func TestRunFanout(t *testing.T) {
+	result := RunFanout("queues", []string{"prod", "staging", "test"}, func(profile string) (interface{}, error) {
+		if profile == "test" {
+			return nil, fmt.Errorf("connection refused")
+		}
+		list := QueueList{Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "orders.retry"}}}
+		if profile == "staging" {
+			list.Queues = append(list.Queues, rabtap.RabbitQueue{Vhost: "/", Name: "orders"})
+		}
+		return list, nil
+	})
+	assert.Equal(t, []string{"test"}, result.Failed())
+	assert.Equal(t, ExitPartialFailure, exitCode(result.Err()))
+
+	table := result.Table(NumberFormat{})
+	assert.Equal(t, "PROFILE", table.Headers[0])
+	assert.Equal(t, 3, len(table.Rows))
+	assert.Equal(t, "staging", table.Rows[2][0].Text)
+
+	summary := result.Summary(NumberFormat{})
+	assert.Equal(t, "3", summary.Rows[3][1].Text)
+	assert.Equal(t, Red, summary.Rows[2][2].Color)
+	assert.Equal(t, 4, len(result.Sections()))
+
+	cli := &CLI{allProfiles: true}
+	_, err := cli.runAllProfiles("delete-messages", cliCommands["delete-messages"], nil)
+	assert.Equal(t, ExitUsage, exitCode(err))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// filter operators, two character operators first so >= is not read as >
+var filterOperators = []string{">=", "<=", "!=", "=", ">", "<", "~"}
+
+// FilterCondition : a dotted field compared to a value, ~ matches a glob
+type FilterCondition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// FilterExpr : conditions that all have to match
+type FilterExpr []FilterCondition
+
+// ParseFilterExpr parse conditions joined by "and", like
+// vhost=prod and name~order.* and messages>1000
+func ParseFilterExpr(str string) (FilterExpr, error) {
+	expr := FilterExpr{}
+	if strings.TrimSpace(str) == "" {
+		return expr, nil
+	}
+	for _, part := range strings.Split(str, " and ") {
+		part = strings.TrimSpace(part)
+		pos, op := -1, ""
+		for _, candidate := range filterOperators {
+			if i := strings.Index(part, candidate); i > 0 && (pos < 0 || i < pos) {
+				pos, op = i, candidate
+			}
+		}
+		if pos < 0 {
+			return nil, fmt.Errorf("invalid condition %q, expected field, one of %s and a value", part, strings.Join(filterOperators, " "))
+		}
+		cond := FilterCondition{
+			Field: strings.TrimSpace(part[:pos]),
+			Op:    op,
+			Value: strings.TrimSpace(part[pos+len(op):]),
+		}
+		if op == "~" {
+			if _, err := path.Match(cond.Value, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %s", cond.Value, err)
+			}
+		}
+		expr = append(expr, cond)
+	}
+	return expr, nil
+}
+
+func (expr FilterExpr) String() string {
+	parts := make([]string, len(expr))
+	for i, cond := range expr {
+		parts[i] = cond.Field + cond.Op + cond.Value
+	}
+	return strings.Join(parts, " and ")
+}
+
+// lookupField the value of a dotted field path of a json object
+func lookupField(object map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = object
+	for _, key := range strings.Split(field, ".") {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = nested[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// compareValues order two json values, numbers numerically and everything
+// else by its text
+func compareValues(a interface{}, b interface{}) int {
+	x, xNumber := a.(float64)
+	y, yNumber := b.(float64)
+	if xNumber && yNumber {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// Match true when the json object satisfies every condition
+func (expr FilterExpr) Match(object map[string]interface{}) bool {
+	for _, cond := range expr {
+		value, ok := lookupField(object, cond.Field)
+		if !ok {
+			return false
+		}
+		var want interface{} = cond.Value
+		if number, err := strconv.ParseFloat(cond.Value, 64); err == nil {
+			want = number
+		}
+		var match bool
+		switch cond.Op {
+		case "=":
+			match = compareValues(value, want) == 0
+		case "!=":
+			match = compareValues(value, want) != 0
+		case ">":
+			match = compareValues(value, want) > 0
+		case ">=":
+			match = compareValues(value, want) >= 0
+		case "<":
+			match = compareValues(value, want) < 0
+		case "<=":
+			match = compareValues(value, want) <= 0
+		case "~":
+			match, _ = path.Match(cond.Value, fmt.Sprint(value))
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// sortObjects order json objects by a dotted field, descending with a
+// leading -
+func sortObjects(list []interface{}, field string) {
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+	value := func(i int) interface{} {
+		if object, ok := list[i].(map[string]interface{}); ok {
+			v, _ := lookupField(object, field)
+			return v
+		}
+		return nil
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if desc {
+			return compareValues(value(i), value(j)) > 0
+		}
+		return compareValues(value(i), value(j)) < 0
+	})
+}
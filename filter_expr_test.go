@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilterExpr(t *testing.T) {
+	expr, err := ParseFilterExpr("vhost=prod and name~order.* and messages>=1000")
+	assert.Nil(t, err)
+	assert.Equal(t, FilterExpr{
+		{Field: "vhost", Op: "=", Value: "prod"},
+		{Field: "name", Op: "~", Value: "order.*"},
+		{Field: "messages", Op: ">=", Value: "1000"},
+	}, expr)
+	assert.Equal(t, "vhost=prod and name~order.* and messages>=1000", expr.String())
+
+	assert.True(t, expr.Match(map[string]interface{}{"vhost": "prod", "name": "order.created", "messages": 1500.0}))
+	assert.False(t, expr.Match(map[string]interface{}{"vhost": "prod", "name": "order.created", "messages": 999.0}))
+	assert.False(t, expr.Match(map[string]interface{}{"vhost": "test", "name": "order.created", "messages": 1500.0}))
+	assert.False(t, expr.Match(map[string]interface{}{"vhost": "prod", "name": "order.created"}))
+
+	nested, _ := ParseFilterExpr("message_stats.publish_details.rate > 2.5")
+	assert.True(t, nested.Match(map[string]interface{}{"message_stats": map[string]interface{}{"publish_details": map[string]interface{}{"rate": 3.0}}}))
+
+	_, err = ParseFilterExpr("messages")
+	assert.NotNil(t, err)
+	_, err = ParseFilterExpr("name~[")
+	assert.NotNil(t, err)
+}
+
+func TestSortObjects(t *testing.T) {
+	list := []interface{}{
+		map[string]interface{}{"name": "b", "messages": 10.0},
+		map[string]interface{}{"name": "a", "messages": 2.0},
+		map[string]interface{}{"name": "c", "messages": 30.0},
+	}
+	sortObjects(list, "-messages")
+	assert.Equal(t, "c", list[0].(map[string]interface{})["name"])
+	assert.Equal(t, "a", list[2].(map[string]interface{})["name"])
+	sortObjects(list, "name")
+	assert.Equal(t, "a", list[0].(map[string]interface{})["name"])
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// limits of the connection settings audit
+const (
+	defaultMaxHeartbeat  = 300
+	defaultMaxFrame      = 1 << 20
+	defaultMaxChannelMax = 2047
+	// minFrameMax smallest frame_max the amqp spec allows
+	minFrameMax = 4096
+	// auditExamples connection names kept per group
+	auditExamples = 3
+)
+
+// SettingsAuditOptions : negotiated values counting as risky
+type SettingsAuditOptions struct {
+	MaxHeartbeat  int
+	MaxFrame      int
+	MaxChannelMax int
+}
+
+// connectionRisks risky settings of a connection, channel_max 0 means no
+// limit
+func connectionRisks(conn rabtap.RabbitConnection, opts SettingsAuditOptions) []string {
+	var risks []string
+	switch {
+	case conn.Timeout == 0:
+		risks = append(risks, "heartbeat disabled")
+	case conn.Timeout > opts.MaxHeartbeat:
+		risks = append(risks, "long heartbeat")
+	}
+	switch {
+	case conn.FrameMax != 0 && conn.FrameMax < minFrameMax:
+		risks = append(risks, "small frame_max")
+	case conn.FrameMax > opts.MaxFrame:
+		risks = append(risks, "large frame_max")
+	}
+	switch {
+	case conn.ChannelMax == 0:
+		risks = append(risks, "unlimited channel_max")
+	case conn.ChannelMax > opts.MaxChannelMax:
+		risks = append(risks, "large channel_max")
+	}
+	return risks
+}
+
+// ClientSettingsGroup : connections of a client product with risky settings
+type ClientSettingsGroup struct {
+	Product     string         `json:"product"`
+	Connections int            `json:"connections"`
+	Risky       int            `json:"risky"`
+	Risks       map[string]int `json:"risks"`
+	Heartbeats  []int          `json:"heartbeats"`
+	Examples    []string       `json:"examples"`
+}
+
+// AuditConnectionSettings group connections by client product, counting
+// the ones negotiated with risky heartbeat, frame_max or channel_max
+// values. Products without risky connections are left out.
+func AuditConnectionSettings(connections []rabtap.RabbitConnection, opts SettingsAuditOptions) []ClientSettingsGroup {
+	groups := map[string]*ClientSettingsGroup{}
+	heartbeats := map[string]map[int]bool{}
+	for _, conn := range connections {
+		product := conn.ClientProperties.Product
+		if product == "" {
+			product = "unknown"
+		}
+		group := groups[product]
+		if group == nil {
+			group = &ClientSettingsGroup{Product: product, Risks: map[string]int{}, Heartbeats: []int{}, Examples: []string{}}
+			groups[product] = group
+			heartbeats[product] = map[int]bool{}
+		}
+		group.Connections++
+		if !heartbeats[product][conn.Timeout] {
+			heartbeats[product][conn.Timeout] = true
+			group.Heartbeats = append(group.Heartbeats, conn.Timeout)
+		}
+		risks := connectionRisks(conn, opts)
+		if len(risks) == 0 {
+			continue
+		}
+		group.Risky++
+		for _, risk := range risks {
+			group.Risks[risk]++
+		}
+		if len(group.Examples) < auditExamples {
+			group.Examples = append(group.Examples, conn.Name)
+		}
+	}
+	report := []ClientSettingsGroup{}
+	for _, group := range groups {
+		if group.Risky == 0 {
+			continue
+		}
+		sort.Ints(group.Heartbeats)
+		report = append(report, *group)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Risky != report[j].Risky {
+			return report[i].Risky > report[j].Risky
+		}
+		return report[i].Product < report[j].Product
+	})
+	return report
+}
+
+// ClientSettingsReport : risky settings per client product
+type ClientSettingsReport []ClientSettingsGroup
+
+// Table groups as table
+func (report ClientSettingsReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"PRODUCT", "CONNECTIONS", "RISKY", "RISKS", "HEARTBEATS", "EXAMPLES"}}
+	for _, group := range report {
+		risks := []string{}
+		for risk, count := range group.Risks {
+			risks = append(risks, risk+" "+format.Count(int64(count)))
+		}
+		sort.Strings(risks)
+		heartbeats := make([]string, len(group.Heartbeats))
+		for i, heartbeat := range group.Heartbeats {
+			heartbeats[i] = format.Count(int64(heartbeat)) + "s"
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: group.Product},
+			{Text: format.Count(int64(group.Connections))},
+			{Text: format.Count(int64(group.Risky)), Color: Yellow},
+			{Text: strings.Join(risks, ", ")},
+			{Text: strings.Join(heartbeats, ",")},
+			{Text: strings.Join(group.Examples, ", ")},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("heartbeat-audit", "[--max-heartbeat s] [--max-frame b] [--max-channel-max n] connections with risky heartbeat, frame_max or channel_max per client", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("heartbeat-audit")
+		opts := SettingsAuditOptions{}
+		flags.IntVar(&opts.MaxHeartbeat, "max-heartbeat", defaultMaxHeartbeat, "longest acceptable heartbeat in seconds")
+		flags.IntVar(&opts.MaxFrame, "max-frame", defaultMaxFrame, "largest acceptable frame_max in bytes")
+		flags.IntVar(&opts.MaxChannelMax, "max-channel-max", defaultMaxChannelMax, "largest acceptable channel_max")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return ClientSettingsReport(AuditConnectionSettings(rabbitmq.info().Connections, opts)), nil
+	})
+}
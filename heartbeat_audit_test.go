@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditConnectionSettings(t *testing.T) {
+	conn := func(name string, product string, timeout int, frameMax int, channelMax int) rabtap.RabbitConnection {
+		c := rabtap.RabbitConnection{Name: name, Timeout: timeout, FrameMax: frameMax, ChannelMax: channelMax}
+		c.ClientProperties.Product = product
+		return c
+	}
+	connections := []rabtap.RabbitConnection{
+		conn("a", "pika", 0, 131072, 2047),
+		conn("b", "pika", 60, 131072, 0),
+		conn("c", "pika", 60, 131072, 2047),
+		conn("d", "amqp-client", 60, 131072, 2047),
+		conn("e", "", 900, 2048, 2047),
+	}
+	report := AuditConnectionSettings(connections, SettingsAuditOptions{MaxHeartbeat: 300, MaxFrame: 1 << 20, MaxChannelMax: 2047})
+	assert.Len(t, report, 2)
+	assert.Equal(t, ClientSettingsGroup{
+		Product: "pika", Connections: 3, Risky: 2,
+		Risks:      map[string]int{"heartbeat disabled": 1, "unlimited channel_max": 1},
+		Heartbeats: []int{0, 60}, Examples: []string{"a", "b"},
+	}, report[0])
+	assert.Equal(t, "unknown", report[1].Product)
+	assert.Equal(t, map[string]int{"long heartbeat": 1, "small frame_max": 1}, report[1].Risks)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// maxInterned strings kept by an Interner before it starts over, bounds
+// memory when names churn
+const maxInterned = 64 * 1024
+
+// Interner : deduplicates repeated strings so equal values share memory
+type Interner struct {
+	strings map[string]string
+}
+
+// NewInterner create an empty interner
+func NewInterner() *Interner {
+	return &Interner{strings: map[string]string{}}
+}
+
+// Intern the canonical copy of str
+func (interner *Interner) Intern(str string) string {
+	if str == "" {
+		return str
+	}
+	if canonical, ok := interner.strings[str]; ok {
+		return canonical
+	}
+	if len(interner.strings) >= maxInterned {
+		interner.strings = map[string]string{}
+	}
+	interner.strings[str] = str
+	return str
+}
+
+// Len number of distinct strings held
+func (interner *Interner) Len() int {
+	return len(interner.strings)
+}
+
+// CompactBrokerInfo intern the low cardinality fields repeated across
+// objects (vhosts, nodes, users, states, ...) and drop detail the views never
+// show. Names of queues, exchanges and connections are left alone, they
+// rarely repeat.
+func CompactBrokerInfo(info *rabtap.BrokerInfo, interner *Interner) {
+	in := interner.Intern
+	info.Overview.Node = in(info.Overview.Node)
+	for i := range info.Connections {
+		conn := &info.Connections[i]
+		conn.Vhost = in(conn.Vhost)
+		conn.User = in(conn.User)
+		conn.Node = in(conn.Node)
+		conn.Host = in(conn.Host)
+		conn.PeerHost = in(conn.PeerHost)
+		conn.Protocol = in(conn.Protocol)
+		conn.AuthMechanism = in(conn.AuthMechanism)
+		conn.Type = in(conn.Type)
+		conn.State = in(conn.State)
+		conn.ClientProperties.Product = in(conn.ClientProperties.Product)
+		conn.ClientProperties.Version = in(conn.ClientProperties.Version)
+		conn.ClientProperties.Platform = in(conn.ClientProperties.Platform)
+		// license blurb of the client library
+		conn.ClientProperties.Information = ""
+		if !conn.Ssl {
+			conn.PeerCertValidity = nil
+			conn.PeerCertIssuer = nil
+			conn.PeerCertSubject = nil
+		}
+	}
+	for i := range info.Exchanges {
+		exchange := &info.Exchanges[i]
+		exchange.Vhost = in(exchange.Vhost)
+		exchange.Type = in(exchange.Type)
+		exchange.Policy = in(exchange.Policy)
+	}
+	for i := range info.Queues {
+		queue := &info.Queues[i]
+		queue.Vhost = in(queue.Vhost)
+		queue.Node = in(queue.Node)
+		queue.State = in(queue.State)
+		queue.Policy = in(queue.Policy)
+	}
+	for i := range info.Consumers {
+		consumer := &info.Consumers[i]
+		consumer.Queue.Vhost = in(consumer.Queue.Vhost)
+		consumer.ChannelDetails.Node = in(consumer.ChannelDetails.Node)
+		consumer.ChannelDetails.User = in(consumer.ChannelDetails.User)
+		consumer.ChannelDetails.PeerHost = in(consumer.ChannelDetails.PeerHost)
+	}
+	for i := range info.Bindings {
+		binding := &info.Bindings[i]
+		binding.Vhost = in(binding.Vhost)
+		binding.Source = in(binding.Source)
+		binding.DestinationType = in(binding.DestinationType)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"unsafe"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func stringData(str string) uintptr {
+	return *(*uintptr)(unsafe.Pointer(&str))
+}
+
+func TestCompactBrokerInfo(t *testing.T) {
+	// build equal strings with distinct backing arrays
+	vhost := func() string { return string([]byte("production")) }
+	info := rabtap.BrokerInfo{
+		Queues:      []rabtap.RabbitQueue{{Name: "q1", Vhost: vhost()}, {Name: "q2", Vhost: vhost()}},
+		Connections: []rabtap.RabbitConnection{{Vhost: vhost()}},
+	}
+	info.Connections[0].ClientProperties.Information = "Licensed under the MPL"
+	assert.NotEqual(t, stringData(info.Queues[0].Vhost), stringData(info.Queues[1].Vhost))
+
+	interner := NewInterner()
+	CompactBrokerInfo(&info, interner)
+	assert.Equal(t, stringData(info.Queues[0].Vhost), stringData(info.Queues[1].Vhost))
+	assert.Equal(t, stringData(info.Queues[0].Vhost), stringData(info.Connections[0].Vhost))
+	assert.Equal(t, "production", info.Queues[1].Vhost)
+	assert.Equal(t, "", info.Connections[0].ClientProperties.Information)
+	assert.Equal(t, 1, interner.Len())
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+var jobsMutex sync.Mutex
+
+// startJob register a new long running job, the returned channel is
+// signalled when the job should stop
+func startJob(resID string) (string, chan bool) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	jobID := newUUID(resID)
+	kill := make(chan bool, 1)
+	subscriptions[jobID] = &kill
+	return jobID, kill
+}
+
+// stopAllJobs signal all running jobs to stop
+func stopAllJobs() {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	for jobID, kill := range subscriptions {
+		delete(subscriptions, jobID)
+		select {
+		case *kill <- true:
+		default:
+		}
+	}
+}
+
+// stopJob signal the job with the given id to stop
+func stopJob(jobID string) error {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	kill, ok := subscriptions[jobID]
+	if !ok {
+		return fmt.Errorf("job %s not found", jobID)
+	}
+	delete(subscriptions, jobID)
+	*kill <- true
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KVStore : small persistent key value store of the serve backend
+type KVStore interface {
+	// Get the value of key, false if it is not set
+	Get(key string) ([]byte, bool, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+	// Keys sorted keys starting with prefix
+	Keys(prefix string) ([]string, error)
+	Close() error
+}
+
+// OpenKVStore open the store at location: s3://bucket/prefix is a bucket,
+// see ParseS3Location, .db and .sqlite files are sqlite databases (builds
+// with -tags sqlite), everything else a json file
+func OpenKVStore(location string) (KVStore, error) {
+	if strings.HasPrefix(location, "s3://") {
+		target, err := ParseS3Location(location)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3KVStore(target), nil
+	}
+	if strings.HasSuffix(location, ".db") || strings.HasSuffix(location, ".sqlite") {
+		return OpenSQLiteKVStore(location)
+	}
+	return OpenFileKVStore(location)
+}
+
+// isStoreLocation true for locations OpenKVStore opens as bucket or
+// database rather than as plain file
+func isStoreLocation(location string) bool {
+	return strings.HasPrefix(location, "s3://") || strings.HasSuffix(location, ".db") || strings.HasSuffix(location, ".sqlite")
+}
+
+// getJSON decode the json value of key into v
+func getJSON(store KVStore, key string, v interface{}) (bool, error) {
+	data, ok, err := store.Get(key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// putJSON store v as json under key
+func putJSON(store KVStore, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return store.Put(key, data)
+}
+
+// FileKVStore : all keys in one json file, rewritten on every change. Values
+// must be json documents.
+type FileKVStore struct {
+	file   string
+	mutex  sync.Mutex
+	values map[string]json.RawMessage
+}
+
+// OpenFileKVStore read the json file, a missing file is an empty store
+func OpenFileKVStore(file string) (*FileKVStore, error) {
+	store := &FileKVStore{file: file, values: map[string]json.RawMessage{}}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.values); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Get the value of key
+func (store *FileKVStore) Get(key string) ([]byte, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	value, ok := store.values[key]
+	return value, ok, nil
+}
+
+// Put set key and write the file
+func (store *FileKVStore) Put(key string, value []byte) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.values[key] = append(json.RawMessage{}, value...)
+	return store.save()
+}
+
+// Delete remove key and write the file
+func (store *FileKVStore) Delete(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.values, key)
+	return store.save()
+}
+
+// Keys sorted keys starting with prefix
+func (store *FileKVStore) Keys(prefix string) ([]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	keys := []string{}
+	for key := range store.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close nothing to do, every change is written immediately
+func (store *FileKVStore) Close() error {
+	return nil
+}
+
+// save write the file through a temporary file, mutex must be held
+func (store *FileKVStore) save() error {
+	data, err := json.Marshal(store.values)
+	if err != nil {
+		return err
+	}
+	tmp := store.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, store.file)
+}
+
+// SQLiteKVStore : keys in a table of a sqlite database
+type SQLiteKVStore struct {
+	db *sql.DB
+}
+
+// errNoSQLite sqlite locations in a build without the sqlite driver
+var errNoSQLite = errors.New("sqlite is not supported by this build, rebuild with -tags sqlite")
+
+// sqliteSupported true when the sqlite3 driver is compiled in (-tags sqlite)
+func sqliteSupported() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite3" {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenSQLiteKVStore open or create the database and its kv table
+func OpenSQLiteKVStore(file string) (*SQLiteKVStore, error) {
+	if !sqliteSupported() {
+		return nil, errNoSQLite
+	}
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS kv (key TEXT PRIMARY KEY, value BLOB NOT NULL)`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteKVStore{db: db}, nil
+}
+
+// Get the value of key
+func (store *SQLiteKVStore) Get(key string) ([]byte, bool, error) {
+	var value []byte
+	err := store.db.QueryRow(`SELECT value FROM kv WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	return value, err == nil, err
+}
+
+// Put insert or replace key
+func (store *SQLiteKVStore) Put(key string, value []byte) error {
+	_, err := store.db.Exec(`INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)`, key, value)
+	return err
+}
+
+// Delete remove key
+func (store *SQLiteKVStore) Delete(key string) error {
+	_, err := store.db.Exec(`DELETE FROM kv WHERE key = ?`, key)
+	return err
+}
+
+// Keys sorted keys starting with prefix
+func (store *SQLiteKVStore) Keys(prefix string) ([]string, error) {
+	rows, err := store.db.Query(`SELECT key FROM kv WHERE substr(key, 1, ?) = ? ORDER BY key`, len(prefix), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Close the database
+func (store *SQLiteKVStore) Close() error {
+	return store.db.Close()
+}
+
+// ParseS3Location read s3://bucket/prefix?endpoint=url&region=r, the
+// credentials are taken from $RADISH_S3_ACCESS_KEY and
+// $RADISH_S3_SECRET_KEY and the endpoint defaults to $RADISH_S3_ENDPOINT
+// or aws
+func ParseS3Location(location string) (S3Target, error) {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return S3Target{}, err
+	}
+	if parsed.Scheme != "s3" || parsed.Host == "" {
+		return S3Target{}, fmt.Errorf("invalid s3 location %q, expected s3://bucket/prefix", location)
+	}
+	query := parsed.Query()
+	target := S3Target{
+		Endpoint:  query.Get("endpoint"),
+		Region:    query.Get("region"),
+		Bucket:    parsed.Host,
+		Prefix:    strings.TrimPrefix(parsed.Path, "/"),
+		AccessKey: os.Getenv("RADISH_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("RADISH_S3_SECRET_KEY"),
+	}
+	if target.Prefix != "" && !strings.HasSuffix(target.Prefix, "/") {
+		target.Prefix += "/"
+	}
+	if target.Endpoint == "" {
+		target.Endpoint = envOr("RADISH_S3_ENDPOINT", "https://s3.amazonaws.com")
+	}
+	return target, nil
+}
+
+// S3KVStore : one object per key in an s3 compatible bucket
+type S3KVStore struct {
+	client *S3Client
+}
+
+// NewS3KVStore keep the keys below the prefix of target
+func NewS3KVStore(target S3Target) *S3KVStore {
+	return &S3KVStore{client: NewS3Client(target)}
+}
+
+// Get the object of key
+func (store *S3KVStore) Get(key string) ([]byte, bool, error) {
+	value, err := store.client.GetObject(key)
+	if s3NotFound(err) {
+		return nil, false, nil
+	}
+	return value, err == nil, err
+}
+
+// Put upload key
+func (store *S3KVStore) Put(key string, value []byte) error {
+	return store.client.PutObject(key, value)
+}
+
+// Delete remove key, deleting a missing key is no error
+func (store *S3KVStore) Delete(key string) error {
+	if err := store.client.DeleteObject(key); err != nil && !s3NotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Keys sorted keys starting with prefix
+func (store *S3KVStore) Keys(prefix string) ([]string, error) {
+	return store.client.ListKeys(prefix)
+}
+
+// Close nothing to do, every change is uploaded immediately
+func (store *S3KVStore) Close() error {
+	return nil
+}
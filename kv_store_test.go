@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 : in memory bucket answering get, put, delete and list requests
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+func (s3 *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s3.mutex.Lock()
+	defer s3.mutex.Unlock()
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bucket"), "/")
+	switch {
+	case r.Method == "GET" && r.URL.Query().Get("list-type") == "2":
+		fmt.Fprint(w, "<ListBucketResult>")
+		for name := range s3.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", name)
+			}
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+	case r.Method == "GET":
+		data, ok := s3.objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case r.Method == "PUT":
+		s3.objects[key], _ = ioutil.ReadAll(r.Body)
+	case r.Method == "DELETE":
+		delete(s3.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestKVStores(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "kv")
+	defer os.RemoveAll(dir)
+	bucket := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	defer bucket.Close()
+	s3Location := "s3://bucket/radish?endpoint=" + url.QueryEscape(bucket.URL)
+	locations := []string{filepath.Join(dir, "store.json"), s3Location}
+	if sqliteSupported() {
+		locations = append(locations, filepath.Join(dir, "store.db"))
+	} else {
+		_, err := OpenKVStore(filepath.Join(dir, "store.db"))
+		assert.Equal(t, errNoSQLite, err)
+	}
+	for _, file := range locations {
+		location := file
+		store, err := OpenKVStore(location)
+		assert.Nil(t, err)
+		_, ok, err := store.Get("a")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		assert.Nil(t, store.Put("views/b", []byte(`{"n":1}`)))
+		assert.Nil(t, store.Put("views/a", []byte(`{"n":2}`)))
+		assert.Nil(t, store.Put("preferences/x", []byte(`{}`)))
+		keys, err := store.Keys("views/")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"views/a", "views/b"}, keys)
+		assert.Nil(t, store.Delete("views/a"))
+		assert.Nil(t, store.Close())
+
+		store, err = OpenKVStore(location)
+		assert.Nil(t, err)
+		value, ok, err := store.Get("views/b")
+		assert.Nil(t, err)
+		assert.True(t, ok, file)
+		assert.Equal(t, `{"n":1}`, string(value))
+		keys, _ = store.Keys("views/")
+		assert.Equal(t, []string{"views/b"}, keys)
+		store.Close()
+	}
+}
+
+func TestParseS3Location(t *testing.T) {
+	target, err := ParseS3Location("s3://backups/radish/prod?region=eu-west-1&endpoint=http://minio:9000")
+	assert.Nil(t, err)
+	assert.Equal(t, S3Target{Endpoint: "http://minio:9000", Region: "eu-west-1", Bucket: "backups", Prefix: "radish/prod/"}, target)
+	_, err = ParseS3Location("s3:///radish")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// thresholds of the lazy queue advisory
+const (
+	defaultLazyMessages = 100000
+	// lazyFastRate publish rate above which a lazy queue with a short
+	// backlog pays for disk writes it does not need
+	lazyFastRate     = 1000
+	lazyFastMessages = 1000
+)
+
+// versionAtLeast true when a rabbitmq version like 3.11.2 is at least
+// major.minor, unparsable versions count as recent
+func versionAtLeast(version string, major int, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return true
+	}
+	vMajor, err1 := strconv.Atoi(parts[0])
+	vMinor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return vMajor > major || (vMajor == major && vMinor >= minor)
+}
+
+// LazyAdvice : queue mode change recommended for a classic queue
+type LazyAdvice struct {
+	Vhost    string       `json:"vhost"`
+	Queue    string       `json:"queue"`
+	Mode     string       `json:"mode"`
+	Messages int64        `json:"messages"`
+	Rate     float64      `json:"rate"`
+	Reason   string       `json:"reason"`
+	Policy   RabbitPolicy `json:"policy"`
+}
+
+// lazyPolicy policy setting key to value for exactly one queue. A queue
+// only gets the definition of one policy, the current one is copied and
+// outranked so none of its settings are lost.
+func lazyPolicy(queue StorageQueue, key string, value interface{}, current map[string]RabbitPolicy) RabbitPolicy {
+	definition := map[string]interface{}{}
+	for k, v := range queue.EffectivePolicy {
+		definition[k] = v
+	}
+	definition[key] = value
+	policy := RabbitPolicy{
+		Vhost:      queue.Vhost,
+		Name:       "radish-" + key + "-" + queue.Name,
+		Pattern:    "^" + regexp.QuoteMeta(queue.Name) + "$",
+		ApplyTo:    "queues",
+		Definition: definition,
+	}
+	if existing, ok := current[queue.Vhost+"\x00"+queue.Policy]; ok {
+		policy.Priority = existing.Priority + 1
+	}
+	return policy
+}
+
+// AdviseLazyQueues find classic queues whose mode does not fit the broker
+// version or their workload. Before 3.12 large backlogs belong in lazy
+// queues, busy queues with short backlogs do not. From 3.12 queue-mode is
+// ignored and version 2 queues keep messages on disk instead.
+func AdviseLazyQueues(queues []StorageQueue, policies []RabbitPolicy, version string, minMessages int64) []LazyAdvice {
+	current := map[string]RabbitPolicy{}
+	for _, policy := range policies {
+		current[policy.Vhost+"\x00"+policy.Name] = policy
+	}
+	modern := versionAtLeast(version, 3, 12)
+	advice := []LazyAdvice{}
+	for _, queue := range queues {
+		if !queue.Classic() {
+			continue
+		}
+		mode, rate := queue.Mode(), queue.MessageStats.PublishDetails.Rate
+		item := LazyAdvice{Vhost: queue.Vhost, Queue: queue.Name, Mode: mode, Messages: queue.Messages, Rate: rate}
+		switch {
+		case modern && mode == "lazy" && fmt.Sprint(queue.EffectivePolicy["queue-version"]) != "2":
+			item.Reason = "queue-mode is ignored since 3.12, version 2 queues keep messages on disk"
+			item.Policy = lazyPolicy(queue, "queue-version", 2, current)
+		case modern:
+			continue
+		case mode != "lazy" && queue.Messages >= minMessages:
+			item.Reason = fmt.Sprintf("%d messages held by a %s mode queue", queue.Messages, mode)
+			item.Policy = lazyPolicy(queue, "queue-mode", "lazy", current)
+		case mode == "lazy" && queue.Messages < lazyFastMessages && rate > lazyFastRate:
+			item.Reason = fmt.Sprintf("lazy queue with a short backlog published at %.0f/s", rate)
+			item.Policy = lazyPolicy(queue, "queue-mode", "default", current)
+		default:
+			continue
+		}
+		advice = append(advice, item)
+	}
+	sort.Slice(advice, func(i, j int) bool { return advice[i].Messages > advice[j].Messages })
+	return advice
+}
+
+// LazyAdviceList : advice for all queues
+type LazyAdviceList []LazyAdvice
+
+// Table advice as table
+func (list LazyAdviceList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "QUEUE", "MODE", "MESSAGES", "PUBLISH", "REASON", "POLICY"}}
+	for _, advice := range list {
+		definition, _ := json.Marshal(advice.Policy.Definition)
+		table.Rows = append(table.Rows, []Cell{
+			{Text: advice.Vhost},
+			{Text: advice.Queue},
+			{Text: advice.Mode},
+			{Text: format.Count(advice.Messages)},
+			{Text: format.Rate(advice.Rate, "msg")},
+			{Text: advice.Reason, Color: Yellow},
+			{Text: advice.Policy.Name + " " + string(definition)},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("lazy-advice", "[--min-messages n] [--apply] [--yes] recommend queue modes and generate the policies setting them", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("lazy-advice")
+		minMessages := flags.Int64("min-messages", defaultLazyMessages, "backlog making a classic queue a lazy candidate")
+		apply := flags.Bool("apply", false, "create the generated policies")
+		yes := flags.Bool("yes", false, "apply without asking")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		queues, err := rabbitmq.management().QueueStorage()
+		if err != nil {
+			return nil, err
+		}
+		policies, err := rabbitmq.management().Policies()
+		if err != nil {
+			return nil, err
+		}
+		advice := LazyAdviceList(AdviseLazyQueues(queues, policies, rabbitmq.info().Overview.RabbitmqVersion, *minMessages))
+		if !*apply || len(advice) == 0 {
+			return advice, nil
+		}
+		if !*yes && !cli.confirm(fmt.Sprintf("create %d policies?", len(advice))) {
+			return advice, nil
+		}
+		for _, item := range advice {
+			if err := rabbitmq.management().PutPolicy(item.Policy); err != nil {
+				return advice, fmt.Errorf("policy %s: %s", item.Policy.Name, err)
+			}
+		}
+		return advice, nil
+	})
+}
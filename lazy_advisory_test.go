@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdviseLazyQueues(t *testing.T) {
+	fast := StorageQueue{Vhost: "/", Name: "fast", Messages: 10, EffectivePolicy: map[string]interface{}{"queue-mode": "lazy"}}
+	fast.MessageStats.PublishDetails.Rate = 5000
+	queues := []StorageQueue{
+		{Vhost: "/", Name: "orders.v1", Messages: 200000, Policy: "ttl",
+			EffectivePolicy: map[string]interface{}{"message-ttl": 60000}},
+		{Vhost: "/", Name: "small", Messages: 10},
+		{Vhost: "/", Name: "quorum", Type: "quorum", Messages: 500000},
+		fast,
+	}
+	policies := []RabbitPolicy{{Vhost: "/", Name: "ttl", Priority: 5}}
+
+	advice := AdviseLazyQueues(queues, policies, "3.11.20", 100000)
+	assert.Len(t, advice, 2)
+	assert.Equal(t, RabbitPolicy{
+		Vhost: "/", Name: "radish-queue-mode-orders.v1", Pattern: `^orders\.v1$`, ApplyTo: "queues",
+		Definition: map[string]interface{}{"message-ttl": 60000, "queue-mode": "lazy"}, Priority: 6,
+	}, advice[0].Policy)
+	assert.Equal(t, "default", advice[1].Policy.Definition["queue-mode"])
+
+	advice = AdviseLazyQueues(queues, policies, "3.12.1", 100000)
+	assert.Len(t, advice, 1)
+	assert.Equal(t, "fast", advice[0].Queue)
+	assert.Equal(t, 2, advice[0].Policy.Definition["queue-version"])
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	assert.True(t, versionAtLeast("3.12.0", 3, 12))
+	assert.True(t, versionAtLeast("4.0.1", 3, 12))
+	assert.False(t, versionAtLeast("3.9.29", 3, 12))
+	assert.True(t, versionAtLeast("", 3, 12))
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// control keys handled by the line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyCtrlK     = 11
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// LineEditor : reads lines from a terminal with cursor movement, kill keys
+// and history navigation, or line by line when the input is no terminal
+type LineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	// fd of the terminal, raw mode is only tried when it is >= 0
+	fd int
+}
+
+// NewLineEditor editor reading from in, fd the terminal in is connected to
+// or -1
+func NewLineEditor(in io.Reader, out io.Writer, fd int) *LineEditor {
+	return &LineEditor{in: bufio.NewReader(in), out: out, fd: fd}
+}
+
+// ReadLine read a line after showing prompt, up and down walk through
+// history. io.EOF is returned on end of input or ctrl-d on an empty line.
+func (editor *LineEditor) ReadLine(prompt string, history []string) (string, error) {
+	if editor.fd >= 0 {
+		if restore, err := makeRaw(editor.fd); err == nil {
+			defer restore()
+			return editor.readRaw(prompt, history)
+		}
+	}
+	fmt.Fprint(editor.out, prompt)
+	line, err := editor.in.ReadString('\n')
+	if err == io.EOF {
+		if line != "" {
+			err = nil
+		}
+		fmt.Fprintln(editor.out)
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// lineState : line being edited in raw mode
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+// redraw write the prompt and the line, leaving the cursor at pos
+func (state *lineState) redraw(out io.Writer) {
+	fmt.Fprintf(out, "\r%s%s\x1b[K", state.prompt, string(state.buf))
+	if back := len(state.buf) - state.pos; back > 0 {
+		fmt.Fprintf(out, "\x1b[%dD", back)
+	}
+}
+
+func (state *lineState) set(line string) {
+	state.buf = []rune(line)
+	state.pos = len(state.buf)
+}
+
+func (state *lineState) insert(r rune) {
+	state.buf = append(state.buf[:state.pos], append([]rune{r}, state.buf[state.pos:]...)...)
+	state.pos++
+}
+
+// remove delete the runes between from and to
+func (state *lineState) remove(from int, to int) {
+	state.buf = append(state.buf[:from], state.buf[to:]...)
+	state.pos = from
+}
+
+// wordStart position of the start of the word before the cursor
+func (state *lineState) wordStart() int {
+	i := state.pos
+	for i > 0 && unicode.IsSpace(state.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(state.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// readRaw edit a line in raw mode, the terminal does not echo and passes
+// every key on its own
+func (editor *LineEditor) readRaw(prompt string, history []string) (string, error) {
+	state := &lineState{prompt: prompt}
+	// index into history, len(history) is the line being typed
+	current, draft := len(history), ""
+	recall := func(index int) {
+		if index < 0 || index > len(history) || index == current {
+			return
+		}
+		if current == len(history) {
+			draft = string(state.buf)
+		}
+		current = index
+		if current == len(history) {
+			state.set(draft)
+		} else {
+			state.set(history[current])
+		}
+	}
+	state.redraw(editor.out)
+	for {
+		r, _, err := editor.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(editor.out, "\r\n")
+			if err == io.EOF && len(state.buf) > 0 {
+				return string(state.buf), nil
+			}
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(editor.out, "\r\n")
+			return string(state.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(editor.out, "^C\r\n")
+			state.set("")
+			current = len(history)
+		case keyCtrlD:
+			if len(state.buf) == 0 {
+				fmt.Fprint(editor.out, "\r\n")
+				return "", io.EOF
+			}
+			if state.pos < len(state.buf) {
+				state.remove(state.pos, state.pos+1)
+			}
+		case keyBackspace, keyCtrlH:
+			if state.pos > 0 {
+				state.remove(state.pos-1, state.pos)
+			}
+		case keyCtrlA:
+			state.pos = 0
+		case keyCtrlE:
+			state.pos = len(state.buf)
+		case keyCtrlB:
+			if state.pos > 0 {
+				state.pos--
+			}
+		case keyCtrlF:
+			if state.pos < len(state.buf) {
+				state.pos++
+			}
+		case keyCtrlK:
+			state.buf = state.buf[:state.pos]
+		case keyCtrlU:
+			state.remove(0, state.pos)
+		case keyCtrlW:
+			state.remove(state.wordStart(), state.pos)
+		case keyCtrlP:
+			recall(current - 1)
+		case keyCtrlN:
+			recall(current + 1)
+		case keyEscape:
+			switch editor.escapeSequence() {
+			case "A":
+				recall(current - 1)
+			case "B":
+				recall(current + 1)
+			case "C":
+				if state.pos < len(state.buf) {
+					state.pos++
+				}
+			case "D":
+				if state.pos > 0 {
+					state.pos--
+				}
+			case "H", "1~":
+				state.pos = 0
+			case "F", "4~":
+				state.pos = len(state.buf)
+			case "3~":
+				if state.pos < len(state.buf) {
+					state.remove(state.pos, state.pos+1)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				state.insert(r)
+			}
+		}
+		state.redraw(editor.out)
+	}
+}
+
+// escapeSequence read the rest of an escape sequence after ESC, e.g. "A"
+// for ESC [ A (up) or "3~" for ESC [ 3 ~ (delete)
+func (editor *LineEditor) escapeSequence() string {
+	r, _, err := editor.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+	var seq []rune
+	for {
+		r, _, err := editor.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, r)
+		if (r >= 'A' && r <= 'Z') || r == '~' {
+			return string(seq)
+		}
+	}
+}
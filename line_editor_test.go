@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineEditorRaw(t *testing.T) {
+	read := func(input string, history ...string) (string, error) {
+		var out bytes.Buffer
+		return NewLineEditor(strings.NewReader(input), &out, -1).readRaw("> ", history)
+	}
+	line, err := read("abc\x1b[D\x1b[DX\r")
+	assert.Nil(t, err)
+	assert.Equal(t, "aXbc", line)
+
+	line, _ = read("bc\x01a\x05d\r")
+	assert.Equal(t, "abcd", line)
+	line, _ = read("abd\x7fc\r")
+	assert.Equal(t, "abc", line)
+	line, _ = read("foo bar\x17baz\r")
+	assert.Equal(t, "foo baz", line)
+	line, _ = read("abc\x02\x02\x0b\r")
+	assert.Equal(t, "a", line)
+	line, _ = read("abc\x01\x1b[3~\r")
+	assert.Equal(t, "bc", line)
+	line, _ = read("x\x03y\r")
+	assert.Equal(t, "y", line)
+	line, _ = read("grüße\x7f\r")
+	assert.Equal(t, "grüß", line)
+
+	line, _ = read("\x1b[A\x1b[A\r", "ls", "info")
+	assert.Equal(t, "ls", line)
+	line, _ = read("\x1b[A\x1b[A\x1b[A\x1b[B\r", "ls", "info")
+	assert.Equal(t, "info", line)
+	line, _ = read("dra\x10\x0eft\r", "ls")
+	assert.Equal(t, "draft", line)
+
+	_, err = read("\x04")
+	assert.Equal(t, io.EOF, err)
+	line, err = read("ab\x01\x04\r")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", line)
+}
+
+func TestLineEditorPlain(t *testing.T) {
+	var out bytes.Buffer
+	editor := NewLineEditor(strings.NewReader("ls\r\nexit"), &out, -1)
+	line, err := editor.ReadLine("> ", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "ls", line)
+	line, err = editor.ReadLine("> ", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "exit", line)
+	_, err = editor.ReadLine("> ", nil)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "> > \n> \n", out.String())
+}
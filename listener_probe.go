@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultProbeTimeout time to wait for a listener to accept and handshake
+const defaultProbeTimeout = 5 * time.Second
+
+// ListenerProbe : reachability of a listener from this machine
+type ListenerProbe struct {
+	Node      string        `json:"node"`
+	Protocol  string        `json:"protocol"`
+	Address   string        `json:"address"`
+	Reachable bool          `json:"reachable"`
+	Latency   time.Duration `json:"latency"`
+	TLS       bool          `json:"tls"`
+	TLSError  string        `json:"tlsError,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// listenerAddress dial address of a listener, host replaces wildcard addresses
+func listenerAddress(ip string, port int, host string) string {
+	if isWildcardAddress(ip) {
+		ip = host
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// ProbeListener dial address and, for tls listeners, complete a handshake
+// verified with tlsConfig
+func ProbeListener(probe ListenerProbe, tlsConfig *tls.Config, timeout time.Duration) ListenerProbe {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", probe.Address, timeout)
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	defer conn.Close()
+	probe.Reachable = true
+	probe.Latency = time.Since(start)
+	if !probe.TLS {
+		return probe
+	}
+	config := &tls.Config{}
+	if tlsConfig != nil {
+		config = tlsConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(probe.Address)
+	}
+	tlsConn := tls.Client(conn, config)
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		probe.TLSError = err.Error()
+	}
+	return probe
+}
+
+// ProbeListeners probe every listener advertised in the overview, the
+// clustering listener is only probed with all set
+func ProbeListeners(overview rabtap.RabbitOverview, host string, tlsConfig *tls.Config, timeout time.Duration, all bool) []ListenerProbe {
+	probes := []ListenerProbe{}
+	for _, listener := range overview.Listeners {
+		if listener.Protocol == "clustering" && !all {
+			continue
+		}
+		probes = append(probes, ProbeListener(ListenerProbe{
+			Node:     listener.Node,
+			Protocol: listener.Protocol,
+			Address:  listenerAddress(listener.IPAddress, listener.Port, host),
+			TLS:      tlsListener(listener.Protocol),
+		}, tlsConfig, timeout))
+	}
+	return probes
+}
+
+// ListenerProbeList : listener probe results
+type ListenerProbeList []ListenerProbe
+
+// Table probe results as table
+func (list ListenerProbeList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"NODE", "PROTOCOL", "ADDRESS", "TCP", "LATENCY", "TLS"}}
+	for _, probe := range list {
+		tcp, tcpColor, latency := "ok", Green, probe.Latency.Round(time.Millisecond).String()
+		if !probe.Reachable {
+			tcp, tcpColor, latency = probe.Error, Red, "-"
+		}
+		handshake, tlsColor := "-", None
+		if probe.TLS && probe.Reachable {
+			handshake, tlsColor = "ok", Green
+			if probe.TLSError != "" {
+				handshake, tlsColor = probe.TLSError, Red
+			}
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: probe.Node},
+			{Text: probe.Protocol},
+			{Text: probe.Address},
+			{Text: tcp, Color: tcpColor},
+			{Text: latency},
+			{Text: handshake, Color: tlsColor},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("probe-listeners", "[--timeout d] [--all] check every advertised listener is reachable from here", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("probe-listeners")
+		timeout := flags.Duration("timeout", defaultProbeTimeout, "connect and handshake timeout")
+		all := flags.Bool("all", false, "include the clustering listener")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		probes := ProbeListeners(rabbitmq.info().Overview, rabbitmq.currentTarget().Host, rabbitmq.tlsConfig, *timeout, *all)
+		failed := 0
+		for _, probe := range probes {
+			if !probe.Reachable || probe.TLSError != "" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return ListenerProbeList(probes), thresholdError("%d of %d listeners failed", failed, len(probes))
+		}
+		return ListenerProbeList(probes), nil
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeListener(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	tlsTS := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsTS.Close()
+
+	addr := strings.TrimPrefix(ts.URL, "http://")
+	probe := ProbeListener(ListenerProbe{Address: addr}, nil, time.Second)
+	assert.True(t, probe.Reachable)
+	assert.Equal(t, "", probe.Error)
+
+	// self signed certificate, the handshake fails verification
+	tlsAddr := strings.TrimPrefix(tlsTS.URL, "https://")
+	probe = ProbeListener(ListenerProbe{Address: tlsAddr, TLS: true}, nil, time.Second)
+	assert.True(t, probe.Reachable)
+	assert.NotEqual(t, "", probe.TLSError)
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := listener.Addr().String()
+	listener.Close()
+	probe = ProbeListener(ListenerProbe{Address: closedAddr}, nil, time.Second)
+	assert.False(t, probe.Reachable)
+	assert.NotEqual(t, "", probe.Error)
+}
+
+func TestListenerAddress(t *testing.T) {
+	assert.Equal(t, "mq:5672", listenerAddress("::", 5672, "mq"))
+	assert.Equal(t, "10.0.0.1:5671", listenerAddress("10.0.0.1", 5671, "mq"))
+	assert.Equal(t, "[fe80::1]:5672", listenerAddress("fe80::1", 5672, "mq"))
+}
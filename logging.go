@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogOptions : logging configuration
+type LogOptions struct {
+	// Level is one of debug, info, warn or error
+	Level string `json:"level"`
+	// Format is text or json
+	Format string `json:"format"`
+	// Verbose enables debug logs including every management api request
+	Verbose bool `json:"verbose"`
+}
+
+// ConfigureLogging apply the logging options to the shared logger
+func ConfigureLogging(opts LogOptions) error {
+	level := logrus.InfoLevel
+	if opts.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(opts.Level); err != nil {
+			return err
+		}
+	}
+	if opts.Verbose {
+		level = logrus.DebugLevel
+	}
+	log.SetLevel(level)
+	log.SetOutput(os.Stderr)
+
+	switch opts.Format {
+	case "", "text":
+		log.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	case "json":
+		log.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %s", opts.Format)
+	}
+	return nil
+}
+
+// subsystemLog logger tagged with the subsystem emitting the logs
+func subsystemLog(name string) *logrus.Entry {
+	return log.WithField("subsystem", name)
+}
@@ -3,12 +3,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	logger "log"
 	"net"
 	"net/http"
 	"os"
-	"os/signal"
 	"runtime"
 
 	"github.com/zserge/lorca"
@@ -22,6 +22,11 @@ var uiErr error
 var ui lorca.UI
 
 func main() {
+	// any argument switches to the command line mode
+	if len(os.Args) > 1 {
+		os.Exit(RunCLI(os.Args[1:]))
+	}
+
 	args := []string{}
 	if runtime.GOOS == "linux" {
 		args = append(args, "--class=Lorca")
@@ -43,16 +48,29 @@ func main() {
 		logger.Fatal(err)
 	}
 	defer ln.Close()
-	go http.Serve(ln, http.FileServer(FS))
+	srv := &http.Server{Handler: NewSPAHandler(staticFiles)}
+	go srv.Serve(ln)
 	ui.Load(fmt.Sprintf("http://%s", ln.Addr()))
 
+	onShutdown("http server", srv.Shutdown)
+	onShutdown("jobs", func(ctx context.Context) error {
+		stopAllJobs()
+		return nil
+	})
+	onShutdown("rabbitmq", func(ctx context.Context) error {
+		if rabbitmq == nil {
+			return nil
+		}
+		return rabbitmq.Close()
+	})
+
 	// Wait until the interrupt signal arrives or browser window is closed
-	sigc := make(chan os.Signal)
-	signal.Notify(sigc, os.Interrupt)
+	sigc := shutdownSignals()
 	select {
 	case <-sigc:
 	case <-ui.Done():
 	}
 
 	logger.Println("exiting...")
+	runShutdownHooks(defaultShutdownTimeout)
 }
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// defaultMaintenanceFile maintenance windows of the maintenance command
+const defaultMaintenanceFile = "radish-maintenance.yml"
+
+// maintenance window actions
+const (
+	MaintenanceSuppress = "suppress"
+	MaintenanceAnnotate = "annotate"
+)
+
+// MaintenanceWindow : planned work during which alerts and churn reports
+// are suppressed or annotated. Scheduled windows start when their cron
+// schedule fires and last Duration, ad-hoc ones last from Start to End, an
+// open end lasts until the window is stopped.
+type MaintenanceWindow struct {
+	Name     string        `yaml:"name" json:"name"`
+	Schedule string        `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	Duration time.Duration `yaml:"duration,omitempty" json:"duration,omitempty"`
+	Start    *time.Time    `yaml:"start,omitempty" json:"start,omitempty"`
+	End      *time.Time    `yaml:"end,omitempty" json:"end,omitempty"`
+	// Vhosts the window covers, all when empty
+	Vhosts []string `yaml:"vhosts,omitempty" json:"vhosts,omitempty"`
+	// Action suppress or annotate, defaults to suppress
+	Action   string `yaml:"action,omitempty" json:"action,omitempty"`
+	Reason   string `yaml:"reason,omitempty" json:"reason,omitempty"`
+	schedule CronSchedule
+}
+
+// compile validate the window and parse its schedule
+func (window *MaintenanceWindow) compile() error {
+	if window.Name == "" {
+		return fmt.Errorf("maintenance window without name")
+	}
+	switch window.Action {
+	case "":
+		window.Action = MaintenanceSuppress
+	case MaintenanceSuppress, MaintenanceAnnotate:
+	default:
+		return fmt.Errorf("maintenance window %s: unknown action %q, expected suppress or annotate", window.Name, window.Action)
+	}
+	if (window.Schedule == "") == (window.Start == nil) {
+		return fmt.Errorf("maintenance window %s: expected either a schedule or a start", window.Name)
+	}
+	if window.Schedule == "" {
+		return nil
+	}
+	if window.Duration <= 0 {
+		return fmt.Errorf("maintenance window %s: a schedule needs a duration", window.Name)
+	}
+	var err error
+	window.schedule, err = ParseCronSchedule(window.Schedule)
+	return err
+}
+
+// ActiveAt the window is in effect at now
+func (window MaintenanceWindow) ActiveAt(now time.Time) bool {
+	if window.Schedule != "" {
+		// a start within the duration before now
+		start := window.schedule.Next(now.Add(-window.Duration))
+		return !start.IsZero() && !start.After(now)
+	}
+	return window.Start != nil && !now.Before(*window.Start) && (window.End == nil || now.Before(*window.End))
+}
+
+// Covers the window applies to objects of vhost
+func (window MaintenanceWindow) Covers(vhost string) bool {
+	return len(window.Vhosts) == 0 || vhost == "" || contains(window.Vhosts, vhost)
+}
+
+// Maintenance : the maintenance windows file
+type Maintenance struct {
+	Windows []MaintenanceWindow `yaml:"windows" json:"windows"`
+}
+
+// LoadMaintenance read a maintenance file, a missing file has no windows
+func LoadMaintenance(file string) (Maintenance, error) {
+	var maintenance Maintenance
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return maintenance, nil
+	}
+	if err != nil {
+		return maintenance, err
+	}
+	if err := yaml.Unmarshal(data, &maintenance); err != nil {
+		return maintenance, fmt.Errorf("%s: %s", file, err)
+	}
+	if err := maintenance.compile(); err != nil {
+		return maintenance, fmt.Errorf("%s: %s", file, err)
+	}
+	return maintenance, nil
+}
+
+// compile every window, names must be unique
+func (maintenance Maintenance) compile() error {
+	names := map[string]bool{}
+	for i := range maintenance.Windows {
+		if err := maintenance.Windows[i].compile(); err != nil {
+			return err
+		}
+		if names[maintenance.Windows[i].Name] {
+			return fmt.Errorf("duplicate maintenance window %s", maintenance.Windows[i].Name)
+		}
+		names[maintenance.Windows[i].Name] = true
+	}
+	return nil
+}
+
+// Save write the maintenance file
+func (maintenance Maintenance) Save(file string) error {
+	data, err := yaml.Marshal(maintenance)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// Active the windows in effect at now
+func (maintenance Maintenance) Active(now time.Time) []MaintenanceWindow {
+	active := []MaintenanceWindow{}
+	for _, window := range maintenance.Windows {
+		if window.ActiveAt(now) {
+			active = append(active, window)
+		}
+	}
+	return active
+}
+
+// Covering the window in effect for vhost at now, suppressing windows
+// take precedence over annotating ones
+func (maintenance Maintenance) Covering(vhost string, now time.Time) (MaintenanceWindow, bool) {
+	found, ok := MaintenanceWindow{}, false
+	for _, window := range maintenance.Active(now) {
+		if !window.Covers(vhost) {
+			continue
+		}
+		if !ok || (window.Action == MaintenanceSuppress && found.Action != MaintenanceSuppress) {
+			found, ok = window, true
+		}
+	}
+	return found, ok
+}
+
+// StartWindow add an ad-hoc window from now, lasting duration or until it
+// is stopped when duration is 0
+func (maintenance *Maintenance) StartWindow(window MaintenanceWindow, duration time.Duration, now time.Time) (MaintenanceWindow, error) {
+	for _, existing := range maintenance.Windows {
+		if existing.Name != window.Name {
+			continue
+		}
+		if existing.Schedule != "" {
+			return window, fmt.Errorf("maintenance window %s is scheduled", window.Name)
+		}
+		if existing.ActiveAt(now) {
+			return window, fmt.Errorf("maintenance window %s is already active", window.Name)
+		}
+	}
+	start := now
+	window.Start = &start
+	window.Schedule = ""
+	if duration > 0 {
+		end := now.Add(duration)
+		window.End = &end
+	}
+	if err := window.compile(); err != nil {
+		return window, err
+	}
+	maintenance.Windows = append(maintenance.removeWindow(window.Name), window)
+	return window, nil
+}
+
+// StopWindow remove the ad-hoc window name, false when there is none
+func (maintenance *Maintenance) StopWindow(name string) bool {
+	for i, window := range maintenance.Windows {
+		if window.Name == name && window.Schedule == "" {
+			maintenance.Windows = append(maintenance.Windows[:i], maintenance.Windows[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// removeWindow the windows without name
+func (maintenance Maintenance) removeWindow(name string) []MaintenanceWindow {
+	windows := []MaintenanceWindow{}
+	for _, window := range maintenance.Windows {
+		if window.Name != name {
+			windows = append(windows, window)
+		}
+	}
+	return windows
+}
+
+// MaintenanceStatus : a window and whether it is in effect
+type MaintenanceStatus struct {
+	MaintenanceWindow
+	Active bool `json:"active"`
+}
+
+// MaintenanceList : the windows of the maintenance file
+type MaintenanceList []MaintenanceStatus
+
+// ListMaintenance the windows with their state at now, active ones first
+func ListMaintenance(maintenance Maintenance, now time.Time) MaintenanceList {
+	list := MaintenanceList{}
+	for _, window := range maintenance.Windows {
+		list = append(list, MaintenanceStatus{MaintenanceWindow: window, Active: window.ActiveAt(now)})
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Active && !list[j].Active })
+	return list
+}
+
+// Table one row per window, active ones in yellow
+func (list MaintenanceList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"NAME", "ACTIVE", "ACTION", "WHEN", "VHOSTS", "REASON"}}
+	for _, status := range list {
+		when := ""
+		switch {
+		case status.Schedule != "":
+			when = fmt.Sprintf("%s for %s", status.Schedule, status.Duration)
+		case status.End != nil:
+			when = fmt.Sprintf("%s - %s", status.Start.Format(time.RFC3339), status.End.Format(time.RFC3339))
+		default:
+			when = status.Start.Format(time.RFC3339) + " until stopped"
+		}
+		active := Cell{Text: "no"}
+		if status.Active {
+			active = Cell{Text: "yes", Color: Yellow}
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: status.Name},
+			active,
+			{Text: status.Action},
+			{Text: when},
+			{Text: orDash(strings.Join(status.Vhosts, ","))},
+			{Text: orDash(status.Reason)},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("maintenance", "[--file f] list | start [--duration d] [--vhosts v,...] [--annotate] [--reason r] <name> | stop <name> manage maintenance windows", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("maintenance")
+		file := flags.String("file", envOr("RADISH_MAINTENANCE", defaultMaintenanceFile), "maintenance windows file")
+		duration := flags.Duration("duration", 0, "length of a started window, 0 lasts until stopped")
+		vhosts := flags.String("vhosts", "", "vhosts the started window covers, empty for all")
+		annotate := flags.Bool("annotate", false, "annotate alerts and churn reports instead of suppressing them")
+		reason := flags.String("reason", "", "why the window was started")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		maintenance, err := LoadMaintenance(*file)
+		if err != nil {
+			return nil, usageError("maintenance: %s", err)
+		}
+		now := time.Now()
+		action := "list"
+		if flags.NArg() > 0 {
+			action = flags.Arg(0)
+		}
+		switch action {
+		case "list":
+			return ListMaintenance(maintenance, now), nil
+		case "start", "stop":
+			if flags.NArg() != 2 {
+				return nil, usageError("maintenance %s: expected a window name", action)
+			}
+		default:
+			return nil, usageError("maintenance: unknown action %s, expected list, start or stop", action)
+		}
+		name := flags.Arg(1)
+		if action == "stop" {
+			if !maintenance.StopWindow(name) {
+				return nil, usageError("maintenance stop: no started window %q", name)
+			}
+		} else {
+			window := MaintenanceWindow{Name: name, Vhosts: splitList(*vhosts), Action: MaintenanceSuppress, Reason: *reason}
+			if *annotate {
+				window.Action = MaintenanceAnnotate
+			}
+			if _, err := maintenance.StartWindow(window, *duration, now); err != nil {
+				return nil, usageError("maintenance start: %s", err)
+			}
+		}
+		if err := maintenance.Save(*file); err != nil {
+			return nil, err
+		}
+		return ListMaintenance(maintenance, now), nil
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "maintenance")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "maintenance.yml")
+	ioutil.WriteFile(file, []byte("windows:\n- name: deploys\n  schedule: \"0 2 * * *\"\n  duration: 1h\n  vhosts: [billing]\n- name: patching\n  schedule: \"30 3 * * *\"\n  duration: 30m\n  action: annotate\n"), 0644)
+	maintenance, err := LoadMaintenance(file)
+	assert.Nil(t, err)
+
+	night := time.Date(2020, 1, 1, 2, 30, 0, 0, time.Local)
+	window, ok := maintenance.Covering("billing", night)
+	assert.True(t, ok)
+	assert.Equal(t, "deploys", window.Name)
+	_, ok = maintenance.Covering("orders", night)
+	assert.False(t, ok)
+	_, ok = maintenance.Covering("billing", night.Add(45*time.Minute))
+	assert.False(t, ok)
+	window, _ = maintenance.Covering("orders", night.Add(time.Hour+5*time.Minute))
+	assert.Equal(t, MaintenanceAnnotate, window.Action)
+
+	started, err := maintenance.StartWindow(MaintenanceWindow{Name: "hotfix"}, time.Hour, night)
+	assert.Nil(t, err)
+	assert.Equal(t, MaintenanceSuppress, started.Action)
+	_, err = maintenance.StartWindow(MaintenanceWindow{Name: "hotfix"}, 0, night)
+	assert.NotNil(t, err)
+	_, err = maintenance.StartWindow(MaintenanceWindow{Name: "deploys"}, 0, night)
+	assert.NotNil(t, err)
+	assert.Nil(t, maintenance.Save(file))
+	maintenance, err = LoadMaintenance(file)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(maintenance.Active(night.Add(10*time.Minute))))
+	assert.True(t, maintenance.StopWindow("hotfix"))
+	assert.False(t, maintenance.StopWindow("deploys"))
+
+	for _, config := range []string{
+		"windows:\n- name: x\n",
+		"windows:\n- name: x\n  schedule: \"0 2 * * *\"\n",
+		"windows:\n- name: x\n  schedule: \"0 2 * * *\"\n  duration: 1h\n  action: drop\n",
+	} {
+		ioutil.WriteFile(file, []byte(config), 0644)
+		_, err := LoadMaintenance(file)
+		assert.NotNil(t, err, config)
+	}
+	missing, err := LoadMaintenance(filepath.Join(dir, "missing.yml"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(missing.Windows))
+}
+
+func TestAlertsInMaintenance(t *testing.T) {
+	rules := AlertRules{Rules: []AlertRule{{Name: "backlog", Resource: ResourceQueues, Filter: "messages>0"}}}
+	assert.Nil(t, rules.compile())
+	engine := NewAlertEngine(rules, nil)
+	now := time.Now()
+	var maintenance Maintenance
+	maintenance.StartWindow(MaintenanceWindow{Name: "deploy"}, time.Minute, now)
+	engine.SetMaintenance(maintenance)
+
+	changes := engine.Evaluate(&Snapshot{Info: reportInfo()}, now)
+	assert.True(t, len(changes) > 0)
+	for _, change := range changes {
+		assert.True(t, change.Alert.Suppressed)
+		assert.Equal(t, "deploy", change.Alert.Maintenance)
+	}
+	assert.Equal(t, 0, len(engine.Evaluate(&Snapshot{Info: reportInfo()}, now.Add(time.Second))))
+	assert.Equal(t, 1, len(engine.Maintenance(now)))
+
+	// still firing after the window, notified then
+	released := engine.Evaluate(&Snapshot{Info: reportInfo()}, now.Add(2*time.Minute))
+	assert.Equal(t, len(changes), len(released))
+	assert.Equal(t, "fired", released[0].Type)
+	assert.False(t, released[0].Alert.Suppressed)
+	assert.Equal(t, "deploy", released[0].Alert.Maintenance)
+
+	churn := QueueChurnList{{Pattern: "b/x-*", Vhost: "b"}, {Pattern: "o/x-*", Vhost: "o"}}
+	maintenance = Maintenance{}
+	maintenance.StartWindow(MaintenanceWindow{Name: "b", Vhosts: []string{"b"}}, 0, now)
+	maintenance.StartWindow(MaintenanceWindow{Name: "o", Vhosts: []string{"o"}, Action: MaintenanceAnnotate}, 0, now)
+	list := churn.InMaintenance(maintenance, now)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, "o", list[0].Maintenance)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ManagementClient talks to the rabbitmq management api for the resources
+// the rabtap rest client does not expose
+type ManagementClient struct {
+	url    *url.URL
+	client *http.Client
+	// scope objects listed and written are limited to
+	scope Scope
+	// readOnly refuse every request modifying the broker with ErrReadOnly
+	readOnly bool
+}
+
+// NewManagementClient create a client for the management api at uri
+func NewManagementClient(uri *url.URL, tlsConfig *tls.Config) *ManagementClient {
+	return &ManagementClient{
+		url: uri,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+}
+
+// managementPath the api path of the segments, each one percent-encoded so
+// vhosts like "/" and names with spaces or slashes stay a single segment
+func managementPath(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+	return strings.Join(escaped, "/")
+}
+
+func (client *ManagementClient) endpoint(path string) string {
+	return strings.TrimSuffix(client.url.String(), "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// request send a request to the management api, body is json encoded when set.
+// Responses with a non 2xx status are turned into errors.
+func (client *ManagementClient) request(method string, path string, body interface{}, header http.Header) (*http.Response, error) {
+	return client.requestContext(context.Background(), method, path, body, header)
+}
+
+// requestContext like request, the request is aborted when ctx is done
+func (client *ManagementClient) requestContext(ctx context.Context, method string, path string, body interface{}, header http.Header) (*http.Response, error) {
+	if client.readOnly && !readOnlyRequest(method, path) {
+		return nil, ErrReadOnly
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, client.endpoint(path), reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	start := time.Now()
+	res, err := client.client.Do(req)
+	if err != nil {
+		subsystemLog("client").WithError(err).Debugf("%s %s failed", method, path)
+		return nil, err
+	}
+	subsystemLog("client").WithFields(logrus.Fields{
+		"status":   res.StatusCode,
+		"duration": time.Since(start).String(),
+	}).Debugf("%s %s", method, path)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, &ManagementError{Code: res.StatusCode, msg: fmt.Sprintf("%s %s: %s", method, path, res.Status)}
+	}
+	return res, nil
+}
+
+// ManagementError : a request answered with an error status
+type ManagementError struct {
+	Code int
+	msg  string
+}
+
+func (err *ManagementError) Error() string {
+	return err.msg
+}
+
+// get fetch path from the management api and decode the json result
+func (client *ManagementClient) get(path string, result interface{}) error {
+	return client.getContext(context.Background(), path, result)
+}
+
+// getContext like get, the request is aborted when ctx is done
+func (client *ManagementClient) getContext(ctx context.Context, path string, result interface{}) error {
+	res, err := client.requestContext(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// getRaw fetch path from the management api without decoding it
+func (client *ManagementClient) getRaw(path string) ([]byte, error) {
+	res, err := client.request("GET", path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// put send body as json to path
+func (client *ManagementClient) put(path string, body interface{}) error {
+	res, err := client.request("PUT", path, body, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// delete remove the resource at path
+func (client *ManagementClient) delete(path string) error {
+	res, err := client.request("DELETE", path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// postResult send body as json to path and decode the json answer
+func (client *ManagementClient) postResult(path string, body interface{}, result interface{}) error {
+	res, err := client.request("POST", path, body, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// post send body as json to path
+func (client *ManagementClient) post(path string, body interface{}) error {
+	res, err := client.request("POST", path, body, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagementPath(t *testing.T) {
+	assert.Equal(t, "queues/%2F/orders", managementPath("queues", "/", "orders"))
+	assert.Equal(t, "queues/my%20vhost/a%2Fb%20c/contents", managementPath("queues", "my vhost", "a/b c", "contents"))
+	assert.Equal(t, "queues/quorum/%2F/q", objectPath("queues/quorum", "/", "q"))
+
+	var calls []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.EscapedPath())
+		if r.Method == "GET" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+	client := NewManagementClient(uri, nil)
+
+	assert.Nil(t, client.PurgeQueue("/", "orders/eu"))
+	assert.Nil(t, client.CloseConnection("10.0.0.1:5672 -> 10.0.0.2:5672", ""))
+	_, err := client.ConnectionChannels("10.0.0.1:5672 -> 10.0.0.2:5672")
+	assert.Nil(t, err)
+	assert.Nil(t, client.DeleteUser("ops team"))
+	assert.Equal(t, []string{
+		"DELETE /api/queues/%2F/orders%2Feu/contents",
+		"DELETE /api/connections/10.0.0.1:5672%20-%3E%2010.0.0.2:5672",
+		"GET /api/connections/10.0.0.1:5672%20-%3E%2010.0.0.2:5672/channels",
+		"DELETE /api/users/ops%20team",
+	}, calls)
+}
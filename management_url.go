@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// managementPorts default management port by scheme
+var managementPorts = map[string]string{"http": "15672", "https": "15671"}
+
+// amqpManagementPorts management port of the default amqp ports
+var amqpManagementPorts = map[string]string{"5672": "15672", "5671": "15671"}
+
+// credentialParams query parameters users put credentials in by mistake
+var credentialParams = []string{"user", "username", "password", "pass", "passwd"}
+
+// ParseManagementURL normalize the management api base of a broker given
+// as http, https, amqp or amqps uri, or as host:port. amqp uris point to
+// the management listener of the same host, the vhost is dropped. The path
+// ends in /api: a missing /api is added after a reverse proxy prefix, which
+// may hold an api segment of its own, and ui urls like /#/queues are cut
+// back to it.
+func ParseManagementURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("management url is empty")
+	}
+	bare := !strings.Contains(raw, "://")
+	if bare {
+		scheme := "http"
+		if strings.Contains(raw, ":15671") {
+			scheme = "https"
+		}
+		raw = scheme + "://" + raw
+	}
+	uri, err := url.Parse(raw)
+	if err != nil {
+		if strings.Contains(raw, "@") {
+			return nil, fmt.Errorf("management url %s: %s, escape special characters of the user and password, like %%2F for /, %%40 for @ and %%3A for :", redactURL(raw), unwrapURLError(err))
+		}
+		return nil, fmt.Errorf("management url %s: %s", redactURL(raw), unwrapURLError(err))
+	}
+	switch uri.Scheme {
+	case "http", "https":
+	case "amqp", "amqps":
+		uri.Scheme = map[string]string{"amqp": "http", "amqps": "https"}[uri.Scheme]
+		port, ok := amqpManagementPorts[uri.Port()]
+		if uri.Port() != "" && !ok {
+			return nil, fmt.Errorf("management url %s: the management port of amqp port %s is unknown, give the http url of the management plugin instead", redactURL(uri.String()), uri.Port())
+		}
+		if ok {
+			uri.Host = net.JoinHostPort(uri.Hostname(), port)
+		}
+		bare = true
+		// the path of an amqp uri is the vhost
+		uri.Path, uri.RawPath = "", ""
+	default:
+		return nil, fmt.Errorf("management url %s: scheme must be http, https, amqp or amqps", redactURL(uri.String()))
+	}
+	if uri.Hostname() == "" {
+		return nil, fmt.Errorf("management url %s: missing host", redactURL(uri.String()))
+	}
+	// a bare host is the broker, web servers in front of it have a scheme
+	if bare && uri.Port() == "" {
+		uri.Host = net.JoinHostPort(uri.Hostname(), managementPorts[uri.Scheme])
+	}
+	if uri.User != nil && uri.User.Username() == "" {
+		return nil, fmt.Errorf("management url %s: password without user, expected %s://user:password@%s", redactURL(uri.String()), uri.Scheme, uri.Host)
+	}
+	query := uri.Query()
+	for _, param := range credentialParams {
+		if query.Get(param) != "" {
+			return nil, fmt.Errorf("management url %s: credentials go before the host, like %s://user:password@%s, or into --user and --password", redactURL(raw), uri.Scheme, uri.Host)
+		}
+	}
+	uri.RawQuery, uri.Fragment = "", ""
+	path := strings.TrimSuffix(strings.TrimSuffix(uri.Path, "/"), "/api")
+	uri.Path, uri.RawPath = path+"/api", ""
+	return uri, nil
+}
+
+// redactURL raw with its password masked, also when it does not parse
+func redactURL(raw string) string {
+	if uri, err := url.Parse(raw); err == nil {
+		if _, ok := uri.User.Password(); ok {
+			uri.User = url.UserPassword(uri.User.Username(), "xxxxx")
+		}
+		return uri.String()
+	}
+	start := strings.Index(raw, "://") + 3
+	at := strings.LastIndex(raw, "@")
+	if start < 3 || at < start {
+		return raw
+	}
+	if colon := strings.Index(raw[start:at], ":"); colon >= 0 {
+		return raw[:start+colon+1] + "xxxxx" + raw[at:]
+	}
+	return raw
+}
+
+// unwrapURLError the reason of a parse error without the url, which may
+// hold a password
+func unwrapURLError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return err
+}
+
+// managementURLError explain the common failures of a first request to
+// the management api at base: a url missing the management plugin and a
+// url answered by something else than the api
+func managementURLError(base *url.URL, err error) error {
+	if mgmtErr, ok := err.(*ManagementError); ok {
+		switch mgmtErr.Code {
+		case http.StatusNotFound:
+			return fmt.Errorf("%s: no management api at %s, the url must point to the management plugin (port %s by default) including any reverse proxy prefix, /api is appended to it",
+				err, redactURL(base.String()), managementPorts[base.Scheme])
+		case http.StatusUnauthorized:
+			return fmt.Errorf("%s: the broker at %s rejected the credentials, check --user and --password or the user:password@ part of the url", err, redactURL(base.String()))
+		}
+	}
+	if _, ok := err.(*json.SyntaxError); ok {
+		return fmt.Errorf("%s answered with something else than json (%s), is it the management ui instead of the api?", redactURL(base.String()), err)
+	}
+	return err
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ManifestExchange : exchange to create
+type ManifestExchange struct {
+	Vhost      string                 `json:"vhost"`
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Internal   bool                   `json:"internal"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// ManifestQueue : queue to create
+type ManifestQueue struct {
+	Vhost      string                 `json:"vhost"`
+	Name       string                 `json:"name"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// ManifestBinding : binding to create
+type ManifestBinding struct {
+	Vhost           string                 `json:"vhost"`
+	Source          string                 `json:"source"`
+	Destination     string                 `json:"destination"`
+	DestinationType string                 `json:"destination_type"`
+	RoutingKey      string                 `json:"routing_key"`
+	Arguments       map[string]interface{} `json:"arguments"`
+}
+
+// Manifest : objects to create in bulk
+type Manifest struct {
+	Exchanges []ManifestExchange `json:"exchanges"`
+	Queues    []ManifestQueue    `json:"queues"`
+	Bindings  []ManifestBinding  `json:"bindings"`
+}
+
+// LoadManifest read a manifest from a .json or .csv file
+func LoadManifest(path string) (Manifest, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		f, err := os.Open(path)
+		if err != nil {
+			return Manifest{}, err
+		}
+		defer f.Close()
+		return ParseCSVManifest(f)
+	}
+	var manifest Manifest
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
+
+// ParseCSVManifest parse a csv manifest. The header names the columns, the
+// kind column selects exchange, queue or binding for every row. Known columns
+// are kind, vhost, name, type, durable, auto_delete, internal, source,
+// destination, destination_type and routing_key.
+func ParseCSVManifest(r io.Reader) (Manifest, error) {
+	var manifest Manifest
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return manifest, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return manifest, nil
+		}
+		if err != nil {
+			return manifest, err
+		}
+		line++
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		flag := func(name string, def bool) bool {
+			if v, err := strconv.ParseBool(field(name)); err == nil {
+				return v
+			}
+			return def
+		}
+		vhost := ResolveVhost(field("vhost"), "")
+		switch field("kind") {
+		case "exchange":
+			manifest.Exchanges = append(manifest.Exchanges, ManifestExchange{
+				Vhost: vhost, Name: field("name"), Type: field("type"),
+				Durable: flag("durable", true), AutoDelete: flag("auto_delete", false), Internal: flag("internal", false),
+			})
+		case "queue":
+			manifest.Queues = append(manifest.Queues, ManifestQueue{
+				Vhost: vhost, Name: field("name"),
+				Durable: flag("durable", true), AutoDelete: flag("auto_delete", false),
+			})
+		case "binding":
+			manifest.Bindings = append(manifest.Bindings, ManifestBinding{
+				Vhost: vhost, Source: field("source"), Destination: field("destination"),
+				DestinationType: field("destination_type"), RoutingKey: field("routing_key"),
+			})
+		default:
+			return manifest, fmt.Errorf("line %d: unknown kind %q", line, field("kind"))
+		}
+	}
+}
+
+// PutExchange declare an exchange, succeeds when it already exists with the
+// same properties
+func (client *ManagementClient) PutExchange(exchange ManifestExchange) error {
+	if err := client.scope.Check("exchange", exchange.Name); err != nil {
+		return err
+	}
+	if exchange.Type == "" {
+		exchange.Type = "direct"
+	}
+	body := map[string]interface{}{
+		"type":        exchange.Type,
+		"durable":     exchange.Durable,
+		"auto_delete": exchange.AutoDelete,
+		"internal":    exchange.Internal,
+		"arguments":   exchange.Arguments,
+	}
+	return client.put(objectPath("exchanges", exchange.Vhost, exchange.Name), body)
+}
+
+// PutQueue declare a queue, succeeds when it already exists with the same
+// properties
+func (client *ManagementClient) PutQueue(queue ManifestQueue) error {
+	if err := client.scope.Check("queue", queue.Name); err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"durable":     queue.Durable,
+		"auto_delete": queue.AutoDelete,
+		"arguments":   queue.Arguments,
+	}
+	return client.put(objectPath("queues", queue.Vhost, queue.Name), body)
+}
+
+// PostBinding create a binding, binding twice is a no-op on the broker
+func (client *ManagementClient) PostBinding(binding ManifestBinding) error {
+	if err := client.scope.Check("binding destination", binding.Destination); err != nil {
+		return err
+	}
+	destType := "q"
+	if binding.DestinationType == "exchange" || binding.DestinationType == "e" {
+		destType = "e"
+	}
+	body := map[string]interface{}{
+		"routing_key": binding.RoutingKey,
+		"arguments":   binding.Arguments,
+	}
+	return client.post(managementPath("bindings", binding.Vhost, "e", binding.Source, destType, binding.Destination), body)
+}
+
+// ManifestTasks the tasks creating the objects of the manifest, one list per
+// phase. Exchanges and queues have to exist before they can be bound.
+func (client *ManagementClient) ManifestTasks(manifest Manifest) [][]BulkTask {
+	declares := []BulkTask{}
+	for _, exchange := range manifest.Exchanges {
+		exchange := exchange
+		declares = append(declares, BulkTask{
+			ID:  fmt.Sprintf("exchange %s/%s", exchange.Vhost, exchange.Name),
+			Run: func() error { return client.PutExchange(exchange) },
+		})
+	}
+	for _, queue := range manifest.Queues {
+		queue := queue
+		declares = append(declares, BulkTask{
+			ID:  fmt.Sprintf("queue %s/%s", queue.Vhost, queue.Name),
+			Run: func() error { return client.PutQueue(queue) },
+		})
+	}
+	bindings := []BulkTask{}
+	for _, binding := range manifest.Bindings {
+		binding := binding
+		bindings = append(bindings, BulkTask{
+			ID: fmt.Sprintf("binding %s/%s->%s (%s)", binding.Vhost, binding.Source,
+				binding.Destination, binding.RoutingKey),
+			Run: func() error { return client.PostBinding(binding) },
+		})
+	}
+	return [][]BulkTask{declares, bindings}
+}
+
+// ManifestOptions : how to create a manifest
+type ManifestOptions struct {
+	File string `json:"file"`
+	BulkOptions
+}
+
+// ParseManifestOptions : parse manifest options sent by the ui
+func ParseManifestOptions(str string) ManifestOptions {
+	var res ManifestOptions
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		fmt.Println(err)
+	}
+	return res
+}
+
+// CreateManifest create all objects of the manifest file
+func (client *ManagementClient) CreateManifest(opts ManifestOptions, progress func(BulkProgress)) (BulkSummary, error) {
+	manifest, err := LoadManifest(opts.File)
+	if err != nil {
+		return BulkSummary{}, err
+	}
+	phases := client.ManifestTasks(manifest)
+	total := 0
+	for _, tasks := range phases {
+		total += len(tasks)
+	}
+	summary := BulkSummary{Total: total, Failures: []BulkFailure{}}
+	for _, tasks := range phases {
+		offset := BulkProgress{Done: summary.Skipped + summary.Succeeded + len(summary.Failures), Failed: len(summary.Failures)}
+		res, err := RunBulk(tasks, opts.BulkOptions, func(p BulkProgress) {
+			if progress != nil {
+				progress(BulkProgress{Done: offset.Done + p.Done, Failed: offset.Failed + p.Failed, Total: total})
+			}
+		})
+		summary.Succeeded += res.Succeeded
+		summary.Skipped += res.Skipped
+		summary.Failures = append(summary.Failures, res.Failures...)
+		if err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
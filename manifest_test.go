@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSVManifest(t *testing.T) {
+	csv := `kind,vhost,name,type,durable,source,destination,destination_type,routing_key
+exchange,/,orders,topic,,,,,
+queue,prod,orders.new,,false,,,,
+binding,/,,,,orders,orders.new,queue,order.created
+`
+	manifest, err := ParseCSVManifest(strings.NewReader(csv))
+	assert.Nil(t, err)
+	assert.Equal(t, ManifestExchange{Vhost: "/", Name: "orders", Type: "topic", Durable: true}, manifest.Exchanges[0])
+	assert.Equal(t, ManifestQueue{Vhost: "prod", Name: "orders.new", Durable: false}, manifest.Queues[0])
+	assert.Equal(t, "order.created", manifest.Bindings[0].RoutingKey)
+
+	_, err = ParseCSVManifest(strings.NewReader("kind,name\nuser,bob\n"))
+	assert.NotNil(t, err)
+}
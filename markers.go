@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// markerPrefix keys of the markers in a store
+const markerPrefix = "markers/"
+
+// marker kinds
+const (
+	MarkerDeploy   = "deploy"
+	MarkerIncident = "incident"
+)
+
+// defaultMarkerWindow time around a marker the backlog is compared over
+const defaultMarkerWindow = 15 * time.Minute
+
+// Marker : a deploy or incident at a point in time, shown along the metric
+// history so changes of the broker can be told apart by their cause
+type Marker struct {
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	Name        string    `json:"name"`
+	Vhost       string    `json:"vhost,omitempty"`
+	Description string    `json:"description,omitempty"`
+	User        string    `json:"user,omitempty"`
+	// Backlog messages around the marker, when the history was consulted
+	Backlog *MarkerBacklog `json:"backlog,omitempty"`
+}
+
+// MarkerBacklog : messages in the queues of the marker vhost, or all
+// queues, just before the marker and at their peak in the window after it
+type MarkerBacklog struct {
+	Before float64 `json:"before"`
+	Peak   float64 `json:"peak"`
+}
+
+// Validate check kind and name, the kind defaults to deploy
+func (marker *Marker) Validate() error {
+	if marker.Name == "" {
+		return fmt.Errorf("marker without name")
+	}
+	switch marker.Kind {
+	case "":
+		marker.Kind = MarkerDeploy
+	case MarkerDeploy, MarkerIncident:
+	default:
+		return fmt.Errorf("unknown marker kind %q, expected deploy or incident", marker.Kind)
+	}
+	return nil
+}
+
+// markerKey store key of a marker id, keys sort by time
+func markerKey(id string) string {
+	return markerPrefix + id
+}
+
+// AddMarker store marker, the time defaults to now
+func AddMarker(store KVStore, marker Marker, now time.Time) (Marker, error) {
+	if err := marker.Validate(); err != nil {
+		return marker, err
+	}
+	if marker.Time.IsZero() {
+		marker.Time = now
+	}
+	random := make([]byte, 3)
+	if _, err := rand.Read(random); err != nil {
+		return marker, err
+	}
+	marker.ID = marker.Time.UTC().Format("20060102T150405.000Z") + "-" + hex.EncodeToString(random)
+	marker.Backlog = nil
+	return marker, putJSON(store, markerKey(marker.ID), marker)
+}
+
+// DeleteMarker remove the marker id, false when there is none
+func DeleteMarker(store KVStore, id string) (bool, error) {
+	_, found, err := store.Get(markerKey(id))
+	if err != nil || !found {
+		return false, err
+	}
+	return true, store.Delete(markerKey(id))
+}
+
+// MarkerList : markers sorted by time
+type MarkerList []Marker
+
+// Markers the markers of store between from and to
+func Markers(store KVStore, from time.Time, to time.Time) (MarkerList, error) {
+	keys, err := store.Keys(markerPrefix)
+	if err != nil {
+		return nil, err
+	}
+	markers := MarkerList{}
+	for _, key := range keys {
+		var marker Marker
+		if _, err := getJSON(store, key, &marker); err != nil {
+			return nil, err
+		}
+		if !marker.Time.Before(from) && !marker.Time.After(to) {
+			markers = append(markers, marker)
+		}
+	}
+	sort.SliceStable(markers, func(i, j int) bool { return markers[i].Time.Before(markers[j].Time) })
+	return markers, nil
+}
+
+// Visible the markers of vhosts the token may see, markers without vhost
+// concern every vhost
+func (markers MarkerList) Visible(token APIToken) MarkerList {
+	visible := MarkerList{}
+	for _, marker := range markers {
+		if marker.Vhost == "" || token.AllowsVhost(marker.Vhost) {
+			visible = append(visible, marker)
+		}
+	}
+	return visible
+}
+
+// markerBacklog total messages of the vhost, or all queues, by time
+// between from and to
+func markerBacklog(history *MetricHistory, vhost string, from time.Time, to time.Time, now time.Time) (map[time.Time]float64, error) {
+	metric := metricMessages.Name
+	if vhost != "" {
+		metric = metricQueueMessages.Name
+	}
+	_, series, err := history.Query(metric, from, to, now)
+	if err != nil {
+		return nil, err
+	}
+	totals := map[time.Time]float64{}
+	for name, points := range series {
+		if v, _ := seriesVhost(name); v != vhost {
+			continue
+		}
+		for _, point := range points {
+			totals[point.Time] += point.Value
+		}
+	}
+	return totals, nil
+}
+
+// Correlate add the backlog within window before and after each marker
+// from the history, markers without history around them are left alone
+func (markers MarkerList) Correlate(history *MetricHistory, window time.Duration, now time.Time) error {
+	for i := range markers {
+		marker := &markers[i]
+		totals, err := markerBacklog(history, marker.Vhost, marker.Time.Add(-window), marker.Time.Add(window), now)
+		if err != nil {
+			return err
+		}
+		var before, peak time.Time
+		backlog := MarkerBacklog{}
+		for at, total := range totals {
+			switch {
+			case !at.After(marker.Time) && at.After(before):
+				before, backlog.Before = at, total
+			case at.After(marker.Time) && (peak.IsZero() || total > backlog.Peak):
+				peak, backlog.Peak = at, total
+			}
+		}
+		if !before.IsZero() && !peak.IsZero() {
+			marker.Backlog = &backlog
+		}
+	}
+	return nil
+}
+
+// Table one row per marker, incidents and markers followed by a growing
+// backlog in yellow
+func (markers MarkerList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"TIME", "KIND", "NAME", "VHOST", "BACKLOG BEFORE", "BACKLOG PEAK AFTER", "DESCRIPTION"}}
+	for _, marker := range markers {
+		kind := Cell{Text: marker.Kind}
+		if marker.Kind == MarkerIncident {
+			kind.Color = Yellow
+		}
+		before, peak := Cell{Text: "-"}, Cell{Text: "-"}
+		if marker.Backlog != nil {
+			before.Text = format.Count(int64(marker.Backlog.Before))
+			peak.Text = format.Count(int64(marker.Backlog.Peak))
+			if marker.Backlog.Peak > 2*marker.Backlog.Before && marker.Backlog.Peak-marker.Backlog.Before >= 100 {
+				peak.Color = Yellow
+			}
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: marker.Time.Format(time.RFC3339)},
+			kind,
+			{Text: marker.Name},
+			{Text: orDash(marker.Vhost)},
+			before,
+			peak,
+			{Text: orDash(marker.Description)},
+		})
+	}
+	return table
+}
+
+// handleMarkers list the markers since ?since= (a duration, default 24h)
+// on GET, add one on POST and remove one on DELETE /api/markers/<id>
+func (server *Server) handleMarkers(w http.ResponseWriter, r *http.Request) {
+	if server.store == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no store configured, see serve --store"})
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/markers"), "/")
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		now := time.Now()
+		since := 24 * time.Hour
+		if str := r.URL.Query().Get("since"); str != "" {
+			d, err := parseRetentionDuration(str)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			since = d
+		}
+		markers, err := Markers(server.store, now.Add(-since), now)
+		if err == nil && server.history != nil {
+			err = markers.Correlate(server.history, defaultMarkerWindow, now)
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if token, ok := requestToken(r); ok {
+			markers = markers.Visible(token)
+		}
+		writeJSON(w, http.StatusOK, markers)
+	case r.Method == http.MethodPost && id == "":
+		var marker Marker
+		if err := json.NewDecoder(r.Body).Decode(&marker); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if token, ok := requestToken(r); ok && !token.AllowsVhost(marker.Vhost) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "token may not mark this vhost"})
+			return
+		}
+		marker.User = requestUser(r)
+		marker, err := AddMarker(server.store, marker, time.Now())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusCreated, marker)
+	case r.Method == http.MethodDelete && id != "":
+		found, err := DeleteMarker(server.store, id)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if !found {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no marker %q", id)})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or POST /api/markers, DELETE /api/markers/<id>"})
+	}
+}
+
+// postMarker add a marker through the api of a running serve
+func postMarker(server string, token string, marker Marker) (Marker, error) {
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return marker, err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(server, "/")+"/api/markers", bytes.NewReader(data))
+	if err != nil {
+		return marker, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return marker, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		var body map[string]string
+		json.NewDecoder(res.Body).Decode(&body)
+		return marker, fmt.Errorf("%s: %s", res.Status, body["error"])
+	}
+	var created Marker
+	err = json.NewDecoder(res.Body).Decode(&created)
+	return created, err
+}
+
+func init() {
+	registerCommand("marker", "[--store f | --server url] add [--kind deploy|incident] [--vhost v] [--at t] [--description d] <name> | list [--since d] [--retention r] | delete <id>: record deploys and incidents along the metric history", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("marker")
+		storeFile := flags.String("store", envOr("RADISH_STORE", ""), "store of serve --store holding the markers")
+		server := flags.String("server", envOr("RADISH_SERVER", ""), "add the marker through the api of a running serve instead")
+		token := flags.String("token", envOr("RADISH_API_TOKEN", ""), "bearer token of the serve api")
+		kind := flags.String("kind", MarkerDeploy, "deploy or incident")
+		vhost := flags.String("vhost", "", "vhost the marker concerns, empty for all")
+		at := flags.String("at", "", "time of the marker (rfc3339), now by default")
+		description := flags.String("description", "", "what was deployed or happened")
+		since := flags.String("since", "7d", "list the markers of this duration")
+		retention := flags.String("retention", defaultRetention, "retention policy the history was recorded with")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = NormalizeVhost(*vhost)
+		action := "list"
+		if flags.NArg() > 0 {
+			action = flags.Arg(0)
+		}
+		now := time.Now()
+		marker := Marker{Kind: *kind, Vhost: *vhost, Description: *description, User: envOr("USER", "")}
+		switch action {
+		case "add":
+			if flags.NArg() != 2 {
+				return nil, usageError("marker add: expected a name")
+			}
+			marker.Name = flags.Arg(1)
+			if *at != "" {
+				t, err := time.Parse(time.RFC3339, *at)
+				if err != nil {
+					return nil, usageError("marker add: --at: %s", err)
+				}
+				marker.Time = t
+			}
+			if err := marker.Validate(); err != nil {
+				return nil, usageError("marker add: %s", err)
+			}
+			if *server != "" {
+				created, err := postMarker(*server, *token, marker)
+				if err != nil {
+					return nil, fmt.Errorf("marker add: %s", err)
+				}
+				return MarkerList{created}, nil
+			}
+		case "list", "delete":
+			if *server != "" {
+				return nil, usageError("marker %s: expected --store, --server only adds markers", action)
+			}
+		default:
+			return nil, usageError("marker: unknown action %s, expected add, list or delete", action)
+		}
+		if *storeFile == "" {
+			return nil, usageError("marker: expected --store or --server")
+		}
+		store, err := OpenKVStore(*storeFile)
+		if err != nil {
+			return nil, usageError("store: %s", err)
+		}
+		defer store.Close()
+		switch action {
+		case "add":
+			created, err := AddMarker(store, marker, now)
+			if err != nil {
+				return nil, err
+			}
+			return MarkerList{created}, nil
+		case "delete":
+			if flags.NArg() != 2 {
+				return nil, usageError("marker delete: expected a marker id")
+			}
+			found, err := DeleteMarker(store, flags.Arg(1))
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, usageError("marker delete: no marker %q", flags.Arg(1))
+			}
+			return MarkerList{}, nil
+		}
+		d, err := parseRetentionDuration(*since)
+		if err != nil {
+			return nil, usageError("marker list: --since: %s", err)
+		}
+		policy, err := ParseRetentionPolicy(*retention)
+		if err != nil {
+			return nil, usageError("retention: %s", err)
+		}
+		markers, err := Markers(store, now.Add(-d), now)
+		if err != nil {
+			return nil, err
+		}
+		history, err := NewMetricHistory(store, policy, 0)
+		if err != nil {
+			return nil, err
+		}
+		return markers, markers.Correlate(history, defaultMarkerWindow, now)
+	})
+}
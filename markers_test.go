@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkers(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "markers")
+	defer os.RemoveAll(dir)
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	defer store.Close()
+	policy, _ := ParseRetentionPolicy("10s:1d")
+	history, _ := NewMetricHistory(store, policy, 0)
+	start := time.Unix(1577880000, 0)
+	// the backlog grows after the deploy at start+100s
+	for i := 0; i < 30; i++ {
+		messages := 10
+		if i > 10 {
+			messages = 10 + 100*(i-10)
+		}
+		info := rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "orders", Messages: messages}}}
+		info.Overview.QueueTotals.Messages = messages
+		history.Record(BrokerMetrics(&Snapshot{Info: info}), start.Add(time.Duration(i)*10*time.Second))
+	}
+
+	_, err := AddMarker(store, Marker{Name: "x", Kind: "release"}, start)
+	assert.NotNil(t, err)
+	deploy, err := AddMarker(store, Marker{Name: "orders v2", Time: start.Add(105 * time.Second)}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, MarkerDeploy, deploy.Kind)
+	_, err = AddMarker(store, Marker{Name: "outage", Kind: MarkerIncident, Vhost: "/"}, start.Add(250*time.Second))
+	assert.Nil(t, err)
+
+	now := start.Add(300 * time.Second)
+	markers, err := Markers(store, start, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(markers))
+	assert.Equal(t, "orders v2", markers[0].Name)
+	assert.Nil(t, markers.Correlate(history, time.Minute, now))
+	assert.Equal(t, &MarkerBacklog{Before: 10, Peak: 610}, markers[0].Backlog)
+	assert.Equal(t, &MarkerBacklog{Before: 1510, Peak: 1910}, markers[1].Backlog)
+	assert.Equal(t, Yellow, markers.Table(NumberFormat{}).Rows[0][5].Color)
+
+	limited := markers.Visible(APIToken{Vhosts: []string{"other"}})
+	assert.Equal(t, 1, len(limited))
+
+	found, err := DeleteMarker(store, deploy.ID)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	found, _ = DeleteMarker(store, deploy.ID)
+	assert.False(t, found)
+}
+
+func TestMarkersAPI(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "markers")
+	defer os.RemoveAll(dir)
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	defer store.Close()
+	policy, _ := ParseRetentionPolicy("10s:1d")
+	history, _ := NewMetricHistory(store, policy, 0)
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	server.UseStore(store)
+	server.EnableHistory(history)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("POST", "/api/markers", strings.NewReader(`{"name":"v2","description":"orders service"}`)))
+	assert.Equal(t, 201, rec.Code)
+	var created Marker
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	assert.Equal(t, "v2", created.Name)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("POST", "/api/markers", strings.NewReader(`{}`)))
+	assert.Equal(t, 400, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/history?metric=messages", nil))
+	var result struct {
+		Markers MarkerList `json:"markers"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Equal(t, 1, len(result.Markers))
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/markers/"+created.ID, nil))
+	assert.Equal(t, 204, rec.Code)
+
+	assert.Equal(t, ActionMarker, requestAction(httptest.NewRequest("POST", "/api/markers", nil)))
+	assert.Equal(t, ActionRead, requestAction(httptest.NewRequest("GET", "/api/markers", nil)))
+	_, _, err := (&TokenStore{}).Issue("deploys", []string{ActionMarker}, nil, 0, time.Now())
+	assert.Nil(t, err)
+}
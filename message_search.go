@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// SearchCriteria : what a message must match, all given criteria must match
+type SearchCriteria struct {
+	// Headers header name to value, values are compared as text
+	Headers       map[string]string
+	CorrelationID string
+	MessageID     string
+	RoutingKey    string
+	Body          *regexp.Regexp
+}
+
+// SearchMessage : a message being searched, Position counts from the head
+// of the queue starting at 1
+type SearchMessage struct {
+	Position        int                    `json:"position"`
+	Exchange        string                 `json:"exchange"`
+	RoutingKey      string                 `json:"routingKey"`
+	CorrelationID   string                 `json:"correlationId,omitempty"`
+	MessageID       string                 `json:"messageId,omitempty"`
+	ContentType     string                 `json:"contentType,omitempty"`
+	ContentEncoding string                 `json:"-"`
+	Headers         map[string]interface{} `json:"headers,omitempty"`
+	Body            []byte                 `json:"-"`
+	Size            int                    `json:"size"`
+}
+
+// ParseHeaderCriteria parse name=value pairs
+func ParseHeaderCriteria(pairs []string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid header criteria %q, expected name=value", pair)
+		}
+		headers[kv[0]] = kv[1]
+	}
+	return headers, nil
+}
+
+// Match message matches all criteria. The body regex sees gzip encoded
+// bodies decompressed.
+func (criteria SearchCriteria) Match(message SearchMessage) bool {
+	if criteria.CorrelationID != "" && message.CorrelationID != criteria.CorrelationID {
+		return false
+	}
+	if criteria.MessageID != "" && message.MessageID != criteria.MessageID {
+		return false
+	}
+	if criteria.RoutingKey != "" && message.RoutingKey != criteria.RoutingKey {
+		return false
+	}
+	for name, value := range criteria.Headers {
+		header, ok := message.Headers[name]
+		if !ok || fmt.Sprint(header) != value {
+			return false
+		}
+	}
+	if criteria.Body != nil {
+		body := message.Body
+		if strings.EqualFold(message.ContentEncoding, "gzip") {
+			if data, err := gunzip(body); err == nil {
+				body = data
+			}
+		}
+		if !criteria.Body.Match(body) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchMessageFromGet convert a message fetched with the get endpoint
+func searchMessageFromGet(position int, message QueueMessage) SearchMessage {
+	headers, _ := message.Properties["headers"].(map[string]interface{})
+	return SearchMessage{
+		Position: position, Exchange: message.Exchange, RoutingKey: message.RoutingKey,
+		CorrelationID: message.property("correlation_id"), MessageID: message.property("message_id"),
+		ContentType: message.property("content_type"), ContentEncoding: message.property("content_encoding"),
+		Headers: headers, Body: message.Body(), Size: message.PayloadBytes,
+	}
+}
+
+// searchMessageFromDelivery convert a message received by a consumer
+func searchMessageFromDelivery(position int, delivery amqp.Delivery) SearchMessage {
+	return SearchMessage{
+		Position: position, Exchange: delivery.Exchange, RoutingKey: delivery.RoutingKey,
+		CorrelationID: delivery.CorrelationId, MessageID: delivery.MessageId,
+		ContentType: delivery.ContentType, ContentEncoding: delivery.ContentEncoding,
+		Headers: delivery.Headers, Body: delivery.Body, Size: len(delivery.Body),
+	}
+}
+
+// SearchQueueGet scan up to limit messages from the head of the queue with
+// one get request that requeues them. The messages stay in place but the
+// broker counts this as a delivery: they are flagged redelivered and on
+// quorum queues their x-delivery-count grows, which may dead letter them
+// once a delivery-limit is reached. The get endpoint always starts at the
+// head, so there is no paging beyond limit.
+func SearchQueueGet(client *ManagementClient, vhost string, queue string, limit int, criteria SearchCriteria) (SearchResult, error) {
+	messages, err := client.GetMessages(vhost, queue, limit, true)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	result := SearchResult{Matches: []SearchMessage{}}
+	for i, message := range messages {
+		result.Scanned++
+		if msg := searchMessageFromGet(i+1, message); criteria.Match(msg) {
+			result.Matches = append(result.Matches, msg)
+		}
+	}
+	return result, nil
+}
+
+// SearchQueueConsume scan up to limit messages with a temporary consumer that
+// never acknowledges. Closing its channel returns all messages to the queue,
+// flagged redelivered like with SearchQueueGet.
+// Scanning stops when no message arrived for idle.
+func SearchQueueConsume(conn *amqp.Connection, queue string, limit int, idle time.Duration, criteria SearchCriteria) (SearchResult, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return SearchResult{}, err
+	}
+	defer ch.Close()
+	if err := ch.Qos(limit, 0, false); err != nil {
+		return SearchResult{}, err
+	}
+	deliveries, err := ch.Consume(queue, "", false, false, false, false, nil)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	result := SearchResult{Matches: []SearchMessage{}}
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+	for result.Scanned < limit {
+		select {
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return result, fmt.Errorf("consumer on %s was cancelled", queue)
+			}
+			result.Scanned++
+			if msg := searchMessageFromDelivery(result.Scanned, delivery); criteria.Match(msg) {
+				result.Matches = append(result.Matches, msg)
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(idle)
+		case <-timer.C:
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+// SearchResult : messages matching a search
+type SearchResult struct {
+	Scanned int             `json:"scanned"`
+	Matches []SearchMessage `json:"matches"`
+}
+
+// Table matches as table
+func (result SearchResult) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"POSITION", "ROUTING KEY", "CORRELATION ID", "MESSAGE ID", "BYTES", "BODY"}}
+	for _, match := range result.Matches {
+		body := FormatPayload(match.Body, match.ContentType, match.ContentEncoding, PayloadOptions{})
+		table.Rows = append(table.Rows, []Cell{
+			{Text: fmt.Sprintf("%d/%d", match.Position, result.Scanned)},
+			{Text: orDash(match.RoutingKey)},
+			{Text: orDash(match.CorrelationID)},
+			{Text: orDash(match.MessageID)},
+			{Text: format.Bytes(int64(match.Size))},
+			{Text: strings.Replace(body, "\n", " ", -1)},
+		})
+	}
+	return table
+}
+
+// stringList : repeatable string flag
+type stringList []string
+
+func (list *stringList) String() string { return strings.Join(*list, ",") }
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+func init() {
+	registerCommand("search", "[--vhost v] [--header name=value]... [--correlation-id id] [--message-id id] [--body regex] [--limit n] [--consume] <queue> find messages without removing them", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("search")
+		vhost := flags.String("vhost", "", "vhost of the queue, the default vhost when omitted")
+		var headers stringList
+		flags.Var(&headers, "header", "header value to match, repeatable")
+		var criteria SearchCriteria
+		flags.StringVar(&criteria.CorrelationID, "correlation-id", "", "correlation id to match")
+		flags.StringVar(&criteria.MessageID, "message-id", "", "message id to match")
+		flags.StringVar(&criteria.RoutingKey, "routing-key", "", "routing key to match")
+		body := flags.String("body", "", "regular expression the body must match")
+		limit := flags.Int("limit", 1000, "messages to scan from the head of the queue, they are marked redelivered")
+		consume := flags.Bool("consume", false, "scan with a temporary consumer instead of get, holds the messages until done")
+		idle := flags.Duration("idle", 2*time.Second, "with --consume, stop when no message arrived for this long")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = cli.vhost(*vhost)
+		if flags.NArg() != 1 {
+			return nil, usageError("search: expected queue name")
+		}
+		var err error
+		if criteria.Headers, err = ParseHeaderCriteria(headers); err != nil {
+			return nil, usageError("search: %s", err)
+		}
+		if *body != "" {
+			if criteria.Body, err = regexp.Compile(*body); err != nil {
+				return nil, usageError("search: --body: %s", err)
+			}
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		if !*consume {
+			return SearchQueueGet(rabbitmq.management(), *vhost, flags.Arg(0), *limit, criteria)
+		}
+		uri, err := VhostAMQPURL(rabbitmq.amqpURL, *vhost)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := amqp.DialConfig(uri, rabbitmq.amqpConfig)
+		if err != nil {
+			return nil, connectionError(err)
+		}
+		defer conn.Close()
+		return SearchQueueConsume(conn, flags.Arg(0), *limit, *idle, criteria)
+	})
+}
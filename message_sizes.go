@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultOutlierBytes messages larger than this are reported individually
+const defaultOutlierBytes = 1 << 20
+
+// sizeBuckets upper bounds of the size histogram, each 4 times the previous
+var sizeBuckets = []int64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, math.MaxInt64}
+
+// SizeBucket : number of messages up to a size
+type SizeBucket struct {
+	Le    int64 `json:"le"`
+	Count int   `json:"count"`
+}
+
+// SizeOutlier : a message larger than the outlier threshold
+type SizeOutlier struct {
+	RoutingKey string `json:"routingKey"`
+	MessageID  string `json:"messageId,omitempty"`
+	Size       int64  `json:"size"`
+}
+
+// SizeReport : size distribution of the messages sampled from a source
+type SizeReport struct {
+	Source   string        `json:"source"`
+	Samples  int           `json:"samples"`
+	Min      int64         `json:"min"`
+	Max      int64         `json:"max"`
+	Mean     int64         `json:"mean"`
+	P50      int64         `json:"p50"`
+	P95      int64         `json:"p95"`
+	P99      int64         `json:"p99"`
+	Buckets  []SizeBucket  `json:"buckets"`
+	Outliers []SizeOutlier `json:"outliers"`
+}
+
+// SizeSampler collect message sizes of one source
+type SizeSampler struct {
+	Source       string
+	OutlierBytes int64
+	mutex        sync.Mutex
+	sizes        []int64
+	outliers     []SizeOutlier
+}
+
+// Add record the size of a message
+func (sampler *SizeSampler) Add(size int64, routingKey string, messageID string) {
+	sampler.mutex.Lock()
+	defer sampler.mutex.Unlock()
+	sampler.sizes = append(sampler.sizes, size)
+	if sampler.OutlierBytes > 0 && size > sampler.OutlierBytes {
+		sampler.outliers = append(sampler.outliers, SizeOutlier{routingKey, messageID, size})
+	}
+}
+
+// nearestRank nearest rank percentile p of sorted sizes
+func nearestRank(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// Report histogram and percentiles of the sizes seen so far, outliers
+// largest first
+func (sampler *SizeSampler) Report() SizeReport {
+	sampler.mutex.Lock()
+	sorted := append([]int64{}, sampler.sizes...)
+	outliers := append([]SizeOutlier{}, sampler.outliers...)
+	sampler.mutex.Unlock()
+
+	report := SizeReport{Source: sampler.Source, Samples: len(sorted), Buckets: []SizeBucket{}, Outliers: outliers}
+	sort.Slice(outliers, func(i, j int) bool { return outliers[i].Size > outliers[j].Size })
+	if len(sorted) == 0 {
+		return report
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total int64
+	bucket := 0
+	counts := make([]int, len(sizeBuckets))
+	for _, size := range sorted {
+		total += size
+		for size > sizeBuckets[bucket] {
+			bucket++
+		}
+		counts[bucket]++
+	}
+	for i, le := range sizeBuckets {
+		report.Buckets = append(report.Buckets, SizeBucket{le, counts[i]})
+	}
+	report.Min, report.Max = sorted[0], sorted[len(sorted)-1]
+	report.Mean = total / int64(len(sorted))
+	report.P50, report.P95, report.P99 = nearestRank(sorted, 50), nearestRank(sorted, 95), nearestRank(sorted, 99)
+	return report
+}
+
+// SampleQueueSizes fetch up to count messages of a queue with requeue set, so
+// the queue content stays, and record their sizes
+func SampleQueueSizes(client *ManagementClient, vhost string, queue string, count int, sampler *SizeSampler) error {
+	messages, err := client.GetMessages(vhost, queue, count, true)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		messageID, _ := message.Properties["message_id"].(string)
+		sampler.Add(int64(message.PayloadBytes), message.RoutingKey, messageID)
+	}
+	return nil
+}
+
+// SizeReports : size reports of several sources
+type SizeReports []SizeReport
+
+// sizeLabel short label of a bucket bound
+func sizeLabel(format NumberFormat, le int64) string {
+	if le == math.MaxInt64 {
+		return "inf"
+	}
+	return format.Bytes(le)
+}
+
+// Table one row per source, followed by its histogram and outliers
+func (reports SizeReports) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"SOURCE", "SAMPLES", "MIN", "P50", "P95", "P99", "MAX", "HISTOGRAM"}}
+	for _, report := range reports {
+		histogram := []string{}
+		for _, bucket := range report.Buckets {
+			if bucket.Count > 0 {
+				histogram = append(histogram, fmt.Sprintf("<=%s:%d", sizeLabel(format, bucket.Le), bucket.Count))
+			}
+		}
+		color := None
+		if len(report.Outliers) > 0 {
+			color = Yellow
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: report.Source},
+			{Text: format.Count(int64(report.Samples))},
+			{Text: format.Bytes(report.Min)},
+			{Text: format.Bytes(report.P50)},
+			{Text: format.Bytes(report.P95)},
+			{Text: format.Bytes(report.P99)},
+			{Text: format.Bytes(report.Max), Color: color},
+			{Text: orDash(strings.Join(histogram, " "))},
+		})
+		for _, outlier := range report.Outliers {
+			table.Rows = append(table.Rows, []Cell{
+				{Text: "  outlier " + orDash(outlier.MessageID)},
+				{Text: "-"}, {Text: "-"}, {Text: "-"}, {Text: "-"}, {Text: "-"},
+				{Text: format.Bytes(outlier.Size), Color: Red},
+				{Text: "routing key " + orDash(outlier.RoutingKey)},
+			})
+		}
+	}
+	return table
+}
+
+// splitList split a comma separated flag value, dropping empty items
+func splitList(str string) []string {
+	var items []string
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func init() {
+	registerCommand("message-sizes", "[--vhost v] [--queues q1,q2] [--exchanges x1,x2] [--count n] [--duration d] [--outlier bytes] message size histograms", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("message-sizes")
+		vhost := flags.String("vhost", "", "vhost of the queues, the default vhost when omitted")
+		queues := flags.String("queues", "", "queues to sample with get, messages are requeued")
+		exchanges := flags.String("exchanges", "", "exchanges to tap")
+		count := flags.Int("count", 100, "messages fetched per queue")
+		duration := flags.Duration("duration", 10*time.Second, "time to tap the exchanges")
+		outlier := flags.Int64("outlier", defaultOutlierBytes, "report messages larger than this many bytes")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = cli.vhost(*vhost)
+		if *queues == "" && *exchanges == "" {
+			return nil, usageError("message-sizes: expected --queues or --exchanges")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		reports := SizeReports{}
+		for _, queue := range splitList(*queues) {
+			sampler := &SizeSampler{Source: "queue " + queue, OutlierBytes: *outlier}
+			if err := SampleQueueSizes(rabbitmq.management(), *vhost, queue, *count, sampler); err != nil {
+				return reports, err
+			}
+			reports = append(reports, sampler.Report())
+		}
+		if names := splitList(*exchanges); len(names) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), *duration)
+			defer cancel()
+			ctx, stop := signalContext(ctx)
+			defer stop()
+			samplers := make([]*SizeSampler, len(names))
+			var wg sync.WaitGroup
+			for i, name := range names {
+				samplers[i] = &SizeSampler{Source: "exchange " + name, OutlierBytes: *outlier}
+				wg.Add(1)
+				go func(sampler *SizeSampler, exchange string) {
+					defer wg.Done()
+					rabbitmq.Tap(ctx, exchange, "#", func(message rabtap.TapMessage) error {
+						msg := message.AmqpMessage
+						sampler.Add(int64(len(msg.Body)), msg.RoutingKey, msg.MessageId)
+						return nil
+					})
+				}(samplers[i], name)
+			}
+			wg.Wait()
+			for _, sampler := range samplers {
+				reports = append(reports, sampler.Report())
+			}
+		}
+		return reports, nil
+	})
+}
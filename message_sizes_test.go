@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeSampler(t *testing.T) {
+	sampler := &SizeSampler{Source: "queue q", OutlierBytes: 100 << 10}
+	for i := 0; i < 98; i++ {
+		sampler.Add(500, "k", "")
+	}
+	sampler.Add(3000, "k", "")
+	sampler.Add(2<<20, "big", "m1")
+	report := sampler.Report()
+	assert.Equal(t, 100, report.Samples)
+	assert.Equal(t, int64(500), report.Min)
+	assert.Equal(t, int64(500), report.P50)
+	assert.Equal(t, int64(3000), report.P99)
+	assert.Equal(t, int64(2<<20), report.Max)
+	assert.Equal(t, SizeBucket{1 << 10, 98}, report.Buckets[0])
+	assert.Equal(t, SizeBucket{4 << 10, 1}, report.Buckets[1])
+	assert.Equal(t, SizeBucket{4 << 20, 1}, report.Buckets[6])
+	assert.Equal(t, []SizeOutlier{{"big", "m1", 2 << 20}}, report.Outliers)
+
+	empty := (&SizeSampler{Source: "queue e"}).Report()
+	assert.Equal(t, 0, empty.Samples)
+	assert.Empty(t, empty.Buckets)
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, splitList(" a,,b "))
+	assert.Nil(t, splitList(""))
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyPrefix keys of the metric history in the store
+const historyPrefix = "history/"
+
+// defaultRetention raw points every 10s for a day, 5 minute averages for a
+// month
+const defaultRetention = "10s:24h,5m:30d"
+
+// RetentionTier : points of a resolution kept for a time
+type RetentionTier struct {
+	Resolution time.Duration
+	Keep       time.Duration
+}
+
+// RetentionPolicy : tiers from the finest to the coarsest resolution, each
+// tier is rolled up from the previous one
+type RetentionPolicy []RetentionTier
+
+// parseRetentionDuration a duration, with d for days
+func parseRetentionDuration(str string) (time.Duration, error) {
+	if strings.HasSuffix(str, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(str, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", str)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(str)
+}
+
+// formatRetentionDuration whole days as 30d, other durations without
+// trailing zero units, like 5m
+func formatRetentionDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	str := d.String()
+	if strings.HasSuffix(str, "m0s") {
+		str = strings.TrimSuffix(str, "0s")
+	}
+	if strings.HasSuffix(str, "h0m") {
+		str = strings.TrimSuffix(str, "0m")
+	}
+	return str
+}
+
+// ParseRetentionPolicy read tiers like 10s:24h,5m:30d. Every resolution
+// must be a multiple of the previous one, which has to be kept at least
+// that long to be rolled up.
+func ParseRetentionPolicy(str string) (RetentionPolicy, error) {
+	policy := RetentionPolicy{}
+	for _, item := range splitList(str) {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid retention %q, expected resolution:keep like 10s:24h", item)
+		}
+		resolution, err := parseRetentionDuration(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		keep, err := parseRetentionDuration(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if resolution < time.Second || keep < resolution {
+			return nil, fmt.Errorf("invalid retention %q, the resolution must be at least 1s and at most the time kept", item)
+		}
+		if n := len(policy); n > 0 {
+			previous := policy[n-1]
+			if resolution <= previous.Resolution || resolution%previous.Resolution != 0 {
+				return nil, fmt.Errorf("invalid retention %q, the resolution must be a multiple of %s", item, previous.Resolution)
+			}
+			if previous.Keep < resolution {
+				return nil, fmt.Errorf("invalid retention %q, %s points must be kept for at least %s to be rolled up", item, previous.Resolution, resolution)
+			}
+		}
+		policy = append(policy, RetentionTier{Resolution: resolution, Keep: keep})
+	}
+	if len(policy) == 0 {
+		return nil, fmt.Errorf("empty retention policy")
+	}
+	return policy, nil
+}
+
+func (policy RetentionPolicy) String() string {
+	tiers := make([]string, len(policy))
+	for i, tier := range policy {
+		tiers[i] = formatRetentionDuration(tier.Resolution) + ":" + formatRetentionDuration(tier.Keep)
+	}
+	return strings.Join(tiers, ",")
+}
+
+// prefix keys of the points of the tier
+func (tier RetentionTier) prefix() string {
+	return fmt.Sprintf("%s%d/", historyPrefix, int64(tier.Resolution/time.Second))
+}
+
+// key of the point of the tier at t
+func (tier RetentionTier) key(t time.Time) string {
+	return fmt.Sprintf("%s%012d", tier.prefix(), t.Unix())
+}
+
+// historyKeyTime time of the point stored under key
+func historyKeyTime(key string) time.Time {
+	unix, _ := strconv.ParseInt(key[strings.LastIndex(key, "/")+1:], 10, 64)
+	return time.Unix(unix, 0)
+}
+
+// HistoryPoint : value of a series at a time
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// MetricHistory : broker metrics kept in a store, one key per point in
+// time with the values of all series. Compact rolls fine points up into
+// coarser tiers, drops expired points and keeps the store under maxBytes.
+type MetricHistory struct {
+	mutex    sync.Mutex
+	store    KVStore
+	policy   RetentionPolicy
+	maxBytes int64
+	// sizes of the history keys in the store, total their sum
+	sizes map[string]int
+	total int64
+}
+
+// NewMetricHistory keep the history in store, maxBytes 0 does not limit
+// its size
+func NewMetricHistory(store KVStore, policy RetentionPolicy, maxBytes int64) (*MetricHistory, error) {
+	history := &MetricHistory{store: store, policy: policy, maxBytes: maxBytes, sizes: map[string]int{}}
+	keys, err := store.Keys(historyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		value, _, err := store.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		history.sizes[key] = len(value)
+		history.total += int64(len(value))
+	}
+	return history, nil
+}
+
+// Size bytes of the stored history
+func (history *MetricHistory) Size() int64 {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	return history.total
+}
+
+// put store the values of a point, mutex must be held
+func (history *MetricHistory) put(key string, values map[string]float64) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := history.store.Put(key, data); err != nil {
+		return err
+	}
+	history.total += int64(len(data) - history.sizes[key])
+	history.sizes[key] = len(data)
+	return nil
+}
+
+// remove delete a point, mutex must be held
+func (history *MetricHistory) remove(key string) error {
+	if err := history.store.Delete(key); err != nil {
+		return err
+	}
+	history.total -= int64(history.sizes[key])
+	delete(history.sizes, key)
+	return nil
+}
+
+// keys sorted keys of the tier, mutex must be held
+func (history *MetricHistory) keys(tier RetentionTier) []string {
+	prefix := tier.prefix()
+	keys := []string{}
+	for key := range history.sizes {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Record store the samples as point of the finest tier
+func (history *MetricHistory) Record(samples []MetricSample, now time.Time) error {
+	values := map[string]float64{}
+	for _, sample := range samples {
+		values[seriesName(sample.Def.Name, sample.Labels)] = sample.Value
+	}
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	tier := history.policy[0]
+	return history.put(tier.key(now.Truncate(tier.Resolution)), values)
+}
+
+// Compact average the finished intervals of every tier from the points of
+// the previous one, delete points older than their tier keeps them and,
+// when the history exceeds its size, the oldest points of the finest tiers
+func (history *MetricHistory) Compact(now time.Time) error {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	for i := 1; i < len(history.policy); i++ {
+		if err := history.rollup(history.policy[i-1], history.policy[i], now); err != nil {
+			return err
+		}
+	}
+	for _, tier := range history.policy {
+		expired := now.Add(-tier.Keep)
+		for _, key := range history.keys(tier) {
+			if !historyKeyTime(key).Before(expired) {
+				break
+			}
+			if err := history.remove(key); err != nil {
+				return err
+			}
+		}
+	}
+	if history.maxBytes <= 0 {
+		return nil
+	}
+	for _, tier := range history.policy {
+		for _, key := range history.keys(tier) {
+			if history.total <= history.maxBytes {
+				return nil
+			}
+			if err := history.remove(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rollup average the points of finer into the intervals of tier that
+// ended and are not rolled up yet, mutex must be held
+func (history *MetricHistory) rollup(finer RetentionTier, tier RetentionTier, now time.Time) error {
+	done := time.Time{}
+	if keys := history.keys(tier); len(keys) > 0 {
+		done = historyKeyTime(keys[len(keys)-1]).Add(tier.Resolution)
+	}
+	end := now.Truncate(tier.Resolution)
+	sums, counts := map[int64]map[string]float64{}, map[int64]map[string]int{}
+	for _, key := range history.keys(finer) {
+		t := historyKeyTime(key)
+		if t.Before(done) || !t.Before(end) {
+			continue
+		}
+		var values map[string]float64
+		if _, err := getJSON(history.store, key, &values); err != nil {
+			return err
+		}
+		start := t.Truncate(tier.Resolution).Unix()
+		if sums[start] == nil {
+			sums[start], counts[start] = map[string]float64{}, map[string]int{}
+		}
+		for series, value := range values {
+			sums[start][series] += value
+			counts[start][series]++
+		}
+	}
+	for start, sum := range sums {
+		for series := range sum {
+			sum[series] /= float64(counts[start][series])
+		}
+		if err := history.put(tier.key(time.Unix(start, 0)), sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query the points of the series named metric, with any labels, between
+// from and to. The finest tier still holding from is used, its resolution
+// is returned with the series.
+func (history *MetricHistory) Query(metric string, from time.Time, to time.Time, now time.Time) (time.Duration, map[string][]HistoryPoint, error) {
+	history.mutex.Lock()
+	defer history.mutex.Unlock()
+	tier := history.policy[len(history.policy)-1]
+	for _, t := range history.policy {
+		if !from.Before(now.Add(-t.Keep)) {
+			tier = t
+			break
+		}
+	}
+	series := map[string][]HistoryPoint{}
+	for _, key := range history.keys(tier) {
+		t := historyKeyTime(key)
+		if t.Before(from) || t.After(to) {
+			continue
+		}
+		var values map[string]float64
+		if _, err := getJSON(history.store, key, &values); err != nil {
+			return 0, nil, err
+		}
+		for name, value := range values {
+			if name == metric || strings.HasPrefix(name, metric+"{") {
+				series[name] = append(series[name], HistoryPoint{Time: t, Value: value})
+			}
+		}
+	}
+	return tier.Resolution, series, nil
+}
+
+// seriesVhost value of the vhost label of a series name
+func seriesVhost(name string) (string, bool) {
+	return seriesLabel(name, "vhost")
+}
+
+// seriesLabel value of the label of a series name
+func seriesLabel(name string, label string) (string, bool) {
+	start := strings.Index(name, "{"+label+`="`)
+	if start < 0 {
+		start = strings.Index(name, ","+label+`="`)
+	}
+	if start < 0 {
+		return "", false
+	}
+	var value strings.Builder
+	escaped := false
+	for _, r := range name[start+len(label)+3:] {
+		switch {
+		case escaped:
+			if r == 'n' {
+				r = '\n'
+			}
+			value.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			return value.String(), true
+		default:
+			value.WriteRune(r)
+		}
+	}
+	return "", false
+}
+
+// RunHistory record the metrics of the latest snapshot at the finest
+// resolution until ctx is done
+func RunHistory(ctx context.Context, poller *Poller, history *MetricHistory) {
+	ticker := time.NewTicker(history.policy[0].Resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if snapshot := poller.Snapshot(); snapshot != nil {
+				if err := history.Record(BrokerMetrics(snapshot), now); err != nil {
+					subsystemLog("history").Warnf("recording metrics failed: %s", err)
+				}
+			}
+		}
+	}
+}
+
+// RunCompaction run the compaction jobs every interval until ctx is done
+func RunCompaction(ctx context.Context, interval time.Duration, jobs map[string]func(now time.Time) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for name, job := range jobs {
+				if err := job(now); err != nil {
+					subsystemLog("compaction").Warnf("compacting %s failed: %s", name, err)
+				}
+			}
+		}
+	}
+}
+
+// EnableHistory serve the metric history under /api/history
+func (server *Server) EnableHistory(history *MetricHistory) {
+	server.history = history
+	server.mux.HandleFunc("/api/history", server.handleHistory)
+}
+
+// handleHistory answer ?metric=name with the series of the metric since
+// ?since= (a duration, default 1h) or between ?from= and ?to= (rfc3339)
+func (server *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	if metric == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected ?metric="})
+		return
+	}
+	now := time.Now()
+	from, to := now.Add(-time.Hour), now
+	var err error
+	if since := query.Get("since"); since != "" {
+		var d time.Duration
+		if d, err = parseRetentionDuration(since); err == nil {
+			from = now.Add(-d)
+		}
+	}
+	if str := query.Get("from"); str != "" && err == nil {
+		from, err = time.Parse(time.RFC3339, str)
+	}
+	if str := query.Get("to"); str != "" && err == nil {
+		to, err = time.Parse(time.RFC3339, str)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	resolution, series, err := server.history.Query(metric, from, to, now)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if token, ok := requestToken(r); ok && len(token.Vhosts) > 0 {
+		// cluster wide series are hidden like the totals of the snapshot
+		for name := range series {
+			if vhost, ok := seriesVhost(name); !ok || !token.AllowsVhost(vhost) {
+				delete(series, name)
+			}
+		}
+	}
+	result := map[string]interface{}{"resolution": resolution.String(), "series": series}
+	if server.store != nil {
+		// deploys and incidents within the range annotate the charts
+		markers, err := Markers(server.store, from, to)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if token, ok := requestToken(r); ok {
+			markers = markers.Visible(token)
+		}
+		result["markers"] = markers
+	}
+	writeJSON(w, http.StatusOK, result)
+}
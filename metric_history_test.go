@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	policy, err := ParseRetentionPolicy(defaultRetention)
+	assert.Nil(t, err)
+	assert.Equal(t, RetentionPolicy{{10 * time.Second, 24 * time.Hour}, {5 * time.Minute, 30 * 24 * time.Hour}}, policy)
+	assert.Equal(t, "10s:1d,5m:30d", policy.String())
+	for _, str := range []string{"", "10s", "0s:1h", "1m:10s", "10s:1h,15s:1d", "10s:1m,5m:1d", "10s:1h,5m:xd"} {
+		_, err := ParseRetentionPolicy(str)
+		assert.NotNil(t, err, str)
+	}
+}
+
+func TestMetricHistory(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	defer store.Close()
+	policy, _ := ParseRetentionPolicy("10s:2m,1m:10m")
+	history, err := NewMetricHistory(store, policy, 0)
+	assert.Nil(t, err)
+
+	start := time.Unix(1577880000, 0)
+	sample := func(value float64) []MetricSample {
+		return []MetricSample{
+			{metricMessages, nil, value},
+			{metricQueueMessages, []MetricLabel{{"vhost", "prod"}, {"queue", "a"}}, value * 2},
+		}
+	}
+	for i := 0; i < 12; i++ {
+		assert.Nil(t, history.Record(sample(float64(i)), start.Add(time.Duration(i)*10*time.Second)))
+	}
+	assert.Nil(t, history.Compact(start.Add(2*time.Minute)))
+	resolution, series, err := history.Query("messages", start, start.Add(time.Hour), start.Add(2*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, resolution)
+	assert.Equal(t, 12, len(series["messages"]))
+
+	// the first minute is rolled up, raw points older than 2m expire
+	assert.Nil(t, history.Compact(start.Add(5*time.Minute)))
+	resolution, series, _ = history.Query("messages", start, start.Add(time.Hour), start.Add(5*time.Minute))
+	assert.Equal(t, time.Minute, resolution)
+	assert.Equal(t, []HistoryPoint{{start, 2.5}, {start.Add(time.Minute), 8.5}}, series["messages"])
+	_, series, _ = history.Query("queue_messages", start, start.Add(time.Hour), start.Add(5*time.Minute))
+	assert.Equal(t, 17.0, series[`queue_messages{vhost="prod",queue="a"}`][1].Value)
+
+	reopened, err := NewMetricHistory(store, policy, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, history.Size(), reopened.Size())
+	assert.Nil(t, reopened.Compact(start.Add(5*time.Minute)))
+	assert.Equal(t, int64(0), reopened.Size())
+}
+
+func TestSeriesVhost(t *testing.T) {
+	vhost, ok := seriesVhost(`queue_messages{vhost="a\"b",queue="q"}`)
+	assert.True(t, ok)
+	assert.Equal(t, `a"b`, vhost)
+	_, ok = seriesVhost("messages")
+	assert.False(t, ok)
+}
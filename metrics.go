@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// writeMetric write a single metric in prometheus text format
+func writeMetric(w io.Writer, name string, kind string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
+
+// writeSummary write latency percentiles as prometheus summary
+func writeSummary(w io.Writer, name string, help string, quantiles []float64, values []time.Duration, sum time.Duration, count int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s summary\n", name, help, name)
+	for i, q := range quantiles {
+		fmt.Fprintf(w, "%s{quantile=\"%g\"} %g\n", name, q/100, values[i].Seconds())
+	}
+	fmt.Fprintf(w, "%s_sum %g\n", name, sum.Seconds())
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeSamples write broker metrics in prometheus text format. Samples are
+// grouped by metric, counters get the _total suffix.
+func writeSamples(w io.Writer, prefix string, samples []MetricSample) {
+	var defs []MetricDef
+	grouped := map[string][]MetricSample{}
+	for _, sample := range samples {
+		if _, ok := grouped[sample.Def.Name]; !ok {
+			defs = append(defs, sample.Def)
+		}
+		grouped[sample.Def.Name] = append(grouped[sample.Def.Name], sample)
+	}
+	for _, def := range defs {
+		name := prefix + def.Name
+		if def.Kind == "counter" {
+			name += "_total"
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, def.Help, name, def.Kind)
+		for _, sample := range grouped[def.Name] {
+			fmt.Fprintf(w, "%s %g\n", seriesName(name, sample.Labels), sample.Value)
+		}
+	}
+}
+
+// seriesName metric name with its labels in prometheus notation, like
+// queue_messages{vhost="/",queue="orders"}
+func seriesName(name string, labels []MetricLabel) string {
+	if len(labels) == 0 {
+		return name
+	}
+	pairs := make([]string, len(labels))
+	for i, label := range labels {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, label.Name, labelEscaper.Replace(label.Value))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// writeRuntimeMetrics go runtime metrics of the process
+func writeRuntimeMetrics(w io.Writer) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	writeMetric(w, "go_goroutines", "gauge", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	writeMetric(w, "go_memstats_heap_alloc_bytes", "gauge", "Number of heap bytes allocated and still in use.", float64(mem.HeapAlloc))
+	writeMetric(w, "go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use.", float64(mem.HeapInuse))
+	writeMetric(w, "go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.", float64(mem.Sys))
+	writeMetric(w, "go_gc_cycles_total", "counter", "Number of completed GC cycles.", float64(mem.NumGC))
+	writeMetric(w, "go_gc_pause_seconds_total", "counter", "Total GC pause time.", float64(mem.PauseTotalNs)/1e9)
+}
+
+// handleMetrics runtime metrics and the staleness of the broker snapshot
+func (server *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeRuntimeMetrics(w)
+	writeMetric(w, "radish_snapshot_age_seconds", "gauge",
+		"Age of the last successful broker snapshot, -1 before the first one.", server.poller.Staleness().Seconds())
+	ready := 0.0
+	if server.poller.Ready() {
+		ready = 1
+	}
+	writeMetric(w, "radish_ready", "gauge", "Whether a recent broker snapshot is available.", ready)
+	if snapshot := server.snapshot(r); snapshot != nil {
+		writeSamples(w, "radish_", BrokerMetrics(snapshot))
+	}
+	if server.canary != nil {
+		report := server.canary.Report()
+		writeSummary(w, "radish_canary_round_trip_seconds", "Publish to consume latency of canary messages.",
+			report.Quantiles, report.RoundTrip, server.canary.RoundTrip.Sum(), server.canary.RoundTrip.Count())
+		writeSummary(w, "radish_canary_confirm_seconds", "Publish confirm latency of canary messages.",
+			report.Quantiles, report.Confirm, server.canary.Confirm.Sum(), server.canary.Confirm.Count())
+		writeMetric(w, "radish_canary_lost_total", "counter", "Canary messages lost or timed out.", float64(report.Lost))
+	}
+	if server.slos != nil {
+		if list, err := server.slos.Status(time.Now()); err == nil {
+			writeSamples(w, "radish_", list.Samples())
+		}
+	}
+}
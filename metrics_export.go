@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// QueueMetricsRow : metrics of one queue at one point in time
+type QueueMetricsRow struct {
+	Timestamp   int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Vhost       string  `parquet:"name=vhost, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Name        string  `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Node        string  `parquet:"name=node, type=BYTE_ARRAY, convertedtype=UTF8"`
+	State       string  `parquet:"name=state, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Messages    int64   `parquet:"name=messages, type=INT64"`
+	Ready       int64   `parquet:"name=messages_ready, type=INT64"`
+	Unacked     int64   `parquet:"name=messages_unacknowledged, type=INT64"`
+	Bytes       int64   `parquet:"name=message_bytes, type=INT64"`
+	Memory      int64   `parquet:"name=memory, type=INT64"`
+	Consumers   int64   `parquet:"name=consumers, type=INT64"`
+	PublishRate float64 `parquet:"name=publish_rate, type=DOUBLE"`
+	DeliverRate float64 `parquet:"name=deliver_get_rate, type=DOUBLE"`
+}
+
+// ConnectionMetricsRow : metrics of one connection at one point in time
+type ConnectionMetricsRow struct {
+	Timestamp int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Name      string  `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Node      string  `parquet:"name=node, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Vhost     string  `parquet:"name=vhost, type=BYTE_ARRAY, convertedtype=UTF8"`
+	User      string  `parquet:"name=user, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Protocol  string  `parquet:"name=protocol, type=BYTE_ARRAY, convertedtype=UTF8"`
+	State     string  `parquet:"name=state, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Product   string  `parquet:"name=product, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Channels  int64   `parquet:"name=channels, type=INT64"`
+	RecvOct   int64   `parquet:"name=recv_oct, type=INT64"`
+	SendOct   int64   `parquet:"name=send_oct, type=INT64"`
+	RecvRate  float64 `parquet:"name=recv_rate, type=DOUBLE"`
+	SendRate  float64 `parquet:"name=send_rate, type=DOUBLE"`
+}
+
+// QueueMetricsRows one row per queue. Rates are the ones computed by radish,
+// the broker's are used until two samples were taken.
+func QueueMetricsRows(info rabtap.BrokerInfo, rates ClientRates, at time.Time) []QueueMetricsRow {
+	rows := make([]QueueMetricsRow, 0, len(info.Queues))
+	for _, q := range info.Queues {
+		publish, deliver := q.MessageStats.PublishDetails.Rate, q.MessageStats.DeliverGetDetails.Rate
+		if r, ok := rates.Queues[q.Vhost+"/"+q.Name]; ok {
+			publish, deliver = r.Publish, r.DeliverGet
+		}
+		rows = append(rows, QueueMetricsRow{
+			Timestamp: at.UnixNano() / int64(time.Millisecond), Vhost: q.Vhost, Name: q.Name, Node: q.Node, State: q.State,
+			Messages: int64(q.Messages), Ready: int64(q.MessagesReady), Unacked: int64(q.MessagesUnacknowledged),
+			Bytes: int64(q.MessageBytes), Memory: int64(q.Memory), Consumers: int64(q.Consumers),
+			PublishRate: publish, DeliverRate: deliver,
+		})
+	}
+	return rows
+}
+
+// ConnectionMetricsRows one row per connection
+func ConnectionMetricsRows(info rabtap.BrokerInfo, rates ClientRates, at time.Time) []ConnectionMetricsRow {
+	rows := make([]ConnectionMetricsRow, 0, len(info.Connections))
+	for _, c := range info.Connections {
+		r := rates.Connections[c.Name]
+		rows = append(rows, ConnectionMetricsRow{
+			Timestamp: at.UnixNano() / int64(time.Millisecond), Name: c.Name, Node: c.Node, Vhost: c.Vhost, User: c.User,
+			Protocol: c.Protocol, State: c.State, Product: c.ClientProperties.Product, Channels: int64(c.Channels),
+			RecvOct: int64(c.RecvOct), SendOct: int64(c.SendOct), RecvRate: r.Recv, SendRate: r.Send,
+		})
+	}
+	return rows
+}
+
+// metricsWriter write queue and connection rows to a file
+type metricsWriter interface {
+	Extension() string
+	WriteQueues(file string, rows []QueueMetricsRow) error
+	WriteConnections(file string, rows []ConnectionMetricsRow) error
+}
+
+// metricsWriters writers by format, parquet is only available when built
+// with -tags parquet
+var metricsWriters = map[string]metricsWriter{"csv": csvMetricsWriter{}}
+
+// csvMetricsWriter : csv files with a header line
+type csvMetricsWriter struct{}
+
+func (csvMetricsWriter) Extension() string { return ".csv" }
+
+func formatFloat(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+func (w csvMetricsWriter) WriteQueues(file string, rows []QueueMetricsRow) error {
+	records := [][]string{{"timestamp", "vhost", "name", "node", "state", "messages", "messages_ready",
+		"messages_unacknowledged", "message_bytes", "memory", "consumers", "publish_rate", "deliver_get_rate"}}
+	for _, r := range rows {
+		records = append(records, []string{
+			time.Unix(0, r.Timestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339), r.Vhost, r.Name, r.Node, r.State,
+			fmt.Sprint(r.Messages), fmt.Sprint(r.Ready), fmt.Sprint(r.Unacked), fmt.Sprint(r.Bytes), fmt.Sprint(r.Memory),
+			fmt.Sprint(r.Consumers), formatFloat(r.PublishRate), formatFloat(r.DeliverRate),
+		})
+	}
+	return writeCSVFile(file, records)
+}
+
+func (w csvMetricsWriter) WriteConnections(file string, rows []ConnectionMetricsRow) error {
+	records := [][]string{{"timestamp", "name", "node", "vhost", "user", "protocol", "state", "product",
+		"channels", "recv_oct", "send_oct", "recv_rate", "send_rate"}}
+	for _, r := range rows {
+		records = append(records, []string{
+			time.Unix(0, r.Timestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339), r.Name, r.Node, r.Vhost, r.User,
+			r.Protocol, r.State, r.Product, fmt.Sprint(r.Channels), fmt.Sprint(r.RecvOct), fmt.Sprint(r.SendOct),
+			formatFloat(r.RecvRate), formatFloat(r.SendRate),
+		})
+	}
+	return writeCSVFile(file, records)
+}
+
+func writeCSVFile(file string, records [][]string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(records); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// MetricsExport : periodic export of queue and connection metrics into files
+// partitioned by date and hour, e.g. queues/date=2020-05-01/hour=13/...
+type MetricsExport struct {
+	Dir     string
+	writer  metricsWriter
+	tracker *RateTracker
+}
+
+// NewMetricsExport create an export writing the given format below dir
+func NewMetricsExport(dir string, format string) (*MetricsExport, error) {
+	writer, ok := metricsWriters[format]
+	if !ok {
+		if format == "parquet" {
+			return nil, fmt.Errorf("radish was built without parquet support, rebuild with -tags parquet")
+		}
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return &MetricsExport{Dir: dir, writer: writer, tracker: NewRateTracker()}, nil
+}
+
+// partition file of kind for the sample taken at, creating its directory
+func (export *MetricsExport) partition(kind string, at time.Time) (string, error) {
+	at = at.UTC()
+	dir := filepath.Join(export.Dir, kind, "date="+at.Format("2006-01-02"), "hour="+at.Format("15"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, kind+"-"+at.Format("20060102T150405Z")+export.writer.Extension()), nil
+}
+
+// Write one sample of info taken at, returns the written files
+func (export *MetricsExport) Write(info rabtap.BrokerInfo, at time.Time) ([]string, error) {
+	export.tracker.Update(ResourceQueues, info, at)
+	rates := export.tracker.Update(ResourceConnections, info, at)
+	queues, err := export.partition("queues", at)
+	if err != nil {
+		return nil, err
+	}
+	if err := export.writer.WriteQueues(queues, QueueMetricsRows(info, rates, at)); err != nil {
+		return nil, err
+	}
+	conns, err := export.partition("connections", at)
+	if err != nil {
+		return nil, err
+	}
+	if err := export.writer.WriteConnections(conns, ConnectionMetricsRows(info, rates, at)); err != nil {
+		return nil, err
+	}
+	return []string{queues, conns}, nil
+}
+
+// MetricsExportResult : files written by an export
+type MetricsExportResult struct {
+	Files []string `json:"files"`
+}
+
+func init() {
+	registerCommand("export-metrics", "[--dir d] [--format csv|parquet] [--interval d] write queue and connection metrics files", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("export-metrics")
+		dir := flags.String("dir", "metrics", "directory to write the partitions to")
+		format := flags.String("format", "csv", "csv or parquet")
+		interval := flags.Duration("interval", 0, "keep exporting with this interval")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		export, err := NewMetricsExport(*dir, *format)
+		if err != nil {
+			return nil, usageError("export-metrics: %s", err)
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		result := MetricsExportResult{}
+		files, err := export.Write(rabbitmq.info(), time.Now())
+		if err != nil {
+			return nil, err
+		}
+		result.Files = append(result.Files, files...)
+		if *interval <= 0 {
+			return result, nil
+		}
+
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		return result, exportEvery(ctx, *interval, func() error {
+			if err := rabbitmq.UpdateBrokerInfoContext(ctx); err != nil {
+				subsystemLog("export").Warnf("fetching broker info failed: %s", err)
+				return nil
+			}
+			files, err := export.Write(rabbitmq.info(), time.Now())
+			result.Files = append(result.Files, files...)
+			return err
+		})
+	})
+}
+
+// exportEvery run export every interval until ctx is done or it fails
+func exportEvery(ctx context.Context, interval time.Duration, export func() error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := export(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// +build parquet
+
+package main
+
+import (
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+func init() {
+	metricsWriters["parquet"] = parquetMetricsWriter{}
+}
+
+// parquetMetricsWriter : parquet files, one row group per file
+type parquetMetricsWriter struct{}
+
+func (parquetMetricsWriter) Extension() string { return ".parquet" }
+
+func writeParquetFile(file string, schema interface{}, write func(pw *writer.ParquetWriter) error) error {
+	fw, err := local.NewLocalFileWriter(file)
+	if err != nil {
+		return err
+	}
+	pw, err := writer.NewParquetWriter(fw, schema, 1)
+	if err != nil {
+		fw.Close()
+		return err
+	}
+	if err := write(pw); err != nil {
+		fw.Close()
+		return err
+	}
+	if err := pw.WriteStop(); err != nil {
+		fw.Close()
+		return err
+	}
+	return fw.Close()
+}
+
+func (parquetMetricsWriter) WriteQueues(file string, rows []QueueMetricsRow) error {
+	return writeParquetFile(file, new(QueueMetricsRow), func(pw *writer.ParquetWriter) error {
+		for _, row := range rows {
+			if err := pw.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (parquetMetricsWriter) WriteConnections(file string, rows []ConnectionMetricsRow) error {
+	return writeParquetFile(file, new(ConnectionMetricsRow), func(pw *writer.ParquetWriter) error {
+		for _, row := range rows {
+			if err := pw.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
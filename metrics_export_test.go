@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsExportCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radish")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	export, err := NewMetricsExport(dir, "csv")
+	assert.Nil(t, err)
+
+	info := rabtap.BrokerInfo{
+		Queues:      []rabtap.RabbitQueue{{Vhost: "/", Name: "orders", Messages: 3}},
+		Connections: []rabtap.RabbitConnection{{Name: "c1", RecvOct: 100}},
+	}
+	at := time.Date(2020, 5, 1, 13, 4, 5, 0, time.UTC)
+	_, err = export.Write(info, at)
+	assert.Nil(t, err)
+	info.Queues[0].MessageStats.Publish = 50
+	info.Connections[0].RecvOct = 1100
+	files, err := export.Write(info, at.Add(10*time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "queues", "date=2020-05-01", "hour=13", "queues-20200501T130415Z.csv"), files[0])
+
+	data, err := ioutil.ReadFile(files[0])
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, "2020-05-01T13:04:15Z,/,orders,,,3,0,0,0,0,0,5,0", lines[1])
+	data, err = ioutil.ReadFile(files[1])
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), ",1100,0,100,0\n")
+}
+
+func TestNewMetricsExportFormats(t *testing.T) {
+	_, err := NewMetricsExport("x", "xml")
+	assert.EqualError(t, err, `unknown format "xml"`)
+}
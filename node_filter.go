@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// matchNode true if the filter is empty, the full node name or the host part
+// of it, so "node3" matches "rabbit@node3"
+func matchNode(node string, filter string) bool {
+	if filter == "" || node == filter {
+		return true
+	}
+	if i := strings.Index(node, "@"); i >= 0 && !strings.Contains(filter, "@") {
+		return node[i+1:] == filter
+	}
+	return false
+}
+
+// FilterBrokerInfoByNode keep the queues, connections and consumers running on
+// node. Exchanges and bindings are cluster wide and kept as they are.
+func FilterBrokerInfoByNode(info rabtap.BrokerInfo, node string) rabtap.BrokerInfo {
+	if node == "" {
+		return info
+	}
+	res := info
+	res.Queues = []rabtap.RabbitQueue{}
+	for _, queue := range info.Queues {
+		if matchNode(queue.Node, node) {
+			res.Queues = append(res.Queues, queue)
+		}
+	}
+	res.Connections = []rabtap.RabbitConnection{}
+	for _, conn := range info.Connections {
+		if matchNode(conn.Node, node) {
+			res.Connections = append(res.Connections, conn)
+		}
+	}
+	res.Consumers = []rabtap.RabbitConsumer{}
+	for _, consumer := range info.Consumers {
+		if matchNode(consumer.ChannelDetails.Node, node) {
+			res.Consumers = append(res.Consumers, consumer)
+		}
+	}
+	return res
+}
+
+// Channels list the channels of all connections
+func (client *ManagementClient) Channels() ([]RabbitChannel, error) {
+	var channels []RabbitChannel
+	err := client.get("channels", &channels)
+	return channels, err
+}
+
+// ChannelList : channels listing
+type ChannelList struct {
+	Channels []RabbitChannel `json:"channels"`
+}
+
+// Table channels as table
+func (list ChannelList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"NAME", "NODE", "USER", "VHOST", "STATE", "CONSUMERS", "PREFETCH", "UNACKED", "UNCONFIRMED"}}
+	for _, channel := range list.Channels {
+		color := None
+		if channel.State == "flow" {
+			color = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: channel.Name},
+			{Text: orDash(channel.Node)},
+			{Text: orDash(channel.User)},
+			{Text: orDash(channel.Vhost)},
+			{Text: orDash(channel.State), Color: color},
+			{Text: format.Count(int64(channel.ConsumerCount))},
+			{Text: format.Count(int64(channel.PrefetchCount))},
+			{Text: format.Count(int64(channel.MessagesUnacknowledged))},
+			{Text: format.Count(int64(channel.MessagesUnconfirmed))},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("channels", "[--vhost v] [--node n] list channels", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("channels")
+		vhost := flags.String("vhost", "", "only channels of this vhost")
+		node := flags.String("node", "", "only channels on this node")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = NormalizeVhost(*vhost)
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		channels, err := rabbitmq.management().Channels()
+		if err != nil {
+			return nil, err
+		}
+		list := ChannelList{Channels: []RabbitChannel{}}
+		for _, channel := range channels {
+			if (*vhost == "" || channel.Vhost == *vhost) && matchNode(channel.Node, *node) {
+				list.Channels = append(list.Channels, channel)
+			}
+		}
+		return list, nil
+	})
+}
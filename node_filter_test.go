@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchNode(t *testing.T) {
+	assert.True(t, matchNode("rabbit@node3", ""))
+	assert.True(t, matchNode("rabbit@node3", "rabbit@node3"))
+	assert.True(t, matchNode("rabbit@node3", "node3"))
+	assert.False(t, matchNode("rabbit@node3", "hare@node3"))
+	assert.False(t, matchNode("rabbit@node33", "node3"))
+}
+
+func TestFilterBrokerInfoByNode(t *testing.T) {
+	info := rabtap.BrokerInfo{
+		Queues:      []rabtap.RabbitQueue{{Name: "q1", Node: "rabbit@a"}, {Name: "q2", Node: "rabbit@b"}},
+		Connections: []rabtap.RabbitConnection{{Name: "c1", Node: "rabbit@b"}},
+		Exchanges:   []rabtap.RabbitExchange{{Name: "x"}},
+		Consumers:   make([]rabtap.RabbitConsumer, 2),
+	}
+	info.Consumers[0].ChannelDetails.Node = "rabbit@a"
+	filtered := FilterBrokerInfoByNode(info, "a")
+	assert.Equal(t, []rabtap.RabbitQueue{info.Queues[0]}, filtered.Queues)
+	assert.Empty(t, filtered.Connections)
+	assert.Len(t, filtered.Consumers, 1)
+	assert.Equal(t, info.Exchanges, filtered.Exchanges)
+	assert.Equal(t, info, FilterBrokerInfoByNode(info, ""))
+}
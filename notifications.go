@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Broadcaster : fan out of values to subscribers that are too slow are
+// skipped rather than blocking the publisher
+type Broadcaster struct {
+	mutex       sync.Mutex
+	subscribers map[chan interface{}]bool
+}
+
+// NewBroadcaster create a broadcaster without subscribers
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: map[chan interface{}]bool{}}
+}
+
+// Subscribe receive all values published from now on until cancel is called
+func (broadcaster *Broadcaster) Subscribe() (<-chan interface{}, func()) {
+	ch := make(chan interface{}, 64)
+	broadcaster.mutex.Lock()
+	broadcaster.subscribers[ch] = true
+	broadcaster.mutex.Unlock()
+	return ch, func() {
+		broadcaster.mutex.Lock()
+		defer broadcaster.mutex.Unlock()
+		if broadcaster.subscribers[ch] {
+			delete(broadcaster.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish send v to all subscribers
+func (broadcaster *Broadcaster) Publish(v interface{}) {
+	broadcaster.mutex.Lock()
+	defer broadcaster.mutex.Unlock()
+	for ch := range broadcaster.subscribers {
+		select {
+		case ch <- v:
+		default:
+		}
+	}
+}
+
+// EnableAlerts serve the notification center of engine under /api/alerts
+func (server *Server) EnableAlerts(engine *AlertEngine) {
+	server.alerts = engine
+	server.mux.HandleFunc("/api/alerts", server.handleAlerts)
+	server.mux.HandleFunc("/api/alerts/", server.handleAlerts)
+}
+
+// visibleAlert the token of r may see alerts of the vhost, alerts without
+// vhost concern the whole cluster
+func visibleAlert(r *http.Request, vhost string) bool {
+	token, ok := requestToken(r)
+	return !ok || vhost == "" || token.AllowsVhost(vhost)
+}
+
+// visibleAlerts the alerts the token of r may see
+func visibleAlerts(r *http.Request, alerts []Alert) []Alert {
+	visible := []Alert{}
+	for _, alert := range alerts {
+		if visibleAlert(r, alert.Vhost) {
+			visible = append(visible, alert)
+		}
+	}
+	return visible
+}
+
+// handleAlerts the active alerts under /api/alerts, the fired and resolved
+// ones under /api/alerts/history and their changes as they happen over a
+// websocket under /api/alerts/stream. POST /api/alerts/<id>/ack and
+// /api/alerts/<id>/silence with {"duration": "1h"} mute an alert. Tokens
+// only see and mute the alerts of their vhosts.
+func (server *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/alerts"), "/")
+	switch {
+	case path == "":
+		writeJSON(w, http.StatusOK, visibleAlerts(r, server.alerts.Active()))
+	case path == "history":
+		writeJSON(w, http.StatusOK, visibleAlerts(r, server.alerts.History()))
+	case path == "maintenance":
+		windows := []MaintenanceWindow{}
+		for _, window := range server.alerts.Maintenance(time.Now()) {
+			visible := len(window.Vhosts) == 0
+			for _, vhost := range window.Vhosts {
+				visible = visible || visibleAlert(r, vhost)
+			}
+			if visible {
+				windows = append(windows, window)
+			}
+		}
+		writeJSON(w, http.StatusOK, windows)
+	case path == "stream":
+		websocket.Server{Handshake: sameOrigin, Handler: server.streamAlerts}.ServeHTTP(w, r)
+	case strings.HasSuffix(path, "/ack") || strings.HasSuffix(path, "/silence"):
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+			return
+		}
+		parts := strings.SplitN(path, "/", 2)
+		for _, active := range server.alerts.Active() {
+			if active.ID == parts[0] && !visibleAlert(r, active.Vhost) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("alert %s is in a vhost the token may not see", active.ID)})
+				return
+			}
+		}
+		var alert Alert
+		var err error
+		if parts[1] == "ack" {
+			alert, err = server.alerts.Ack(parts[0], requestUser(r))
+		} else {
+			var req struct {
+				Duration string `json:"duration"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			duration, err := time.ParseDuration(req.Duration)
+			if err != nil || duration <= 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected a positive duration like 1h"})
+				return
+			}
+			alert, err = server.alerts.Silence(parts[0], time.Now().Add(duration))
+		}
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, alert)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+// streamAlerts send the active alerts, then every change until the client
+// goes away
+func (server *Server) streamAlerts(ws *websocket.Conn) {
+	changes, cancel := server.alerts.Changes.Subscribe()
+	defer cancel()
+	closed := make(chan struct{})
+	go func() {
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		close(closed)
+	}()
+	for _, alert := range visibleAlerts(ws.Request(), server.alerts.Active()) {
+		if websocket.JSON.Send(ws, AlertChange{Type: "active", Alert: alert}) != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case change := <-changes:
+			if alertChange, ok := change.(AlertChange); ok && !visibleAlert(ws.Request(), alertChange.Alert.Vhost) {
+				continue
+			}
+			if websocket.JSON.Send(ws, change) != nil {
+				return
+			}
+		}
+	}
+}
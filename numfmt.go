@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NumberFormat formats counts, sizes and rates for display, humanized unless Raw
+type NumberFormat struct {
+	Raw bool
+}
+
+var countUnits = []string{"", "k", "M", "G", "T"}
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+
+// precision decimals value is shown with: none for large values, one for
+// small ones and up to three for small non-zero fractions, so a rate of
+// 0.04 is not shown as 0
+func precision(value float64) int {
+	abs := math.Abs(value)
+	switch {
+	case abs >= 100:
+		return 0
+	case abs == 0 || abs >= 0.05:
+		return 1
+	}
+	digits := 1
+	for digits < 3 && abs*math.Pow(10, float64(digits)) < 0.5 {
+		digits++
+	}
+	return digits
+}
+
+// humanize value in units of base, e.g. 1.2 and the index of M. The value
+// is rounded before the unit is chosen, 999960 is 1M and not 1000k.
+func humanize(value float64, base float64, units int) (string, int) {
+	unit := 0
+	for {
+		digits := precision(value)
+		scale := math.Pow(10, float64(digits))
+		rounded := math.Round(value*scale) / scale
+		if math.Abs(rounded) >= base && unit < units-1 {
+			value /= base
+			unit++
+			continue
+		}
+		if rounded == 0 && value != 0 {
+			return "<0.001", unit
+		}
+		s := strconv.FormatFloat(rounded, 'f', digits, 64)
+		if digits > 0 {
+			s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+		}
+		return s, unit
+	}
+}
+
+// Count format a number of messages or objects, e.g. 1.2M
+func (f NumberFormat) Count(n int64) string {
+	if f.Raw {
+		return strconv.FormatInt(n, 10)
+	}
+	value, unit := humanize(float64(n), 1000, len(countUnits))
+	return value + countUnits[unit]
+}
+
+// Bytes format a size in bytes, e.g. 3.4 GiB
+func (f NumberFormat) Bytes(n int64) string {
+	if f.Raw {
+		return strconv.FormatInt(n, 10)
+	}
+	value, unit := humanize(float64(n), 1024, len(byteUnits))
+	return value + " " + byteUnits[unit]
+}
+
+// Rate format a per second rate, e.g. 2.5k msg/s
+func (f NumberFormat) Rate(rate float64, unit string) string {
+	if f.Raw {
+		return fmt.Sprintf("%g %s/s", rate, unit)
+	}
+	value, i := humanize(rate, 1000, len(countUnits))
+	return value + countUnits[i] + " " + unit + "/s"
+}
+
+// Float format a value that may have fractions like a count, e.g. 2.5k
+func (f NumberFormat) Float(value float64) string {
+	if f.Raw {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	text, unit := humanize(value, 1000, len(countUnits))
+	return text + countUnits[unit]
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNumberFormat(t *testing.T) {
+	human := NumberFormat{}
+	assert.Equal(t, "12", human.Count(12))
+	assert.Equal(t, "1.2M", human.Count(1234567))
+	assert.Equal(t, "999", human.Count(999))
+	assert.Equal(t, "1k", human.Count(1000))
+	assert.Equal(t, "3.4 GiB", human.Bytes(3650722202))
+	assert.Equal(t, "512 B", human.Bytes(512))
+	assert.Equal(t, "2.5k msg/s", human.Rate(2500, "msg"))
+	assert.Equal(t, "0.2 msg/s", human.Rate(0.2, "msg"))
+
+	// rounding promotes to the next unit
+	assert.Equal(t, "1M", human.Count(999960))
+	assert.Equal(t, "999k", human.Count(999499))
+	assert.Equal(t, "1 MiB", human.Bytes(1048575))
+	assert.Equal(t, "1023 B", human.Bytes(1023))
+	assert.Equal(t, "1 KiB", human.Bytes(1024))
+	assert.Equal(t, "1k msg/s", human.Rate(999.96, "msg"))
+	// small rates keep a significant digit
+	assert.Equal(t, "0.04 msg/s", human.Rate(0.04, "msg"))
+	assert.Equal(t, "0.004 msg/s", human.Rate(0.004, "msg"))
+	assert.Equal(t, "<0.001 msg/s", human.Rate(0.0001, "msg"))
+	assert.Equal(t, "0 msg/s", human.Rate(0, "msg"))
+	assert.Equal(t, "2.5", human.Float(2.5))
+
+	raw := NumberFormat{Raw: true}
+	assert.Equal(t, "1234567", raw.Count(1234567))
+	assert.Equal(t, "3650722202", raw.Bytes(3650722202))
+	assert.Equal(t, "2500 msg/s", raw.Rate(2500, "msg"))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// object kinds of find
+const (
+	ObjectQueue    = "queue"
+	ObjectExchange = "exchange"
+	ObjectBinding  = "binding"
+	ObjectUser     = "user"
+)
+
+// ObjectQuery : what find looks for, a name or a regular expression
+// matched against the names of the objects of Kinds
+type ObjectQuery struct {
+	Name  string
+	Regex *regexp.Regexp
+	Kinds []string
+	Vhost string
+}
+
+// ParseObjectQuery a query for name, a regular expression when regex is
+// set, in the comma separated kinds or all
+func ParseObjectQuery(name string, regex bool, kinds string, vhost string) (ObjectQuery, error) {
+	query := ObjectQuery{Name: name, Vhost: NormalizeVhost(vhost), Kinds: splitList(kinds)}
+	if len(query.Kinds) == 0 {
+		query.Kinds = []string{ObjectQueue, ObjectExchange, ObjectBinding, ObjectUser}
+	}
+	for _, kind := range query.Kinds {
+		switch kind {
+		case ObjectQueue, ObjectExchange, ObjectBinding, ObjectUser:
+		default:
+			return query, fmt.Errorf("unknown kind %q, expected queue, exchange, binding or user", kind)
+		}
+	}
+	if regex {
+		var err error
+		if query.Regex, err = regexp.Compile(name); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+// Matches the name is the one looked for
+func (query ObjectQuery) Matches(name string) bool {
+	if query.Regex != nil {
+		return query.Regex.MatchString(name)
+	}
+	return name == query.Name
+}
+
+// in the vhost is searched
+func (query ObjectQuery) in(vhost string) bool {
+	return query.Vhost == "" || query.Vhost == vhost
+}
+
+// ObjectLocation : where a found object lives
+type ObjectLocation struct {
+	Profile string `json:"profile,omitempty"`
+	Cluster string `json:"cluster,omitempty"`
+	Kind    string `json:"kind"`
+	Vhost   string `json:"vhost,omitempty"`
+	Name    string `json:"name"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// FindObjects the objects of a broker matching the query. Bindings match
+// by source or destination, users are located in every vhost they have
+// permissions in.
+func FindObjects(query ObjectQuery, info rabtap.BrokerInfo, users []RabbitUser, permissions []RabbitPermission) []ObjectLocation {
+	found := []ObjectLocation{}
+	add := func(kind string, vhost string, name string, detail string) {
+		found = append(found, ObjectLocation{Cluster: info.Overview.ClusterName, Kind: kind, Vhost: vhost, Name: name, Detail: detail})
+	}
+	for _, kind := range query.Kinds {
+		switch kind {
+		case ObjectQueue:
+			for _, queue := range info.Queues {
+				if query.in(queue.Vhost) && query.Matches(queue.Name) {
+					add(kind, queue.Vhost, queue.Name, fmt.Sprintf("%d messages, %d consumers on %s", queue.Messages, queue.Consumers, orDash(queue.Node)))
+				}
+			}
+		case ObjectExchange:
+			for _, exchange := range info.Exchanges {
+				if exchange.Name != "" && query.in(exchange.Vhost) && query.Matches(exchange.Name) {
+					add(kind, exchange.Vhost, exchange.Name, exchange.Type)
+				}
+			}
+		case ObjectBinding:
+			for _, binding := range info.Bindings {
+				if !query.in(binding.Vhost) || !(query.Matches(binding.Source) || query.Matches(binding.Destination)) {
+					continue
+				}
+				add(kind, binding.Vhost, fmt.Sprintf("%s -> %s", orDash(binding.Source), binding.Destination),
+					fmt.Sprintf("%s, routing key %q", binding.DestinationType, binding.RoutingKey))
+			}
+		case ObjectUser:
+			for _, user := range users {
+				if !query.Matches(user.Name) {
+					continue
+				}
+				tags := orDash(strings.Join(user.TagList(), ","))
+				located := false
+				for _, permission := range permissions {
+					if permission.User == user.Name && query.in(permission.Vhost) {
+						add(kind, permission.Vhost, user.Name, fmt.Sprintf("tags %s, configure %q write %q read %q", tags, permission.Configure, permission.Write, permission.Read))
+						located = true
+					}
+				}
+				if !located && query.Vhost == "" {
+					add(kind, "", user.Name, fmt.Sprintf("tags %s, no permissions", tags))
+				}
+			}
+		}
+	}
+	return found
+}
+
+// ObjectSearch : the objects found on every searched broker
+type ObjectSearch struct {
+	Locations []ObjectLocation `json:"locations"`
+	// Failed brokers that could not be searched, by profile
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// Table one row per object, failed brokers in red
+func (search ObjectSearch) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"PROFILE", "CLUSTER", "KIND", "VHOST", "NAME", "DETAIL"}}
+	for _, location := range search.Locations {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: orDash(location.Profile)},
+			{Text: orDash(location.Cluster)},
+			{Text: location.Kind},
+			{Text: orDash(location.Vhost)},
+			{Text: location.Name},
+			{Text: orDash(location.Detail)},
+		})
+	}
+	profiles := []string{}
+	for profile := range search.Failed {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	for _, profile := range profiles {
+		table.Rows = append(table.Rows, []Cell{{Text: profile}, {Text: "-"}, {Text: "-"}, {Text: "-"}, {Text: "-"}, {Text: search.Failed[profile], Color: Red}})
+	}
+	return table
+}
+
+// searchBroker the objects of the broker of cli matching the query
+func (cli *CLI) searchBroker(query ObjectQuery) ([]ObjectLocation, error) {
+	rabbitmq, err := cli.connect()
+	if err != nil {
+		return nil, err
+	}
+	var users []RabbitUser
+	var permissions []RabbitPermission
+	if contains(query.Kinds, ObjectUser) {
+		if users, err = rabbitmq.management().Users(); err != nil {
+			return nil, err
+		}
+		if permissions, err = rabbitmq.management().Permissions(); err != nil {
+			return nil, err
+		}
+	}
+	return FindObjects(query, rabbitmq.info(), users, permissions), nil
+}
+
+func init() {
+	registerCommand("find", "[--kind queue,exchange,binding,user] [--regex] [--vhost v] <name> where a queue, exchange, binding or user lives across every profile and vhost", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("find")
+		kinds := flags.String("kind", "", "object kinds to search, all by default")
+		regex := flags.Bool("regex", false, "the name is a regular expression")
+		vhost := flags.String("vhost", "", "only search this vhost")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("find: expected a name")
+		}
+		query, err := ParseObjectQuery(flags.Arg(0), *regex, *kinds, *vhost)
+		if err != nil {
+			return nil, usageError("find: %s", err)
+		}
+		search := ObjectSearch{Locations: []ObjectLocation{}}
+		profiles, err := LoadBrokerProfiles(cli.profilesFile)
+		if cli.profile != "" || cli.replay != "" || os.IsNotExist(err) || len(profiles.Profiles) == 0 {
+			// a single broker
+			if search.Locations, err = cli.searchBroker(query); err != nil {
+				return nil, err
+			}
+			for i := range search.Locations {
+				search.Locations[i].Profile = cli.profile
+			}
+			return search, nil
+		}
+		if err != nil {
+			return nil, usageError("find: %s", err)
+		}
+		result := RunFanout("find", profiles.Names(), func(profile string) (interface{}, error) {
+			login, err := fanoutLogin(profiles, profile, cli.baseLogin)
+			if err != nil {
+				return nil, err
+			}
+			sub := *cli
+			sub.rabbitmq, sub.profile, sub.login, sub.record = nil, profile, login, ""
+			return sub.searchBroker(query)
+		})
+		for _, profile := range result.Profiles {
+			if profile.Error != "" {
+				if search.Failed == nil {
+					search.Failed = map[string]string{}
+				}
+				search.Failed[profile.Profile] = profile.Error
+				continue
+			}
+			for _, location := range profile.Result.([]ObjectLocation) {
+				location.Profile = profile.Profile
+				search.Locations = append(search.Locations, location)
+			}
+		}
+		return search, result.Err()
+	})
+}
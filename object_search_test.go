@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindObjects(t *testing.T) {
+	info := rabtap.BrokerInfo{
+		Queues:    []rabtap.RabbitQueue{{Vhost: "/", Name: "orders.retry", Messages: 3}, {Vhost: "shop", Name: "orders"}},
+		Exchanges: []rabtap.RabbitExchange{{Vhost: "/", Name: ""}, {Vhost: "shop", Name: "orders", Type: "topic"}},
+		Bindings:  []rabtap.RabbitBinding{{Vhost: "shop", Source: "orders", Destination: "orders", DestinationType: "queue", RoutingKey: "#"}},
+	}
+	info.Overview.ClusterName = "rabbit@prod"
+	users := []RabbitUser{{Name: "orders", Tags: "monitoring"}, {Name: "admin"}}
+	permissions := []RabbitPermission{{User: "orders", Vhost: "shop", Configure: "", Write: "orders", Read: ".*"}}
+
+	query, err := ParseObjectQuery("orders", false, "", "")
+	assert.Nil(t, err)
+	found := FindObjects(query, info, users, permissions)
+	assert.Equal(t, 4, len(found))
+	assert.Equal(t, ObjectLocation{Cluster: "rabbit@prod", Kind: ObjectQueue, Vhost: "shop", Name: "orders", Detail: "0 messages, 0 consumers on -"}, found[0])
+	assert.Equal(t, "orders -> orders", found[2].Name)
+	assert.Equal(t, ObjectUser, found[3].Kind)
+	assert.Equal(t, "shop", found[3].Vhost)
+
+	query, _ = ParseObjectQuery(`^orders\.`, true, "queue", "/")
+	found = FindObjects(query, info, nil, nil)
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, "orders.retry", found[0].Name)
+
+	query, _ = ParseObjectQuery("admin", false, "user", "")
+	found = FindObjects(query, info, users, permissions)
+	assert.Equal(t, "tags -, no permissions", found[0].Detail)
+
+	_, err = ParseObjectQuery("orders", false, "policy", "")
+	assert.NotNil(t, err)
+	_, err = ParseObjectQuery("(", true, "", "")
+	assert.NotNil(t, err)
+
+	table := ObjectSearch{Locations: found, Failed: map[string]string{"staging": "connection refused"}}.Table(NumberFormat{})
+	assert.Equal(t, 2, len(table.Rows))
+	assert.Equal(t, Red, table.Rows[1][5].Color)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// objectPath the api path of an object, kind is a literal path like queues
+// or queues/quorum
+func objectPath(kind string, vhost string, name string) string {
+	return managementPath(append(strings.Split(kind, "/"), vhost, name)...)
+}
+
+// DeleteQueue delete a queue
+func (client *ManagementClient) DeleteQueue(vhost string, name string) error {
+	if err := client.scope.Check("queue", name); err != nil {
+		return err
+	}
+	return client.delete(objectPath("queues", vhost, name))
+}
+
+// PurgeQueue remove all ready messages from a queue
+func (client *ManagementClient) PurgeQueue(vhost string, name string) error {
+	if err := client.scope.Check("queue", name); err != nil {
+		return err
+	}
+	return client.delete(managementPath("queues", vhost, name, "contents"))
+}
+
+// DeleteExchange delete an exchange
+func (client *ManagementClient) DeleteExchange(vhost string, name string) error {
+	if err := client.scope.Check("exchange", name); err != nil {
+		return err
+	}
+	return client.delete(objectPath("exchanges", vhost, name))
+}
+
+// CloseConnection close a client connection, reason is shown to the client
+func (client *ManagementClient) CloseConnection(name string, reason string) error {
+	header := http.Header{}
+	if reason != "" {
+		header.Set("X-Reason", reason)
+	}
+	res, err := client.request("DELETE", managementPath("connections", name), nil, header)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// VhostNames list the vhosts of the broker
+func (client *ManagementClient) VhostNames() ([]string, error) {
+	var vhosts []struct {
+		Name string `json:"name"`
+	}
+	if err := client.get("vhosts?columns=name", &vhosts); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(vhosts))
+	for i, vhost := range vhosts {
+		names[i] = vhost.Name
+	}
+	return names, nil
+}
+
+// QueueMessage : message fetched with the get endpoint of a queue
+type QueueMessage struct {
+	Exchange        string                 `json:"exchange"`
+	RoutingKey      string                 `json:"routing_key"`
+	Redelivered     bool                   `json:"redelivered"`
+	MessageCount    int                    `json:"message_count"`
+	Payload         string                 `json:"payload"`
+	PayloadBytes    int                    `json:"payload_bytes"`
+	PayloadEncoding string                 `json:"payload_encoding"`
+	Properties      map[string]interface{} `json:"properties"`
+}
+
+// PublishMessage publish a text payload through the management api, routed
+// is false when no queue received the message
+func (client *ManagementClient) PublishMessage(vhost string, exchange string, routingKey string, payload string) (bool, error) {
+	if exchange == "" {
+		exchange = "amq.default"
+	}
+	var res struct {
+		Routed bool `json:"routed"`
+	}
+	err := client.postResult(managementPath("exchanges", vhost, exchange, "publish"), map[string]interface{}{
+		"properties":       map[string]interface{}{},
+		"routing_key":      routingKey,
+		"payload":          payload,
+		"payload_encoding": "string",
+	}, &res)
+	return res.Routed, err
+}
+
+// GetMessages fetch up to count messages from a queue, with requeue set
+// they stay in the queue
+func (client *ManagementClient) GetMessages(vhost string, queue string, count int, requeue bool) ([]QueueMessage, error) {
+	ackmode := "ack_requeue_false"
+	if requeue {
+		ackmode = "ack_requeue_true"
+	} else if client.readOnly {
+		return nil, ErrReadOnly
+	} else if err := client.scope.Check("queue", queue); err != nil {
+		return nil, err
+	}
+	messages := []QueueMessage{}
+	err := client.postResult(managementPath("queues", vhost, queue, "get"), map[string]interface{}{
+		"count":    count,
+		"ackmode":  ackmode,
+		"encoding": "auto",
+	}, &messages)
+	return messages, err
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// token actions of the operator endpoints
+const (
+	ActionPurge  = "purge"
+	ActionClose  = "close"
+	ActionDelete = "delete"
+)
+
+// idempotencyTTL how long the result of a request with an Idempotency-Key
+// is replayed
+const idempotencyTTL = 24 * time.Hour
+
+// operatorClient : the mutating management api calls behind the operator
+// endpoints
+type operatorClient interface {
+	PurgeQueue(vhost string, name string) error
+	DeleteQueue(vhost string, name string) error
+	DeleteExchange(vhost string, name string) error
+	CloseConnection(name string, reason string) error
+}
+
+// OperatorAction : body of a POST to /api/actions/<action>
+type OperatorAction struct {
+	// Kind queue or exchange for delete
+	Kind string `json:"kind,omitempty"`
+	// Vhost of the object, the default vhost when empty
+	Vhost  string `json:"vhost,omitempty"`
+	Name   string `json:"name"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// idempotentResult : a finished or running request of an idempotency key
+type idempotentResult struct {
+	done    bool
+	status  int
+	body    interface{}
+	expires time.Time
+}
+
+// idempotencyCache : results by idempotency key, so retried requests are not
+// executed twice
+type idempotencyCache struct {
+	mutex   sync.Mutex
+	results map[string]*idempotentResult
+}
+
+// begin the result of key, nil when the caller has to execute the request
+func (cache *idempotencyCache) begin(key string, now time.Time) *idempotentResult {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.results == nil {
+		cache.results = map[string]*idempotentResult{}
+	}
+	for k, result := range cache.results {
+		if result.done && now.After(result.expires) {
+			delete(cache.results, k)
+		}
+	}
+	if result, ok := cache.results[key]; ok {
+		return result
+	}
+	cache.results[key] = &idempotentResult{}
+	return nil
+}
+
+// finish store the result of key
+func (cache *idempotencyCache) finish(key string, status int, body interface{}, now time.Time) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.results[key] = &idempotentResult{done: true, status: status, body: body, expires: now.Add(idempotencyTTL)}
+}
+
+// EnableActions serve purge, close and delete under /api/actions/, every
+// execution is recorded in audit
+func (server *Server) EnableActions(client operatorClient, audit *AuditLog) {
+	server.operator = client
+	server.audit = audit
+	server.mux.HandleFunc("/api/actions/", server.handleAction)
+}
+
+// actionVhost the vhost an action touches, connections are looked up in the
+// snapshot
+func (server *Server) actionVhost(action string, req OperatorAction) string {
+	if action != ActionClose {
+		return req.Vhost
+	}
+	if snapshot := server.poller.Snapshot(); snapshot != nil {
+		for _, conn := range snapshot.Info.Connections {
+			if conn.Name == req.Name {
+				return conn.Vhost
+			}
+		}
+	}
+	return ""
+}
+
+// execute run the action against the broker
+func (server *Server) execute(action string, req OperatorAction) error {
+	switch action {
+	case ActionPurge:
+		return server.operator.PurgeQueue(req.Vhost, req.Name)
+	case ActionClose:
+		return server.operator.CloseConnection(req.Name, req.Reason)
+	case ActionDelete:
+		if req.Kind == "exchange" {
+			return server.operator.DeleteExchange(req.Vhost, req.Name)
+		}
+		return server.operator.DeleteQueue(req.Vhost, req.Name)
+	}
+	return fmt.Errorf("unknown action %q", action)
+}
+
+// actionStatus http status of a failed action
+func actionStatus(err error) int {
+	if err == ErrReadOnly || strings.Contains(err.Error(), "outside the scope") {
+		return http.StatusForbidden
+	}
+	return http.StatusBadGateway
+}
+
+// handleAction execute a POST to /api/actions/purge, close or delete. The
+// token has to allow the action and the vhost. Requests with an
+// Idempotency-Key header are executed once, retries get the first result.
+func (server *Server) handleAction(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/api/actions/")
+	if action != ActionPurge && action != ActionClose && action != ActionDelete {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("unknown action %q", action)})
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	var req OperatorAction
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected name"})
+		return
+	}
+	if action != ActionClose {
+		req.Vhost = server.vhost(req.Vhost)
+	}
+	if action == ActionDelete && req.Kind != "queue" && req.Kind != "exchange" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected kind queue or exchange"})
+		return
+	}
+	vhost := server.actionVhost(action, req)
+	if token, ok := requestToken(r); ok && !token.AllowsVhost(vhost) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("token %s may not %s in vhost %q", token.Name, action, vhost)})
+		return
+	}
+	user := requestUser(r)
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" {
+		key = user + "/" + key
+		if result := server.idempotency.begin(key, time.Now()); result != nil {
+			if !result.done {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": "a request with this idempotency key is still running"})
+				return
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeJSON(w, result.status, result.body)
+			return
+		}
+	}
+	target := req.Name
+	if action == ActionDelete {
+		target = req.Kind + " " + req.Name
+	}
+	entry := AuditEntry{
+		Time: time.Now().UTC(), User: user, Action: action, Vhost: vhost, Target: target,
+		Reason: req.Reason, IdempotencyKey: r.Header.Get("Idempotency-Key"), Result: "ok",
+	}
+	status, body := http.StatusOK, interface{}(map[string]string{"status": "done"})
+	if err := server.execute(action, req); err != nil {
+		entry.Result, entry.Error = "failed", err.Error()
+		status, body = actionStatus(err), map[string]string{"error": err.Error()}
+	}
+	if err := server.audit.Record(entry); err != nil {
+		subsystemLog("audit").Errorf("recording %s of %s failed: %s", action, target, err)
+	}
+	if key != "" {
+		server.idempotency.finish(key, status, body, time.Now())
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOperator : records the operations instead of running them
+type fakeOperator struct {
+	calls []string
+}
+
+func (f *fakeOperator) PurgeQueue(vhost string, name string) error {
+	f.calls = append(f.calls, "purge "+vhost+"/"+name)
+	return nil
+}
+func (f *fakeOperator) DeleteQueue(vhost string, name string) error {
+	f.calls = append(f.calls, "delete queue "+vhost+"/"+name)
+	return nil
+}
+func (f *fakeOperator) DeleteExchange(vhost string, name string) error {
+	return ErrReadOnly
+}
+func (f *fakeOperator) CloseConnection(name string, reason string) error {
+	f.calls = append(f.calls, "close "+name)
+	return nil
+}
+
+func TestServerActions(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit")
+	defer os.RemoveAll(dir)
+	audit := NewAuditLog(filepath.Join(dir, "audit.log"))
+	store := &TokenStore{}
+	purger, _, _ := store.Issue("purger", []string{ActionPurge, ActionDelete}, []string{"prod"}, 0, time.Now())
+	reader, _, _ := store.Issue("reader", []string{ActionRead}, nil, 0, time.Now())
+	operator := &fakeOperator{}
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	server.RequireTokens(store)
+	server.EnableActions(operator, audit)
+
+	post := func(path string, secret string, key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+secret)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+	purge := `{"vhost":"prod","name":"orders"}`
+	assert.Equal(t, http.StatusForbidden, post("/api/actions/purge", reader, "", purge).Code)
+	assert.Equal(t, http.StatusForbidden, post("/api/actions/purge", purger, "", `{"vhost":"test","name":"orders"}`).Code)
+	assert.Equal(t, http.StatusOK, post("/api/actions/purge", purger, "k1", purge).Code)
+	rec := post("/api/actions/purge", purger, "k1", purge)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, []string{"purge prod/orders"}, operator.calls)
+
+	assert.Equal(t, http.StatusBadRequest, post("/api/actions/delete", purger, "", `{"vhost":"prod","name":"x"}`).Code)
+	assert.Equal(t, http.StatusForbidden, post("/api/actions/delete", purger, "", `{"kind":"exchange","vhost":"prod","name":"x"}`).Code)
+
+	entries, err := audit.Entries(time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "purger", entries[0].User)
+	assert.Equal(t, "ok", entries[0].Result)
+	assert.Equal(t, "k1", entries[0].IdempotencyKey)
+	assert.Equal(t, "exchange x", entries[1].Target)
+	assert.Equal(t, ErrReadOnly.Error(), entries[1].Error)
+}
+
+func TestStoreAuditLog(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "audit")
+	defer os.RemoveAll(dir)
+	bucket := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	defer bucket.Close()
+	audit, err := OpenAuditLog("s3://bucket/audit?endpoint=" + url.QueryEscape(bucket.URL))
+	assert.Nil(t, err)
+	defer audit.Close()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, audit.Record(AuditEntry{Time: now, User: "alice", Action: ActionPurge, Target: "a", Result: "ok"}))
+	assert.Nil(t, audit.Record(AuditEntry{Time: now, User: "bob", Action: ActionPurge, Target: "b", Result: "ok"}))
+	assert.Nil(t, audit.Record(AuditEntry{Time: now.Add(time.Hour), User: "alice", Action: ActionClose, Target: "c", Result: "ok"}))
+	entries, err := audit.Entries(now)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "bob", entries[1].User)
+	entries, _ = audit.Entries(now.Add(time.Minute))
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "c", entries[0].Target)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// OTLPEmitter : pushes metrics to an opentelemetry collector with otlp/http
+// in its json encoding, e.g. to http://collector:4318/v1/metrics
+type OTLPEmitter struct {
+	EmitterOptions
+	URL     string
+	Headers map[string]string
+	client  *http.Client
+}
+
+// NewOTLPEmitter create an emitter posting to url. The tags of opts become
+// resource attributes.
+func NewOTLPEmitter(url string, opts EmitterOptions) *OTLPEmitter {
+	return &OTLPEmitter{EmitterOptions: opts, URL: url, Headers: map[string]string{}, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+	// AggregationTemporality 2 is cumulative
+	AggregationTemporality int  `json:"aggregationTemporality"`
+	IsMonotonic            bool `json:"isMonotonic"`
+}
+
+type otlpMetric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Unit        string     `json:"unit,omitempty"`
+	Gauge       *otlpGauge `json:"gauge,omitempty"`
+	Sum         *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+func otlpAttributes(labels []MetricLabel) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(labels))
+	for _, label := range labels {
+		attrs = append(attrs, otlpAttribute{label.Name, otlpValue{label.Value}})
+	}
+	return attrs
+}
+
+// otlpPayload one metric per definition with a data point per sample, in
+// the order the definitions first appear
+func otlpPayload(opts EmitterOptions, samples []MetricSample, at time.Time) otlpRequest {
+	timestamp := strconv.FormatInt(at.UnixNano(), 10)
+	var metrics []otlpMetric
+	index := map[string]int{}
+	for _, sample := range samples {
+		i, ok := index[sample.Def.Name]
+		if !ok {
+			metric := otlpMetric{Name: opts.Prefix + sample.Def.Name, Description: sample.Def.Help, Unit: sample.Def.Unit}
+			if sample.Def.Kind == "counter" {
+				metric.Sum = &otlpSum{AggregationTemporality: 2, IsMonotonic: true}
+			} else {
+				metric.Gauge = &otlpGauge{}
+			}
+			i = len(metrics)
+			index[sample.Def.Name] = i
+			metrics = append(metrics, metric)
+		}
+		point := otlpDataPoint{Attributes: otlpAttributes(sample.Labels), TimeUnixNano: timestamp, AsDouble: sample.Value}
+		if metrics[i].Sum != nil {
+			metrics[i].Sum.DataPoints = append(metrics[i].Sum.DataPoints, point)
+		} else {
+			metrics[i].Gauge.DataPoints = append(metrics[i].Gauge.DataPoints, point)
+		}
+	}
+
+	resource := otlpResourceMetrics{}
+	resource.Resource.Attributes = append([]otlpAttribute{{"service.name", otlpValue{"radish"}}}, otlpAttributes(opts.Tags)...)
+	scope := otlpScopeMetrics{Metrics: metrics}
+	scope.Scope.Name = "radish"
+	resource.ScopeMetrics = []otlpScopeMetrics{scope}
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{resource}}
+}
+
+// Emit post the samples as one export request
+func (emitter *OTLPEmitter) Emit(samples []MetricSample, at time.Time) error {
+	data, err := json.Marshal(otlpPayload(emitter.EmitterOptions, samples, at))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", emitter.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range emitter.Headers {
+		req.Header.Set(name, value)
+	}
+	res, err := emitter.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("otlp export failed: %s", res.Status)
+	}
+	return nil
+}
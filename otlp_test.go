@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOTLPPayload(t *testing.T) {
+	samples := []MetricSample{
+		{metricQueueMessages, []MetricLabel{{"queue", "q1"}}, 1},
+		{metricConnectionRecv, []MetricLabel{{"connection", "c1"}}, 100},
+		{metricQueueMessages, []MetricLabel{{"queue", "q2"}}, 2},
+	}
+	payload := otlpPayload(EmitterOptions{Prefix: "radish.", Tags: []MetricLabel{{"env", "prod"}}}, samples, time.Unix(1, 0))
+	resource := payload.ResourceMetrics[0]
+	assert.Equal(t, []otlpAttribute{{"service.name", otlpValue{"radish"}}, {"env", otlpValue{"prod"}}}, resource.Resource.Attributes)
+	metrics := resource.ScopeMetrics[0].Metrics
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, "radish.queue_messages", metrics[0].Name)
+	assert.Len(t, metrics[0].Gauge.DataPoints, 2)
+	assert.Equal(t, "1000000000", metrics[0].Gauge.DataPoints[1].TimeUnixNano)
+	assert.True(t, metrics[1].Sum.IsMonotonic)
+	assert.Equal(t, 100.0, metrics[1].Sum.DataPoints[0].AsDouble)
+}
+
+func TestOTLPEmitter(t *testing.T) {
+	var got otlpRequest
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &got)
+		auth = r.Header.Get("api-key")
+	}))
+	defer server.Close()
+	emitter := NewOTLPEmitter(server.URL, EmitterOptions{})
+	emitter.Headers["api-key"] = "secret"
+	assert.Nil(t, emitter.Emit([]MetricSample{{metricMessages, nil, 3}}, time.Now()))
+	assert.Equal(t, "secret", auth)
+	assert.Equal(t, "messages", got.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].Name)
+}
+
+func TestWriteSamples(t *testing.T) {
+	var buf bytes.Buffer
+	writeSamples(&buf, "radish_", []MetricSample{
+		{metricQueueMessages, []MetricLabel{{"queue", `a"b`}}, 1},
+		{metricConnectionRecv, nil, 5},
+		{metricQueueMessages, []MetricLabel{{"queue", "c"}}, 2},
+	})
+	assert.Equal(t, `# HELP radish_queue_messages Messages in the queue.
+# TYPE radish_queue_messages gauge
+radish_queue_messages{queue="a\"b"} 1
+radish_queue_messages{queue="c"} 2
+# HELP radish_connection_received_bytes_total Bytes received on the connection.
+# TYPE radish_connection_received_bytes_total counter
+radish_connection_received_bytes_total 5
+`, buf.String())
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ownership arguments a queue or exchange can be declared with
+const (
+	ownerArgument = "x-owner"
+	teamArgument  = "x-team"
+)
+
+// defaultOwnersFile sidecar registry read when --registry is not set
+const defaultOwnersFile = "owners.yml"
+
+// OwnerEntry : owner of the objects matching a name pattern, for objects
+// declared without ownership arguments
+type OwnerEntry struct {
+	Vhost   string `yaml:"vhost" json:"vhost"`
+	Pattern string `yaml:"pattern" json:"pattern"`
+	Owner   string `yaml:"owner" json:"owner"`
+	Team    string `yaml:"team" json:"team"`
+}
+
+// OwnerRegistry : sidecar file mapping object names to owners
+type OwnerRegistry struct {
+	Owners []OwnerEntry `yaml:"owners" json:"owners"`
+}
+
+// LoadOwnerRegistry read an owners.yml file, a missing file is an empty
+// registry
+func LoadOwnerRegistry(file string) (OwnerRegistry, error) {
+	var registry OwnerRegistry
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return registry, err
+	}
+	err = yaml.Unmarshal(data, &registry)
+	return registry, err
+}
+
+// Save write the registry back to file
+func (registry OwnerRegistry) Save(file string) error {
+	data, err := yaml.Marshal(registry)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// Set add an entry, replacing the one for the same vhost and pattern
+func (registry *OwnerRegistry) Set(entry OwnerEntry) {
+	for i, existing := range registry.Owners {
+		if existing.Vhost == entry.Vhost && existing.Pattern == entry.Pattern {
+			registry.Owners[i] = entry
+			return
+		}
+	}
+	registry.Owners = append(registry.Owners, entry)
+}
+
+// Lookup first entry whose glob pattern matches the name, entries without
+// vhost match in all vhosts
+func (registry OwnerRegistry) Lookup(vhost string, name string) (OwnerEntry, bool) {
+	for _, entry := range registry.Owners {
+		if entry.Vhost != "" && entry.Vhost != vhost {
+			continue
+		}
+		if ok, _ := path.Match(entry.Pattern, name); ok {
+			return entry, true
+		}
+	}
+	return OwnerEntry{}, false
+}
+
+// OwnedObject : a queue or exchange with its arguments
+type OwnedObject struct {
+	Kind      string                 `json:"kind"`
+	Vhost     string                 `json:"vhost"`
+	Name      string                 `json:"name"`
+	Messages  int64                  `json:"messages"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// OwnedObjects queues and exchanges with the arguments the rabtap client
+// does not expose, the default and amq.* exchanges are left out
+func (client *ManagementClient) OwnedObjects() ([]OwnedObject, error) {
+	var queues, exchanges []OwnedObject
+	if err := client.get("queues?columns=vhost,name,messages,arguments", &queues); err != nil {
+		return nil, err
+	}
+	if err := client.get("exchanges?columns=vhost,name,arguments", &exchanges); err != nil {
+		return nil, err
+	}
+	objects := []OwnedObject{}
+	for _, queue := range queues {
+		queue.Kind = "queue"
+		objects = append(objects, queue)
+	}
+	for _, exchange := range exchanges {
+		if exchange.Name == "" || strings.HasPrefix(exchange.Name, "amq.") {
+			continue
+		}
+		exchange.Kind = "exchange"
+		objects = append(objects, exchange)
+	}
+	return client.scopedObjects(objects), nil
+}
+
+// scopedObjects drop the objects outside the scope of the client
+func (client *ManagementClient) scopedObjects(objects []OwnedObject) []OwnedObject {
+	scoped := objects[:0]
+	for _, object := range objects {
+		if client.scope.Match(object.Name) {
+			scoped = append(scoped, object)
+		}
+	}
+	return scoped
+}
+
+// Ownership : who owns an object and where that is recorded
+type Ownership struct {
+	Owner string `json:"owner"`
+	Team  string `json:"team"`
+	// Source arguments or registry, empty for untagged objects
+	Source string `json:"source"`
+}
+
+// ResolveOwnership ownership arguments win over the registry
+func ResolveOwnership(object OwnedObject, registry OwnerRegistry) Ownership {
+	owner, _ := object.Arguments[ownerArgument].(string)
+	team, _ := object.Arguments[teamArgument].(string)
+	if owner != "" || team != "" {
+		return Ownership{owner, team, "arguments"}
+	}
+	if entry, ok := registry.Lookup(object.Vhost, object.Name); ok {
+		return Ownership{entry.Owner, entry.Team, "registry"}
+	}
+	return Ownership{}
+}
+
+// OwnerSummary : objects of one team and owner
+type OwnerSummary struct {
+	Team      string `json:"team"`
+	Owner     string `json:"owner"`
+	Queues    int    `json:"queues"`
+	Exchanges int    `json:"exchanges"`
+	Messages  int64  `json:"messages"`
+}
+
+// OwnershipReport : objects grouped by owner, untagged ones listed
+type OwnershipReport struct {
+	Owners   []OwnerSummary `json:"owners"`
+	Untagged []OwnedObject  `json:"untagged"`
+}
+
+// BuildOwnershipReport group objects by team and owner, largest team first
+func BuildOwnershipReport(objects []OwnedObject, registry OwnerRegistry) OwnershipReport {
+	report := OwnershipReport{Owners: []OwnerSummary{}, Untagged: []OwnedObject{}}
+	summaries := map[[2]string]*OwnerSummary{}
+	for _, object := range objects {
+		ownership := ResolveOwnership(object, registry)
+		if ownership.Source == "" {
+			report.Untagged = append(report.Untagged, object)
+			continue
+		}
+		key := [2]string{ownership.Team, ownership.Owner}
+		if summaries[key] == nil {
+			summaries[key] = &OwnerSummary{Team: ownership.Team, Owner: ownership.Owner}
+		}
+		summary := summaries[key]
+		if object.Kind == "queue" {
+			summary.Queues++
+		} else {
+			summary.Exchanges++
+		}
+		summary.Messages += object.Messages
+	}
+	for _, summary := range summaries {
+		report.Owners = append(report.Owners, *summary)
+	}
+	sort.Slice(report.Owners, func(i, j int) bool {
+		a, b := report.Owners[i], report.Owners[j]
+		if a.Queues+a.Exchanges != b.Queues+b.Exchanges {
+			return a.Queues+a.Exchanges > b.Queues+b.Exchanges
+		}
+		return a.Team+"\x00"+a.Owner < b.Team+"\x00"+b.Owner
+	})
+	sort.Slice(report.Untagged, func(i, j int) bool {
+		a, b := report.Untagged[i], report.Untagged[j]
+		return a.Vhost+"\x00"+a.Name < b.Vhost+"\x00"+b.Name
+	})
+	return report
+}
+
+// Table owner summaries followed by the untagged objects
+func (report OwnershipReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"TEAM", "OWNER", "QUEUES", "EXCHANGES", "MESSAGES"}}
+	for _, summary := range report.Owners {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: orDash(summary.Team)},
+			{Text: orDash(summary.Owner)},
+			{Text: format.Count(int64(summary.Queues))},
+			{Text: format.Count(int64(summary.Exchanges))},
+			{Text: format.Count(summary.Messages)},
+		})
+	}
+	for _, object := range report.Untagged {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: "untagged", Color: Yellow},
+			{Text: object.Kind + " " + object.Vhost + "/" + object.Name},
+			{Text: "-"}, {Text: "-"},
+			{Text: format.Count(object.Messages)},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("owners", "[--registry f] [--untagged] objects grouped by owner from x-owner/x-team arguments or a registry file", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("owners")
+		file := flags.String("registry", envOr("RADISH_OWNERS", defaultOwnersFile), "sidecar owner registry")
+		untagged := flags.Bool("untagged", false, "only list objects without owner")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		registry, err := LoadOwnerRegistry(*file)
+		if err != nil {
+			return nil, usageError("owners: %s", err)
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		objects, err := rabbitmq.management().OwnedObjects()
+		if err != nil {
+			return nil, err
+		}
+		report := BuildOwnershipReport(objects, registry)
+		if *untagged {
+			report.Owners = []OwnerSummary{}
+		}
+		return report, nil
+	})
+
+	registerCommand("set-owner", "[--registry f] [--vhost v] [--team t] [--owner o] <pattern> record the owner of matching objects in the registry file", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("set-owner")
+		file := flags.String("registry", envOr("RADISH_OWNERS", defaultOwnersFile), "sidecar owner registry")
+		entry := OwnerEntry{}
+		flags.StringVar(&entry.Vhost, "vhost", "", "vhost of the objects, empty for all")
+		flags.StringVar(&entry.Team, "team", "", "owning team")
+		flags.StringVar(&entry.Owner, "owner", "", "owning person or service")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		entry.Vhost = NormalizeVhost(entry.Vhost)
+		if flags.NArg() != 1 {
+			return nil, usageError("set-owner: expected name pattern")
+		}
+		if entry.Team == "" && entry.Owner == "" {
+			return nil, usageError("set-owner: expected --team or --owner")
+		}
+		entry.Pattern = flags.Arg(0)
+		if _, err := path.Match(entry.Pattern, ""); err != nil {
+			return nil, usageError("set-owner: %s", err)
+		}
+		registry, err := LoadOwnerRegistry(*file)
+		if err != nil {
+			return nil, usageError("set-owner: %s", err)
+		}
+		registry.Set(entry)
+		return registry, registry.Save(*file)
+	})
+}
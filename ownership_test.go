@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildOwnershipReport(t *testing.T) {
+	registry := OwnerRegistry{Owners: []OwnerEntry{
+		{Pattern: "billing.*", Team: "billing", Owner: "bob"},
+		{Vhost: "prod", Pattern: "orders*", Team: "shop"},
+	}}
+	objects := []OwnedObject{
+		{Kind: "queue", Vhost: "/", Name: "billing.invoices", Messages: 5},
+		{Kind: "exchange", Vhost: "/", Name: "billing.events"},
+		{Kind: "queue", Vhost: "/", Name: "payments", Messages: 2,
+			Arguments: map[string]interface{}{"x-team": "billing", "x-owner": "bob"}},
+		{Kind: "queue", Vhost: "/", Name: "orders"},
+		{Kind: "queue", Vhost: "prod", Name: "orders.eu", Messages: 1},
+	}
+	report := BuildOwnershipReport(objects, registry)
+	assert.Equal(t, []OwnerSummary{
+		{Team: "billing", Owner: "bob", Queues: 2, Exchanges: 1, Messages: 7},
+		{Team: "shop", Queues: 1, Messages: 1},
+	}, report.Owners)
+	assert.Len(t, report.Untagged, 1)
+	assert.Equal(t, "orders", report.Untagged[0].Name)
+	assert.Equal(t, "arguments", ResolveOwnership(objects[2], registry).Source)
+}
+
+func TestOwnerRegistrySave(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "owners")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "owners.yml")
+
+	registry, err := LoadOwnerRegistry(file)
+	assert.Nil(t, err)
+	registry.Set(OwnerEntry{Pattern: "a.*", Team: "a"})
+	registry.Set(OwnerEntry{Pattern: "a.*", Team: "b"})
+	assert.Nil(t, registry.Save(file))
+
+	loaded, err := LoadOwnerRegistry(file)
+	assert.Nil(t, err)
+	assert.Equal(t, []OwnerEntry{{Pattern: "a.*", Team: "b"}}, loaded.Owners)
+}
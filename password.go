@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// HashingAlgorithmSHA256 rabbitmq name of the salted sha256 password hashing
+const HashingAlgorithmSHA256 = "rabbit_password_hashing_sha256"
+
+const passwordSaltLength = 4
+
+// hashPasswordWithSalt base64(salt + sha256(salt + password)) as computed by rabbitmq
+func hashPasswordWithSalt(salt []byte, password string) string {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), []byte(password)...))
+	return base64.StdEncoding.EncodeToString(append(append([]byte{}, salt...), sum[:]...))
+}
+
+// HashPassword compute a rabbitmq compatible salted sha256 hash of password
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashPasswordWithSalt(salt, password), nil
+}
+
+// PasswordMatchesHash check if password produces the given sha256 hash
+func PasswordMatchesHash(password string, hash string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil || len(decoded) != passwordSaltLength+sha256.Size {
+		return false
+	}
+	expected := hashPasswordWithSalt(decoded[:passwordSaltLength], password)
+	return bytes.Equal([]byte(expected), []byte(hash))
+}
+
+// NewUser : user to create, the password is hashed locally unless
+// SendPlaintext is set
+type NewUser struct {
+	Name          string   `json:"name"`
+	Password      string   `json:"password"`
+	Tags          []string `json:"tags"`
+	SendPlaintext bool     `json:"sendPlaintext"`
+}
+
+// CreateUser create a user with a plaintext password
+func (client *ManagementClient) CreateUser(user NewUser) error {
+	if user.Name == "" {
+		return fmt.Errorf("user name is required")
+	}
+	if user.SendPlaintext {
+		return client.PutUserPassword(user.Name, user.Password, user.Tags)
+	}
+	hash, err := HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	return client.PutUser(user.Name, hash, HashingAlgorithmSHA256, user.Tags)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPassword(t *testing.T) {
+	// example from the rabbitmq password hashing documentation
+	assert.Equal(t, "kI3GCqW5JLMJa4iX1lo7X4D6XbYqlLgxIs30+P6tENUV2POR",
+		hashPasswordWithSalt([]byte{0x90, 0x8D, 0xC6, 0x0A}, "test12"))
+
+	hash, err := HashPassword("secret")
+	assert.Nil(t, err)
+	assert.True(t, PasswordMatchesHash("secret", hash))
+	assert.False(t, PasswordMatchesHash("other", hash))
+	assert.False(t, PasswordMatchesHash("secret", "invalid"))
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// maxDecompressed limit of decompressed payloads, protects against gzip bombs
+const maxDecompressed = 64 << 20
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	avroMagic = []byte{'O', 'b', 'j', 1}
+)
+
+// PayloadOptions : how message bodies are displayed
+type PayloadOptions struct {
+	// Raw print the body as it is
+	Raw bool
+	// Base64 print the body base64 encoded
+	Base64 bool
+	// Proto message types to decode protobuf bodies with, ProtoType selects
+	// the type when the content type does not name it
+	Proto     *ProtoDescriptors
+	ProtoType string
+}
+
+// contentTypeParam value of a content type parameter, e.g. proto=shop.Order
+func contentTypeParam(contentType string, name string) string {
+	for _, part := range strings.Split(contentType, ";")[1:] {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], name) {
+			return strings.Trim(kv[1], `"`)
+		}
+	}
+	return ""
+}
+
+func isProtobufType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.Contains(mediaType, "protobuf") || strings.HasSuffix(mediaType, "/x-proto")
+}
+
+// gunzip decompress data up to maxDecompressed bytes
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(io.LimitReader(reader, maxDecompressed))
+}
+
+// FormatPayload pretty print a message body: gzip is decompressed, json
+// indented, protobuf decoded with the descriptors or raw, the schema of avro
+// container files shown, other text printed as it is and binary data as hex
+// dump. Content type and encoding are taken from the message properties,
+// magic bytes are checked when they are missing.
+func FormatPayload(body []byte, contentType string, contentEncoding string, opts PayloadOptions) string {
+	switch {
+	case opts.Base64:
+		return base64.StdEncoding.EncodeToString(body)
+	case opts.Raw:
+		return string(body)
+	}
+	var notes []string
+	if strings.EqualFold(contentEncoding, "gzip") || bytes.HasPrefix(body, gzipMagic) {
+		if data, err := gunzip(body); err == nil {
+			notes = append(notes, fmt.Sprintf("gzip %d -> %d bytes", len(body), len(data)))
+			body = data
+		}
+	}
+	text := formatDecoded(body, contentType, opts)
+	if len(notes) > 0 {
+		text = "(" + strings.Join(notes, ", ") + ")\n" + text
+	}
+	return text
+}
+
+func formatDecoded(body []byte, contentType string, opts PayloadOptions) string {
+	if isProtobufType(contentType) || opts.ProtoType != "" {
+		typeName := contentTypeParam(contentType, "proto")
+		if typeName == "" {
+			typeName = contentTypeParam(contentType, "messagetype")
+		}
+		if typeName == "" {
+			typeName = opts.ProtoType
+		}
+		if opts.Proto != nil && typeName != "" {
+			if text, err := opts.Proto.Decode(body, typeName); err == nil {
+				return text
+			}
+		}
+		if text, err := DecodeProtoRaw(body); err == nil {
+			return text
+		}
+	}
+	if bytes.HasPrefix(body, avroMagic) || strings.Contains(strings.ToLower(contentType), "avro") {
+		if schema, err := avroContainerSchema(body); err == nil {
+			return fmt.Sprintf("avro container, %d bytes, schema:\n%s", len(body), indentJSON([]byte(schema)))
+		}
+	}
+	trimmed := bytes.TrimSpace(body)
+	if strings.Contains(strings.ToLower(contentType), "json") ||
+		(len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed)) {
+		return indentJSON(trimmed)
+	}
+	if printableString(body) {
+		return string(body)
+	}
+	return strings.TrimRight(hex.Dump(body), "\n")
+}
+
+// indentJSON indent valid json, other data is returned as it is
+func indentJSON(data []byte) string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return out.String()
+}
+
+// avroLong read a zigzag encoded avro long
+func avroLong(data []byte) (int64, []byte, error) {
+	value, n := binary.Varint(data)
+	if n <= 0 {
+		return 0, nil, errors.New("truncated avro long")
+	}
+	return value, data[n:], nil
+}
+
+// avroContainerSchema the avro.schema metadata of an object container file
+func avroContainerSchema(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, avroMagic) {
+		return "", errors.New("not an avro container")
+	}
+	data = data[len(avroMagic):]
+	for {
+		count, rest, err := avroLong(data)
+		if err != nil {
+			return "", err
+		}
+		data = rest
+		if count == 0 {
+			return "", errors.New("avro container without schema")
+		}
+		if count < 0 {
+			// negative counts are followed by the size of the block
+			count = -count
+			if _, data, err = avroLong(data); err != nil {
+				return "", err
+			}
+		}
+		for i := int64(0); i < count; i++ {
+			var key, value []byte
+			for _, dst := range []*[]byte{&key, &value} {
+				size, rest, err := avroLong(data)
+				if err != nil {
+					return "", err
+				}
+				if size < 0 || int64(len(rest)) < size {
+					return "", errors.New("truncated avro metadata")
+				}
+				*dst, data = rest[:size], rest[size:]
+			}
+			if string(key) == "avro.schema" {
+				return string(value), nil
+			}
+		}
+	}
+}
+
+// payloadFlags register the body display flags on flags, the returned
+// function builds the options after parsing
+func payloadFlags(flags *flag.FlagSet) func() (PayloadOptions, error) {
+	var opts PayloadOptions
+	flags.BoolVar(&opts.Raw, "raw", false, "print bodies as they are")
+	flags.BoolVar(&opts.Base64, "base64", false, "print bodies base64 encoded")
+	descriptor := flags.String("proto-descriptor", "", "descriptor set of protobuf bodies, see protoc --descriptor_set_out")
+	flags.StringVar(&opts.ProtoType, "proto-type", "", "protobuf message type of bodies without proto content type parameter")
+	return func() (PayloadOptions, error) {
+		if *descriptor != "" {
+			descs, err := LoadProtoDescriptors(*descriptor)
+			if err != nil {
+				return opts, err
+			}
+			opts.Proto = descs
+		}
+		return opts, nil
+	}
+}
+
+// Body the payload of a message fetched with get, decoded from base64
+func (message QueueMessage) Body() []byte {
+	if message.PayloadEncoding == "base64" {
+		if data, err := base64.StdEncoding.DecodeString(message.Payload); err == nil {
+			return data
+		}
+	}
+	return []byte(message.Payload)
+}
+
+// property string property of a message fetched with get
+func (message QueueMessage) property(name string) string {
+	value, _ := message.Properties[name].(string)
+	return value
+}
+
+// formatBodyLine append the body to a summary line, multi line bodies are
+// indented below it
+func formatBodyLine(line string, body string) string {
+	if !strings.Contains(body, "\n") {
+		return line + " " + body
+	}
+	return line + "\n  " + strings.Replace(body, "\n", "\n  ", -1)
+}
+
+// GetMessageList : messages peeked from a queue
+type GetMessageList struct {
+	Messages []QueueMessage `json:"messages"`
+	opts     PayloadOptions
+}
+
+// Table messages with their decoded bodies as table
+func (list GetMessageList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"#", "EXCHANGE", "ROUTING KEY", "CONTENT TYPE", "BYTES", "BODY"}}
+	for i, message := range list.Messages {
+		body := FormatPayload(message.Body(), message.property("content_type"), message.property("content_encoding"), list.opts)
+		table.Rows = append(table.Rows, []Cell{
+			{Text: fmt.Sprint(i + 1)},
+			{Text: orDash(message.Exchange)},
+			{Text: orDash(message.RoutingKey)},
+			{Text: orDash(message.property("content_type"))},
+			{Text: format.Bytes(int64(message.PayloadBytes))},
+			{Text: strings.Replace(body, "\n", " ", -1)},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("get", "[--vhost v] [--count n] [--ack] [--raw] [--base64] [--proto-descriptor f] [--proto-type t] <queue> peek at messages", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("get")
+		vhost := flags.String("vhost", "", "vhost of the queue, the default vhost when omitted")
+		count := flags.Int("count", 10, "messages to fetch")
+		ack := flags.Bool("ack", false, "remove the messages from the queue instead of requeueing them")
+		payloadOpts := payloadFlags(flags)
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = cli.vhost(*vhost)
+		if flags.NArg() != 1 {
+			return nil, usageError("get: expected queue name")
+		}
+		opts, err := payloadOpts()
+		if err != nil {
+			return nil, usageError("get: %s", err)
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		messages, err := rabbitmq.management().GetMessages(*vhost, flags.Arg(0), *count, !*ack)
+		if err != nil {
+			return nil, err
+		}
+		if cli.json || cli.csv {
+			return GetMessageList{Messages: messages, opts: opts}, nil
+		}
+		for i, message := range messages {
+			line := fmt.Sprintf("#%d exchange=%q routing_key=%q", i+1, message.Exchange, message.RoutingKey)
+			body := FormatPayload(message.Body(), message.property("content_type"), message.property("content_encoding"), opts)
+			fmt.Fprintln(cli.out, formatBodyLine(line, body))
+		}
+		return nil, nil
+	})
+}
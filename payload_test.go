@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func varint(value int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutVarint(buf, value)]
+}
+
+// protoBytes encode a length delimited field
+func protoBytes(number int, data []byte) []byte {
+	return protowire.AppendBytes(protowire.AppendTag(nil, protowire.Number(number), protowire.BytesType), data)
+}
+
+// protoVarint encode a varint field
+func protoVarint(number int, value uint64) []byte {
+	return protowire.AppendVarint(protowire.AppendTag(nil, protowire.Number(number), protowire.VarintType), value)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestFormatPayloadJSONAndGzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(`{"id":1}`))
+	w.Close()
+	assert.Contains(t, FormatPayload(buf.Bytes(), "", "", PayloadOptions{}), " -> 8 bytes)\n{\n  \"id\": 1\n}")
+	assert.Equal(t, "{\n  \"id\": 1\n}", FormatPayload([]byte(`{"id":1}`), "application/json", "", PayloadOptions{}))
+	assert.Equal(t, `{"id":1}`, FormatPayload([]byte(`{"id":1}`), "", "", PayloadOptions{Raw: true}))
+	assert.Equal(t, "eyJpZCI6MX0=", FormatPayload([]byte(`{"id":1}`), "", "", PayloadOptions{Base64: true}))
+	assert.Equal(t, "hello", FormatPayload([]byte("hello"), "text/plain", "", PayloadOptions{}))
+	assert.Contains(t, FormatPayload([]byte{0, 1, 2, 0xff}, "", "", PayloadOptions{}), "00 01 02 ff")
+}
+
+func TestFormatPayloadProtobuf(t *testing.T) {
+	address := protoBytes(1, []byte("Main St"))
+	order := concat(protoVarint(1, 150), protoBytes(2, []byte("book")), protoBytes(3, address), protoVarint(4, 3))
+	assert.Equal(t, "1: 150\n2: \"book\"\n3 {\n  1: \"Main St\"\n}\n4: 3",
+		FormatPayload(order, "application/x-protobuf", "", PayloadOptions{}))
+
+	field := func(name string, number int32, fieldType descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		desc := &descriptorpb.FieldDescriptorProto{
+			Name: proto.String(name), Number: proto.Int32(number), Type: fieldType.Enum(),
+			Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if typeName != "" {
+			desc.TypeName = proto.String(typeName)
+		}
+		return desc
+	}
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name: proto.String("shop.proto"), Package: proto.String("shop"), Syntax: proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				field("item", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("address", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".shop.Order.Address"),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name:  proto.String("Address"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("street", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")},
+			}},
+		}},
+	}}})
+	assert.Nil(t, err)
+	descs, err := ParseProtoDescriptors(set)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"shop.Order", "shop.Order.Address"}, descs.Names())
+
+	// the text format varies its whitespace on purpose, compare the tokens
+	tokens := func(text string) []string { return strings.Fields(strings.Replace(text, ":", " : ", -1)) }
+	opts := PayloadOptions{Proto: descs}
+	assert.Equal(t, tokens("id: 150\nitem: \"book\"\naddress: {\n  street: \"Main St\"\n}\n4: 3"),
+		tokens(FormatPayload(order, "application/x-protobuf; proto=shop.Order", "", opts)))
+	_, err = descs.Decode(order, "shop.Missing")
+	assert.NotNil(t, err)
+}
+
+func TestAvroContainerSchema(t *testing.T) {
+	schema := `{"type":"string"}`
+	header := concat(avroMagic, varint(1),
+		varint(int64(len("avro.schema"))), []byte("avro.schema"),
+		varint(int64(len(schema))), []byte(schema),
+		varint(0))
+	got, err := avroContainerSchema(header)
+	assert.Nil(t, err)
+	assert.Equal(t, schema, got)
+	assert.Contains(t, FormatPayload(header, "", "", PayloadOptions{}), "avro container")
+}
+
+func TestFormatBodyLine(t *testing.T) {
+	assert.Equal(t, "#1 body", formatBodyLine("#1", "body"))
+	assert.Equal(t, "#1\n  {\n  }", formatBodyLine("#1", "{\n}"))
+}
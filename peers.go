@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// PeerAnnotation : workload information for a connection peer
+type PeerAnnotation struct {
+	Pod        string `json:"pod"`
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+}
+
+// PeerResolver maps the peer ip of a connection to the workload owning it
+type PeerResolver interface {
+	Resolve(ip string) (PeerAnnotation, bool)
+}
+
+// AnnotatedConnection : connection together with its peer annotation
+type AnnotatedConnection struct {
+	rabtap.RabbitConnection
+	Peer *PeerAnnotation `json:"peer,omitempty"`
+}
+
+// AnnotateConnections resolve the peer of every connection
+func AnnotateConnections(conns []rabtap.RabbitConnection, resolver PeerResolver) []AnnotatedConnection {
+	result := make([]AnnotatedConnection, 0, len(conns))
+	for _, conn := range conns {
+		annotated := AnnotatedConnection{RabbitConnection: conn}
+		if peer, ok := resolver.Resolve(conn.PeerHost); ok {
+			annotated.Peer = &peer
+		}
+		result = append(result, annotated)
+	}
+	return result
+}
+
+// CIDRMapping : static mapping of a network to a workload
+type CIDRMapping struct {
+	CIDR string `json:"cidr"`
+	PeerAnnotation
+	network *net.IPNet
+}
+
+// CIDRResolver resolves peers against a list of cidr mappings, first match wins
+type CIDRResolver struct {
+	mappings []CIDRMapping
+}
+
+// LoadCIDRResolver read a json file containing a list of cidr mappings
+func LoadCIDRResolver(path string) (*CIDRResolver, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mappings []CIDRMapping
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return nil, err
+	}
+	return NewCIDRResolver(mappings)
+}
+
+// NewCIDRResolver create a resolver from the given mappings
+func NewCIDRResolver(mappings []CIDRMapping) (*CIDRResolver, error) {
+	for i := range mappings {
+		cidr := mappings[i].CIDR
+		// a bare address is a network of its own, /32 or /128 for ipv6
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		mappings[i].network = network
+	}
+	return &CIDRResolver{mappings: mappings}, nil
+}
+
+// Resolve find the first mapping containing ip
+func (resolver *CIDRResolver) Resolve(ip string) (PeerAnnotation, bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return PeerAnnotation{}, false
+	}
+	for _, mapping := range resolver.mappings {
+		if mapping.network.Contains(addr) {
+			return mapping.PeerAnnotation, true
+		}
+	}
+	return PeerAnnotation{}, false
+}
+
+type kubernetesPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name            string `json:"name"`
+			Namespace       string `json:"namespace"`
+			OwnerReferences []struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"ownerReferences"`
+		} `json:"metadata"`
+		Status struct {
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// KubernetesResolver resolves peers against the pods known to the kubernetes
+// api, using the in-cluster service account
+type KubernetesResolver struct {
+	pods map[string]PeerAnnotation
+}
+
+// NewKubernetesResolver list all pods of the cluster once and index them by ip
+func NewKubernetesResolver() (*KubernetesResolver, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running inside a kubernetes cluster")
+	}
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/api/v1/pods", net.JoinHostPort(host, port)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing pods: %s", res.Status)
+	}
+	var podList kubernetesPodList
+	if err := json.NewDecoder(res.Body).Decode(&podList); err != nil {
+		return nil, err
+	}
+	return newKubernetesResolver(podList), nil
+}
+
+// newKubernetesResolver index the pods of podList by their ip
+func newKubernetesResolver(podList kubernetesPodList) *KubernetesResolver {
+	resolver := &KubernetesResolver{pods: map[string]PeerAnnotation{}}
+	for _, pod := range podList.Items {
+		if pod.Status.PodIP == "" {
+			continue
+		}
+		annotation := PeerAnnotation{Pod: pod.Metadata.Name, Namespace: pod.Metadata.Namespace}
+		for _, owner := range pod.Metadata.OwnerReferences {
+			if owner.Kind == "ReplicaSet" {
+				annotation.Deployment = deploymentOfReplicaSet(owner.Name)
+			}
+		}
+		resolver.pods[normalizeIP(pod.Status.PodIP)] = annotation
+	}
+	return resolver
+}
+
+// normalizeIP the canonical text of an ip, ipv4 mapped ipv6 addresses as
+// ipv4. Anything that is no ip is returned as it is.
+func normalizeIP(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.String()
+	}
+	return addr.String()
+}
+
+// deploymentOfReplicaSet strip the pod template hash from a replica set name
+func deploymentOfReplicaSet(name string) string {
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// Resolve lookup the pod with the given ip
+func (resolver *KubernetesResolver) Resolve(ip string) (PeerAnnotation, bool) {
+	annotation, ok := resolver.pods[normalizeIP(ip)]
+	return annotation, ok
+}
+
+// PeerOptions : where to resolve connection peers from, kubernetes is used
+// when no mapping file is given
+type PeerOptions struct {
+	MappingFile string `json:"mappingFile"`
+}
+
+// ParsePeerOptions : parse peer options sent by the ui
+func ParsePeerOptions(str string) PeerOptions {
+	var res PeerOptions
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		fmt.Println(err)
+	}
+	return res
+}
+
+// AnnotatedConnections list the connections annotated with their workloads
+func (rabbitmq *Rabbitmq) AnnotatedConnections(opts PeerOptions) ([]AnnotatedConnection, error) {
+	var resolver PeerResolver
+	var err error
+	if opts.MappingFile != "" {
+		resolver, err = LoadCIDRResolver(opts.MappingFile)
+	} else {
+		resolver, err = NewKubernetesResolver()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rabbitmq.UpdateBrokerInfo(); err != nil {
+		return nil, err
+	}
+	return AnnotateConnections(rabbitmq.info().Connections, resolver), nil
+}
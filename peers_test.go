@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCIDRResolver(t *testing.T) {
+	resolver, err := NewCIDRResolver([]CIDRMapping{
+		{CIDR: "10.0.1.5", PeerAnnotation: PeerAnnotation{Pod: "orders-1"}},
+		{CIDR: "10.0.0.0/16", PeerAnnotation: PeerAnnotation{Namespace: "prod"}},
+		{CIDR: "fd00::5", PeerAnnotation: PeerAnnotation{Pod: "orders-2"}},
+	})
+	assert.Nil(t, err)
+
+	conns := []rabtap.RabbitConnection{{PeerHost: "10.0.1.5"}, {PeerHost: "10.0.2.1"}, {PeerHost: "192.168.0.1"},
+		{PeerHost: "fd00::5"}, {PeerHost: "fd00::6"}}
+	annotated := AnnotateConnections(conns, resolver)
+	assert.Equal(t, "orders-1", annotated[0].Peer.Pod)
+	assert.Equal(t, "prod", annotated[1].Peer.Namespace)
+	assert.Nil(t, annotated[2].Peer)
+	assert.Equal(t, "orders-2", annotated[3].Peer.Pod)
+	assert.Nil(t, annotated[4].Peer)
+}
+
+func TestKubernetesResolver(t *testing.T) {
+	var podList kubernetesPodList
+	err := json.Unmarshal([]byte(`{"items": [
+		{"metadata": {"name": "orders-5d8f7c9b4-x2x", "namespace": "prod",
+			"ownerReferences": [{"kind": "ReplicaSet", "name": "orders-5d8f7c9b4"}]},
+		 "status": {"podIP": "10.0.0.5"}},
+		{"metadata": {"name": "billing-0", "namespace": "prod"}, "status": {"podIP": "fd00:0:0::7"}},
+		{"metadata": {"name": "pending", "namespace": "prod"}, "status": {}}
+	]}`), &podList)
+	assert.Nil(t, err)
+	resolver := newKubernetesResolver(podList)
+
+	for _, ip := range []string{"10.0.0.5", "::ffff:10.0.0.5", "::FFFF:10.0.0.5"} {
+		annotation, ok := resolver.Resolve(ip)
+		assert.True(t, ok, ip)
+		assert.Equal(t, "orders", annotation.Deployment, ip)
+	}
+	for _, ip := range []string{"fd00::7", "FD00:0000::0007"} {
+		annotation, ok := resolver.Resolve(ip)
+		assert.True(t, ok, ip)
+		assert.Equal(t, "billing-0", annotation.Pod, ip)
+	}
+	_, ok := resolver.Resolve("10.0.0.6")
+	assert.False(t, ok)
+	assert.Equal(t, "not-an-ip", normalizeIP("not-an-ip"))
+}
+
+func TestDeploymentOfReplicaSet(t *testing.T) {
+	assert.Equal(t, "orders", deploymentOfReplicaSet("orders-5d8f7c9b4"))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// placementQueue : queue columns describing where the replicas of a queue live
+type placementQueue struct {
+	Vhost                  string   `json:"vhost"`
+	Name                   string   `json:"name"`
+	Type                   string   `json:"type"`
+	Node                   string   `json:"node"`
+	Leader                 string   `json:"leader"`
+	Members                []string `json:"members"`
+	Online                 []string `json:"online"`
+	SlaveNodes             []string `json:"slave_nodes"`
+	SynchronisedSlaveNodes []string `json:"synchronised_slave_nodes"`
+}
+
+// replicated convert classic mirrored queues to the quorum layout: the master
+// is the leader, the mirrors are members and the synchronised ones are online
+func (queue placementQueue) replicated() (QuorumQueue, bool) {
+	res := QuorumQueue{Vhost: queue.Vhost, Name: queue.Name, Type: queue.Type, Leader: queue.Leader, Members: queue.Members, Online: queue.Online}
+	switch {
+	case queue.Type == "quorum":
+		return res, true
+	case len(queue.SlaveNodes) > 0:
+		res.Type = "classic"
+		res.Leader = queue.Node
+		res.Members = append([]string{queue.Node}, queue.SlaveNodes...)
+		res.Online = append([]string{queue.Node}, queue.SynchronisedSlaveNodes...)
+		return res, true
+	}
+	return res, false
+}
+
+// ReplicatedQueues list quorum and classic mirrored queues
+func (client *ManagementClient) ReplicatedQueues() ([]QuorumQueue, error) {
+	var queues []placementQueue
+	if err := client.get("queues?columns=vhost,name,type,node,leader,members,online,slave_nodes,synchronised_slave_nodes", &queues); err != nil {
+		return nil, err
+	}
+	res := []QuorumQueue{}
+	for _, queue := range queues {
+		if replicated, ok := queue.replicated(); ok {
+			res = append(res, replicated)
+		}
+	}
+	return res, nil
+}
+
+// PlacementMove : suggestion to move leaders from a hot node
+type PlacementMove struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Queues int    `json:"queues"`
+}
+
+// PlacementReport : leader distribution of all replicated queues
+type PlacementReport struct {
+	QuorumReport
+	ByType     map[string]int  `json:"byType"`
+	HotNodes   []string        `json:"hotNodes"`
+	Moves      []PlacementMove `json:"moves"`
+	Rebalanced bool            `json:"rebalanced"`
+}
+
+// BuildPlacementReport find the nodes leading more than their fair share of
+// queues and suggest how many leaders to move to the coldest nodes
+func BuildPlacementReport(queues []QuorumQueue) PlacementReport {
+	report := PlacementReport{QuorumReport: BuildQuorumReport(queues), ByType: map[string]int{}, HotNodes: []string{}, Moves: []PlacementMove{}}
+	for _, queue := range queues {
+		report.ByType[queue.Type]++
+	}
+	if len(report.Nodes) < 2 {
+		return report
+	}
+	fair := report.Queues / len(report.Nodes)
+	excess := map[string]int{}
+	cold := []NodeLeaders{}
+	for _, n := range report.Nodes {
+		if n.Share > leaderImbalance/float64(len(report.Nodes)) {
+			report.HotNodes = append(report.HotNodes, n.Node)
+			excess[n.Node] = n.Leaders - fair
+		}
+		if n.Leaders < fair {
+			cold = append(cold, n)
+		}
+	}
+	sort.Slice(cold, func(i, j int) bool { return cold[i].Leaders < cold[j].Leaders })
+	for _, hot := range report.HotNodes {
+		for i := range cold {
+			count := fair - cold[i].Leaders
+			if count > excess[hot] {
+				count = excess[hot]
+			}
+			if count <= 0 {
+				continue
+			}
+			report.Moves = append(report.Moves, PlacementMove{From: hot, To: cold[i].Node, Queues: count})
+			cold[i].Leaders += count
+			excess[hot] -= count
+		}
+	}
+	return report
+}
+
+// Table leaders per node and suggested moves as table
+func (report PlacementReport) Table(format NumberFormat) Table {
+	table := report.QuorumReport.Table(format)
+	for _, move := range report.Moves {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: fmt.Sprintf("move %s leaders from %s to %s", format.Count(int64(move.Queues)), move.From, move.To), Color: Yellow},
+			{Text: "-"}, {Text: "-"}, {Text: "-"},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("placement", "[--rebalance] leader placement of quorum and mirrored queues", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("placement")
+		rebalance := flags.Bool("rebalance", false, "trigger a rebalance when hot nodes are found")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		queues, err := rabbitmq.management().ReplicatedQueues()
+		if err != nil {
+			return nil, err
+		}
+		report := BuildPlacementReport(queues)
+		if *rebalance && len(report.HotNodes) > 0 {
+			if err := rabbitmq.management().RebalanceQueues(); err != nil {
+				return report, err
+			}
+			report.Rebalanced = true
+		}
+		return report, nil
+	})
+}
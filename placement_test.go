@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlacementQueueReplicated(t *testing.T) {
+	mirrored := placementQueue{Name: "ha", Node: "rabbit@a", SlaveNodes: []string{"rabbit@b", "rabbit@c"}, SynchronisedSlaveNodes: []string{"rabbit@b"}}
+	queue, ok := mirrored.replicated()
+	assert.True(t, ok)
+	assert.Equal(t, "rabbit@a", queue.Leader)
+	assert.Equal(t, []string{"rabbit@a", "rabbit@b", "rabbit@c"}, queue.Members)
+	assert.Equal(t, []string{"rabbit@a", "rabbit@b"}, queue.Online)
+
+	_, ok = placementQueue{Name: "plain", Node: "rabbit@a"}.replicated()
+	assert.False(t, ok)
+}
+
+func TestBuildPlacementReport(t *testing.T) {
+	members := []string{"rabbit@a", "rabbit@b", "rabbit@c"}
+	queues := []QuorumQueue{}
+	for i := 0; i < 6; i++ {
+		queues = append(queues, QuorumQueue{Type: "quorum", Leader: "rabbit@a", Members: members, Online: members})
+	}
+	queues = append(queues, QuorumQueue{Type: "classic", Leader: "rabbit@b", Members: members, Online: members})
+	report := BuildPlacementReport(queues)
+	assert.Equal(t, map[string]int{"quorum": 6, "classic": 1}, report.ByType)
+	assert.Equal(t, []string{"rabbit@a"}, report.HotNodes)
+	assert.Equal(t, []PlacementMove{{From: "rabbit@a", To: "rabbit@c", Queues: 2}, {From: "rabbit@a", To: "rabbit@b", Queues: 1}}, report.Moves)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// pluginProtocol version sent to exec plugins
+const pluginProtocol = 1
+
+// defaultPluginTimeout time an exec plugin gets to answer
+const defaultPluginTimeout = 30 * time.Second
+
+// plugin hooks
+const (
+	HookAnalyze = "analyze"
+	HookSection = "section"
+	HookNotify  = "notify"
+)
+
+// Finding : something an analyzer found, alerting like a rule match
+type Finding struct {
+	Severity string `json:"severity"`
+	Vhost    string `json:"vhost,omitempty"`
+	Object   string `json:"object"`
+	Summary  string `json:"summary"`
+}
+
+// Analyzer : custom check of the broker state, evaluated by the alert
+// engine along with the rules
+type Analyzer interface {
+	Name() string
+	Analyze(info rabtap.BrokerInfo) ([]Finding, error)
+}
+
+// Notifier : notification channel the fired and resolved alerts are sent to
+type Notifier interface {
+	Name() string
+	Notify(change AlertChange) error
+}
+
+var pluginMutex sync.Mutex
+var analyzers = map[string]Analyzer{}
+var notifiers = map[string]Notifier{}
+
+// RegisterAnalyzer add an analyzer, usually from the init function of the
+// package providing it
+func RegisterAnalyzer(analyzer Analyzer) {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+	analyzers[analyzer.Name()] = analyzer
+}
+
+// RegisterNotifier add a notification channel
+func RegisterNotifier(notifier Notifier) {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+	notifiers[notifier.Name()] = notifier
+}
+
+// RegisterReportSection add a report section, sections of the same name
+// are replaced
+func RegisterReportSection(name string, title string, build func(info rabtap.BrokerInfo) Tabular) {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+	reportSections[name] = reportSection{title: title, build: build}
+}
+
+// registeredAnalyzers the analyzers ordered by name
+func registeredAnalyzers() []Analyzer {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+	list := make([]Analyzer, 0, len(analyzers))
+	for _, analyzer := range analyzers {
+		list = append(list, analyzer)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// registeredNotifiers the notifiers ordered by name
+func registeredNotifiers() []Notifier {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+	list := make([]Notifier, 0, len(notifiers))
+	for _, notifier := range notifiers {
+		list = append(list, notifier)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// ExecPlugin : a program extending radish. It is started once per call
+// with a PluginRequest as json on stdin and answers with a PluginResponse
+// as json on stdout, a non zero exit code fails the call with its stderr.
+type ExecPlugin struct {
+	PluginName string   `yaml:"name" json:"name"`
+	Command    string   `yaml:"command" json:"command"`
+	Args       []string `yaml:"args,omitempty" json:"args,omitempty"`
+	// Hooks analyze, section and notify the plugin implements
+	Hooks []string `yaml:"hooks" json:"hooks"`
+	// Title of its report section, defaults to the name
+	Title   string        `yaml:"title,omitempty" json:"title,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// PluginRequest : json sent to an exec plugin
+type PluginRequest struct {
+	Protocol int                `json:"protocol"`
+	Hook     string             `json:"hook"`
+	Info     *rabtap.BrokerInfo `json:"info,omitempty"`
+	Change   *AlertChange       `json:"change,omitempty"`
+}
+
+// PluginResponse : json answered by an exec plugin, findings for analyze,
+// a table for section, nothing for notify
+type PluginResponse struct {
+	Findings []Finding    `json:"findings,omitempty"`
+	Table    *PluginTable `json:"table,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// PluginTable : a table returned by a plugin
+type PluginTable struct {
+	Headers []string   `json:"headers"`
+	Rows    [][]string `json:"rows"`
+}
+
+// Table the rows as plain cells
+func (table PluginTable) Table(format NumberFormat) Table {
+	result := Table{Headers: table.Headers}
+	for _, row := range table.Rows {
+		cells := make([]Cell, len(row))
+		for i, text := range row {
+			cells[i] = Cell{Text: text}
+		}
+		result.Rows = append(result.Rows, cells)
+	}
+	return result
+}
+
+// Name of the plugin
+func (plugin ExecPlugin) Name() string {
+	return plugin.PluginName
+}
+
+// call run the plugin with the request
+func (plugin ExecPlugin) call(request PluginRequest) (PluginResponse, error) {
+	var response PluginResponse
+	request.Protocol = pluginProtocol
+	data, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	timeout := plugin.Timeout
+	if timeout <= 0 {
+		timeout = defaultPluginTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, plugin.Command, plugin.Args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return response, fmt.Errorf("plugin %s: %s %s", plugin.PluginName, err, strings.TrimSpace(stderr.String()))
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return response, nil
+	}
+	if err := json.Unmarshal(out, &response); err != nil {
+		return response, fmt.Errorf("plugin %s: invalid response: %s", plugin.PluginName, err)
+	}
+	if response.Error != "" {
+		return response, fmt.Errorf("plugin %s: %s", plugin.PluginName, response.Error)
+	}
+	return response, nil
+}
+
+// Analyze run the analyze hook, findings default to warnings
+func (plugin ExecPlugin) Analyze(info rabtap.BrokerInfo) ([]Finding, error) {
+	response, err := plugin.call(PluginRequest{Hook: HookAnalyze, Info: &info})
+	if err != nil {
+		return nil, err
+	}
+	for i := range response.Findings {
+		if response.Findings[i].Severity == "" {
+			response.Findings[i].Severity = SeverityWarning
+		}
+	}
+	return response.Findings, nil
+}
+
+// Notify run the notify hook
+func (plugin ExecPlugin) Notify(change AlertChange) error {
+	_, err := plugin.call(PluginRequest{Hook: HookNotify, Change: &change})
+	return err
+}
+
+// Section run the section hook, failures are shown in the section
+func (plugin ExecPlugin) Section(info rabtap.BrokerInfo) Tabular {
+	response, err := plugin.call(PluginRequest{Hook: HookSection, Info: &info})
+	if err == nil && response.Table == nil {
+		err = fmt.Errorf("plugin %s: no table in the response", plugin.PluginName)
+	}
+	if err != nil {
+		return PluginTable{Headers: []string{"ERROR"}, Rows: [][]string{{err.Error()}}}
+	}
+	return *response.Table
+}
+
+// PluginConfig : the plugins file
+type PluginConfig struct {
+	Plugins []ExecPlugin `yaml:"plugins"`
+}
+
+// LoadPlugins read a plugins yaml file and register every plugin for its
+// hooks
+func LoadPlugins(file string) (PluginConfig, error) {
+	var config PluginConfig
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %s", file, err)
+	}
+	for _, plugin := range config.Plugins {
+		if plugin.PluginName == "" || plugin.Command == "" {
+			return config, fmt.Errorf("%s: plugins need a name and a command", file)
+		}
+		for _, hook := range plugin.Hooks {
+			if !contains([]string{HookAnalyze, HookSection, HookNotify}, hook) {
+				return config, fmt.Errorf("%s: plugin %s: unknown hook %q, expected analyze, section or notify", file, plugin.PluginName, hook)
+			}
+		}
+	}
+	for _, plugin := range config.Plugins {
+		plugin := plugin
+		for _, hook := range plugin.Hooks {
+			switch hook {
+			case HookAnalyze:
+				RegisterAnalyzer(plugin)
+			case HookNotify:
+				RegisterNotifier(plugin)
+			case HookSection:
+				title := plugin.Title
+				if title == "" {
+					title = plugin.PluginName
+				}
+				RegisterReportSection(plugin.PluginName, title, plugin.Section)
+			}
+		}
+	}
+	return config, nil
+}
+
+// AnalyzerFinding : a finding with the analyzer that made it
+type AnalyzerFinding struct {
+	Analyzer string `json:"analyzer"`
+	Finding
+}
+
+// FindingList : findings of the analyzers
+type FindingList []AnalyzerFinding
+
+// Table one row per finding, colored by severity
+func (list FindingList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"ANALYZER", "SEVERITY", "VHOST", "OBJECT", "SUMMARY"}}
+	for _, finding := range list {
+		color := Yellow
+		if finding.Severity == SeverityCritical {
+			color = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: finding.Analyzer},
+			{Text: finding.Severity, Color: color},
+			{Text: orDash(finding.Vhost)},
+			{Text: finding.Object},
+			{Text: finding.Summary},
+		})
+	}
+	return table
+}
+
+// PluginList : the loaded exec plugins
+type PluginList []ExecPlugin
+
+// Table one row per plugin
+func (list PluginList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"NAME", "HOOKS", "COMMAND"}}
+	for _, plugin := range list {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: plugin.PluginName},
+			{Text: strings.Join(plugin.Hooks, ",")},
+			{Text: strings.TrimSpace(plugin.Command + " " + strings.Join(plugin.Args, " "))},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("plugins", "[--analyze] list the exec plugins of --plugins, run their analyzers against the broker", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("plugins")
+		analyze := flags.Bool("analyze", false, "run the analyzers and list their findings")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if cli.pluginsFile == "" {
+			return nil, usageError("plugins: expected --plugins")
+		}
+		if !*analyze {
+			return PluginList(cli.plugins.Plugins), nil
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		findings, failed := FindingList{}, 0
+		for _, analyzer := range registeredAnalyzers() {
+			list, err := analyzer.Analyze(rabbitmq.info())
+			if err != nil {
+				subsystemLog("plugins").Errorf("%s", err)
+				failed++
+				continue
+			}
+			for _, finding := range list {
+				findings = append(findings, AnalyzerFinding{Analyzer: analyzer.Name(), Finding: finding})
+			}
+		}
+		if failed > 0 {
+			return findings, &CLIError{Code: ExitPartialFailure, Err: fmt.Errorf("%d analyzers failed", failed)}
+		}
+		return findings, nil
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unregisterPlugin remove what LoadPlugins registered for name
+func unregisterPlugin(name string) {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+	delete(analyzers, name)
+	delete(notifiers, name)
+	delete(reportSections, name)
+}
+
+func TestExecPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin scripts need sh")
+	}
+	dir, _ := ioutil.TempDir("", "plugins")
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "capacity.sh")
+	ioutil.WriteFile(script, []byte(`#!/bin/sh
+request=$(cat)
+case "$request" in
+*'"hook":"analyze"'*) echo '{"findings":[{"vhost":"/","object":"orders","summary":"orders is near its limit"}]}' ;;
+*'"hook":"section"'*) echo '{"table":{"headers":["QUEUE","LIMIT"],"rows":[["orders","90%"]]}}' ;;
+*'"hook":"notify"'*) echo "$request" > "$(dirname "$0")/notified" ;;
+esac
+`), 0755)
+	file := filepath.Join(dir, "plugins.yml")
+	ioutil.WriteFile(file, []byte("plugins:\n- name: capacity\n  command: "+script+"\n  hooks: [analyze, section, notify]\n  title: Capacity\n"), 0644)
+
+	config, err := LoadPlugins(file)
+	assert.Nil(t, err)
+	defer unregisterPlugin("capacity")
+	assert.Equal(t, 1, len(config.Plugins))
+
+	engine := NewAlertEngine(AlertRules{}, nil)
+	changes := engine.Evaluate(&Snapshot{Info: reportInfo()}, time.Now())
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, "capacity", changes[0].Alert.Rule)
+	assert.Equal(t, SeverityWarning, changes[0].Alert.Severity)
+	assert.Equal(t, "orders", changes[0].Alert.Object)
+
+	report, err := BuildReport("daily", []string{"capacity"}, reportInfo(), time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, "Capacity", report.Sections[0].Title)
+	markdown, _ := report.Render(ReportMarkdown, NumberFormat{})
+	assert.True(t, strings.Contains(string(markdown), "| orders | 90% |"))
+
+	assert.Nil(t, NewAlertNotifier(nil).Notify(changes[0]))
+	notified, err := ioutil.ReadFile(filepath.Join(dir, "notified"))
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(notified), `"protocol":1`))
+
+	ioutil.WriteFile(script, []byte("#!/bin/sh\necho broken >&2\nexit 3\n"), 0755)
+	_, err = ExecPlugin{PluginName: "capacity", Command: script}.Analyze(reportInfo())
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "broken"))
+	assert.Equal(t, 0, len(engine.Evaluate(&Snapshot{Info: reportInfo()}, time.Now())))
+
+	ioutil.WriteFile(file, []byte("plugins:\n- name: x\n  command: x\n  hooks: [transform]\n"), 0644)
+	_, err = LoadPlugins(file)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// xDeath : one entry of the x-death header the broker adds when it
+// dead letters a message
+type xDeath struct {
+	Queue  string
+	Reason string
+	Count  int
+}
+
+// parseXDeath entries of the x-death header of a message fetched with get
+func parseXDeath(headers map[string]interface{}) []xDeath {
+	entries, _ := headers["x-death"].([]interface{})
+	var deaths []xDeath
+	for _, entry := range entries {
+		table, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		death := xDeath{}
+		death.Queue, _ = table["queue"].(string)
+		death.Reason, _ = table["reason"].(string)
+		if count, ok := table["count"].(float64); ok {
+			death.Count = int(count)
+		}
+		deaths = append(deaths, death)
+	}
+	return deaths
+}
+
+// PoisonSample : messages fetched from the head of a queue
+type PoisonSample struct {
+	Vhost    string
+	Queue    string
+	Messages []QueueMessage
+}
+
+// SamplePoison fetch up to count messages from each non empty queue whose
+// name matches pattern. The messages are requeued, the broker marks them
+// redelivered from then on.
+func SamplePoison(client *ManagementClient, info rabtap.BrokerInfo, pattern *regexp.Regexp, count int) ([]PoisonSample, error) {
+	var samples []PoisonSample
+	for _, queue := range info.Queues {
+		if queue.MessagesReady == 0 || (pattern != nil && !pattern.MatchString(queue.Name)) {
+			continue
+		}
+		messages, err := client.GetMessages(queue.Vhost, queue.Name, count, true)
+		if err != nil {
+			return samples, err
+		}
+		samples = append(samples, PoisonSample{queue.Vhost, queue.Name, messages})
+	}
+	return samples, nil
+}
+
+// PoisonSuspect : messages that died or were redelivered repeatedly,
+// grouped by the queue they kept failing in
+type PoisonSuspect struct {
+	Vhost       string   `json:"vhost"`
+	Queue       string   `json:"queue"`
+	Messages    int      `json:"messages"`
+	MaxDeaths   int      `json:"maxDeaths"`
+	Redelivered int      `json:"redelivered"`
+	Reasons     []string `json:"reasons"`
+	FoundIn     []string `json:"foundIn"`
+	Consumers   []string `json:"consumers"`
+	MessageIDs  []string `json:"messageIds,omitempty"`
+	Action      string   `json:"action"`
+}
+
+// PoisonReport : poison message suspects, most deaths first
+type PoisonReport struct {
+	Scanned  int             `json:"scanned"`
+	Suspects []PoisonSuspect `json:"suspects"`
+}
+
+// maxPoisonIDs message ids kept per suspect
+const maxPoisonIDs = 5
+
+// poisonAction what to look at for a suspect
+func poisonAction(suspect PoisonSuspect) string {
+	for _, reason := range suspect.Reasons {
+		if reason == "rejected" && len(suspect.Consumers) > 0 {
+			return "consumers reject these messages, check their logs for the message ids"
+		}
+	}
+	for _, reason := range suspect.Reasons {
+		switch reason {
+		case "rejected":
+			return "messages were rejected by consumers that are gone, replay them once fixed"
+		case "expired":
+			return "messages expire before consumption, raise the ttl or add consumers"
+		case "maxlen":
+			return "queue overflows, raise max-length or add consumers"
+		case "delivery_limit":
+			return "quorum delivery limit reached, consumers crash or nack before acking"
+		}
+	}
+	return "messages are redelivered, consumers close their channel before acking"
+}
+
+// AnalyzePoison find messages dead lettered at least minDeaths times or
+// redelivered, and correlate them to the consumers of the queue they died in
+func AnalyzePoison(info rabtap.BrokerInfo, samples []PoisonSample, minDeaths int) PoisonReport {
+	report := PoisonReport{Suspects: []PoisonSuspect{}}
+	suspects := map[string]*PoisonSuspect{}
+	suspect := func(vhost string, queue string) *PoisonSuspect {
+		key := vhost + "/" + queue
+		if suspects[key] == nil {
+			suspects[key] = &PoisonSuspect{Vhost: vhost, Queue: queue}
+		}
+		return suspects[key]
+	}
+	for _, sample := range samples {
+		for _, message := range sample.Messages {
+			report.Scanned++
+			headers, _ := message.Properties["headers"].(map[string]interface{})
+			deaths := parseXDeath(headers)
+			total, origin, reasons := 0, sample.Queue, []string{}
+			for _, death := range deaths {
+				total += death.Count
+				reasons = append(reasons, death.Reason)
+			}
+			if len(deaths) > 0 {
+				// x-death is sorted most recent first
+				origin = deaths[0].Queue
+			}
+			if total < minDeaths && !message.Redelivered {
+				continue
+			}
+			s := suspect(sample.Vhost, origin)
+			s.Messages++
+			if total > s.MaxDeaths {
+				s.MaxDeaths = total
+			}
+			if message.Redelivered {
+				s.Redelivered++
+			}
+			s.Reasons = appendUnique(s.Reasons, reasons...)
+			s.FoundIn = appendUnique(s.FoundIn, sample.Queue)
+			if id := message.property("message_id"); id != "" && len(s.MessageIDs) < maxPoisonIDs {
+				s.MessageIDs = append(s.MessageIDs, id)
+			}
+		}
+	}
+	for _, consumer := range info.Consumers {
+		s := suspects[consumer.Queue.Vhost+"/"+consumer.Queue.Name]
+		if s == nil {
+			continue
+		}
+		name := consumer.ChannelDetails.ConnectionName
+		if consumer.ChannelDetails.User != "" {
+			name = consumer.ChannelDetails.User + "@" + name
+		}
+		s.Consumers = appendUnique(s.Consumers, name)
+	}
+	for _, s := range suspects {
+		sort.Strings(s.Reasons)
+		sort.Strings(s.Consumers)
+		s.Action = poisonAction(*s)
+		report.Suspects = append(report.Suspects, *s)
+	}
+	sort.Slice(report.Suspects, func(i, j int) bool {
+		a, b := report.Suspects[i], report.Suspects[j]
+		if a.MaxDeaths != b.MaxDeaths {
+			return a.MaxDeaths > b.MaxDeaths
+		}
+		if a.Messages != b.Messages {
+			return a.Messages > b.Messages
+		}
+		return a.Vhost+"/"+a.Queue < b.Vhost+"/"+b.Queue
+	})
+	return report
+}
+
+// appendUnique append the values not yet in list
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, item := range list {
+			if item == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// Table suspects as table
+func (report PoisonReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "QUEUE", "MESSAGES", "DEATHS", "REDELIVERED", "REASONS", "FOUND IN", "CONSUMERS", "ACTION"}}
+	for _, s := range report.Suspects {
+		color := Yellow
+		if len(s.Consumers) > 0 {
+			color = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: s.Vhost},
+			{Text: s.Queue},
+			{Text: format.Count(int64(s.Messages))},
+			{Text: format.Count(int64(s.MaxDeaths)), Color: color},
+			{Text: format.Count(int64(s.Redelivered))},
+			{Text: orDash(strings.Join(s.Reasons, ","))},
+			{Text: strings.Join(s.FoundIn, ",")},
+			{Text: orDash(strings.Join(s.Consumers, ","))},
+			{Text: s.Action},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("poison", "[--queues regex] [--count n] [--min-deaths n] find messages that keep failing and the consumers rejecting them", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("poison")
+		queues := flags.String("queues", "", "only sample queues matching this regular expression")
+		count := flags.Int("count", 50, "messages fetched per queue, they are requeued")
+		minDeaths := flags.Int("min-deaths", 3, "x-death count making a message suspect")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		var pattern *regexp.Regexp
+		if *queues != "" {
+			var err error
+			if pattern, err = regexp.Compile(*queues); err != nil {
+				return nil, usageError("poison: --queues: %s", err)
+			}
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		samples, err := SamplePoison(rabbitmq.management(), rabbitmq.info(), pattern, *count)
+		if err != nil {
+			return nil, fmt.Errorf("sampling queues: %s", err)
+		}
+		return AnalyzePoison(rabbitmq.info(), samples, *minDeaths), nil
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzePoison(t *testing.T) {
+	info := rabtap.BrokerInfo{}
+	consumer := rabtap.RabbitConsumer{}
+	consumer.Queue.Vhost, consumer.Queue.Name = "/", "orders"
+	consumer.ChannelDetails.User, consumer.ChannelDetails.ConnectionName = "app", "billing"
+	info.Consumers = append(info.Consumers, consumer)
+
+	dead := QueueMessage{Properties: map[string]interface{}{
+		"message_id": "m-1",
+		"headers": map[string]interface{}{"x-death": []interface{}{
+			map[string]interface{}{"queue": "orders", "reason": "rejected", "count": float64(4)},
+			map[string]interface{}{"queue": "orders.retry", "reason": "expired", "count": float64(4)},
+		}},
+	}}
+	once := QueueMessage{Properties: map[string]interface{}{"headers": map[string]interface{}{"x-death": []interface{}{
+		map[string]interface{}{"queue": "orders", "reason": "rejected", "count": float64(1)},
+	}}}}
+	samples := []PoisonSample{
+		{Vhost: "/", Queue: "orders.dlq", Messages: []QueueMessage{dead, once}},
+		{Vhost: "/", Queue: "payments", Messages: []QueueMessage{{Redelivered: true}, {}}},
+	}
+
+	report := AnalyzePoison(info, samples, 3)
+	assert.Equal(t, 4, report.Scanned)
+	assert.Len(t, report.Suspects, 2)
+	assert.Equal(t, PoisonSuspect{
+		Vhost: "/", Queue: "orders", Messages: 1, MaxDeaths: 8,
+		Reasons: []string{"expired", "rejected"}, FoundIn: []string{"orders.dlq"},
+		Consumers: []string{"app@billing"}, MessageIDs: []string{"m-1"},
+		Action: "consumers reject these messages, check their logs for the message ids",
+	}, report.Suspects[0])
+	assert.Equal(t, "payments", report.Suspects[1].Queue)
+	assert.Equal(t, 1, report.Suspects[1].Redelivered)
+	assert.Equal(t, "messages are redelivered, consumers close their channel before acking", report.Suspects[1].Action)
+}
@@ -0,0 +1,82 @@
+package main
+
+// RabbitPolicy : policy as returned by the management api
+type RabbitPolicy struct {
+	Vhost      string                 `json:"vhost" yaml:"vhost"`
+	Name       string                 `json:"name" yaml:"name"`
+	Pattern    string                 `json:"pattern" yaml:"pattern"`
+	ApplyTo    string                 `json:"apply-to" yaml:"apply-to"`
+	Definition map[string]interface{} `json:"definition" yaml:"definition"`
+	Priority   int                    `json:"priority" yaml:"priority"`
+}
+
+// Policies list the policies of all vhosts
+func (client *ManagementClient) Policies() ([]RabbitPolicy, error) {
+	var policies []RabbitPolicy
+	err := client.get("policies", &policies)
+	return policies, err
+}
+
+// PutPolicy create or update a policy
+func (client *ManagementClient) PutPolicy(policy RabbitPolicy) error {
+	if err := client.scope.CheckPattern("policy", policy.Pattern); err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"pattern":    policy.Pattern,
+		"definition": policy.Definition,
+		"priority":   policy.Priority,
+		"apply-to":   policy.ApplyTo,
+	}
+	return client.put(policyPath(policy.Vhost, policy.Name), body)
+}
+
+// DeletePolicy delete a policy
+func (client *ManagementClient) DeletePolicy(vhost string, name string) error {
+	if err := client.checkPolicyDelete(policyPath(vhost, name)); err != nil {
+		return err
+	}
+	return client.delete(policyPath(vhost, name))
+}
+
+// PutOperatorPolicy create or update an operator policy. Operator
+// policies apply on top of the user policy matching a queue, for numeric
+// limits the lower value wins.
+func (client *ManagementClient) PutOperatorPolicy(policy RabbitPolicy) error {
+	if err := client.scope.CheckPattern("operator policy", policy.Pattern); err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"pattern":    policy.Pattern,
+		"definition": policy.Definition,
+		"priority":   policy.Priority,
+		"apply-to":   policy.ApplyTo,
+	}
+	return client.put(managementPath("operator-policies", policy.Vhost, policy.Name), body)
+}
+
+// DeleteOperatorPolicy delete an operator policy
+func (client *ManagementClient) DeleteOperatorPolicy(vhost string, name string) error {
+	path := managementPath("operator-policies", vhost, name)
+	if err := client.checkPolicyDelete(path); err != nil {
+		return err
+	}
+	return client.delete(path)
+}
+
+// checkPolicyDelete refuse deleting a policy at path whose pattern can match
+// names outside the scope, the pattern is fetched first
+func (client *ManagementClient) checkPolicyDelete(path string) error {
+	if client.scope.Empty() {
+		return nil
+	}
+	var policy RabbitPolicy
+	if err := client.get(path, &policy); err != nil {
+		return err
+	}
+	return client.scope.CheckPattern("policy", policy.Pattern)
+}
+
+func policyPath(vhost string, name string) string {
+	return managementPath("policies", vhost, name)
+}
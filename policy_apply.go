@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// policy definition keys known to rabbitmq
+var knownPolicyKeys = map[string]bool{
+	"alternate-exchange":            true,
+	"dead-letter-exchange":          true,
+	"dead-letter-routing-key":       true,
+	"dead-letter-strategy":          true,
+	"delivery-limit":                true,
+	"expires":                       true,
+	"federation-upstream":           true,
+	"federation-upstream-set":       true,
+	"ha-mode":                       true,
+	"ha-params":                     true,
+	"ha-promote-on-failure":         true,
+	"ha-promote-on-shutdown":        true,
+	"ha-sync-batch-size":            true,
+	"ha-sync-mode":                  true,
+	"initial-cluster-size":          true,
+	"max-age":                       true,
+	"max-length":                    true,
+	"max-length-bytes":              true,
+	"message-ttl":                   true,
+	"overflow":                      true,
+	"queue-leader-locator":          true,
+	"queue-master-locator":          true,
+	"queue-mode":                    true,
+	"queue-version":                 true,
+	"stream-max-segment-size-bytes": true,
+}
+
+var validApplyTo = map[string]bool{
+	"": true, "all": true, "queues": true, "exchanges": true,
+	"classic_queues": true, "quorum_queues": true, "streams": true,
+}
+
+// keys only supported by classic queues
+func classicOnlyPolicyKey(key string) bool {
+	return strings.HasPrefix(key, "ha-") || key == "queue-mode" || key == "queue-master-locator"
+}
+
+// PolicyFile : declarative list of policies
+type PolicyFile struct {
+	Policies []RabbitPolicy `yaml:"policies" json:"policies"`
+	// Prune delete existing policies of the listed vhosts missing in the file
+	Prune bool `yaml:"prune" json:"prune"`
+}
+
+// yamlToJSON convert the map[interface{}]interface{} values produced by the
+// yaml decoder into json compatible values
+func yamlToJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		res := map[string]interface{}{}
+		for key, item := range v {
+			res[fmt.Sprint(key)] = yamlToJSON(item)
+		}
+		return res
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = yamlToJSON(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlToJSON(item)
+		}
+		return v
+	}
+	return value
+}
+
+// LoadPolicyFile read policies from a yaml (or json) file
+func LoadPolicyFile(path string) (PolicyFile, error) {
+	var file PolicyFile
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return file, err
+	}
+	for i := range file.Policies {
+		if file.Policies[i].Definition != nil {
+			yamlToJSON(file.Policies[i].Definition)
+		}
+	}
+	return file, nil
+}
+
+// ValidatePolicies check policies for unknown keys and definitions not
+// supported by the queue types they apply to. queues are the existing queues
+// with their type.
+func ValidatePolicies(policies []RabbitPolicy, queues []QueueType) []error {
+	errs := []error{}
+	seen := map[string]bool{}
+	for _, policy := range policies {
+		id := policy.Vhost + "/" + policy.Name
+		if policy.Name == "" || policy.Vhost == "" {
+			errs = append(errs, fmt.Errorf("policy %q: name and vhost are required", id))
+			continue
+		}
+		if seen[id] {
+			errs = append(errs, fmt.Errorf("policy %s: declared twice", id))
+		}
+		seen[id] = true
+		if !validApplyTo[policy.ApplyTo] {
+			errs = append(errs, fmt.Errorf("policy %s: invalid apply-to %q", id, policy.ApplyTo))
+		}
+		pattern, err := regexp.Compile(policy.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("policy %s: %s", id, err))
+			continue
+		}
+		for key := range policy.Definition {
+			if !knownPolicyKeys[key] {
+				errs = append(errs, fmt.Errorf("policy %s: unknown key %s", id, key))
+			}
+			if !classicOnlyPolicyKey(key) {
+				continue
+			}
+			if policy.ApplyTo == "quorum_queues" || policy.ApplyTo == "streams" {
+				errs = append(errs, fmt.Errorf("policy %s: %s is not supported by %s", id, key, policy.ApplyTo))
+				continue
+			}
+			if policy.ApplyTo == "exchanges" {
+				continue
+			}
+			for _, queue := range queues {
+				if queue.Type != "" && queue.Type != "classic" && queue.Vhost == policy.Vhost && pattern.MatchString(queue.Name) {
+					errs = append(errs, fmt.Errorf("policy %s: %s would apply to %s queue %s", id, key, queue.Type, queue.Name))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// PolicyDiff : difference between desired and existing policies
+type PolicyDiff struct {
+	Added   []RabbitPolicy `json:"added"`
+	Updated []RabbitPolicy `json:"updated"`
+	Removed []RabbitPolicy `json:"removed"`
+}
+
+// Changes the diff as a list of changes
+func (diff PolicyDiff) Changes() []PolicyChange {
+	changes := []PolicyChange{}
+	for _, policy := range diff.Added {
+		changes = append(changes, PolicyChange{Policy: policy})
+	}
+	for _, policy := range diff.Updated {
+		changes = append(changes, PolicyChange{Policy: policy})
+	}
+	for _, policy := range diff.Removed {
+		changes = append(changes, PolicyChange{Policy: policy, Delete: true})
+	}
+	return changes
+}
+
+func samePolicy(a RabbitPolicy, b RabbitPolicy) bool {
+	applyTo := func(p RabbitPolicy) string {
+		if p.ApplyTo == "" {
+			return "all"
+		}
+		return p.ApplyTo
+	}
+	defA, _ := json.Marshal(a.Definition)
+	defB, _ := json.Marshal(b.Definition)
+	return a.Pattern == b.Pattern && a.Priority == b.Priority && applyTo(a) == applyTo(b) &&
+		reflect.DeepEqual(defA, defB)
+}
+
+// DiffPolicies compare desired with existing policies. With prune set,
+// existing policies of vhosts mentioned in desired but not declared are removed.
+func DiffPolicies(desired []RabbitPolicy, existing []RabbitPolicy, prune bool) PolicyDiff {
+	diff := PolicyDiff{Added: []RabbitPolicy{}, Updated: []RabbitPolicy{}, Removed: []RabbitPolicy{}}
+	current := map[string]RabbitPolicy{}
+	for _, policy := range existing {
+		current[policy.Vhost+"/"+policy.Name] = policy
+	}
+	declared := map[string]bool{}
+	vhosts := map[string]bool{}
+	for _, policy := range desired {
+		id := policy.Vhost + "/" + policy.Name
+		declared[id] = true
+		vhosts[policy.Vhost] = true
+		old, ok := current[id]
+		if !ok {
+			diff.Added = append(diff.Added, policy)
+		} else if !samePolicy(old, policy) {
+			diff.Updated = append(diff.Updated, policy)
+		}
+	}
+	if prune {
+		for _, policy := range existing {
+			if vhosts[policy.Vhost] && !declared[policy.Vhost+"/"+policy.Name] {
+				diff.Removed = append(diff.Removed, policy)
+			}
+		}
+	}
+	return diff
+}
+
+// QueueType : queue name with its type
+type QueueType struct {
+	Vhost string `json:"vhost"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+}
+
+// QueueTypes list all queues with their type
+func (client *ManagementClient) QueueTypes() ([]QueueType, error) {
+	var queues []QueueType
+	err := client.get("queues?columns=vhost,name,type", &queues)
+	return queues, err
+}
+
+// PolicyApplyOptions : how to apply a policy file
+type PolicyApplyOptions struct {
+	File   string `json:"file"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// ParsePolicyApplyOptions : parse policy apply options sent by the ui
+func ParsePolicyApplyOptions(str string) PolicyApplyOptions {
+	var res PolicyApplyOptions
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		fmt.Println(err)
+	}
+	return res
+}
+
+// PolicyApplyResult : outcome of applying a policy file
+type PolicyApplyResult struct {
+	Diff       PolicyDiff `json:"diff"`
+	Applied    bool       `json:"applied"`
+	RolledBack bool       `json:"rolledBack"`
+}
+
+// ApplyPolicyFile validate the policy file, diff it against the broker and
+// apply the changes. When a change fails all changes already made are reverted.
+func (client *ManagementClient) ApplyPolicyFile(opts PolicyApplyOptions) (PolicyApplyResult, error) {
+	var result PolicyApplyResult
+	file, err := LoadPolicyFile(opts.File)
+	if err != nil {
+		return result, err
+	}
+	queues, err := client.QueueTypes()
+	if err != nil {
+		return result, err
+	}
+	if errs := ValidatePolicies(file.Policies, queues); len(errs) > 0 {
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return result, fmt.Errorf("invalid policies: %s", strings.Join(msgs, "; "))
+	}
+	existing, err := client.Policies()
+	if err != nil {
+		return result, err
+	}
+	result.Diff = DiffPolicies(file.Policies, existing, file.Prune)
+	if opts.DryRun {
+		return result, nil
+	}
+
+	previous := map[string]RabbitPolicy{}
+	for _, policy := range existing {
+		previous[policy.Vhost+"/"+policy.Name] = policy
+	}
+	applied := []PolicyChange{}
+	for _, change := range result.Diff.Changes() {
+		if change.Delete {
+			err = client.DeletePolicy(change.Policy.Vhost, change.Policy.Name)
+		} else {
+			err = client.PutPolicy(change.Policy)
+		}
+		if err != nil {
+			result.RolledBack = true
+			if rbErr := client.rollbackPolicies(applied, previous); rbErr != nil {
+				return result, fmt.Errorf("%s (rollback failed: %s)", err, rbErr)
+			}
+			return result, err
+		}
+		applied = append(applied, change)
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// rollbackPolicies revert the applied changes in reverse order
+func (client *ManagementClient) rollbackPolicies(applied []PolicyChange, previous map[string]RabbitPolicy) error {
+	for i := len(applied) - 1; i >= 0; i-- {
+		policy := applied[i].Policy
+		var err error
+		if old, ok := previous[policy.Vhost+"/"+policy.Name]; ok {
+			err = client.PutPolicy(old)
+		} else {
+			err = client.DeletePolicy(policy.Vhost, policy.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAndValidatePolicyFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "policies*.yml")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString(`
+policies:
+  - vhost: /
+    name: ha-orders
+    pattern: ^orders\.
+    apply-to: queues
+    priority: 1
+    definition:
+      ha-mode: all
+      unknown-key: 1
+`)
+	f.Close()
+
+	file, err := LoadPolicyFile(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(file.Policies))
+	assert.Equal(t, "all", file.Policies[0].Definition["ha-mode"])
+
+	queues := []QueueType{{Vhost: "/", Name: "orders.new", Type: "quorum"}}
+	errs := ValidatePolicies(file.Policies, queues)
+	assert.Equal(t, 2, len(errs))
+}
+
+func TestDiffPolicies(t *testing.T) {
+	existing := []RabbitPolicy{
+		{Vhost: "/", Name: "a", Pattern: ".*", ApplyTo: "all"},
+		{Vhost: "/", Name: "b", Pattern: ".*", Definition: map[string]interface{}{"max-length": 10}},
+		{Vhost: "/", Name: "c", Pattern: ".*"},
+	}
+	desired := []RabbitPolicy{
+		{Vhost: "/", Name: "a", Pattern: ".*"},
+		{Vhost: "/", Name: "b", Pattern: ".*", Definition: map[string]interface{}{"max-length": 20}},
+		{Vhost: "/", Name: "d", Pattern: ".*"},
+	}
+	diff := DiffPolicies(desired, existing, true)
+	assert.Equal(t, "d", diff.Added[0].Name)
+	assert.Equal(t, 1, len(diff.Updated))
+	assert.Equal(t, "b", diff.Updated[0].Name)
+	assert.Equal(t, "c", diff.Removed[0].Name)
+	assert.Equal(t, 3, len(diff.Changes()))
+}
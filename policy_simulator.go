@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// PolicyTarget : a queue or exchange policies can apply to
+type PolicyTarget struct {
+	Vhost string `json:"vhost"`
+	Name  string `json:"name"`
+	// Kind is "queues" or "exchanges"
+	Kind string `json:"kind"`
+	// Type of a queue, "classic", "quorum" or "stream"
+	Type string `json:"type,omitempty"`
+	// Policy currently reported by the broker
+	Policy string `json:"policy"`
+}
+
+// PolicyChange : a proposed change, Delete removes the policy with the given
+// vhost and name, otherwise the policy is added or replaced
+type PolicyChange struct {
+	Policy RabbitPolicy `json:"policy"`
+	Delete bool         `json:"delete"`
+}
+
+// SimulatedPolicy : policy resolution for a single object
+type SimulatedPolicy struct {
+	PolicyTarget
+	Effective string `json:"effective"`
+	Proposed  string `json:"proposed"`
+}
+
+// PolicySimulation : result of a policy simulation
+type PolicySimulation struct {
+	Objects []SimulatedPolicy `json:"objects"`
+	// Unmatched objects no policy applies to
+	Unmatched []SimulatedPolicy `json:"unmatched"`
+	// Unexpected objects where the broker reports another policy than computed
+	Unexpected []SimulatedPolicy `json:"unexpected"`
+	// Changed objects whose effective policy changes with the proposal
+	Changed []SimulatedPolicy `json:"changed"`
+}
+
+// policyQueueTypes queue type each type specific apply-to matches
+var policyQueueTypes = map[string]string{
+	"classic_queues": "classic",
+	"quorum_queues":  "quorum",
+	"streams":        "stream",
+}
+
+func policyAppliesTo(policy RabbitPolicy, target PolicyTarget) bool {
+	switch policy.ApplyTo {
+	case "", "all":
+		return true
+	case "classic_queues", "quorum_queues", "streams":
+		// brokers before 3.8 report no type, all their queues are classic
+		queueType := target.Type
+		if queueType == "" {
+			queueType = "classic"
+		}
+		return target.Kind == "queues" && policyQueueTypes[policy.ApplyTo] == queueType
+	}
+	return policy.ApplyTo == target.Kind
+}
+
+type compiledPolicy struct {
+	RabbitPolicy
+	pattern *regexp.Regexp
+}
+
+func compilePolicies(policies []RabbitPolicy) ([]compiledPolicy, error) {
+	compiled := []compiledPolicy{}
+	for _, policy := range policies {
+		pattern, err := regexp.Compile(policy.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %s", policy.Name, err)
+		}
+		compiled = append(compiled, compiledPolicy{policy, pattern})
+	}
+	return compiled, nil
+}
+
+// effectivePolicy the policy with the highest priority matching target,
+// ties are broken by name to keep the result deterministic
+func effectivePolicy(policies []compiledPolicy, target PolicyTarget) string {
+	var best *compiledPolicy
+	for i, policy := range policies {
+		if policy.Vhost != target.Vhost || !policyAppliesTo(policy.RabbitPolicy, target) ||
+			!policy.pattern.MatchString(target.Name) {
+			continue
+		}
+		if best == nil || policy.Priority > best.Priority ||
+			(policy.Priority == best.Priority && policy.Name < best.Name) {
+			best = &policies[i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.Name
+}
+
+// ApplyPolicyChanges return the policies after applying the changes
+func ApplyPolicyChanges(policies []RabbitPolicy, changes []PolicyChange) []RabbitPolicy {
+	result := append([]RabbitPolicy{}, policies...)
+	for _, change := range changes {
+		kept := result[:0]
+		for _, policy := range result {
+			if policy.Vhost != change.Policy.Vhost || policy.Name != change.Policy.Name {
+				kept = append(kept, policy)
+			}
+		}
+		result = kept
+		if !change.Delete {
+			result = append(result, change.Policy)
+		}
+	}
+	return result
+}
+
+// SimulatePolicies compute the effective policy of every target for the
+// current policies and after applying the proposed changes
+func SimulatePolicies(targets []PolicyTarget, policies []RabbitPolicy, changes []PolicyChange) (PolicySimulation, error) {
+	sim := PolicySimulation{
+		Objects:    []SimulatedPolicy{},
+		Unmatched:  []SimulatedPolicy{},
+		Unexpected: []SimulatedPolicy{},
+		Changed:    []SimulatedPolicy{},
+	}
+	current, err := compilePolicies(policies)
+	if err != nil {
+		return sim, err
+	}
+	proposed, err := compilePolicies(ApplyPolicyChanges(policies, changes))
+	if err != nil {
+		return sim, err
+	}
+	for _, target := range targets {
+		obj := SimulatedPolicy{
+			PolicyTarget: target,
+			Effective:    effectivePolicy(current, target),
+			Proposed:     effectivePolicy(proposed, target),
+		}
+		sim.Objects = append(sim.Objects, obj)
+		if obj.Effective == "" {
+			sim.Unmatched = append(sim.Unmatched, obj)
+		}
+		if obj.Effective != obj.Policy {
+			sim.Unexpected = append(sim.Unexpected, obj)
+		}
+		if obj.Effective != obj.Proposed {
+			sim.Changed = append(sim.Changed, obj)
+		}
+	}
+	return sim, nil
+}
+
+// PolicyTargets list all queues and exchanges with the policy the broker
+// currently applies to them
+func (client *ManagementClient) PolicyTargets() ([]PolicyTarget, error) {
+	targets := []PolicyTarget{}
+	for _, kind := range []string{"queues", "exchanges"} {
+		var objects []struct {
+			PolicyTarget
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := client.get(kind+"?columns=vhost,name,policy,type,arguments", &objects); err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			target := obj.PolicyTarget
+			target.Kind = kind
+			if kind != "queues" {
+				// the type of an exchange is direct, topic, ...
+				target.Type = ""
+			} else if declared, ok := obj.Arguments["x-queue-type"].(string); ok && target.Type == "" {
+				target.Type = declared
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// ParsePolicyChanges : parse proposed policy changes sent by the ui
+func ParsePolicyChanges(str string) []PolicyChange {
+	var res []PolicyChange
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		fmt.Println(err)
+	}
+	return res
+}
+
+// SimulatePolicies simulate the proposed policy changes against the broker
+func (client *ManagementClient) SimulatePolicies(changes []PolicyChange) (PolicySimulation, error) {
+	targets, err := client.PolicyTargets()
+	if err != nil {
+		return PolicySimulation{}, err
+	}
+	policies, err := client.Policies()
+	if err != nil {
+		return PolicySimulation{}, err
+	}
+	return SimulatePolicies(targets, policies, changes)
+}
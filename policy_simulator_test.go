@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatePolicies(t *testing.T) {
+	policies := []RabbitPolicy{
+		{Vhost: "/", Name: "ha-all", Pattern: ".*", ApplyTo: "all", Priority: 0},
+		{Vhost: "/", Name: "orders", Pattern: "^orders\\.", ApplyTo: "queues", Priority: 10},
+	}
+	targets := []PolicyTarget{
+		{Vhost: "/", Name: "orders.new", Kind: "queues", Policy: "orders"},
+		{Vhost: "/", Name: "orders.new", Kind: "exchanges", Policy: "orders"},
+		{Vhost: "/other", Name: "orders.new", Kind: "queues"},
+	}
+	changes := []PolicyChange{{Policy: RabbitPolicy{Vhost: "/", Name: "orders"}, Delete: true}}
+
+	sim, err := SimulatePolicies(targets, policies, changes)
+	assert.Nil(t, err)
+	assert.Equal(t, "orders", sim.Objects[0].Effective)
+	assert.Equal(t, "ha-all", sim.Objects[0].Proposed)
+	assert.Equal(t, "ha-all", sim.Objects[1].Effective)
+	assert.Equal(t, 1, len(sim.Unmatched))
+	assert.Equal(t, "/other", sim.Unmatched[0].Vhost)
+	assert.Equal(t, 1, len(sim.Unexpected))
+	assert.Equal(t, 1, len(sim.Changed))
+}
+
+func TestPolicyAppliesToQueueType(t *testing.T) {
+	quorum := RabbitPolicy{ApplyTo: "quorum_queues"}
+	classic := RabbitPolicy{ApplyTo: "classic_queues"}
+	streams := RabbitPolicy{ApplyTo: "streams"}
+	assert.True(t, policyAppliesTo(quorum, PolicyTarget{Kind: "queues", Type: "quorum"}))
+	assert.False(t, policyAppliesTo(quorum, PolicyTarget{Kind: "queues", Type: "classic"}))
+	assert.False(t, policyAppliesTo(quorum, PolicyTarget{Kind: "exchanges"}))
+	assert.True(t, policyAppliesTo(classic, PolicyTarget{Kind: "queues"}))
+	assert.False(t, policyAppliesTo(classic, PolicyTarget{Kind: "queues", Type: "stream"}))
+	assert.True(t, policyAppliesTo(streams, PolicyTarget{Kind: "queues", Type: "stream"}))
+	assert.True(t, policyAppliesTo(RabbitPolicy{ApplyTo: "queues"}, PolicyTarget{Kind: "queues", Type: "stream"}))
+}
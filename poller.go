@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultPollInterval = 10 * time.Second
+
+// defaultFetchTimeout limit of a single resource fetch, a hung management
+// api request must not stall the poller
+const defaultFetchTimeout = 30 * time.Second
+
+// resources fetched by the poller, each with its own interval
+const (
+	ResourceOverview    = "overview"
+	ResourceConnections = "connections"
+	ResourceExchanges   = "exchanges"
+	ResourceQueues      = "queues"
+	ResourceConsumers   = "consumers"
+	ResourceBindings    = "bindings"
+)
+
+// PollResources all resource classes known to the poller
+var PollResources = []string{
+	ResourceOverview, ResourceConnections, ResourceExchanges,
+	ResourceQueues, ResourceConsumers, ResourceBindings,
+}
+
+// brokerFetcher : per resource endpoints of the management api, requests
+// are aborted when ctx is done
+type brokerFetcher interface {
+	Overview(ctx context.Context) (rabtap.RabbitOverview, error)
+	Connections(ctx context.Context) ([]rabtap.RabbitConnection, error)
+	Exchanges(ctx context.Context) ([]rabtap.RabbitExchange, error)
+	Queues(ctx context.Context) ([]rabtap.RabbitQueue, error)
+	Consumers(ctx context.Context) ([]rabtap.RabbitConsumer, error)
+	Bindings(ctx context.Context) ([]rabtap.RabbitBinding, error)
+}
+
+// fetchResource fetch a single resource class into info
+func fetchResource(ctx context.Context, client brokerFetcher, resource string, info *rabtap.BrokerInfo) error {
+	var err error
+	switch resource {
+	case ResourceOverview:
+		info.Overview, err = client.Overview(ctx)
+	case ResourceConnections:
+		info.Connections, err = client.Connections(ctx)
+	case ResourceExchanges:
+		info.Exchanges, err = client.Exchanges(ctx)
+	case ResourceQueues:
+		info.Queues, err = client.Queues(ctx)
+	case ResourceConsumers:
+		info.Consumers, err = client.Consumers(ctx)
+	case ResourceBindings:
+		info.Bindings, err = client.Bindings(ctx)
+	default:
+		err = fmt.Errorf("unknown resource %q", resource)
+	}
+	return err
+}
+
+// PollIntervals : poll interval per resource class, Default for the others
+type PollIntervals struct {
+	Default   time.Duration
+	Resources map[string]time.Duration
+}
+
+// Interval poll interval of the resource
+func (intervals PollIntervals) Interval(resource string) time.Duration {
+	if interval, ok := intervals.Resources[resource]; ok && interval > 0 {
+		return interval
+	}
+	if intervals.Default > 0 {
+		return intervals.Default
+	}
+	return defaultPollInterval
+}
+
+// Max the longest interval of all resources
+func (intervals PollIntervals) Max() time.Duration {
+	max := time.Duration(0)
+	for _, resource := range PollResources {
+		if interval := intervals.Interval(resource); interval > max {
+			max = interval
+		}
+	}
+	return max
+}
+
+// Min the shortest interval of all resources
+func (intervals PollIntervals) Min() time.Duration {
+	min := intervals.Interval(PollResources[0])
+	for _, resource := range PollResources[1:] {
+		if interval := intervals.Interval(resource); interval < min {
+			min = interval
+		}
+	}
+	return min
+}
+
+// ParsePollIntervals parse "queues=5s,bindings=1m" overrides
+func ParsePollIntervals(str string, def time.Duration) (PollIntervals, error) {
+	intervals := PollIntervals{Default: def, Resources: map[string]time.Duration{}}
+	if str == "" {
+		return intervals, nil
+	}
+	for _, part := range strings.Split(str, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return intervals, fmt.Errorf("invalid poll interval %q, expected resource=duration", part)
+		}
+		if !isPollResource(kv[0]) {
+			return intervals, fmt.Errorf("unknown resource %q, expected one of %s", kv[0], strings.Join(PollResources, ", "))
+		}
+		interval, err := time.ParseDuration(kv[1])
+		if err != nil || interval <= 0 {
+			return intervals, fmt.Errorf("invalid poll interval %q", part)
+		}
+		intervals.Resources[kv[0]] = interval
+	}
+	return intervals, nil
+}
+
+func isPollResource(resource string) bool {
+	for _, known := range PollResources {
+		if known == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot : broker state, Fetched is the oldest fetch time of all resources.
+// Resources are fetched at different times, Dangling lists the references
+// between them that did not resolve. Rates are computed from the counters of
+// successive fetches.
+type Snapshot struct {
+	Info      rabtap.BrokerInfo    `json:"info"`
+	Fetched   time.Time            `json:"fetched"`
+	FetchedAt map[string]time.Time `json:"fetchedAt"`
+	Dangling  []DanglingRef        `json:"dangling,omitempty"`
+	Rates     ClientRates          `json:"rates"`
+}
+
+// Poller periodically fetches the broker state and keeps the latest snapshot
+type Poller struct {
+	client    brokerFetcher
+	intervals PollIntervals
+	refresh   chan []string
+	// reschedule wakes Run up after the intervals changed
+	reschedule chan struct{}
+	// Reconcile re-fetch the resources involved in dangling references once
+	Reconcile bool
+	// Timeout of a single resource fetch
+	Timeout time.Duration
+	// Events receives the changes between two fetches of a resource
+	Events *EventBus
+
+	// inflight collapses concurrent fetches of a resource into one call
+	inflight  singleflight.Group
+	mutex     sync.RWMutex
+	interner  *Interner
+	rates     *RateTracker
+	info      rabtap.BrokerInfo
+	fetchedAt map[string]time.Time
+	dangling  []DanglingRef
+	lastError error
+}
+
+// NewPoller create a poller fetching the broker info every interval
+func NewPoller(rabbitmq *Rabbitmq, intervals PollIntervals) *Poller {
+	return newPoller(rabbitmq.fetcher(), intervals)
+}
+
+func newPoller(client brokerFetcher, intervals PollIntervals) *Poller {
+	return &Poller{
+		client:     client,
+		intervals:  intervals,
+		refresh:    make(chan []string, 8),
+		reschedule: make(chan struct{}, 1),
+		interner:   NewInterner(),
+		rates:      NewRateTracker(),
+		Events:     NewEventBus(),
+		fetchedAt:  map[string]time.Time{},
+		Timeout:    defaultFetchTimeout,
+	}
+}
+
+// Poll fetch the given resources now, all of them if none are given
+func (poller *Poller) Poll(resources ...string) error {
+	err := poller.fetch(resources...)
+	if refs := poller.findDangling(); len(refs) > 0 && poller.Reconcile {
+		subsystemLog("poller").Debugf("re-fetching after %d dangling references", len(refs))
+		if refetchErr := poller.fetch(danglingResources(refs)...); err == nil {
+			err = refetchErr
+		}
+		poller.findDangling()
+	}
+	return err
+}
+
+// findDangling update the dangling references of the current info
+func (poller *Poller) findDangling() []DanglingRef {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	if len(poller.fetchedAt) < len(PollResources) {
+		return nil
+	}
+	poller.dangling = FindDanglingRefs(poller.info)
+	return poller.dangling
+}
+
+// fetch the given resources, all of them if none are given
+func (poller *Poller) fetch(resources ...string) error {
+	if len(resources) == 0 {
+		resources = PollResources
+	}
+	var firstErr error
+	for _, resource := range resources {
+		_, err, _ := poller.inflight.Do(resource, func() (interface{}, error) {
+			return nil, poller.fetchOne(resource)
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// fetchOne fetch a resource and store it in the current info
+func (poller *Poller) fetchOne(resource string) error {
+	var info rabtap.BrokerInfo
+	poller.mutex.RLock()
+	client := poller.client
+	poller.mutex.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), poller.Timeout)
+	err := fetchResource(ctx, client, resource, &info)
+	cancel()
+	now := time.Now()
+	poller.mutex.Lock()
+	poller.lastError = err
+	var events []BrokerEvent
+	if err == nil {
+		CompactBrokerInfo(&info, poller.interner)
+		if fetchedAt, fetched := poller.fetchedAt[resource]; fetched {
+			events = DiffEvents(resource, poller.info, info, now)
+			if poller.ratesDisabled(resource, info) {
+				FillRates(resource, &poller.info, &info, now.Sub(fetchedAt))
+			}
+		}
+		poller.rates.Update(resource, info, now)
+		poller.store(resource, info)
+		poller.fetchedAt[resource] = now
+	}
+	poller.mutex.Unlock()
+	for _, event := range events {
+		poller.Events.Publish(event)
+	}
+	if err != nil {
+		subsystemLog("poller").Warnf("fetching %s failed: %s", resource, err)
+	}
+	return err
+}
+
+// FetchNow fetch the resources immediately and wait for the result.
+// Concurrent calls for the same resource, including a scheduled poll, share
+// a single request to the broker.
+func (poller *Poller) FetchNow(resources ...string) error {
+	for _, resource := range resources {
+		if !isPollResource(resource) {
+			return fmt.Errorf("unknown resource %q", resource)
+		}
+	}
+	return poller.fetch(resources...)
+}
+
+// ratesDisabled the broker sends no rates for the fetched resource, they are
+// computed from successive samples instead, mutex must be held
+func (poller *Poller) ratesDisabled(resource string, info rabtap.BrokerInfo) bool {
+	if resource == ResourceOverview {
+		return RatesDisabled(info.Overview)
+	}
+	return RatesDisabled(poller.info.Overview)
+}
+
+// store copy the fetched resource into the current info, mutex must be held
+func (poller *Poller) store(resource string, info rabtap.BrokerInfo) {
+	switch resource {
+	case ResourceOverview:
+		poller.info.Overview = info.Overview
+	case ResourceConnections:
+		poller.info.Connections = info.Connections
+	case ResourceExchanges:
+		poller.info.Exchanges = info.Exchanges
+	case ResourceQueues:
+		poller.info.Queues = info.Queues
+	case ResourceConsumers:
+		poller.info.Consumers = info.Consumers
+	case ResourceBindings:
+		poller.info.Bindings = info.Bindings
+	}
+}
+
+// Refresh trigger an out of schedule fetch of the resources, all if none given
+func (poller *Poller) Refresh(resources ...string) error {
+	for _, resource := range resources {
+		if !isPollResource(resource) {
+			return fmt.Errorf("unknown resource %q", resource)
+		}
+	}
+	select {
+	case poller.refresh <- resources:
+	default:
+		// a refresh is already pending
+	}
+	return nil
+}
+
+// Intervals the current poll intervals
+func (poller *Poller) Intervals() PollIntervals {
+	poller.mutex.RLock()
+	defer poller.mutex.RUnlock()
+	return poller.intervals
+}
+
+// SetIntervals change the poll intervals of a running poller
+func (poller *Poller) SetIntervals(intervals PollIntervals) {
+	poller.mutex.Lock()
+	poller.intervals = intervals
+	poller.mutex.Unlock()
+	select {
+	case poller.reschedule <- struct{}{}:
+	default:
+	}
+}
+
+// SetClient poll another broker. The state of the previous one is
+// forgotten so its differences are not reported as events, the snapshot is
+// empty until every resource was fetched from the new broker.
+func (poller *Poller) SetClient(client brokerFetcher) {
+	poller.mutex.Lock()
+	poller.client = client
+	poller.info = rabtap.BrokerInfo{}
+	poller.fetchedAt = map[string]time.Time{}
+	poller.dangling = nil
+	poller.rates = NewRateTracker()
+	poller.mutex.Unlock()
+	poller.Refresh()
+}
+
+// due resources whose interval has elapsed, tick is the scheduling resolution
+func (poller *Poller) due(now time.Time, tick time.Duration) []string {
+	poller.mutex.RLock()
+	defer poller.mutex.RUnlock()
+	var due []string
+	for _, resource := range PollResources {
+		fetched, ok := poller.fetchedAt[resource]
+		if !ok || now.Sub(fetched)+tick/2 >= poller.intervals.Interval(resource) {
+			due = append(due, resource)
+		}
+	}
+	return due
+}
+
+// Run poll until ctx is done
+func (poller *Poller) Run(ctx context.Context) {
+	tick := poller.Intervals().Min()
+	ticker := time.NewTicker(tick)
+	defer func() { ticker.Stop() }()
+	poller.Poll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case resources := <-poller.refresh:
+			poller.Poll(resources...)
+		case <-poller.reschedule:
+			ticker.Stop()
+			tick = poller.Intervals().Min()
+			ticker = time.NewTicker(tick)
+		case now := <-ticker.C:
+			if due := poller.due(now, tick); len(due) > 0 {
+				poller.Poll(due...)
+			}
+		}
+	}
+}
+
+// Snapshot the latest state, nil until every resource was fetched once
+func (poller *Poller) Snapshot() *Snapshot {
+	poller.mutex.RLock()
+	defer poller.mutex.RUnlock()
+	if len(poller.fetchedAt) < len(PollResources) {
+		return nil
+	}
+	snapshot := &Snapshot{Info: poller.info, FetchedAt: map[string]time.Time{}, Dangling: poller.dangling, Rates: poller.rates.Rates()}
+	for resource, fetched := range poller.fetchedAt {
+		snapshot.FetchedAt[resource] = fetched
+		if snapshot.Fetched.IsZero() || fetched.Before(snapshot.Fetched) {
+			snapshot.Fetched = fetched
+		}
+	}
+	return snapshot
+}
+
+// Staleness age of the oldest resource of the snapshot, -1s if there is none
+func (poller *Poller) Staleness() time.Duration {
+	snapshot := poller.Snapshot()
+	if snapshot == nil {
+		return -time.Second
+	}
+	return time.Since(snapshot.Fetched)
+}
+
+// Ready every resource was fetched within three of its poll intervals
+func (poller *Poller) Ready() bool {
+	snapshot := poller.Snapshot()
+	if snapshot == nil {
+		return false
+	}
+	intervals := poller.Intervals()
+	for resource, fetched := range snapshot.FetchedAt {
+		if time.Since(fetched) >= 3*intervals.Interval(resource) {
+			return false
+		}
+	}
+	return true
+}
+
+// String the effective interval of every resource
+func (intervals PollIntervals) String() string {
+	parts := make([]string, 0, len(PollResources))
+	for _, resource := range PollResources {
+		parts = append(parts, fmt.Sprintf("%s=%s", resource, intervals.Interval(resource)))
+	}
+	return strings.Join(parts, ",")
+}
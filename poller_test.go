@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeFetcher struct {
+	calls   map[string]int
+	failing string
+}
+
+func (f *fakeFetcher) call(resource string) error {
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[resource]++
+	if f.failing == resource {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (f *fakeFetcher) Overview(ctx context.Context) (rabtap.RabbitOverview, error) {
+	return rabtap.RabbitOverview{}, f.call(ResourceOverview)
+}
+func (f *fakeFetcher) Connections(ctx context.Context) ([]rabtap.RabbitConnection, error) {
+	return nil, f.call(ResourceConnections)
+}
+func (f *fakeFetcher) Exchanges(ctx context.Context) ([]rabtap.RabbitExchange, error) {
+	return nil, f.call(ResourceExchanges)
+}
+func (f *fakeFetcher) Queues(ctx context.Context) ([]rabtap.RabbitQueue, error) {
+	return []rabtap.RabbitQueue{{Name: "q1"}}, f.call(ResourceQueues)
+}
+func (f *fakeFetcher) Consumers(ctx context.Context) ([]rabtap.RabbitConsumer, error) {
+	return nil, f.call(ResourceConsumers)
+}
+func (f *fakeFetcher) Bindings(ctx context.Context) ([]rabtap.RabbitBinding, error) {
+	return nil, f.call(ResourceBindings)
+}
+
+func TestParsePollIntervals(t *testing.T) {
+	intervals, err := ParsePollIntervals("queues=5s, bindings=2m", 30*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, intervals.Interval(ResourceQueues))
+	assert.Equal(t, 2*time.Minute, intervals.Interval(ResourceBindings))
+	assert.Equal(t, 30*time.Second, intervals.Interval(ResourceExchanges))
+	assert.Equal(t, 5*time.Second, intervals.Min())
+	assert.Equal(t, 2*time.Minute, intervals.Max())
+
+	_, err = ParsePollIntervals("channels=5s", time.Second)
+	assert.NotNil(t, err)
+	_, err = ParsePollIntervals("queues=fast", time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestPollerDue(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	poller := newPoller(fetcher, PollIntervals{
+		Default:   time.Minute,
+		Resources: map[string]time.Duration{ResourceQueues: 5 * time.Second},
+	})
+	assert.Nil(t, poller.Snapshot())
+	assert.Equal(t, PollResources, poller.due(time.Now(), 5*time.Second))
+
+	assert.Nil(t, poller.Poll())
+	snapshot := poller.Snapshot()
+	assert.NotNil(t, snapshot)
+	assert.Equal(t, "q1", snapshot.Info.Queues[0].Name)
+	assert.Len(t, snapshot.FetchedAt, len(PollResources))
+
+	later := time.Now().Add(5 * time.Second)
+	assert.Equal(t, []string{ResourceQueues}, poller.due(later, 5*time.Second))
+}
+
+func TestPollerKeepsStaleResourceOnError(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	poller := newPoller(fetcher, PollIntervals{Default: time.Second})
+	assert.Nil(t, poller.Poll())
+	fetcher.failing = ResourceQueues
+	assert.NotNil(t, poller.Poll(ResourceQueues))
+	assert.Equal(t, "q1", poller.Snapshot().Info.Queues[0].Name)
+
+	assert.NotNil(t, poller.Refresh("channels"))
+	assert.Nil(t, poller.Refresh(ResourceQueues))
+	assert.Equal(t, []string{ResourceQueues}, <-poller.refresh)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// themes of the client
+var themes = []string{"system", "light", "dark"}
+
+// Preferences : ui settings of a user, kept by the serve backend so they
+// follow the user across browsers
+type Preferences struct {
+	Theme        string `json:"theme"`
+	DefaultVhost string `json:"defaultVhost,omitempty"`
+	// Columns visible columns per table, like queues: [name, messages]
+	Columns map[string][]string `json:"columns,omitempty"`
+	// RefreshSeconds interval the client reloads data at
+	RefreshSeconds int `json:"refreshSeconds,omitempty"`
+}
+
+// defaultPreferences of users that saved nothing yet
+func defaultPreferences() Preferences {
+	return Preferences{Theme: "system", RefreshSeconds: 10}
+}
+
+// Validate reject values the client can not apply
+func (prefs Preferences) Validate() error {
+	if !contains(themes, prefs.Theme) {
+		return fmt.Errorf("unknown theme %q, expected one of %s", prefs.Theme, strings.Join(themes, ", "))
+	}
+	if prefs.RefreshSeconds < 0 {
+		return fmt.Errorf("refresh interval must not be negative")
+	}
+	return nil
+}
+
+// requestUser the user preferences are kept for: the token name, the user
+// set by an authenticating proxy or "default"
+func requestUser(r *http.Request) string {
+	if token, ok := requestToken(r); ok {
+		return token.Name
+	}
+	if user := r.Header.Get("X-Radish-User"); user != "" {
+		return user
+	}
+	return "default"
+}
+
+// handlePreferences GET or PUT the preferences of the requesting user
+func (server *Server) handlePreferences(w http.ResponseWriter, r *http.Request) {
+	if server.store == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no store configured, see serve --store"})
+		return
+	}
+	key := "preferences/" + requestUser(r)
+	switch r.Method {
+	case http.MethodGet:
+		prefs := defaultPreferences()
+		if _, err := getJSON(server.store, key, &prefs); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, prefs)
+	case http.MethodPut:
+		prefs := defaultPreferences()
+		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := prefs.Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := putJSON(server.store, key, prefs); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, prefs)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or PUT"})
+	}
+}
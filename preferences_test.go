@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerPreferences(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "prefs")
+	defer os.RemoveAll(dir)
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	server.UseStore(store)
+
+	request := func(method string, user string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/preferences", strings.NewReader(body))
+		req.Header.Set("X-Radish-User", user)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+	var prefs Preferences
+	rec := request("GET", "alice", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	json.Unmarshal(rec.Body.Bytes(), &prefs)
+	assert.Equal(t, defaultPreferences(), prefs)
+
+	rec = request("PUT", "alice", `{"theme":"dark","defaultVhost":"prod","columns":{"queues":["name","messages"]}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = request("GET", "alice", "")
+	prefs = Preferences{}
+	json.Unmarshal(rec.Body.Bytes(), &prefs)
+	assert.Equal(t, "dark", prefs.Theme)
+	assert.Equal(t, []string{"name", "messages"}, prefs.Columns["queues"])
+	assert.Equal(t, 10, prefs.RefreshSeconds)
+
+	rec = request("GET", "bob", "")
+	prefs = Preferences{}
+	json.Unmarshal(rec.Body.Bytes(), &prefs)
+	assert.Equal(t, "system", prefs.Theme)
+
+	rec = request("PUT", "alice", `{"theme":"pink"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// defaultProfilesFile broker profiles selected with --profile
+const defaultProfilesFile = "radish-profiles.yml"
+
+// BrokerProfile : connection settings of a named broker, empty fields keep
+// the value of the connection flags
+type BrokerProfile struct {
+	Host          string `yaml:"host,omitempty" json:"host,omitempty"`
+	Port          string `yaml:"port,omitempty" json:"port,omitempty"`
+	User          string `yaml:"user,omitempty" json:"user,omitempty"`
+	Password      string `yaml:"password,omitempty" json:"-"`
+	ManagementURL string `yaml:"managementUrl,omitempty" json:"managementUrl,omitempty"`
+	TLS           bool   `yaml:"tls,omitempty" json:"tls,omitempty"`
+	CACert        string `yaml:"cacert,omitempty" json:"cacert,omitempty"`
+	Cert          string `yaml:"cert,omitempty" json:"cert,omitempty"`
+	Key           string `yaml:"key,omitempty" json:"key,omitempty"`
+	Insecure      bool   `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+	Scope         string `yaml:"scope,omitempty" json:"scope,omitempty"`
+	ReadOnly      bool   `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+	// Vhost of commands run without --vhost
+	Vhost string `yaml:"vhost,omitempty" json:"vhost,omitempty"`
+}
+
+// BrokerProfiles : the profiles file
+type BrokerProfiles struct {
+	Profiles map[string]BrokerProfile `yaml:"profiles"`
+}
+
+// LoadBrokerProfiles read a profiles yaml file
+func LoadBrokerProfiles(file string) (BrokerProfiles, error) {
+	var profiles BrokerProfiles
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return profiles, err
+	}
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return profiles, fmt.Errorf("%s: %s", file, err)
+	}
+	for name, profile := range profiles.Profiles {
+		if profile.Host == "" && profile.ManagementURL == "" {
+			return profiles, fmt.Errorf("%s: profile %s has neither host nor managementUrl", file, name)
+		}
+		if profile.ManagementURL != "" {
+			if _, err := ParseManagementURL(profile.ManagementURL); err != nil {
+				return profiles, fmt.Errorf("%s: profile %s: %s", file, name, err)
+			}
+		}
+	}
+	return profiles, nil
+}
+
+// Names of the profiles, sorted
+func (profiles BrokerProfiles) Names() []string {
+	names := make([]string, 0, len(profiles.Profiles))
+	for name := range profiles.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Login the login details of the named profile on top of base
+func (profiles BrokerProfiles) Login(name string, base RabbitmqLoginDetails) (RabbitmqLoginDetails, error) {
+	profile, ok := profiles.Profiles[name]
+	if !ok {
+		return base, fmt.Errorf("unknown profile %q", name)
+	}
+	login := base
+	set := func(dst *string, value string) {
+		if value != "" {
+			*dst = value
+		}
+	}
+	set(&login.Host, profile.Host)
+	set(&login.Port, profile.Port)
+	set(&login.Username, profile.User)
+	set(&login.Password, profile.Password)
+	set(&login.ManagementURL, profile.ManagementURL)
+	set(&login.CACert, profile.CACert)
+	set(&login.ClientCert, profile.Cert)
+	set(&login.ClientKey, profile.Key)
+	set(&login.Scope, profile.Scope)
+	set(&login.DefaultVhost, NormalizeVhost(profile.Vhost))
+	login.TLS = login.TLS || profile.TLS
+	login.TLSSkipVerify = login.TLSSkipVerify || profile.Insecure
+	login.ReadOnly = login.ReadOnly || profile.ReadOnly
+	return login, nil
+}
+
+// ProfileList : the profiles of the profiles file
+type ProfileList struct {
+	Profiles map[string]BrokerProfile `json:"profiles"`
+	Current  string                   `json:"current,omitempty"`
+}
+
+// Table one row per profile, passwords are never shown
+func (list ProfileList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"PROFILE", "HOST", "MANAGEMENT URL", "USER", "VHOST", "READ ONLY"}}
+	for _, name := range (BrokerProfiles{Profiles: list.Profiles}).Names() {
+		profile := list.Profiles[name]
+		cell := Cell{Text: name}
+		if name == list.Current {
+			cell.Color = Green
+		}
+		readOnly := "-"
+		if profile.ReadOnly {
+			readOnly = "yes"
+		}
+		table.Rows = append(table.Rows, []Cell{cell, {Text: orDash(profile.Host)}, {Text: orDash(profile.ManagementURL)}, {Text: orDash(profile.User)}, {Text: orDash(profile.Vhost)}, {Text: readOnly}})
+	}
+	return table
+}
+
+// useProfile replace the login details by the profile of --profile
+func (cli *CLI) useProfile() error {
+	cli.baseLogin = cli.login
+	if cli.profile == "" {
+		return nil
+	}
+	profiles, err := LoadBrokerProfiles(cli.profilesFile)
+	if err != nil {
+		return err
+	}
+	login, err := profiles.Login(cli.profile, cli.login)
+	if err != nil {
+		return fmt.Errorf("%s, expected one of %v in %s", err, profiles.Names(), cli.profilesFile)
+	}
+	cli.login = login
+	return nil
+}
+
+func init() {
+	registerCommand("profiles", "list the broker profiles of the profiles file", func(cli *CLI, args []string) (interface{}, error) {
+		if err := parseFlags(newFlagSet("profiles"), args); err != nil {
+			return nil, err
+		}
+		profiles, err := LoadBrokerProfiles(cli.profilesFile)
+		if os.IsNotExist(err) {
+			return nil, usageError("profiles: no profiles file %s, see --profiles", cli.profilesFile)
+		}
+		if err != nil {
+			return nil, usageError("profiles: %s", err)
+		}
+		return ProfileList{Profiles: profiles.Profiles, Current: cli.profile}, nil
+	})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoField : a field of the protobuf wire format, fixed size values are
+// kept in Varint
+type protoField struct {
+	Number protowire.Number
+	Type   protowire.Type
+	Varint uint64
+	Bytes  []byte
+}
+
+// parseProto split data into its fields, fails unless all of data is valid
+// wire format
+func parseProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		field := protoField{Number: number, Type: wireType}
+		switch wireType {
+		case protowire.VarintType:
+			field.Varint, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			field.Varint, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var value uint32
+			value, n = protowire.ConsumeFixed32(data)
+			field.Varint = uint64(value)
+		case protowire.BytesType:
+			field.Bytes, n = protowire.ConsumeBytes(data)
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", wireType)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// printableString true for valid utf-8 without control characters but tabs
+// and newlines
+func printableString(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeProtoRaw print a message without its schema like protoc --decode_raw,
+// length delimited fields are shown as nested message when they parse as one
+func DecodeProtoRaw(data []byte) (string, error) {
+	fields, err := parseProto(data)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	writeProtoRaw(&sb, fields, "")
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func writeProtoRaw(sb *strings.Builder, fields []protoField, indent string) {
+	for _, field := range fields {
+		switch field.Type {
+		case protowire.BytesType:
+			if nested, err := parseProto(field.Bytes); err == nil && len(nested) > 0 && !printableString(field.Bytes) {
+				fmt.Fprintf(sb, "%s%d {\n", indent, field.Number)
+				writeProtoRaw(sb, nested, indent+"  ")
+				fmt.Fprintf(sb, "%s}\n", indent)
+			} else {
+				fmt.Fprintf(sb, "%s%d: %s\n", indent, field.Number, strconv.Quote(string(field.Bytes)))
+			}
+		case protowire.Fixed64Type:
+			fmt.Fprintf(sb, "%s%d: 0x%016x\n", indent, field.Number, field.Varint)
+		case protowire.Fixed32Type:
+			fmt.Fprintf(sb, "%s%d: 0x%08x\n", indent, field.Number, field.Varint)
+		default:
+			fmt.Fprintf(sb, "%s%d: %d\n", indent, field.Number, field.Varint)
+		}
+	}
+}
+
+// ProtoDescriptors : message types of a descriptor set
+type ProtoDescriptors struct {
+	files *protoregistry.Files
+}
+
+// LoadProtoDescriptors read a FileDescriptorSet written by
+// protoc --include_imports --descriptor_set_out=file
+func LoadProtoDescriptors(file string) (*ProtoDescriptors, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProtoDescriptors(data)
+}
+
+// ParseProtoDescriptors parse a serialized FileDescriptorSet, the imports of
+// every file have to be part of the set
+func ParseProtoDescriptors(data []byte) (*ProtoDescriptors, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, err
+	}
+	return &ProtoDescriptors{files: files}, nil
+}
+
+// Names the full names of the message types, e.g. "shop.Order", sorted
+func (descs *ProtoDescriptors) Names() []string {
+	names := []string{}
+	descs.files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		names = appendMessageNames(names, file.Messages())
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+// appendMessageNames add the messages and their nested messages, map
+// entries are left out
+func appendMessageNames(names []string, messages protoreflect.MessageDescriptors) []string {
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		if message.IsMapEntry() {
+			continue
+		}
+		names = append(names, string(message.FullName()))
+		names = appendMessageNames(names, message.Messages())
+	}
+	return names
+}
+
+// Decode print data as message of type typeName in protobuf text format,
+// fields missing from the descriptor are printed by number
+func (descs *ProtoDescriptors) Decode(data []byte, typeName string) (string, error) {
+	desc, err := descs.files.FindDescriptorByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return "", fmt.Errorf("unknown message type %q", typeName)
+	}
+	messageDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return "", fmt.Errorf("%s is no message type", typeName)
+	}
+	message := dynamicpb.NewMessage(messageDesc)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return "", err
+	}
+	text, err := prototext.MarshalOptions{Multiline: true, Indent: "  ", EmitUnknown: true}.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(text), "\n"), nil
+}
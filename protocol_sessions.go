@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// ProtocolCapabilities : protocol plugins enabled on the broker
+type ProtocolCapabilities struct {
+	MQTT  bool `json:"mqtt"`
+	STOMP bool `json:"stomp"`
+}
+
+// DetectCapabilities derive the enabled protocol plugins from the listeners
+// of the overview, plugins without a listener are not running
+func DetectCapabilities(overview rabtap.RabbitOverview) ProtocolCapabilities {
+	var caps ProtocolCapabilities
+	for _, listener := range overview.Listeners {
+		protocol := strings.ToLower(listener.Protocol)
+		caps.MQTT = caps.MQTT || strings.Contains(protocol, "mqtt")
+		caps.STOMP = caps.STOMP || strings.Contains(protocol, "stomp")
+	}
+	return caps
+}
+
+// VhostChannels list the channels of a vhost
+func (client *ManagementClient) VhostChannels(vhost string) ([]RabbitChannel, error) {
+	var channels []RabbitChannel
+	err := client.get(managementPath("vhosts", vhost, "channels"), &channels)
+	return channels, err
+}
+
+// ProtocolSession : mqtt session or stomp subscription, the broker models
+// them as channels of the plugin's connection
+type ProtocolSession struct {
+	Protocol   string        `json:"protocol"`
+	Connection string        `json:"connection"`
+	Channel    RabbitChannel `json:"channel"`
+}
+
+// protocolConnections mqtt and stomp connections by name, if the plugin is enabled
+func protocolConnections(conns []rabtap.RabbitConnection, caps ProtocolCapabilities) map[string]rabtap.RabbitConnection {
+	res := map[string]rabtap.RabbitConnection{}
+	for _, conn := range conns {
+		switch ProtocolFamily(conn.Protocol) {
+		case ProtocolMQTT:
+			if caps.MQTT {
+				res[conn.Name] = conn
+			}
+		case ProtocolSTOMP:
+			if caps.STOMP {
+				res[conn.Name] = conn
+			}
+		}
+	}
+	return res
+}
+
+// ProtocolSessions sessions of mqtt and stomp connections in info. Only the
+// vhosts those connections use are queried, and only for enabled plugins.
+func (client *ManagementClient) ProtocolSessions(info *rabtap.BrokerInfo) ([]ProtocolSession, error) {
+	conns := protocolConnections(info.Connections, DetectCapabilities(info.Overview))
+	vhosts := map[string]bool{}
+	for _, conn := range conns {
+		vhosts[conn.Vhost] = true
+	}
+	sessions := []ProtocolSession{}
+	for vhost := range vhosts {
+		channels, err := client.VhostChannels(vhost)
+		if err != nil {
+			return nil, err
+		}
+		for _, channel := range channels {
+			if conn, ok := conns[channel.ConnectionDetails.Name]; ok {
+				sessions = append(sessions, ProtocolSession{
+					Protocol:   conn.Protocol,
+					Connection: conn.Name,
+					Channel:    channel,
+				})
+			}
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Channel.Name < sessions[j].Channel.Name
+	})
+	return sessions, nil
+}
+
+// SessionList : mqtt and stomp sessions listing
+type SessionList []ProtocolSession
+
+// Table sessions as table
+func (list SessionList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"PROTOCOL", "CONNECTION", "USER", "VHOST", "STATE", "CONSUMERS", "UNACKED"}}
+	for _, session := range list {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: session.Protocol},
+			{Text: session.Connection},
+			{Text: orDash(session.Channel.User)},
+			{Text: session.Channel.Vhost},
+			{Text: orDash(session.Channel.State)},
+			{Text: format.Count(int64(session.Channel.ConsumerCount))},
+			{Text: format.Count(int64(session.Channel.MessagesUnacknowledged))},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("sessions", "list mqtt and stomp sessions", func(cli *CLI, args []string) (interface{}, error) {
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		info := rabbitmq.info()
+		sessions, err := rabbitmq.management().ProtocolSessions(&info)
+		if err != nil {
+			return nil, err
+		}
+		return SessionList(sessions), nil
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocolSessions(t *testing.T) {
+	requested := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.EscapedPath())
+		w.Write([]byte(`[
+			{"name": "mqtt-conn (1)", "vhost": "iot", "connection_details": {"name": "mqtt-conn"}},
+			{"name": "amqp-conn (1)", "vhost": "iot", "connection_details": {"name": "amqp-conn"}}]`))
+	}))
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+	client := NewManagementClient(uri, nil)
+
+	var info rabtap.BrokerInfo
+	json.Unmarshal([]byte(`{"Overview": {"listeners": [{"protocol": "amqp"}, {"protocol": "mqtt"}]},
+		"Connections": [
+			{"name": "mqtt-conn", "vhost": "iot", "protocol": "MQTT 3.1.1"},
+			{"name": "stomp-conn", "vhost": "/", "protocol": "STOMP 1.2"},
+			{"name": "amqp-conn", "vhost": "iot", "protocol": "AMQP 0-9-1"}]}`), &info)
+	assert.Equal(t, ProtocolCapabilities{MQTT: true}, DetectCapabilities(info.Overview))
+
+	sessions, err := client.ProtocolSessions(&info)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/api/vhosts/iot/channels"}, requested)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "mqtt-conn", sessions[0].Connection)
+	assert.Equal(t, "MQTT 3.1.1", sessions[0].Protocol)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// protocol families of broker connections
+const (
+	ProtocolAMQP091 = "amqp-0-9-1"
+	ProtocolAMQP10  = "amqp-1.0"
+	ProtocolMQTT    = "mqtt"
+	ProtocolSTOMP   = "stomp"
+	ProtocolOther   = "other"
+)
+
+// protocolVersionSeparators : the broker writes versions as 0-9-1 or 1-0,
+// plugins and docs use dots
+var protocolVersionSeparators = strings.NewReplacer(".", "-", "_", "-")
+
+// ProtocolFamily family of a connection protocol as reported by the broker,
+// e.g. "AMQP 0-9-1", "AMQP 1-0", "MQTT 3.1.1" or "Web STOMP 1.2"
+func ProtocolFamily(protocol string) string {
+	p := protocolVersionSeparators.Replace(strings.ToLower(protocol))
+	switch {
+	case strings.Contains(p, "0-9-1"), strings.Contains(p, "0-9"), strings.Contains(p, "0-8"):
+		return ProtocolAMQP091
+	case strings.Contains(p, "amqp 1-0"):
+		return ProtocolAMQP10
+	case strings.Contains(p, "mqtt"):
+		return ProtocolMQTT
+	case strings.Contains(p, "stomp"):
+		return ProtocolSTOMP
+	}
+	return ProtocolOther
+}
+
+// hasChannels only amqp 0-9-1 connections multiplex channels, other
+// protocols report no or meaningless channel counts
+func hasChannels(conn rabtap.RabbitConnection) bool {
+	return ProtocolFamily(conn.Protocol) == ProtocolAMQP091
+}
+
+// ConnectionExtras : connection fields of other protocols the rabtap type
+// does not decode
+type ConnectionExtras struct {
+	Name             string `json:"name"`
+	ClientProperties struct {
+		ClientID string `json:"client_id"`
+	} `json:"client_properties"`
+}
+
+// ConnectionExtras fetch the protocol specific fields of all connections,
+// keyed by connection name
+func (client *ManagementClient) ConnectionExtras() (map[string]ConnectionExtras, error) {
+	var conns []ConnectionExtras
+	if err := client.get("connections?columns=name,client_properties", &conns); err != nil {
+		return nil, err
+	}
+	res := make(map[string]ConnectionExtras, len(conns))
+	for _, conn := range conns {
+		res[conn.Name] = conn
+	}
+	return res, nil
+}
+
+// connectionClient client library of amqp connections, the client id of
+// mqtt ones
+func connectionClient(conn rabtap.RabbitConnection, extras ConnectionExtras) string {
+	client := strings.TrimSpace(conn.ClientProperties.Product + " " + conn.ClientProperties.Version)
+	if client == "" && extras.ClientProperties.ClientID != "" {
+		client = fmt.Sprintf("client-id %s", extras.ClientProperties.ClientID)
+	}
+	return orDash(client)
+}
+
+// orDash placeholder for values the protocol does not provide
+func orDash(str string) string {
+	if str == "" {
+		return "-"
+	}
+	return str
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocolFamily(t *testing.T) {
+	assert.Equal(t, ProtocolAMQP091, ProtocolFamily("AMQP 0-9-1"))
+	assert.Equal(t, ProtocolAMQP10, ProtocolFamily("AMQP 1.0"))
+	// as reported by the management api
+	assert.Equal(t, ProtocolAMQP10, ProtocolFamily("AMQP 1-0"))
+	assert.Equal(t, ProtocolMQTT, ProtocolFamily("MQTT 3.1.1"))
+	assert.Equal(t, ProtocolMQTT, ProtocolFamily("Web MQTT 3.1.1"))
+	assert.Equal(t, ProtocolSTOMP, ProtocolFamily("STOMP 1.2"))
+	assert.Equal(t, ProtocolOther, ProtocolFamily(""))
+}
+
+func TestConnectionListProtocols(t *testing.T) {
+	amqpConn := rabtap.RabbitConnection{Name: "a", Protocol: "AMQP 0-9-1", Channels: 3, User: "guest", Vhost: "/"}
+	amqpConn.ClientProperties.Product = "RabbitMQ"
+	amqpConn.ClientProperties.Version = "5.9.0"
+	mqttConn := rabtap.RabbitConnection{Name: "m", Protocol: "MQTT 3.1.1"}
+	extras := ConnectionExtras{Name: "m"}
+	extras.ClientProperties.ClientID = "sensor-1"
+
+	table := ConnectionList{
+		Connections: []rabtap.RabbitConnection{amqpConn, mqttConn},
+		Extras:      map[string]ConnectionExtras{"m": extras},
+	}.Table(NumberFormat{Raw: true})
+	assert.Equal(t, "PROTOCOL", table.Headers[1])
+	assert.Equal(t, "3", table.Rows[0][5].Text)
+	assert.Equal(t, "RabbitMQ 5.9.0", table.Rows[0][8].Text)
+	assert.Equal(t, "-", table.Rows[1][2].Text)
+	assert.Equal(t, "-", table.Rows[1][5].Text)
+	assert.Equal(t, "client-id sensor-1", table.Rows[1][8].Text)
+}
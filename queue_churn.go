@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultMinChurnQueues temporary queues of one client above which it is reported
+const defaultMinChurnQueues = 100
+
+// temporaryQueue : queue columns needed to find the owner of a temporary queue
+type temporaryQueue struct {
+	Vhost           string `json:"vhost"`
+	Name            string `json:"name"`
+	AutoDelete      bool   `json:"auto_delete"`
+	Exclusive       bool   `json:"exclusive"`
+	OwnerPidDetails struct {
+		Name string `json:"name"`
+	} `json:"owner_pid_details"`
+}
+
+// TemporaryQueues list the auto-delete and exclusive queues
+func (client *ManagementClient) TemporaryQueues() ([]temporaryQueue, error) {
+	var queues []temporaryQueue
+	if err := client.get("queues?columns=vhost,name,auto_delete,exclusive,owner_pid_details", &queues); err != nil {
+		return nil, err
+	}
+	res := []temporaryQueue{}
+	for _, queue := range queues {
+		if queue.AutoDelete || queue.Exclusive {
+			res = append(res, queue)
+		}
+	}
+	return res, nil
+}
+
+var (
+	uuidPattern      = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	generatedPattern = regexp.MustCompile(`^amq\.gen-`)
+	uniquePattern    = regexp.MustCompile(`[0-9a-fA-F]{8,}|[0-9]+`)
+)
+
+// queueNamePattern replace the generated parts of a queue name by *, so
+// "reply-4f1c...-a9" and "reply-77b2...-03" share the pattern "reply-*"
+func queueNamePattern(name string) string {
+	if generatedPattern.MatchString(name) {
+		return "amq.gen-*"
+	}
+	pattern := uuidPattern.ReplaceAllString(name, "*")
+	pattern = uniquePattern.ReplaceAllString(pattern, "*")
+	for strings.Contains(pattern, "**") {
+		pattern = strings.Replace(pattern, "**", "*", -1)
+	}
+	return pattern
+}
+
+// QueueChurn : temporary queues sharing a name pattern created by one client
+type QueueChurn struct {
+	User        string   `json:"user"`
+	Product     string   `json:"product"`
+	Pattern     string   `json:"pattern"`
+	Queues      int      `json:"queues"`
+	Exclusive   int      `json:"exclusive"`
+	Connections []string `json:"connections"`
+	Closed      []string `json:"closed,omitempty"`
+	Vhost       string   `json:"vhost"`
+	// Maintenance window the churn was seen in
+	Maintenance string `json:"maintenance,omitempty"`
+}
+
+// FindQueueChurn group temporary queues by the user and client product of the
+// connection owning them and by name pattern. The owner of exclusive queues is
+// reported by the broker, auto-delete queues are attributed to the connections
+// consuming from them. Groups with less than min queues are left out.
+func FindQueueChurn(queues []temporaryQueue, info rabtap.BrokerInfo, min int) []QueueChurn {
+	conns := map[string]rabtap.RabbitConnection{}
+	for _, conn := range info.Connections {
+		conns[conn.Name] = conn
+	}
+	consumers := map[string]string{}
+	for _, consumer := range info.Consumers {
+		consumers[consumer.Queue.Vhost+"/"+consumer.Queue.Name] = consumer.ChannelDetails.ConnectionName
+	}
+
+	groups := map[string]*QueueChurn{}
+	groupConns := map[string]map[string]bool{}
+	for _, queue := range queues {
+		connName := queue.OwnerPidDetails.Name
+		if connName == "" {
+			connName = consumers[queue.Vhost+"/"+queue.Name]
+		}
+		conn := conns[connName]
+		churn := QueueChurn{User: conn.User, Product: conn.ClientProperties.Product, Pattern: queue.Vhost + "/" + queueNamePattern(queue.Name), Vhost: queue.Vhost}
+		key := churn.User + "\x00" + churn.Product + "\x00" + churn.Pattern
+		if _, ok := groups[key]; !ok {
+			groups[key] = &churn
+			groupConns[key] = map[string]bool{}
+		}
+		groups[key].Queues++
+		if queue.Exclusive {
+			groups[key].Exclusive++
+		}
+		if connName != "" {
+			groupConns[key][connName] = true
+		}
+	}
+
+	res := []QueueChurn{}
+	for key, churn := range groups {
+		if churn.Queues < min {
+			continue
+		}
+		churn.Connections = []string{}
+		for name := range groupConns[key] {
+			churn.Connections = append(churn.Connections, name)
+		}
+		sort.Strings(churn.Connections)
+		res = append(res, *churn)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Queues != res[j].Queues {
+			return res[i].Queues > res[j].Queues
+		}
+		return res[i].Pattern < res[j].Pattern
+	})
+	return res
+}
+
+// QueueChurnList : clients creating many temporary queues
+type QueueChurnList []QueueChurn
+
+// InMaintenance drop the churn of vhosts in a suppressing maintenance
+// window and annotate the churn of annotating ones
+func (list QueueChurnList) InMaintenance(maintenance Maintenance, now time.Time) QueueChurnList {
+	res := QueueChurnList{}
+	for _, churn := range list {
+		if window, ok := maintenance.Covering(churn.Vhost, now); ok {
+			if window.Action == MaintenanceSuppress {
+				continue
+			}
+			churn.Maintenance = window.Name
+		}
+		res = append(res, churn)
+	}
+	return res
+}
+
+// Table churn groups as table
+func (list QueueChurnList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"USER", "PRODUCT", "PATTERN", "QUEUES", "EXCLUSIVE", "CONNECTIONS", "CLOSED", "MAINTENANCE"}}
+	for _, churn := range list {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: orDash(churn.User)},
+			{Text: orDash(churn.Product)},
+			{Text: churn.Pattern, Color: Yellow},
+			{Text: format.Count(int64(churn.Queues)), Color: Yellow},
+			{Text: format.Count(int64(churn.Exclusive))},
+			{Text: format.Count(int64(len(churn.Connections)))},
+			{Text: format.Count(int64(len(churn.Closed)))},
+			{Text: orDash(churn.Maintenance)},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("queue-churn", "[--min n] [--close] [--yes] [--maintenance f] clients creating many auto-delete or exclusive queues", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("queue-churn")
+		min := flags.Int("min", defaultMinChurnQueues, "report clients owning at least this many temporary queues")
+		closeConns := flags.Bool("close", false, "close the responsible connections")
+		yes := flags.Bool("yes", false, "close without asking")
+		maintenanceFile := flags.String("maintenance", envOr("RADISH_MAINTENANCE", defaultMaintenanceFile), "maintenance windows file, churn in active windows is left out or annotated")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		maintenance, err := LoadMaintenance(*maintenanceFile)
+		if err != nil {
+			return nil, usageError("queue-churn: %s", err)
+		}
+		queues, err := rabbitmq.management().TemporaryQueues()
+		if err != nil {
+			return nil, err
+		}
+		list := QueueChurnList(FindQueueChurn(queues, rabbitmq.info(), *min)).InMaintenance(maintenance, time.Now())
+		if !*closeConns {
+			return list, nil
+		}
+		for i, churn := range list {
+			if len(churn.Connections) == 0 {
+				continue
+			}
+			question := fmt.Sprintf("close %d connections of %s (%s) owning %d queues like %s?",
+				len(churn.Connections), orDash(churn.User), orDash(churn.Product), churn.Queues, churn.Pattern)
+			if !*yes && !cli.confirm(question) {
+				continue
+			}
+			for _, name := range churn.Connections {
+				if err := rabbitmq.management().CloseConnection(name, "radish: too many temporary queues"); err != nil {
+					return list, err
+				}
+				list[i].Closed = append(list[i].Closed, name)
+			}
+		}
+		return list, nil
+	})
+}
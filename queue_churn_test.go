@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueNamePattern(t *testing.T) {
+	assert.Equal(t, "amq.gen-*", queueNamePattern("amq.gen-JzTY20BRgKO-HjmUJj0wLg"))
+	assert.Equal(t, "reply-*", queueNamePattern("reply-4f1c2a9e-1b2c-4d5e-8f90-123456789abc"))
+	assert.Equal(t, "worker-*-tmp", queueNamePattern("worker-17-tmp"))
+	assert.Equal(t, "orders", queueNamePattern("orders"))
+}
+
+func TestFindQueueChurn(t *testing.T) {
+	info := rabtap.BrokerInfo{Connections: []rabtap.RabbitConnection{{Name: "c1", User: "app"}, {Name: "c2", User: "app"}}}
+	info.Connections[0].ClientProperties.Product = "pika"
+	info.Connections[1].ClientProperties.Product = "pika"
+	info.Consumers = make([]rabtap.RabbitConsumer, 1)
+	info.Consumers[0].Queue.Vhost, info.Consumers[0].Queue.Name = "/", "reply-3"
+	info.Consumers[0].ChannelDetails.ConnectionName = "c2"
+
+	queues := make([]temporaryQueue, 3)
+	for i, name := range []string{"reply-1", "reply-2", "reply-3"} {
+		queues[i] = temporaryQueue{Vhost: "/", Name: name, AutoDelete: true}
+	}
+	queues[0].Exclusive = true
+	queues[0].OwnerPidDetails.Name = "c1"
+	queues[1].Exclusive = true
+	queues[1].OwnerPidDetails.Name = "c1"
+	queues = append(queues, temporaryQueue{Vhost: "/", Name: "other", AutoDelete: true})
+
+	churn := FindQueueChurn(queues, info, 2)
+	assert.Equal(t, []QueueChurn{{User: "app", Product: "pika", Pattern: "//reply-*", Queues: 3, Exclusive: 2, Connections: []string{"c1", "c2"}, Vhost: "/"}}, churn)
+}
+
+func TestCLIConfirm(t *testing.T) {
+	var out, prompts bytes.Buffer
+	cli := &CLI{out: &out, in: strings.NewReader("yes\n"), prompts: &prompts}
+	assert.True(t, cli.confirm("close?"))
+	assert.Equal(t, "close? [y/N] ", prompts.String())
+	assert.Empty(t, out.String())
+	cli.in = strings.NewReader("\n")
+	assert.False(t, cli.confirm("close?"))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// QueueRef : identifies a queue in a vhost
+type QueueRef struct {
+	Vhost string `json:"vhost"`
+	Queue string `json:"queue"`
+}
+
+// ParseQueueRef : parse queue reference sent by the ui
+func ParseQueueRef(str string) QueueRef {
+	var res QueueRef
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		fmt.Println(err)
+	}
+	return res
+}
+
+// QueueConsumer : a consumer of a queue resolved to the connection serving it
+type QueueConsumer struct {
+	ConsumerTag    string `json:"consumerTag"`
+	Channel        string `json:"channel"`
+	ConnectionName string `json:"connectionName"`
+	ClientName     string `json:"clientName"`
+	PeerHost       string `json:"peerHost"`
+	PeerPort       int    `json:"peerPort"`
+	User           string `json:"user"`
+	PrefetchCount  int    `json:"prefetchCount"`
+	AckRequired    bool   `json:"ackRequired"`
+}
+
+// FindQueueConsumers list the consumers of the given queue together with the
+// channel and connection they are running on
+func FindQueueConsumers(info *rabtap.BrokerInfo, ref QueueRef) []QueueConsumer {
+	connections := map[string]rabtap.RabbitConnection{}
+	for _, conn := range info.Connections {
+		connections[conn.Name] = conn
+	}
+	result := []QueueConsumer{}
+	for _, consumer := range info.Consumers {
+		if consumer.Queue.Name != ref.Queue || (ref.Vhost != "" && consumer.Queue.Vhost != ref.Vhost) {
+			continue
+		}
+		details := consumer.ChannelDetails
+		qc := QueueConsumer{
+			ConsumerTag:    consumer.ConsumerTag,
+			Channel:        details.Name,
+			ConnectionName: details.ConnectionName,
+			PeerHost:       details.PeerHost,
+			PeerPort:       details.PeerPort,
+			User:           details.User,
+			PrefetchCount:  consumer.PrefetchCount,
+			AckRequired:    consumer.AckRequired,
+		}
+		if conn, ok := connections[details.ConnectionName]; ok {
+			qc.ClientName = conn.ClientProperties.ConnectionName
+		}
+		result = append(result, qc)
+	}
+	return result
+}
+
+// QueueConsumers lookup who is consuming from the given queue
+func (rabbitmq *Rabbitmq) QueueConsumers(ref QueueRef) ([]QueueConsumer, error) {
+	if err := rabbitmq.UpdateBrokerInfo(); err != nil {
+		return nil, err
+	}
+	info := rabbitmq.info()
+	return FindQueueConsumers(&info, ref), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func queueConsumersInfo() rabtap.BrokerInfo {
+	info := rabtap.BrokerInfo{Connections: []rabtap.RabbitConnection{{Name: "10.0.0.1:4711 -> 10.0.0.2:5672"}}}
+	info.Connections[0].ClientProperties.ConnectionName = "billing-worker"
+	add := func(tag string, vhost string, queue string, conn string) {
+		consumer := rabtap.RabbitConsumer{ConsumerTag: tag, PrefetchCount: 10, AckRequired: true}
+		consumer.Queue.Vhost, consumer.Queue.Name = vhost, queue
+		consumer.ChannelDetails.Name = conn + " (1)"
+		consumer.ChannelDetails.ConnectionName = conn
+		consumer.ChannelDetails.PeerHost, consumer.ChannelDetails.PeerPort = "10.0.0.1", 4711
+		consumer.ChannelDetails.User = "app"
+		info.Consumers = append(info.Consumers, consumer)
+	}
+	add("ctag-1", "/", "orders", "10.0.0.1:4711 -> 10.0.0.2:5672")
+	add("ctag-2", "/", "orders", "gone")
+	add("ctag-3", "billing", "orders", "10.0.0.1:4711 -> 10.0.0.2:5672")
+	add("ctag-4", "/", "invoices", "10.0.0.1:4711 -> 10.0.0.2:5672")
+	return info
+}
+
+func TestFindQueueConsumers(t *testing.T) {
+	info := queueConsumersInfo()
+	for _, tc := range []struct {
+		ref  QueueRef
+		tags []string
+	}{
+		{QueueRef{Vhost: "/", Queue: "orders"}, []string{"ctag-1", "ctag-2"}},
+		{QueueRef{Vhost: "billing", Queue: "orders"}, []string{"ctag-3"}},
+		{QueueRef{Queue: "orders"}, []string{"ctag-1", "ctag-2", "ctag-3"}},
+		{QueueRef{Vhost: "/", Queue: "invoices"}, []string{"ctag-4"}},
+		{QueueRef{Vhost: "/", Queue: "unknown"}, []string{}},
+		{QueueRef{Vhost: "other", Queue: "orders"}, []string{}},
+	} {
+		tags := []string{}
+		for _, consumer := range FindQueueConsumers(&info, tc.ref) {
+			tags = append(tags, consumer.ConsumerTag)
+		}
+		assert.Equal(t, tc.tags, tags, "%+v", tc.ref)
+	}
+}
+
+func TestFindQueueConsumersDetails(t *testing.T) {
+	info := queueConsumersInfo()
+	consumers := FindQueueConsumers(&info, QueueRef{Vhost: "/", Queue: "orders"})
+	assert.Equal(t, QueueConsumer{
+		ConsumerTag:    "ctag-1",
+		Channel:        "10.0.0.1:4711 -> 10.0.0.2:5672 (1)",
+		ConnectionName: "10.0.0.1:4711 -> 10.0.0.2:5672",
+		ClientName:     "billing-worker",
+		PeerHost:       "10.0.0.1",
+		PeerPort:       4711,
+		User:           "app",
+		PrefetchCount:  10,
+		AckRequired:    true,
+	}, consumers[0])
+	// connection closed since the consumers were listed
+	assert.Equal(t, "", consumers[1].ClientName)
+	assert.Equal(t, []QueueConsumer{}, FindQueueConsumers(&rabtap.BrokerInfo{}, QueueRef{Queue: "orders"}))
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// errScopedBulkChange growing or shrinking by pattern or node would reach
+// queues outside the scope
+var errScopedBulkChange = errors.New("grow and shrink are refused with a scope, add or remove members queue by queue")
+
+// QuorumQueue : quorum queue with its replicas
+type QuorumQueue struct {
+	Vhost   string   `json:"vhost"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Leader  string   `json:"leader"`
+	Members []string `json:"members"`
+	Online  []string `json:"online"`
+}
+
+// QuorumQueues list the quorum queues of the broker
+func (client *ManagementClient) QuorumQueues() ([]QuorumQueue, error) {
+	var queues []QuorumQueue
+	if err := client.get("queues?columns=vhost,name,type,leader,members,online", &queues); err != nil {
+		return nil, err
+	}
+	res := []QuorumQueue{}
+	for _, queue := range queues {
+		if queue.Type == "quorum" {
+			res = append(res, queue)
+		}
+	}
+	return res, nil
+}
+
+func quorumReplicasPath(vhost string, queue string, action string) string {
+	return managementPath("queues", "quorum", vhost, queue, "replicas", action)
+}
+
+// AddQuorumMember add a replica of the queue on node
+func (client *ManagementClient) AddQuorumMember(vhost string, queue string, node string) error {
+	if err := client.scope.Check("queue", queue); err != nil {
+		return err
+	}
+	return client.post(quorumReplicasPath(vhost, queue, "add"), map[string]string{"node": node})
+}
+
+// DeleteQuorumMember remove the replica of the queue on node
+func (client *ManagementClient) DeleteQuorumMember(vhost string, queue string, node string) error {
+	if err := client.scope.Check("queue", queue); err != nil {
+		return err
+	}
+	res, err := client.request("DELETE", quorumReplicasPath(vhost, queue, "delete"), map[string]string{"node": node}, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// GrowQuorumQueues add replicas on node to the matching quorum queues,
+// strategy "all" grows every queue, "even" only those with an even number
+// of members. Refused with a scope, the broker matches the pattern itself.
+func (client *ManagementClient) GrowQuorumQueues(node string, vhostPattern string, queuePattern string, strategy string) error {
+	if !client.scope.Empty() {
+		return errScopedBulkChange
+	}
+	return client.post(managementPath("queues", "quorum", "replicas", "on", node, "grow"), map[string]string{
+		"vhost_pattern": vhostPattern,
+		"queue_pattern": queuePattern,
+		"strategy":      strategy,
+	})
+}
+
+// ShrinkQuorumQueues remove the replicas of all quorum queues on node,
+// refused with a scope
+func (client *ManagementClient) ShrinkQuorumQueues(node string) error {
+	if !client.scope.Empty() {
+		return errScopedBulkChange
+	}
+	return client.delete(managementPath("queues", "quorum", "replicas", "on", node, "shrink"))
+}
+
+// RebalanceQueues let the broker spread queue leaders evenly over the nodes
+func (client *ManagementClient) RebalanceQueues() error {
+	return client.post("rebalance/queues", map[string]string{})
+}
+
+// NodeLeaders : quorum queue leaders on a node
+type NodeLeaders struct {
+	Node    string  `json:"node"`
+	Leaders int     `json:"leaders"`
+	Members int     `json:"members"`
+	Share   float64 `json:"share"`
+}
+
+// QuorumReport : leader distribution of the quorum queues
+type QuorumReport struct {
+	Queues          int           `json:"queues"`
+	Nodes           []NodeLeaders `json:"nodes"`
+	Unbalanced      bool          `json:"unbalanced"`
+	Suggestion      string        `json:"suggestion,omitempty"`
+	UnderReplicated []QuorumQueue `json:"underReplicated"`
+}
+
+// leaderImbalance a node leading more than this factor of its fair share of
+// queues makes the cluster unbalanced
+const leaderImbalance = 1.5
+
+// BuildQuorumReport count leaders and replicas per node. Queues with replicas
+// offline are listed as under replicated.
+func BuildQuorumReport(queues []QuorumQueue) QuorumReport {
+	report := QuorumReport{Queues: len(queues), Nodes: []NodeLeaders{}, UnderReplicated: []QuorumQueue{}}
+	nodes := map[string]*NodeLeaders{}
+	node := func(name string) *NodeLeaders {
+		if _, ok := nodes[name]; !ok {
+			nodes[name] = &NodeLeaders{Node: name}
+		}
+		return nodes[name]
+	}
+	for _, queue := range queues {
+		for _, member := range queue.Members {
+			node(member).Members++
+		}
+		if queue.Leader != "" {
+			node(queue.Leader).Leaders++
+		}
+		if len(queue.Online) < len(queue.Members) {
+			report.UnderReplicated = append(report.UnderReplicated, queue)
+		}
+	}
+	for _, n := range nodes {
+		if report.Queues > 0 {
+			n.Share = float64(n.Leaders) / float64(report.Queues)
+		}
+		report.Nodes = append(report.Nodes, *n)
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Node < report.Nodes[j].Node })
+	if len(report.Nodes) > 1 && report.Queues >= len(report.Nodes) {
+		fair := 1 / float64(len(report.Nodes))
+		for _, n := range report.Nodes {
+			if n.Share > fair*leaderImbalance {
+				report.Unbalanced = true
+				report.Suggestion = fmt.Sprintf("%s leads %.0f%% of the quorum queues, run radish rebalance", n.Node, n.Share*100)
+			}
+		}
+	}
+	return report
+}
+
+// Table leaders per node as table
+func (report QuorumReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"NODE", "LEADERS", "MEMBERS", "LEADER SHARE"}}
+	fair := 0.0
+	if len(report.Nodes) > 0 {
+		fair = 1 / float64(len(report.Nodes))
+	}
+	for _, n := range report.Nodes {
+		color := Green
+		if n.Share > fair*leaderImbalance {
+			color = Yellow
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: n.Node},
+			{Text: format.Count(int64(n.Leaders)), Color: color},
+			{Text: format.Count(int64(n.Members))},
+			{Text: fmt.Sprintf("%.0f%%", n.Share*100), Color: color},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("quorum-queues", "leader distribution of the quorum queues", func(cli *CLI, args []string) (interface{}, error) {
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		queues, err := rabbitmq.management().QuorumQueues()
+		if err != nil {
+			return nil, err
+		}
+		return BuildQuorumReport(queues), nil
+	})
+
+	registerCommand("quorum-grow", "--node n [--vhost-pattern p] [--queue-pattern p] [--strategy all|even] add replicas on a node", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("quorum-grow")
+		node := flags.String("node", "", "node to add replicas on")
+		vhostPattern := flags.String("vhost-pattern", ".*", "vhosts to grow")
+		queuePattern := flags.String("queue-pattern", ".*", "queues to grow")
+		strategy := flags.String("strategy", "all", "all or even")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if *node == "" {
+			return nil, usageError("quorum-grow: --node is required")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return nil, rabbitmq.management().GrowQuorumQueues(*node, *vhostPattern, *queuePattern, *strategy)
+	})
+
+	registerCommand("quorum-shrink", "--node n remove all quorum replicas from a node", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("quorum-shrink")
+		node := flags.String("node", "", "node to remove replicas from")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if *node == "" {
+			return nil, usageError("quorum-shrink: --node is required")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return nil, rabbitmq.management().ShrinkQuorumQueues(*node)
+	})
+
+	registerCommand("quorum-member", "[--vhost v] --node n add|remove <queue> change the replicas of one queue", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("quorum-member")
+		vhost := flags.String("vhost", "", "vhost of the queue, the default vhost when omitted")
+		node := flags.String("node", "", "node of the replica")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = cli.vhost(*vhost)
+		if flags.NArg() != 2 || *node == "" {
+			return nil, usageError("quorum-member: expected --node, add or remove and a queue name")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		switch flags.Arg(0) {
+		case "add":
+			return nil, rabbitmq.management().AddQuorumMember(*vhost, flags.Arg(1), *node)
+		case "remove":
+			return nil, rabbitmq.management().DeleteQuorumMember(*vhost, flags.Arg(1), *node)
+		}
+		return nil, usageError("quorum-member: unknown action %s", flags.Arg(0))
+	})
+
+	registerCommand("rebalance", "spread queue leaders evenly over the nodes", func(cli *CLI, args []string) (interface{}, error) {
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return nil, rabbitmq.management().RebalanceQueues()
+	})
+}
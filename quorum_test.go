@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildQuorumReport(t *testing.T) {
+	members := []string{"rabbit@a", "rabbit@b", "rabbit@c"}
+	queues := []QuorumQueue{
+		{Name: "q1", Leader: "rabbit@a", Members: members, Online: members},
+		{Name: "q2", Leader: "rabbit@a", Members: members, Online: members},
+		{Name: "q3", Leader: "rabbit@a", Members: members, Online: members[:2]},
+		{Name: "q4", Leader: "rabbit@b", Members: members, Online: members},
+	}
+	report := BuildQuorumReport(queues)
+	assert.True(t, report.Unbalanced)
+	assert.Equal(t, "rabbit@a leads 75% of the quorum queues, run radish rebalance", report.Suggestion)
+	assert.Equal(t, NodeLeaders{Node: "rabbit@a", Leaders: 3, Members: 4, Share: 0.75}, report.Nodes[0])
+	assert.Equal(t, 0, report.Nodes[2].Leaders)
+	assert.Len(t, report.UnderReplicated, 1)
+
+	queues[0].Leader, queues[1].Leader = "rabbit@c", "rabbit@b"
+	assert.False(t, BuildQuorumReport(queues).Unbalanced)
+}
+
+func TestQuorumPaths(t *testing.T) {
+	assert.Equal(t, "queues/quorum/%2F/orders/replicas/add", quorumReplicasPath("/", "orders", "add"))
+	assert.Equal(t, "queues/quorum/replicas/on/rabbit@a/grow", objectPath("queues/quorum/replicas/on", "rabbit@a", "grow"))
+}
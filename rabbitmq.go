@@ -4,7 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"net/url"
-	"fmt"
+	"sync"
 	"github.com/streadway/amqp"
 	"github.com/jandelgado/rabtap/pkg"
 	"github.com/sirupsen/logrus"
@@ -20,7 +20,19 @@ type Rabbitmq struct {
 	connection 			*amqp.Connection
 	restClientExist 	bool
 	restClient 			*rabtap.RabbitHTTPClient
+	mgmtClient 			*ManagementClient
 	brokerInfo 			rabtap.BrokerInfo
+	target 				BrokerTarget
+	discoveryStop 		chan bool
+	tlsConfig 			*tls.Config
+	amqpConfig 			amqp.Config
+	scope 				Scope
+	readOnly 			bool
+	recorder 			*Recorder
+	offline 			bool
+	// mu guards target, the urls, the connection, the clients and the broker
+	// info, the discovery watcher replaces them
+	mu 					sync.Mutex
 }
 
 // NewRabbitmq expose rabbitmq functionality
@@ -35,19 +47,75 @@ func NewRabbitmq() *Rabbitmq {
 
 // Connect establish connection to rabbitmq
 func (rabbitmq *Rabbitmq) Connect(det RabbitmqLoginDetails) error {
-	rabbitmq.amqpURL = fmt.Sprintf("amqp://%s:%s@%s:%s", det.Username, det.Password, det.Host, det.Port)
-	rabbitmq.restURL = fmt.Sprintf("http://%s:%s@%s:%s/api", det.Username, det.Password, det.Host, "15672")
-	conn, err := amqp.Dial(rabbitmq.amqpURL)
+	tlsConfig, err := BuildTLSConfig(det)
 	if err != nil {
-		rabbitmq.connected = false;
 		return err
 	}
-	rabbitmq.connected = true;
-	rabbitmq.connection = conn;
-	if err := rabbitmq.RestClient(rabbitmq.restURL); err != nil {
-		return err;
+	rabbitmq.tlsConfig = tlsConfig
+	rabbitmq.scope = ParseScope(det.Scope)
+	rabbitmq.readOnly = det.ReadOnly
+	if rabbitmq.amqpConfig, err = AMQPConfig(det, tlsConfig); err != nil {
+		return err
+	}
+	if det.ManagementURL != "" {
+		return rabbitmq.connectManagement(det)
+	}
+	targets, err := ResolveBrokerTargets(det)
+	if err != nil {
+		return err
+	}
+	if rabbitmq.discoveryStop != nil {
+		close(rabbitmq.discoveryStop)
+		rabbitmq.discoveryStop = nil
+	}
+	if err := rabbitmq.connectAny(det, targets); err != nil {
+		return err
+	}
+	if det.Discovery != "" {
+		rabbitmq.discoveryStop = make(chan bool)
+		go rabbitmq.watchDiscovery(det, rabbitmq.discoveryStop)
+	}
+	return nil
+}
+
+// connectTarget connect to the given broker endpoint
+func (rabbitmq *Rabbitmq) connectTarget(det RabbitmqLoginDetails, target BrokerTarget) error {
+	amqpScheme, amqpPort, restScheme, restPort := "amqp", "5672", "http", "15672"
+	if det.TLSEnabled() {
+		amqpScheme, amqpPort, restScheme, restPort = "amqps", "5671", "https", "15671"
+	}
+	if target.Port != "" {
+		amqpPort = target.Port
+	}
+	// credentials are escaped, passwords may hold @, / or :
+	user := url.UserPassword(det.Username, det.Password)
+	amqpURL := (&url.URL{Scheme: amqpScheme, User: user, Host: target.Host + ":" + amqpPort}).String()
+	restURL := (&url.URL{Scheme: restScheme, User: user, Host: target.Host + ":" + restPort, Path: "/api"}).String()
+	rabbitmq.mu.Lock()
+	rabbitmq.amqpURL, rabbitmq.restURL = amqpURL, restURL
+	rabbitmq.mu.Unlock()
+	conn, err := amqp.DialConfig(amqpURL, rabbitmq.amqpConfig)
+	rabbitmq.mu.Lock()
+	if err != nil {
+		rabbitmq.connected = false
+		rabbitmq.mu.Unlock()
+		return err
 	}
-	return nil;
+	if rabbitmq.connection != nil {
+		rabbitmq.connection.Close()
+	}
+	rabbitmq.target = target
+	rabbitmq.connected = true
+	rabbitmq.connection = conn
+	rabbitmq.mu.Unlock()
+	return rabbitmq.RestClient(restURL)
+}
+
+// currentTarget the broker endpoint connected to
+func (rabbitmq *Rabbitmq) currentTarget() BrokerTarget {
+	rabbitmq.mu.Lock()
+	defer rabbitmq.mu.Unlock()
+	return rabbitmq.target
 }
 
 // RestClient connect to rabbitmq rest client for broker info
@@ -56,26 +124,61 @@ func (rabbitmq *Rabbitmq) RestClient(restClientURL string) error {
 	if err != nil {
 		return err
 	}
-	rabbitmq.restClient = rabtap.NewRabbitHTTPClient(url, &tls.Config{})
+	restClient := rabtap.NewRabbitHTTPClient(url, rabbitmq.tlsConfig)
+	mgmtClient := NewManagementClient(url, rabbitmq.tlsConfig)
+	mgmtClient.scope = rabbitmq.scope
+	mgmtClient.readOnly = rabbitmq.readOnly
+	if rabbitmq.recorder != nil {
+		mgmtClient.client.Transport = rabbitmq.recorder.Wrap(url, mgmtClient.client.Transport)
+	}
+	rabbitmq.mu.Lock()
+	rabbitmq.restClient, rabbitmq.mgmtClient = restClient, mgmtClient
+	rabbitmq.mu.Unlock()
 	if err := rabbitmq.UpdateBrokerInfo(); err != nil {
-		return err
+		return managementURLError(url, err)
 	}
 	return nil
 }
 
 // UpdateBrokerInfo update broker info for updated exchanges channels and queues values
 func (rabbitmq *Rabbitmq) UpdateBrokerInfo() error {
-	brokerInfo, err := rabbitmq.restClient.BrokerInfo();
+	ctx, cancel := context.WithTimeout(context.Background(), defaultBrokerInfoTimeout)
+	defer cancel()
+	return rabbitmq.UpdateBrokerInfoContext(ctx)
+}
+
+// UpdateBrokerInfoContext update broker info, giving up when ctx is done
+func (rabbitmq *Rabbitmq) UpdateBrokerInfoContext(ctx context.Context) error {
+	brokerInfo, err := rabbitmq.management().BrokerInfo(ctx)
 	if err != nil {
 		return err
 	}
+	rabbitmq.mu.Lock()
 	rabbitmq.brokerInfo = brokerInfo
 	rabbitmq.restClientExist = true
-	return nil;
+	rabbitmq.mu.Unlock()
+	return nil
+}
+
+// management the management api client of the broker connected to
+func (rabbitmq *Rabbitmq) management() *ManagementClient {
+	rabbitmq.mu.Lock()
+	defer rabbitmq.mu.Unlock()
+	return rabbitmq.mgmtClient
+}
+
+// info the broker info of the last update
+func (rabbitmq *Rabbitmq) info() rabtap.BrokerInfo {
+	rabbitmq.mu.Lock()
+	defer rabbitmq.mu.Unlock()
+	return rabbitmq.brokerInfo
 }
  
 // SubscribeToQueue sub to queue
 func (rabbitmq *Rabbitmq) SubscribeToQueue(queueName string) (<-chan amqp.Delivery, error) {
+	if rabbitmq.offline {
+		return nil, ErrOffline
+	}
 	channel, err := rabbitmq.connection.Channel()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// RatesDisabled true when the broker runs with rates_mode=none and leaves out
+// all *_details rates
+func RatesDisabled(overview rabtap.RabbitOverview) bool {
+	return overview.RatesMode == "none"
+}
+
+// counterRate per second rate between two samples of a counter. A counter
+// lower than before was reset by a restart and counts from 0 again.
+func counterRate(prev int, cur int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	delta := cur - prev
+	if delta < 0 {
+		delta = cur
+	}
+	return float64(delta) / elapsed.Seconds()
+}
+
+// FillRates compute the publish and deliver rates of resource in cur from the
+// message counters of the previous sample taken elapsed earlier. Queues not
+// in prev are left at 0.
+func FillRates(resource string, prev *rabtap.BrokerInfo, cur *rabtap.BrokerInfo, elapsed time.Duration) {
+	switch resource {
+	case ResourceOverview:
+		stats := &cur.Overview.MessageStats
+		stats.PublishDetails.Rate = counterRate(prev.Overview.MessageStats.Publish, stats.Publish, elapsed)
+		stats.DeliverGetDetails.Rate = counterRate(prev.Overview.MessageStats.DeliverGet, stats.DeliverGet, elapsed)
+	case ResourceQueues:
+		prevQueues := make(map[string]int, len(prev.Queues))
+		for i, queue := range prev.Queues {
+			prevQueues[queue.Vhost+"/"+queue.Name] = i
+		}
+		for i := range cur.Queues {
+			queue := &cur.Queues[i]
+			j, ok := prevQueues[queue.Vhost+"/"+queue.Name]
+			if !ok {
+				continue
+			}
+			prevStats := prev.Queues[j].MessageStats
+			queue.MessageStats.PublishDetails.Rate = counterRate(prevStats.Publish, queue.MessageStats.Publish, elapsed)
+			queue.MessageStats.DeliverGetDetails.Rate = counterRate(prevStats.DeliverGet, queue.MessageStats.DeliverGet, elapsed)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillRates(t *testing.T) {
+	prev := rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "q1"}, {Vhost: "/", Name: "q2"}}}
+	prev.Overview.MessageStats.Publish = 100
+	prev.Queues[0].MessageStats.Publish = 10
+	prev.Queues[0].MessageStats.DeliverGet = 50
+	cur := rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "q1"}, {Vhost: "/", Name: "new"}}}
+	cur.Overview.MessageStats.Publish = 300
+	cur.Queues[0].MessageStats.Publish = 30
+	cur.Queues[0].MessageStats.DeliverGet = 5 // counter reset
+	cur.Queues[1].MessageStats.Publish = 1000
+
+	FillRates(ResourceOverview, &prev, &cur, 10*time.Second)
+	FillRates(ResourceQueues, &prev, &cur, 10*time.Second)
+	assert.Equal(t, 20.0, cur.Overview.MessageStats.PublishDetails.Rate)
+	assert.Equal(t, 2.0, cur.Queues[0].MessageStats.PublishDetails.Rate)
+	assert.Equal(t, 0.5, cur.Queues[0].MessageStats.DeliverGetDetails.Rate)
+	assert.Equal(t, 0.0, cur.Queues[1].MessageStats.PublishDetails.Rate)
+}
+
+func TestRatesDisabled(t *testing.T) {
+	assert.True(t, RatesDisabled(rabtap.RabbitOverview{RatesMode: "none"}))
+	assert.False(t, RatesDisabled(rabtap.RabbitOverview{RatesMode: "basic"}))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrReadOnly returned by every method changing the broker when the client
+// or profile is read only
+var ErrReadOnly = errors.New("read only: refusing to modify the broker")
+
+// readOnlyRequest true for management api requests that do not modify the
+// broker. Fetching messages is a POST, GetMessages checks its ack mode
+// itself.
+func readOnlyRequest(method string, path string) bool {
+	if method == "GET" || method == "HEAD" {
+		return true
+	}
+	path = strings.SplitN(path, "?", 2)[0]
+	return method == "POST" && strings.HasPrefix(path, "queues/") && strings.HasSuffix(path, "/get")
+}
+
+// writable ErrReadOnly for read only connections, for operations going
+// through amqp instead of the management api
+func (rabbitmq *Rabbitmq) writable() error {
+	if rabbitmq.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
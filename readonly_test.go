@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyClient(t *testing.T) {
+	var methods []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+	client := NewManagementClient(uri, nil)
+	client.readOnly = true
+
+	assert.Equal(t, ErrReadOnly, client.DeleteQueue("/", "orders"))
+	assert.Equal(t, ErrReadOnly, client.PutPolicy(RabbitPolicy{Vhost: "/", Name: "ttl"}))
+	_, err := client.PublishMessage("/", "", "orders", "hello")
+	assert.Equal(t, ErrReadOnly, err)
+	_, err = client.GetMessages("/", "orders", 1, false)
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Empty(t, methods)
+
+	_, err = client.GetMessages("/", "orders", 1, true)
+	assert.Nil(t, err)
+	_, err = client.Policies()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"POST", "GET"}, methods)
+}
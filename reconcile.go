@@ -0,0 +1,76 @@
+package main
+
+import (
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// DanglingRef : object of a snapshot referencing an object missing from it
+type DanglingRef struct {
+	Resource string `json:"resource"`
+	Object   string `json:"object"`
+	Missing  string `json:"missing"`
+	Kind     string `json:"kind"`
+}
+
+// Resources the resource classes to re-fetch to resolve the reference
+func (ref DanglingRef) Resources() []string {
+	return []string{ref.Resource, ref.Kind}
+}
+
+// FindDanglingRefs bindings and consumers of info pointing to exchanges,
+// queues or connections info does not contain
+func FindDanglingRefs(info rabtap.BrokerInfo) []DanglingRef {
+	exchanges := map[string]bool{}
+	for _, exchange := range info.Exchanges {
+		exchanges[exchange.Vhost+"/"+exchange.Name] = true
+	}
+	queues := map[string]bool{}
+	for _, queue := range info.Queues {
+		queues[queue.Vhost+"/"+queue.Name] = true
+	}
+	connections := map[string]bool{}
+	for _, conn := range info.Connections {
+		connections[conn.Name] = true
+	}
+
+	var refs []DanglingRef
+	for _, binding := range info.Bindings {
+		object := binding.Vhost + "/" + binding.Source + "->" + binding.Destination
+		// the default exchange is not listed with a name
+		if binding.Source != "" && !exchanges[binding.Vhost+"/"+binding.Source] {
+			refs = append(refs, DanglingRef{ResourceBindings, object, binding.Vhost + "/" + binding.Source, ResourceExchanges})
+		}
+		dest := binding.Vhost + "/" + binding.Destination
+		if binding.DestinationType == "queue" && !queues[dest] {
+			refs = append(refs, DanglingRef{ResourceBindings, object, dest, ResourceQueues})
+		}
+		if binding.DestinationType == "exchange" && !exchanges[dest] {
+			refs = append(refs, DanglingRef{ResourceBindings, object, dest, ResourceExchanges})
+		}
+	}
+	for _, consumer := range info.Consumers {
+		queue := consumer.Queue.Vhost + "/" + consumer.Queue.Name
+		if !queues[queue] {
+			refs = append(refs, DanglingRef{ResourceConsumers, consumer.ConsumerTag, queue, ResourceQueues})
+		}
+		if conn := consumer.ChannelDetails.ConnectionName; conn != "" && !connections[conn] {
+			refs = append(refs, DanglingRef{ResourceConsumers, consumer.ConsumerTag, conn, ResourceConnections})
+		}
+	}
+	return refs
+}
+
+// danglingResources the distinct resource classes involved in refs
+func danglingResources(refs []DanglingRef) []string {
+	seen := map[string]bool{}
+	var resources []string
+	for _, ref := range refs {
+		for _, resource := range ref.Resources() {
+			if !seen[resource] {
+				seen[resource] = true
+				resources = append(resources, resource)
+			}
+		}
+	}
+	return resources
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDanglingRefs(t *testing.T) {
+	info := rabtap.BrokerInfo{
+		Exchanges: []rabtap.RabbitExchange{{Vhost: "prod", Name: "ex"}},
+		Queues:    []rabtap.RabbitQueue{{Vhost: "prod", Name: "q1"}},
+		Bindings: []rabtap.RabbitBinding{
+			{Vhost: "prod", Source: "", Destination: "q1", DestinationType: "queue"},
+			{Vhost: "prod", Source: "ex", Destination: "q1", DestinationType: "queue"},
+			{Vhost: "prod", Source: "ex", Destination: "gone", DestinationType: "queue"},
+			{Vhost: "prod", Source: "old", Destination: "ex", DestinationType: "exchange"},
+		},
+	}
+	consumer := rabtap.RabbitConsumer{ConsumerTag: "c1"}
+	consumer.Queue.Vhost = "prod"
+	consumer.Queue.Name = "gone"
+	consumer.ChannelDetails.ConnectionName = "conn"
+	info.Consumers = []rabtap.RabbitConsumer{consumer}
+
+	refs := FindDanglingRefs(info)
+	assert.Equal(t, []DanglingRef{
+		{ResourceBindings, "prod/ex->gone", "prod/gone", ResourceQueues},
+		{ResourceBindings, "prod/old->ex", "prod/old", ResourceExchanges},
+		{ResourceConsumers, "c1", "prod/gone", ResourceQueues},
+		{ResourceConsumers, "c1", "conn", ResourceConnections},
+	}, refs)
+	assert.Equal(t, []string{ResourceBindings, ResourceQueues, ResourceExchanges, ResourceConsumers, ResourceConnections},
+		danglingResources(refs))
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordingVersion format version of recorded bundles
+const recordingVersion = 1
+
+// ErrOffline returned by amqp operations while replaying a recording
+var ErrOffline = errors.New("replaying a recording: amqp operations are not available")
+
+// RecordingHeader : first line of a bundle
+type RecordingHeader struct {
+	Version int       `json:"version"`
+	Started time.Time `json:"started"`
+	// API management api base the responses were fetched from, without
+	// credentials
+	API string `json:"api"`
+}
+
+// RecordedResponse : a response of the management api. Path is relative to
+// the api base and includes the query.
+type RecordedResponse struct {
+	Time   time.Time       `json:"time"`
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// key of the request the response answers
+func (response RecordedResponse) key() string {
+	return response.Method + " " + response.Path
+}
+
+// Recorder : writes the read only responses of the management api to a
+// bundle, gzipped json lines starting with a RecordingHeader
+type Recorder struct {
+	mutex   sync.Mutex
+	file    *os.File
+	gz      *gzip.Writer
+	started time.Time
+	wrote   bool
+	count   int
+	// redaction applied to the responses before they are written
+	redaction Redaction
+}
+
+// NewRecorder create the bundle file
+func NewRecorder(file string) (*Recorder, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: f, gz: gzip.NewWriter(f), started: time.Now()}, nil
+}
+
+// recordedPath path and query of u relative to the api base
+func recordedPath(base *url.URL, u *url.URL) string {
+	path := strings.TrimPrefix(u.RequestURI(), strings.TrimSuffix(base.EscapedPath(), "/"))
+	return strings.TrimPrefix(path, "/")
+}
+
+// write append a line, the header is written before the first response
+func (recorder *Recorder) write(api *url.URL, response RecordedResponse) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if recorder.redaction.Enabled() {
+		var err error
+		if response, err = recorder.redaction.response(response); err != nil {
+			return err
+		}
+	}
+	enc := json.NewEncoder(recorder.gz)
+	if !recorder.wrote {
+		clean := *api
+		clean.User = nil
+		if err := enc.Encode(RecordingHeader{Version: recordingVersion, Started: recorder.started, API: recorder.redaction.Text(clean.String())}); err != nil {
+			return err
+		}
+		recorder.wrote = true
+	}
+	if err := enc.Encode(response); err != nil {
+		return err
+	}
+	recorder.count++
+	// a bundle of a killed process stays readable up to the last response
+	return recorder.gz.Flush()
+}
+
+// Count responses recorded so far
+func (recorder *Recorder) Count() int {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return recorder.count
+}
+
+// Close finish the bundle
+func (recorder *Recorder) Close() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if err := recorder.gz.Close(); err != nil {
+		recorder.file.Close()
+		return err
+	}
+	return recorder.file.Close()
+}
+
+// Wrap record the responses of requests to the api at base sent through
+// transport
+func (recorder *Recorder) Wrap(base *url.URL, transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return recordingTransport{recorder: recorder, base: base, transport: transport}
+}
+
+type recordingTransport struct {
+	recorder  *Recorder
+	base      *url.URL
+	transport http.RoundTripper
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.transport.RoundTrip(req)
+	if err != nil || !readOnlyRequest(req.Method, recordedPath(t.base, req.URL)) {
+		return res, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	raw := json.RawMessage(body)
+	if !json.Valid(body) {
+		raw, _ = json.Marshal(string(body))
+	}
+	response := RecordedResponse{Time: time.Now(), Method: req.Method, Path: recordedPath(t.base, req.URL), Status: res.StatusCode, Body: raw}
+	if err := t.recorder.write(t.base, response); err != nil {
+		subsystemLog("record").Warnf("recording %s failed: %s", response.Path, err)
+	}
+	return res, nil
+}
+
+// Recording : a loaded bundle, answering requests with the latest response
+// recorded at or before At, or the latest one when At is zero
+type Recording struct {
+	Header    RecordingHeader
+	At        time.Time
+	responses map[string][]RecordedResponse
+}
+
+// LoadRecording read a bundle
+func LoadRecording(file string) (*Recording, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a recording: %s", file, err)
+	}
+	recording := &Recording{responses: map[string][]RecordedResponse{}}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	first := true
+	for scanner.Scan() {
+		if first {
+			if err := json.Unmarshal(scanner.Bytes(), &recording.Header); err != nil || recording.Header.Version == 0 {
+				return nil, fmt.Errorf("%s: not a recording", file)
+			}
+			if recording.Header.Version > recordingVersion {
+				return nil, fmt.Errorf("%s: recording version %d is newer than %d", file, recording.Header.Version, recordingVersion)
+			}
+			first = false
+			continue
+		}
+		var response RecordedResponse
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		recording.responses[response.key()] = append(recording.responses[response.key()], response)
+	}
+	// a truncated stream ends the bundle of a killed recorder
+	if err := scanner.Err(); err != nil && err != gzip.ErrChecksum && !strings.Contains(err.Error(), "unexpected EOF") {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	if first {
+		return nil, fmt.Errorf("%s: empty recording", file)
+	}
+	for _, responses := range recording.responses {
+		sort.SliceStable(responses, func(i, j int) bool { return responses[i].Time.Before(responses[j].Time) })
+	}
+	return recording, nil
+}
+
+// Find the response to method and path at the time of the recording
+func (recording *Recording) Find(method string, path string) (RecordedResponse, bool) {
+	responses := recording.responses[method+" "+path]
+	found, ok := RecordedResponse{}, false
+	for _, response := range responses {
+		if !recording.At.IsZero() && response.Time.After(recording.At) {
+			break
+		}
+		found, ok = response, true
+	}
+	return found, ok
+}
+
+// RoundTrip answer from the recording, requests that were not recorded
+// get a 404 like unknown objects of the broker
+func (recording *Recording) RoundTrip(req *http.Request) (*http.Response, error) {
+	base, err := url.Parse(recording.Header.API)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	status := http.StatusNotFound
+	body := []byte(`{"error":"Object Not Found","reason":"not in the recording"}`)
+	if response, ok := recording.Find(req.Method, recordedPath(base, req.URL)); ok {
+		status, body = response.Status, response.Body
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// RecordingSummary : what a bundle holds
+type RecordingSummary struct {
+	Header    RecordingHeader     `json:"header"`
+	Requests  int                 `json:"requests"`
+	Responses int                 `json:"responses"`
+	First     time.Time           `json:"first"`
+	Last      time.Time           `json:"last"`
+	Paths     []RecordedPathCount `json:"paths"`
+}
+
+// RecordedPathCount : responses recorded for one request
+type RecordedPathCount struct {
+	Request string    `json:"request"`
+	Count   int       `json:"count"`
+	Last    time.Time `json:"last"`
+}
+
+// Summary the recorded requests and the time they span
+func (recording *Recording) Summary() RecordingSummary {
+	summary := RecordingSummary{Header: recording.Header, Requests: len(recording.responses), Paths: []RecordedPathCount{}}
+	for key, responses := range recording.responses {
+		summary.Responses += len(responses)
+		first, last := responses[0].Time, responses[len(responses)-1].Time
+		if summary.First.IsZero() || first.Before(summary.First) {
+			summary.First = first
+		}
+		if last.After(summary.Last) {
+			summary.Last = last
+		}
+		summary.Paths = append(summary.Paths, RecordedPathCount{Request: key, Count: len(responses), Last: last})
+	}
+	sort.Slice(summary.Paths, func(i, j int) bool { return summary.Paths[i].Request < summary.Paths[j].Request })
+	return summary
+}
+
+// Table one row per recorded request
+func (summary RecordingSummary) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"REQUEST", "RESPONSES", "LAST"}}
+	for _, path := range summary.Paths {
+		table.Rows = append(table.Rows, []Cell{{Text: path.Request}, {Text: format.Count(int64(path.Count))}, {Text: path.Last.Format(time.RFC3339)}})
+	}
+	return table
+}
+
+// Replay answer every management api request from the recording instead of
+// a broker. The connection is read only and has no amqp endpoint.
+func (rabbitmq *Rabbitmq) Replay(recording *Recording, det RabbitmqLoginDetails) error {
+	base, err := url.Parse(recording.Header.API)
+	if err != nil {
+		return err
+	}
+	rabbitmq.offline = true
+	rabbitmq.readOnly = true
+	rabbitmq.scope = ParseScope(det.Scope)
+	rabbitmq.restURL = base.String()
+	mgmtClient := NewManagementClient(base, nil)
+	mgmtClient.client.Transport = recording
+	mgmtClient.scope = rabbitmq.scope
+	mgmtClient.readOnly = true
+	rabbitmq.mu.Lock()
+	rabbitmq.mgmtClient = mgmtClient
+	rabbitmq.mu.Unlock()
+	return rabbitmq.UpdateBrokerInfo()
+}
+
+// fetcher the client polling the resources, the management client so
+// fetches honour the scope, read only mode and recordings and can time out
+func (rabbitmq *Rabbitmq) fetcher() brokerFetcher {
+	return rabbitmq.management()
+}
+
+func init() {
+	registerCommand("recording", "file: summarize a bundle of --record", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("recording")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("recording: expected a bundle file")
+		}
+		recording, err := LoadRecording(flags.Arg(0))
+		if err != nil {
+			return nil, usageError("recording: %s", err)
+		}
+		return recording.Summary(), nil
+	})
+}
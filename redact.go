@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// redaction rules
+const (
+	RedactNames    = "names"
+	RedactUsers    = "users"
+	RedactPayloads = "payloads"
+	RedactIPs      = "ips"
+)
+
+// redactedUser replaces user names
+const redactedUser = "redacted"
+
+var ipPattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b|(?i)(?:[0-9a-f]{1,4}:){7}[0-9a-f]{1,4}|(?:[0-9a-f]{1,4}:){1,6}:[0-9a-f]{0,4}\b`)
+
+// userKeys fields holding user names in every resource
+var userKeys = map[string]bool{"user": true, "username": true, "user_who_performed_action": true}
+
+// Redaction : what to remove from snapshots and recordings before they are
+// shared. Queue names and ips are replaced by salted hashes, so the same
+// object keeps the same replacement within the salt.
+type Redaction struct {
+	Names    bool
+	Users    bool
+	Payloads bool
+	IPs      bool
+	Salt     string
+}
+
+// ParseRedaction parse a comma separated list of names, users, payloads and
+// ips, or all. A random salt is used when salt is empty.
+func ParseRedaction(spec string, salt string) (Redaction, error) {
+	var redaction Redaction
+	for _, rule := range splitList(spec) {
+		switch rule {
+		case "all":
+			redaction.Names, redaction.Users, redaction.Payloads, redaction.IPs = true, true, true, true
+		case RedactNames:
+			redaction.Names = true
+		case RedactUsers:
+			redaction.Users = true
+		case RedactPayloads:
+			redaction.Payloads = true
+		case RedactIPs:
+			redaction.IPs = true
+		default:
+			return redaction, fmt.Errorf("unknown redaction %q, expected names, users, payloads, ips or all", rule)
+		}
+	}
+	redaction.Salt = salt
+	if redaction.Salt == "" {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return redaction, err
+		}
+		redaction.Salt = hex.EncodeToString(random)
+	}
+	return redaction, nil
+}
+
+// Enabled any rule is set
+func (redaction Redaction) Enabled() bool {
+	return redaction.Names || redaction.Users || redaction.Payloads || redaction.IPs
+}
+
+func (redaction Redaction) hash(prefix string, value string) string {
+	sum := sha256.Sum256([]byte(redaction.Salt + value))
+	return prefix + hex.EncodeToString(sum[:6])
+}
+
+// Queue the replacement of a queue name
+func (redaction Redaction) Queue(name string) string {
+	if !redaction.Names || name == "" {
+		return name
+	}
+	return redaction.hash("q-", name)
+}
+
+// Text mask the ips in s
+func (redaction Redaction) Text(s string) string {
+	if !redaction.IPs {
+		return s
+	}
+	return ipPattern.ReplaceAllStringFunc(s, func(ip string) string {
+		return redaction.hash("ip-", ip)
+	})
+}
+
+// queueKey replace the name of a vhost/name key
+func (redaction Redaction) queueKey(key string) string {
+	i := strings.LastIndex(key, "/")
+	return key[:i+1] + redaction.Queue(key[i+1:])
+}
+
+// value redact a decoded json value. resource is the resource class the
+// value belongs to, taken from the enclosing keys.
+func (redaction Redaction) value(value interface{}, resource string) interface{} {
+	switch value := value.(type) {
+	case string:
+		return redaction.Text(value)
+	case []interface{}:
+		for i := range value {
+			value[i] = redaction.value(value[i], resource)
+		}
+		return value
+	case map[string]interface{}:
+		return redaction.object(value, resource)
+	}
+	return value
+}
+
+// object redact the fields of a json object
+func (redaction Redaction) object(object map[string]interface{}, resource string) map[string]interface{} {
+	result := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		// broker info fields are capitalized
+		child := resource
+		switch strings.ToLower(key) {
+		case ResourceQueues, ResourceConsumers, ResourceBindings, ResourceConnections, "users", "permissions", "dangling":
+			child = strings.ToLower(key)
+		}
+		if redaction.Payloads && key == "payload" {
+			continue
+		}
+		if redaction.Users && key == "password_hash" {
+			continue
+		}
+		if s, ok := value.(string); ok {
+			value = redaction.field(object, resource, key, s)
+		} else if nested, ok := value.(map[string]interface{}); ok && child == ResourceQueues {
+			// rates keyed by vhost/name
+			keyed := make(map[string]interface{}, len(nested))
+			for id, v := range nested {
+				keyed[redaction.queueKey(id)] = redaction.value(v, child)
+			}
+			value = keyed
+		} else if key == "queue" {
+			value = redaction.value(value, ResourceQueues)
+		} else {
+			value = redaction.value(value, child)
+		}
+		result[redaction.Text(key)] = value
+	}
+	return result
+}
+
+// field redact the string field key of object
+func (redaction Redaction) field(object map[string]interface{}, resource string, key string, s string) string {
+	switch {
+	case redaction.Users && (userKeys[key] || (key == "name" && resource == "users")):
+		return redactedUser
+	case key == "queue":
+		return redaction.Queue(s)
+	case key == "name" && resource == ResourceQueues:
+		return redaction.Queue(s)
+	case key == "destination" && object["destination_type"] == "queue":
+		return redaction.Queue(s)
+	case (key == "routing_key" || key == "properties_key") && object["source"] == "" && object["destination_type"] == "queue":
+		// bindings of the default exchange are keyed by the queue name
+		return redaction.Queue(s)
+	case key == "missing" && resource == "dangling" && object["kind"] == ResourceQueues:
+		return redaction.Queue(s)
+	}
+	return redaction.Text(s)
+}
+
+// JSON redact a json document of the resource class, empty when unknown
+func (redaction Redaction) JSON(data []byte, resource string) ([]byte, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(redaction.value(value, resource))
+}
+
+// BrokerInfo redact a broker snapshot
+func (redaction Redaction) BrokerInfo(info rabtap.BrokerInfo) (rabtap.BrokerInfo, error) {
+	if !redaction.Enabled() {
+		return info, nil
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return info, err
+	}
+	if data, err = redaction.JSON(data, ""); err != nil {
+		return info, err
+	}
+	var redacted rabtap.BrokerInfo
+	err = json.Unmarshal(data, &redacted)
+	return redacted, err
+}
+
+// Path redact the names in a recorded api path like queues/%2F/orders
+func (redaction Redaction) Path(path string) string {
+	query := ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, query = path[:i], path[i:]
+	}
+	segments := strings.Split(path, "/")
+	replace := func(i int, redact func(string) string) {
+		if i < len(segments) {
+			name, err := url.PathUnescape(segments[i])
+			if err == nil {
+				segments[i] = url.PathEscape(redact(name))
+			}
+		}
+	}
+	switch segments[0] {
+	case ResourceQueues:
+		replace(2, redaction.Queue)
+	case ResourceBindings:
+		for i := range segments {
+			if segments[i] == "q" {
+				replace(i+1, redaction.Queue)
+			}
+		}
+	case "users":
+		if redaction.Users {
+			replace(1, func(string) string { return redactedUser })
+		}
+	case "permissions", "topic-permissions":
+		if redaction.Users {
+			replace(2, func(string) string { return redactedUser })
+		}
+	}
+	return redaction.Text(strings.Join(segments, "/")) + query
+}
+
+// response redact a recorded response
+func (redaction Redaction) response(response RecordedResponse) (RecordedResponse, error) {
+	resource := strings.SplitN(response.Path, "/", 2)[0]
+	response.Path = redaction.Path(response.Path)
+	if len(response.Body) == 0 {
+		return response, nil
+	}
+	body, err := redaction.JSON(response.Body, resource)
+	response.Body = body
+	return response, err
+}
+
+// RedactFile write a redacted copy of a recording bundle or a json
+// snapshot, returning the number of redacted documents
+func (redaction Redaction) RedactFile(in string, out string) (int, error) {
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		redacted, err := redaction.JSON(data, "")
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s", in, err)
+		}
+		return 1, ioutil.WriteFile(out, append(redacted, '\n'), 0600)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	writer := gzip.NewWriter(f)
+	enc := json.NewEncoder(writer)
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	count := 0
+	for first := true; scanner.Scan(); first = false {
+		if first {
+			var header RecordingHeader
+			if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version == 0 {
+				return 0, fmt.Errorf("%s: not a recording", in)
+			}
+			header.API = redaction.Text(header.API)
+			if err := enc.Encode(header); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		var response RecordedResponse
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			return count, fmt.Errorf("%s: %s", in, err)
+		}
+		if response, err = redaction.response(response); err != nil {
+			return count, fmt.Errorf("%s: %s: %s", in, response.Path, err)
+		}
+		if err := enc.Encode(response); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil && !strings.Contains(err.Error(), "unexpected EOF") {
+		return count, fmt.Errorf("%s: %s", in, err)
+	}
+	if err := writer.Close(); err != nil {
+		return count, err
+	}
+	return count, f.Close()
+}
+
+// RedactResult : a redacted copy
+type RedactResult struct {
+	File      string `json:"file"`
+	Documents int    `json:"documents"`
+}
+
+// Table the written file
+func (result RedactResult) Table(format NumberFormat) Table {
+	return Table{Headers: []string{"FILE", "DOCUMENTS"}, Rows: [][]Cell{{{Text: result.File}, {Text: format.Count(int64(result.Documents))}}}}
+}
+
+func init() {
+	registerCommand("redact", "[--rules r] [--salt s] <in> <out> write a redacted copy of a recording bundle or json snapshot", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("redact")
+		rules := flags.String("rules", "all", "names, users, payloads, ips or all")
+		salt := flags.String("salt", envOr("RADISH_REDACT_SALT", ""), "salt of the name and ip hashes, random by default")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 2 {
+			return nil, usageError("redact: expected an input and an output file")
+		}
+		redaction, err := ParseRedaction(*rules, *salt)
+		if err != nil {
+			return nil, usageError("redact: %s", err)
+		}
+		count, err := redaction.RedactFile(flags.Arg(0), flags.Arg(1))
+		if err != nil {
+			return nil, err
+		}
+		return RedactResult{File: flags.Arg(1), Documents: count}, nil
+	})
+}
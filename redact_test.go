@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactBrokerInfo(t *testing.T) {
+	redaction, err := ParseRedaction("all", "salt")
+	assert.Nil(t, err)
+	info := rabtap.BrokerInfo{
+		Queues:      []rabtap.RabbitQueue{{Vhost: "/", Name: "orders"}},
+		Connections: []rabtap.RabbitConnection{{Name: "10.0.0.7:51234 -> 10.0.0.1:5672", User: "billing", PeerHost: "10.0.0.7"}},
+		Bindings:    []rabtap.RabbitBinding{{Source: "", Destination: "orders", DestinationType: "queue", RoutingKey: "orders"}},
+	}
+	var consumer rabtap.RabbitConsumer
+	consumer.Queue.Name = "orders"
+	consumer.ChannelDetails.User = "billing"
+	info.Consumers = []rabtap.RabbitConsumer{consumer}
+
+	redacted, err := redaction.BrokerInfo(info)
+	assert.Nil(t, err)
+	hashed := redaction.Queue("orders")
+	assert.True(t, strings.HasPrefix(hashed, "q-"))
+	assert.Equal(t, hashed, redacted.Queues[0].Name)
+	assert.Equal(t, "/", redacted.Queues[0].Vhost)
+	assert.Equal(t, hashed, redacted.Bindings[0].Destination)
+	assert.Equal(t, hashed, redacted.Bindings[0].RoutingKey)
+	assert.Equal(t, hashed, redacted.Consumers[0].Queue.Name)
+	assert.Equal(t, redactedUser, redacted.Consumers[0].ChannelDetails.User)
+	assert.Equal(t, redactedUser, redacted.Connections[0].User)
+	assert.False(t, strings.Contains(redacted.Connections[0].Name, "10.0.0"))
+	assert.Equal(t, redaction.Text("10.0.0.7"), redacted.Connections[0].PeerHost)
+
+	data, _ := redaction.JSON([]byte(`{"payload":"secret","payload_bytes":6,"rates":{"queues":{"/vh/orders":{"publish":1}}}}`), "")
+	assert.Equal(t, `{"payload_bytes":6,"rates":{"queues":{"/vh/`+hashed+`":{"publish":1}}}}`, string(data))
+
+	names, _ := ParseRedaction("names", "salt")
+	same, _ := names.BrokerInfo(info)
+	assert.Equal(t, "billing", same.Connections[0].User)
+	assert.Equal(t, "queues/%2F/"+hashed+"/bindings", names.Path("queues/%2F/orders/bindings"))
+	assert.Equal(t, "users", redaction.Path("users"))
+	assert.Equal(t, "users/redacted", redaction.Path("users/billing"))
+
+	_, err = ParseRedaction("names,hostnames", "")
+	assert.NotNil(t, err)
+	random, _ := ParseRedaction("names", "")
+	assert.NotEqual(t, hashed, random.Queue("orders"))
+}
+
+func TestRedactRecording(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "redact")
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.gz"), filepath.Join(dir, "out.gz")
+	recorder, _ := NewRecorder(in)
+	api, _ := url.Parse("http://10.0.0.1:15672/api")
+	recorder.write(api, RecordedResponse{Time: time.Now(), Method: "GET", Path: "queues/%2F/orders", Status: 200, Body: json.RawMessage(`{"name":"orders","vhost":"/"}`)})
+	recorder.Close()
+
+	redaction, _ := ParseRedaction("names,ips", "salt")
+	count, err := redaction.RedactFile(in, out)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	recording, err := LoadRecording(out)
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(recording.Header.API, "10.0.0.1"))
+	response, ok := recording.Find("GET", "queues/%2F/"+redaction.Queue("orders"))
+	assert.True(t, ok)
+	assert.Equal(t, `{"name":"`+redaction.Queue("orders")+`","vhost":"/"}`, string(response.Body))
+
+	snapshot := filepath.Join(dir, "snapshot.json")
+	ioutil.WriteFile(snapshot, []byte(`{"info":{"Queues":[{"name":"orders"}]}}`), 0644)
+	count, err = redaction.RedactFile(snapshot, out)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	data, _ := ioutil.ReadFile(out)
+	assert.False(t, strings.Contains(string(data), "orders"))
+}
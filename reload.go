@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configCheckInterval how often daemon modes look for changed config files
+const configCheckInterval = 5 * time.Second
+
+// WatchConfig call reload when SIGHUP arrives or the modification time of
+// one of the files changes, until ctx is done. Files that do not exist yet
+// are picked up once they are created.
+func WatchConfig(ctx context.Context, files []string, interval time.Duration, reload func()) {
+	modified := func() map[string]time.Time {
+		times := map[string]time.Time{}
+		for _, file := range files {
+			if stat, err := os.Stat(file); err == nil {
+				times[file] = stat.ModTime()
+			}
+		}
+		return times
+	}
+	last := modified()
+	sigc := reloadSignals()
+	defer signal.Stop(sigc)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigc:
+			subsystemLog("config").Infof("received %s, reloading", sig)
+			last = modified()
+			reload()
+		case <-ticker.C:
+			times := modified()
+			changed := len(times) != len(last)
+			for file, t := range times {
+				changed = changed || !t.Equal(last[file])
+			}
+			last = times
+			if changed {
+				subsystemLog("config").Infof("configuration changed, reloading")
+				reload()
+			}
+		}
+	}
+}
+
+// AlertWebhook : url the changes of alerts are posted to as json
+type AlertWebhook struct {
+	URL string `yaml:"url" json:"url"`
+	// Severities posted, all when empty
+	Severities []string `yaml:"severities,omitempty" json:"severities,omitempty"`
+}
+
+// DaemonConfig : the serve settings that can change without a restart
+type DaemonConfig struct {
+	// Profile broker profile to poll, the connection flags when empty
+	Profile string `yaml:"profile,omitempty"`
+	// Interval and Poll override --interval and --poll
+	Interval time.Duration `yaml:"interval,omitempty"`
+	Poll     string        `yaml:"poll,omitempty"`
+	// Rules are evaluated in addition to the ones of --alert-rules
+	AlertRules `yaml:",inline"`
+	Webhooks   []AlertWebhook `yaml:"webhooks,omitempty"`
+	// Maintenance windows in addition to the ones of --maintenance
+	Maintenance []MaintenanceWindow `yaml:"maintenance,omitempty"`
+}
+
+// LoadDaemonConfig read and validate a serve config yaml file
+func LoadDaemonConfig(file string) (DaemonConfig, error) {
+	var config DaemonConfig
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %s", file, err)
+	}
+	for _, hook := range config.Webhooks {
+		if hook.URL == "" {
+			return config, fmt.Errorf("%s: webhook without url", file)
+		}
+	}
+	if err := config.AlertRules.compile(); err != nil {
+		return config, fmt.Errorf("%s: %s", file, err)
+	}
+	if err := (Maintenance{Windows: config.Maintenance}).compile(); err != nil {
+		return config, fmt.Errorf("%s: %s", file, err)
+	}
+	return config, nil
+}
+
+// DaemonSettings : the effective reloadable settings of serve
+type DaemonSettings struct {
+	Profile     string
+	Login       RabbitmqLoginDetails
+	Intervals   PollIntervals
+	Rules       AlertRules
+	Webhooks    []AlertWebhook
+	Maintenance Maintenance
+}
+
+// DaemonSources : where the daemon settings are read from
+type DaemonSources struct {
+	Login        RabbitmqLoginDetails
+	Profile      string
+	ProfilesFile string
+	Interval     time.Duration
+	Poll         string
+	RulesFile    string
+	ConfigFile   string
+	// MaintenanceFile of the maintenance command, windows started with it
+	// apply to a running serve
+	MaintenanceFile string
+}
+
+// Files the files whose changes trigger a reload
+func (sources DaemonSources) Files() []string {
+	var files []string
+	for _, file := range []string{sources.ConfigFile, sources.RulesFile, sources.MaintenanceFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	if sources.Profile != "" || sources.ConfigFile != "" {
+		files = append(files, sources.ProfilesFile)
+	}
+	return files
+}
+
+// Load read the settings, the config file takes precedence over the flags
+func (sources DaemonSources) Load() (DaemonSettings, error) {
+	var config DaemonConfig
+	if sources.ConfigFile != "" {
+		var err error
+		if config, err = LoadDaemonConfig(sources.ConfigFile); err != nil {
+			return DaemonSettings{}, err
+		}
+	}
+	settings := DaemonSettings{Profile: sources.Profile, Login: sources.Login, Webhooks: config.Webhooks}
+	interval, poll := sources.Interval, sources.Poll
+	if config.Interval > 0 {
+		interval = config.Interval
+	}
+	if config.Poll != "" {
+		poll = config.Poll
+	}
+	var err error
+	if settings.Intervals, err = ParsePollIntervals(poll, interval); err != nil {
+		return settings, err
+	}
+	if sources.RulesFile != "" {
+		if settings.Rules, err = LoadAlertRules(sources.RulesFile); err != nil {
+			return settings, err
+		}
+	}
+	settings.Rules.Rules = append(settings.Rules.Rules, config.Rules...)
+	if sources.MaintenanceFile != "" {
+		if settings.Maintenance, err = LoadMaintenance(sources.MaintenanceFile); err != nil {
+			return settings, err
+		}
+	}
+	settings.Maintenance.Windows = append(settings.Maintenance.Windows, config.Maintenance...)
+	if err := settings.Maintenance.compile(); err != nil {
+		return settings, err
+	}
+	if config.Profile != "" {
+		settings.Profile = config.Profile
+	}
+	if settings.Profile != "" {
+		profiles, err := LoadBrokerProfiles(sources.ProfilesFile)
+		if err != nil {
+			return settings, err
+		}
+		if settings.Login, err = profiles.Login(settings.Profile, sources.Login); err != nil {
+			return settings, err
+		}
+	}
+	return settings, nil
+}
+
+// AlertNotifier posts the changes of an alert engine to webhooks and the
+// registered notifiers, the webhooks can be replaced while it runs
+type AlertNotifier struct {
+	mutex    sync.Mutex
+	webhooks []AlertWebhook
+	client   *http.Client
+}
+
+// NewAlertNotifier create a notifier posting to webhooks
+func NewAlertNotifier(webhooks []AlertWebhook) *AlertNotifier {
+	return &AlertNotifier{webhooks: webhooks, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// SetWebhooks replace the webhooks, changes in flight go to the old ones
+func (notifier *AlertNotifier) SetWebhooks(webhooks []AlertWebhook) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	notifier.webhooks = webhooks
+}
+
+// Notify post the change to every webhook taking its severity and send it
+// to the registered notifiers
+func (notifier *AlertNotifier) Notify(change AlertChange) error {
+	notifier.mutex.Lock()
+	webhooks := notifier.webhooks
+	notifier.mutex.Unlock()
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, hook := range webhooks {
+		if len(hook.Severities) > 0 && !contains(hook.Severities, change.Alert.Severity) {
+			continue
+		}
+		res, err := notifier.client.Post(hook.URL, "application/json", bytes.NewReader(data))
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode >= 300 {
+				err = fmt.Errorf("%s: %s", hook.URL, res.Status)
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, channel := range registeredNotifiers() {
+		if err := channel.Notify(change); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Run post the fired and resolved alerts of engine until ctx is done
+func (notifier *AlertNotifier) Run(ctx context.Context, engine *AlertEngine) {
+	changes, cancel := engine.Changes.Subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v := <-changes:
+			change, ok := v.(AlertChange)
+			if !ok || (change.Type != "fired" && change.Type != "resolved") || change.Alert.Suppressed {
+				continue
+			}
+			if err := notifier.Notify(change); err != nil {
+				subsystemLog("alerts").Warnf("posting alert %s failed: %s", change.Alert.ID, err)
+			}
+		}
+	}
+}
+
+// Daemon : the parts of a running serve that take reloaded settings
+type Daemon struct {
+	Poller   *Poller
+	Alerts   *AlertEngine
+	Notifier *AlertNotifier
+	// Connect opens the broker of a changed profile
+	Connect  func(login RabbitmqLoginDetails) (brokerFetcher, error)
+	settings DaemonSettings
+}
+
+// NewDaemon a daemon started with settings
+func NewDaemon(poller *Poller, settings DaemonSettings) *Daemon {
+	return &Daemon{Poller: poller, settings: settings}
+}
+
+// Apply switch to the new settings and describe what changed. Connected
+// websocket clients, the snapshot and the stored history are kept, only a
+// changed broker starts with an empty snapshot.
+func (daemon *Daemon) Apply(settings DaemonSettings) ([]string, error) {
+	var changes []string
+	if settings.Login != daemon.settings.Login {
+		if daemon.Connect == nil {
+			return nil, fmt.Errorf("changing the broker needs a restart")
+		}
+		client, err := daemon.Connect(settings.Login)
+		if err != nil {
+			return nil, err
+		}
+		daemon.Poller.SetClient(client)
+		changes = append(changes, fmt.Sprintf("polling profile %s", orDash(settings.Profile)))
+	}
+	if settings.Intervals.String() != daemon.settings.Intervals.String() {
+		daemon.Poller.SetIntervals(settings.Intervals)
+		changes = append(changes, fmt.Sprintf("poll intervals %s", settings.Intervals))
+	}
+	if daemon.Alerts != nil && !alertRulesEqual(settings.Rules, daemon.settings.Rules) {
+		daemon.Alerts.SetRules(settings.Rules)
+		changes = append(changes, fmt.Sprintf("%d alert rules", len(settings.Rules.Rules)))
+	}
+	if daemon.Alerts != nil && !maintenanceEqual(settings.Maintenance, daemon.settings.Maintenance) {
+		daemon.Alerts.SetMaintenance(settings.Maintenance)
+		changes = append(changes, fmt.Sprintf("%d maintenance windows", len(settings.Maintenance.Windows)))
+	}
+	if daemon.Notifier != nil && !alertWebhooksEqual(settings.Webhooks, daemon.settings.Webhooks) {
+		daemon.Notifier.SetWebhooks(settings.Webhooks)
+		changes = append(changes, fmt.Sprintf("%d alert webhooks", len(settings.Webhooks)))
+	}
+	daemon.settings = settings
+	return changes, nil
+}
+
+// Reload load the settings from sources and apply them, the running
+// settings are kept when they are invalid
+func (daemon *Daemon) Reload(sources DaemonSources) {
+	logger := subsystemLog("config")
+	settings, err := sources.Load()
+	if err == nil {
+		var changes []string
+		if changes, err = daemon.Apply(settings); err == nil {
+			if len(changes) == 0 {
+				logger.Infof("configuration unchanged")
+			}
+			for _, change := range changes {
+				logger.Infof("applied %s", change)
+			}
+			return
+		}
+	}
+	logger.Errorf("reload failed, keeping the running configuration: %s", err)
+}
+
+// alertRulesEqual the rule lists are the same
+func alertRulesEqual(a AlertRules, b AlertRules) bool {
+	if len(a.Rules) != len(b.Rules) {
+		return false
+	}
+	for i := range a.Rules {
+		x, y := a.Rules[i], b.Rules[i]
+		if x.Name != y.Name || x.Resource != y.Resource || x.Filter != y.Filter || x.Expr != y.Expr || x.Severity != y.Severity || x.Summary != y.Summary {
+			return false
+		}
+	}
+	return true
+}
+
+// alertWebhooksEqual the webhook lists are the same
+func alertWebhooksEqual(a []AlertWebhook, b []AlertWebhook) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+// maintenanceEqual the windows are the same
+func maintenanceEqual(a Maintenance, b Maintenance) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDaemonReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "reload")
+	defer os.RemoveAll(dir)
+	profilesFile := filepath.Join(dir, "profiles.yml")
+	configFile := filepath.Join(dir, "serve.yml")
+	ioutil.WriteFile(profilesFile, []byte("profiles:\n  prod:\n    host: rabbit.prod\n    user: ops\n  staging:\n    managementUrl: http://rabbit.staging:15672\n    readOnly: true\n"), 0644)
+	ioutil.WriteFile(configFile, []byte("profile: prod\ninterval: 30s\n"), 0644)
+
+	sources := DaemonSources{
+		Login:        RabbitmqLoginDetails{Host: "127.0.0.1", Port: "5672", Username: "guest", Password: "secret"},
+		ProfilesFile: profilesFile,
+		Interval:     10 * time.Second,
+		ConfigFile:   configFile,
+	}
+	settings, err := sources.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, "rabbit.prod", settings.Login.Host)
+	assert.Equal(t, "ops", settings.Login.Username)
+	assert.Equal(t, "secret", settings.Login.Password)
+	assert.Equal(t, 30*time.Second, settings.Intervals.Interval(ResourceQueues))
+	assert.Equal(t, []string{configFile, profilesFile}, sources.Files())
+
+	first, second := &fakeFetcher{}, &fakeFetcher{}
+	poller := newPoller(first, settings.Intervals)
+	assert.Nil(t, poller.Poll())
+	daemon := NewDaemon(poller, settings)
+	daemon.Alerts = NewAlertEngine(settings.Rules, nil)
+	daemon.Notifier = NewAlertNotifier(nil)
+	var connected RabbitmqLoginDetails
+	daemon.Connect = func(login RabbitmqLoginDetails) (brokerFetcher, error) {
+		connected = login
+		return second, nil
+	}
+
+	ioutil.WriteFile(configFile, []byte("profile: staging\npoll: queues=5s\nrules:\n- name: backlog\n  resource: queues\n  filter: messages>10\nwebhooks:\n- url: http://hooks.example.com\n"), 0644)
+	settings, err = sources.Load()
+	assert.Nil(t, err)
+	changes, err := daemon.Apply(settings)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"polling profile staging", "poll intervals " + settings.Intervals.String(), "1 alert rules", "1 alert webhooks"}, changes)
+	assert.Equal(t, "http://rabbit.staging:15672", connected.ManagementURL)
+	assert.True(t, connected.ReadOnly)
+	assert.Equal(t, 5*time.Second, poller.Intervals().Interval(ResourceQueues))
+	assert.Nil(t, poller.Snapshot())
+	assert.Nil(t, <-poller.refresh)
+
+	changes, err = daemon.Apply(settings)
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+
+	ioutil.WriteFile(configFile, []byte("rules:\n- name: broken\n  resource: channels\n"), 0644)
+	_, err = sources.Load()
+	assert.NotNil(t, err)
+}
+
+func TestAlertNotifier(t *testing.T) {
+	posted := make(chan AlertChange, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var change AlertChange
+		json.NewDecoder(r.Body).Decode(&change)
+		posted <- change
+	}))
+	defer hook.Close()
+
+	notifier := NewAlertNotifier([]AlertWebhook{{URL: hook.URL, Severities: []string{SeverityCritical}}})
+	assert.Nil(t, notifier.Notify(AlertChange{Type: "fired", Alert: Alert{ID: "a", Severity: SeverityWarning}}))
+	assert.Nil(t, notifier.Notify(AlertChange{Type: "fired", Alert: Alert{ID: "b", Severity: SeverityCritical}}))
+	assert.Equal(t, "b", (<-posted).Alert.ID)
+	assert.Len(t, posted, 0)
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	notifier.SetWebhooks([]AlertWebhook{{URL: missing.URL}})
+	assert.NotNil(t, notifier.Notify(AlertChange{Type: "resolved", Alert: Alert{ID: "b"}}))
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "watch")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "serve.yml")
+
+	reloads := make(chan bool, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchConfig(ctx, []string{file}, 10*time.Millisecond, func() { reloads <- true })
+	time.Sleep(30 * time.Millisecond)
+	ioutil.WriteFile(file, []byte("interval: 5s\n"), 0644)
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		t.Fatal("no reload after the file was created")
+	}
+}
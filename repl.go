@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+const replHistorySize = 500
+
+// REPL : interactive shell sharing one broker connection between commands
+type REPL struct {
+	cli     *CLI
+	vhost   string
+	kind    string
+	name    string
+	history []string
+}
+
+func replHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".radish_history")
+}
+
+func (repl *REPL) loadHistory() {
+	data, err := ioutil.ReadFile(replHistoryPath())
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			repl.history = append(repl.history, line)
+		}
+	}
+}
+
+func (repl *REPL) saveHistory() {
+	if len(repl.history) > replHistorySize {
+		repl.history = repl.history[len(repl.history)-replHistorySize:]
+	}
+	if path := replHistoryPath(); path != "" {
+		ioutil.WriteFile(path, []byte(strings.Join(repl.history, "\n")+"\n"), 0600)
+	}
+}
+
+func (repl *REPL) prompt() string {
+	p := "radish " + repl.vhost
+	if repl.kind != "" {
+		p += " " + repl.kind + ":" + repl.name
+	}
+	return p + "> "
+}
+
+// ls list the objects in the current context
+func (repl *REPL) ls(info *rabtap.BrokerInfo) {
+	out := repl.cli.out
+	switch repl.kind {
+	case "exchange":
+		for _, binding := range info.Bindings {
+			if binding.Vhost == repl.vhost && binding.Source == repl.name {
+				fmt.Fprintf(out, "%s %s  [%s]\n", binding.DestinationType, binding.Destination, binding.RoutingKey)
+			}
+		}
+	case "queue":
+		for _, consumer := range FindQueueConsumers(info, QueueRef{Vhost: repl.vhost, Queue: repl.name}) {
+			fmt.Fprintf(out, "%s  %s  %s\n", consumer.ConsumerTag, consumer.ConnectionName, consumer.User)
+		}
+	default:
+		for _, exchange := range info.Exchanges {
+			if exchange.Vhost == repl.vhost && exchange.Name != "" {
+				fmt.Fprintf(out, "exchange %s (%s)\n", exchange.Name, exchange.Type)
+			}
+		}
+		for _, queue := range info.Queues {
+			if queue.Vhost == repl.vhost {
+				fmt.Fprintf(out, "queue    %s (%d messages)\n", queue.Name, queue.Messages)
+			}
+		}
+	}
+}
+
+// info show the selected object or the broker overview
+func (repl *REPL) info(info *rabtap.BrokerInfo) {
+	var result interface{} = info.Overview
+	switch repl.kind {
+	case "exchange":
+		for _, exchange := range info.Exchanges {
+			if exchange.Vhost == repl.vhost && exchange.Name == repl.name {
+				result = exchange
+			}
+		}
+	case "queue":
+		for _, queue := range info.Queues {
+			if queue.Vhost == repl.vhost && queue.Name == repl.name {
+				result = queue
+			}
+		}
+	}
+	repl.cli.printResult("info", result, nil)
+}
+
+// exec run a single line, returns false when the shell should exit
+func (repl *REPL) exec(line string) bool {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return true
+	}
+	switch words[0] {
+	case "exit", "quit":
+		return false
+	case "help":
+		fmt.Fprintln(repl.cli.out, "use vhost <name>, cd <exchange|queue> <name>, cd .., ls, info, refresh, history, exit")
+		fmt.Fprintln(repl.cli.out, cliUsage())
+	case "history":
+		for i, entry := range repl.history {
+			fmt.Fprintf(repl.cli.out, "%4d  %s\n", i+1, entry)
+		}
+	case "use":
+		if len(words) != 3 || words[1] != "vhost" {
+			fmt.Fprintln(repl.cli.out, "usage: use vhost <name>")
+			break
+		}
+		repl.vhost, repl.kind, repl.name = ResolveVhost(words[2], ""), "", ""
+	case "cd":
+		if len(words) == 2 && words[1] == ".." {
+			repl.kind, repl.name = "", ""
+		} else if len(words) == 3 && (words[1] == "exchange" || words[1] == "queue") {
+			repl.kind, repl.name = words[1], words[2]
+		} else {
+			fmt.Fprintln(repl.cli.out, "usage: cd <exchange|queue> <name> | cd ..")
+		}
+	case "ls", "info", "refresh":
+		rabbitmq, err := repl.cli.connect()
+		if err != nil {
+			repl.cli.printResult(words[0], nil, err)
+			break
+		}
+		switch words[0] {
+		case "ls":
+			info := rabbitmq.info()
+			repl.ls(&info)
+		case "info":
+			info := rabbitmq.info()
+			repl.info(&info)
+		case "refresh":
+			if err := rabbitmq.UpdateBrokerInfo(); err != nil {
+				repl.cli.printResult("refresh", nil, err)
+			}
+		}
+	default:
+		command, ok := cliCommands[words[0]]
+		if !ok {
+			fmt.Fprintf(repl.cli.out, "unknown command %s, try help\n", words[0])
+			break
+		}
+		// commands run without --vhost address the vhost in use
+		defaultVhost := repl.cli.login.DefaultVhost
+		repl.cli.login.DefaultVhost = repl.vhost
+		result, err := command.run(repl.cli, words[1:])
+		repl.cli.login.DefaultVhost = defaultVhost
+		repl.cli.printResult(words[0], result, err)
+	}
+	return true
+}
+
+// Run read and execute lines from the editor until exit or end of input
+func (repl *REPL) Run(editor *LineEditor) {
+	repl.loadHistory()
+	defer repl.saveHistory()
+	for {
+		line, err := editor.ReadLine(repl.prompt(), repl.history)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(repl.cli.out, err)
+			}
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if n := len(repl.history); n == 0 || repl.history[n-1] != line {
+			repl.history = append(repl.history, line)
+		}
+		if !repl.exec(line) {
+			return
+		}
+	}
+}
+
+func init() {
+	registerCommand("shell", "interactive shell", func(cli *CLI, args []string) (interface{}, error) {
+		if _, err := cli.connect(); err != nil {
+			return nil, err
+		}
+		repl := &REPL{cli: cli, vhost: cli.vhost("")}
+		repl.Run(NewLineEditor(os.Stdin, cli.out, int(os.Stdin.Fd())))
+		return nil, nil
+	})
+}
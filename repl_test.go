@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestREPLUseVhost(t *testing.T) {
+	var seen []string
+	registerCommand("test-vhost", "", func(cli *CLI, args []string) (interface{}, error) {
+		seen = append(seen, cli.vhost(""))
+		return nil, nil
+	})
+	defer delete(cliCommands, "test-vhost")
+
+	var out bytes.Buffer
+	cli := &CLI{out: &out, login: RabbitmqLoginDetails{DefaultVhost: "flags"}}
+	repl := &REPL{cli: cli, vhost: cli.vhost("")}
+	assert.Equal(t, "radish flags> ", repl.prompt())
+	repl.exec("test-vhost")
+	assert.True(t, repl.exec("use vhost %2F"))
+	assert.Equal(t, "radish /> ", repl.prompt())
+	repl.exec("test-vhost")
+	repl.exec("use vhost billing")
+	repl.exec("cd queue orders")
+	assert.Equal(t, "radish billing queue:orders> ", repl.prompt())
+	repl.exec("test-vhost")
+	assert.Equal(t, []string{"flags", "/", "billing"}, seen)
+	assert.Equal(t, "flags", cli.login.DefaultVhost)
+	assert.False(t, repl.exec("exit"))
+}
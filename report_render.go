@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// chartBars bars drawn by the inline charts of a table
+const chartBars = 10
+
+// reportStyle css of standalone html documents, kept small so pasted
+// documents look the same in wikis
+const reportStyle = `body{font-family:sans-serif;margin:2em;color:#222}` +
+	`table{border-collapse:collapse;margin:1em 0}th,td{border:1px solid #ccc;padding:.2em .6em;text-align:left}` +
+	`th{background:#f4f4f4}svg{display:block;margin:.5em 0}`
+
+// ReportChart : values of one numeric column of a table, by row label
+type ReportChart struct {
+	Title  string
+	Labels []string
+	Values []float64
+}
+
+// chartOf the largest values of the first numeric column of a table, rows
+// are labeled by their NAME or first text column. Tables without numbers,
+// with a single row or only zeros have no chart.
+func chartOf(table Table) (ReportChart, bool) {
+	if len(table.Rows) < 2 {
+		return ReportChart{}, false
+	}
+	numeric := func(col int) bool {
+		positive := false
+		for _, row := range table.Rows {
+			if col >= len(row) || row[col].Text == "-" || row[col].Text == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(row[col].Text, 64)
+			if err != nil {
+				return false
+			}
+			positive = positive || value > 0
+		}
+		return positive
+	}
+	label, value := -1, -1
+	for col, header := range table.Headers {
+		switch {
+		case header == "NAME":
+			label = col
+		case value < 0 && numeric(col):
+			value = col
+		}
+	}
+	if value < 0 {
+		return ReportChart{}, false
+	}
+	if label < 0 {
+		for col := range table.Headers {
+			if col != value && !numeric(col) {
+				label = col
+				break
+			}
+		}
+	}
+	chart := ReportChart{Title: table.Headers[value]}
+	for _, row := range table.Rows {
+		if value >= len(row) {
+			continue
+		}
+		v, err := strconv.ParseFloat(row[value].Text, 64)
+		if err != nil {
+			continue
+		}
+		name := "-"
+		if label >= 0 && label < len(row) {
+			name = row[label].Text
+		}
+		chart.Labels = append(chart.Labels, name)
+		chart.Values = append(chart.Values, v)
+	}
+	order := make([]int, len(chart.Values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return chart.Values[order[i]] > chart.Values[order[j]] })
+	if len(order) > chartBars {
+		order = order[:chartBars]
+	}
+	sorted := ReportChart{Title: chart.Title}
+	for _, i := range order {
+		sorted.Labels = append(sorted.Labels, chart.Labels[i])
+		sorted.Values = append(sorted.Values, chart.Values[i])
+	}
+	return sorted, true
+}
+
+// max largest value of the chart
+func (chart ReportChart) max() float64 {
+	max := 0.0
+	for _, v := range chart.Values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// WriteSVG draw the chart as small horizontal bar chart
+func (chart ReportChart) WriteSVG(w io.Writer) error {
+	const width, barHeight, labelWidth = 480, 16, 160
+	max := chart.max()
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-size=\"11\" role=\"img\"><title>%s</title>\n",
+		width, len(chart.Values)*barHeight+4, html.EscapeString(chart.Title))
+	for i, v := range chart.Values {
+		bar := 0.0
+		if max > 0 {
+			bar = v / max * (width - labelWidth - 60)
+		}
+		y := i*barHeight + 2
+		fmt.Fprintf(&b, "<text x=\"0\" y=\"%d\">%s</text>", y+11, html.EscapeString(truncate(chart.Labels[i], 26, TableOptions{Ellipsis: "…"})))
+		fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%.1f\" height=\"%d\" fill=\"#5c7cfa\"/>", labelWidth, y, bar, barHeight-4)
+		fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%d\">%s</text>\n", float64(labelWidth)+bar+4, y+11, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteText draw the chart with block characters, for markdown documents
+func (chart ReportChart) WriteText(w io.Writer) error {
+	const width = 30
+	max := chart.max()
+	labelWidth := 0
+	for _, label := range chart.Labels {
+		if n := len([]rune(label)); n > labelWidth {
+			labelWidth = n
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "```\n%s\n", chart.Title)
+	for i, v := range chart.Values {
+		bar := 0
+		if max > 0 {
+			bar = int(v / max * width)
+		}
+		if bar == 0 && v > 0 {
+			bar = 1
+		}
+		label := chart.Labels[i] + strings.Repeat(" ", labelWidth-len([]rune(chart.Labels[i])))
+		fmt.Fprintf(&b, "%s  %s %s\n", label, strings.Repeat("█", bar), strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	b.WriteString("```\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMarkdownResult a tabular result as markdown table with a text chart,
+// other results as json block
+func writeMarkdownResult(w io.Writer, result interface{}, numbers NumberFormat) {
+	tabular, ok := result.(Tabular)
+	if !ok {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintf(w, "```json\n%s\n```\n", data)
+		return
+	}
+	if chart, ok := chartOf(tabular.Table(NumberFormat{Raw: true})); ok {
+		chart.WriteText(w)
+		fmt.Fprintln(w)
+	}
+	tabular.Table(numbers).WriteMarkdown(w)
+}
+
+// writeHTMLResult a tabular result as html table with a svg chart, other
+// results as preformatted json
+func writeHTMLResult(w io.Writer, result interface{}, numbers NumberFormat) {
+	tabular, ok := result.(Tabular)
+	if !ok {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintf(w, "<pre>%s</pre>\n", html.EscapeString(string(data)))
+		return
+	}
+	if chart, ok := chartOf(tabular.Table(NumberFormat{Raw: true})); ok {
+		chart.WriteSVG(w)
+	}
+	tabular.Table(numbers).WriteHTML(w)
+}
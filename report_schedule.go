@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SMTPConfig : mail server the reports are sent through
+type SMTPConfig struct {
+	// Addr host:port of the server
+	Addr     string `yaml:"addr"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username,omitempty"`
+	// Password defaults to $RADISH_SMTP_PASSWORD
+	Password string `yaml:"password,omitempty"`
+}
+
+// ScheduledReport : sections rendered and delivered on a cron schedule
+type ScheduledReport struct {
+	Name string `yaml:"name"`
+	// Schedule cron expression or @daily, @weekly, ...
+	Schedule string   `yaml:"schedule"`
+	Sections []string `yaml:"sections"`
+	// Format markdown or html, defaults to html
+	Format string `yaml:"format,omitempty"`
+	// Email recipients of the report as attachment
+	Email []string `yaml:"email,omitempty"`
+	// Webhook url the report is posted to as json
+	Webhook  string `yaml:"webhook,omitempty"`
+	schedule CronSchedule
+}
+
+// ReportSchedule : the reports file of the reports command
+type ReportSchedule struct {
+	SMTP    SMTPConfig        `yaml:"smtp"`
+	Reports []ScheduledReport `yaml:"reports"`
+	// Store of serve --store, the deploy and incident markers of the last
+	// Markers (default 24h) are listed at the top of every report
+	Store   string        `yaml:"store,omitempty"`
+	Markers time.Duration `yaml:"markers,omitempty"`
+}
+
+// LoadReportSchedule read and validate a reports yaml file
+func LoadReportSchedule(file string) (ReportSchedule, error) {
+	var schedule ReportSchedule
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return schedule, err
+	}
+	if err := yaml.Unmarshal(data, &schedule); err != nil {
+		return schedule, fmt.Errorf("%s: %s", file, err)
+	}
+	if schedule.SMTP.Password == "" {
+		schedule.SMTP.Password = envOr("RADISH_SMTP_PASSWORD", "")
+	}
+	if schedule.Markers == 0 {
+		schedule.Markers = 24 * time.Hour
+	}
+	return schedule, schedule.compile()
+}
+
+// compile parse the schedules and check sections and destinations
+func (schedule ReportSchedule) compile() error {
+	for i := range schedule.Reports {
+		report := &schedule.Reports[i]
+		if report.Name == "" {
+			return fmt.Errorf("report %d has no name", i+1)
+		}
+		var err error
+		if report.schedule, err = ParseCronSchedule(report.Schedule); err != nil {
+			return fmt.Errorf("report %s: %s", report.Name, err)
+		}
+		if report.Format == "" {
+			report.Format = ReportHTML
+		}
+		if report.Format != ReportHTML && report.Format != ReportMarkdown {
+			return fmt.Errorf("report %s: unknown format %q", report.Name, report.Format)
+		}
+		if len(report.Sections) == 0 {
+			return fmt.Errorf("report %s has no sections", report.Name)
+		}
+		for _, section := range report.Sections {
+			if _, ok := findReportSection(section); !ok {
+				return fmt.Errorf("report %s: unknown section %q, expected one of %s", report.Name, section, strings.Join(reportSectionNames(), ", "))
+			}
+		}
+		if len(report.Email) == 0 && report.Webhook == "" {
+			return fmt.Errorf("report %s has neither email recipients nor a webhook", report.Name)
+		}
+		if len(report.Email) > 0 && (schedule.SMTP.Addr == "" || schedule.SMTP.From == "") {
+			return fmt.Errorf("report %s: email needs smtp addr and from", report.Name)
+		}
+	}
+	return nil
+}
+
+// Find the report with the given name
+func (schedule ReportSchedule) Find(name string) (ScheduledReport, bool) {
+	for _, report := range schedule.Reports {
+		if report.Name == name {
+			return report, true
+		}
+	}
+	return ScheduledReport{}, false
+}
+
+// reportFilename attachment name of a report generated at now
+func reportFilename(name string, format string, now time.Time) string {
+	_, ext := reportContentType(format)
+	return fmt.Sprintf("%s-%s%s", name, now.Format("2006-01-02"), ext)
+}
+
+// reportMail a multipart message with a short text and the report attached
+func reportMail(from string, to []string, subject string, filename string, format string, content []byte) []byte {
+	boundary := make([]byte, 12)
+	rand.Read(boundary)
+	mark := "radish-" + hex.EncodeToString(boundary)
+	contentType, _ := reportContentType(format)
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", from, strings.Join(to, ", "), mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\nMIME-Version: 1.0\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mark)
+	fmt.Fprintf(&msg, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s, see the attached %s.\r\n", mark, subject, filename)
+	fmt.Fprintf(&msg, "--%s\r\nContent-Type: %s\r\nContent-Transfer-Encoding: base64\r\n", mark, contentType)
+	fmt.Fprintf(&msg, "Content-Disposition: attachment; filename=%q\r\n\r\n", filename)
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	fmt.Fprintf(&msg, "--%s--\r\n", mark)
+	return msg.Bytes()
+}
+
+// sendMail deliver msg through the smtp server, with plain auth when a
+// user name is configured
+func (config SMTPConfig) sendMail(to []string, msg []byte) error {
+	var auth smtp.Auth
+	if config.Username != "" {
+		host, _, err := net.SplitHostPort(config.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return smtp.SendMail(config.Addr, auth, config.From, to, msg)
+}
+
+// ReportWebhook : body posted to the webhook of a report
+type ReportWebhook struct {
+	Report    string    `json:"report"`
+	Cluster   string    `json:"cluster"`
+	Generated time.Time `json:"generated"`
+	Format    string    `json:"format"`
+	Filename  string    `json:"filename"`
+	Content   string    `json:"content"`
+}
+
+var reportClient = &http.Client{Timeout: 30 * time.Second}
+
+// postReport post the rendered report as json
+func postReport(url string, body ReportWebhook) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	res, err := reportClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("report webhook failed: %s", res.Status)
+	}
+	return nil
+}
+
+// ReportDelivery : where a report went
+type ReportDelivery struct {
+	Report    string    `json:"report"`
+	Generated time.Time `json:"generated"`
+	Email     []string  `json:"email,omitempty"`
+	Webhook   string    `json:"webhook,omitempty"`
+}
+
+// Build generate the sections of report from info, annotated with the
+// markers of the store
+func (schedule ReportSchedule) Build(report ScheduledReport, info rabtap.BrokerInfo, now time.Time) (Report, error) {
+	built, err := BuildReport(report.Name, report.Sections, info, now)
+	if err != nil || schedule.Store == "" {
+		return built, err
+	}
+	store, err := OpenKVStore(schedule.Store)
+	if err != nil {
+		return built, err
+	}
+	defer store.Close()
+	markers, err := Markers(store, now.Add(-schedule.Markers), now)
+	if err != nil {
+		return built, err
+	}
+	built.Annotate(markers)
+	return built, nil
+}
+
+// Deliver render the report from info and send it to the recipients and
+// the webhook
+func (schedule ReportSchedule) Deliver(report ScheduledReport, info rabtap.BrokerInfo, now time.Time) (ReportDelivery, error) {
+	delivery := ReportDelivery{Report: report.Name, Generated: now}
+	built, err := schedule.Build(report, info, now)
+	if err != nil {
+		return delivery, err
+	}
+	content, err := built.Render(report.Format, NumberFormat{})
+	if err != nil {
+		return delivery, err
+	}
+	filename := reportFilename(report.Name, report.Format, now)
+	if len(report.Email) > 0 {
+		subject := fmt.Sprintf("radish report %s of %s", report.Name, orDash(built.Cluster))
+		if err := schedule.SMTP.sendMail(report.Email, reportMail(schedule.SMTP.From, report.Email, subject, filename, report.Format, content)); err != nil {
+			return delivery, fmt.Errorf("mailing report %s: %s", report.Name, err)
+		}
+		delivery.Email = report.Email
+	}
+	if report.Webhook != "" {
+		body := ReportWebhook{Report: report.Name, Cluster: built.Cluster, Generated: now, Format: report.Format, Filename: filename, Content: string(content)}
+		if err := postReport(report.Webhook, body); err != nil {
+			return delivery, fmt.Errorf("posting report %s: %s", report.Name, err)
+		}
+		delivery.Webhook = report.Webhook
+	}
+	return delivery, nil
+}
+
+// RunReports deliver every report in the minutes its schedule fires until
+// ctx is done. The broker info is refreshed before each round, schedules
+// received from reloads replace the running one.
+func RunReports(ctx context.Context, rabbitmq *Rabbitmq, schedule ReportSchedule, reloads <-chan ReportSchedule) {
+	logger := subsystemLog("reports")
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-ctx.Done():
+			return
+		case schedule = <-reloads:
+			logger.Infof("scheduling %d reports", len(schedule.Reports))
+			continue
+		case <-time.After(next.Sub(now)):
+		}
+		var due []ScheduledReport
+		for _, report := range schedule.Reports {
+			if report.schedule.Matches(next) {
+				due = append(due, report)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+		if err := rabbitmq.UpdateBrokerInfoContext(ctx); err != nil {
+			logger.Warnf("fetching broker info failed, %d reports skipped: %s", len(due), err)
+			continue
+		}
+		for _, report := range due {
+			if _, err := schedule.Deliver(report, rabbitmq.info(), next); err != nil {
+				logger.Errorf("%s", err)
+			} else {
+				logger.Infof("report %s delivered", report.Name)
+			}
+		}
+	}
+}
+
+func init() {
+	registerCommand("reports", "--config f [--run name] [--print name] deliver health, orphans, top-queues and posture reports on cron schedules", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("reports")
+		config := flags.String("config", envOr("RADISH_REPORTS", ""), "reports yaml file")
+		run := flags.String("run", "", "deliver this report now and exit")
+		printName := flags.String("print", "", "print this report rendered instead of delivering it")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if *config == "" {
+			return nil, usageError("reports: expected --config")
+		}
+		schedule, err := LoadReportSchedule(*config)
+		if err != nil {
+			return nil, usageError("reports: %s", err)
+		}
+		name := *run
+		if *printName != "" {
+			name = *printName
+		}
+		report, found := schedule.Find(name)
+		if name != "" && !found {
+			return nil, usageError("reports: no report %q in %s", name, *config)
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		if *printName != "" {
+			built, err := schedule.Build(report, rabbitmq.info(), time.Now())
+			if err != nil {
+				return nil, err
+			}
+			content, err := built.Render(report.Format, NumberFormat{})
+			if err != nil {
+				return nil, err
+			}
+			cli.out.Write(content)
+			return nil, nil
+		}
+		if *run != "" {
+			return schedule.Deliver(report, rabbitmq.info(), time.Now())
+		}
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		subsystemLog("reports").Infof("scheduling %d reports", len(schedule.Reports))
+		reloads := make(chan ReportSchedule, 1)
+		go WatchConfig(ctx, []string{*config}, configCheckInterval, func() {
+			reloaded, err := LoadReportSchedule(*config)
+			if err != nil {
+				subsystemLog("config").Errorf("reload failed, keeping the running reports: %s", err)
+				return
+			}
+			select {
+			case reloads <- reloaded:
+			case <-ctx.Done():
+			}
+		})
+		RunReports(ctx, rabbitmq, schedule, reloads)
+		return nil, nil
+	})
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// report formats
+const (
+	ReportMarkdown = "markdown"
+	ReportHTML     = "html"
+)
+
+// topQueuesLimit queues listed by the top-queues section
+const topQueuesLimit = 10
+
+// HealthDeduction : points a health score lost for one reason
+type HealthDeduction struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+	Points int    `json:"points"`
+}
+
+// HealthScore : 100 for a healthy broker, less for every problem found
+type HealthScore struct {
+	Score      int               `json:"score"`
+	Deductions []HealthDeduction `json:"deductions"`
+}
+
+// ScoreHealth rate the broker: queues without consumers, queues over the
+// message threshold, blocked connections, orphaned objects and severe
+// posture findings cost points, each reason at most 25
+func ScoreHealth(info rabtap.BrokerInfo) HealthScore {
+	score := HealthScore{Score: 100, Deductions: []HealthDeduction{}}
+	deduct := func(reason string, count int, each int) {
+		if count == 0 {
+			return
+		}
+		points := count * each
+		if points > 25 {
+			points = 25
+		}
+		score.Score -= points
+		score.Deductions = append(score.Deductions, HealthDeduction{Reason: reason, Count: count, Points: points})
+	}
+	unconsumed, full := 0, 0
+	for _, queue := range info.Queues {
+		if queue.Messages > 0 && queue.Consumers == 0 {
+			unconsumed++
+		}
+		if queue.Messages > defaultMaxMessages {
+			full++
+		}
+	}
+	blocked := 0
+	for _, conn := range info.Connections {
+		if conn.State == "blocked" || conn.State == "blocking" {
+			blocked++
+		}
+	}
+	deduct("queues with messages and no consumers", unconsumed, 2)
+	deduct(fmt.Sprintf("queues with more than %d messages", defaultMaxMessages), full, 5)
+	deduct("blocked connections", blocked, 5)
+	deduct("orphaned exchanges and queues", len(FindOrphans(info)), 1)
+	deduct("high or critical posture findings", PostureReport(AssessPosture(info)).AtLeast("high"), 5)
+	if score.Score < 0 {
+		score.Score = 0
+	}
+	return score
+}
+
+// Table score and deductions as table
+func (score HealthScore) Table(format NumberFormat) Table {
+	color := Green
+	switch {
+	case score.Score < 50:
+		color = Red
+	case score.Score < 80:
+		color = Yellow
+	}
+	table := Table{Headers: []string{"REASON", "COUNT", "POINTS"}}
+	table.Rows = append(table.Rows, []Cell{{Text: "score"}, {Text: "-"}, {Text: fmt.Sprint(score.Score), Color: color}})
+	for _, deduction := range score.Deductions {
+		table.Rows = append(table.Rows, []Cell{
+			{Text: deduction.Reason},
+			{Text: format.Count(int64(deduction.Count))},
+			{Text: fmt.Sprintf("-%d", deduction.Points)},
+		})
+	}
+	return table
+}
+
+// OrphanedObject : an exchange routing nowhere or a queue nothing routes
+// to and nobody consumes
+type OrphanedObject struct {
+	Kind     string `json:"kind"`
+	Vhost    string `json:"vhost"`
+	Name     string `json:"name"`
+	Messages int    `json:"messages"`
+}
+
+// OrphanList : orphaned objects ordered by vhost, kind and name
+type OrphanList []OrphanedObject
+
+// FindOrphans exchanges without bindings to anything and queues without
+// consumers that are bound to no exchange but the default one. Default and
+// amq.* exchanges are never orphans.
+func FindOrphans(info rabtap.BrokerInfo) OrphanList {
+	sources, bound := map[string]bool{}, map[string]bool{}
+	for _, binding := range info.Bindings {
+		if binding.Source == "" {
+			continue
+		}
+		sources[binding.Vhost+"\x00"+binding.Source] = true
+		bound[binding.Vhost+"\x00"+binding.DestinationType+"\x00"+binding.Destination] = true
+	}
+	orphans := OrphanList{}
+	for _, exchange := range info.Exchanges {
+		if exchange.Name == "" || strings.HasPrefix(exchange.Name, "amq.") {
+			continue
+		}
+		if !sources[exchange.Vhost+"\x00"+exchange.Name] {
+			orphans = append(orphans, OrphanedObject{Kind: "exchange", Vhost: exchange.Vhost, Name: exchange.Name})
+		}
+	}
+	for _, queue := range info.Queues {
+		if queue.Consumers == 0 && !bound[queue.Vhost+"\x00queue\x00"+queue.Name] {
+			orphans = append(orphans, OrphanedObject{Kind: "queue", Vhost: queue.Vhost, Name: queue.Name, Messages: queue.Messages})
+		}
+	}
+	sort.SliceStable(orphans, func(i, j int) bool {
+		if orphans[i].Vhost != orphans[j].Vhost {
+			return orphans[i].Vhost < orphans[j].Vhost
+		}
+		if orphans[i].Kind != orphans[j].Kind {
+			return orphans[i].Kind < orphans[j].Kind
+		}
+		return orphans[i].Name < orphans[j].Name
+	})
+	return orphans
+}
+
+// Table orphans as table
+func (orphans OrphanList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "KIND", "NAME", "MESSAGES"}}
+	for _, orphan := range orphans {
+		messages := "-"
+		if orphan.Kind == "queue" {
+			messages = format.Count(int64(orphan.Messages))
+		}
+		table.Rows = append(table.Rows, []Cell{{Text: orphan.Vhost}, {Text: orphan.Kind}, {Text: orphan.Name, Color: Yellow}, {Text: messages}})
+	}
+	return table
+}
+
+// TopQueues the queues with the most messages
+func TopQueues(info rabtap.BrokerInfo, limit int) QueueList {
+	queues := append([]rabtap.RabbitQueue{}, info.Queues...)
+	sort.SliceStable(queues, func(i, j int) bool { return queues[i].Messages > queues[j].Messages })
+	if len(queues) > limit {
+		queues = queues[:limit]
+	}
+	return QueueList{Queues: queues, MaxMessages: defaultMaxMessages, NoRates: RatesDisabled(info.Overview)}
+}
+
+// reportSection : a titled table built from the broker info
+type reportSection struct {
+	title string
+	build func(info rabtap.BrokerInfo) Tabular
+}
+
+// reportSections : the sections a report can be made of, plugins register
+// more with RegisterReportSection
+var reportSections = map[string]reportSection{
+	"health":     {"Health score", func(info rabtap.BrokerInfo) Tabular { return ScoreHealth(info) }},
+	"orphans":    {"Orphaned objects", func(info rabtap.BrokerInfo) Tabular { return FindOrphans(info) }},
+	"top-queues": {"Top queues", func(info rabtap.BrokerInfo) Tabular { return TopQueues(info, topQueuesLimit) }},
+	"posture":    {"Security posture", func(info rabtap.BrokerInfo) Tabular { return PostureReport(AssessPosture(info)) }},
+}
+
+// findReportSection the section registered as name
+func findReportSection(name string) (reportSection, bool) {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+	section, ok := reportSections[name]
+	return section, ok
+}
+
+// reportSectionNames the known section names, sorted
+func reportSectionNames() []string {
+	pluginMutex.Lock()
+	defer pluginMutex.Unlock()
+	names := []string{}
+	for name := range reportSections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReportSection : a titled result of a report
+type ReportSection struct {
+	Title  string      `json:"title"`
+	Result interface{} `json:"result"`
+}
+
+// Report : sections generated together for one cluster
+type Report struct {
+	Title     string          `json:"title"`
+	Cluster   string          `json:"cluster"`
+	Generated time.Time       `json:"generated"`
+	Sections  []ReportSection `json:"sections"`
+}
+
+// BuildReport generate the named sections from info
+func BuildReport(title string, sections []string, info rabtap.BrokerInfo, now time.Time) (Report, error) {
+	report := Report{Title: title, Cluster: info.Overview.ClusterName, Generated: now}
+	for _, name := range sections {
+		section, ok := findReportSection(name)
+		if !ok {
+			return report, fmt.Errorf("unknown report section %q, expected one of %s", name, strings.Join(reportSectionNames(), ", "))
+		}
+		report.Sections = append(report.Sections, ReportSection{Title: section.title, Result: section.build(info)})
+	}
+	return report, nil
+}
+
+// Annotate list the deploy and incident markers before the sections
+func (report *Report) Annotate(markers MarkerList) {
+	if len(markers) == 0 {
+		return
+	}
+	report.Sections = append([]ReportSection{{Title: "Deploys and incidents", Result: markers}}, report.Sections...)
+}
+
+// Render the report as markdown or standalone html document, numbers of
+// the tables are formatted with numbers
+func (report Report) Render(format string, numbers NumberFormat) ([]byte, error) {
+	var out bytes.Buffer
+	subtitle := fmt.Sprintf("%s, %s", orDash(report.Cluster), report.Generated.Format(time.RFC1123))
+	switch format {
+	case ReportMarkdown:
+		fmt.Fprintf(&out, "# %s\n\n_%s_\n", report.Title, subtitle)
+		for _, section := range report.Sections {
+			fmt.Fprintf(&out, "\n## %s\n\n", section.Title)
+			writeMarkdownResult(&out, section.Result, numbers)
+		}
+	case ReportHTML:
+		fmt.Fprintf(&out, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title>\n<style>%s</style></head>\n<body>\n", html.EscapeString(report.Title), reportStyle)
+		fmt.Fprintf(&out, "<h1>%s</h1>\n<p><em>%s</em></p>\n", html.EscapeString(report.Title), html.EscapeString(subtitle))
+		for _, section := range report.Sections {
+			fmt.Fprintf(&out, "<h2>%s</h2>\n", html.EscapeString(section.Title))
+			writeHTMLResult(&out, section.Result, numbers)
+		}
+		out.WriteString("</body>\n</html>\n")
+	default:
+		return nil, fmt.Errorf("unknown report format %q, expected %s or %s", format, ReportMarkdown, ReportHTML)
+	}
+	return out.Bytes(), nil
+}
+
+// reportContentType mime type and file extension of a report format
+func reportContentType(format string) (string, string) {
+	if format == ReportHTML {
+		return "text/html; charset=utf-8", ".html"
+	}
+	return "text/markdown; charset=utf-8", ".md"
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronSchedule(t *testing.T) {
+	at := func(s string) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return v
+	}
+	schedule, err := ParseCronSchedule("30 6 * * 1-5")
+	assert.Nil(t, err)
+	assert.True(t, schedule.Matches(at("2020-01-06 06:30")))
+	assert.False(t, schedule.Matches(at("2020-01-05 06:30")))
+	assert.False(t, schedule.Matches(at("2020-01-06 06:31")))
+	assert.Equal(t, at("2020-01-06 06:30"), schedule.Next(at("2020-01-03 06:30")))
+
+	weekly, err := ParseCronSchedule("@weekly")
+	assert.Nil(t, err)
+	assert.True(t, weekly.Matches(at("2020-01-05 00:00")))
+	sunday, _ := ParseCronSchedule("0 0 * * 7")
+	assert.True(t, sunday.Matches(at("2020-01-05 00:00")))
+	steps, _ := ParseCronSchedule("*/15 * * * *")
+	assert.True(t, steps.Matches(at("2020-01-05 10:45")))
+	assert.False(t, steps.Matches(at("2020-01-05 10:50")))
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "x * * * *"} {
+		_, err := ParseCronSchedule(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func reportInfo() rabtap.BrokerInfo {
+	info := rabtap.BrokerInfo{
+		Exchanges: []rabtap.RabbitExchange{{Vhost: "/", Name: "orders"}, {Vhost: "/", Name: "unused"}, {Vhost: "/", Name: "amq.direct"}},
+		Queues: []rabtap.RabbitQueue{
+			{Vhost: "/", Name: "orders", Messages: 20000, Consumers: 1},
+			{Vhost: "/", Name: "lost", Messages: 5},
+		},
+		Bindings: []rabtap.RabbitBinding{
+			{Vhost: "/", Source: "", Destination: "lost", DestinationType: "queue"},
+			{Vhost: "/", Source: "orders", Destination: "orders", DestinationType: "queue"},
+		},
+	}
+	info.Overview.ClusterName = "rabbit@prod"
+	return info
+}
+
+func TestReportSections(t *testing.T) {
+	info := reportInfo()
+	orphans := FindOrphans(info)
+	assert.Equal(t, OrphanList{{Kind: "exchange", Vhost: "/", Name: "unused"}, {Kind: "queue", Vhost: "/", Name: "lost", Messages: 5}}, orphans)
+
+	score := ScoreHealth(info)
+	assert.Equal(t, 100-2-5-2, score.Score)
+	assert.Equal(t, 3, len(score.Deductions))
+
+	top := TopQueues(info, 1)
+	assert.Equal(t, 1, len(top.Queues))
+	assert.Equal(t, "orders", top.Queues[0].Name)
+}
+
+func TestReportRender(t *testing.T) {
+	now := time.Date(2020, 1, 6, 7, 0, 0, 0, time.UTC)
+	report, err := BuildReport("daily", []string{"health", "orphans"}, reportInfo(), now)
+	assert.Nil(t, err)
+	markdown, err := report.Render(ReportMarkdown, NumberFormat{})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(markdown), "# daily\n"))
+	assert.True(t, strings.Contains(string(markdown), "| / | exchange | unused | - |\n"))
+	page, err := report.Render(ReportHTML, NumberFormat{})
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(page), "<h2>Orphaned objects</h2>"))
+	assert.True(t, strings.Contains(string(page), "<td style=\"color:#b26a00\">lost</td>"))
+
+	_, err = BuildReport("daily", []string{"nope"}, reportInfo(), now)
+	assert.NotNil(t, err)
+	_, err = report.Render("pdf", NumberFormat{})
+	assert.NotNil(t, err)
+}
+
+func TestReportMail(t *testing.T) {
+	msg := string(reportMail("radish@example.com", []string{"ops@example.com"}, "daily", "daily-2020-01-06.md", ReportMarkdown, []byte("# daily\n")))
+	assert.True(t, strings.Contains(msg, "To: ops@example.com\r\n"))
+	assert.True(t, strings.Contains(msg, "Content-Type: text/markdown; charset=utf-8\r\n"))
+	assert.True(t, strings.Contains(msg, "filename=\"daily-2020-01-06.md\""))
+	assert.True(t, strings.Contains(msg, "IyBkYWlseQo=\r\n"))
+}
+
+func TestReportDeliverWebhook(t *testing.T) {
+	var posted ReportWebhook
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&posted)
+	}))
+	defer hook.Close()
+
+	dir, _ := ioutil.TempDir("", "reports")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "reports.yml")
+	ioutil.WriteFile(file, []byte("reports:\n- name: weekly\n  schedule: '@weekly'\n  sections: [top-queues]\n  format: markdown\n  webhook: "+hook.URL+"\n"), 0644)
+	schedule, err := LoadReportSchedule(file)
+	assert.Nil(t, err)
+	report, ok := schedule.Find("weekly")
+	assert.True(t, ok)
+
+	now := time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC)
+	delivery, err := schedule.Deliver(report, reportInfo(), now)
+	assert.Nil(t, err)
+	assert.Equal(t, hook.URL, delivery.Webhook)
+	assert.Equal(t, "weekly-2020-01-05.md", posted.Filename)
+	assert.Equal(t, "rabbit@prod", posted.Cluster)
+	assert.True(t, strings.Contains(posted.Content, "## Top queues"))
+
+	ioutil.WriteFile(file, []byte("reports:\n- name: weekly\n  schedule: '@weekly'\n  sections: [health]\n  email: [ops@example.com]\n"), 0644)
+	_, err = LoadReportSchedule(file)
+	assert.NotNil(t, err)
+}
+
+func TestReportCharts(t *testing.T) {
+	table := TopQueues(reportInfo(), 10).Table(NumberFormat{Raw: true})
+	chart, ok := chartOf(table)
+	assert.True(t, ok)
+	assert.Equal(t, "MESSAGES", chart.Title)
+	assert.Equal(t, []string{"orders", "lost"}, chart.Labels)
+	assert.Equal(t, []float64{20000, 5}, chart.Values)
+
+	_, ok = chartOf(Table{Headers: []string{"NAME", "STATE"}, Rows: [][]Cell{{{Text: "a"}, {Text: "ok"}}, {{Text: "b"}, {Text: "ok"}}}})
+	assert.False(t, ok)
+
+	var text strings.Builder
+	chart.WriteText(&text)
+	assert.Equal(t, "```\nMESSAGES\norders  "+strings.Repeat("█", 30)+" 20000\nlost    █ 5\n```\n", text.String())
+	var svg strings.Builder
+	chart.WriteSVG(&svg)
+	assert.Equal(t, 2, strings.Count(svg.String(), "<rect "))
+}
+
+func TestPrintDocument(t *testing.T) {
+	var out strings.Builder
+	cli := &CLI{out: &out, html: true}
+	cli.printResult("orphans", FindOrphans(reportInfo()), nil)
+	assert.True(t, strings.HasPrefix(out.String(), "<!DOCTYPE html>"))
+	assert.True(t, strings.Contains(out.String(), "<title>radish orphans</title>"))
+	assert.True(t, strings.Contains(out.String(), "<svg "))
+}
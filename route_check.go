@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// expectations of a route check
+const (
+	ExpectRouted   = "routed"
+	ExpectReturned = "returned"
+)
+
+// routeCheckType message type of route check messages, consumers can use it
+// to skip them
+const routeCheckType = "radish.route-check"
+
+// RouteCheck : exchange and routing key a test message is published to
+type RouteCheck struct {
+	Vhost      string                 `json:"vhost"`
+	Exchange   string                 `json:"exchange"`
+	RoutingKey string                 `json:"routing_key"`
+	Headers    map[string]interface{} `json:"headers"`
+	// Expect routed, the default, or returned when no queue may be bound
+	Expect string `json:"expect"`
+}
+
+// LoadRouteChecks read route checks from a .json or .csv file, csv columns
+// are vhost, exchange, routing_key and expect. Checks without vhost go to
+// defaultVhost.
+func LoadRouteChecks(path string, defaultVhost string) ([]RouteCheck, error) {
+	var checks []RouteCheck
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		checks, err = ParseCSVRouteChecks(f)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &checks); err != nil {
+			return nil, err
+		}
+	}
+	for i := range checks {
+		checks[i].Vhost = ResolveVhost(checks[i].Vhost, defaultVhost)
+		if checks[i].Expect == "" {
+			checks[i].Expect = ExpectRouted
+		}
+		if checks[i].Expect != ExpectRouted && checks[i].Expect != ExpectReturned {
+			return nil, fmt.Errorf("route %d: expect must be %s or %s", i+1, ExpectRouted, ExpectReturned)
+		}
+	}
+	return checks, nil
+}
+
+// ParseCSVRouteChecks parse route checks from csv with a header line
+func ParseCSVRouteChecks(r io.Reader) ([]RouteCheck, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	checks := []RouteCheck{}
+	for _, record := range records[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		checks = append(checks, RouteCheck{
+			Vhost: field("vhost"), Exchange: field("exchange"),
+			RoutingKey: field("routing_key"), Expect: field("expect"),
+		})
+	}
+	return checks, nil
+}
+
+// RouteCheckResult : what happened to the test message of a route check
+type RouteCheckResult struct {
+	RouteCheck
+	Confirmed bool          `json:"confirmed"`
+	Returned  bool          `json:"returned"`
+	Latency   time.Duration `json:"latency"`
+	Error     string        `json:"error,omitempty"`
+	OK        bool          `json:"ok"`
+}
+
+// evaluate compare the outcome with the expectation
+func (result *RouteCheckResult) evaluate() {
+	switch {
+	case result.Error != "":
+		result.OK = false
+	case !result.Confirmed:
+		result.Error = "publish not confirmed"
+	case result.Returned && result.Expect == ExpectRouted:
+		result.Error = "returned unroutable"
+	case !result.Returned && result.Expect == ExpectReturned:
+		result.Error = "routed to a queue"
+	default:
+		result.OK = true
+	}
+}
+
+// RouteChecker publish mandatory, confirmed test messages on a channel
+type RouteChecker struct {
+	Timeout time.Duration
+	TTL     time.Duration
+}
+
+// Check publish one test message per route. The broker sends basic.return
+// before the confirm, a return is therefore known once the confirm arrived.
+// Checking stops at the first route closing the channel, the results cover
+// the routes checked so far.
+func (checker RouteChecker) Check(conn *amqp.Connection, checks []RouteCheck) []RouteCheckResult {
+	results := make([]RouteCheckResult, len(checks))
+	for i, check := range checks {
+		results[i].RouteCheck = check
+	}
+	fail := func(err error) []RouteCheckResult {
+		for i := range results {
+			results[i].Error = err.Error()
+			results[i].evaluate()
+		}
+		return results
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return fail(err)
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		return fail(err)
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	returns := ch.NotifyReturn(make(chan amqp.Return, len(checks)))
+	for i := range results {
+		result := &results[i]
+		id := fmt.Sprintf("radish-route-check-%d-%d", time.Now().UnixNano(), i)
+		publishing := amqp.Publishing{
+			MessageId: id, Type: routeCheckType, Timestamp: time.Now(),
+			Headers: amqp.Table(result.Headers), Body: []byte("route check"),
+		}
+		if checker.TTL > 0 {
+			publishing.Expiration = fmt.Sprint(checker.TTL.Milliseconds())
+		}
+		sent := time.Now()
+		if err := ch.Publish(result.Exchange, result.RoutingKey, true, false, publishing); err != nil {
+			result.Error = err.Error()
+			result.evaluate()
+			continue
+		}
+		select {
+		case confirm, ok := <-confirms:
+			result.Latency = time.Since(sent)
+			if !ok {
+				result.Error = "channel closed, does the exchange exist?"
+			} else if !confirm.Ack {
+				result.Error = "publish nacked"
+			} else {
+				result.Confirmed = true
+			}
+		case <-time.After(checker.Timeout):
+			result.Error = fmt.Sprintf("no confirm within %s", checker.Timeout)
+		}
+	drain:
+		for {
+			select {
+			case ret := <-returns:
+				if ret.MessageId == id {
+					result.Returned = true
+				}
+			default:
+				break drain
+			}
+		}
+		result.evaluate()
+		if result.Error != "" && !result.Confirmed {
+			// a missing exchange closes the channel, the caller continues
+			// with the remaining routes on a new one
+			return results[:i+1]
+		}
+	}
+	return results
+}
+
+// RouteCheckResults : results of all route checks
+type RouteCheckResults []RouteCheckResult
+
+// Failed number of routes not behaving as expected
+func (results RouteCheckResults) Failed() int {
+	failed := 0
+	for _, result := range results {
+		if !result.OK {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Table one row per route
+func (results RouteCheckResults) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "EXCHANGE", "ROUTING KEY", "EXPECT", "ROUTED", "LATENCY", "RESULT"}}
+	for _, result := range results {
+		text, color := "ok", Green
+		if !result.OK {
+			text, color = orDash(result.Error), Red
+		}
+		routed := "-"
+		if result.Confirmed {
+			routed = fmt.Sprint(!result.Returned)
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: result.Vhost},
+			{Text: orDash(result.Exchange)},
+			{Text: orDash(result.RoutingKey)},
+			{Text: result.Expect},
+			{Text: routed},
+			{Text: result.Latency.Round(time.Microsecond).String()},
+			{Text: text, Color: color},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("route-check", "[--timeout d] [--ttl d] <file> publish a mandatory confirmed test message per exchange and routing key", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("route-check")
+		checker := RouteChecker{}
+		flags.DurationVar(&checker.Timeout, "timeout", 5*time.Second, "time to wait for a confirm")
+		flags.DurationVar(&checker.TTL, "ttl", time.Second, "expiration of the test messages, 0 keeps them")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("route-check: expected route file")
+		}
+		checks, err := LoadRouteChecks(flags.Arg(0), cli.vhost(""))
+		if err != nil {
+			return nil, usageError("route-check: %s", err)
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		if err := rabbitmq.writable(); err != nil {
+			return nil, err
+		}
+		var vhosts []string
+		byVhost := map[string][]RouteCheck{}
+		for _, check := range checks {
+			if byVhost[check.Vhost] == nil {
+				vhosts = append(vhosts, check.Vhost)
+			}
+			byVhost[check.Vhost] = append(byVhost[check.Vhost], check)
+		}
+		results := RouteCheckResults{}
+		for _, vhost := range vhosts {
+			uri, err := VhostAMQPURL(rabbitmq.amqpURL, vhost)
+			if err != nil {
+				return results, err
+			}
+			conn, err := amqp.DialConfig(uri, rabbitmq.amqpConfig)
+			if err != nil {
+				return results, connectionError(err)
+			}
+			for remaining := byVhost[vhost]; len(remaining) > 0; {
+				checked := checker.Check(conn, remaining)
+				results = append(results, checked...)
+				remaining = remaining[len(checked):]
+			}
+			conn.Close()
+		}
+		if failed := results.Failed(); failed > 0 {
+			return results, thresholdError("%d of %d routes failed", failed, len(results))
+		}
+		return results, nil
+	})
+}
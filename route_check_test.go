@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSVRouteChecks(t *testing.T) {
+	checks, err := ParseCSVRouteChecks(strings.NewReader("vhost,exchange,routing_key,expect\n/,events,order.created,\nprod,events,nobody.listens,returned\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []RouteCheck{
+		{Vhost: "/", Exchange: "events", RoutingKey: "order.created"},
+		{Vhost: "prod", Exchange: "events", RoutingKey: "nobody.listens", Expect: ExpectReturned},
+	}, checks)
+}
+
+func TestLoadRouteChecksDefaultVhost(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "routes")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "routes.csv")
+	ioutil.WriteFile(file, []byte("vhost,exchange,routing_key,expect\n,events,order.created,\nprod,events,order.paid,\n%2F,events,order.shipped,\n"), 0600)
+	checks, err := LoadRouteChecks(file, "billing")
+	assert.Nil(t, err)
+	assert.Equal(t, "billing", checks[0].Vhost)
+	assert.Equal(t, "prod", checks[1].Vhost)
+	assert.Equal(t, "/", checks[2].Vhost)
+
+	checks, err = LoadRouteChecks(file, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "/", checks[0].Vhost)
+}
+
+func TestRouteCheckEvaluate(t *testing.T) {
+	for _, tc := range []struct {
+		result RouteCheckResult
+		err    string
+	}{
+		{RouteCheckResult{RouteCheck: RouteCheck{Expect: ExpectRouted}, Confirmed: true}, ""},
+		{RouteCheckResult{RouteCheck: RouteCheck{Expect: ExpectRouted}, Confirmed: true, Returned: true}, "returned unroutable"},
+		{RouteCheckResult{RouteCheck: RouteCheck{Expect: ExpectReturned}, Confirmed: true, Returned: true}, ""},
+		{RouteCheckResult{RouteCheck: RouteCheck{Expect: ExpectReturned}, Confirmed: true}, "routed to a queue"},
+		{RouteCheckResult{RouteCheck: RouteCheck{Expect: ExpectRouted}}, "publish not confirmed"},
+	} {
+		tc.result.evaluate()
+		assert.Equal(t, tc.err, tc.result.Error)
+		assert.Equal(t, tc.err == "", tc.result.OK)
+	}
+	assert.Equal(t, 1, RouteCheckResults{{OK: true}, {}}.Failed())
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Target : location and credentials of an s3 compatible bucket
+type S3Target struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+}
+
+// S3Client minimal client for s3 compatible object stores using path style
+// urls and aws signature version 4
+type S3Client struct {
+	target S3Target
+	client *http.Client
+}
+
+// NewS3Client create a client for the given bucket
+func NewS3Client(target S3Target) *S3Client {
+	if target.Region == "" {
+		target.Region = "us-east-1"
+	}
+	return &S3Client{target: target, client: &http.Client{Timeout: time.Minute}}
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// do sign and send a request for the given object key
+func (s3 *S3Client) do(method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint := strings.TrimSuffix(s3.target.Endpoint, "/") + "/" + url.PathEscape(s3.target.Bucket)
+	if key != "" {
+		segments := strings.Split(key, "/")
+		for i := range segments {
+			segments[i] = url.PathEscape(segments[i])
+		}
+		endpoint += "/" + strings.Join(segments, "/")
+	}
+	rawQuery := strings.Replace(query.Encode(), "+", "%20", -1)
+	if rawQuery != "" {
+		endpoint += "?" + rawQuery
+	}
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		req.URL.EscapedPath(),
+		rawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s3.target.Region)
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s3.target.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, s3.target.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3.target.AccessKey, scope, signedHeaders, signature))
+
+	res, err := s3.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return nil, &S3Error{Code: res.StatusCode, msg: fmt.Sprintf("s3 %s %s: %s %s", method, key, res.Status, msg)}
+	}
+	return res, nil
+}
+
+// S3Error : a request answered with an error status
+type S3Error struct {
+	Code int
+	msg  string
+}
+
+func (err *S3Error) Error() string {
+	return err.msg
+}
+
+// s3NotFound true for errors of missing objects
+func s3NotFound(err error) bool {
+	s3err, ok := err.(*S3Error)
+	return ok && s3err.Code == http.StatusNotFound
+}
+
+// PutObject store data under the given key, relative to the target prefix
+func (s3 *S3Client) PutObject(key string, data []byte) error {
+	res, err := s3.do("PUT", s3.target.Prefix+key, nil, data)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// GetObject read the object stored under the given key
+func (s3 *S3Client) GetObject(key string) ([]byte, error) {
+	res, err := s3.do("GET", s3.target.Prefix+key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// DeleteObject remove the object stored under the given key
+func (s3 *S3Client) DeleteObject(key string) error {
+	res, err := s3.do("DELETE", s3.target.Prefix+key, nil, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// ListObjects list the keys below the target prefix, sorted
+func (s3 *S3Client) ListObjects() ([]string, error) {
+	return s3.ListKeys("")
+}
+
+// ListKeys list the keys starting with prefix below the target prefix,
+// sorted and relative to the target prefix
+func (s3 *S3Client) ListKeys(prefix string) ([]string, error) {
+	keys := []string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s3.target.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		res, err := s3.do("GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(content.Key, s3.target.Prefix))
+		}
+		if !result.IsTruncated {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
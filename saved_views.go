@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var viewNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// SavedView : a named, shareable list of a resource, addressed by
+// /api/views/<name>/data in the api and /views/<name> in the client
+type SavedView struct {
+	Name     string `json:"name"`
+	Resource string `json:"resource"`
+	// Broker cluster name the view was saved for, empty for any
+	Broker  string   `json:"broker,omitempty"`
+	Vhost   string   `json:"vhost,omitempty"`
+	Filter  string   `json:"filter,omitempty"`
+	Sort    string   `json:"sort,omitempty"`
+	Columns []string `json:"columns,omitempty"`
+	// Owner user that saved the view last
+	Owner   string    `json:"owner,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Query the list query of the view
+func (view SavedView) Query() (ListQuery, error) {
+	filter, err := ParseFilterExpr(view.Filter)
+	if err != nil {
+		return ListQuery{}, err
+	}
+	if view.Vhost != "" {
+		field := "vhost"
+		if view.Resource == ResourceConsumers {
+			field = "queue.vhost"
+		}
+		filter = append(filter, FilterCondition{Field: field, Op: "=", Value: view.Vhost})
+	}
+	return ListQuery{Filter: filter, Sort: view.Sort, Fields: view.Columns}, nil
+}
+
+// Validate reject views that can not be run
+func (view SavedView) Validate() error {
+	if !viewNamePattern.MatchString(view.Name) {
+		return fmt.Errorf("invalid view name %q, use letters, digits and ._-", view.Name)
+	}
+	if !isPollResource(view.Resource) || view.Resource == ResourceOverview {
+		return fmt.Errorf("unknown list resource %q", view.Resource)
+	}
+	_, err := view.Query()
+	return err
+}
+
+// viewKey store key of a saved view
+func viewKey(name string) string {
+	return "views/" + name
+}
+
+// SavedViews all views of store sorted by name
+func SavedViews(store KVStore) ([]SavedView, error) {
+	keys, err := store.Keys("views/")
+	if err != nil {
+		return nil, err
+	}
+	views := []SavedView{}
+	for _, key := range keys {
+		var view SavedView
+		if _, err := getJSON(store, key, &view); err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// handleViews list the saved views, or get, put and delete one under
+// /api/views/<name> and run it under /api/views/<name>/data
+func (server *Server) handleViews(w http.ResponseWriter, r *http.Request) {
+	if server.store == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no store configured, see serve --store"})
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/views"), "/")
+	if name == "" {
+		views, err := SavedViews(server.store)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, views)
+		return
+	}
+	if strings.HasSuffix(name, "/data") {
+		server.handleViewData(w, r, strings.TrimSuffix(name, "/data"))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		var view SavedView
+		found, err := getJSON(server.store, viewKey(name), &view)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if !found {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no view %q", name)})
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+	case http.MethodPut:
+		var view SavedView
+		if err := json.NewDecoder(r.Body).Decode(&view); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		view.Name, view.Owner, view.Updated = name, requestUser(r), time.Now().UTC()
+		if err := view.Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := putJSON(server.store, viewKey(name), view); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+	case http.MethodDelete:
+		if err := server.store.Delete(viewKey(name)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET, PUT or DELETE"})
+	}
+}
+
+// handleViewData run the saved view against the snapshot, ?limit= and
+// ?offset= page the result
+func (server *Server) handleViewData(w http.ResponseWriter, r *http.Request, name string) {
+	var view SavedView
+	found, err := getJSON(server.store, viewKey(name), &view)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no view %q", name)})
+		return
+	}
+	query, err := view.Query()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	paging, err := ParseListQuery(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	query.Limit, query.Offset = paging.Limit, paging.Offset
+	snapshot := server.snapshot(r)
+	if snapshot == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "no snapshot yet"})
+		return
+	}
+	if view.Broker != "" && view.Broker != snapshot.Info.Overview.ClusterName {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("view %q is for broker %s", name, view.Broker)})
+		return
+	}
+	result, total, err := query.Apply(resourceOf(snapshot.Info, view.Resource))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	setSnapshotAge(w, snapshot.FetchedAt[view.Resource])
+	w.Header().Set("X-Total-Count", fmt.Sprint(total))
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavedViewQuery(t *testing.T) {
+	view := SavedView{Name: "prod-orders", Resource: ResourceQueues, Vhost: "prod", Filter: "name~order* and messages>1000", Sort: "-messages", Columns: []string{"name", "messages"}}
+	assert.Nil(t, view.Validate())
+	query, err := view.Query()
+	assert.Nil(t, err)
+	assert.Equal(t, "name~order* and messages>1000 and vhost=prod", query.Filter.String())
+
+	assert.NotNil(t, SavedView{Name: "a b", Resource: ResourceQueues}.Validate())
+	assert.NotNil(t, SavedView{Name: "x", Resource: ResourceOverview}.Validate())
+}
+
+func TestServerSavedViews(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "views")
+	defer os.RemoveAll(dir)
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	defer store.Close()
+	poller := newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second})
+	poller.Poll()
+	server := NewServer(poller)
+	server.UseStore(store)
+
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	rec := request("PUT", "/api/views/q1", `{"resource":"queues","filter":"name=q1","columns":["name"]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = request("PUT", "/api/views/none", `{"resource":"queues","filter":"name=other"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var views []SavedView
+	json.Unmarshal(request("GET", "/api/views", "").Body.Bytes(), &views)
+	assert.Equal(t, 2, len(views))
+	assert.Equal(t, "default", views[0].Owner)
+
+	rec = request("GET", "/api/views/q1/data", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Total-Count"))
+	assert.Equal(t, "[{\"name\":\"q1\"}]\n", rec.Body.String())
+	rec = request("GET", "/api/views/none/data", "")
+	assert.Equal(t, "0", rec.Header().Get("X-Total-Count"))
+
+	assert.Equal(t, http.StatusNoContent, request("DELETE", "/api/views/none", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/api/views/none", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request("PUT", "/api/views/bad", `{"resource":"queues","filter":"name"}`).Code)
+
+	// changing shared views needs the views action
+	assert.Equal(t, ActionViews, requestAction(httptest.NewRequest("PUT", "/api/views/q1", nil)))
+	assert.Equal(t, ActionViews, requestAction(httptest.NewRequest("DELETE", "/api/views/q1", nil)))
+	assert.Equal(t, ActionRead, requestAction(httptest.NewRequest("GET", "/api/views/q1/data", nil)))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// Scope : name prefixes limiting the queues and exchanges radish lists and
+// writes, so teams sharing a vhost only see and touch their own objects
+type Scope struct {
+	Prefixes []string
+}
+
+// ParseScope parse a comma separated list of prefixes, a trailing * is
+// optional: team-a.* and team-a. are the same scope
+func ParseScope(str string) Scope {
+	scope := Scope{}
+	for _, prefix := range splitList(str) {
+		scope.Prefixes = append(scope.Prefixes, strings.TrimSuffix(prefix, "*"))
+	}
+	return scope
+}
+
+// Empty true when the scope does not limit anything
+func (scope Scope) Empty() bool {
+	return len(scope.Prefixes) == 0
+}
+
+func (scope Scope) String() string {
+	patterns := make([]string, len(scope.Prefixes))
+	for i, prefix := range scope.Prefixes {
+		patterns[i] = prefix + "*"
+	}
+	return strings.Join(patterns, ",")
+}
+
+// Match true when name starts with one of the prefixes
+func (scope Scope) Match(name string) bool {
+	if scope.Empty() {
+		return true
+	}
+	for _, prefix := range scope.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check refuse writing to an object outside the scope
+func (scope Scope) Check(kind string, name string) error {
+	if scope.Match(name) {
+		return nil
+	}
+	return fmt.Errorf("%s %q is outside the scope %s", kind, name, scope)
+}
+
+// patternPrefix the text every name matching a policy pattern starts with,
+// empty unless the pattern is anchored with ^ and followed by literal text
+func patternPrefix(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil || re.Op != syntax.OpConcat || len(re.Sub) < 2 {
+		return ""
+	}
+	if op := re.Sub[0].Op; op != syntax.OpBeginText && op != syntax.OpBeginLine {
+		return ""
+	}
+	var prefix []rune
+	for _, sub := range re.Sub[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix = append(prefix, sub.Rune...)
+	}
+	return string(prefix)
+}
+
+// CheckPattern refuse writing a policy whose pattern can match names outside
+// the scope, only patterns anchored to one of the prefixes are in scope
+func (scope Scope) CheckPattern(kind string, pattern string) error {
+	if scope.Empty() {
+		return nil
+	}
+	prefix := patternPrefix(pattern)
+	for _, scoped := range scope.Prefixes {
+		if strings.HasPrefix(prefix, scoped) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s pattern %q can match names outside the scope %s, anchor it with ^ and a prefix", kind, pattern, scope)
+}
+
+// FilterBrokerInfo keep the queues and exchanges in scope, their bindings
+// and consumers. Connections and the overview are not owned by a team and
+// stay as they are.
+func (scope Scope) FilterBrokerInfo(info rabtap.BrokerInfo) rabtap.BrokerInfo {
+	if scope.Empty() {
+		return info
+	}
+	queues := []rabtap.RabbitQueue{}
+	for _, queue := range info.Queues {
+		if scope.Match(queue.Name) {
+			queues = append(queues, queue)
+		}
+	}
+	exchanges := []rabtap.RabbitExchange{}
+	for _, exchange := range info.Exchanges {
+		if scope.Match(exchange.Name) {
+			exchanges = append(exchanges, exchange)
+		}
+	}
+	bindings := []rabtap.RabbitBinding{}
+	for _, binding := range info.Bindings {
+		if scope.Match(binding.Destination) || (binding.Source != "" && scope.Match(binding.Source)) {
+			bindings = append(bindings, binding)
+		}
+	}
+	consumers := []rabtap.RabbitConsumer{}
+	for _, consumer := range info.Consumers {
+		if scope.Match(consumer.Queue.Name) {
+			consumers = append(consumers, consumer)
+		}
+	}
+	info.Queues, info.Exchanges, info.Bindings, info.Consumers = queues, exchanges, bindings, consumers
+	return info
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeMatch(t *testing.T) {
+	scope := ParseScope("team-a.*, shared.")
+	assert.Equal(t, []string{"team-a.", "shared."}, scope.Prefixes)
+	assert.True(t, scope.Match("team-a.orders"))
+	assert.True(t, scope.Match("shared.events"))
+	assert.False(t, scope.Match("team-b.orders"))
+	assert.Nil(t, scope.Check("queue", "team-a.orders"))
+	assert.EqualError(t, scope.Check("queue", "team-b.orders"), `queue "team-b.orders" is outside the scope team-a.*,shared.*`)
+	assert.True(t, ParseScope("").Match("anything"))
+}
+
+func TestScopeCheckPattern(t *testing.T) {
+	scope := ParseScope("team-a.")
+	assert.Equal(t, "team-a.orders", patternPrefix(`^team-a\.orders$`))
+	assert.Equal(t, "team-a.", patternPrefix(`^team-a\..*`))
+	assert.Equal(t, "", patternPrefix(`team-a\.`))
+	assert.Nil(t, scope.CheckPattern("policy", `^team-a\..*`))
+	assert.Nil(t, scope.CheckPattern("policy", "^"+regexp.QuoteMeta("team-a.orders")+"$"))
+	for _, pattern := range []string{`team-a\.`, `^team-a`, `^team-a.`, `^team-a\.|^team-b\.`, `^(?i)team-a\.`, `.*`, `(`} {
+		assert.NotNil(t, scope.CheckPattern("policy", pattern), pattern)
+	}
+	assert.Nil(t, ParseScope("").CheckPattern("policy", ".*"))
+}
+
+func TestScopeFilterBrokerInfo(t *testing.T) {
+	info := rabtap.BrokerInfo{
+		Queues:    []rabtap.RabbitQueue{{Name: "team-a.orders"}, {Name: "team-b.orders"}},
+		Exchanges: []rabtap.RabbitExchange{{Name: ""}, {Name: "amq.topic"}, {Name: "team-a.events"}},
+		Bindings: []rabtap.RabbitBinding{
+			{Source: "", Destination: "team-a.orders"},
+			{Source: "", Destination: "team-b.orders"},
+			{Source: "team-a.events", Destination: "team-b.orders"},
+		},
+		Connections: []rabtap.RabbitConnection{{Name: "c1"}},
+	}
+	consumer := rabtap.RabbitConsumer{}
+	consumer.Queue.Name = "team-b.orders"
+	info.Consumers = append(info.Consumers, consumer)
+
+	scoped := ParseScope("team-a.").FilterBrokerInfo(info)
+	assert.Equal(t, []rabtap.RabbitQueue{{Name: "team-a.orders"}}, scoped.Queues)
+	assert.Equal(t, []rabtap.RabbitExchange{{Name: "team-a.events"}}, scoped.Exchanges)
+	assert.Len(t, scoped.Bindings, 2)
+	assert.Empty(t, scoped.Consumers)
+	assert.Len(t, scoped.Connections, 1)
+}
+
+func TestScopeEnforcedOnWrites(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method == "GET" {
+			w.Write([]byte(`{"name": "ttl", "pattern": ".*"}`))
+		}
+	}))
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+	client := NewManagementClient(uri, nil)
+	client.scope = ParseScope("team-a.")
+
+	assert.NotNil(t, client.DeleteQueue("/", "team-b.orders"))
+	assert.NotNil(t, client.PurgeQueue("/", "team-b.orders"))
+	assert.NotNil(t, client.PutQueue(ManifestQueue{Vhost: "/", Name: "team-b.orders"}))
+	assert.NotNil(t, client.PutPolicy(RabbitPolicy{Vhost: "/", Name: "ttl", Pattern: ".*"}))
+	assert.NotNil(t, client.PutOperatorPolicy(drainPolicy("/", "team-b.orders")))
+	assert.NotNil(t, client.AddQuorumMember("/", "team-b.orders", "rabbit@b"))
+	assert.NotNil(t, client.DeleteQuorumMember("/", "team-b.orders", "rabbit@b"))
+	assert.NotNil(t, client.GrowQuorumQueues("rabbit@b", ".*", "^team-a\\.", "all"))
+	assert.NotNil(t, client.ShrinkQuorumQueues("rabbit@b"))
+	_, err := client.DrainQueue(context.Background(), DrainOptions{Vhost: "/", Queue: "team-b.orders", Block: DrainBlockClose}, func(int) {})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, requests)
+
+	assert.Nil(t, client.DeleteQueue("/", "team-a.orders"))
+	assert.Nil(t, client.PutPolicy(RabbitPolicy{Vhost: "/", Name: "ttl", Pattern: `^team-a\.`}))
+	assert.Nil(t, client.AddQuorumMember("/", "team-a.orders", "rabbit@b"))
+	assert.Equal(t, 3, requests)
+	// the policy to delete is looked up, its pattern matches every queue
+	assert.NotNil(t, client.DeletePolicy("/", "ttl"))
+	assert.Equal(t, 4, requests)
+}
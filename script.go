@@ -0,0 +1,856 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// ScriptEnv : what a script can see, the object it is evaluated for, the
+// snapshot and the metric history. Lists of the snapshot are converted
+// once per env, share an env between the objects of one evaluation.
+type ScriptEnv struct {
+	Object   map[string]interface{}
+	Resource string
+	Info     *rabtap.BrokerInfo
+	History  *MetricHistory
+	Now      time.Time
+	lists    map[string][]interface{}
+}
+
+// list the json objects of a resource of the snapshot
+func (env *ScriptEnv) list(resource string) ([]interface{}, error) {
+	if env.Info == nil {
+		return nil, fmt.Errorf("no snapshot to read %s from", resource)
+	}
+	if !isPollResource(resource) || resource == ResourceOverview {
+		return nil, fmt.Errorf("unknown list resource %q", resource)
+	}
+	if list, ok := env.lists[resource]; ok {
+		return list, nil
+	}
+	data, err := json.Marshal(resourceOf(*env.Info, resource))
+	if err != nil {
+		return nil, err
+	}
+	var list []interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	if env.lists == nil {
+		env.lists = map[string][]interface{}{}
+	}
+	env.lists[resource] = list
+	return list, nil
+}
+
+// with a copy of env evaluating for another object
+func (env *ScriptEnv) with(object map[string]interface{}, resource string) *ScriptEnv {
+	other := *env
+	other.Object, other.Resource = object, resource
+	return &other
+}
+
+// series name of metric for the object of the env, queues and connections
+// have their own series, other objects the cluster wide one
+func (env *ScriptEnv) series(metric string) string {
+	str := func(field string) string {
+		v, _ := lookupField(env.Object, field)
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+	switch env.Resource {
+	case ResourceQueues:
+		return seriesName(metric, []MetricLabel{{"vhost", str("vhost")}, {"queue", str("name")}})
+	case ResourceConnections:
+		return seriesName(metric, []MetricLabel{{"vhost", str("vhost")}, {"user", str("user")}, {"connection", str("name")}})
+	}
+	return metric
+}
+
+// points of metric for the object of the env within window
+func (env *ScriptEnv) points(metric string, window string) ([]HistoryPoint, error) {
+	if env.History == nil {
+		return nil, fmt.Errorf("history functions need the metric history, see serve --history")
+	}
+	d, err := parseRetentionDuration(window)
+	if err != nil {
+		return nil, err
+	}
+	now := env.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	_, series, err := env.History.Query(metric, now.Add(-d), now, now)
+	if err != nil {
+		return nil, err
+	}
+	return series[env.series(metric)], nil
+}
+
+// Script : a compiled expression, like
+// messages > 3 * avg_over("queue_messages", "24h") and consumers == 0
+type Script struct {
+	src  string
+	root scriptNode
+}
+
+var scriptCache sync.Map
+
+// ParseScript compile an expression
+func ParseScript(src string) (*Script, error) {
+	tokens, err := scanScript(src)
+	if err != nil {
+		return nil, err
+	}
+	parser := &scriptParser{tokens: tokens}
+	root, err := parser.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok := parser.peek(); tok.kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+	}
+	return &Script{src: src, root: root}, nil
+}
+
+// cachedScript compile src once, for expressions passed to functions
+func cachedScript(src string) (*Script, error) {
+	if script, ok := scriptCache.Load(src); ok {
+		return script.(*Script), nil
+	}
+	script, err := ParseScript(src)
+	if err != nil {
+		return nil, err
+	}
+	scriptCache.Store(src, script)
+	return script, nil
+}
+
+func (script *Script) String() string {
+	return script.src
+}
+
+// Eval the value of the expression: a float64, string, bool or nil
+func (script *Script) Eval(env *ScriptEnv) (interface{}, error) {
+	return script.root.eval(env)
+}
+
+// Match evaluate the expression as condition
+func (script *Script) Match(env *ScriptEnv) (bool, error) {
+	v, err := script.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// truthy false, nil, 0 and "" are false, everything else true
+func truthy(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case float64:
+		return value != 0
+	case string:
+		return value != ""
+	}
+	return true
+}
+
+// script token kinds
+const (
+	tokenEnd = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type scriptToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// scriptOperators two character operators first
+var scriptOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "!", "~", "(", ")", ","}
+
+// scanScript split an expression into tokens
+func scanScript(src string) ([]scriptToken, error) {
+	var tokens []scriptToken
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, scriptToken{tokenNumber, string(runes[start:i]), start})
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, scriptToken{tokenString, b.String(), start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, scriptToken{tokenIdent, string(runes[start:i]), start})
+		default:
+			op := ""
+			for _, candidate := range scriptOperators {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", r, i)
+			}
+			tokens = append(tokens, scriptToken{tokenOp, op, i})
+			i += len([]rune(op))
+		}
+	}
+	return append(tokens, scriptToken{tokenEnd, "end of expression", len(runes)}), nil
+}
+
+type scriptNode interface {
+	eval(env *ScriptEnv) (interface{}, error)
+}
+
+type scriptLiteral struct{ value interface{} }
+
+func (node scriptLiteral) eval(env *ScriptEnv) (interface{}, error) {
+	return node.value, nil
+}
+
+// scriptField a dotted field of the object, nil when it is missing
+type scriptField struct{ path string }
+
+func (node scriptField) eval(env *ScriptEnv) (interface{}, error) {
+	if env.Object == nil {
+		return nil, nil
+	}
+	v, _ := lookupField(env.Object, node.path)
+	return v, nil
+}
+
+type scriptUnary struct {
+	op      string
+	operand scriptNode
+}
+
+func (node scriptUnary) eval(env *ScriptEnv) (interface{}, error) {
+	v, err := node.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if node.op == "!" {
+		return !truthy(v), nil
+	}
+	x, ok := v.(float64)
+	if v == nil {
+		return nil, nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("- needs a number, got %s", scriptType(v))
+	}
+	return -x, nil
+}
+
+type scriptBinary struct {
+	op          string
+	left, right scriptNode
+}
+
+func (node scriptBinary) eval(env *ScriptEnv) (interface{}, error) {
+	a, err := node.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch node.op {
+	case "&&":
+		if !truthy(a) {
+			return false, nil
+		}
+		b, err := node.right.eval(env)
+		return truthy(b), err
+	case "||":
+		if truthy(a) {
+			return true, nil
+		}
+		b, err := node.right.eval(env)
+		return truthy(b), err
+	}
+	b, err := node.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch node.op {
+	case "==", "!=":
+		equal := a == nil && b == nil
+		if a != nil && b != nil {
+			equal = compareValues(a, b) == 0
+		}
+		return equal == (node.op == "=="), nil
+	case "<", "<=", ">", ">=":
+		if a == nil || b == nil {
+			return false, nil
+		}
+		c := compareValues(a, b)
+		switch node.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "~":
+		pattern, ok := b.(string)
+		if !ok || a == nil {
+			return false, nil
+		}
+		match, err := path.Match(pattern, fmt.Sprint(a))
+		return match, err
+	case "+":
+		if x, ok := a.(string); ok {
+			if y, ok := b.(string); ok {
+				return x + y, nil
+			}
+		}
+	}
+	if a == nil || b == nil {
+		// missing fields and history make the result missing too
+		return nil, nil
+	}
+	x, xok := a.(float64)
+	y, yok := b.(float64)
+	if !xok || !yok {
+		return nil, fmt.Errorf("%s needs numbers, got %s and %s", node.op, scriptType(a), scriptType(b))
+	}
+	switch node.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, nil
+		}
+		return x / y, nil
+	}
+	if y == 0 {
+		return nil, nil
+	}
+	return math.Mod(x, y), nil
+}
+
+type scriptCall struct {
+	name string
+	fn   scriptFunc
+	args []scriptNode
+}
+
+func (node scriptCall) eval(env *ScriptEnv) (interface{}, error) {
+	args := make([]interface{}, len(node.args))
+	for i, arg := range node.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := node.fn.call(env, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", node.name, err)
+	}
+	return v, nil
+}
+
+// scriptType name of the type of a value for errors
+func scriptType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "list"
+	}
+	return "object"
+}
+
+type scriptParser struct {
+	tokens []scriptToken
+	pos    int
+}
+
+func (parser *scriptParser) peek() scriptToken {
+	return parser.tokens[parser.pos]
+}
+
+func (parser *scriptParser) next() scriptToken {
+	tok := parser.tokens[parser.pos]
+	if tok.kind != tokenEnd {
+		parser.pos++
+	}
+	return tok
+}
+
+// accept consume the next token when it is one of the operators or
+// keywords, returning it as operator
+func (parser *scriptParser) accept(ops ...string) (string, bool) {
+	tok := parser.peek()
+	if tok.kind != tokenOp && tok.kind != tokenIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			parser.next()
+			switch op {
+			case "or":
+				return "||", true
+			case "and":
+				return "&&", true
+			case "not":
+				return "!", true
+			}
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (parser *scriptParser) or() (scriptNode, error) {
+	return parser.binary(parser.and, "||", "or")
+}
+
+func (parser *scriptParser) and() (scriptNode, error) {
+	return parser.binary(parser.not, "&&", "and")
+}
+
+func (parser *scriptParser) not() (scriptNode, error) {
+	if _, ok := parser.accept("!", "not"); ok {
+		operand, err := parser.not()
+		return scriptUnary{op: "!", operand: operand}, err
+	}
+	return parser.comparison()
+}
+
+func (parser *scriptParser) comparison() (scriptNode, error) {
+	return parser.binary(parser.additive, "==", "!=", "<=", ">=", "<", ">", "~")
+}
+
+func (parser *scriptParser) additive() (scriptNode, error) {
+	return parser.binary(parser.multiplicative, "+", "-")
+}
+
+func (parser *scriptParser) multiplicative() (scriptNode, error) {
+	return parser.binary(parser.unary, "*", "/", "%")
+}
+
+// binary left associative operators of one precedence level
+func (parser *scriptParser) binary(operand func() (scriptNode, error), ops ...string) (scriptNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := parser.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = scriptBinary{op: op, left: left, right: right}
+	}
+}
+
+func (parser *scriptParser) unary() (scriptNode, error) {
+	if _, ok := parser.accept("-"); ok {
+		operand, err := parser.unary()
+		return scriptUnary{op: "-", operand: operand}, err
+	}
+	return parser.primary()
+}
+
+func (parser *scriptParser) primary() (scriptNode, error) {
+	tok := parser.next()
+	switch tok.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", tok.text, tok.pos)
+		}
+		return scriptLiteral{value}, nil
+	case tokenString:
+		return scriptLiteral{tok.text}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return scriptLiteral{true}, nil
+		case "false":
+			return scriptLiteral{false}, nil
+		case "null":
+			return scriptLiteral{nil}, nil
+		}
+		if _, ok := parser.accept("("); !ok {
+			return scriptField{tok.text}, nil
+		}
+		fn, ok := scriptFuncs[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown function %s at %d", tok.text, tok.pos)
+		}
+		call := scriptCall{name: tok.text, fn: fn}
+		if _, ok := parser.accept(")"); !ok {
+			for {
+				arg, err := parser.or()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if _, ok := parser.accept(")"); ok {
+					break
+				}
+				if _, ok := parser.accept(","); !ok {
+					return nil, fmt.Errorf("expected , or ) at %d", parser.peek().pos)
+				}
+			}
+		}
+		if len(call.args) < fn.min || (fn.max >= 0 && len(call.args) > fn.max) {
+			return nil, fmt.Errorf("%s at %d: wrong number of arguments, expected %s", tok.text, tok.pos, fn.usage)
+		}
+		return call, nil
+	case tokenOp:
+		if tok.text == "(" {
+			node, err := parser.or()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := parser.accept(")"); !ok {
+				return nil, fmt.Errorf("expected ) at %d", parser.peek().pos)
+			}
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+}
+
+// scriptFunc : a function of the script language, max -1 for any number of
+// arguments
+type scriptFunc struct {
+	min, max int
+	usage    string
+	call     func(env *ScriptEnv, args []interface{}) (interface{}, error)
+}
+
+// stringArgs the arguments as strings
+func stringArgs(args []interface{}) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("argument %d must be a string, got %s", i+1, scriptType(arg))
+		}
+		strs[i] = str
+	}
+	return strs, nil
+}
+
+// numberArgs the arguments as numbers
+func numberArgs(args []interface{}) ([]float64, error) {
+	numbers := make([]float64, len(args))
+	for i, arg := range args {
+		number, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf("argument %d must be a number, got %s", i+1, scriptType(arg))
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// stringFunc a function of string arguments
+func stringFunc(n int, usage string, fn func(args []string) (interface{}, error)) scriptFunc {
+	return scriptFunc{n, n, usage, func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+		strs, err := stringArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return fn(strs)
+	}}
+}
+
+// historyFunc reduce the points of a metric of the object within a window
+func historyFunc(reduce func(points []HistoryPoint) interface{}) scriptFunc {
+	return scriptFunc{2, 2, `("metric", "window")`, func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+		strs, err := stringArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		points, err := env.points(strs[0], strs[1])
+		if err != nil || len(points) == 0 {
+			return nil, err
+		}
+		return reduce(points), nil
+	}}
+}
+
+// matchingObjects the objects of resource matching the expression, all
+// when it is empty
+func matchingObjects(env *ScriptEnv, resource string, expr string) ([]map[string]interface{}, error) {
+	list, err := env.list(resource)
+	if err != nil {
+		return nil, err
+	}
+	var script *Script
+	if expr != "" {
+		if script, err = cachedScript(expr); err != nil {
+			return nil, err
+		}
+	}
+	var objects []map[string]interface{}
+	for _, item := range list {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if script != nil {
+			match, err := script.Match(env.with(object, resource))
+			if err != nil {
+				return nil, err
+			}
+			if !match {
+				continue
+			}
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+var scriptFuncs map[string]scriptFunc
+
+func init() {
+	scriptFuncs = map[string]scriptFunc{
+		"len": {1, 1, "(value)", func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case nil:
+				return 0.0, nil
+			case string:
+				return float64(len([]rune(v))), nil
+			case []interface{}:
+				return float64(len(v)), nil
+			case map[string]interface{}:
+				return float64(len(v)), nil
+			}
+			return nil, fmt.Errorf("expected a string or list, got %s", scriptType(args[0]))
+		}},
+		"lower": stringFunc(1, "(string)", func(args []string) (interface{}, error) { return strings.ToLower(args[0]), nil }),
+		"upper": stringFunc(1, "(string)", func(args []string) (interface{}, error) { return strings.ToUpper(args[0]), nil }),
+		"contains": stringFunc(2, "(string, substring)", func(args []string) (interface{}, error) {
+			return strings.Contains(args[0], args[1]), nil
+		}),
+		"startsWith": stringFunc(2, "(string, prefix)", func(args []string) (interface{}, error) {
+			return strings.HasPrefix(args[0], args[1]), nil
+		}),
+		"endsWith": stringFunc(2, "(string, suffix)", func(args []string) (interface{}, error) {
+			return strings.HasSuffix(args[0], args[1]), nil
+		}),
+		"matches": stringFunc(2, "(string, regexp)", func(args []string) (interface{}, error) {
+			re, err := regexp.Compile(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString(args[0]), nil
+		}),
+		"has": {1, 1, `("field")`, func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+			strs, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			_, found := lookupField(env.Object, strs[0])
+			return found, nil
+		}},
+		"abs": {1, 1, "(number)", func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+			numbers, err := numberArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			return math.Abs(numbers[0]), nil
+		}},
+		"min": {1, -1, "(number, ...)", func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+			numbers, err := numberArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			min := numbers[0]
+			for _, n := range numbers[1:] {
+				min = math.Min(min, n)
+			}
+			return min, nil
+		}},
+		"max": {1, -1, "(number, ...)", func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+			numbers, err := numberArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			max := numbers[0]
+			for _, n := range numbers[1:] {
+				max = math.Max(max, n)
+			}
+			return max, nil
+		}},
+		"count": {1, 2, `("resource"[, "expression"])`, func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+			strs, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			expr := ""
+			if len(strs) > 1 {
+				expr = strs[1]
+			}
+			objects, err := matchingObjects(env, strs[0], expr)
+			return float64(len(objects)), err
+		}},
+		"sum": {2, 3, `("resource", "field"[, "expression"])`, func(env *ScriptEnv, args []interface{}) (interface{}, error) {
+			strs, err := stringArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			expr := ""
+			if len(strs) > 2 {
+				expr = strs[2]
+			}
+			objects, err := matchingObjects(env, strs[0], expr)
+			if err != nil {
+				return nil, err
+			}
+			sum := 0.0
+			for _, object := range objects {
+				if v, ok := lookupField(object, strs[1]); ok {
+					if n, ok := v.(float64); ok {
+						sum += n
+					}
+				}
+			}
+			return sum, nil
+		}},
+		"avg_over": historyFunc(func(points []HistoryPoint) interface{} {
+			sum := 0.0
+			for _, point := range points {
+				sum += point.Value
+			}
+			return sum / float64(len(points))
+		}),
+		"min_over": historyFunc(func(points []HistoryPoint) interface{} {
+			min := points[0].Value
+			for _, point := range points {
+				min = math.Min(min, point.Value)
+			}
+			return min
+		}),
+		"max_over": historyFunc(func(points []HistoryPoint) interface{} {
+			max := points[0].Value
+			for _, point := range points {
+				max = math.Max(max, point.Value)
+			}
+			return max
+		}),
+		"delta": historyFunc(func(points []HistoryPoint) interface{} {
+			return points[len(points)-1].Value - points[0].Value
+		}),
+	}
+}
+
+// ScriptResult : value of an expression evaluated without object
+type ScriptResult struct {
+	Expr  string      `json:"expr"`
+	Value interface{} `json:"value"`
+}
+
+func init() {
+	registerCommand("expr", "[--resource r] [--store f] expression: list the objects of r matching the expression, or print its value", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("expr")
+		resource := flags.String("resource", "", "list the objects of this resource matching the expression")
+		storeFile := flags.String("store", envOr("RADISH_STORE", ""), "store with the metric history of serve --history, for the history functions")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("expr: expected one expression")
+		}
+		script, err := ParseScript(flags.Arg(0))
+		if err != nil {
+			return nil, usageError("expr: %s", err)
+		}
+		if *resource != "" && (!isPollResource(*resource) || *resource == ResourceOverview) {
+			return nil, usageError("expr: unknown list resource %q", *resource)
+		}
+		env := &ScriptEnv{Now: time.Now()}
+		if *storeFile != "" {
+			store, err := OpenKVStore(*storeFile)
+			if err != nil {
+				return nil, usageError("store: %s", err)
+			}
+			defer store.Close()
+			policy, _ := ParseRetentionPolicy(defaultRetention)
+			if env.History, err = NewMetricHistory(store, policy, 0); err != nil {
+				return nil, err
+			}
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		info := rabbitmq.info()
+		env.Info = &info
+		if *resource == "" {
+			value, err := script.Eval(env)
+			if err != nil {
+				return nil, err
+			}
+			return ScriptResult{Expr: script.String(), Value: value}, nil
+		}
+		list, _, err := ListQuery{Script: script, Env: env.with(nil, *resource)}.Apply(resourceOf(rabbitmq.info(), *resource))
+		return list, err
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptEval(t *testing.T) {
+	info := reportInfo()
+	object := map[string]interface{}{"name": "orders", "messages": 20000.0, "consumers": 1.0, "arguments": map[string]interface{}{"x-queue-type": "quorum"}}
+	env := &ScriptEnv{Object: object, Resource: ResourceQueues, Info: &info}
+	for expr, want := range map[string]interface{}{
+		`1 + 2 * 3`:                                          7.0,
+		`(1 + 2) * 3 % 4`:                                    1.0,
+		`messages / consumers - 1`:                           19999.0,
+		`messages > 1000 and consumers == 1`:                 true,
+		`not (messages > 1000) || name == "orders"`:          true,
+		`has("arguments") && len(name) == 6`:                 true,
+		`name ~ "ord*" && startsWith(upper(name), "ORD")`:    true,
+		`matches(name, "^o.+s$")`:                            true,
+		`missing == null && !(missing > 1)`:                  true,
+		`count("queues")`:                                    2.0,
+		`count("queues", "consumers == 0 and messages > 0")`: 1.0,
+		`sum("queues", "messages") - messages`:               5.0,
+		`max(1, messages, 3) + min(-2, abs(-7))`:             19998.0,
+		`messages / 0`:                                       nil,
+		`"a" + 'b'`:                                          "ab",
+	} {
+		script, err := ParseScript(expr)
+		assert.Nil(t, err, expr)
+		if err != nil {
+			continue
+		}
+		value, err := script.Eval(env)
+		assert.Nil(t, err, expr)
+		assert.Equal(t, want, value, expr)
+	}
+
+	for _, expr := range []string{`1 +`, `nope(1)`, `len()`, `(1`, `"open`, `a # b`} {
+		_, err := ParseScript(expr)
+		assert.NotNil(t, err, expr)
+	}
+	for _, expr := range []string{`name * 2`, `count("channels")`, `avg_over("queue_messages", "1h")`} {
+		script, _ := ParseScript(expr)
+		_, err := script.Eval(env)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestScriptHistory(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "script")
+	defer os.RemoveAll(dir)
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	defer store.Close()
+	policy, _ := ParseRetentionPolicy("10s:1d")
+	history, _ := NewMetricHistory(store, policy, 0)
+	start := time.Unix(1577880000, 0)
+	for i := 0; i < 6; i++ {
+		value := float64(100 + i*20)
+		history.Record([]MetricSample{{metricQueueMessages, []MetricLabel{{"vhost", "/"}, {"queue", "orders"}}, value}}, start.Add(time.Duration(i)*10*time.Second))
+	}
+	now := start.Add(time.Minute)
+	info := rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "orders", Messages: 600}, {Vhost: "/", Name: "new", Messages: 600}}}
+	env := &ScriptEnv{Info: &info, History: history, Now: now}
+
+	script, err := ParseScript(`messages > 3 * avg_over("queue_messages", "24h")`)
+	assert.Nil(t, err)
+	list, _, err := ListQuery{Script: script, Env: env.with(nil, ResourceQueues)}.Apply(info.Queues)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list.([]interface{})))
+
+	for expr, want := range map[string]float64{
+		`avg_over("queue_messages", "24h")`: 150,
+		`max_over("queue_messages", "1h")`:  200,
+		`min_over("queue_messages", "1h")`:  100,
+		`delta("queue_messages", "1h")`:     100,
+	} {
+		script, _ := ParseScript(expr)
+		value, err := script.Eval(env.with(map[string]interface{}{"vhost": "/", "name": "orders"}, ResourceQueues))
+		assert.Nil(t, err)
+		assert.Equal(t, want, value, expr)
+	}
+
+	rules := AlertRules{Rules: []AlertRule{{Name: "surge", Resource: ResourceQueues, Expr: `messages > 3 * avg_over("queue_messages", "24h")`}}}
+	assert.Nil(t, rules.compile())
+	engine := NewAlertEngine(rules, nil)
+	engine.UseMetricHistory(history)
+	changes := engine.Evaluate(&Snapshot{Info: info}, now)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, "orders", changes[0].Alert.Object)
+
+	query, err := ParseListQuery(url.Values{"expr": {`name == "new"`}})
+	assert.Nil(t, err)
+	assert.False(t, query.Empty())
+	_, err = ParseListQuery(url.Values{"expr": {`name ==`}})
+	assert.NotNil(t, err)
+}
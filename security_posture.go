@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// severities of posture findings, ordered
+var postureSeverities = []string{"info", "low", "medium", "high", "critical"}
+
+// severityRank position of a severity, -1 for unknown ones
+func severityRank(severity string) int {
+	for i, s := range postureSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// PostureFinding : a security weakness seen on the broker, connections
+// with the same weakness, user and vhost are counted together
+type PostureFinding struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Subject  string `json:"subject"`
+	Detail   string `json:"detail"`
+	Count    int    `json:"count"`
+}
+
+// loopbackHost true for localhost peers
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// AssessPosture check listeners and connections for plaintext transport,
+// passwords sent in clear and remote use of the guest account
+func AssessPosture(info rabtap.BrokerInfo) []PostureFinding {
+	findings := map[string]*PostureFinding{}
+	var order []string
+	add := func(severity string, rule string, subject string, detail string) {
+		key := rule + "\x00" + subject
+		if findings[key] == nil {
+			findings[key] = &PostureFinding{Severity: severity, Rule: rule, Subject: subject, Detail: detail}
+			order = append(order, key)
+		}
+		findings[key].Count++
+	}
+	for _, listener := range info.Overview.Listeners {
+		if listener.Protocol == "clustering" || tlsListener(listener.Protocol) {
+			continue
+		}
+		add("low", "plaintext-listener", listener.Node+" "+net.JoinHostPort(listener.IPAddress, fmt.Sprint(listener.Port)),
+			listener.Protocol+" listener without tls")
+	}
+	for _, conn := range info.Connections {
+		subject := fmt.Sprintf("user %s vhost %s", conn.User, conn.Vhost)
+		local := loopbackHost(conn.PeerHost)
+		if conn.User == "guest" && !local {
+			add("critical", "remote-guest", subject+" from "+conn.PeerHost, "default guest credentials used from a remote host")
+		}
+		if conn.Ssl || local {
+			continue
+		}
+		mechanism := strings.ToUpper(conn.AuthMechanism)
+		if mechanism == "PLAIN" || mechanism == "AMQPLAIN" {
+			add("high", "cleartext-password", subject, mechanism+" authentication over a plaintext connection")
+		} else {
+			add("medium", "plaintext-connection", subject, orDash(conn.Protocol)+" connection without tls")
+		}
+	}
+	report := []PostureFinding{}
+	for _, key := range order {
+		report = append(report, *findings[key])
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return severityRank(report[i].Severity) > severityRank(report[j].Severity)
+	})
+	return report
+}
+
+// PostureReport : security posture findings, most severe first
+type PostureReport []PostureFinding
+
+// AtLeast number of findings with at least the given severity
+func (report PostureReport) AtLeast(severity string) int {
+	count := 0
+	for _, finding := range report {
+		if severityRank(finding.Severity) >= severityRank(severity) {
+			count++
+		}
+	}
+	return count
+}
+
+// Table findings as table
+func (report PostureReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"SEVERITY", "RULE", "SUBJECT", "COUNT", "DETAIL"}}
+	for _, finding := range report {
+		color := Yellow
+		if severityRank(finding.Severity) >= severityRank("high") {
+			color = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: finding.Severity, Color: color},
+			{Text: finding.Rule},
+			{Text: finding.Subject},
+			{Text: format.Count(int64(finding.Count))},
+			{Text: finding.Detail},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("posture", "[--fail-on severity] report plaintext listeners and connections, cleartext passwords and remote guest logins", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("posture")
+		failOn := flags.String("fail-on", "high", "exit with the threshold code for findings of this severity or worse, none never fails")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if *failOn != "none" && severityRank(*failOn) < 0 {
+			return nil, usageError("posture: --fail-on must be none or one of %s", strings.Join(postureSeverities, ", "))
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		report := PostureReport(AssessPosture(rabbitmq.info()))
+		if *failOn != "none" {
+			if failed := report.AtLeast(*failOn); failed > 0 {
+				return report, thresholdError("%d findings of severity %s or worse", failed, *failOn)
+			}
+		}
+		return report, nil
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssessPosture(t *testing.T) {
+	info := rabtap.BrokerInfo{Connections: []rabtap.RabbitConnection{
+		{User: "guest", Vhost: "/", PeerHost: "10.1.2.3", AuthMechanism: "PLAIN", Protocol: "AMQP 0-9-1"},
+		{User: "guest", Vhost: "/", PeerHost: "127.0.0.1", AuthMechanism: "PLAIN"},
+		{User: "app", Vhost: "/", PeerHost: "10.1.2.4", AuthMechanism: "PLAIN"},
+		{User: "app", Vhost: "/", PeerHost: "10.1.2.5", AuthMechanism: "PLAIN"},
+		{User: "app", Vhost: "/", PeerHost: "10.1.2.6", AuthMechanism: "EXTERNAL", Ssl: true},
+		{User: "cert", Vhost: "/", PeerHost: "10.1.2.7", AuthMechanism: "EXTERNAL", Protocol: "MQTT 3.1.1"},
+	}}
+	info.Overview.Listeners = append(info.Overview.Listeners,
+		struct {
+			Node      string `json:"node"`
+			Protocol  string `json:"protocol"`
+			IPAddress string `json:"ip_address"`
+			Port      int    `json:"port"`
+		}{"rabbit@a", "amqp", "::", 5672},
+		struct {
+			Node      string `json:"node"`
+			Protocol  string `json:"protocol"`
+			IPAddress string `json:"ip_address"`
+			Port      int    `json:"port"`
+		}{"rabbit@a", "amqp/ssl", "::", 5671},
+	)
+
+	report := PostureReport(AssessPosture(info))
+	assert.Equal(t, PostureReport{
+		{Severity: "critical", Rule: "remote-guest", Subject: "user guest vhost / from 10.1.2.3", Detail: "default guest credentials used from a remote host", Count: 1},
+		{Severity: "high", Rule: "cleartext-password", Subject: "user guest vhost /", Detail: "PLAIN authentication over a plaintext connection", Count: 1},
+		{Severity: "high", Rule: "cleartext-password", Subject: "user app vhost /", Detail: "PLAIN authentication over a plaintext connection", Count: 2},
+		{Severity: "medium", Rule: "plaintext-connection", Subject: "user cert vhost /", Detail: "MQTT 3.1.1 connection without tls", Count: 1},
+		{Severity: "low", Rule: "plaintext-listener", Subject: "rabbit@a [::]:5672", Detail: "amqp listener without tls", Count: 1},
+	}, report)
+	assert.Equal(t, 3, report.AtLeast("high"))
+	assert.Equal(t, 5, report.AtLeast("info"))
+}
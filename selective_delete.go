@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+
+	"github.com/streadway/amqp"
+)
+
+// strategies of a selective delete
+const (
+	// DeleteRepublish republish kept messages to the tail of the same queue
+	DeleteRepublish = "republish"
+	// DeleteSwap move kept messages to a temporary queue and back, they are
+	// never only in radish's memory
+	DeleteSwap = "swap"
+)
+
+// SelectiveDeleteOptions : which messages of a queue to delete and how
+type SelectiveDeleteOptions struct {
+	Vhost    string
+	Queue    string
+	Strategy string
+	Criteria SearchCriteria
+	// Backup file receiving the deleted messages as json lines
+	Backup string
+}
+
+// swapQueue name of the temporary queue of the swap strategy
+func (opts SelectiveDeleteOptions) swapQueue() string {
+	return opts.Queue + ".radish-swap"
+}
+
+// DeletePlan : what a selective delete is going to do, shown before it runs
+type DeletePlan struct {
+	Vhost            string   `json:"vhost"`
+	Queue            string   `json:"queue"`
+	Strategy         string   `json:"strategy"`
+	Messages         int      `json:"messages"`
+	Scanned          int      `json:"scanned"`
+	EstimatedMatches int      `json:"estimatedMatches"`
+	Steps            []string `json:"steps"`
+	Warnings         []string `json:"warnings"`
+}
+
+// String the plan as text for the confirmation prompt
+func (plan DeletePlan) String() string {
+	text := fmt.Sprintf("queue %s in vhost %s holds %d messages, %d of the first %d match\n",
+		plan.Queue, plan.Vhost, plan.Messages, plan.EstimatedMatches, plan.Scanned)
+	for i, step := range plan.Steps {
+		text += fmt.Sprintf("  %d. %s\n", i+1, step)
+	}
+	for _, warning := range plan.Warnings {
+		text += "  ! " + warning + "\n"
+	}
+	return text
+}
+
+// PlanSelectiveDelete estimate the matches by searching the head of the
+// queue and describe the steps of the strategy
+func PlanSelectiveDelete(client *ManagementClient, opts SelectiveDeleteOptions, sample int) (DeletePlan, error) {
+	plan := DeletePlan{Vhost: opts.Vhost, Queue: opts.Queue, Strategy: opts.Strategy}
+	messages, err := client.QueueMessages(opts.Vhost, opts.Queue)
+	if err != nil {
+		return plan, err
+	}
+	plan.Messages = messages
+	result, err := SearchQueueGet(client, opts.Vhost, opts.Queue, sample, opts.Criteria)
+	if err != nil {
+		return plan, err
+	}
+	plan.Scanned, plan.EstimatedMatches = result.Scanned, len(result.Matches)
+
+	backup := "deleted messages are not kept, pass --backup to save them"
+	if opts.Backup != "" {
+		backup = "write deleted messages to " + opts.Backup
+	}
+	switch opts.Strategy {
+	case DeleteRepublish:
+		plan.Steps = []string{
+			fmt.Sprintf("get the %d messages one by one", messages),
+			backup,
+			"acknowledge matching messages, removing them",
+			"republish the others with confirms to the tail of " + opts.Queue + " before acknowledging them",
+		}
+	case DeleteSwap:
+		plan.Steps = []string{
+			"declare the durable queue " + opts.swapQueue(),
+			fmt.Sprintf("get the %d messages one by one", messages),
+			backup,
+			"acknowledge matching messages, removing them",
+			"publish the others with confirms to " + opts.swapQueue() + " before acknowledging them",
+			"move all messages from " + opts.swapQueue() + " back to " + opts.Queue,
+			"delete " + opts.swapQueue(),
+		}
+	default:
+		return plan, fmt.Errorf("unknown strategy %q", opts.Strategy)
+	}
+	plan.Warnings = []string{
+		"kept messages are republished through the default exchange, their original exchange and routing key are lost",
+		"messages published while the delete runs are interleaved with the kept ones",
+	}
+	return plan, nil
+}
+
+// publishingFromDelivery copy the properties and body of a delivery
+func publishingFromDelivery(d amqp.Delivery) amqp.Publishing {
+	return amqp.Publishing{
+		Headers: d.Headers, ContentType: d.ContentType, ContentEncoding: d.ContentEncoding,
+		DeliveryMode: d.DeliveryMode, Priority: d.Priority, CorrelationId: d.CorrelationId,
+		ReplyTo: d.ReplyTo, Expiration: d.Expiration, MessageId: d.MessageId, Timestamp: d.Timestamp,
+		Type: d.Type, UserId: d.UserId, AppId: d.AppId, Body: d.Body,
+	}
+}
+
+// deletedMessage : json line of the backup file
+type deletedMessage struct {
+	SearchMessage
+	Body string `json:"body"`
+}
+
+// republished wait for the confirm of a mandatory publish. The broker sends
+// the return of an unroutable message before its confirm, a return already
+// queued when the confirm arrives means the message went nowhere.
+func republished(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) error {
+	if confirm := <-confirms; !confirm.Ack {
+		return errors.New("broker did not confirm republished message")
+	}
+	select {
+	case ret := <-returns:
+		return fmt.Errorf("republished message was returned: %d %s", ret.ReplyCode, ret.ReplyText)
+	default:
+		return nil
+	}
+}
+
+// moveMessages get up to count messages from queue from. Messages drop
+// returns true for are passed to deleted and acknowledged, the others are
+// published to queue to and acknowledged once the broker confirmed them
+// without returning them.
+func moveMessages(ch *amqp.Channel, confirms <-chan amqp.Confirmation, returns <-chan amqp.Return, from string, to string, count int,
+	drop func(SearchMessage) bool, deleted func(SearchMessage) error) (kept int, dropped int, err error) {
+	for i := 1; i <= count; i++ {
+		delivery, ok, err := ch.Get(from, false)
+		if err != nil {
+			return kept, dropped, err
+		}
+		if !ok {
+			break
+		}
+		msg := searchMessageFromDelivery(i, delivery)
+		if drop(msg) {
+			if err := deleted(msg); err != nil {
+				delivery.Nack(false, true)
+				return kept, dropped, err
+			}
+			dropped++
+			if err := delivery.Ack(false); err != nil {
+				return kept, dropped, err
+			}
+			continue
+		}
+		if err := ch.Publish("", to, true, false, publishingFromDelivery(delivery)); err != nil {
+			delivery.Nack(false, true)
+			return kept, dropped, err
+		}
+		if err := republished(confirms, returns); err != nil {
+			delivery.Nack(false, true)
+			return kept, dropped, err
+		}
+		kept++
+		if err := delivery.Ack(false); err != nil {
+			return kept, dropped, err
+		}
+	}
+	return kept, dropped, nil
+}
+
+// SelectiveDeleteResult : outcome of a selective delete
+type SelectiveDeleteResult struct {
+	Plan    DeletePlan `json:"plan"`
+	Deleted int        `json:"deleted"`
+	Kept    int        `json:"kept"`
+	Backup  string     `json:"backup,omitempty"`
+}
+
+// SelectiveDelete remove the messages matching the criteria from the queue,
+// going through the number of messages the plan found
+func SelectiveDelete(conn *amqp.Connection, opts SelectiveDeleteOptions, plan DeletePlan) (SelectiveDeleteResult, error) {
+	result := SelectiveDeleteResult{Plan: plan, Backup: opts.Backup}
+	var backup io.Writer = ioutil.Discard
+	if opts.Backup != "" {
+		f, err := os.OpenFile(opts.Backup, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return result, err
+		}
+		defer f.Close()
+		backup = f
+	}
+	encoder := json.NewEncoder(backup)
+	deleted := func(msg SearchMessage) error {
+		return encoder.Encode(deletedMessage{msg, base64.StdEncoding.EncodeToString(msg.Body)})
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return result, err
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		return result, err
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+	target := opts.Queue
+	if opts.Strategy == DeleteSwap {
+		target = opts.swapQueue()
+		if _, err := ch.QueueDeclare(target, true, false, false, false, nil); err != nil {
+			return result, err
+		}
+	}
+	result.Kept, result.Deleted, err = moveMessages(ch, confirms, returns, opts.Queue, target, plan.Messages, opts.Criteria.Match, deleted)
+	if err != nil || opts.Strategy != DeleteSwap {
+		return result, err
+	}
+	keepAll := func(SearchMessage) bool { return false }
+	// on failure the swap queue is kept, it still holds the messages not
+	// moved back
+	if moved, _, err := moveMessages(ch, confirms, returns, target, opts.Queue, result.Kept, keepAll, deleted); err != nil {
+		return result, fmt.Errorf("moving messages back from %s failed, %d kept messages are left in %s: %s",
+			target, result.Kept-moved, target, err)
+	}
+	_, err = ch.QueueDelete(target, false, true, false)
+	return result, err
+}
+
+// Table plan and counts as table
+func (result SelectiveDeleteResult) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"QUEUE", "STRATEGY", "MESSAGES", "DELETED", "KEPT"}}
+	table.Rows = append(table.Rows, []Cell{
+		{Text: result.Plan.Queue},
+		{Text: result.Plan.Strategy},
+		{Text: format.Count(int64(result.Plan.Messages))},
+		{Text: format.Count(int64(result.Deleted)), Color: Yellow},
+		{Text: format.Count(int64(result.Kept))},
+	})
+	return table
+}
+
+func init() {
+	registerCommand("delete-messages", "[--vhost v] [--header name=value]... [--correlation-id id] [--message-id id] [--body regex] [--strategy republish|swap] [--backup f] [--dry-run] [--yes] <queue> remove matching messages", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("delete-messages")
+		opts := SelectiveDeleteOptions{}
+		flags.StringVar(&opts.Vhost, "vhost", "", "vhost of the queue, the default vhost when omitted")
+		var headers stringList
+		flags.Var(&headers, "header", "header value to match, repeatable")
+		flags.StringVar(&opts.Criteria.CorrelationID, "correlation-id", "", "correlation id to match")
+		flags.StringVar(&opts.Criteria.MessageID, "message-id", "", "message id to match")
+		flags.StringVar(&opts.Criteria.RoutingKey, "routing-key", "", "routing key to match")
+		body := flags.String("body", "", "regular expression the body must match")
+		flags.StringVar(&opts.Strategy, "strategy", DeleteSwap, "republish or swap")
+		flags.StringVar(&opts.Backup, "backup", "", "append deleted messages to this file as json lines")
+		sample := flags.Int("sample", 1000, "messages searched to estimate the matches")
+		dryRun := flags.Bool("dry-run", false, "only show the plan")
+		yes := flags.Bool("yes", false, "run without asking")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		opts.Vhost = cli.vhost(opts.Vhost)
+		if flags.NArg() != 1 {
+			return nil, usageError("delete-messages: expected queue name")
+		}
+		opts.Queue = flags.Arg(0)
+		var err error
+		if opts.Criteria.Headers, err = ParseHeaderCriteria(headers); err != nil {
+			return nil, usageError("delete-messages: %s", err)
+		}
+		if *body != "" {
+			if opts.Criteria.Body, err = regexp.Compile(*body); err != nil {
+				return nil, usageError("delete-messages: --body: %s", err)
+			}
+		}
+		if len(opts.Criteria.Headers) == 0 && opts.Criteria.CorrelationID == "" && opts.Criteria.MessageID == "" &&
+			opts.Criteria.RoutingKey == "" && opts.Criteria.Body == nil {
+			return nil, usageError("delete-messages: refusing to run without criteria, use purge-queues to empty a queue")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		if err := rabbitmq.writable(); err != nil {
+			return nil, err
+		}
+		if err := rabbitmq.scope.Check("queue", opts.Queue); err != nil {
+			return nil, err
+		}
+		plan, err := PlanSelectiveDelete(rabbitmq.management(), opts, *sample)
+		if err != nil {
+			return nil, err
+		}
+		if !cli.json {
+			fmt.Fprint(cli.out, plan.String())
+		}
+		if *dryRun {
+			if cli.json {
+				return plan, nil
+			}
+			return nil, nil
+		}
+		if !*yes && !cli.confirm("delete the matching messages?") {
+			return nil, nil
+		}
+		uri, err := VhostAMQPURL(rabbitmq.amqpURL, opts.Vhost)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := amqp.DialConfig(uri, rabbitmq.amqpConfig)
+		if err != nil {
+			return nil, connectionError(err)
+		}
+		defer conn.Close()
+		return SelectiveDelete(conn, opts, plan)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanSelectiveDelete(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/queues/%2F/orders":
+			w.Write([]byte(`{"messages": 3}`))
+		case "/api/queues/%2F/orders/get":
+			w.Write([]byte(`[
+				{"payload": "one", "payload_encoding": "string", "properties": {"headers": {"tenant": "acme"}}},
+				{"payload": "two", "payload_encoding": "string", "properties": {"headers": {"tenant": "other"}}}]`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	}))
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+	opts := SelectiveDeleteOptions{Vhost: "/", Queue: "orders", Strategy: DeleteSwap,
+		Criteria: SearchCriteria{Headers: map[string]string{"tenant": "acme"}}}
+
+	plan, err := PlanSelectiveDelete(NewManagementClient(uri, nil), opts, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, plan.Messages)
+	assert.Equal(t, 2, plan.Scanned)
+	assert.Equal(t, 1, plan.EstimatedMatches)
+	assert.Contains(t, plan.Steps, "declare the durable queue orders.radish-swap")
+	assert.Contains(t, plan.String(), "1 of the first 2 match")
+
+	opts.Strategy = "shuffle"
+	_, err = PlanSelectiveDelete(NewManagementClient(uri, nil), opts, 100)
+	assert.NotNil(t, err)
+}
+
+func TestPublishingFromDelivery(t *testing.T) {
+	delivery := amqp.Delivery{Headers: amqp.Table{"tenant": "acme"}, CorrelationId: "c-1",
+		DeliveryMode: amqp.Persistent, Priority: 4, Body: []byte("body")}
+	publishing := publishingFromDelivery(delivery)
+	assert.Equal(t, amqp.Table{"tenant": "acme"}, publishing.Headers)
+	assert.Equal(t, "c-1", publishing.CorrelationId)
+	assert.Equal(t, amqp.Persistent, publishing.DeliveryMode)
+	assert.Equal(t, uint8(4), publishing.Priority)
+	assert.Equal(t, []byte("body"), publishing.Body)
+}
+
+func TestRepublished(t *testing.T) {
+	confirms, returns := make(chan amqp.Confirmation, 1), make(chan amqp.Return, 1)
+	confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	assert.Nil(t, republished(confirms, returns))
+
+	confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: false}
+	assert.EqualError(t, republished(confirms, returns), "broker did not confirm republished message")
+
+	// the queue was deleted meanwhile, acked but returned
+	returns <- amqp.Return{ReplyCode: 312, ReplyText: "NO_ROUTE"}
+	confirms <- amqp.Confirmation{DeliveryTag: 3, Ack: true}
+	assert.EqualError(t, republished(confirms, returns), "republished message was returned: 312 NO_ROUTE")
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// Server : http backend of the serve mode
+type Server struct {
+	poller *Poller
+	canary *Canary
+	tokens *TokenStore
+	store  KVStore
+	mux    *http.ServeMux
+	// live tails, see EnableTail
+	rabbitmq   *Rabbitmq
+	tailLimits TailLimits
+	tails      int32
+	// operator actions, see EnableActions
+	operator    operatorClient
+	audit       *AuditLog
+	idempotency idempotencyCache
+	alerts      *AlertEngine
+	history     *MetricHistory
+	slos        *SLOTracker
+	// defaultVhost of requests without vhost, see UseDefaultVhost
+	defaultVhost string
+}
+
+// NewServer create the backend serving data of the poller
+func NewServer(poller *Poller) *Server {
+	server := &Server{poller: poller, mux: http.NewServeMux()}
+	server.mux.HandleFunc("/healthz", server.handleHealth)
+	server.mux.HandleFunc("/readyz", server.handleReady)
+	server.mux.HandleFunc("/metrics", server.handleMetrics)
+	server.mux.HandleFunc("/refresh", server.handleRefresh)
+	server.mux.HandleFunc("/api/snapshot", server.handleSnapshot)
+	server.mux.HandleFunc("/api/preferences", server.handlePreferences)
+	server.mux.HandleFunc("/api/views", server.handleViews)
+	server.mux.HandleFunc("/api/views/", server.handleViews)
+	server.mux.HandleFunc("/api/markers", server.handleMarkers)
+	server.mux.HandleFunc("/api/markers/", server.handleMarkers)
+	server.mux.HandleFunc("/api/", server.handleResource)
+	server.mux.Handle("/", NewSPAHandler(staticFiles))
+	return server
+}
+
+// UseStore keep user data like preferences in store
+func (server *Server) UseStore(store KVStore) {
+	server.store = store
+}
+
+// RequireTokens only serve api requests with a bearer token of store, the
+// health endpoints and the client stay open
+func (server *Server) RequireTokens(store *TokenStore) {
+	server.tokens = store
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if server.tokens != nil && apiPath(r.URL.Path) {
+		var ok bool
+		if r, ok = server.authorize(w, r); !ok {
+			return
+		}
+	}
+	serveGzip(w, r, server.mux)
+}
+
+// EnableProfiling serve the go profiler under /debug/pprof/
+func (server *Server) EnableProfiling() {
+	server.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	server.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	server.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	server.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	server.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// writeJSON send v as json response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleHealth the process is alive
+func (server *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady a recent broker snapshot is available
+func (server *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	res := map[string]interface{}{
+		"ready":              server.poller.Ready(),
+		"snapshotAgeSeconds": server.poller.Staleness().Seconds(),
+	}
+	if !server.poller.Ready() {
+		writeJSON(w, http.StatusServiceUnavailable, res)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleSnapshot the latest broker snapshot with its fetch times
+func (server *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	snapshot := server.snapshot(r)
+	if snapshot == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "no snapshot yet"})
+		return
+	}
+	setSnapshotAge(w, snapshot.Fetched)
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// setSnapshotAge tell clients how old the served data is, it is cached by
+// the poller and must not be cached again
+func setSnapshotAge(w http.ResponseWriter, fetched time.Time) {
+	age := time.Since(fetched)
+	if age < 0 {
+		age = 0
+	}
+	w.Header().Set("X-Snapshot-Age", strconv.FormatFloat(age.Seconds(), 'f', 3, 64))
+	w.Header().Set("Last-Modified", fetched.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-cache")
+}
+
+// resourceOf the list or object of resource in info
+func resourceOf(info rabtap.BrokerInfo, resource string) interface{} {
+	switch resource {
+	case ResourceOverview:
+		return info.Overview
+	case ResourceConnections:
+		return info.Connections
+	case ResourceExchanges:
+		return info.Exchanges
+	case ResourceQueues:
+		return info.Queues
+	case ResourceConsumers:
+		return info.Consumers
+	case ResourceBindings:
+		return info.Bindings
+	}
+	return nil
+}
+
+// TableResult : a table of the serve api, with the numbers formatted like
+// the command line does
+type TableResult struct {
+	Headers []string   `json:"headers"`
+	Rows    [][]string `json:"rows"`
+}
+
+// resourceTable the queues or connections of list as the table of the
+// command line, numbers humanized unless format is raw
+func resourceTable(resource string, list interface{}, format NumberFormat) (TableResult, error) {
+	result := TableResult{Rows: [][]string{}}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return result, err
+	}
+	var tabular Tabular
+	switch resource {
+	case ResourceQueues:
+		var queues []rabtap.RabbitQueue
+		err = json.Unmarshal(data, &queues)
+		tabular = QueueList{Queues: queues, MaxMessages: defaultMaxMessages}
+	case ResourceConnections:
+		var connections []rabtap.RabbitConnection
+		err = json.Unmarshal(data, &connections)
+		tabular = ConnectionList{Connections: connections}
+	default:
+		return result, fmt.Errorf("%s have no table format", resource)
+	}
+	if err != nil {
+		return result, err
+	}
+	table := tabular.Table(format)
+	result.Headers = table.Headers
+	for _, row := range table.Rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = cell.Text
+		}
+		result.Rows = append(result.Rows, cells)
+	}
+	return result, nil
+}
+
+// handleResource a single resource class of the snapshot under
+// /api/<resource>. With ?fresh=true or a POST to /api/<resource>/refresh
+// the resource is fetched before answering, concurrent fresh requests share
+// one broker request. Lists are paged with ?limit= and ?offset= and
+// projected with ?fields=, X-Total-Count has the size of the whole list.
+// Queues and connections come as table with humanized numbers with
+// ?format=table, exact ones with ?raw=true as well.
+func (server *Server) handleResource(w http.ResponseWriter, r *http.Request) {
+	resource := strings.TrimPrefix(r.URL.Path, "/api/")
+	refresh := strings.HasSuffix(resource, "/refresh")
+	resource = strings.TrimSuffix(resource, "/refresh")
+	if !isPollResource(resource) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("unknown resource %q", resource)})
+		return
+	}
+	if refresh && r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	query, err := ParseListQuery(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if fresh, _ := strconv.ParseBool(r.URL.Query().Get("fresh")); fresh || refresh {
+		if err := server.poller.FetchNow(resource); err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	snapshot := server.snapshot(r)
+	if snapshot == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "no snapshot yet"})
+		return
+	}
+	setSnapshotAge(w, snapshot.FetchedAt[resource])
+	result := resourceOf(snapshot.Info, resource)
+	query.Env = &ScriptEnv{Resource: resource, Info: &snapshot.Info, History: server.history, Now: time.Now()}
+	if !query.Empty() {
+		var total int
+		if result, total, err = query.Apply(result); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	}
+	if r.URL.Query().Get("format") == "table" {
+		raw, _ := strconv.ParseBool(r.URL.Query().Get("raw"))
+		table, err := resourceTable(resource, result, NumberFormat{Raw: raw})
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, table)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleRefresh trigger an immediate fetch of the ?resource= classes
+func (server *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	if err := server.poller.Refresh(r.URL.Query()["resource"]...); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "refresh scheduled"})
+}
+
+// ListenAndServe serve on addr until ctx is done, in flight requests get
+// the shutdown timeout to finish
+func (server *Server) ListenAndServe(ctx context.Context, addr string, shutdownTimeout time.Duration) error {
+	srv := &http.Server{Addr: addr, Handler: server}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+func init() {
+	registerCommand("serve", "[--listen addr] [--interval d] [--poll queues=5s,...] [--reconcile] [--pprof] [--events] [--canary d] [--statsd addr] [--graphite addr] [--influx url] [--otlp url] [--tokens f] [--store f] [--tail] [--actions] [--alert-rules f] run the http backend", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("serve")
+		listen := flags.String("listen", "127.0.0.1:8080", "address to listen on")
+		interval := flags.Duration("interval", defaultPollInterval, "default broker poll interval")
+		poll := flags.String("poll", "", "per resource intervals, e.g. queues=5s,bindings=5m")
+		reconcile := flags.Bool("reconcile", false, "re-fetch resources when the snapshot has dangling references")
+		fetchTimeout := flags.Duration("fetch-timeout", defaultFetchTimeout, "abort a management api fetch after this long")
+		profiling := flags.Bool("pprof", false, "serve the go profiler under /debug/pprof/")
+		listenEvents := flags.Bool("events", false, "listen to the event exchange for immediate change detection")
+		canaryInterval := flags.Duration("canary", 0, "run a latency canary at this interval and export its percentiles")
+		statsd := flags.String("statsd", "", "push metrics to this statsd address")
+		graphite := flags.String("graphite", "", "push metrics to this graphite plaintext address")
+		influx := flags.String("influx", "", "push metrics to this influxdb write url")
+		otlp := flags.String("otlp", "", "push metrics to this otlp/http metrics url, e.g. http://collector:4318/v1/metrics")
+		otlpHeaders := flags.String("otlp-headers", "", "headers of otlp requests, e.g. api-key=secret")
+		emitPrefix := flags.String("emit-prefix", "radish.", "prefix of pushed metric names")
+		emitTags := flags.String("emit-tags", "", "tags added to pushed metrics, e.g. env=prod,dc=fra")
+		emitInterval := flags.Duration("emit-interval", defaultPollInterval, "interval to push metrics at")
+		tokensFile := flags.String("tokens", "", "require bearer tokens of this token file, see token-issue")
+		tail := flags.Bool("tail", false, "serve live tails of queues and exchanges over websockets under /api/tail")
+		tailLimits := TailLimits{}
+		flags.Float64Var(&tailLimits.Rate, "tail-rate", 50, "messages per second sent to a tail client, the rest is dropped")
+		flags.IntVar(&tailLimits.MaxBytes, "tail-max-bytes", 64*1024, "truncate tailed bodies to this size")
+		flags.DurationVar(&tailLimits.Duration, "tail-duration", 10*time.Minute, "close tail sessions after this time")
+		flags.IntVar(&tailLimits.Sessions, "tail-sessions", 4, "concurrent tail sessions")
+		actions := flags.Bool("actions", false, "serve purge, close and delete under /api/actions/")
+		auditFile := flags.String("audit", envOr("RADISH_AUDIT", defaultAuditFile), "audit log of the operator actions, a file, sqlite .db or s3://bucket/prefix")
+		alertRules := flags.String("alert-rules", envOr("RADISH_ALERT_RULES", ""), "evaluate the alert rules of this yaml file and serve them under /api/alerts")
+		history := flags.Bool("history", false, "record broker metrics in the store and serve them under /api/history")
+		retention := flags.String("retention", defaultRetention, "resolutions of the metric history and how long they are kept, like 10s:24h,5m:30d")
+		historyMaxMB := flags.Int("history-max-mb", 0, "drop the oldest history points beyond this size, 0 keeps all within the retention")
+		storeFile := flags.String("store", envOr("RADISH_STORE", ""), "keep user preferences, saved views, alert acks and history in this json file, sqlite .db or s3://bucket/prefix")
+		configFile := flags.String("config", envOr("RADISH_SERVE_CONFIG", ""), "yaml file with profile, interval, poll, rules and webhooks, reloaded on change or SIGHUP")
+		baselineFile := flags.String("baseline", envOr("RADISH_BASELINE", ""), "alert on deviations from this baseline of the baseline command")
+		slosFile := flags.String("slos", envOr("RADISH_SLOS", ""), "track the queue slos of this file in the metric history, needs --history")
+		maintenanceFile := flags.String("maintenance", envOr("RADISH_MAINTENANCE", ""), "maintenance windows file alerts are suppressed or annotated in, reloaded on change")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		sources := DaemonSources{
+			Login:           cli.baseLogin,
+			Profile:         cli.profile,
+			ProfilesFile:    cli.profilesFile,
+			Interval:        *interval,
+			Poll:            *poll,
+			RulesFile:       *alertRules,
+			ConfigFile:      *configFile,
+			MaintenanceFile: *maintenanceFile,
+		}
+		settings, err := sources.Load()
+		if err != nil {
+			return nil, usageError("serve: %s", err)
+		}
+		intervals := settings.Intervals
+		tags, err := ParseTags(*emitTags)
+		if err != nil {
+			return nil, usageError("%s", err)
+		}
+		var tokens *TokenStore
+		if *tokensFile != "" {
+			if tokens, err = LoadTokenStore(*tokensFile); err != nil {
+				return nil, usageError("tokens: %s", err)
+			}
+		}
+		policy, err := ParseRetentionPolicy(*retention)
+		if err != nil {
+			return nil, usageError("retention: %s", err)
+		}
+		if *history && *storeFile == "" {
+			return nil, usageError("serve: --history needs --store")
+		}
+		var slos []SLO
+		if *slosFile != "" {
+			if !*history {
+				return nil, usageError("serve: --slos needs --history")
+			}
+			if slos, err = LoadSLOs(*slosFile); err != nil {
+				return nil, usageError("slos: %s", err)
+			}
+		}
+		var store KVStore
+		if *storeFile != "" {
+			if store, err = OpenKVStore(*storeFile); err != nil {
+				return nil, usageError("store: %s", err)
+			}
+			defer store.Close()
+		}
+		var audit *AuditLog
+		if *actions {
+			if audit, err = OpenAuditLog(*auditFile); err != nil {
+				return nil, usageError("audit: %s", err)
+			}
+			defer audit.Close()
+		}
+		emitterOpts := EmitterOptions{Prefix: *emitPrefix, Tags: tags}
+		var emitters []Emitter
+		if *statsd != "" {
+			emitter, err := NewStatsdEmitter(*statsd, emitterOpts)
+			if err != nil {
+				return nil, usageError("statsd: %s", err)
+			}
+			emitters = append(emitters, emitter)
+		}
+		if *graphite != "" {
+			emitters = append(emitters, &GraphiteEmitter{EmitterOptions: emitterOpts, Addr: *graphite})
+		}
+		if *influx != "" {
+			emitters = append(emitters, NewInfluxEmitter(*influx, emitterOpts))
+		}
+		if *otlp != "" {
+			headers, err := ParseTags(*otlpHeaders)
+			if err != nil {
+				return nil, usageError("otlp-headers: %s", err)
+			}
+			// otel metric names are namespaced with dots
+			emitter := NewOTLPEmitter(*otlp, EmitterOptions{Prefix: "radish.", Tags: tags})
+			for _, header := range headers {
+				emitter.Headers[header.Name] = header.Value
+			}
+			emitters = append(emitters, emitter)
+		}
+		cli.login = settings.Login
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		poller := NewPoller(rabbitmq, intervals)
+		daemon := NewDaemon(poller, settings)
+		poller.Reconcile = *reconcile
+		poller.Timeout = *fetchTimeout
+		subsystemLog("poller").Infof("poll intervals %s", intervals)
+		go poller.Run(ctx)
+		if len(emitters) > 0 {
+			go RunEmitters(ctx, poller, emitters, *emitInterval)
+		}
+		if *listenEvents {
+			go rabbitmq.ListenEvents(ctx, "#", poller.Events)
+			go RefreshOnEvents(ctx, poller)
+		}
+		subsystemLog("server").Infof("listening on %s", *listen)
+		server := NewServer(poller)
+		server.UseDefaultVhost(cli.login.DefaultVhost)
+		if tokens != nil {
+			server.RequireTokens(tokens)
+		}
+		if store != nil {
+			server.UseStore(store)
+		}
+		compaction := map[string]func(time.Time) error{}
+		if *baselineFile != "" {
+			baseline, err := LoadBaseline(*baselineFile)
+			if err != nil {
+				return nil, usageError("baseline: %s", err)
+			}
+			RegisterAnalyzer(baseline)
+		}
+		var metrics *MetricHistory
+		if *history {
+			if metrics, err = NewMetricHistory(store, policy, int64(*historyMaxMB)*1024*1024); err != nil {
+				return nil, err
+			}
+		}
+		if len(slos) > 0 {
+			tracker := NewSLOTracker(metrics, slos)
+			server.EnableSLOs(tracker)
+			RegisterAnalyzer(tracker)
+			subsystemLog("slo").Infof("tracking %d slos", len(slos))
+		}
+		if *alertRules != "" || *configFile != "" || *baselineFile != "" || len(slos) > 0 {
+			engine := NewAlertEngine(settings.Rules, store)
+			engine.SetMaintenance(settings.Maintenance)
+			server.EnableAlerts(engine)
+			go RunAlerts(ctx, poller, engine, intervals.Min())
+			if store != nil {
+				compaction["alert history"] = engine.CompactHistory
+			}
+			daemon.Alerts = engine
+			daemon.Notifier = NewAlertNotifier(settings.Webhooks)
+			go daemon.Notifier.Run(ctx, engine)
+		}
+		if *history {
+			server.EnableHistory(metrics)
+			if daemon.Alerts != nil {
+				daemon.Alerts.UseMetricHistory(metrics)
+			}
+			subsystemLog("history").Infof("recording metrics with retention %s", policy)
+			go RunHistory(ctx, poller, metrics)
+			compaction["metric history"] = metrics.Compact
+		}
+		if len(compaction) > 0 {
+			go RunCompaction(ctx, time.Minute, compaction)
+		}
+		if *tail {
+			server.EnableTail(rabbitmq, tailLimits)
+		}
+		if *actions {
+			if tokens == nil {
+				subsystemLog("server").Warnf("operator actions are enabled without --tokens, anyone reaching %s can use them", *listen)
+			}
+			server.EnableActions(rabbitmq.management(), audit)
+		}
+		if *canaryInterval > 0 {
+			server.canary = NewCanary(CanaryOptions{Interval: *canaryInterval})
+			manager := NewAMQPManager(rabbitmq.amqpURL, rabbitmq.amqpConfig, AMQPManagerOptions{})
+			go manager.Run(ctx)
+			go func() {
+				if err := server.canary.Run(ctx, manager, nil); err != nil {
+					subsystemLog("canary").Errorf("canary stopped: %s", err)
+				}
+			}()
+		}
+		if *profiling {
+			server.EnableProfiling()
+		}
+		daemon.Connect = func(login RabbitmqLoginDetails) (brokerFetcher, error) {
+			if rabbitmq.offline {
+				return nil, ErrOffline
+			}
+			next := NewRabbitmq()
+			next.recorder = rabbitmq.recorder
+			if err := next.Connect(login); err != nil {
+				return nil, err
+			}
+			onShutdown("rabbitmq", func(ctx context.Context) error {
+				return next.Close()
+			})
+			if *tail || *actions || *canaryInterval > 0 {
+				subsystemLog("config").Warnf("tails, operator actions and the canary keep using the broker they started with until restarted")
+			}
+			return next.fetcher(), nil
+		}
+		go WatchConfig(ctx, sources.Files(), configCheckInterval, func() { daemon.Reload(sources) })
+		if err := server.ListenAndServe(ctx, *listen, cli.shutdownTimeout); err != nil && err != http.ErrServerClosed {
+			return nil, err
+		}
+		return nil, nil
+	})
+}
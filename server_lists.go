@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ListQuery : filter, sort, limit, offset and field selection of a list
+// endpoint
+type ListQuery struct {
+	Filter FilterExpr `json:"filter,omitempty"`
+	// Script expression objects have to match as well, evaluated in Env
+	Script *Script    `json:"-"`
+	Env    *ScriptEnv `json:"-"`
+	Sort   string     `json:"sort,omitempty"`
+	Limit  int        `json:"limit,omitempty"`
+	Offset int        `json:"offset,omitempty"`
+	Fields []string   `json:"fields,omitempty"`
+}
+
+// ParseListQuery read ?filter=&expr=&sort=&limit=&offset=&fields=, like
+// ?filter=messages>1000&sort=-messages&fields=name,vhost,message_stats.publish
+func ParseListQuery(values url.Values) (ListQuery, error) {
+	query := ListQuery{Sort: values.Get("sort"), Fields: splitList(values.Get("fields"))}
+	var err error
+	if query.Filter, err = ParseFilterExpr(values.Get("filter")); err != nil {
+		return query, err
+	}
+	if expr := values.Get("expr"); expr != "" {
+		if query.Script, err = ParseScript(expr); err != nil {
+			return query, err
+		}
+	}
+	if str := values.Get("limit"); str != "" {
+		if query.Limit, err = strconv.Atoi(str); err != nil || query.Limit < 0 {
+			return query, fmt.Errorf("invalid limit %q", str)
+		}
+	}
+	if str := values.Get("offset"); str != "" {
+		if query.Offset, err = strconv.Atoi(str); err != nil || query.Offset < 0 {
+			return query, fmt.Errorf("invalid offset %q", str)
+		}
+	}
+	return query, nil
+}
+
+// Empty true when the query returns the list as it is
+func (query ListQuery) Empty() bool {
+	return len(query.Filter) == 0 && query.Script == nil && query.Sort == "" && query.Limit == 0 && query.Offset == 0 && len(query.Fields) == 0
+}
+
+// Apply filter, sort, page and project the json list of v, the second
+// result is the size of the filtered list. Values that are not lists are
+// returned unchanged.
+func (query ListQuery) Apply(v interface{}) (interface{}, int, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, 0, err
+	}
+	var list []interface{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return v, 1, nil
+	}
+	if len(query.Filter) > 0 || query.Script != nil {
+		env := query.Env
+		if env == nil {
+			env = &ScriptEnv{}
+		}
+		matching := []interface{}{}
+		for _, item := range list {
+			object, ok := item.(map[string]interface{})
+			if !ok || !query.Filter.Match(object) {
+				continue
+			}
+			if query.Script != nil {
+				match, err := query.Script.Match(env.with(object, env.Resource))
+				if err != nil {
+					return nil, 0, err
+				}
+				if !match {
+					continue
+				}
+			}
+			matching = append(matching, item)
+		}
+		list = matching
+	}
+	if query.Sort != "" {
+		sortObjects(list, query.Sort)
+	}
+	total := len(list)
+	if query.Offset >= len(list) {
+		list = list[:0]
+	} else {
+		list = list[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < len(list) {
+		list = list[:query.Limit]
+	}
+	if len(query.Fields) > 0 {
+		for i, item := range list {
+			if object, ok := item.(map[string]interface{}); ok {
+				list[i] = selectFields(object, query.Fields)
+			}
+		}
+	}
+	return list, total, nil
+}
+
+// selectFields copy the dotted field paths of object, missing fields are
+// left out
+func selectFields(object map[string]interface{}, fields []string) map[string]interface{} {
+	selected := map[string]interface{}{}
+	for _, field := range fields {
+		value, found := lookupField(object, field)
+		if !found {
+			continue
+		}
+		path := strings.Split(field, ".")
+		target := selected
+		for _, key := range path[:len(path)-1] {
+			next, ok := target[key].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				target[key] = next
+			}
+			target = next
+		}
+		target[path[len(path)-1]] = value
+	}
+	return selected
+}
+
+// gzipWriter : response writer compressing the body
+type gzipWriter struct {
+	http.ResponseWriter
+	writer   *gzip.Writer
+	hijacked bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	return w.writer.Write(data)
+}
+
+// Flush send the compressed data written so far
+func (w *gzipWriter) Flush() {
+	w.writer.Flush()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hand the connection to handlers taking it over, like websockets
+func (w *gzipWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer can not be hijacked")
+	}
+	w.hijacked = true
+	return hijacker.Hijack()
+}
+
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+// acceptsGzip true when the client announced gzip support
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// serveGzip call handler with a compressing writer when the client
+// accepts gzip. Protocol upgrades like websockets take over the connection
+// and are passed on as they are.
+func serveGzip(w http.ResponseWriter, r *http.Request, handler http.Handler) {
+	if r.Header.Get("Upgrade") != "" {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(r) {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	writer := gzipWriters.Get().(*gzip.Writer)
+	writer.Reset(w)
+	gw := &gzipWriter{ResponseWriter: w, writer: writer}
+	defer func() {
+		if !gw.hijacked {
+			writer.Close()
+		}
+		gzipWriters.Put(writer)
+	}()
+	w.Header().Set("Content-Encoding", "gzip")
+	handler.ServeHTTP(gw, r)
+}
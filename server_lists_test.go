@@ -0,0 +1,58 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListQuery(t *testing.T) {
+	query, err := ParseListQuery(url.Values{"limit": {"2"}, "offset": {"1"}, "fields": {"name,stats.rate,missing"}})
+	assert.Nil(t, err)
+	list := []map[string]interface{}{
+		{"name": "a"},
+		{"name": "b", "vhost": "/", "stats": map[string]interface{}{"rate": 1.5, "count": 3}},
+		{"name": "c"},
+		{"name": "d"},
+	}
+	result, total, err := query.Apply(list)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "b", "stats": map[string]interface{}{"rate": 1.5}},
+		map[string]interface{}{"name": "c"},
+	}, result)
+
+	result, _, _ = ListQuery{Offset: 10}.Apply(list)
+	assert.Equal(t, []interface{}{}, result)
+
+	_, err = ParseListQuery(url.Values{"limit": {"-1"}})
+	assert.NotNil(t, err)
+}
+
+func TestServerGzip(t *testing.T) {
+	poller := newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second})
+	poller.Poll()
+	server := NewServer(poller)
+
+	req := httptest.NewRequest("GET", "/api/queues?fields=name&limit=1", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "1", rec.Header().Get("X-Total-Count"))
+	reader, err := gzip.NewReader(rec.Body)
+	assert.Nil(t, err)
+	var queues []map[string]interface{}
+	assert.Nil(t, json.NewDecoder(reader).Decode(&queues))
+	assert.Equal(t, []map[string]interface{}{{"name": "q1"}}, queues)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/queues", nil))
+	assert.Equal(t, "", rec.Header().Get("Content-Encoding"))
+}
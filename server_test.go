@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerHealth(t *testing.T) {
+	poller := newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second})
+	server := NewServer(poller)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	poller.Poll()
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	poller.fetchedAt[ResourceQueues] = time.Now().Add(-time.Minute)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestServerMetrics(t *testing.T) {
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	assert.True(t, strings.Contains(body, "go_goroutines "))
+	assert.True(t, strings.Contains(body, "radish_snapshot_age_seconds -1\n"))
+	assert.True(t, strings.Contains(body, "radish_ready 0\n"))
+}
+
+func TestServerProfiling(t *testing.T) {
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	server.EnableProfiling()
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// blockingFetcher : fetcher whose queue requests wait for release
+type blockingFetcher struct {
+	fakeFetcher
+	release chan struct{}
+	queues  int32
+}
+
+func (f *blockingFetcher) Queues(ctx context.Context) ([]rabtap.RabbitQueue, error) {
+	atomic.AddInt32(&f.queues, 1)
+	select {
+	case <-f.release:
+		return []rabtap.RabbitQueue{{Name: "q1"}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestPollerFetchTimeout(t *testing.T) {
+	fetcher := &blockingFetcher{release: make(chan struct{})}
+	poller := newPoller(fetcher, PollIntervals{Default: time.Second})
+	poller.Timeout = 10 * time.Millisecond
+	assert.Equal(t, context.DeadlineExceeded, poller.Poll(ResourceQueues))
+	assert.Nil(t, poller.Poll(ResourceOverview))
+}
+
+func TestServerResourceCoalescing(t *testing.T) {
+	fetcher := &blockingFetcher{release: make(chan struct{})}
+	poller := newPoller(fetcher, PollIntervals{Default: time.Second})
+	close(fetcher.release)
+	poller.Poll()
+	fetcher.release = make(chan struct{})
+	atomic.StoreInt32(&fetcher.queues, 0)
+	server := NewServer(poller)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/queues?fresh=true", nil))
+			codes[i] = rec.Code
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(fetcher.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetcher.queues))
+	for _, code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/channels", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServerSnapshotAge(t *testing.T) {
+	fetcher := &fakeFetcher{}
+	poller := newPoller(fetcher, PollIntervals{Default: time.Second})
+	server := NewServer(poller)
+	poller.Poll()
+	poller.fetchedAt[ResourceQueues] = time.Now().Add(-time.Minute)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/queues", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	age, err := strconv.ParseFloat(rec.Header().Get("X-Snapshot-Age"), 64)
+	assert.Nil(t, err)
+	assert.True(t, age >= 60)
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/queues/refresh", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("POST", "/api/queues/refresh", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	age, _ = strconv.ParseFloat(rec.Header().Get("X-Snapshot-Age"), 64)
+	assert.True(t, age < 60)
+	assert.Equal(t, 2, fetcher.calls[ResourceQueues])
+}
+
+func TestServerResourceTable(t *testing.T) {
+	poller := newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second})
+	poller.Poll()
+	poller.info.Queues[0].MessageBytes = 1048575
+	server := NewServer(poller)
+
+	table := func(query string) TableResult {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/queues?format=table"+query, nil))
+		var result TableResult
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result
+	}
+	assert.Equal(t, "BYTES", table("").Headers[6])
+	assert.Equal(t, "1 MiB", table("").Rows[0][6])
+	assert.Equal(t, "1048575", table("&raw=true").Rows[0][6])
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/bindings?format=table", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultShutdownTimeout time given to daemon modes to finish after a signal
+const defaultShutdownTimeout = 10 * time.Second
+
+type shutdownHook struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+var shutdownMutex sync.Mutex
+var shutdownHooks []shutdownHook
+
+// onShutdown register a hook run on shutdown, hooks run in reverse order of
+// registration so resources are released before the ones they depend on
+func onShutdown(name string, run func(ctx context.Context) error) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	shutdownHooks = append(shutdownHooks, shutdownHook{name: name, run: run})
+}
+
+// runShutdownHooks run all registered hooks, giving them timeout to finish
+func runShutdownHooks(timeout time.Duration) {
+	shutdownMutex.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].run(ctx); err != nil {
+			subsystemLog("shutdown").Warnf("%s: %s", hooks[i].name, err)
+		}
+	}
+}
+
+// shutdownSignals channel receiving SIGINT and SIGTERM
+func shutdownSignals() chan os.Signal {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	return sigc
+}
+
+// reloadSignals channel receiving SIGHUP, the signal daemon modes reload
+// their configuration on
+func reloadSignals() chan os.Signal {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGHUP)
+	return sigc
+}
+
+// signalContext context cancelled when SIGINT or SIGTERM arrives
+func signalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	sigc := shutdownSignals()
+	go func() {
+		defer signal.Stop(sigc)
+		select {
+		case sig := <-sigc:
+			subsystemLog("shutdown").Infof("received %s, shutting down", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Close stop background work and close the amqp connection
+func (rabbitmq *Rabbitmq) Close() error {
+	if rabbitmq.discoveryStop != nil {
+		close(rabbitmq.discoveryStop)
+		rabbitmq.discoveryStop = nil
+	}
+	rabbitmq.connected = false
+	if rabbitmq.connection != nil {
+		err := rabbitmq.connection.Close()
+		rabbitmq.connection = nil
+		return err
+	}
+	return nil
+}
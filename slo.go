@@ -0,0 +1,456 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// slo objectives
+const (
+	// SLODrain backlog drains within the target at the current deliver rate
+	SLODrain = "drain"
+	// SLOAge oldest message is younger than the target, estimated from the
+	// backlog and the publish rate
+	SLOAge = "age"
+)
+
+const (
+	defaultSLOGoal   = 0.99
+	defaultSLOWindow = "30d"
+	// sloCacheTTL how long computed compliance is served before the
+	// history is queried again
+	sloCacheTTL = time.Minute
+	// sloAnalyzer name of the analyzer alerting on fast budget burn
+	sloAnalyzer = "slo"
+)
+
+// sloBurnWindows short windows the burn rate is reported for besides the
+// slo window. A budget burning faster than the rate over both windows is
+// alerted on, 14.4 spends 2% of a 30 day budget in an hour.
+var sloBurnWindows = []struct {
+	Window time.Duration
+	Alert  float64
+}{{time.Hour, 14.4}, {6 * time.Hour, 6}}
+
+var (
+	metricSLOCompliance = MetricDef{"slo_compliance", "Share of good queue samples over the slo window.", "gauge", "1"}
+	metricSLOBudget     = MetricDef{"slo_error_budget_remaining", "Share of the error budget left over the slo window.", "gauge", "1"}
+	metricSLOBurnRate   = MetricDef{"slo_burn_rate", "Error budget burn rate over the window, 1 spends the budget exactly.", "gauge", "1"}
+)
+
+// SLO : a processing latency objective of the queues matching Vhost and
+// Queue, globs that match all when empty. Every history point of a matching
+// queue is a sample, Goal the share of samples that must meet Target over
+// Window.
+type SLO struct {
+	Name      string        `yaml:"name" json:"name"`
+	Vhost     string        `yaml:"vhost,omitempty" json:"vhost,omitempty"`
+	Queue     string        `yaml:"queue,omitempty" json:"queue,omitempty"`
+	Objective string        `yaml:"objective" json:"objective"`
+	Target    time.Duration `yaml:"target" json:"target"`
+	Goal      float64       `yaml:"goal,omitempty" json:"goal,omitempty"`
+	Window    string        `yaml:"window,omitempty" json:"window,omitempty"`
+	window    time.Duration
+}
+
+// compile validate the slo and apply the defaults
+func (slo *SLO) compile() error {
+	if slo.Name == "" {
+		return fmt.Errorf("slo without name")
+	}
+	if slo.Objective != SLODrain && slo.Objective != SLOAge {
+		return fmt.Errorf("slo %s: unknown objective %q, expected drain or age", slo.Name, slo.Objective)
+	}
+	if slo.Target <= 0 {
+		return fmt.Errorf("slo %s: expected a target duration", slo.Name)
+	}
+	if slo.Goal == 0 {
+		slo.Goal = defaultSLOGoal
+	}
+	if slo.Goal <= 0 || slo.Goal >= 1 {
+		return fmt.Errorf("slo %s: goal %g is not between 0 and 1", slo.Name, slo.Goal)
+	}
+	if slo.Window == "" {
+		slo.Window = defaultSLOWindow
+	}
+	var err error
+	if slo.window, err = parseRetentionDuration(slo.Window); err != nil {
+		return fmt.Errorf("slo %s: window: %s", slo.Name, err)
+	}
+	for _, glob := range []string{slo.Vhost, slo.Queue} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("slo %s: bad pattern %q", slo.Name, glob)
+		}
+	}
+	return nil
+}
+
+// Matches the slo applies to the queue
+func (slo SLO) Matches(vhost string, queue string) bool {
+	match := func(glob string, s string) bool {
+		ok, _ := path.Match(glob, s)
+		return glob == "" || ok
+	}
+	return match(slo.Vhost, vhost) && match(slo.Queue, queue)
+}
+
+// Good whether a sample of a queue holding messages meets the target. The
+// drain time is the backlog over the deliver rate, the age of the oldest
+// message the backlog over the publish rate. A backlog that does not move
+// misses both.
+func (slo SLO) Good(messages float64, publish float64, deliver float64) bool {
+	if messages <= 0 {
+		return true
+	}
+	rate := deliver
+	if slo.Objective == SLOAge {
+		rate = publish
+	}
+	if rate <= 0 {
+		return false
+	}
+	return time.Duration(messages/rate*float64(time.Second)) <= slo.Target
+}
+
+// SLOFile : the slo definitions file
+type SLOFile struct {
+	SLOs []SLO `yaml:"slos"`
+}
+
+// LoadSLOs read the slo definitions of a yaml file
+func LoadSLOs(file string) ([]SLO, error) {
+	var slos SLOFile
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &slos); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	names := map[string]bool{}
+	for i := range slos.SLOs {
+		if err := slos.SLOs[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		if names[slos.SLOs[i].Name] {
+			return nil, fmt.Errorf("%s: duplicate slo %s", file, slos.SLOs[i].Name)
+		}
+		names[slos.SLOs[i].Name] = true
+	}
+	return slos.SLOs, nil
+}
+
+// sloSamples count the good and all samples of the queues matching slo
+// recorded between from and now
+func sloSamples(history *MetricHistory, slo SLO, from time.Time, now time.Time) (good int, total int, queues int, err error) {
+	query := func(metric MetricDef) (map[string][]HistoryPoint, error) {
+		_, series, err := history.Query(metric.Name, from, now, now)
+		return series, err
+	}
+	messages, err := query(metricQueueMessages)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	publish, err := query(metricQueuePublishRate)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	deliver, err := query(metricQueueDeliverRate)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	// the rates of the same queue at the time of a point
+	at := func(series []HistoryPoint) map[int64]float64 {
+		values := make(map[int64]float64, len(series))
+		for _, point := range series {
+			values[point.Time.Unix()] = point.Value
+		}
+		return values
+	}
+	for name, points := range messages {
+		vhost, _ := seriesVhost(name)
+		queue, _ := seriesLabel(name, "queue")
+		if !slo.Matches(vhost, queue) {
+			continue
+		}
+		labels := strings.TrimPrefix(name, metricQueueMessages.Name)
+		publishAt := at(publish[metricQueuePublishRate.Name+labels])
+		deliverAt := at(deliver[metricQueueDeliverRate.Name+labels])
+		queues++
+		for _, point := range points {
+			total++
+			if slo.Good(point.Value, publishAt[point.Time.Unix()], deliverAt[point.Time.Unix()]) {
+				good++
+			}
+		}
+	}
+	return good, total, queues, nil
+}
+
+// SLOStatus : compliance of an slo over its window and how fast its error
+// budget burns
+type SLOStatus struct {
+	SLO
+	Queues     int     `json:"queues"`
+	Samples    int     `json:"samples"`
+	Compliance float64 `json:"compliance"`
+	// Budget share of the error budget left, negative once overspent
+	Budget float64 `json:"error_budget_remaining"`
+	// BurnRates error rate over the budget by window, 1 spends the budget
+	// exactly over the slo window
+	BurnRates map[string]float64 `json:"burn_rates"`
+}
+
+// FastBurn the budget burns faster than the alerting rate of every short
+// window
+func (status SLOStatus) FastBurn() bool {
+	for _, burn := range sloBurnWindows {
+		if status.BurnRates[formatRetentionDuration(burn.Window)] <= burn.Alert {
+			return false
+		}
+	}
+	return true
+}
+
+// EvaluateSLO compute the compliance of slo at now from the history
+func EvaluateSLO(history *MetricHistory, slo SLO, now time.Time) (SLOStatus, error) {
+	status := SLOStatus{SLO: slo, Compliance: 1, Budget: 1, BurnRates: map[string]float64{}}
+	budget := 1 - slo.Goal
+	good, total, queues, err := sloSamples(history, slo, now.Add(-slo.window), now)
+	if err != nil {
+		return status, err
+	}
+	status.Queues, status.Samples = queues, total
+	if total > 0 {
+		status.Compliance = float64(good) / float64(total)
+		status.Budget = 1 - (1-status.Compliance)/budget
+	}
+	status.BurnRates[slo.Window] = (1 - status.Compliance) / budget
+	for _, burn := range sloBurnWindows {
+		if burn.Window >= slo.window {
+			continue
+		}
+		// queried separately for the finer resolution of the short window
+		good, total, _, err := sloSamples(history, slo, now.Add(-burn.Window), now)
+		if err != nil {
+			return status, err
+		}
+		rate := 0.0
+		if total > 0 {
+			rate = (1 - float64(good)/float64(total)) / budget
+		}
+		status.BurnRates[formatRetentionDuration(burn.Window)] = rate
+	}
+	return status, nil
+}
+
+// SLOList : the status of every slo
+type SLOList []SLOStatus
+
+// EvaluateSLOs compute the status of every slo
+func EvaluateSLOs(history *MetricHistory, slos []SLO, now time.Time) (SLOList, error) {
+	list := SLOList{}
+	for _, slo := range slos {
+		status, err := EvaluateSLO(history, slo, now)
+		if err != nil {
+			return list, fmt.Errorf("slo %s: %s", slo.Name, err)
+		}
+		list = append(list, status)
+	}
+	return list, nil
+}
+
+// Exhausted the slos that spent their error budget
+func (list SLOList) Exhausted() []string {
+	names := []string{}
+	for _, status := range list {
+		if status.Budget <= 0 {
+			names = append(names, status.Name)
+		}
+	}
+	return names
+}
+
+// Samples the compliance, budget and burn rate metrics of the slos
+func (list SLOList) Samples() []MetricSample {
+	samples := []MetricSample{}
+	for _, status := range list {
+		labels := []MetricLabel{{"slo", status.Name}}
+		samples = append(samples,
+			MetricSample{metricSLOCompliance, labels, status.Compliance},
+			MetricSample{metricSLOBudget, labels, status.Budget})
+		windows := make([]string, 0, len(status.BurnRates))
+		for window := range status.BurnRates {
+			windows = append(windows, window)
+		}
+		sort.Strings(windows)
+		for _, window := range windows {
+			samples = append(samples, MetricSample{metricSLOBurnRate, []MetricLabel{{"slo", status.Name}, {"window", window}}, status.BurnRates[window]})
+		}
+	}
+	return samples
+}
+
+// Table one row per slo, exhausted budgets in red and fast burns in yellow
+func (list SLOList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"SLO", "OBJECTIVE", "QUEUES", "SAMPLES", "COMPLIANCE", "GOAL", "BUDGET", "BURN 1H", "BURN 6H", "BURN WINDOW"}}
+	for _, status := range list {
+		budget := Cell{Text: fmt.Sprintf("%.1f%%", status.Budget*100)}
+		switch {
+		case status.Budget <= 0:
+			budget.Color = Red
+		case status.FastBurn():
+			budget.Color = Yellow
+		}
+		burn := func(window string) Cell {
+			rate, ok := status.BurnRates[window]
+			if !ok {
+				return Cell{Text: "-"}
+			}
+			return Cell{Text: format.Float(rate)}
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: status.Name},
+			{Text: fmt.Sprintf("%s < %s", status.Objective, status.Target)},
+			{Text: format.Count(int64(status.Queues))},
+			{Text: format.Count(int64(status.Samples))},
+			{Text: fmt.Sprintf("%.2f%%", status.Compliance*100)},
+			{Text: fmt.Sprintf("%g%% over %s", status.Goal*100, status.Window)},
+			budget,
+			burn("1h"),
+			burn("6h"),
+			burn(status.Window),
+		})
+	}
+	return table
+}
+
+// SLOTracker : the slos of a server, evaluated at most once per
+// sloCacheTTL since every evaluation scans the history of their windows
+type SLOTracker struct {
+	mutex    sync.Mutex
+	history  *MetricHistory
+	slos     []SLO
+	status   SLOList
+	computed time.Time
+}
+
+// NewSLOTracker track slos in history
+func NewSLOTracker(history *MetricHistory, slos []SLO) *SLOTracker {
+	return &SLOTracker{history: history, slos: slos}
+}
+
+// Status the status of the slos at now
+func (tracker *SLOTracker) Status(now time.Time) (SLOList, error) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if tracker.status != nil && now.Sub(tracker.computed) < sloCacheTTL {
+		return tracker.status, nil
+	}
+	status, err := EvaluateSLOs(tracker.history, tracker.slos, now)
+	if err != nil {
+		return nil, err
+	}
+	tracker.status, tracker.computed = status, now
+	return status, nil
+}
+
+// Name of the analyzer
+func (tracker *SLOTracker) Name() string {
+	return sloAnalyzer
+}
+
+// Analyze a finding for every slo with a fast burning or exhausted budget
+func (tracker *SLOTracker) Analyze(info rabtap.BrokerInfo) ([]Finding, error) {
+	list, err := tracker.Status(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	findings := []Finding{}
+	for _, status := range list {
+		switch {
+		case status.FastBurn():
+			findings = append(findings, Finding{Severity: SeverityCritical, Vhost: status.Vhost, Object: status.Name,
+				Summary: fmt.Sprintf("slo %s burns its error budget %.1f times too fast", status.Name, status.BurnRates["1h"])})
+		case status.Budget <= 0:
+			findings = append(findings, Finding{Severity: SeverityWarning, Vhost: status.Vhost, Object: status.Name,
+				Summary: fmt.Sprintf("slo %s exhausted its error budget, compliance %.2f%%", status.Name, status.Compliance*100)})
+		}
+	}
+	return findings, nil
+}
+
+// EnableSLOs serve the status of the slos under /api/slos and add their
+// metrics to /metrics
+func (server *Server) EnableSLOs(tracker *SLOTracker) {
+	server.slos = tracker
+	server.mux.HandleFunc("/api/slos", server.handleSLOs)
+}
+
+// handleSLOs the status of every slo
+func (server *Server) handleSLOs(w http.ResponseWriter, r *http.Request) {
+	list, err := server.slos.Status(time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if token, ok := requestToken(r); ok && len(token.Vhosts) > 0 {
+		visible := SLOList{}
+		for _, status := range list {
+			if status.Vhost != "" && !strings.ContainsAny(status.Vhost, "*?[") && token.AllowsVhost(status.Vhost) {
+				visible = append(visible, status)
+			}
+		}
+		list = visible
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func init() {
+	registerCommand("slo", "--store f [--retention r] [--slos file]: compliance and burn rates of the queue slos from the metric history", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("slo")
+		storeFile := flags.String("store", envOr("RADISH_STORE", ""), "store holding the metric history of serve --history")
+		retention := flags.String("retention", defaultRetention, "retention policy the history was recorded with")
+		slosFile := flags.String("slos", envOr("RADISH_SLOS", "radish-slos.yml"), "slo definitions")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if *storeFile == "" {
+			return nil, usageError("slo: expected --store")
+		}
+		slos, err := LoadSLOs(*slosFile)
+		if err != nil {
+			return nil, usageError("slo: %s", err)
+		}
+		policy, err := ParseRetentionPolicy(*retention)
+		if err != nil {
+			return nil, usageError("retention: %s", err)
+		}
+		store, err := OpenKVStore(*storeFile)
+		if err != nil {
+			return nil, usageError("store: %s", err)
+		}
+		defer store.Close()
+		history, err := NewMetricHistory(store, policy, 0)
+		if err != nil {
+			return nil, err
+		}
+		list, err := EvaluateSLOs(history, slos, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if exhausted := list.Exhausted(); len(exhausted) > 0 {
+			return list, thresholdError("error budget exhausted: %s", strings.Join(exhausted, ", "))
+		}
+		return list, nil
+	})
+}
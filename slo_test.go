@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// sloInfo a queue holding messages, published and delivered at rate
+func sloInfo(messages int, rate float64) rabtap.BrokerInfo {
+	queue := rabtap.RabbitQueue{Vhost: "/", Name: "orders", Messages: messages}
+	queue.MessageStats.PublishDetails.Rate = rate
+	queue.MessageStats.DeliverGetDetails.Rate = rate
+	return rabtap.BrokerInfo{Queues: []rabtap.RabbitQueue{queue, {Vhost: "/", Name: "audit", Messages: 1000}}}
+}
+
+func TestSLO(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "slo")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "slos.yml")
+	ioutil.WriteFile(file, []byte("slos:\n- name: orders-drain\n  queue: ord*\n  objective: drain\n  target: 5m\n  window: 1d\n"), 0644)
+	slos, err := LoadSLOs(file)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.99, slos[0].Goal)
+	assert.True(t, slos[0].Matches("/", "orders"))
+	assert.False(t, slos[0].Matches("/", "audit"))
+
+	assert.True(t, slos[0].Good(0, 0, 0))
+	assert.True(t, slos[0].Good(3000, 0, 10))
+	assert.False(t, slos[0].Good(3001, 0, 10))
+	assert.False(t, slos[0].Good(1, 0, 0))
+
+	store, _ := OpenKVStore(filepath.Join(dir, "store.json"))
+	defer store.Close()
+	policy, _ := ParseRetentionPolicy("10s:1d")
+	history, _ := NewMetricHistory(store, policy, 0)
+	start := time.Unix(1577880000, 0)
+	// 100 samples, the last 20 backlogs take 10 minutes to drain
+	for i := 0; i < 100; i++ {
+		info := sloInfo(100, 10)
+		if i >= 80 {
+			info = sloInfo(6000, 10)
+		}
+		history.Record(BrokerMetrics(&Snapshot{Info: info}), start.Add(time.Duration(i)*10*time.Second))
+	}
+	now := start.Add(1000 * time.Second)
+	status, err := EvaluateSLO(history, slos[0], now)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, status.Queues)
+	assert.Equal(t, 100, status.Samples)
+	assert.InDelta(t, 0.8, status.Compliance, 1e-9)
+	assert.InDelta(t, -19, status.Budget, 1e-9)
+	assert.InDelta(t, 20, status.BurnRates["1d"], 1e-9)
+	assert.InDelta(t, 20, status.BurnRates["1h"], 1e-9)
+	assert.True(t, status.FastBurn())
+
+	list := SLOList{status}
+	assert.Equal(t, []string{"orders-drain"}, list.Exhausted())
+	assert.Equal(t, 5, len(list.Samples()))
+	assert.Equal(t, Red, list.Table(NumberFormat{}).Rows[0][6].Color)
+
+	ioutil.WriteFile(file, []byte("slos:\n- name: x\n  objective: latency\n  target: 1m\n"), 0644)
+	_, err = LoadSLOs(file)
+	assert.NotNil(t, err)
+}
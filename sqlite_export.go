@@ -0,0 +1,261 @@
+// +build sqlite
+
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	// registers the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema normalized tables of a broker snapshot, every row references
+// the snapshot it was taken in so history can be kept in one file
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		taken_at TIMESTAMP NOT NULL,
+		cluster_name TEXT,
+		rabbitmq_version TEXT,
+		publish_rate REAL,
+		deliver_get_rate REAL)`,
+	`CREATE TABLE IF NOT EXISTS queues (
+		snapshot_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+		vhost TEXT NOT NULL,
+		name TEXT NOT NULL,
+		node TEXT,
+		state TEXT,
+		policy TEXT,
+		durable BOOLEAN,
+		auto_delete BOOLEAN,
+		exclusive BOOLEAN,
+		messages INTEGER,
+		messages_ready INTEGER,
+		messages_unacknowledged INTEGER,
+		message_bytes INTEGER,
+		memory INTEGER,
+		consumers INTEGER,
+		publish_rate REAL,
+		deliver_get_rate REAL,
+		PRIMARY KEY (snapshot_id, vhost, name))`,
+	`CREATE TABLE IF NOT EXISTS exchanges (
+		snapshot_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+		vhost TEXT NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT,
+		policy TEXT,
+		durable BOOLEAN,
+		auto_delete BOOLEAN,
+		internal BOOLEAN,
+		PRIMARY KEY (snapshot_id, vhost, name))`,
+	`CREATE TABLE IF NOT EXISTS bindings (
+		snapshot_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+		vhost TEXT NOT NULL,
+		source TEXT NOT NULL,
+		destination TEXT NOT NULL,
+		destination_type TEXT NOT NULL,
+		routing_key TEXT,
+		properties_key TEXT)`,
+	`CREATE TABLE IF NOT EXISTS connections (
+		snapshot_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		node TEXT,
+		vhost TEXT,
+		user TEXT,
+		protocol TEXT,
+		state TEXT,
+		channels INTEGER,
+		recv_oct INTEGER,
+		send_oct INTEGER,
+		peer_host TEXT,
+		peer_port INTEGER,
+		product TEXT,
+		version TEXT,
+		connected_at TIMESTAMP,
+		PRIMARY KEY (snapshot_id, name))`,
+	`CREATE TABLE IF NOT EXISTS consumers (
+		snapshot_id INTEGER NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+		vhost TEXT NOT NULL,
+		queue TEXT NOT NULL,
+		consumer_tag TEXT NOT NULL,
+		connection_name TEXT,
+		channel INTEGER,
+		prefetch_count INTEGER,
+		ack_required BOOLEAN,
+		exclusive BOOLEAN)`,
+	`CREATE INDEX IF NOT EXISTS bindings_destination ON bindings (snapshot_id, vhost, destination)`,
+	`CREATE INDEX IF NOT EXISTS consumers_queue ON consumers (snapshot_id, vhost, queue)`,
+}
+
+// OpenSQLite open or create the sqlite file and its tables
+func OpenSQLite(file string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", file+"?_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// sqliteInserter insert rows of one table with a prepared statement
+type sqliteInserter struct {
+	tx  *sql.Tx
+	err error
+}
+
+// insert run stmt with every row of rows, the first error is kept
+func (ins *sqliteInserter) insert(stmt string, rows [][]interface{}) {
+	if ins.err != nil || len(rows) == 0 {
+		return
+	}
+	prepared, err := ins.tx.Prepare(stmt)
+	if err != nil {
+		ins.err = err
+		return
+	}
+	defer prepared.Close()
+	for _, row := range rows {
+		if _, err := prepared.Exec(row...); err != nil {
+			ins.err = err
+			return
+		}
+	}
+}
+
+// ExportSQLite write info as a new snapshot taken at the given time. Without
+// history all previous snapshots are deleted. Returns the snapshot id.
+func ExportSQLite(db *sql.DB, info rabtap.BrokerInfo, takenAt time.Time, history bool) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if !history {
+		for _, table := range []string{"consumers", "connections", "bindings", "exchanges", "queues", "snapshots"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return 0, err
+			}
+		}
+	}
+	overview := info.Overview
+	res, err := tx.Exec("INSERT INTO snapshots (taken_at, cluster_name, rabbitmq_version, publish_rate, deliver_get_rate) VALUES (?, ?, ?, ?, ?)",
+		takenAt.UTC(), overview.ClusterName, overview.RabbitmqVersion,
+		overview.MessageStats.PublishDetails.Rate, overview.MessageStats.DeliverGetDetails.Rate)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	ins := &sqliteInserter{tx: tx}
+	rows := make([][]interface{}, 0, len(info.Queues))
+	for _, q := range info.Queues {
+		rows = append(rows, []interface{}{id, q.Vhost, q.Name, q.Node, q.State, q.Policy, q.Durable, q.AutoDelete, q.Exclusive,
+			q.Messages, q.MessagesReady, q.MessagesUnacknowledged, q.MessageBytes, q.Memory, q.Consumers,
+			q.MessageStats.PublishDetails.Rate, q.MessageStats.DeliverGetDetails.Rate})
+	}
+	ins.insert("INSERT INTO queues VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", rows)
+
+	rows = make([][]interface{}, 0, len(info.Exchanges))
+	for _, x := range info.Exchanges {
+		rows = append(rows, []interface{}{id, x.Vhost, x.Name, x.Type, x.Policy, x.Durable, x.AutoDelete, x.Internal})
+	}
+	ins.insert("INSERT INTO exchanges VALUES (?, ?, ?, ?, ?, ?, ?, ?)", rows)
+
+	rows = make([][]interface{}, 0, len(info.Bindings))
+	for _, b := range info.Bindings {
+		rows = append(rows, []interface{}{id, b.Vhost, b.Source, b.Destination, b.DestinationType, b.RoutingKey, b.PropertiesKey})
+	}
+	ins.insert("INSERT INTO bindings VALUES (?, ?, ?, ?, ?, ?, ?)", rows)
+
+	rows = make([][]interface{}, 0, len(info.Connections))
+	for _, c := range info.Connections {
+		var connectedAt interface{}
+		if c.ConnectedAt > 0 {
+			connectedAt = time.Unix(0, c.ConnectedAt*int64(time.Millisecond)).UTC()
+		}
+		rows = append(rows, []interface{}{id, c.Name, c.Node, c.Vhost, c.User, c.Protocol, c.State, c.Channels,
+			c.RecvOct, c.SendOct, c.PeerHost, c.PeerPort, c.ClientProperties.Product, c.ClientProperties.Version, connectedAt})
+	}
+	ins.insert("INSERT INTO connections VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", rows)
+
+	rows = make([][]interface{}, 0, len(info.Consumers))
+	for _, c := range info.Consumers {
+		rows = append(rows, []interface{}{id, c.Queue.Vhost, c.Queue.Name, c.ConsumerTag, c.ChannelDetails.ConnectionName,
+			c.ChannelDetails.Number, c.PrefetchCount, c.AckRequired, c.Exclusive})
+	}
+	ins.insert("INSERT INTO consumers VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", rows)
+
+	if ins.err != nil {
+		return 0, ins.err
+	}
+	return id, tx.Commit()
+}
+
+// SQLiteExport : result of an export
+type SQLiteExport struct {
+	File      string `json:"file"`
+	Snapshots int    `json:"snapshots"`
+}
+
+func init() {
+	registerCommand("export-sqlite", "[--history] [--interval d] <file> write the broker snapshot to a sqlite file", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("export-sqlite")
+		history := flags.Bool("history", false, "keep the snapshots already in the file")
+		interval := flags.Duration("interval", 0, "keep exporting snapshots with this interval, implies --history")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("export-sqlite: expected a file name")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		db, err := OpenSQLite(flags.Arg(0))
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		result := SQLiteExport{File: flags.Arg(0)}
+		info, err := cli.redaction.BrokerInfo(rabbitmq.info())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ExportSQLite(db, info, time.Now(), *history); err != nil {
+			return nil, err
+		}
+		result.Snapshots++
+		if *interval <= 0 {
+			return result, nil
+		}
+
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		return result, exportEvery(ctx, *interval, func() error {
+			if err := rabbitmq.UpdateBrokerInfoContext(ctx); err != nil {
+				subsystemLog("export").Warnf("fetching broker info failed: %s", err)
+				return nil
+			}
+			info, err := cli.redaction.BrokerInfo(rabbitmq.info())
+			if err != nil {
+				return err
+			}
+			if _, err := ExportSQLite(db, info, time.Now(), true); err != nil {
+				return err
+			}
+			result.Snapshots++
+			return nil
+		})
+	})
+}
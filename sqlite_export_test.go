@@ -0,0 +1,59 @@
+// +build sqlite
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radish")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	db, err := OpenSQLite(filepath.Join(dir, "broker.db"))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	info := rabtap.BrokerInfo{
+		Queues:      []rabtap.RabbitQueue{{Vhost: "/", Name: "orders", Messages: 12}},
+		Exchanges:   []rabtap.RabbitExchange{{Vhost: "/", Name: "events", Type: "topic"}},
+		Bindings:    []rabtap.RabbitBinding{{Vhost: "/", Source: "events", Destination: "orders", DestinationType: "queue", RoutingKey: "order.#"}},
+		Connections: []rabtap.RabbitConnection{{Name: "c1", User: "app", ConnectedAt: 1500000000000}},
+		Consumers:   make([]rabtap.RabbitConsumer, 1),
+	}
+	info.Consumers[0].Queue.Vhost, info.Consumers[0].Queue.Name = "/", "orders"
+	info.Consumers[0].ChannelDetails.ConnectionName = "c1"
+
+	first, err := ExportSQLite(db, info, time.Now(), false)
+	assert.Nil(t, err)
+	second, err := ExportSQLite(db, info, time.Now(), true)
+	assert.Nil(t, err)
+	assert.True(t, second > first)
+
+	var user string
+	var messages int
+	err = db.QueryRow(`SELECT c.user, q.messages FROM consumers s
+		JOIN connections c ON c.snapshot_id = s.snapshot_id AND c.name = s.connection_name
+		JOIN queues q ON q.snapshot_id = s.snapshot_id AND q.vhost = s.vhost AND q.name = s.queue
+		JOIN bindings b ON b.snapshot_id = s.snapshot_id AND b.destination = q.name
+		WHERE s.snapshot_id = ?`, second).Scan(&user, &messages)
+	assert.Nil(t, err)
+	assert.Equal(t, "app", user)
+	assert.Equal(t, 12, messages)
+
+	var snapshots int
+	assert.Nil(t, db.QueryRow("SELECT count(*) FROM snapshots").Scan(&snapshots))
+	assert.Equal(t, 2, snapshots)
+
+	_, err = ExportSQLite(db, info, time.Now(), false)
+	assert.Nil(t, err)
+	assert.Nil(t, db.QueryRow("SELECT count(*) FROM queues").Scan(&snapshots))
+	assert.Equal(t, 1, snapshots)
+}
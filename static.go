@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// staticFiles the built client, generated into assets.go by go generate or
+// embedded with go:embed when built with -tags embed
+var staticFiles http.FileSystem = FS
+
+// SPAHandler : serves the single page client. Paths without a file are
+// client side routes and get index.html (html5 history fallback).
+type SPAHandler struct {
+	files  http.FileSystem
+	server http.Handler
+}
+
+// NewSPAHandler serve the client in files
+func NewSPAHandler(files http.FileSystem) *SPAHandler {
+	return &SPAHandler{files: files, server: http.FileServer(files)}
+}
+
+// apiPath true for the paths of the backend, everything else is the client
+func apiPath(name string) bool {
+	for _, prefix := range []string{"/api/", "/metrics", "/refresh", "/debug/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// staticCacheControl content hashed build output never changes, everything
+// else is revalidated so a new release is picked up
+func staticCacheControl(name string) string {
+	if strings.HasPrefix(name, "/static/") {
+		return "public, max-age=31536000, immutable"
+	}
+	return "no-cache"
+}
+
+// exists true when name is a regular file of the client
+func (handler *SPAHandler) exists(name string) bool {
+	f, err := handler.files.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && !info.IsDir()
+}
+
+func (handler *SPAHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)
+	if apiPath(r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+	if name != "/" && !handler.exists(name) {
+		// missing assets are errors, extensionless paths are client routes
+		if path.Ext(name) != "" {
+			http.Error(w, os.ErrNotExist.Error(), http.StatusNotFound)
+			return
+		}
+		name = "/"
+	}
+	w.Header().Set("Cache-Control", staticCacheControl(name))
+	if name != r.URL.Path {
+		url := *r.URL
+		url.Path = name
+		r2 := *r
+		r2.URL = &url
+		r = &r2
+	}
+	handler.server.ServeHTTP(w, r)
+}
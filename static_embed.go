@@ -0,0 +1,21 @@
+// +build embed
+
+package main
+
+import (
+	"embed"
+	iofs "io/fs"
+	"net/http"
+)
+
+// clientBuild the output of npm run build in client/
+//go:embed client/build
+var clientBuild embed.FS
+
+func init() {
+	build, err := iofs.Sub(clientBuild, "client/build")
+	if err != nil {
+		panic(err)
+	}
+	staticFiles = http.FS(build)
+}
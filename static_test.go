@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSPAHandler(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "client")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "static", "js"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>radish</html>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "static", "js", "main.123.js"), []byte("app()"), 0644)
+	handler := NewSPAHandler(http.Dir(dir))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+	rec := get("/static/js/main.123.js")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "app()", rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Cache-Control"), "immutable")
+
+	rec = get("/queues/prod")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<html>radish</html>", rec.Body.String())
+	assert.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+
+	rec = get("/static/js/missing.js")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
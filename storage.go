@@ -0,0 +1,175 @@
+package main
+
+import (
+	"sort"
+)
+
+// defaultRAMBacklog bytes in memory making a non lazy classic queue suspect
+const defaultRAMBacklog = 64 << 20
+
+// StorageQueue : where the messages of a queue are stored
+type StorageQueue struct {
+	Vhost                  string                 `json:"vhost"`
+	Name                   string                 `json:"name"`
+	Type                   string                 `json:"type"`
+	Messages               int64                  `json:"messages"`
+	MessageBytes           int64                  `json:"message_bytes"`
+	MessageBytesRAM        int64                  `json:"message_bytes_ram"`
+	MessageBytesPersistent int64                  `json:"message_bytes_persistent"`
+	MessageBytesPagedOut   int64                  `json:"message_bytes_paged_out"`
+	Arguments              map[string]interface{} `json:"arguments"`
+	Policy                 string                 `json:"policy"`
+	EffectivePolicy        map[string]interface{} `json:"effective_policy_definition"`
+	MessageStats           struct {
+		PublishDetails struct {
+			Rate float64 `json:"rate"`
+		} `json:"publish_details"`
+	} `json:"message_stats"`
+}
+
+// storageColumns columns fetched for the storage report
+const storageColumns = "vhost,name,type,messages,message_bytes,message_bytes_ram,message_bytes_persistent," +
+	"message_bytes_paged_out,arguments,policy,effective_policy_definition,message_stats.publish_details.rate"
+
+// QueueStorage message bytes of all queues split by where they are kept
+func (client *ManagementClient) QueueStorage() ([]StorageQueue, error) {
+	var queues []StorageQueue
+	if err := client.get("queues?columns="+storageColumns, &queues); err != nil {
+		return nil, err
+	}
+	scoped := queues[:0]
+	for _, queue := range queues {
+		if client.scope.Match(queue.Name) {
+			scoped = append(scoped, queue)
+		}
+	}
+	return scoped, nil
+}
+
+// Classic true for classic queues, brokers before 3.8 report no type
+func (queue StorageQueue) Classic() bool {
+	return queue.Type == "" || queue.Type == "classic"
+}
+
+// Mode queue mode of a classic queue, the x-queue-mode argument wins over
+// the queue-mode of the policy
+func (queue StorageQueue) Mode() string {
+	if mode, ok := queue.Arguments["x-queue-mode"].(string); ok && mode != "" {
+		return mode
+	}
+	if mode, ok := queue.EffectivePolicy["queue-mode"].(string); ok && mode != "" {
+		return mode
+	}
+	return "default"
+}
+
+// QueueStorageRow : storage of one queue in the report
+type QueueStorageRow struct {
+	Vhost      string `json:"vhost"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Mode       string `json:"mode"`
+	Messages   int64  `json:"messages"`
+	Total      int64  `json:"total"`
+	RAM        int64  `json:"ram"`
+	Persistent int64  `json:"persistent"`
+	PagedOut   int64  `json:"pagedOut"`
+	// RAMBacklog a non lazy classic queue holding a large backlog in memory
+	RAMBacklog bool `json:"ramBacklog"`
+}
+
+// StorageReport : queues ranked by total message bytes
+type StorageReport struct {
+	Total      int64             `json:"total"`
+	RAM        int64             `json:"ram"`
+	Persistent int64             `json:"persistent"`
+	PagedOut   int64             `json:"pagedOut"`
+	Queues     []QueueStorageRow `json:"queues"`
+}
+
+// BuildStorageReport rank queues by total bytes, keeping the top ones.
+// Non lazy classic queues with more than ramBacklog bytes in memory are
+// flagged.
+func BuildStorageReport(queues []StorageQueue, ramBacklog int64, top int) StorageReport {
+	report := StorageReport{Queues: []QueueStorageRow{}}
+	for _, queue := range queues {
+		row := QueueStorageRow{
+			Vhost: queue.Vhost, Name: queue.Name, Type: queue.Type, Mode: "-",
+			Messages: queue.Messages, Total: queue.MessageBytes, RAM: queue.MessageBytesRAM,
+			Persistent: queue.MessageBytesPersistent, PagedOut: queue.MessageBytesPagedOut,
+		}
+		if row.Type == "" {
+			row.Type = "classic"
+		}
+		if queue.Classic() {
+			row.Mode = queue.Mode()
+			row.RAMBacklog = row.Mode != "lazy" && row.RAM > ramBacklog
+		}
+		report.Total += row.Total
+		report.RAM += row.RAM
+		report.Persistent += row.Persistent
+		report.PagedOut += row.PagedOut
+		report.Queues = append(report.Queues, row)
+	}
+	sort.Slice(report.Queues, func(i, j int) bool {
+		a, b := report.Queues[i], report.Queues[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Vhost+"\x00"+a.Name < b.Vhost+"\x00"+b.Name
+	})
+	if top > 0 && len(report.Queues) > top {
+		report.Queues = report.Queues[:top]
+	}
+	return report
+}
+
+// Table queues as table with a total row
+func (report StorageReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "QUEUE", "TYPE", "MODE", "MESSAGES", "TOTAL", "RAM", "PERSISTENT", "PAGED OUT"}}
+	for _, row := range report.Queues {
+		ramColor := None
+		if row.RAMBacklog {
+			ramColor = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: row.Vhost},
+			{Text: row.Name},
+			{Text: row.Type},
+			{Text: row.Mode},
+			{Text: format.Count(row.Messages)},
+			{Text: format.Bytes(row.Total)},
+			{Text: format.Bytes(row.RAM), Color: ramColor},
+			{Text: format.Bytes(row.Persistent)},
+			{Text: format.Bytes(row.PagedOut)},
+		})
+	}
+	table.Rows = append(table.Rows, []Cell{
+		{Text: "total"}, {Text: ""}, {Text: ""}, {Text: ""}, {Text: ""},
+		{Text: format.Bytes(report.Total)},
+		{Text: format.Bytes(report.RAM)},
+		{Text: format.Bytes(report.Persistent)},
+		{Text: format.Bytes(report.PagedOut)},
+	})
+	return table
+}
+
+func init() {
+	registerCommand("storage", "[--top n] [--ram-backlog bytes] message bytes per queue split into ram, persistent and paged out", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("storage")
+		top := flags.Int("top", 20, "queues listed, 0 lists all")
+		ramBacklog := flags.Int64("ram-backlog", defaultRAMBacklog, "flag non lazy classic queues with more bytes in ram")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		queues, err := rabbitmq.management().QueueStorage()
+		if err != nil {
+			return nil, err
+		}
+		return BuildStorageReport(queues, *ramBacklog, *top), nil
+	})
+}
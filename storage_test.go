@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildStorageReport(t *testing.T) {
+	queues := []StorageQueue{
+		{Vhost: "/", Name: "small", Type: "classic", MessageBytes: 10, MessageBytesRAM: 10},
+		{Vhost: "/", Name: "backlog", Type: "classic", MessageBytes: 500, MessageBytesRAM: 400, MessageBytesPersistent: 500, MessageBytesPagedOut: 100},
+		{Vhost: "/", Name: "lazy", MessageBytes: 300, MessageBytesRAM: 200,
+			EffectivePolicy: map[string]interface{}{"queue-mode": "lazy"}},
+		{Vhost: "/", Name: "quorum", Type: "quorum", MessageBytes: 200, MessageBytesRAM: 200},
+	}
+	report := BuildStorageReport(queues, 100, 3)
+	assert.Equal(t, int64(1010), report.Total)
+	assert.Equal(t, int64(810), report.RAM)
+	assert.Len(t, report.Queues, 3)
+	assert.Equal(t, QueueStorageRow{
+		Vhost: "/", Name: "backlog", Type: "classic", Mode: "default",
+		Total: 500, RAM: 400, Persistent: 500, PagedOut: 100, RAMBacklog: true,
+	}, report.Queues[0])
+	assert.Equal(t, "lazy", report.Queues[1].Mode)
+	assert.False(t, report.Queues[1].RAMBacklog)
+	assert.Equal(t, "-", report.Queues[2].Mode)
+	assert.False(t, report.Queues[2].RAMBacklog)
+}
+
+func TestStorageQueueMode(t *testing.T) {
+	queue := StorageQueue{
+		Arguments:       map[string]interface{}{"x-queue-mode": "default"},
+		EffectivePolicy: map[string]interface{}{"queue-mode": "lazy"},
+	}
+	assert.Equal(t, "default", queue.Mode())
+}
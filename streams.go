@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// StreamConnectionDetails : connection a stream publisher or consumer uses
+type StreamConnectionDetails struct {
+	Name     string `json:"name"`
+	Node     string `json:"node"`
+	User     string `json:"user"`
+	PeerHost string `json:"peer_host"`
+	PeerPort int    `json:"peer_port"`
+}
+
+// StreamRef : stream a publisher or consumer is attached to
+type StreamRef struct {
+	Name  string `json:"name"`
+	Vhost string `json:"vhost"`
+}
+
+// StreamPublisher : publisher of a stream
+type StreamPublisher struct {
+	PublisherID       int                     `json:"publisher_id"`
+	Reference         string                  `json:"reference"`
+	Published         int64                   `json:"published"`
+	Confirmed         int64                   `json:"confirmed"`
+	Errored           int64                   `json:"errored"`
+	Queue             StreamRef               `json:"queue"`
+	ConnectionDetails StreamConnectionDetails `json:"connection_details"`
+}
+
+// StreamConsumer : consumer of a stream
+type StreamConsumer struct {
+	SubscriptionID    int                     `json:"subscription_id"`
+	Credits           int64                   `json:"credits"`
+	Consumed          int64                   `json:"consumed"`
+	Offset            int64                   `json:"offset"`
+	OffsetLag         int64                   `json:"offset_lag"`
+	Queue             StreamRef               `json:"queue"`
+	ConnectionDetails StreamConnectionDetails `json:"connection_details"`
+}
+
+// StreamPublishers list publishers of all streams
+func (client *ManagementClient) StreamPublishers() ([]StreamPublisher, error) {
+	var publishers []StreamPublisher
+	err := client.get("stream/publishers", &publishers)
+	return publishers, err
+}
+
+// StreamConsumers list consumers of all streams
+func (client *ManagementClient) StreamConsumers() ([]StreamConsumer, error) {
+	var consumers []StreamConsumer
+	err := client.get("stream/consumers", &consumers)
+	return consumers, err
+}
+
+// StreamSummary : a stream with its publishers and consumers
+type StreamSummary struct {
+	Vhost        string            `json:"vhost"`
+	Name         string            `json:"name"`
+	Publishers   []StreamPublisher `json:"publishers"`
+	Consumers    []StreamConsumer  `json:"consumers"`
+	Published    int64             `json:"published"`
+	Consumed     int64             `json:"consumed"`
+	MaxOffsetLag int64             `json:"maxOffsetLag"`
+}
+
+// SummarizeStreams group publishers and consumers by the stream queues of queues
+func SummarizeStreams(queues []QueueType, publishers []StreamPublisher, consumers []StreamConsumer) []StreamSummary {
+	streams := map[StreamRef]*StreamSummary{}
+	for _, queue := range queues {
+		if queue.Type == "stream" {
+			streams[StreamRef{Name: queue.Name, Vhost: queue.Vhost}] = &StreamSummary{
+				Vhost: queue.Vhost, Name: queue.Name,
+				Publishers: []StreamPublisher{}, Consumers: []StreamConsumer{},
+			}
+		}
+	}
+	for _, publisher := range publishers {
+		if stream, ok := streams[publisher.Queue]; ok {
+			stream.Publishers = append(stream.Publishers, publisher)
+			stream.Published += publisher.Published
+		}
+	}
+	for _, consumer := range consumers {
+		if stream, ok := streams[consumer.Queue]; ok {
+			stream.Consumers = append(stream.Consumers, consumer)
+			stream.Consumed += consumer.Consumed
+			if consumer.OffsetLag > stream.MaxOffsetLag {
+				stream.MaxOffsetLag = consumer.OffsetLag
+			}
+		}
+	}
+	res := make([]StreamSummary, 0, len(streams))
+	for _, stream := range streams {
+		res = append(res, *stream)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Vhost != res[j].Vhost {
+			return res[i].Vhost < res[j].Vhost
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// Streams summarize all streams of the broker, publishers and consumers are
+// only fetched when streams exist, the plugin may not be enabled otherwise
+func (client *ManagementClient) Streams() ([]StreamSummary, error) {
+	queues, err := client.QueueTypes()
+	if err != nil {
+		return nil, err
+	}
+	hasStreams := false
+	for _, queue := range queues {
+		hasStreams = hasStreams || queue.Type == "stream"
+	}
+	if !hasStreams {
+		return []StreamSummary{}, nil
+	}
+	publishers, err := client.StreamPublishers()
+	if err != nil {
+		return nil, fmt.Errorf("listing stream publishers (is rabbitmq_stream_management enabled?): %s", err)
+	}
+	consumers, err := client.StreamConsumers()
+	if err != nil {
+		return nil, err
+	}
+	return SummarizeStreams(queues, publishers, consumers), nil
+}
+
+// StreamList : streams listing
+type StreamList []StreamSummary
+
+// Table streams as table
+func (list StreamList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "NAME", "PUBLISHERS", "CONSUMERS", "PUBLISHED", "CONSUMED", "MAX LAG"}}
+	for _, stream := range list {
+		lagColor := None
+		if stream.MaxOffsetLag > 0 {
+			lagColor = Yellow
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: stream.Vhost},
+			{Text: stream.Name},
+			{Text: format.Count(int64(len(stream.Publishers)))},
+			{Text: format.Count(int64(len(stream.Consumers)))},
+			{Text: format.Count(stream.Published)},
+			{Text: format.Count(stream.Consumed)},
+			{Text: format.Count(stream.MaxOffsetLag), Color: lagColor},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("streams", "list streams with their publishers and consumers", func(cli *CLI, args []string) (interface{}, error) {
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		streams, err := rabbitmq.management().Streams()
+		if err != nil {
+			return nil, err
+		}
+		return StreamList(streams), nil
+	})
+}
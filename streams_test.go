@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeStreams(t *testing.T) {
+	queues := []QueueType{
+		{Vhost: "/", Name: "events", Type: "stream"},
+		{Vhost: "/", Name: "jobs", Type: "quorum"},
+		{Vhost: "/", Name: "audit", Type: "stream"},
+	}
+	var publishers []StreamPublisher
+	var consumers []StreamConsumer
+	json.Unmarshal([]byte(`[
+		{"publisher_id": 1, "published": 10, "queue": {"name": "events", "vhost": "/"}},
+		{"publisher_id": 2, "published": 5, "queue": {"name": "events", "vhost": "/"}}]`), &publishers)
+	json.Unmarshal([]byte(`[
+		{"subscription_id": 1, "consumed": 12, "offset_lag": 3, "queue": {"name": "events", "vhost": "/"}},
+		{"subscription_id": 2, "consumed": 1, "offset_lag": 14, "queue": {"name": "events", "vhost": "/"}}]`), &consumers)
+
+	streams := SummarizeStreams(queues, publishers, consumers)
+	assert.Len(t, streams, 2)
+	assert.Equal(t, "audit", streams[0].Name)
+	assert.Empty(t, streams[0].Publishers)
+	assert.Equal(t, "events", streams[1].Name)
+	assert.Equal(t, int64(15), streams[1].Published)
+	assert.Equal(t, int64(13), streams[1].Consumed)
+	assert.Equal(t, int64(14), streams[1].MaxOffsetLag)
+
+	table := StreamList(streams).Table(NumberFormat{Raw: true})
+	assert.Equal(t, []string{"/", "events", "2", "2", "15", "13", "14"}, cellTexts(table.Rows[1]))
+}
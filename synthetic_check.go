@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// SyntheticStep : one management api call of the synthetic check
+type SyntheticStep struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// SyntheticResult : outcome of the synthetic check of a vhost
+type SyntheticResult struct {
+	Vhost string          `json:"vhost"`
+	OK    bool            `json:"ok"`
+	Steps []SyntheticStep `json:"steps"`
+}
+
+// step time fn and record it, returns whether it succeeded
+func (result *SyntheticResult) step(name string, fn func() error) bool {
+	start := time.Now()
+	err := fn()
+	step := SyntheticStep{Name: name, Duration: time.Since(start)}
+	if err != nil {
+		step.Error = err.Error()
+		result.OK = false
+	}
+	result.Steps = append(result.Steps, step)
+	return err == nil
+}
+
+// SyntheticCheck exercise the write path of the management api in vhost:
+// declare a temporary exchange and queue, bind them, publish, get the message
+// back and delete both. Cleanup runs even when an earlier step failed.
+func (client *ManagementClient) SyntheticCheck(vhost string) SyntheticResult {
+	result := SyntheticResult{Vhost: vhost, OK: true, Steps: []SyntheticStep{}}
+	name := "radish-check-" + uuid.NewV4().String()
+	payload := "radish synthetic check " + time.Now().Format(time.RFC3339Nano)
+
+	exchangeDeclared := result.step("declare exchange", func() error {
+		return client.PutExchange(ManifestExchange{Vhost: vhost, Name: name, Type: "direct", AutoDelete: true})
+	})
+	queueDeclared := result.step("declare queue", func() error {
+		return client.PutQueue(ManifestQueue{Vhost: vhost, Name: name, AutoDelete: true})
+	})
+	if exchangeDeclared && queueDeclared && result.step("bind", func() error {
+		return client.PostBinding(ManifestBinding{Vhost: vhost, Source: name, Destination: name, DestinationType: "queue", RoutingKey: name})
+	}) && result.step("publish", func() error {
+		routed, err := client.PublishMessage(vhost, name, name, payload)
+		if err == nil && !routed {
+			err = fmt.Errorf("message was not routed")
+		}
+		return err
+	}) {
+		result.step("get", func() error {
+			messages, err := client.GetMessages(vhost, name, 1, false)
+			switch {
+			case err != nil:
+				return err
+			case len(messages) == 0:
+				return fmt.Errorf("queue is empty")
+			case messages[0].Payload != payload:
+				return fmt.Errorf("got %q, expected the published payload", messages[0].Payload)
+			}
+			return nil
+		})
+	}
+	if queueDeclared {
+		result.step("delete queue", func() error { return client.DeleteQueue(vhost, name) })
+	}
+	if exchangeDeclared {
+		result.step("delete exchange", func() error { return client.DeleteExchange(vhost, name) })
+	}
+	return result
+}
+
+// SyntheticResults : synthetic check of several vhosts
+type SyntheticResults []SyntheticResult
+
+// Table one row per step
+func (results SyntheticResults) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "STEP", "DURATION", "RESULT"}}
+	for _, result := range results {
+		for _, step := range result.Steps {
+			text, color := "ok", Green
+			if step.Error != "" {
+				text, color = step.Error, Red
+			}
+			table.Rows = append(table.Rows, []Cell{
+				{Text: result.Vhost},
+				{Text: step.Name},
+				{Text: step.Duration.Round(time.Millisecond).String()},
+				{Text: text, Color: color},
+			})
+		}
+	}
+	return table
+}
+
+func init() {
+	registerCommand("health-check", "[--vhost v] declare, bind, publish, get and delete in every vhost", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("health-check")
+		vhost := flags.String("vhost", "", "only check this vhost")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = NormalizeVhost(*vhost)
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		vhosts := []string{*vhost}
+		if *vhost == "" {
+			if vhosts, err = rabbitmq.management().VhostNames(); err != nil {
+				return nil, err
+			}
+		}
+		results := SyntheticResults{}
+		failed := 0
+		for _, name := range vhosts {
+			result := rabbitmq.management().SyntheticCheck(name)
+			if !result.OK {
+				failed++
+			}
+			results = append(results, result)
+		}
+		if failed > 0 {
+			return results, thresholdError("health check failed in %d of %d vhosts", failed, len(vhosts))
+		}
+		return results, nil
+	})
+}
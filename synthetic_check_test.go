@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWritePath a management api keeping the last published payload
+func fakeWritePath(t *testing.T, routed bool) *httptest.Server {
+	var payload string
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.EscapedPath()
+		switch {
+		case r.Method == "POST" && strings.HasSuffix(path, "/publish"):
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			payload = body["payload"].(string)
+			json.NewEncoder(w).Encode(map[string]bool{"routed": routed})
+		case r.Method == "POST" && strings.HasSuffix(path, "/get"):
+			json.NewEncoder(w).Encode([]QueueMessage{{Payload: payload}})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func stepNames(result SyntheticResult) []string {
+	var names []string
+	for _, step := range result.Steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestSyntheticCheck(t *testing.T) {
+	ts := fakeWritePath(t, true)
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+	result := NewManagementClient(uri, nil).SyntheticCheck("/")
+	assert.True(t, result.OK)
+	assert.Equal(t, []string{"declare exchange", "declare queue", "bind", "publish", "get", "delete queue", "delete exchange"},
+		stepNames(result))
+}
+
+func TestSyntheticCheckCleansUpAfterFailure(t *testing.T) {
+	ts := fakeWritePath(t, false)
+	defer ts.Close()
+	uri, _ := url.Parse(ts.URL + "/api")
+	result := NewManagementClient(uri, nil).SyntheticCheck("/")
+	assert.False(t, result.OK)
+	assert.Equal(t, []string{"declare exchange", "declare queue", "bind", "publish", "delete queue", "delete exchange"},
+		stepNames(result))
+	assert.Equal(t, "message was not routed", result.Steps[3].Error)
+}
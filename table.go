@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Color : terminal color of a table cell
+type Color int
+
+// cell colors, None keeps the terminal default
+const (
+	None Color = iota
+	Red
+	Yellow
+	Green
+)
+
+var colorCodes = map[Color]string{
+	Red:    "\x1b[31m",
+	Yellow: "\x1b[33m",
+	Green:  "\x1b[32m",
+}
+
+const colorReset = "\x1b[0m"
+
+const (
+	columnSeparator = "  "
+	minColumnWidth  = 6
+	defaultWidth    = 120
+)
+
+// Cell : a single value of a table
+type Cell struct {
+	Text  string
+	Color Color
+}
+
+// Table : rows of cells rendered as aligned columns
+type Table struct {
+	Headers []string
+	Rows    [][]Cell
+}
+
+// Tabular : results with a human friendly table representation
+type Tabular interface {
+	Table(format NumberFormat) Table
+}
+
+// TableOptions : how tables are rendered
+type TableOptions struct {
+	Color bool
+	// Width available in the terminal, columns are shrunk to fit unless Wide is set
+	Width int
+	Wide  bool
+	// Ellipsis marks truncated values
+	Ellipsis string
+	// TruncateMiddle keeps the start and the end of truncated values, which
+	// suits dotted queue names better than cutting the end
+	TruncateMiddle bool
+}
+
+// colorEnabled colors are used when writing to a terminal, unless disabled by
+// --no-color or the NO_COLOR environment variable
+func colorEnabled(out io.Writer, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// outputWidth width of the terminal out writes to, falling back to COLUMNS
+func outputWidth(out io.Writer) int {
+	if f, ok := out.(*os.File); ok {
+		if width := terminalWidth(f); width > 0 {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return defaultWidth
+}
+
+// truncate shorten text to width runes
+func truncate(text string, width int, opts TableOptions) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	ellipsis := []rune(opts.Ellipsis)
+	if len(ellipsis) >= width {
+		return string(runes[:width])
+	}
+	keep := width - len(ellipsis)
+	if opts.TruncateMiddle {
+		head := (keep + 1) / 2
+		return string(runes[:head]) + opts.Ellipsis + string(runes[len(runes)-(keep-head):])
+	}
+	return string(runes[:keep]) + opts.Ellipsis
+}
+
+func (cell Cell) render(width int, opts TableOptions) string {
+	text := truncate(cell.Text, width, opts)
+	text += strings.Repeat(" ", width-len([]rune(text)))
+	if opts.Color && cell.Color != None {
+		return colorCodes[cell.Color] + text + colorReset
+	}
+	return text
+}
+
+// columnWidths the widest value per column, shrinking the widest columns
+// until the table fits into the available width
+func (table Table) columnWidths(opts TableOptions) []int {
+	widths := make([]int, len(table.Headers))
+	for i, header := range table.Headers {
+		widths[i] = len([]rune(header))
+	}
+	for _, row := range table.Rows {
+		for i, cell := range row {
+			if i < len(widths) && len([]rune(cell.Text)) > widths[i] {
+				widths[i] = len([]rune(cell.Text))
+			}
+		}
+	}
+	if opts.Wide || opts.Width <= 0 {
+		return widths
+	}
+	total := func() int {
+		sum := len(columnSeparator) * (len(widths) - 1)
+		for _, w := range widths {
+			sum += w
+		}
+		return sum
+	}
+	for total() > opts.Width {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			break
+		}
+		widths[widest]--
+	}
+	return widths
+}
+
+// Render write the table with aligned columns
+func (table Table) Render(out io.Writer, opts TableOptions) {
+	widths := table.columnWidths(opts)
+	headerOpts := opts
+	headerOpts.Color = false
+	cells := make([]string, len(table.Headers))
+	for i, header := range table.Headers {
+		cells[i] = Cell{Text: header}.render(widths[i], headerOpts)
+	}
+	fmt.Fprintln(out, strings.TrimRight(strings.Join(cells, columnSeparator), " "))
+	for _, row := range table.Rows {
+		cells = cells[:0]
+		for i, cell := range row {
+			if i < len(widths) {
+				cells = append(cells, cell.render(widths[i], opts))
+			}
+		}
+		fmt.Fprintln(out, strings.TrimRight(strings.Join(cells, columnSeparator), " "))
+	}
+}
+
+// WriteCSV write the headers and cell texts as csv
+func (table Table) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(table.Headers); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = cell.Text
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// markdownEscaper escapes the characters breaking a markdown table cell
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\n", " ", "\r", "")
+
+// WriteMarkdown write the headers and cell texts as a markdown table
+func (table Table) WriteMarkdown(w io.Writer) error {
+	line := func(cells []string) string {
+		return "| " + strings.Join(cells, " | ") + " |\n"
+	}
+	headers := make([]string, len(table.Headers))
+	rule := make([]string, len(table.Headers))
+	for i, header := range table.Headers {
+		headers[i] = markdownEscaper.Replace(header)
+		rule[i] = "---"
+	}
+	if _, err := io.WriteString(w, line(headers)+line(rule)); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = markdownEscaper.Replace(cell.Text)
+		}
+		if _, err := io.WriteString(w, line(cells)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var htmlColors = map[Color]string{
+	Red:    "#c62828",
+	Yellow: "#b26a00",
+	Green:  "#2e7d32",
+}
+
+// WriteHTML write the table as html table, colored cells keep their color
+func (table Table) WriteHTML(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("<table>\n<thead><tr>")
+	for _, header := range table.Headers {
+		fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(header))
+	}
+	b.WriteString("</tr></thead>\n<tbody>\n")
+	for _, row := range table.Rows {
+		b.WriteString("<tr>")
+		for _, cell := range row {
+			if color, ok := htmlColors[cell.Color]; ok {
+				fmt.Fprintf(&b, "<td style=\"color:%s\">%s</td>", color, html.EscapeString(cell.Text))
+			} else {
+				fmt.Fprintf(&b, "<td>%s</td>", html.EscapeString(cell.Text))
+			}
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
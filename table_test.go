@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableRender(t *testing.T) {
+	table := Table{
+		Headers: []string{"NAME", "STATE"},
+		Rows: [][]Cell{
+			{{Text: "orders"}, {Text: "running", Color: Green}},
+			{{Text: "a"}, {Text: "flow", Color: Red}},
+		},
+	}
+	var out bytes.Buffer
+	table.Render(&out, TableOptions{})
+	assert.Equal(t, "NAME    STATE\norders  running\na       flow\n", out.String())
+
+	out.Reset()
+	table.Render(&out, TableOptions{Color: true})
+	assert.Contains(t, out.String(), "\x1b[31mflow   \x1b[0m")
+}
+
+func TestTableRenderTruncates(t *testing.T) {
+	table := Table{
+		Headers: []string{"NAME", "MESSAGES"},
+		Rows:    [][]Cell{{{Text: "orders.payment.retry.dead-letter"}, {Text: "12"}}},
+	}
+	var out bytes.Buffer
+	table.Render(&out, TableOptions{Width: 30, Ellipsis: "~"})
+	assert.Equal(t, "NAME                  MESSAGES\norders.payment.retr~  12\n", out.String())
+
+	out.Reset()
+	table.Render(&out, TableOptions{Width: 30, Ellipsis: "~", TruncateMiddle: true})
+	assert.Equal(t, "NAME                  MESSAGES\norders.pay~ad-letter  12\n", out.String())
+
+	out.Reset()
+	table.Render(&out, TableOptions{Width: 30, Wide: true})
+	assert.Contains(t, out.String(), "orders.payment.retry.dead-letter  12")
+}
+
+// cellTexts texts of a table row
+func cellTexts(row []Cell) []string {
+	texts := make([]string, len(row))
+	for i, cell := range row {
+		texts[i] = cell.Text
+	}
+	return texts
+}
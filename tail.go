@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"golang.org/x/net/websocket"
+)
+
+// TailLimits : server side limits of live tail sessions
+type TailLimits struct {
+	// Rate messages per second sent to a client, the others are dropped
+	Rate float64
+	// MaxBytes formatted body size, longer bodies are truncated
+	MaxBytes int
+	// Duration after which a session is closed
+	Duration time.Duration
+	// Sessions concurrently running sessions
+	Sessions int
+}
+
+// TailMessage : a tapped message as sent to the client
+type TailMessage struct {
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time,omitempty"`
+	Exchange    string    `json:"exchange,omitempty"`
+	RoutingKey  string    `json:"routingKey,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	Size        int       `json:"size,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	Truncated   bool      `json:"truncated,omitempty"`
+	// Dropped messages skipped so far because of the rate limit
+	Dropped int    `json:"dropped"`
+	Error   string `json:"error,omitempty"`
+}
+
+// rateLimiter : token bucket allowing rate events per second, with a burst
+// of one second
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// allow take a token if there is one
+func (limiter *rateLimiter) allow(now time.Time) bool {
+	if limiter.rate <= 0 {
+		return true
+	}
+	if !limiter.last.IsZero() {
+		limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	} else {
+		limiter.tokens = limiter.rate
+	}
+	if limiter.tokens > limiter.rate {
+		limiter.tokens = limiter.rate
+	}
+	limiter.last = now
+	if limiter.tokens < 1 {
+		return false
+	}
+	limiter.tokens--
+	return true
+}
+
+// tailMessage the client message of a tapped message
+func tailMessage(message rabtap.TapMessage, maxBytes int) TailMessage {
+	msg := message.AmqpMessage
+	body := FormatPayload(msg.Body, msg.ContentType, msg.ContentEncoding, PayloadOptions{})
+	res := TailMessage{
+		Type:        "message",
+		Time:        message.ReceivedTimestamp,
+		Exchange:    msg.Exchange,
+		RoutingKey:  msg.RoutingKey,
+		ContentType: msg.ContentType,
+		Size:        len(msg.Body),
+		Body:        body,
+	}
+	if maxBytes > 0 && len(body) > maxBytes {
+		res.Body, res.Truncated = body[:maxBytes], true
+	}
+	return res
+}
+
+// TailBindings the exchange bindings delivering copies of the messages of
+// a queue. Messages published to the default exchange can not be tapped.
+func TailBindings(info rabtap.BrokerInfo, vhost string, queue string) []rabtap.ExchangeConfiguration {
+	bindings := []rabtap.ExchangeConfiguration{}
+	for _, binding := range info.Bindings {
+		if binding.Vhost == vhost && binding.Destination == queue && binding.DestinationType == "queue" && binding.Source != "" {
+			bindings = append(bindings, rabtap.ExchangeConfiguration{Exchange: binding.Source, BindingKey: binding.RoutingKey})
+		}
+	}
+	return bindings
+}
+
+// EnableTail serve live tails of queues and exchanges under /api/tail
+func (server *Server) EnableTail(rabbitmq *Rabbitmq, limits TailLimits) {
+	server.rabbitmq = rabbitmq
+	server.tailLimits = limits
+	server.mux.HandleFunc("/api/tail", server.handleTail)
+}
+
+// sameOrigin refuse websocket handshakes of other sites, browsers send
+// the cookies and credentials of this one along
+func sameOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Host != r.Host {
+		return fmt.Errorf("origin %v not allowed", origin)
+	}
+	config.Origin = origin
+	return nil
+}
+
+// handleTail stream the messages of ?queue= or ?exchange= (with ?key=) in
+// ?vhost=, the default vhost when omitted, over a websocket until the client goes away or the session limit
+// is reached. Queues are tailed through copies of their bindings, their
+// messages are not consumed.
+func (server *Server) handleTail(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	vhost := server.vhost(query.Get("vhost"))
+	if token, ok := requestToken(r); ok && !token.AllowsVhost(vhost) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("token %s may not see vhost %s", token.Name, vhost)})
+		return
+	}
+	var bindings []rabtap.ExchangeConfiguration
+	switch {
+	case query.Get("queue") != "":
+		snapshot := server.poller.Snapshot()
+		if snapshot == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "no snapshot yet"})
+			return
+		}
+		if bindings = TailBindings(snapshot.Info, vhost, query.Get("queue")); len(bindings) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("queue %q has no exchange bindings to tap", query.Get("queue"))})
+			return
+		}
+	case query.Get("exchange") != "":
+		key := query.Get("key")
+		if key == "" {
+			key = "#"
+		}
+		bindings = []rabtap.ExchangeConfiguration{{Exchange: query.Get("exchange"), BindingKey: key}}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected ?queue= or ?exchange="})
+		return
+	}
+	uri, err := VhostAMQPURL(server.rabbitmq.amqpURL, vhost)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if n := atomic.AddInt32(&server.tails, 1); server.tailLimits.Sessions > 0 && int(n) > server.tailLimits.Sessions {
+		atomic.AddInt32(&server.tails, -1)
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many tail sessions"})
+		return
+	}
+	defer atomic.AddInt32(&server.tails, -1)
+	websocket.Server{Handshake: sameOrigin, Handler: func(ws *websocket.Conn) {
+		server.tail(ws, uri, bindings)
+	}}.ServeHTTP(w, r)
+}
+
+// tail run one session, the tap queue goes away with the session
+func (server *Server) tail(ws *websocket.Conn, uri string, bindings []rabtap.ExchangeConfiguration) {
+	limits := server.tailLimits
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+	if limits.Duration > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(ctx, limits.Duration)
+		defer stop()
+	}
+	go func() {
+		// the client sends nothing, a failing read means it went away
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+		cancel()
+	}()
+	logger := subsystemLog("tail")
+	logger.Infof("tail of %s started for %s", uriHost(uri), ws.Request().RemoteAddr)
+	limiter := &rateLimiter{rate: limits.Rate}
+	dropped := 0
+	server.rabbitmq.TapBindings(ctx, uri, bindings, func(message rabtap.TapMessage) error {
+		if !limiter.allow(time.Now()) {
+			dropped++
+			return nil
+		}
+		res := tailMessage(message, limits.MaxBytes)
+		res.Dropped = dropped
+		if err := websocket.JSON.Send(ws, res); err != nil {
+			cancel()
+		}
+		return nil
+	})
+	end := TailMessage{Type: "end", Dropped: dropped}
+	if ctx.Err() == context.DeadlineExceeded {
+		end.Error = "session duration limit reached"
+	}
+	websocket.JSON.Send(ws, end)
+	logger.Infof("tail of %s ended, %d messages dropped", uriHost(uri), dropped)
+}
+
+// uriHost host and vhost of an amqp uri without credentials, for logging
+func uriHost(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "?"
+	}
+	return parsed.Host + parsed.Path
+}
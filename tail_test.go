@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &rateLimiter{rate: 2}
+	now := time.Now()
+	assert.True(t, limiter.allow(now))
+	assert.True(t, limiter.allow(now))
+	assert.False(t, limiter.allow(now))
+	assert.True(t, limiter.allow(now.Add(500*time.Millisecond)))
+	assert.False(t, limiter.allow(now.Add(500*time.Millisecond)))
+	assert.True(t, (&rateLimiter{}).allow(now))
+}
+
+func TestTailBindings(t *testing.T) {
+	info := rabtap.BrokerInfo{Bindings: []rabtap.RabbitBinding{
+		{Vhost: "/", Source: "", Destination: "orders", DestinationType: "queue", RoutingKey: "orders"},
+		{Vhost: "/", Source: "events", Destination: "orders", DestinationType: "queue", RoutingKey: "order.*"},
+		{Vhost: "prod", Source: "events", Destination: "orders", DestinationType: "queue", RoutingKey: "order.#"},
+		{Vhost: "/", Source: "events", Destination: "orders", DestinationType: "exchange", RoutingKey: "x"},
+	}}
+	assert.Equal(t, []rabtap.ExchangeConfiguration{{Exchange: "events", BindingKey: "order.*"}}, TailBindings(info, "/", "orders"))
+	assert.Equal(t, 0, len(TailBindings(info, "/", "missing")))
+}
+
+func TestTailMessage(t *testing.T) {
+	msg := tailMessage(rabtap.TapMessage{AmqpMessage: &amqp.Delivery{Exchange: "events", RoutingKey: "k", Body: []byte("0123456789")}}, 4)
+	assert.Equal(t, "message", msg.Type)
+	assert.Equal(t, 10, msg.Size)
+	assert.Equal(t, 4, len(msg.Body))
+	assert.True(t, msg.Truncated)
+}
+
+func TestServerTailValidation(t *testing.T) {
+	poller := newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second})
+	poller.Poll()
+	server := NewServer(poller)
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusNotFound, get("/api/tail?exchange=events"))
+
+	server.EnableTail(&Rabbitmq{amqpURL: "amqp://localhost:5672/"}, TailLimits{Sessions: 1})
+	assert.Equal(t, http.StatusBadRequest, get("/api/tail"))
+	assert.Equal(t, http.StatusBadRequest, get("/api/tail?queue=q1"))
+
+	// not a websocket handshake
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/api/tail?exchange=events")
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	// the handler may still be unwinding after the response was sent
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&server.tails) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&server.tails))
+}
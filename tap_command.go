@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/streadway/amqp"
+)
+
+// TapMessageLine summary of a tapped message followed by its decoded body
+func TapMessageLine(message rabtap.TapMessage, opts PayloadOptions) string {
+	msg := message.AmqpMessage
+	line := fmt.Sprintf("%s exchange=%q routing_key=%q",
+		message.ReceivedTimestamp.Format(time.RFC3339), msg.Exchange, msg.RoutingKey)
+	return formatBodyLine(line, FormatPayload(msg.Body, msg.ContentType, msg.ContentEncoding, opts))
+}
+
+// Tap tap the exchange until ctx is done, every message is passed to
+// receiveFunc. The tap queue and its binding are declared again when the
+// connection is recovered after a broker restart.
+func (rabbitmq *Rabbitmq) Tap(ctx context.Context, exchange string, bindingKey string, receiveFunc MessageReceiveFunc) {
+	rabbitmq.TapBindings(ctx, rabbitmq.amqpURL, []rabtap.ExchangeConfiguration{{Exchange: exchange, BindingKey: bindingKey}}, receiveFunc)
+}
+
+// TapBindings tap all the exchange bindings with one exclusive queue on the
+// broker at uri until ctx is done. The queue is deleted with its connection.
+func (rabbitmq *Rabbitmq) TapBindings(ctx context.Context, uri string, bindings []rabtap.ExchangeConfiguration, receiveFunc MessageReceiveFunc) {
+	manager := NewAMQPManager(uri, rabbitmq.amqpConfig, AMQPManagerOptions{})
+	manager.Consume(ctx, func(ch *amqp.Channel) (string, error) {
+		queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			return "", err
+		}
+		for _, binding := range bindings {
+			if err := ch.QueueBind(queue.Name, binding.BindingKey, binding.Exchange, false, nil); err != nil {
+				return "", err
+			}
+		}
+		return queue.Name, nil
+	}, func(delivery amqp.Delivery) {
+		if err := receiveFunc(rabtap.TapMessage{AmqpMessage: &delivery, ReceivedTimestamp: time.Now()}); err != nil {
+			subsystemLog("tap").Error(err)
+		}
+	})
+	manager.Run(ctx)
+}
+
+func init() {
+	registerCommand("tap", "[--binding-key k] [--raw] [--base64] [--proto-descriptor f] [--proto-type t] <exchange> print messages published to an exchange", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("tap")
+		bindingKey := flags.String("binding-key", "#", "binding key of the tap")
+		payloadOpts := payloadFlags(flags)
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() != 1 {
+			return nil, usageError("tap: expected exchange name")
+		}
+		opts, err := payloadOpts()
+		if err != nil {
+			return nil, usageError("tap: %s", err)
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		rabbitmq.Tap(ctx, flags.Arg(0), *bindingKey, func(message rabtap.TapMessage) error {
+			fmt.Fprintln(cli.out, TapMessageLine(message, opts))
+			return nil
+		})
+		return nil, nil
+	})
+
+	registerCommand("backup", "[--dir d] [--interval s] [--retention n] [--gzip] export definitions periodically", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("backup")
+		var opts BackupOptions
+		flags.StringVar(&opts.Dir, "dir", "backups", "directory to write backups to")
+		flags.IntVar(&opts.Interval, "interval", 3600, "seconds between two exports")
+		flags.IntVar(&opts.Retention, "retention", 0, "number of backups to keep, 0 keeps all")
+		flags.BoolVar(&opts.Gzip, "gzip", false, "gzip backups")
+		flags.BoolVar(&opts.Normalize, "normalize", false, "write normalized definitions")
+		flags.BoolVar(&opts.KeepSecrets, "keep-secrets", false, "keep password hashes and uri credentials in normalized backups")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		backup, err := NewDefinitionsBackup(rabbitmq.management(), opts)
+		if err != nil {
+			return nil, usageError("backup: %s", err)
+		}
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		backup.RunContext(ctx)
+		return nil, nil
+	})
+}
@@ -0,0 +1,10 @@
+// +build windows
+
+package main
+
+import "os"
+
+// terminalWidth not detected on windows, COLUMNS is used instead
+func terminalWidth(f *os.File) int {
+	return 0
+}
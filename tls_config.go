@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// radishConnectionName client provided name of the amqp connections radish
+// opens, tells them apart from the connections of applications
+const radishConnectionName = "radish"
+
+// authMechanismExternal login by client certificate instead of password
+const authMechanismExternal = "EXTERNAL"
+
+// externalAuth : sasl EXTERNAL, the broker takes the user from the client
+// certificate
+type externalAuth struct{}
+
+func (externalAuth) Mechanism() string { return authMechanismExternal }
+func (externalAuth) Response() string  { return "" }
+
+// TLSEnabled amqps and https are used
+func (det RabbitmqLoginDetails) TLSEnabled() bool {
+	return det.TLS || det.ClientCert != "" || det.AuthMechanism == authMechanismExternal
+}
+
+// BuildTLSConfig tls settings shared by the amqp connection and the
+// management client: ca bundle, client certificate and verification
+func BuildTLSConfig(det RabbitmqLoginDetails) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: det.TLSSkipVerify}
+	if det.CACert != "" {
+		pem, err := ioutil.ReadFile(det.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", det.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if det.ClientCert != "" || det.ClientKey != "" {
+		if det.ClientCert == "" || det.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(det.ClientCert, det.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if det.AuthMechanism == authMechanismExternal && len(config.Certificates) == 0 {
+		return nil, fmt.Errorf("EXTERNAL authentication needs a client certificate")
+	}
+	return config, nil
+}
+
+// AMQPConfig dial settings of the amqp connection for det
+func AMQPConfig(det RabbitmqLoginDetails, tlsConfig *tls.Config) (amqp.Config, error) {
+	config := amqp.Config{
+		Heartbeat:       10 * time.Second,
+		TLSClientConfig: tlsConfig,
+		Properties:      amqp.Table{"product": "radish", "connection_name": radishConnectionName},
+	}
+	switch det.AuthMechanism {
+	case "", "PLAIN":
+	case authMechanismExternal:
+		config.SASL = []amqp.Authentication{externalAuth{}}
+	default:
+		return config, fmt.Errorf("unsupported auth mechanism %q", det.AuthMechanism)
+	}
+	return config, nil
+}
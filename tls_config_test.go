@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert write a self signed certificate and its key to dir
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "radish"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radish-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir)
+
+	det := RabbitmqLoginDetails{CACert: certFile, ClientCert: certFile, ClientKey: keyFile, AuthMechanism: "EXTERNAL"}
+	assert.True(t, det.TLSEnabled())
+	config, err := BuildTLSConfig(det)
+	assert.Nil(t, err)
+	assert.NotNil(t, config.RootCAs)
+	assert.Len(t, config.Certificates, 1)
+
+	_, err = BuildTLSConfig(RabbitmqLoginDetails{ClientCert: certFile})
+	assert.NotNil(t, err)
+	_, err = BuildTLSConfig(RabbitmqLoginDetails{AuthMechanism: "EXTERNAL"})
+	assert.NotNil(t, err)
+	_, err = BuildTLSConfig(RabbitmqLoginDetails{CACert: keyFile})
+	assert.NotNil(t, err)
+	assert.False(t, RabbitmqLoginDetails{}.TLSEnabled())
+}
+
+func TestAMQPConfig(t *testing.T) {
+	config, err := AMQPConfig(RabbitmqLoginDetails{AuthMechanism: "EXTERNAL"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "EXTERNAL", config.SASL[0].Mechanism())
+
+	config, err = AMQPConfig(RabbitmqLoginDetails{}, nil)
+	assert.Equal(t, radishConnectionName, config.Properties["connection_name"])
+	assert.Nil(t, err)
+	assert.Nil(t, config.SASL)
+
+	_, err = AMQPConfig(RabbitmqLoginDetails{AuthMechanism: "AMQPLAIN"}, nil)
+	assert.NotNil(t, err)
+}
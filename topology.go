@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// TopologyNode : an exchange or queue of the topology graph
+type TopologyNode struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Vhost string `json:"vhost"`
+	Name  string `json:"name"`
+	// Detail exchange type or message count of queues
+	Detail string `json:"detail"`
+	// Depth column of the node, exchanges bound to nothing upstream are 0
+	Depth int `json:"depth"`
+}
+
+// TopologyEdge : a binding between two nodes
+type TopologyEdge struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	RoutingKey string `json:"routingKey"`
+}
+
+// TopologyGraph : exchanges and queues connected by their bindings
+type TopologyGraph struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+// topologyID node id of an object
+func topologyID(kind string, vhost string, name string) string {
+	return kind + ":" + vhost + ":" + name
+}
+
+// BuildTopology the graph of the bindings of vhost, or of all vhosts when
+// empty. The default exchange and unbound amq.* exchanges are left out.
+func BuildTopology(info rabtap.BrokerInfo, vhost string) TopologyGraph {
+	graph := TopologyGraph{Nodes: []TopologyNode{}, Edges: []TopologyEdge{}}
+	index := map[string]int{}
+	add := func(node TopologyNode) {
+		if _, ok := index[node.ID]; !ok {
+			index[node.ID] = len(graph.Nodes)
+			graph.Nodes = append(graph.Nodes, node)
+		}
+	}
+	bound := map[string]bool{}
+	for _, binding := range info.Bindings {
+		if binding.Source == "" || (vhost != "" && binding.Vhost != vhost) {
+			continue
+		}
+		kind := "queue"
+		if binding.DestinationType == "exchange" {
+			kind = "exchange"
+		}
+		from, to := topologyID("exchange", binding.Vhost, binding.Source), topologyID(kind, binding.Vhost, binding.Destination)
+		bound[from], bound[to] = true, true
+		graph.Edges = append(graph.Edges, TopologyEdge{From: from, To: to, RoutingKey: binding.RoutingKey})
+	}
+	for _, exchange := range info.Exchanges {
+		id := topologyID("exchange", exchange.Vhost, exchange.Name)
+		if exchange.Name == "" || (vhost != "" && exchange.Vhost != vhost) || (strings.HasPrefix(exchange.Name, "amq.") && !bound[id]) {
+			continue
+		}
+		add(TopologyNode{ID: id, Kind: "exchange", Vhost: exchange.Vhost, Name: exchange.Name, Detail: exchange.Type})
+	}
+	for _, queue := range info.Queues {
+		if vhost != "" && queue.Vhost != vhost {
+			continue
+		}
+		add(TopologyNode{ID: topologyID("queue", queue.Vhost, queue.Name), Kind: "queue", Vhost: queue.Vhost, Name: queue.Name,
+			Detail: fmt.Sprintf("%d msg", queue.Messages)})
+	}
+	// bindings of objects missing from the lists still get a node
+	for _, edge := range graph.Edges {
+		for _, id := range []string{edge.From, edge.To} {
+			parts := strings.SplitN(id, ":", 3)
+			add(TopologyNode{ID: id, Kind: parts[0], Vhost: parts[1], Name: parts[2]})
+		}
+	}
+	// longest path from a root, cycles stop growing after one round per node
+	for round := 0; round < len(graph.Nodes); round++ {
+		changed := false
+		for _, edge := range graph.Edges {
+			from, to := &graph.Nodes[index[edge.From]], &graph.Nodes[index[edge.To]]
+			if to.Depth < from.Depth+1 {
+				to.Depth, changed = from.Depth+1, true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	sort.SliceStable(graph.Nodes, func(i, j int) bool {
+		a, b := graph.Nodes[i], graph.Nodes[j]
+		if a.Vhost != b.Vhost {
+			return a.Vhost < b.Vhost
+		}
+		if a.Depth != b.Depth {
+			return a.Depth < b.Depth
+		}
+		return a.Name < b.Name
+	})
+	return graph
+}
+
+// dotQuote a graphviz string literal
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// topology node colors
+const (
+	exchangeFill = "#e3e8ff"
+	queueFill    = "#e6f4ea"
+)
+
+// Dot the graph in the graphviz dot language, one cluster per vhost
+func (graph TopologyGraph) Dot() string {
+	var b strings.Builder
+	b.WriteString("digraph topology {\n\trankdir=LR;\n\tnode [shape=box fontname=\"Helvetica\" fontsize=10];\n\tedge [fontname=\"Helvetica\" fontsize=9];\n")
+	vhost, cluster := "", 0
+	for i, node := range graph.Nodes {
+		if i == 0 || node.Vhost != vhost {
+			if i > 0 {
+				b.WriteString("\t}\n")
+			}
+			vhost = node.Vhost
+			fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n\t\tlabel=%s;\n", cluster, dotQuote("vhost "+vhost))
+			cluster++
+		}
+		label, style, fill := node.Name, "filled", queueFill
+		if node.Kind == "exchange" {
+			style, fill = "rounded,filled", exchangeFill
+		}
+		if node.Detail != "" {
+			label += "\n" + node.Detail
+		}
+		fmt.Fprintf(&b, "\t\t%s [label=%s style=%s fillcolor=%s];\n", dotQuote(node.ID), dotQuote(label), dotQuote(style), dotQuote(fill))
+	}
+	if len(graph.Nodes) > 0 {
+		b.WriteString("\t}\n")
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.RoutingKey))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// SVG draw the graph without graphviz: one column per depth, vhosts
+// stacked, bindings as straight lines labeled with their routing key
+func (graph TopologyGraph) SVG() string {
+	const columnWidth, nodeWidth, nodeHeight, rowHeight, margin = 240, 180, 32, 44, 20
+	type position struct{ x, y int }
+	positions := map[string]position{}
+	// top of the current vhost and nodes placed in each of its columns
+	top, rows, width := margin, map[int]int{}, 0
+	bottom := func() int {
+		tallest := 0
+		for _, n := range rows {
+			if n > tallest {
+				tallest = n
+			}
+		}
+		return top + tallest*rowHeight
+	}
+	vhost := ""
+	var nodes strings.Builder
+	for i, node := range graph.Nodes {
+		if i == 0 || node.Vhost != vhost {
+			if i > 0 {
+				top = bottom() + margin
+			}
+			vhost, rows = node.Vhost, map[int]int{}
+			fmt.Fprintf(&nodes, "<text x=\"%d\" y=\"%d\" font-weight=\"bold\">vhost %s</text>\n", margin, top+12, html.EscapeString(vhost))
+			top += 24
+		}
+		pos := position{x: margin + node.Depth*columnWidth, y: top + rows[node.Depth]*rowHeight}
+		rows[node.Depth]++
+		positions[node.ID] = pos
+		if pos.x+nodeWidth+margin > width {
+			width = pos.x + nodeWidth + margin
+		}
+		fill, radius := queueFill, 0
+		if node.Kind == "exchange" {
+			fill, radius = exchangeFill, 8
+		}
+		fmt.Fprintf(&nodes, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"%d\" fill=\"%s\" stroke=\"#555\"/>", pos.x, pos.y, nodeWidth, nodeHeight, radius, fill)
+		fmt.Fprintf(&nodes, "<text x=\"%d\" y=\"%d\">%s</text>", pos.x+6, pos.y+13, html.EscapeString(truncate(node.Name, 28, TableOptions{Ellipsis: "…"})))
+		fmt.Fprintf(&nodes, "<text x=\"%d\" y=\"%d\" fill=\"#666\">%s</text>\n", pos.x+6, pos.y+26, html.EscapeString(node.Detail))
+	}
+	height := bottom() + margin
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"Helvetica,sans-serif\" font-size=\"10\">\n", width, height)
+	b.WriteString("<defs><marker id=\"arrow\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"6\" markerHeight=\"6\" orient=\"auto\"><path d=\"M0,0L10,5L0,10z\" fill=\"#555\"/></marker></defs>\n")
+	for _, edge := range graph.Edges {
+		from, to := positions[edge.From], positions[edge.To]
+		x1, y1, x2, y2 := from.x+nodeWidth, from.y+nodeHeight/2, to.x, to.y+nodeHeight/2
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#555\" marker-end=\"url(#arrow)\"/>", x1, y1, x2, y2)
+		if edge.RoutingKey != "" {
+			fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" fill=\"#333\" font-size=\"9\">%s</text>", (x1+x2)/2-20, (y1+y2)/2-3, html.EscapeString(edge.RoutingKey))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(nodes.String())
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// topology export formats
+var topologyFormats = []string{"dot", "svg", "png", "pdf"}
+
+// RenderTopology the graph in format: dot is written directly, svg, png
+// and pdf are laid out by the graphviz dot program when it is installed.
+// Without it svg falls back to the built in layout, the engine used is
+// returned with the data.
+func RenderTopology(graph TopologyGraph, format string, dotPath string) ([]byte, string, error) {
+	if !contains(topologyFormats, format) {
+		return nil, "", fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(topologyFormats, ", "))
+	}
+	if format == "dot" {
+		return []byte(graph.Dot()), "dot", nil
+	}
+	if dotPath == "" {
+		dotPath, _ = exec.LookPath("dot")
+	}
+	if dotPath == "" {
+		if format == "svg" {
+			return []byte(graph.SVG()), "builtin", nil
+		}
+		return nil, "", fmt.Errorf("rendering %s needs graphviz dot, install it or export svg or dot", format)
+	}
+	cmd := exec.Command(dotPath, "-T"+format)
+	cmd.Stdin = strings.NewReader(graph.Dot())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("dot failed: %s %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return data, "graphviz", nil
+}
+
+// TopologyExport : a rendered topology written to a file
+type TopologyExport struct {
+	File   string `json:"file"`
+	Format string `json:"format"`
+	Engine string `json:"engine"`
+	Nodes  int    `json:"nodes"`
+	Edges  int    `json:"edges"`
+}
+
+func init() {
+	registerCommand("topology", "[--vhost v] [--format dot|svg|png|pdf] [--out file] [--dot path] render exchanges, queues and bindings as graph", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("topology")
+		vhost := flags.String("vhost", "", "only this vhost")
+		format := flags.String("format", "svg", "dot, svg, png or pdf")
+		out := flags.String("out", "", "write to this file instead of stdout, the format defaults to its extension")
+		dotPath := flags.String("dot", "", "graphviz dot program, looked up in PATH by default")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = NormalizeVhost(*vhost)
+		formatSet := false
+		flags.Visit(func(f *flag.Flag) { formatSet = formatSet || f.Name == "format" })
+		if ext := strings.TrimPrefix(filepath.Ext(*out), "."); !formatSet && contains(topologyFormats, ext) {
+			*format = ext
+		}
+		if !contains(topologyFormats, *format) {
+			return nil, usageError("topology: --format must be one of %s", strings.Join(topologyFormats, ", "))
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		graph := BuildTopology(rabbitmq.info(), *vhost)
+		data, engine, err := RenderTopology(graph, *format, *dotPath)
+		if err != nil {
+			return nil, err
+		}
+		if *out == "" {
+			cli.out.Write(data)
+			return nil, nil
+		}
+		if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+			return nil, err
+		}
+		return TopologyExport{File: *out, Format: *format, Engine: engine, Nodes: len(graph.Nodes), Edges: len(graph.Edges)}, nil
+	})
+}
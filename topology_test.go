@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func topologyInfo() rabtap.BrokerInfo {
+	return rabtap.BrokerInfo{
+		Exchanges: []rabtap.RabbitExchange{
+			{Vhost: "/", Name: "", Type: "direct"},
+			{Vhost: "/", Name: "amq.topic", Type: "topic"},
+			{Vhost: "/", Name: "events", Type: "topic"},
+			{Vhost: "/", Name: "orders", Type: "fanout"},
+		},
+		Queues: []rabtap.RabbitQueue{{Vhost: "/", Name: "billing", Messages: 3}},
+		Bindings: []rabtap.RabbitBinding{
+			{Vhost: "/", Source: "", Destination: "billing", DestinationType: "queue", RoutingKey: "billing"},
+			{Vhost: "/", Source: "events", Destination: "orders", DestinationType: "exchange", RoutingKey: "order.*"},
+			{Vhost: "/", Source: "orders", Destination: "billing", DestinationType: "queue"},
+		},
+	}
+}
+
+func TestBuildTopology(t *testing.T) {
+	graph := BuildTopology(topologyInfo(), "")
+	names := []string{}
+	for _, node := range graph.Nodes {
+		names = append(names, node.Kind+" "+node.Name+" "+string(rune('0'+node.Depth)))
+	}
+	assert.Equal(t, []string{"exchange events 0", "exchange orders 1", "queue billing 2"}, names)
+	assert.Equal(t, 2, len(graph.Edges))
+	assert.Equal(t, 0, len(BuildTopology(topologyInfo(), "other").Nodes))
+}
+
+func TestRenderTopology(t *testing.T) {
+	graph := BuildTopology(topologyInfo(), "/")
+	dot := graph.Dot()
+	assert.True(t, strings.HasPrefix(dot, "digraph topology {"))
+	assert.True(t, strings.Contains(dot, `"exchange:/:events" -> "exchange:/:orders" [label="order.*"];`))
+	assert.True(t, strings.Contains(dot, `[label="billing\n3 msg" style="filled"`))
+
+	_, _, err := RenderTopology(graph, "svg", "/nonexistent/dot")
+	assert.NotNil(t, err)
+	data, engine, err := RenderTopology(graph, "dot", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "dot", engine)
+	assert.Equal(t, dot, string(data))
+	_, _, err = RenderTopology(graph, "gif", "")
+	assert.NotNil(t, err)
+
+	svg := graph.SVG()
+	assert.Equal(t, 3, strings.Count(svg, "<rect "))
+	assert.Equal(t, 2, strings.Count(svg, "<line "))
+}
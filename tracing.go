@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/streadway/amqp"
+)
+
+// traceExchange exchange the firehose publishes to once enabled with
+// rabbitmqctl trace_on
+const traceExchange = "amq.rabbitmq.trace"
+
+// RabbitTrace : trace of the rabbitmq_tracing plugin
+type RabbitTrace struct {
+	Vhost           string `json:"vhost"`
+	Name            string `json:"name"`
+	Format          string `json:"format"`
+	Pattern         string `json:"pattern"`
+	MaxPayloadBytes int    `json:"max_payload_bytes,omitempty"`
+	TracerUsername  string `json:"tracer_connection_username,omitempty"`
+	TracerPassword  string `json:"tracer_connection_password,omitempty"`
+}
+
+// TraceFile : file written by a trace
+type TraceFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Traces list the traces of all vhosts
+func (client *ManagementClient) Traces() ([]RabbitTrace, error) {
+	traces := []RabbitTrace{}
+	err := client.get("traces", &traces)
+	return traces, err
+}
+
+// StartTrace create a trace writing messages matching its pattern to a file
+func (client *ManagementClient) StartTrace(trace RabbitTrace) error {
+	return client.put(objectPath("traces", trace.Vhost, trace.Name), trace)
+}
+
+// StopTrace delete a trace, its file is kept
+func (client *ManagementClient) StopTrace(vhost string, name string) error {
+	return client.delete(objectPath("traces", vhost, name))
+}
+
+// TraceFiles list the trace files of the node answering the api
+func (client *ManagementClient) TraceFiles() ([]TraceFile, error) {
+	files := []TraceFile{}
+	err := client.get("trace-files", &files)
+	return files, err
+}
+
+// TraceFile download a trace file
+func (client *ManagementClient) TraceFile(name string) ([]byte, error) {
+	return client.getRaw(managementPath("trace-files", name))
+}
+
+// TraceRecord : entry of a json formatted trace file
+type TraceRecord struct {
+	Timestamp    string   `json:"timestamp"`
+	Type         string   `json:"type"`
+	Node         string   `json:"node"`
+	Connection   string   `json:"connection"`
+	Vhost        string   `json:"vhost"`
+	User         string   `json:"user"`
+	Channel      int      `json:"channel"`
+	Exchange     string   `json:"exchange"`
+	Queue        string   `json:"queue"`
+	RoutedQueues []string `json:"routed_queues"`
+	RoutingKeys  []string `json:"routing_keys"`
+	Payload      string   `json:"payload"`
+}
+
+// printablePayload payload as text when it is utf-8, a size note otherwise
+func printablePayload(payload []byte) string {
+	if utf8.Valid(payload) {
+		return string(payload)
+	}
+	return fmt.Sprintf("<%d bytes binary>", len(payload))
+}
+
+// Line one line summary of the record
+func (record TraceRecord) Line() string {
+	payload, err := base64.StdEncoding.DecodeString(record.Payload)
+	if err != nil {
+		payload = []byte(record.Payload)
+	}
+	target := "exchange=" + record.Exchange
+	if record.Type == "received" {
+		target = "queue=" + record.Queue
+	}
+	return fmt.Sprintf("%s %-9s %s routing_keys=%s user=%s %s", record.Timestamp, record.Type, target,
+		strings.Join(record.RoutingKeys, ","), record.User, printablePayload(payload))
+}
+
+// PrintTraceFile pretty print a trace file. Json formatted files are printed
+// one line per message, text formatted ones as they are.
+func PrintTraceFile(out io.Writer, data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		_, err := out.Write(data)
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var record TraceRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, record.Line())
+	}
+	return scanner.Err()
+}
+
+// FirehoseLine one line summary of a message of the trace exchange, its
+// routing key is publish.<exchange> or deliver.<queue>
+func FirehoseLine(delivery amqp.Delivery) string {
+	event, target := delivery.RoutingKey, ""
+	if i := strings.Index(delivery.RoutingKey, "."); i >= 0 {
+		event, target = delivery.RoutingKey[:i], delivery.RoutingKey[i+1:]
+	}
+	var keys []string
+	if routingKeys, ok := delivery.Headers["routing_keys"].([]interface{}); ok {
+		for _, key := range routingKeys {
+			keys = append(keys, fmt.Sprint(key))
+		}
+	}
+	return fmt.Sprintf("%s %-7s %s routing_keys=%s %s", time.Now().Format(time.RFC3339), event, target,
+		strings.Join(keys, ","), printablePayload(delivery.Body))
+}
+
+// Firehose consume the trace exchange until ctx is done, pattern selects
+// events like "publish.#" or "deliver.orders"
+func (rabbitmq *Rabbitmq) Firehose(ctx context.Context, pattern string, handle func(amqp.Delivery)) {
+	manager := NewAMQPManager(rabbitmq.amqpURL, rabbitmq.amqpConfig, AMQPManagerOptions{})
+	manager.Consume(ctx, func(ch *amqp.Channel) (string, error) {
+		queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			return "", err
+		}
+		return queue.Name, ch.QueueBind(queue.Name, pattern, traceExchange, false, nil)
+	}, handle)
+	manager.Run(ctx)
+}
+
+// TraceList : traces listing
+type TraceList []RabbitTrace
+
+// Table traces as table
+func (list TraceList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "NAME", "PATTERN", "FORMAT"}}
+	for _, trace := range list {
+		table.Rows = append(table.Rows, []Cell{{Text: trace.Vhost}, {Text: trace.Name}, {Text: trace.Pattern}, {Text: trace.Format}})
+	}
+	return table
+}
+
+// TraceFileList : trace files listing
+type TraceFileList []TraceFile
+
+// Table trace files as table
+func (list TraceFileList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"NAME", "SIZE"}}
+	for _, file := range list {
+		table.Rows = append(table.Rows, []Cell{{Text: file.Name}, {Text: format.Bytes(file.Size)}})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("traces", "list traces of the tracing plugin", func(cli *CLI, args []string) (interface{}, error) {
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		traces, err := rabbitmq.management().Traces()
+		return TraceList(traces), err
+	})
+
+	registerCommand("trace-start", "[--vhost v] [--pattern p] [--format json|text] <name> start tracing to a file", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("trace-start")
+		trace := RabbitTrace{}
+		flags.StringVar(&trace.Vhost, "vhost", "", "vhost to trace, the default vhost when omitted")
+		flags.StringVar(&trace.Pattern, "pattern", "#", "firehose routing key pattern, e.g. publish.orders")
+		flags.StringVar(&trace.Format, "format", "json", "file format: json or text")
+		flags.IntVar(&trace.MaxPayloadBytes, "max-payload", 0, "truncate payloads, 0 keeps them whole")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		trace.Vhost = cli.vhost(trace.Vhost)
+		if flags.NArg() != 1 {
+			return nil, usageError("trace-start: expected trace name")
+		}
+		trace.Name = flags.Arg(0)
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return trace, rabbitmq.management().StartTrace(trace)
+	})
+
+	registerCommand("trace-stop", "[--vhost v] <name> stop a trace", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("trace-stop")
+		vhost := flags.String("vhost", "", "vhost of the trace, the default vhost when omitted")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = cli.vhost(*vhost)
+		if flags.NArg() != 1 {
+			return nil, usageError("trace-stop: expected trace name")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return nil, rabbitmq.management().StopTrace(*vhost, flags.Arg(0))
+	})
+
+	registerCommand("trace-files", "list trace files", func(cli *CLI, args []string) (interface{}, error) {
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		files, err := rabbitmq.management().TraceFiles()
+		return TraceFileList(files), err
+	})
+
+	registerCommand("trace-show", "<file> download and print a trace file", func(cli *CLI, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, usageError("trace-show: expected trace file name")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		data, err := rabbitmq.management().TraceFile(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return nil, PrintTraceFile(cli.out, data)
+	})
+
+	registerCommand("trace-live", "[--pattern p] follow the firehose, needs rabbitmqctl trace_on", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("trace-live")
+		pattern := flags.String("pattern", "#", "routing key pattern, e.g. publish.orders or deliver.#")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		rabbitmq.Firehose(ctx, *pattern, func(delivery amqp.Delivery) {
+			fmt.Fprintln(cli.out, FirehoseLine(delivery))
+		})
+		return nil, nil
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintTraceFile(t *testing.T) {
+	data := []byte(`{"timestamp":"2020-04-01 10:00:00:123","type":"published","exchange":"orders","routing_keys":["eu.new"],"user":"shop","payload":"aGVsbG8="}
+{"timestamp":"2020-04-01 10:00:00:124","type":"received","queue":"billing","routing_keys":["eu.new"],"user":"shop","payload":"/w=="}
+`)
+	var out bytes.Buffer
+	assert.Nil(t, PrintTraceFile(&out, data))
+	assert.Equal(t, "2020-04-01 10:00:00:123 published exchange=orders routing_keys=eu.new user=shop hello\n"+
+		"2020-04-01 10:00:00:124 received  queue=billing routing_keys=eu.new user=shop <1 bytes binary>\n", out.String())
+
+	out.Reset()
+	assert.Nil(t, PrintTraceFile(&out, []byte("text trace\n")))
+	assert.Equal(t, "text trace\n", out.String())
+}
+
+func TestFirehoseLine(t *testing.T) {
+	line := FirehoseLine(amqp.Delivery{
+		RoutingKey: "publish.orders",
+		Headers:    amqp.Table{"routing_keys": []interface{}{"eu.new"}},
+		Body:       []byte("hello"),
+	})
+	assert.Contains(t, line, " publish orders routing_keys=eu.new hello")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultUnackedThreshold time a channel may hold unacked messages without
+// acking any before it counts as stuck
+const defaultUnackedThreshold = 5 * time.Minute
+
+// UnackedHolder : a channel holding unacked messages without acking
+type UnackedHolder struct {
+	Channel    string        `json:"channel"`
+	Connection string        `json:"connection"`
+	PeerHost   string        `json:"peerHost"`
+	User       string        `json:"user"`
+	Vhost      string        `json:"vhost"`
+	Unacked    int           `json:"unacked"`
+	Prefetch   int           `json:"prefetch"`
+	Consumers  []string      `json:"consumers"`
+	Since      time.Time     `json:"since"`
+	Held       time.Duration `json:"held"`
+	Stuck      bool          `json:"stuck"`
+}
+
+// String one line summary of a stuck channel
+func (holder UnackedHolder) String() string {
+	return fmt.Sprintf("stuck channel=%q user=%s unacked=%d held=%s consumers=%s",
+		holder.Channel, holder.User, holder.Unacked, holder.Held.Round(time.Second), orDash(strings.Join(holder.Consumers, ",")))
+}
+
+// unackedState : since when a channel holds messages and its ack counter then
+type unackedState struct {
+	since time.Time
+	acks  int
+	stuck bool
+}
+
+// UnackedWatchdog follow channels across samples. A channel holding unacked
+// messages whose ack counter does not move for longer than the threshold
+// usually runs a handler stuck on a delivery.
+type UnackedWatchdog struct {
+	Threshold time.Duration
+	states    map[string]*unackedState
+	holders   []UnackedHolder
+}
+
+// NewUnackedWatchdog create a watchdog with the given threshold
+func NewUnackedWatchdog(threshold time.Duration) *UnackedWatchdog {
+	if threshold <= 0 {
+		threshold = defaultUnackedThreshold
+	}
+	return &UnackedWatchdog{Threshold: threshold, states: map[string]*unackedState{}}
+}
+
+// Observe record a sample of channels and consumers, returns the channels
+// that became stuck with this sample
+func (watchdog *UnackedWatchdog) Observe(channels []RabbitChannel, consumers []rabtap.RabbitConsumer, at time.Time) []UnackedHolder {
+	byChannel := map[string][]string{}
+	for _, consumer := range consumers {
+		name := consumer.ChannelDetails.Name
+		byChannel[name] = append(byChannel[name], consumer.Queue.Name+" ("+consumer.ConsumerTag+")")
+	}
+	states := map[string]*unackedState{}
+	var stuck []UnackedHolder
+	watchdog.holders = []UnackedHolder{}
+	for _, channel := range channels {
+		if channel.MessagesUnacknowledged == 0 {
+			continue
+		}
+		state := watchdog.states[channel.Name]
+		if state == nil || channel.MessageStats.Ack != state.acks {
+			state = &unackedState{since: at, acks: channel.MessageStats.Ack}
+		}
+		states[channel.Name] = state
+		holder := UnackedHolder{
+			Channel: channel.Name, Connection: channel.ConnectionDetails.Name, PeerHost: channel.ConnectionDetails.PeerHost,
+			User: channel.User, Vhost: channel.Vhost, Unacked: channel.MessagesUnacknowledged,
+			Prefetch: channel.PrefetchCount, Consumers: byChannel[channel.Name],
+			Since: state.since, Held: at.Sub(state.since),
+		}
+		sort.Strings(holder.Consumers)
+		holder.Stuck = holder.Held >= watchdog.Threshold
+		if holder.Stuck && !state.stuck {
+			stuck = append(stuck, holder)
+		}
+		state.stuck = holder.Stuck
+		watchdog.holders = append(watchdog.holders, holder)
+	}
+	watchdog.states = states
+	sort.Slice(watchdog.holders, func(i, j int) bool {
+		if watchdog.holders[i].Held != watchdog.holders[j].Held {
+			return watchdog.holders[i].Held > watchdog.holders[j].Held
+		}
+		return watchdog.holders[i].Channel < watchdog.holders[j].Channel
+	})
+	sort.Slice(stuck, func(i, j int) bool { return stuck[i].Channel < stuck[j].Channel })
+	return stuck
+}
+
+// Holders channels holding unacked messages at the last sample, longest
+// held first
+func (watchdog *UnackedWatchdog) Holders() UnackedHolders {
+	return UnackedHolders(watchdog.holders)
+}
+
+// UnackedHolders : channels holding unacked messages
+type UnackedHolders []UnackedHolder
+
+// Table holders as table
+func (holders UnackedHolders) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"CHANNEL", "USER", "UNACKED", "PREFETCH", "HELD", "CONSUMERS"}}
+	for _, holder := range holders {
+		color := None
+		if holder.Stuck {
+			color = Red
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: holder.Channel},
+			{Text: orDash(holder.User)},
+			{Text: format.Count(int64(holder.Unacked))},
+			{Text: format.Count(int64(holder.Prefetch))},
+			{Text: holder.Held.Round(time.Second).String(), Color: color},
+			{Text: orDash(strings.Join(holder.Consumers, ", "))},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("unacked-watchdog", "[--interval d] [--threshold d] [--count n] alert on consumers holding unacked messages without acking", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("unacked-watchdog")
+		interval := flags.Duration("interval", 15*time.Second, "time between two samples")
+		threshold := flags.Duration("threshold", defaultUnackedThreshold, "time without acks making a channel stuck")
+		count := flags.Int("count", 0, "samples to take, 0 runs until interrupted")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		if *interval <= 0 {
+			return nil, usageError("unacked-watchdog: --interval must be positive")
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		ctx, shutdown := cli.daemonContext()
+		defer shutdown()
+		watchdog := NewUnackedWatchdog(*threshold)
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for i := 1; ; i++ {
+			channels, err := rabbitmq.management().Channels()
+			if err != nil {
+				return watchdog.Holders(), fmt.Errorf("sampling channels: %s", err)
+			}
+			consumers, err := rabbitmq.fetcher().Consumers(ctx)
+			if err != nil {
+				return watchdog.Holders(), fmt.Errorf("sampling consumers: %s", err)
+			}
+			for _, holder := range watchdog.Observe(channels, consumers, time.Now()) {
+				if !cli.json {
+					fmt.Fprintln(cli.out, holder.String())
+				}
+			}
+			if *count > 0 && i >= *count {
+				return watchdog.Holders(), nil
+			}
+			select {
+			case <-ctx.Done():
+				return watchdog.Holders(), nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
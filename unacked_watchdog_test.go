@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnackedWatchdog(t *testing.T) {
+	watchdog := NewUnackedWatchdog(time.Minute)
+	channel := func(name string, unacked int, acks int) RabbitChannel {
+		c := RabbitChannel{Name: name, User: "app", MessagesUnacknowledged: unacked, PrefetchCount: 10}
+		c.MessageStats.Ack = acks
+		return c
+	}
+	consumer := rabtap.RabbitConsumer{ConsumerTag: "ctag-1"}
+	consumer.Queue.Name = "orders"
+	consumer.ChannelDetails.Name = "stuck (1)"
+	consumers := []rabtap.RabbitConsumer{consumer}
+	start := time.Now()
+
+	assert.Empty(t, watchdog.Observe([]RabbitChannel{channel("stuck (1)", 10, 5), channel("busy (1)", 10, 5)}, consumers, start))
+	assert.Empty(t, watchdog.Observe([]RabbitChannel{channel("stuck (1)", 10, 5), channel("busy (1)", 10, 50)}, consumers, start.Add(30*time.Second)))
+	stuck := watchdog.Observe([]RabbitChannel{channel("stuck (1)", 10, 5), channel("busy (1)", 10, 90)}, consumers, start.Add(90*time.Second))
+	assert.Len(t, stuck, 1)
+	assert.Equal(t, "stuck (1)", stuck[0].Channel)
+	assert.Equal(t, []string{"orders (ctag-1)"}, stuck[0].Consumers)
+	assert.Equal(t, 90*time.Second, stuck[0].Held)
+
+	holders := watchdog.Holders()
+	assert.Len(t, holders, 2)
+	assert.Equal(t, "stuck (1)", holders[0].Channel)
+	assert.False(t, holders[1].Stuck)
+
+	// an idle channel resets the state
+	assert.Empty(t, watchdog.Observe([]RabbitChannel{channel("stuck (1)", 0, 5)}, consumers, start.Add(2*time.Minute)))
+	assert.Empty(t, watchdog.Holders())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultMaxApps distinct client applications a user may be shared by
+const defaultMaxApps = 5
+
+// UserActivity : what a user does on the broker
+type UserActivity struct {
+	User        string   `json:"user"`
+	Connections int      `json:"connections"`
+	Channels    int      `json:"channels"`
+	Consumers   int      `json:"consumers"`
+	PublishRate float64  `json:"publishRate"`
+	DeliverRate float64  `json:"deliverRate"`
+	Vhosts      []string `json:"vhosts"`
+	PeerHosts   []string `json:"peerHosts"`
+	// Apps distinct client applications, by connection name or else by
+	// product and peer host
+	Apps   []string `json:"apps"`
+	Shared bool     `json:"shared"`
+}
+
+// connectionApp name of the application behind a connection
+func connectionApp(conn rabtap.RabbitConnection) string {
+	if name := conn.ClientProperties.ConnectionName; name != "" {
+		return name
+	}
+	return orDash(conn.ClientProperties.Product) + "@" + conn.PeerHost
+}
+
+// BuildUserActivity summarize connections, channels and consumers per user.
+// Users whose credentials are used by more than maxApps applications are
+// marked shared.
+func BuildUserActivity(info rabtap.BrokerInfo, channels []RabbitChannel, maxApps int) []UserActivity {
+	users := map[string]*UserActivity{}
+	user := func(name string) *UserActivity {
+		if users[name] == nil {
+			users[name] = &UserActivity{User: name, Vhosts: []string{}, PeerHosts: []string{}, Apps: []string{}}
+		}
+		return users[name]
+	}
+	for _, conn := range info.Connections {
+		activity := user(conn.User)
+		activity.Connections++
+		activity.Channels += conn.Channels
+		activity.Vhosts = appendUnique(activity.Vhosts, conn.Vhost)
+		activity.PeerHosts = appendUnique(activity.PeerHosts, conn.PeerHost)
+		activity.Apps = appendUnique(activity.Apps, connectionApp(conn))
+	}
+	for _, consumer := range info.Consumers {
+		user(consumer.ChannelDetails.User).Consumers++
+	}
+	for _, channel := range channels {
+		activity := user(channel.User)
+		activity.PublishRate += channel.MessageStats.PublishDetails.Rate
+		activity.DeliverRate += channel.MessageStats.DeliverGetDetails.Rate
+	}
+	report := []UserActivity{}
+	for _, activity := range users {
+		sort.Strings(activity.Vhosts)
+		sort.Strings(activity.PeerHosts)
+		sort.Strings(activity.Apps)
+		activity.Shared = len(activity.Apps) > maxApps
+		report = append(report, *activity)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Connections != report[j].Connections {
+			return report[i].Connections > report[j].Connections
+		}
+		return report[i].User < report[j].User
+	})
+	return report
+}
+
+// UserActivityReport : activity of all users
+type UserActivityReport []UserActivity
+
+// Table users as table
+func (report UserActivityReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"USER", "CONNECTIONS", "CHANNELS", "CONSUMERS", "PUBLISH", "DELIVER", "VHOSTS", "APPS"}}
+	for _, activity := range report {
+		color := None
+		if activity.Shared {
+			color = Yellow
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: orDash(activity.User), Color: color},
+			{Text: format.Count(int64(activity.Connections))},
+			{Text: format.Count(int64(activity.Channels))},
+			{Text: format.Count(int64(activity.Consumers))},
+			{Text: format.Rate(activity.PublishRate, "msg")},
+			{Text: format.Rate(activity.DeliverRate, "msg")},
+			{Text: orDash(strings.Join(activity.Vhosts, ","))},
+			{Text: format.Count(int64(len(activity.Apps))), Color: color},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("user-activity", "[--user u] [--max-apps n] [--shared] connections, consumers and rates per user", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("user-activity")
+		name := flags.String("user", "", "only this user")
+		maxApps := flags.Int("max-apps", defaultMaxApps, "applications sharing a user before it is flagged")
+		shared := flags.Bool("shared", false, "only users shared by too many applications")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		channels, err := rabbitmq.management().Channels()
+		if err != nil {
+			return nil, err
+		}
+		report := UserActivityReport{}
+		for _, activity := range BuildUserActivity(rabbitmq.info(), channels, *maxApps) {
+			if (*name == "" || activity.User == *name) && (!*shared || activity.Shared) {
+				report = append(report, activity)
+			}
+		}
+		return report, nil
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildUserActivity(t *testing.T) {
+	conn := func(user string, vhost string, name string, peer string, channels int) rabtap.RabbitConnection {
+		c := rabtap.RabbitConnection{User: user, Vhost: vhost, PeerHost: peer, Channels: channels}
+		c.ClientProperties.ConnectionName, c.ClientProperties.Product = name, "pika"
+		return c
+	}
+	info := rabtap.BrokerInfo{Connections: []rabtap.RabbitConnection{
+		conn("shared", "/", "billing", "10.0.0.1", 2),
+		conn("shared", "prod", "shop", "10.0.0.2", 1),
+		conn("shared", "/", "", "10.0.0.3", 1),
+		conn("svc", "/", "svc", "10.0.0.4", 3),
+	}}
+	consumer := rabtap.RabbitConsumer{}
+	consumer.ChannelDetails.User = "svc"
+	info.Consumers = append(info.Consumers, consumer)
+	channel := RabbitChannel{User: "svc"}
+	channel.MessageStats.PublishDetails.Rate = 12.5
+	channel.MessageStats.DeliverGetDetails.Rate = 3
+
+	report := BuildUserActivity(info, []RabbitChannel{channel, channel}, 2)
+	assert.Len(t, report, 2)
+	assert.Equal(t, UserActivity{
+		User: "shared", Connections: 3, Channels: 4, Vhosts: []string{"/", "prod"},
+		PeerHosts: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		Apps:      []string{"billing", "pika@10.0.0.3", "shop"}, Shared: true,
+	}, report[0])
+	assert.Equal(t, 1, report[1].Consumers)
+	assert.Equal(t, 25.0, report[1].PublishRate)
+	assert.False(t, report[1].Shared)
+}
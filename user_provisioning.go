@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DeclaredUser : user declared in a users file
+type DeclaredUser struct {
+	Name string `yaml:"name" json:"name"`
+	// Password plaintext password, hashed locally before it is sent
+	Password         string             `yaml:"password" json:"-"`
+	PasswordHash     string             `yaml:"password_hash" json:"password_hash"`
+	HashingAlgorithm string             `yaml:"hashing_algorithm" json:"hashing_algorithm"`
+	Tags             []string           `yaml:"tags" json:"tags"`
+	Permissions      []RabbitPermission `yaml:"permissions" json:"permissions"`
+}
+
+// UsersFile : declarative description of users and their permissions
+type UsersFile struct {
+	Users []DeclaredUser `yaml:"users"`
+	// Protected users are never modified or deleted
+	Protected []string `yaml:"protected"`
+}
+
+// LoadUsersFile read a users.yml file
+func LoadUsersFile(path string) (UsersFile, error) {
+	var file UsersFile
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	err = yaml.Unmarshal(data, &file)
+	return file, err
+}
+
+// UserPlan : actions needed to reconcile the broker with a users file
+type UserPlan struct {
+	CreateUsers       []DeclaredUser     `json:"createUsers"`
+	UpdateUsers       []DeclaredUser     `json:"updateUsers"`
+	DeleteUsers       []string           `json:"deleteUsers"`
+	SetPermissions    []RabbitPermission `json:"setPermissions"`
+	DeletePermissions []RabbitPermission `json:"deletePermissions"`
+}
+
+// PlanUsers compute the actions needed to bring users and permissions to the
+// declared state. Users not declared are deleted unless protected.
+func PlanUsers(file UsersFile, users []RabbitUser, permissions []RabbitPermission) UserPlan {
+	plan := UserPlan{
+		CreateUsers:       []DeclaredUser{},
+		UpdateUsers:       []DeclaredUser{},
+		DeleteUsers:       []string{},
+		SetPermissions:    []RabbitPermission{},
+		DeletePermissions: []RabbitPermission{},
+	}
+	protected := map[string]bool{}
+	for _, name := range file.Protected {
+		protected[name] = true
+	}
+	existing := map[string]RabbitUser{}
+	for _, user := range users {
+		existing[user.Name] = user
+	}
+	existingPerms := map[string]RabbitPermission{}
+	for _, perm := range permissions {
+		existingPerms[perm.User+"\x00"+perm.Vhost] = perm
+	}
+
+	declared := map[string]bool{}
+	declaredPerms := map[string]bool{}
+	for _, user := range file.Users {
+		if protected[user.Name] {
+			continue
+		}
+		declared[user.Name] = true
+		tags := append([]string{}, user.Tags...)
+		sort.Strings(tags)
+		if old, ok := existing[user.Name]; !ok {
+			plan.CreateUsers = append(plan.CreateUsers, user)
+		} else if !reflect.DeepEqual(old.TagList(), tags) ||
+			(user.PasswordHash != "" && user.PasswordHash != old.PasswordHash) ||
+			(user.Password != "" && !PasswordMatchesHash(user.Password, old.PasswordHash)) {
+			plan.UpdateUsers = append(plan.UpdateUsers, user)
+		}
+		for _, perm := range user.Permissions {
+			perm.User = user.Name
+			key := perm.User + "\x00" + perm.Vhost
+			declaredPerms[key] = true
+			if old, ok := existingPerms[key]; !ok || old != perm {
+				plan.SetPermissions = append(plan.SetPermissions, perm)
+			}
+		}
+	}
+	for _, user := range users {
+		if !declared[user.Name] && !protected[user.Name] {
+			plan.DeleteUsers = append(plan.DeleteUsers, user.Name)
+		}
+	}
+	for _, perm := range permissions {
+		// permissions of deleted users go away with the user
+		if declared[perm.User] && !declaredPerms[perm.User+"\x00"+perm.Vhost] {
+			plan.DeletePermissions = append(plan.DeletePermissions, perm)
+		}
+	}
+	return plan
+}
+
+// UserProvisioningOptions : how to reconcile the users file
+type UserProvisioningOptions struct {
+	File   string `json:"file"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// ParseUserProvisioningOptions : parse user provisioning options sent by the ui
+func ParseUserProvisioningOptions(str string) UserProvisioningOptions {
+	var res UserProvisioningOptions
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		fmt.Println(err)
+	}
+	return res
+}
+
+// ProvisionUsers reconcile the broker users and permissions with the file
+func (client *ManagementClient) ProvisionUsers(opts UserProvisioningOptions) (UserPlan, error) {
+	file, err := LoadUsersFile(opts.File)
+	if err != nil {
+		return UserPlan{}, err
+	}
+	users, err := client.Users()
+	if err != nil {
+		return UserPlan{}, err
+	}
+	permissions, err := client.Permissions()
+	if err != nil {
+		return UserPlan{}, err
+	}
+	plan := PlanUsers(file, users, permissions)
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	existing := map[string]RabbitUser{}
+	for _, user := range users {
+		existing[user.Name] = user
+	}
+	for _, user := range append(plan.CreateUsers, plan.UpdateUsers...) {
+		hash, algorithm := user.PasswordHash, user.HashingAlgorithm
+		if user.Password != "" {
+			if hash, err = HashPassword(user.Password); err != nil {
+				return plan, err
+			}
+			algorithm = HashingAlgorithmSHA256
+		} else if hash == "" {
+			hash, algorithm = existing[user.Name].PasswordHash, existing[user.Name].HashingAlgorithm
+		}
+		if err := client.PutUser(user.Name, hash, algorithm, user.Tags); err != nil {
+			return plan, err
+		}
+	}
+	for _, perm := range plan.SetPermissions {
+		if err := client.PutPermission(perm); err != nil {
+			return plan, err
+		}
+	}
+	for _, perm := range plan.DeletePermissions {
+		if err := client.DeletePermission(perm.Vhost, perm.User); err != nil {
+			return plan, err
+		}
+	}
+	for _, name := range plan.DeleteUsers {
+		if err := client.DeleteUser(name); err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanUsers(t *testing.T) {
+	file := UsersFile{
+		Protected: []string{"guest"},
+		Users: []DeclaredUser{
+			{Name: "orders", Tags: []string{"monitoring"}, Permissions: []RabbitPermission{
+				{Vhost: "/", Configure: ".*", Write: ".*", Read: ".*"},
+			}},
+			{Name: "billing", Tags: []string{}},
+			{Name: "guest", Tags: []string{}},
+		},
+	}
+	users := []RabbitUser{
+		{Name: "billing", Tags: "management"},
+		{Name: "guest", Tags: "administrator"},
+		{Name: "legacy", Tags: []interface{}{}},
+	}
+	permissions := []RabbitPermission{
+		{User: "billing", Vhost: "/", Configure: ".*", Write: ".*", Read: ".*"},
+		{User: "guest", Vhost: "/", Configure: ".*", Write: ".*", Read: ".*"},
+	}
+
+	plan := PlanUsers(file, users, permissions)
+	assert.Equal(t, "orders", plan.CreateUsers[0].Name)
+	assert.Equal(t, "billing", plan.UpdateUsers[0].Name)
+	assert.Equal(t, []string{"legacy"}, plan.DeleteUsers)
+	assert.Equal(t, "orders", plan.SetPermissions[0].User)
+	assert.Equal(t, 1, len(plan.DeletePermissions))
+	assert.Equal(t, "billing", plan.DeletePermissions[0].User)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RabbitUser : user as returned by the management api
+type RabbitUser struct {
+	Name             string `json:"name"`
+	PasswordHash     string `json:"password_hash"`
+	HashingAlgorithm string `json:"hashing_algorithm"`
+	// Tags is a comma separated string on older brokers and a list on newer ones
+	Tags interface{} `json:"tags"`
+}
+
+// TagList the tags of the user, sorted
+func (user RabbitUser) TagList() []string {
+	tags := []string{}
+	switch v := user.Tags.(type) {
+	case string:
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	case []interface{}:
+		for _, tag := range v {
+			tags = append(tags, fmt.Sprint(tag))
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// RabbitPermission : permissions of a user in a vhost
+type RabbitPermission struct {
+	User      string `json:"user" yaml:"user"`
+	Vhost     string `json:"vhost" yaml:"vhost"`
+	Configure string `json:"configure" yaml:"configure"`
+	Write     string `json:"write" yaml:"write"`
+	Read      string `json:"read" yaml:"read"`
+}
+
+// Users list all users
+func (client *ManagementClient) Users() ([]RabbitUser, error) {
+	var users []RabbitUser
+	err := client.get("users", &users)
+	return users, err
+}
+
+// PutUser create or update a user, tags are sent comma separated which is
+// understood by all broker versions
+func (client *ManagementClient) PutUser(name string, passwordHash string, hashingAlgorithm string, tags []string) error {
+	body := map[string]interface{}{
+		"password_hash": passwordHash,
+		"tags":          strings.Join(tags, ","),
+	}
+	if hashingAlgorithm != "" {
+		body["hashing_algorithm"] = hashingAlgorithm
+	}
+	return client.put(managementPath("users", name), body)
+}
+
+// PutUserPassword create or update a user sending the plaintext password
+// to the broker, which hashes it
+func (client *ManagementClient) PutUserPassword(name string, password string, tags []string) error {
+	body := map[string]interface{}{
+		"password": password,
+		"tags":     strings.Join(tags, ","),
+	}
+	return client.put(managementPath("users", name), body)
+}
+
+// DeleteUser delete a user
+func (client *ManagementClient) DeleteUser(name string) error {
+	return client.delete(managementPath("users", name))
+}
+
+// Permissions list the permissions of all users
+func (client *ManagementClient) Permissions() ([]RabbitPermission, error) {
+	var permissions []RabbitPermission
+	err := client.get("permissions", &permissions)
+	return permissions, err
+}
+
+func permissionPath(vhost string, user string) string {
+	return managementPath("permissions", vhost, user)
+}
+
+// PutPermission set the permissions of a user in a vhost
+func (client *ManagementClient) PutPermission(perm RabbitPermission) error {
+	body := map[string]string{
+		"configure": perm.Configure,
+		"write":     perm.Write,
+		"read":      perm.Read,
+	}
+	return client.put(permissionPath(perm.Vhost, perm.User), body)
+}
+
+// DeletePermission clear the permissions of a user in a vhost
+func (client *ManagementClient) DeletePermission(vhost string, user string) error {
+	return client.delete(permissionPath(vhost, user))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneDefinitions(t *testing.T) {
+	defs := []byte(`{
+		"vhosts": [{"name": "dev"}, {"name": "prod"}],
+		"exchanges": [{"vhost": "dev", "name": "dev.events", "type": "topic", "arguments": {"alternate-exchange": "dev.unrouted"}}],
+		"queues": [
+			{"vhost": "dev", "name": "dev.orders", "arguments": {"x-dead-letter-exchange": "dev.dlx"}},
+			{"vhost": "prod", "name": "prod.orders", "arguments": {}}],
+		"bindings": [{"vhost": "dev", "source": "amq.topic", "destination": "dev.orders", "destination_type": "queue", "routing_key": "#"}],
+		"policies": [{"vhost": "dev", "name": "dlx", "pattern": ".*", "definition": {"dead-letter-exchange": "dev.dlx"}}],
+		"permissions": [
+			{"vhost": "dev", "user": "alice", "configure": ".*", "write": ".*", "read": ".*"},
+			{"vhost": "dev", "user": "bob", "configure": ".*", "write": ".*", "read": ".*"}]
+	}`)
+	rule, err := ParseRenameRule("^dev\\.(.*)=alice.$1")
+	assert.Nil(t, err)
+	clone, report, err := CloneDefinitions(defs, CloneOptions{
+		Source: "dev", Target: "alice", Rename: []RenameRule{rule}, Users: map[string]bool{"alice": true},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "alice"}}, clone["vhosts"])
+	queues := clone["queues"].([]interface{})
+	assert.Len(t, queues, 1)
+	queue := queues[0].(map[string]interface{})
+	assert.Equal(t, "alice", queue["vhost"])
+	assert.Equal(t, "alice.orders", queue["name"])
+	assert.Equal(t, "alice.dlx", queue["arguments"].(map[string]interface{})["x-dead-letter-exchange"])
+	binding := clone["bindings"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "amq.topic", binding["source"])
+	assert.Equal(t, "alice.orders", binding["destination"])
+	policy := clone["policies"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "alice.dlx", policy["definition"].(map[string]interface{})["dead-letter-exchange"])
+
+	assert.Equal(t, 1, report.Objects["permissions"])
+	assert.Equal(t, []string{"bob"}, report.SkippedPermissions)
+	assert.Equal(t, []string{"dev.dlx -> alice.dlx", "dev.events -> alice.events", "dev.orders -> alice.orders", "dev.unrouted -> alice.unrouted"}, report.Renamed)
+
+	_, err = ParseRenameRule("no-replacement")
+	assert.NotNil(t, err)
+}
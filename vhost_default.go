@@ -0,0 +1,44 @@
+package main
+
+import "strings"
+
+// defaultVhost the vhost of commands and requests that name none
+const defaultVhost = "/"
+
+// NormalizeVhost the vhost as typed by a user, "%2F" as copied from
+// management api urls is the default vhost
+func NormalizeVhost(vhost string) string {
+	vhost = strings.TrimSpace(vhost)
+	if strings.EqualFold(vhost, "%2F") {
+		return defaultVhost
+	}
+	return vhost
+}
+
+// ResolveVhost the vhost to address, fallback when vhost is empty and the
+// default vhost when both are
+func ResolveVhost(vhost string, fallback string) string {
+	if vhost = NormalizeVhost(vhost); vhost != "" {
+		return vhost
+	}
+	if fallback = NormalizeVhost(fallback); fallback != "" {
+		return fallback
+	}
+	return defaultVhost
+}
+
+// vhost the vhost of a command addressing one vhost, the --vhost flag, the
+// default vhost of the profile or "/"
+func (cli *CLI) vhost(flag string) string {
+	return ResolveVhost(flag, cli.login.DefaultVhost)
+}
+
+// UseDefaultVhost resolve requests without vhost to vhost instead of "/"
+func (server *Server) UseDefaultVhost(vhost string) {
+	server.defaultVhost = NormalizeVhost(vhost)
+}
+
+// vhost the vhost of a request, the server's default vhost when empty
+func (server *Server) vhost(vhost string) string {
+	return ResolveVhost(vhost, server.defaultVhost)
+}
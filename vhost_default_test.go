@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveVhost(t *testing.T) {
+	assert.Equal(t, "/", NormalizeVhost("%2f"))
+	assert.Equal(t, "", NormalizeVhost(" "))
+	assert.Equal(t, "prod", ResolveVhost("prod", "test"))
+	assert.Equal(t, "test", ResolveVhost("", "test"))
+	assert.Equal(t, "/", ResolveVhost("", ""))
+	assert.Equal(t, "/", ResolveVhost("%2F", "test"))
+
+	profiles := BrokerProfiles{Profiles: map[string]BrokerProfile{
+		"billing": {Host: "mq", Vhost: "billing"},
+		"root":    {Host: "mq"},
+	}}
+	login, _ := profiles.Login("billing", RabbitmqLoginDetails{DefaultVhost: "flags"})
+	assert.Equal(t, "billing", (&CLI{login: login}).vhost(""))
+	assert.Equal(t, "other", (&CLI{login: login}).vhost("other"))
+	login, _ = profiles.Login("root", RabbitmqLoginDetails{})
+	assert.Equal(t, "/", (&CLI{login: login}).vhost(""))
+}
+
+func TestServerDefaultVhost(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "vhost")
+	defer os.RemoveAll(dir)
+	operator := &fakeOperator{}
+	server := NewServer(newPoller(&fakeFetcher{}, PollIntervals{Default: time.Second}))
+	server.EnableActions(operator, NewAuditLog(filepath.Join(dir, "audit.log")))
+
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("POST", "/api/actions/purge", strings.NewReader(body)))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, post(`{"name":"orders"}`))
+	server.UseDefaultVhost("billing")
+	assert.Equal(t, http.StatusOK, post(`{"name":"orders"}`))
+	assert.Equal(t, http.StatusOK, post(`{"vhost":"%2F","name":"orders"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"vhost":"/"}`))
+	assert.Equal(t, []string{"purge //orders", "purge billing/orders", "purge //orders"}, operator.calls)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sort"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultTopUsers users listed per vhost in the usage report
+const defaultTopUsers = 3
+
+// UserUsage : traffic of a user's connections to a vhost
+type UserUsage struct {
+	User        string `json:"user"`
+	Connections int    `json:"connections"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// VhostUsage : resources a vhost uses, for chargeback and capacity reviews
+type VhostUsage struct {
+	Vhost        string      `json:"vhost"`
+	Queues       int         `json:"queues"`
+	Messages     int64       `json:"messages"`
+	MessageBytes int64       `json:"messageBytes"`
+	Published    int64       `json:"published"`
+	Delivered    int64       `json:"delivered"`
+	Connections  int         `json:"connections"`
+	RecvBytes    int64       `json:"recvBytes"`
+	SendBytes    int64       `json:"sendBytes"`
+	TopUsers     []UserUsage `json:"topUsers"`
+}
+
+// VhostUsageReport : usage of all vhosts
+type VhostUsageReport []VhostUsage
+
+// BuildVhostUsage sum queues and connections per vhost. Published and
+// delivered are the message counters of the queues since their creation.
+// Users are ranked by the bytes their connections transferred.
+func BuildVhostUsage(info rabtap.BrokerInfo, topUsers int) VhostUsageReport {
+	vhosts := map[string]*VhostUsage{}
+	users := map[string]map[string]*UserUsage{}
+	vhost := func(name string) *VhostUsage {
+		if vhosts[name] == nil {
+			vhosts[name] = &VhostUsage{Vhost: name, TopUsers: []UserUsage{}}
+			users[name] = map[string]*UserUsage{}
+		}
+		return vhosts[name]
+	}
+	for _, q := range info.Queues {
+		usage := vhost(q.Vhost)
+		usage.Queues++
+		usage.Messages += int64(q.Messages)
+		usage.MessageBytes += int64(q.MessageBytes)
+		usage.Published += int64(q.MessageStats.Publish)
+		usage.Delivered += int64(q.MessageStats.DeliverGet)
+	}
+	for _, c := range info.Connections {
+		usage := vhost(c.Vhost)
+		usage.Connections++
+		usage.RecvBytes += int64(c.RecvOct)
+		usage.SendBytes += int64(c.SendOct)
+		user := users[c.Vhost][c.User]
+		if user == nil {
+			user = &UserUsage{User: c.User}
+			users[c.Vhost][c.User] = user
+		}
+		user.Connections++
+		user.Bytes += int64(c.RecvOct + c.SendOct)
+	}
+
+	report := VhostUsageReport{}
+	for name, usage := range vhosts {
+		for _, user := range users[name] {
+			usage.TopUsers = append(usage.TopUsers, *user)
+		}
+		sort.Slice(usage.TopUsers, func(i, j int) bool {
+			a, b := usage.TopUsers[i], usage.TopUsers[j]
+			if a.Bytes != b.Bytes {
+				return a.Bytes > b.Bytes
+			}
+			return a.User < b.User
+		})
+		if len(usage.TopUsers) > topUsers {
+			usage.TopUsers = usage.TopUsers[:topUsers]
+		}
+		report = append(report, *usage)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Vhost < report[j].Vhost })
+	return report
+}
+
+// Table usage per vhost as table
+func (report VhostUsageReport) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "QUEUES", "MESSAGES", "BYTES", "PUBLISHED", "DELIVERED", "CONNECTIONS", "TRAFFIC", "TOP USERS"}}
+	for _, usage := range report {
+		top := ""
+		for i, user := range usage.TopUsers {
+			if i > 0 {
+				top += " "
+			}
+			top += orDash(user.User) + "(" + format.Bytes(user.Bytes) + ")"
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: usage.Vhost},
+			{Text: format.Count(int64(usage.Queues))},
+			{Text: format.Count(usage.Messages)},
+			{Text: format.Bytes(usage.MessageBytes)},
+			{Text: format.Count(usage.Published)},
+			{Text: format.Count(usage.Delivered)},
+			{Text: format.Count(int64(usage.Connections))},
+			{Text: format.Bytes(usage.RecvBytes + usage.SendBytes)},
+			{Text: orDash(top)},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("vhost-usage", "[--top n] queues, messages, bytes, connections and top users per vhost", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("vhost-usage")
+		top := flags.Int("top", defaultTopUsers, "users listed per vhost")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		return BuildVhostUsage(rabbitmq.info(), *top), nil
+	})
+}
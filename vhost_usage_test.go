@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	rabtap "github.com/jandelgado/rabtap/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildVhostUsage(t *testing.T) {
+	info := rabtap.BrokerInfo{
+		Queues: []rabtap.RabbitQueue{
+			{Vhost: "a", Name: "q1", Messages: 2, MessageBytes: 200},
+			{Vhost: "a", Name: "q2", Messages: 3, MessageBytes: 300},
+			{Vhost: "b", Name: "q1"},
+		},
+		Connections: []rabtap.RabbitConnection{
+			{Vhost: "a", User: "alice", RecvOct: 10, SendOct: 10},
+			{Vhost: "a", User: "bob", RecvOct: 100},
+			{Vhost: "a", User: "carol", RecvOct: 1},
+		},
+	}
+	info.Queues[0].MessageStats.Publish = 40
+	report := BuildVhostUsage(info, 2)
+	assert.Len(t, report, 2)
+	assert.Equal(t, VhostUsage{
+		Vhost: "a", Queues: 2, Messages: 5, MessageBytes: 500, Published: 40, Connections: 3, RecvBytes: 111, SendBytes: 10,
+		TopUsers: []UserUsage{{"bob", 1, 100}, {"alice", 1, 20}},
+	}, report[0])
+	assert.Equal(t, []UserUsage{}, report[1].TopUsers)
+}
+
+func TestTableWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	table := Table{Headers: []string{"A", "B"}, Rows: [][]Cell{{{Text: "x,y"}, {Text: "1"}}}}
+	assert.Nil(t, table.WriteCSV(&buf))
+	assert.Equal(t, "A,B\n\"x,y\",1\n", buf.String())
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	rabtap "github.com/jandelgado/rabtap/pkg"
+)
+
+// defaultMaxMessages backlog above which queues are highlighted
+const defaultMaxMessages = 10000
+
+// QueueList : queues listing with highlighting of unhealthy queues
+type QueueList struct {
+	Queues      []rabtap.RabbitQueue `json:"queues"`
+	MaxMessages int                  `json:"-"`
+	// NoRates the broker runs with rates_mode=none, rates are unknown
+	NoRates bool `json:"-"`
+}
+
+// queueColor red for queues over the threshold or in flow state, yellow
+// for queues with messages but nobody consuming
+func queueColor(queue rabtap.RabbitQueue, maxMessages int) Color {
+	switch {
+	case queue.Messages > maxMessages || queue.State == "flow":
+		return Red
+	case queue.Messages > 0 && queue.Consumers == 0:
+		return Yellow
+	}
+	return Green
+}
+
+// Table queues as table
+func (list QueueList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"VHOST", "NAME", "STATE", "MESSAGES", "READY", "UNACKED", "BYTES", "IN", "OUT", "CONSUMERS"}}
+	for _, queue := range list.Queues {
+		color := queueColor(queue, list.MaxMessages)
+		in, out := "-", "-"
+		if !list.NoRates {
+			in = format.Rate(queue.MessageStats.PublishDetails.Rate, "msg")
+			out = format.Rate(queue.MessageStats.DeliverGetDetails.Rate, "msg")
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: queue.Vhost},
+			{Text: queue.Name, Color: color},
+			{Text: queue.State, Color: color},
+			{Text: format.Count(int64(queue.Messages))},
+			{Text: format.Count(int64(queue.MessagesReady))},
+			{Text: format.Count(int64(queue.MessagesUnacknowledged))},
+			{Text: format.Bytes(int64(queue.MessageBytes))},
+			{Text: in},
+			{Text: out},
+			{Text: format.Count(int64(queue.Consumers))},
+		})
+	}
+	return table
+}
+
+// ConnectionList : connections listing highlighting blocked connections
+type ConnectionList struct {
+	Connections []rabtap.RabbitConnection   `json:"connections"`
+	Extras      map[string]ConnectionExtras `json:"-"`
+}
+
+// connectionColor red for connections in flow control, yellow for blocked ones
+func connectionColor(conn rabtap.RabbitConnection) Color {
+	switch conn.State {
+	case "flow":
+		return Red
+	case "blocked", "blocking":
+		return Yellow
+	case "running":
+		return Green
+	}
+	return None
+}
+
+// Table connections as table
+func (list ConnectionList) Table(format NumberFormat) Table {
+	table := Table{Headers: []string{"NAME", "PROTOCOL", "USER", "VHOST", "STATE", "CHANNELS", "RECV", "SENT", "CLIENT"}}
+	for _, conn := range list.Connections {
+		color := connectionColor(conn)
+		channels := "-"
+		if hasChannels(conn) {
+			channels = format.Count(int64(conn.Channels))
+		}
+		table.Rows = append(table.Rows, []Cell{
+			{Text: conn.Name},
+			{Text: orDash(conn.Protocol)},
+			{Text: orDash(conn.User)},
+			{Text: orDash(conn.Vhost)},
+			{Text: orDash(conn.State), Color: color},
+			{Text: channels},
+			{Text: format.Bytes(int64(conn.RecvOct))},
+			{Text: format.Bytes(int64(conn.SendOct))},
+			{Text: connectionClient(conn, list.Extras[conn.Name])},
+		})
+	}
+	return table
+}
+
+func init() {
+	registerCommand("queues", "[--vhost v] [--node n] [--max-messages n] list queues", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("queues")
+		vhost := flags.String("vhost", "", "only queues of this vhost")
+		node := flags.String("node", "", "only queues located on this node")
+		maxMessages := flags.Int("max-messages", defaultMaxMessages, "highlight queues with more messages")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = NormalizeVhost(*vhost)
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		list := QueueList{Queues: []rabtap.RabbitQueue{}, MaxMessages: *maxMessages, NoRates: RatesDisabled(rabbitmq.info().Overview)}
+		for _, queue := range rabbitmq.info().Queues {
+			if (*vhost == "" || queue.Vhost == *vhost) && matchNode(queue.Node, *node) {
+				list.Queues = append(list.Queues, queue)
+			}
+		}
+		return list, nil
+	})
+
+	registerCommand("connections", "[--vhost v] [--node n] list connections", func(cli *CLI, args []string) (interface{}, error) {
+		flags := newFlagSet("connections")
+		vhost := flags.String("vhost", "", "only connections to this vhost")
+		node := flags.String("node", "", "only connections to this node")
+		if err := parseFlags(flags, args); err != nil {
+			return nil, err
+		}
+		*vhost = NormalizeVhost(*vhost)
+		rabbitmq, err := cli.connect()
+		if err != nil {
+			return nil, err
+		}
+		list := ConnectionList{Connections: []rabtap.RabbitConnection{}}
+		otherProtocols := false
+		for _, conn := range rabbitmq.info().Connections {
+			if (*vhost == "" || conn.Vhost == *vhost) && matchNode(conn.Node, *node) {
+				list.Connections = append(list.Connections, conn)
+				otherProtocols = otherProtocols || !hasChannels(conn)
+			}
+		}
+		if otherProtocols {
+			// client ids of mqtt and stomp connections
+			if list.Extras, err = rabbitmq.management().ConnectionExtras(); err != nil {
+				subsystemLog("cli").Warnf("fetching connection details failed: %s", err)
+			}
+		}
+		return list, nil
+	})
+}